@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/admin"
+)
+
+const usage = `usage: agentctl -addr host:port [-timeout duration] command [argument]
+
+commands:
+  log-level info|silent   set the log level of the agent
+  enable-processor NAME   enable a processor of the agent
+  disable-processor NAME  disable a processor of the agent
+  pause-drain DRAIN       pause a drain by its exact URL or drain hash
+  resume-drain DRAIN      resume a paused drain
+  stats                   dump the pipeline stats of the agent
+`
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("agentctl: ")
+
+	addr := flag.String("addr", "", "address of the admin service of the agent, e.g. 127.0.0.1:8089")
+	timeout := flag.Duration("timeout", 5*time.Second, "timeout of the request")
+	flag.Usage = func() { fmt.Fprint(flag.CommandLine.Output(), usage) }
+	flag.Parse()
+
+	args := flag.Args()
+	if *addr == "" || len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	command, arg := args[0], ""
+	if command != "stats" {
+		if len(args) != 2 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		arg = args[1]
+	}
+
+	client, err := admin.NewClient(*addr)
+	if err != nil {
+		log.Fatalf("failed to connect to %s: %s", *addr, err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	switch command {
+	case "log-level":
+		err = client.SetLogLevel(ctx, arg)
+	case "enable-processor":
+		err = client.SetProcessorEnabled(ctx, arg, true)
+	case "disable-processor":
+		err = client.SetProcessorEnabled(ctx, arg, false)
+	case "pause-drain":
+		err = client.SetDrainPaused(ctx, arg, true)
+	case "resume-drain":
+		err = client.SetDrainPaused(ctx, arg, false)
+	case "stats":
+		var stats map[string]any
+		stats, err = client.Stats(ctx)
+		if err == nil {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(stats)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		cancel()
+		log.Fatalf("%s failed: %s", command, err)
+	}
+}
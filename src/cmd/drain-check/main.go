@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	metrics "code.cloudfoundry.org/go-metric-registry"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/ingress/bindings"
+)
+
+const usage = `usage: drain-check [flags] DRAIN_URL
+
+Checks a syslog drain the way the Syslog Agent would: the drain URL is
+validated, the drain host is resolved and checked against the blacklist, a
+connection is made and a test RFC5424 message is sent to the drain.
+
+flags:
+`
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("drain-check: ")
+
+	certFile := flag.String("cert", "", "client certificate file of the binding for mutual TLS")
+	keyFile := flag.String("key", "", "client key file of the binding for mutual TLS")
+	caFile := flag.String("ca", "", "CA file of the binding used to verify the drain")
+	skipCertVerify := flag.Bool("skip-cert-verify", false, "do not verify the certificate of the drain")
+	var blacklist bindings.BlacklistRanges
+	flag.Func("blacklist", "blacklisted IP ranges of the agent, e.g. 10.0.0.0-10.255.255.255,127.0.0.1-127.0.0.1", blacklist.UnmarshalEnv)
+	appID := flag.String("app-id", "drain-check", "app ID of the test message")
+	hostname := flag.String("hostname", "drain-check", "hostname of the test message")
+	message := flag.String("message", "drain-check test message", "payload of the test message")
+	timeout := flag.Duration("timeout", 30*time.Second, "timeout of the connection and of sending the test message")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	b := syslog.Binding{
+		AppId:    *appID,
+		Hostname: *hostname,
+		Drain: syslog.Drain{
+			Url: flag.Arg(0),
+			Credentials: syslog.Credentials{
+				Cert: readFile(*certFile),
+				Key:  readFile(*keyFile),
+				CA:   readFile(*caFile),
+			},
+		},
+	}
+
+	c := &checker{
+		blacklist:      &blacklist,
+		skipCertVerify: *skipCertVerify,
+		message:        *message,
+		timeout:        *timeout,
+		out:            os.Stdout,
+	}
+	if !c.check(b) {
+		os.Exit(1)
+	}
+}
+
+func readFile(path string) string {
+	if path == "" {
+		return ""
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("failed to read %s: %s", path, err)
+	}
+	return string(data)
+}
+
+// checker runs the checks of a drain and prints a report of them.
+type checker struct {
+	blacklist      *bindings.BlacklistRanges
+	skipCertVerify bool
+	message        string
+	timeout        time.Duration
+	out            io.Writer
+}
+
+// check reports whether all checks of the drain of the binding passed. The
+// checks stop at the first failure.
+func (c *checker) check(b syslog.Binding) bool {
+	u, err := url.Parse(b.Drain.Url)
+	if err != nil {
+		c.report("drain", "invalid URL: %s", err)
+		return false
+	}
+	c.report("drain", "%s", anonymize(u))
+
+	b, ok := c.validate(b)
+	if !ok {
+		return false
+	}
+	c.resolve(u)
+
+	m := metrics.NewRegistry(log.New(io.Discard, "", 0))
+	trustedCAs, err := x509.SystemCertPool()
+	if err != nil {
+		trustedCAs = x509.NewCertPool()
+	}
+	internalTLSConfig, externalTLSConfig, err := syslog.NewDrainTLSConfigs(trustedCAs, nil, c.skipCertVerify)
+	if err != nil {
+		log.Fatalf("failed to create TLS configs: %s", err)
+	}
+	deliveries := syslog.NewDeliveries(nil)
+	f := syslog.NewWriterFactory(
+		internalTLSConfig,
+		externalTLSConfig,
+		syslog.DefaultNetworkTimeoutConfig(),
+		m,
+		syslog.WithDeliveries(deliveries),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	if !c.connect(ctx, f, b) {
+		return false
+	}
+	return c.send(ctx, f, deliveries, b)
+}
+
+// validate applies the validation and URL parameter parsing of the agent
+// to the binding. Unlike the agent it drops bindings that fail to resolve
+// or are blacklisted regardless of the configured policies.
+func (c *checker) validate(b syslog.Binding) (syslog.Binding, bool) {
+	var violations bytes.Buffer
+	policies := bindings.FilterPolicies{
+		Scheme:         bindings.FilterPolicyDrop,
+		Blacklist:      bindings.FilterPolicyDrop,
+		ResolveFailure: bindings.FilterPolicyDrop,
+	}
+	fetcher := bindings.NewDrainParamParser(
+		bindings.NewFilteredBindingFetcher(
+			c.blacklist,
+			staticFetcher{b},
+			metrics.NewRegistry(log.New(io.Discard, "", 0)),
+			policies,
+			log.New(&violations, "", 0),
+		),
+		true,
+	)
+
+	bs, err := fetcher.FetchBindings()
+	if err != nil || len(bs) != 1 {
+		c.report("validation", "failed: %s", strings.TrimSpace(violations.String()))
+		return b, false
+	}
+	c.report("validation", "ok")
+	return bs[0], true
+}
+
+// resolve reports all addresses of the drain host. The agent connects to
+// any of them.
+func (c *checker) resolve(u *url.URL) {
+	ips, err := net.LookupIP(u.Hostname())
+	if err != nil {
+		c.report("dns", "failed: %s", err)
+		return
+	}
+
+	addrs := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		if c.blacklist.CheckBlacklist(ip) != nil {
+			addrs = append(addrs, ip.String()+" (blacklisted)")
+			continue
+		}
+		addrs = append(addrs, ip.String())
+	}
+	c.report("dns", "%s", strings.Join(addrs, ", "))
+}
+
+// connect probes the drain like the agent does with drain probes enabled.
+func (c *checker) connect(ctx context.Context, f syslog.WriterFactory, b syslog.Binding) bool {
+	ub, err := syslog.NewURLBinding(ctx, b)
+	if err != nil {
+		c.report("connection", "failed: %s", err)
+		return false
+	}
+
+	start := time.Now()
+	if err := f.Probe(ctx, ub); err != nil {
+		c.report("connection", "failed: %s", err)
+		return false
+	}
+
+	var method string
+	switch ub.URL.Scheme {
+	case "syslog", "forward":
+		method = "TCP connect"
+	case "syslog-tls", "forward-tls":
+		method = "TLS handshake"
+	default:
+		method = "HEAD request"
+	}
+	c.report("connection", "ok (%s in %s)", method, time.Since(start).Round(time.Millisecond))
+	return true
+}
+
+// send writes a test log message to the drain with the writer the agent
+// would use. The message counts as delivered once the writer reports it as
+// egressed, which batching writers only do once the drain accepted the
+// batch.
+func (c *checker) send(ctx context.Context, f syslog.WriterFactory, deliveries *syslog.Deliveries, b syslog.Binding) bool {
+	w, err := f.NewDrainWriter(ctx, b)
+	if err != nil {
+		c.report("message", "failed: %s", err)
+		return false
+	}
+
+	env := &loggregator_v2.Envelope{
+		Timestamp:  time.Now().UnixNano(),
+		SourceId:   b.AppId,
+		InstanceId: "0",
+		Tags:       map[string]string{"source_type": "DRAIN-CHECK"},
+		Message: &loggregator_v2.Envelope_Log{
+			Log: &loggregator_v2.Log{
+				Payload: []byte(c.message),
+				Type:    loggregator_v2.Log_OUT,
+			},
+		},
+	}
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		err := w.Write(ctx, env)
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+		done <- err
+	}()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("not delivered within %s, see the errors above", c.timeout)
+	}
+	if err != nil {
+		c.report("message", "failed: %s", err)
+		return false
+	}
+
+	d := deliveries.Deliveries(b.AppId)
+	if len(d) == 0 || d[0].LastDelivery.IsZero() {
+		c.report("message", "failed: the drain did not accept the message, see the errors above")
+		return false
+	}
+	c.report("message", "ok (delivered in %s)", time.Since(start).Round(time.Millisecond))
+	return true
+}
+
+func (c *checker) report(step, format string, v ...any) {
+	fmt.Fprintf(c.out, "%-12s"+format+"\n", append([]any{step + ":"}, v...)...)
+}
+
+// anonymize returns the drain URL without credentials and query
+// parameters.
+func anonymize(u *url.URL) string {
+	anonymous := *u
+	anonymous.User = nil
+	anonymous.RawQuery = ""
+	return anonymous.String()
+}
+
+// staticFetcher returns its bindings on every fetch.
+type staticFetcher []syslog.Binding
+
+func (f staticFetcher) FetchBindings() ([]syslog.Binding, error) {
+	return f, nil
+}
+
+func (f staticFetcher) DrainLimit() int {
+	return len(f)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"net"
+	"net/url"
+	"time"
+
+	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/ingress/bindings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("checker", func() {
+	var (
+		listener net.Listener
+		messages chan string
+		out      *bytes.Buffer
+		c        *checker
+	)
+
+	BeforeEach(func() {
+		var err error
+		listener, err = net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+
+		messages = make(chan string, 10)
+		go func(l net.Listener, messages chan<- string) {
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				go func() {
+					defer conn.Close()
+					s := bufio.NewScanner(conn)
+					for s.Scan() {
+						messages <- s.Text()
+					}
+				}()
+			}
+		}(listener, messages)
+
+		out = &bytes.Buffer{}
+		c = &checker{
+			blacklist: &bindings.BlacklistRanges{},
+			message:   "some-message",
+			timeout:   5 * time.Second,
+			out:       out,
+		}
+	})
+
+	AfterEach(func() {
+		listener.Close()
+	})
+
+	newWriterFactory := func(opts ...syslog.WriterFactoryOption) syslog.WriterFactory {
+		return syslog.NewWriterFactory(
+			&tls.Config{},
+			&tls.Config{},
+			syslog.DefaultNetworkTimeoutConfig(),
+			metricsHelpers.NewMetricsRegistry(),
+			opts...,
+		)
+	}
+
+	drainBinding := func(drainURL string) syslog.Binding {
+		return syslog.Binding{
+			AppId:    "some-app",
+			Hostname: "some-host",
+			Drain:    syslog.Drain{Url: drainURL},
+		}
+	}
+
+	Describe("check", func() {
+		It("sends a test message to the drain", func() {
+			Expect(c.check(drainBinding("syslog://user:pass@" + listener.Addr().String() + "?disable-metadata=true"))).To(BeTrue())
+
+			Eventually(messages).Should(Receive(ContainSubstring("some-message")))
+			Expect(out.String()).To(ContainSubstring("drain:      syslog://" + listener.Addr().String() + "\n"))
+			Expect(out.String()).To(ContainSubstring("validation: ok\n"))
+			Expect(out.String()).To(ContainSubstring("dns:        127.0.0.1\n"))
+			Expect(out.String()).To(ContainSubstring("connection: ok (TCP connect in"))
+			Expect(out.String()).To(ContainSubstring("message:    ok (delivered in"))
+			Expect(out.String()).ToNot(ContainSubstring("pass"))
+		})
+
+		It("stops at the first failed check", func() {
+			Expect(c.check(drainBinding("ftp://" + listener.Addr().String()))).To(BeFalse())
+
+			Expect(out.String()).To(ContainSubstring("validation: failed"))
+			Expect(out.String()).ToNot(ContainSubstring("connection:"))
+			Consistently(messages, 100*time.Millisecond).ShouldNot(Receive())
+		})
+
+		It("reports an invalid URL", func() {
+			Expect(c.check(drainBinding("://invalid"))).To(BeFalse())
+
+			Expect(out.String()).To(HavePrefix("drain:      invalid URL"))
+		})
+	})
+
+	Describe("validate", func() {
+		It("applies the URL parameters of the binding", func() {
+			b, ok := c.validate(drainBinding("syslog://" + listener.Addr().String() + "?disable-metadata=true"))
+
+			Expect(ok).To(BeTrue())
+			Expect(b.OmitMetadata).To(BeTrue())
+			Expect(out.String()).To(Equal("validation: ok\n"))
+		})
+
+		It("fails for blacklisted drains", func() {
+			var err error
+			c.blacklist, err = bindings.NewBlacklistRanges(bindings.BlacklistRange{Start: "127.0.0.1", End: "127.0.0.1"})
+			Expect(err).ToNot(HaveOccurred())
+
+			_, ok := c.validate(drainBinding("syslog://" + listener.Addr().String()))
+
+			Expect(ok).To(BeFalse())
+			Expect(out.String()).To(HavePrefix("validation: failed: "))
+			Expect(out.String()).To(ContainSubstring("127.0.0.1"))
+		})
+
+		It("fails for unsupported schemes", func() {
+			_, ok := c.validate(drainBinding("ftp://" + listener.Addr().String()))
+
+			Expect(ok).To(BeFalse())
+			Expect(out.String()).To(HavePrefix("validation: failed: "))
+		})
+	})
+
+	Describe("resolve", func() {
+		It("marks blacklisted addresses", func() {
+			var err error
+			c.blacklist, err = bindings.NewBlacklistRanges(bindings.BlacklistRange{Start: "127.0.0.1", End: "127.0.0.1"})
+			Expect(err).ToNot(HaveOccurred())
+
+			c.resolve(&url.URL{Host: listener.Addr().String()})
+
+			Expect(out.String()).To(Equal("dns:        127.0.0.1 (blacklisted)\n"))
+		})
+
+		It("reports hosts that cannot be resolved", func() {
+			c.resolve(&url.URL{Host: "drain.invalid"})
+
+			Expect(out.String()).To(HavePrefix("dns:        failed: "))
+		})
+	})
+
+	Describe("connect", func() {
+		It("reports a successful connection", func() {
+			f := newWriterFactory()
+
+			ok := c.connect(context.Background(), f, drainBinding("syslog://"+listener.Addr().String()))
+
+			Expect(ok).To(BeTrue())
+			Expect(out.String()).To(HavePrefix("connection: ok (TCP connect in "))
+		})
+
+		It("reports drains that refuse the connection", func() {
+			addr := listener.Addr().String()
+			listener.Close()
+			f := newWriterFactory()
+
+			ok := c.connect(context.Background(), f, drainBinding("syslog://"+addr))
+
+			Expect(ok).To(BeFalse())
+			Expect(out.String()).To(HavePrefix("connection: failed: "))
+		})
+	})
+
+	Describe("send", func() {
+		It("fails when the drain does not accept the message in time", func() {
+			addr := listener.Addr().String()
+			listener.Close()
+			c.timeout = 100 * time.Millisecond
+			ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+			defer cancel()
+			deliveries := syslog.NewDeliveries(nil)
+			f := newWriterFactory(syslog.WithDeliveries(deliveries))
+
+			ok := c.send(ctx, f, deliveries, drainBinding("syslog://"+addr))
+
+			Expect(ok).To(BeFalse())
+			Expect(out.String()).To(HavePrefix("message:    failed: "))
+		})
+	})
+})
@@ -90,6 +90,7 @@ type spyLoggregatorV2Ingress struct {
 	blocking bool
 
 	addr      string
+	cfgFile   string
 	srv       *grpc.Server
 	close     func()
 	envelopes chan *loggregator_v2.Envelope
@@ -128,6 +129,7 @@ func startSpyLoggregatorV2Ingress(testCerts *testhelper.TestCerts, commonName st
 	contents := fmt.Sprintf(configTempl, port[len(port)-1])
 	err = os.WriteFile(tmpfn, []byte(contents), 0600)
 	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+	s.cfgFile = tmpfn
 
 	go s.srv.Serve(lis) // nolint:errcheck
 
@@ -1,9 +1,16 @@
 package app
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
+	"time"
 
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/agentlib"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/config"
+	egress_v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
+	ingress_v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/ingress/v2"
 
 	"code.cloudfoundry.org/go-envstruct"
 )
@@ -16,22 +23,331 @@ type GRPC struct {
 	CertFile     string   `env:"AGENT_CERT_FILE_PATH, required, report"`
 	KeyFile      string   `env:"AGENT_KEY_FILE_PATH, required, report"`
 	CipherSuites []string `env:"AGENT_CIPHER_SUITES, report"`
+	// HealthAndReflection registers the gRPC health checking and reflection
+	// services on the ingress servers.
+	HealthAndReflection bool `env:"AGENT_GRPC_HEALTH_AND_REFLECTION, report"`
+}
+
+// UnixSocket stores the configuration for an optional gRPC ingress on a
+// Unix domain socket for colocated emitters. The socket does not use TLS;
+// access is controlled by the socket file permissions.
+type UnixSocket struct {
+	Path        string `env:"AGENT_UNIX_SOCKET_PATH, report"`
+	Permissions string `env:"AGENT_UNIX_SOCKET_PERMISSIONS, report"`
+}
+
+// NamedPipe stores the configuration for an optional gRPC ingress on a
+// Windows named pipe for colocated emitters. The pipe does not use TLS;
+// access is controlled by its security descriptor in SDDL form. Remote
+// clients are rejected.
+type NamedPipe struct {
+	Name string `env:"AGENT_NAMED_PIPE_NAME, report"`
+	SDDL string `env:"AGENT_NAMED_PIPE_SDDL, report"`
+}
+
+// PlacementMetadata stores the configuration for tagging envelopes with
+// placement metadata, such as the cell ID or Kubernetes node, read from a
+// file or an HTTP endpoint. The file takes precedence if both are set.
+type PlacementMetadata struct {
+	File            string        `env:"PLACEMENT_METADATA_FILE, report"`
+	URL             string        `env:"PLACEMENT_METADATA_URL, report"`
+	RefreshInterval time.Duration `env:"PLACEMENT_METADATA_REFRESH_INTERVAL, report"`
+}
+
+// Journald stores the configuration for reading the logs of system
+// components from systemd-journald. Entries are read by following the
+// journal with journalctl and, if SocketPath is set, from connections to a
+// unix socket in the JSON export format of journalctl. The journal is read
+// from the cursor persisted in CursorFile.
+type Journald struct {
+	Enabled    bool     `env:"JOURNALD_ENABLED, report"`
+	Units      []string `env:"JOURNALD_UNITS, report"`
+	SocketPath string   `env:"JOURNALD_SOCKET_PATH, report"`
+	CursorFile string   `env:"JOURNALD_CURSOR_FILE, report"`
+}
+
+// FileTail stores the configuration for tailing the log files of components
+// that only write logs to files. Files matching the globs are read from
+// the offsets persisted in CheckpointFile.
+type FileTail struct {
+	Globs          []string      `env:"FILE_TAIL_GLOBS, report"`
+	CheckpointFile string        `env:"FILE_TAIL_CHECKPOINT_FILE, report"`
+	PollInterval   time.Duration `env:"FILE_TAIL_POLL_INTERVAL, report"`
 }
 
 // Config holds the configuration for the forwarder agent
 type Config struct {
 	UseRFC3339 bool `env:"USE_RFC3339"`
+	// EventLogSource additionally writes the logs to the Windows Event Log
+	// under the event source. It is only supported on Windows.
+	EventLogSource string `env:"EVENT_LOG_SOURCE, report"`
+	// LogThrottleInterval coalesces repeated identical log lines into a
+	// summary per interval. Zero disables throttling.
+	LogThrottleInterval time.Duration `env:"LOG_THROTTLE_INTERVAL, report"`
 	// DownstreamIngressPortCfg will define consumers on localhost that will
 	// receive each envelope. It is assumed to adhere to the Loggregator Ingress
 	// Service and use the provided TLS configuration.
 	DownstreamIngressPortCfg string `env:"DOWNSTREAM_INGRESS_PORT_GLOB, report"`
+	// DownstreamRescanInterval is how often the files matching
+	// DownstreamIngressPortCfg are scanned for added, changed and removed
+	// consumers. Zero only scans them at startup.
+	DownstreamRescanInterval time.Duration `env:"DOWNSTREAM_RESCAN_INTERVAL, report"`
 	GRPC                     GRPC
+	UnixSocket               UnixSocket
+	NamedPipe                NamedPipe
+	PlacementMetadata        PlacementMetadata
+	Journald                 Journald
+	FileTail                 FileTail
 	MetricsServer            config.MetricsServer
 	Tags                     map[string]string `env:"AGENT_TAGS"`
+	AgentVersionTag          bool              `env:"AGENT_VERSION_TAG, report"`
+	PriorityDropping         bool              `env:"PRIORITY_DROPPING, report"`
+	MaxTagBytes              int               `env:"MAX_TAG_BYTES, report"`
 	DebugMetrics             bool              `env:"DEBUG_METRICS, report"`
 	EmitOTelTraces           bool              `env:"EMIT_OTEL_TRACES, report"`
 	EmitOTelMetrics          bool              `env:"EMIT_OTEL_METRICS, report"`
 	EmitOTelLogs             bool              `env:"EMIT_OTEL_LOGS, report"`
+
+	// IDRewriteRules rewrite the source IDs and instance IDs of envelopes
+	// before they are written downstream.
+	IDRewriteRules egress_v2.IDRewriter `env:"ID_REWRITE_RULES, report"`
+
+	// MetricRules rename metrics and promote counters to gauges before
+	// envelopes are written downstream.
+	MetricRules egress_v2.MetricRules `env:"METRIC_RULES, report"`
+
+	// OrderingLanes processes and writes envelopes in that many lanes in
+	// parallel. The envelopes of a source ID always go through the same
+	// lane and keep their order.
+	OrderingLanes int `env:"ORDERING_LANES, report"`
+
+	// AdminPort is the port on localhost of the admin service used by
+	// agentctl. Zero disables it.
+	AdminPort uint16 `env:"ADMIN_PORT, report"`
+
+	// Autotune sizes GOMAXPROCS, the ingress diode and, unless
+	// OrderingLanes is set, the ordering lanes by the CPUs available to the
+	// agent, e.g. its cgroup CPU quota, instead of fixed defaults.
+	Autotune bool `env:"AUTOTUNE, report"`
+
+	// CounterCardinalityLimit is the number of distinct tag sets of a
+	// counter name of a source ID. Further tag sets are aggregated into a
+	// single series. Zero disables the limit.
+	CounterCardinalityLimit int `env:"COUNTER_CARDINALITY_LIMIT, report"`
+
+	// GaugeDownsamplingWindow aggregates gauges per series over the window
+	// and writes only the GaugeDownsamplingStatistics of every window
+	// downstream. Zero disables downsampling.
+	GaugeDownsamplingWindow     time.Duration             `env:"GAUGE_DOWNSAMPLING_WINDOW, report"`
+	GaugeDownsamplingStatistics egress_v2.GaugeStatistics `env:"GAUGE_DOWNSAMPLING_STATISTICS, report"`
+
+	// DownstreamCreditWindow is the number of envelopes that may be pushed
+	// to a downstream consumer before it has accepted them. Envelopes
+	// beyond the window are not pushed and are counted as backpressure.
+	// Zero disables flow control.
+	DownstreamCreditWindow int `env:"DOWNSTREAM_CREDIT_WINDOW, report"`
+
+	// BatchMetadata tags ingressed envelopes with their emitter and reports
+	// the delay of batches per emitter at ingress and the delivery latency
+	// per emitter at egress.
+	BatchMetadata bool `env:"BATCH_METADATA, report"`
+	// EnvelopeSizeMetrics reports the sizes of ingressed envelopes by
+	// envelope type and of the payloads of their logs in histograms.
+	EnvelopeSizeMetrics bool `env:"ENVELOPE_SIZE_METRICS, report"`
+
+	// FutureTimestampTolerance is how far in the future ingressed envelopes
+	// may be timestamped before FutureTimestampAction is applied to them.
+	// Zero disables the check.
+	FutureTimestampTolerance time.Duration `env:"FUTURE_TIMESTAMP_TOLERANCE, report"`
+	// FutureTimestampAction is pass, clamp, the default, or reject.
+	FutureTimestampAction ingress_v2.FutureTimestampAction `env:"FUTURE_TIMESTAMP_ACTION, report"`
+
+	// Plugins names the sources, processors and sinks registered with
+	// agentlib that the agent runs in addition to its built-in ingress and
+	// downstream consumers.
+	Plugins agentlib.PluginConfigs `env:"PLUGINS, report"`
+
+	// Pipelines run in isolation from the agent's main pipeline, each with
+	// its own ingress port, certificates, plugins and destinations.
+	Pipelines Pipelines `env:"PIPELINES, report"`
+
+	// DownstreamConsumers receive each envelope like the consumers
+	// registered with ingress_port.yml files.
+	DownstreamConsumers DownstreamConsumers `env:"DOWNSTREAM_CONSUMERS, report"`
+
+	// DownstreamConsumerToken is a shared token the ingress_port.yml files
+	// of downstream consumers must contain under token. Files without it
+	// are ignored. Empty disables the check.
+	DownstreamConsumerToken string `env:"DOWNSTREAM_CONSUMER_TOKEN"`
+
+	// DownstreamConsumerIdentities are the common names and DNS names
+	// downstream consumers may present in their certificates. The agent
+	// does not forward envelopes to consumers with other certificates.
+	// Empty allows all certificates signed by the CA.
+	DownstreamConsumerIdentities []string `env:"DOWNSTREAM_CONSUMER_IDENTITIES, report"`
+}
+
+// Pipeline configures a named pipeline, e.g. for an isolation segment.
+// Envelopes it receives on its port are tagged with the agent's tags and
+// its own tags and are only written to its destinations and sinks.
+type Pipeline struct {
+	Name string `json:"name"`
+	// Port on localhost of the Loggregator V2 ingress server of the
+	// pipeline.
+	Port uint16 `json:"port"`
+	// CAFile, CertFile and KeyFile are the certificates of the ingress
+	// server and of the clients of the destinations.
+	CAFile       string                 `json:"ca_file"`
+	CertFile     string                 `json:"cert_file"`
+	KeyFile      string                 `json:"key_file"`
+	Tags         map[string]string      `json:"tags,omitempty"`
+	Destinations []PipelineDestination  `json:"destinations,omitempty"`
+	Plugins      agentlib.PluginConfigs `json:"plugins,omitempty"`
+}
+
+// PipelineDestination is a downstream consumer of a Pipeline, like the
+// consumers registered with an ingress_port.yml file.
+type PipelineDestination struct {
+	// Ingress is the address of the consumer.
+	Ingress string `json:"ingress"`
+	// Protocol is loggregator, the default, otelcol or dropsonde.
+	Protocol       string            `json:"protocol,omitempty"`
+	SourceIDPrefix string            `json:"source_id_prefix,omitempty"`
+	EnvelopeTypes  []string          `json:"envelope_types,omitempty"`
+	Tags           map[string]string `json:"tags,omitempty"`
+}
+
+// Pipelines configures the named pipelines of the agent.
+type Pipelines []Pipeline
+
+// UnmarshalEnv implements envstruct.Unmarshaller.
+// Example input:
+// [{"name":"iso-1","port":3460,"ca_file":"ca.crt","cert_file":"iso-1.crt",
+// "key_file":"iso-1.key","destinations":[{"ingress":"127.0.0.1:3461"}]}]
+func (p *Pipelines) UnmarshalEnv(v string) error {
+	if v == "" {
+		return nil
+	}
+
+	var pipelines []Pipeline
+	if err := json.Unmarshal([]byte(v), &pipelines); err != nil {
+		return fmt.Errorf("invalid pipelines: %s", err)
+	}
+
+	names := make(map[string]bool)
+	ports := make(map[uint16]bool)
+	for _, pl := range pipelines {
+		switch {
+		case pl.Name == "":
+			return errors.New("pipeline without a name")
+		case names[pl.Name]:
+			return fmt.Errorf("pipeline %q configured twice", pl.Name)
+		case pl.Port == 0:
+			return fmt.Errorf("pipeline %q has no port", pl.Name)
+		case ports[pl.Port]:
+			return fmt.Errorf("port %d of pipeline %q is used by another pipeline", pl.Port, pl.Name)
+		case pl.CAFile == "" || pl.CertFile == "" || pl.KeyFile == "":
+			return fmt.Errorf("pipeline %q requires a CA, certificate and key", pl.Name)
+		}
+		for _, d := range pl.Destinations {
+			if d.Ingress == "" {
+				return fmt.Errorf("destination of pipeline %q has no ingress address", pl.Name)
+			}
+			if err := d.selector().Validate(); err != nil {
+				return fmt.Errorf("invalid selector of destination %s of pipeline %q: %s", d.Ingress, pl.Name, err)
+			}
+		}
+		names[pl.Name] = true
+		ports[pl.Port] = true
+	}
+	*p = pipelines
+
+	return nil
+}
+
+func (d PipelineDestination) selector() egress_v2.Selector {
+	return egress_v2.Selector{
+		SourceIDPrefix: d.SourceIDPrefix,
+		EnvelopeTypes:  d.EnvelopeTypes,
+		Tags:           d.Tags,
+	}
+}
+
+// DownstreamConsumer is a downstream consumer declared in the config
+// instead of with an ingress_port.yml file, e.g. outside of BOSH. Unlike
+// files, it may be on another host and use its own certificates.
+type DownstreamConsumer struct {
+	PipelineDestination
+	// CAFile, CertFile and KeyFile are the certificates of the client. The
+	// agent's certificates are used if they are not set.
+	CAFile   string `json:"ca_file,omitempty"`
+	CertFile string `json:"cert_file,omitempty"`
+	KeyFile  string `json:"key_file,omitempty"`
+	// ServerName is the name the certificate of the consumer is verified
+	// against. It defaults to metron, or otel-collector for the otelcol
+	// protocol.
+	ServerName string `json:"server_name,omitempty"`
+}
+
+// DownstreamConsumers configures the downstream consumers declared in the
+// config.
+type DownstreamConsumers []DownstreamConsumer
+
+// UnmarshalEnv implements envstruct.Unmarshaller.
+// Example input:
+// [{"ingress":"10.0.0.5:3459","envelope_types":["log"],
+// "ca_file":"ca.crt","cert_file":"client.crt","key_file":"client.key"}]
+func (c *DownstreamConsumers) UnmarshalEnv(v string) error {
+	if v == "" {
+		return nil
+	}
+
+	var consumers []DownstreamConsumer
+	if err := json.Unmarshal([]byte(v), &consumers); err != nil {
+		return fmt.Errorf("invalid downstream consumers: %s", err)
+	}
+
+	for _, dc := range consumers {
+		if _, _, err := net.SplitHostPort(dc.Ingress); err != nil {
+			return fmt.Errorf("invalid ingress address of downstream consumer %q: %s", dc.Ingress, err)
+		}
+		if err := dc.selector().Validate(); err != nil {
+			return fmt.Errorf("invalid selector of downstream consumer %s: %s", dc.Ingress, err)
+		}
+		certs := 0
+		for _, f := range []string{dc.CAFile, dc.CertFile, dc.KeyFile} {
+			if f != "" {
+				certs++
+			}
+		}
+		if certs != 0 && certs != 3 {
+			return fmt.Errorf("downstream consumer %s requires a CA, certificate and key or none of them", dc.Ingress)
+		}
+	}
+	*c = consumers
+
+	return nil
+}
+
+func (dc DownstreamConsumer) destination() destination {
+	d := destination{
+		Ingress:  dc.Ingress,
+		Protocol: dc.Protocol,
+		Selector: destinationSelector{
+			SourceIDPrefix: dc.SourceIDPrefix,
+			EnvelopeTypes:  dc.EnvelopeTypes,
+			Tags:           dc.Tags,
+		},
+	}
+	if dc.CAFile != "" || dc.ServerName != "" {
+		d.tls = &destinationTLS{
+			CAFile:     dc.CAFile,
+			CertFile:   dc.CertFile,
+			KeyFile:    dc.KeyFile,
+			ServerName: dc.ServerName,
+		}
+	}
+	return d
 }
 
 // LoadConfig will load the configuration for the forwarder agent from the
@@ -42,10 +358,30 @@ func LoadConfig() Config {
 		GRPC: GRPC{
 			Port: 3458,
 		},
+		UnixSocket: UnixSocket{
+			Permissions: "0660",
+		},
+		PlacementMetadata: PlacementMetadata{
+			RefreshInterval: time.Minute,
+		},
+		DownstreamRescanInterval: 10 * time.Second,
+		Autotune:                 true,
+		FutureTimestampAction:    ingress_v2.FutureTimestampClamp,
 	}
 	if err := envstruct.Load(&cfg); err != nil {
 		panic(fmt.Sprintf("Failed to load config from environment: %s", err))
 	}
+	if cfg.PlacementMetadata.RefreshInterval <= 0 {
+		panic("Placement metadata refresh interval must be positive")
+	}
+	if cfg.DownstreamCreditWindow < 0 || cfg.DownstreamCreditWindow > maxCreditWindow {
+		panic(fmt.Sprintf("Downstream credit window must be between 0 and %d", maxCreditWindow))
+	}
+	for _, p := range cfg.Pipelines {
+		if p.Port == cfg.GRPC.Port {
+			panic(fmt.Sprintf("Port %d of pipeline %q is used by the agent", p.Port, p.Name))
+		}
+	}
 
 	envstruct.WriteReport(&cfg) //nolint:errcheck
 
@@ -0,0 +1,491 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metrics "code.cloudfoundry.org/go-metric-registry"
+	"google.golang.org/grpc"
+
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
+	egress_v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
+)
+
+// States of a downstream consumer.
+const (
+	consumerConnecting   = "connecting"
+	consumerConnected    = "connected"
+	consumerDisconnected = "disconnected"
+	consumerInvalid      = "invalid"
+)
+
+// ConsumerStatus is the state of a downstream consumer discovered from an
+// ingress_port.yml file or declared in the config, as served on
+// /debug/consumers.
+type ConsumerStatus struct {
+	File        string     `json:"file,omitempty"`
+	Static      bool       `json:"static,omitempty"`
+	Destination string     `json:"destination,omitempty"`
+	Protocol    string     `json:"protocol,omitempty"`
+	State       string     `json:"state"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+	Envelopes   uint64     `json:"envelopes"`
+}
+
+// consumers are the downstream consumers declared in the config and
+// discovered from the files that match a glob. The files are scanned again
+// periodically, so consumers are added, replaced and removed when their
+// files change while the agent runs.
+type consumers struct {
+	pattern      string
+	settings     downstreamSettings
+	introspector *egress_v2.Introspector
+	log          *log.Logger
+
+	mu      sync.Mutex
+	static  []*consumer
+	byFile  map[string]*consumer
+	writers atomic.Pointer[[]Writer]
+
+	discovered metrics.Gauge
+	invalid    metrics.Gauge
+}
+
+type consumer struct {
+	contents []byte
+	readErr  string
+	dest     destination
+	w        Writer
+	status   *consumerStatus
+	invalid  ConsumerStatus
+	stop     context.CancelFunc
+}
+
+func newConsumers(pattern string, settings downstreamSettings, introspector *egress_v2.Introspector, l *log.Logger) *consumers {
+	c := &consumers{
+		pattern:      pattern,
+		settings:     settings,
+		introspector: introspector,
+		log:          l,
+		byFile:       make(map[string]*consumer),
+		discovered: settings.m.NewGauge(
+			"downstream_consumers",
+			"Number of downstream consumers discovered from ingress port files.",
+		),
+		invalid: settings.m.NewGauge(
+			"downstream_invalid_consumers",
+			"Number of ingress port files of downstream consumers that are ignored because they are invalid.",
+		),
+	}
+	c.writers.Store(&[]Writer{})
+	return c
+}
+
+// Write writes the envelope to all consumers.
+func (c *consumers) Write(ctx context.Context, e *loggregator_v2.Envelope) error {
+	for _, w := range *c.writers.Load() {
+		w.Write(ctx, e) //nolint:errcheck
+	}
+	return nil
+}
+
+// run scans the files every interval until ctx is done.
+func (c *consumers) run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := c.scan(); err != nil {
+				c.log.Printf("Unable to read downstream port location: %s", err)
+			}
+		}
+	}
+}
+
+// scan adds consumers for new files, replaces the consumers of changed
+// files and removes the consumers of deleted files.
+func (c *consumers) scan() error {
+	files, err := filepath.Glob(c.pattern)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	seen := make(map[string]bool, len(files))
+	for _, f := range files {
+		seen[f] = true
+
+		var readErr string
+		contents, err := os.ReadFile(f)
+		if err != nil {
+			readErr = err.Error()
+		}
+		if old, ok := c.byFile[f]; ok && bytes.Equal(old.contents, contents) && old.readErr == readErr {
+			continue
+		}
+
+		c.remove(f)
+		c.byFile[f] = c.add(f, contents, err)
+	}
+	for f := range c.byFile {
+		if !seen[f] {
+			c.log.Printf("Removed downstream consumer %s", f)
+			c.remove(f)
+		}
+	}
+
+	c.publish()
+	return nil
+}
+
+func (c *consumers) add(file string, contents []byte, readErr error) *consumer {
+	con := &consumer{contents: contents}
+	if readErr != nil {
+		c.log.Printf("Cannot read %s: %s. Ignoring this destination.", file, readErr)
+		con.readErr = readErr.Error()
+		con.invalid = invalidConsumer(file, readErr)
+		return con
+	}
+
+	d, err := parseDestination(file, contents, c.log)
+	if err != nil {
+		con.invalid = invalidConsumer(file, err)
+		return con
+	}
+	if !c.settings.authorized(d.Token) {
+		c.log.Printf("Invalid token in %s. Ignoring this destination.", file)
+		con.invalid = invalidConsumer(file, errors.New("invalid token"))
+		return con
+	}
+
+	if err := c.start(con, d); err != nil {
+		c.log.Printf("%s. Ignoring this destination.", err)
+		con.invalid = invalidConsumer(file, err)
+	}
+	return con
+}
+
+// addStatic adds the consumers declared in the config. Unlike the
+// consumers of files, they are never replaced or removed.
+func (c *consumers) addStatic(dests []destination) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, d := range dests {
+		con := &consumer{}
+		if err := c.start(con, d); err != nil {
+			c.log.Printf("%s. Ignoring this destination.", err)
+			continue
+		}
+		c.static = append(c.static, con)
+	}
+	c.publish()
+}
+
+// start starts the writer of the consumer to d. If the writer cannot be
+// created the consumer is left stopped.
+func (c *consumers) start(con *consumer, d destination) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	status := newConsumerStatus(c.settings.m, d.Ingress)
+	w, err := c.settings.writer(ctx, d, status)
+	if err != nil {
+		cancel()
+		status.removed()
+		return err
+	}
+	con.dest = d
+	con.stop = cancel
+	con.status = status
+	con.w = w
+	if q, ok := con.w.(egress_v2.Queue); ok {
+		c.introspector.Register("egress "+d.Ingress, egress_v2.QueueStatus(q))
+	}
+	if sel := d.Selector.selector(); !sel.IsZero() {
+		con.w = egress_v2.NewSelectingWriter(con.w, sel)
+	}
+	return nil
+}
+
+func (c *consumers) remove(file string) {
+	con, ok := c.byFile[file]
+	if !ok {
+		return
+	}
+	delete(c.byFile, file)
+	if con.stop == nil {
+		return
+	}
+
+	con.stop()
+	con.status.removed()
+	c.introspector.Unregister("egress " + con.dest.Ingress)
+}
+
+// publish makes the writers of the current consumers the ones envelopes
+// are written to.
+func (c *consumers) publish() {
+	writers := make([]Writer, 0, len(c.static)+len(c.byFile))
+	for _, con := range c.static {
+		writers = append(writers, con.w)
+	}
+	var invalid int
+	for _, f := range c.sortedFiles() {
+		con := c.byFile[f]
+		if con.stop == nil {
+			invalid++
+			continue
+		}
+		writers = append(writers, con.w)
+	}
+
+	c.writers.Store(&writers)
+	c.discovered.Set(float64(len(writers)))
+	c.invalid.Set(float64(invalid))
+}
+
+// Status returns the status of the consumers declared in the config and of
+// the consumers of files ordered by file.
+func (c *consumers) Status() []ConsumerStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	statuses := make([]ConsumerStatus, 0, len(c.static)+len(c.byFile))
+	for _, con := range c.static {
+		s := con.status.status()
+		s.Static = true
+		s.Protocol = con.dest.Protocol
+		statuses = append(statuses, s)
+	}
+	for _, f := range c.sortedFiles() {
+		con := c.byFile[f]
+		if con.stop == nil {
+			statuses = append(statuses, con.invalid)
+			continue
+		}
+		s := con.status.status()
+		s.File = f
+		s.Protocol = con.dest.Protocol
+		statuses = append(statuses, s)
+	}
+	return statuses
+}
+
+// ServeHTTP writes the status of all consumers as JSON.
+func (c *consumers) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]ConsumerStatus{"consumers": c.Status()}) //nolint:errcheck
+}
+
+func (c *consumers) sortedFiles() []string {
+	files := make([]string, 0, len(c.byFile))
+	for f := range c.byFile {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func invalidConsumer(file string, err error) ConsumerStatus {
+	now := time.Now()
+	return ConsumerStatus{
+		File:        file,
+		State:       consumerInvalid,
+		LastError:   err.Error(),
+		LastErrorAt: &now,
+	}
+}
+
+// consumerStatus records the connection state, errors and throughput of
+// the writer to a downstream consumer.
+type consumerStatus struct {
+	destination string
+
+	mu           sync.Mutex
+	conns        int
+	disconnected bool
+	lastErr      string
+	lastErrAt    time.Time
+	envelopes    atomic.Uint64
+
+	connected metrics.Gauge
+	errors    metrics.Counter
+	written   metrics.Counter
+}
+
+func newConsumerStatus(m Metrics, destination string) *consumerStatus {
+	labels := metrics.WithMetricLabels(map[string]string{"destination": destination})
+	return &consumerStatus{
+		destination: destination,
+		connected: m.NewGauge(
+			"downstream_consumer_connected",
+			"Whether the agent is connected to the downstream consumer.",
+			labels,
+		),
+		errors: m.NewCounter(
+			"downstream_consumer_errors",
+			"Total number of errors dialing or writing to the downstream consumer.",
+			labels,
+		),
+		written: m.NewCounter(
+			"downstream_consumer_envelopes",
+			"Total number of envelopes written to the downstream consumer.",
+			labels,
+		),
+	}
+}
+
+func (s *consumerStatus) status() ConsumerStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := ConsumerStatus{
+		Destination: s.destination,
+		State:       s.state(),
+		Envelopes:   s.envelopes.Load(),
+	}
+	if s.lastErr != "" {
+		at := s.lastErrAt
+		status.LastError = s.lastErr
+		status.LastErrorAt = &at
+	}
+	return status
+}
+
+func (s *consumerStatus) state() string {
+	switch {
+	case s.conns > 0:
+		return consumerConnected
+	case s.disconnected:
+		return consumerDisconnected
+	default:
+		return consumerConnecting
+	}
+}
+
+func (s *consumerStatus) dialed(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err != nil {
+		s.disconnected = true
+		s.failedLocked(err.Error())
+		return
+	}
+	s.conns++
+	s.disconnected = false
+	s.connected.Set(1)
+}
+
+func (s *consumerStatus) closed() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.conns--
+	if s.conns == 0 {
+		s.disconnected = true
+		s.connected.Set(0)
+	}
+}
+
+func (s *consumerStatus) removed() {
+	s.connected.Set(0)
+}
+
+func (s *consumerStatus) failed(msg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failedLocked(msg)
+}
+
+func (s *consumerStatus) failedLocked(msg string) {
+	s.lastErr = msg
+	s.lastErrAt = time.Now()
+	s.errors.Add(1)
+}
+
+// dialOption returns a gRPC dial option that records the connections to
+// the consumer. Once ctx is done, no new connections are dialed.
+func (s *consumerStatus) dialOption(ctx context.Context) grpc.DialOption {
+	var d net.Dialer
+	return grpc.WithContextDialer(func(dialCtx context.Context, addr string) (net.Conn, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		conn, err := d.DialContext(dialCtx, "tcp", addr)
+		s.dialed(err)
+		if err != nil {
+			return nil, err
+		}
+		return &consumerConn{Conn: conn, status: s}, nil
+	})
+}
+
+// errorLogger returns a logger that records everything it logs as the
+// last error of the consumer and logs it to l. The clients of downstream
+// consumers only log errors.
+func (s *consumerStatus) errorLogger(l *log.Logger) *log.Logger {
+	return log.New(errorRecorder{l: l, status: s}, "", 0)
+}
+
+// writer returns a writer that counts the envelopes written to w.
+func (s *consumerStatus) writer(w egress.WriteCloser) egress.WriteCloser {
+	return countingWriter{WriteCloser: w, status: s}
+}
+
+type errorRecorder struct {
+	l      *log.Logger
+	status *consumerStatus
+}
+
+func (r errorRecorder) Write(p []byte) (int, error) {
+	msg := strings.TrimSuffix(string(p), "\n")
+	r.status.failed(msg)
+	r.l.Print(msg)
+	return len(p), nil
+}
+
+type countingWriter struct {
+	egress.WriteCloser
+	status *consumerStatus
+}
+
+func (w countingWriter) Write(ctx context.Context, e *loggregator_v2.Envelope) error {
+	if err := w.WriteCloser.Write(ctx, e); err != nil {
+		return err
+	}
+	w.status.envelopes.Add(1)
+	w.status.written.Add(1)
+	return nil
+}
+
+// consumerConn records when a connection to a consumer is closed.
+type consumerConn struct {
+	net.Conn
+	once   sync.Once
+	status *consumerStatus
+}
+
+func (c *consumerConn) Close() error {
+	c.once.Do(c.status.closed)
+	return c.Conn.Close()
+}
@@ -2,10 +2,14 @@ package app
 
 import (
 	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"log"
 	"os"
-	"path/filepath"
+	"slices"
+	"strconv"
 	"time"
 
 	metrics "code.cloudfoundry.org/go-metric-registry"
@@ -18,10 +22,18 @@ import (
 	gendiodes "code.cloudfoundry.org/go-diodes"
 	"code.cloudfoundry.org/go-loggregator/v10"
 	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/admin"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/agentlib"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/autotune"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/buildinfo"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/config"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/diodes"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
+	egress_v1 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v1"
 	egress_v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/ingress/filetail"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/ingress/journald"
 	v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/ingress/v2"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/otelcolclient"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/plumbing"
@@ -34,21 +46,59 @@ import (
 type ForwarderAgent struct {
 	pprofPort             uint16
 	pprofServer           *http.Server
+	infoPort              uint16
+	infoServer            *http.Server
 	m                     Metrics
 	grpc                  GRPC
+	unixSocket            UnixSocket
+	namedPipe             NamedPipe
+	placementMetadata     PlacementMetadata
+	journald              Journald
+	stopJournald          context.CancelFunc
+	fileTail              FileTail
+	stopFileTail          context.CancelFunc
+	priorityDropping      bool
+	maxTagBytes           int
+	orderingLanes         int
+	adminPort             uint16
+	adminSrv              *admin.Server
+	bufferSize            int
+	counterCardinality    int
+	gaugeWindow           time.Duration
+	gaugeStatistics       egress_v2.GaugeStatistics
+	creditWindow          int
+	batchMetadata         bool
+	envelopeSizes         bool
+	futureTolerance       time.Duration
+	futureAction          v2.FutureTimestampAction
+	consumerToken         string
+	consumerIdentities    []string
 	v2srv                 *v2.Server
+	unixSrv               *v2.Server
+	pipeSrv               *v2.Server
 	downstreamFilePattern string
+	rescanInterval        time.Duration
+	staticConsumers       DownstreamConsumers
+	stopConsumers         context.CancelFunc
 	log                   *log.Logger
 	tags                  map[string]string
 	debugMetrics          bool
 	emitOTelTraces        bool
 	emitOTelMetrics       bool
 	emitOTelLogs          bool
+	idRewriter            egress_v2.IDRewriter
+	metricRules           egress_v2.MetricRules
+	plugins               agentlib.PluginConfigs
+	stopPlugins           context.CancelFunc
+	stopEgress            context.CancelFunc
+	pipelines             Pipelines
+	runningPipelines      []runningPipeline
 }
 
 type Metrics interface {
 	NewGauge(name, helpText string, opts ...metrics.MetricOption) metrics.Gauge
 	NewCounter(name, helpText string, opts ...metrics.MetricOption) metrics.Counter
+	NewHistogram(name, helpText string, buckets []float64, opts ...metrics.MetricOption) metrics.Histogram
 	RegisterDebugMetrics()
 }
 
@@ -57,7 +107,13 @@ type BindingFetcher interface {
 }
 
 type Writer interface {
-	Write(*loggregator_v2.Envelope) error
+	Write(context.Context, *loggregator_v2.Envelope) error
+}
+
+type envelopeBuffer interface {
+	Set(*loggregator_v2.Envelope)
+	Next() *loggregator_v2.Envelope
+	Len() int
 }
 
 // NewForwarderAgent intializes and returns a new forwarder agent.
@@ -66,50 +122,220 @@ func NewForwarderAgent(
 	m Metrics,
 	log *log.Logger,
 ) *ForwarderAgent {
+	tags := cfg.Tags
+	if cfg.AgentVersionTag {
+		tags = buildinfo.WithVersionTag(tags)
+	}
+
+	config.EmitConfigInfo(m, config.Fingerprint(cfg, "Tags.index", "Tags.ip"), map[string]string{
+		"priority_dropping": strconv.FormatBool(cfg.PriorityDropping),
+		"max_tag_bytes":     strconv.Itoa(cfg.MaxTagBytes),
+	})
+
+	bufferSize, lanes := 10000, cfg.OrderingLanes
+	if cfg.Autotune {
+		tuning := autotune.Detect()
+		tuning.SetGOMAXPROCS()
+		log.Printf("Autotuned for %s", tuning)
+		bufferSize = tuning.DiodeSize
+		if lanes == 0 && tuning.Workers > 1 {
+			lanes = tuning.Workers
+		}
+	}
+
 	return &ForwarderAgent{
 		pprofPort:             cfg.MetricsServer.PprofPort,
+		infoPort:              cfg.MetricsServer.InfoPort,
 		grpc:                  cfg.GRPC,
+		unixSocket:            cfg.UnixSocket,
+		namedPipe:             cfg.NamedPipe,
+		placementMetadata:     cfg.PlacementMetadata,
+		journald:              cfg.Journald,
+		fileTail:              cfg.FileTail,
+		priorityDropping:      cfg.PriorityDropping,
+		maxTagBytes:           cfg.MaxTagBytes,
+		orderingLanes:         lanes,
+		bufferSize:            bufferSize,
+		adminPort:             cfg.AdminPort,
+		counterCardinality:    cfg.CounterCardinalityLimit,
+		gaugeWindow:           cfg.GaugeDownsamplingWindow,
+		gaugeStatistics:       cfg.GaugeDownsamplingStatistics,
+		creditWindow:          cfg.DownstreamCreditWindow,
+		batchMetadata:         cfg.BatchMetadata,
+		envelopeSizes:         cfg.EnvelopeSizeMetrics,
+		futureTolerance:       cfg.FutureTimestampTolerance,
+		futureAction:          cfg.FutureTimestampAction,
+		consumerToken:         cfg.DownstreamConsumerToken,
+		consumerIdentities:    cfg.DownstreamConsumerIdentities,
 		m:                     m,
 		downstreamFilePattern: cfg.DownstreamIngressPortCfg,
+		rescanInterval:        cfg.DownstreamRescanInterval,
+		staticConsumers:       cfg.DownstreamConsumers,
 		log:                   log,
-		tags:                  cfg.Tags,
+		tags:                  tags,
 		debugMetrics:          cfg.MetricsServer.DebugMetrics,
 		emitOTelTraces:        cfg.EmitOTelTraces,
 		emitOTelMetrics:       cfg.EmitOTelMetrics,
 		emitOTelLogs:          cfg.EmitOTelLogs,
+		idRewriter:            cfg.IDRewriteRules,
+		metricRules:           cfg.MetricRules,
+		plugins:               cfg.Plugins,
+		pipelines:             cfg.Pipelines,
 	}
 }
 
 func (s *ForwarderAgent) Run() {
+	introspector := egress_v2.NewIntrospector()
+	consumers := newConsumers(
+		s.downstreamFilePattern,
+		s.downstreamSettings(s.grpc, s.m, s.log),
+		introspector,
+		s.log,
+	)
 	if s.debugMetrics {
 		s.m.RegisterDebugMetrics()
+		mux := http.NewServeMux()
+		mux.Handle("/debug/consumers", consumers)
+		mux.Handle("/", egress_v2.DebugHandler(introspector, http.DefaultServeMux))
 		s.pprofServer = &http.Server{
 			Addr:              fmt.Sprintf("127.0.0.1:%d", s.pprofPort),
-			Handler:           http.DefaultServeMux,
+			Handler:           mux,
 			ReadHeaderTimeout: 2 * time.Second,
 		}
 		go func() { s.log.Println("PPROF SERVER STOPPED " + s.pprofServer.ListenAndServe().Error()) }()
 	}
+	if s.infoPort != 0 {
+		s.infoServer = buildinfo.NewServer(s.infoPort)
+		go func() { s.log.Println("INFO SERVER STOPPED " + s.infoServer.ListenAndServe().Error()) }()
+	}
+	buildinfo.EmitStartup(s.m)
+
+	processors := admin.NewSwitches()
+	if s.adminPort != 0 {
+		logLevel := admin.NewLogLevel(s.log.Writer())
+		s.log.SetOutput(logLevel)
+		s.adminSrv = admin.NewServer(
+			s.adminPort,
+			admin.WithLogLevel(logLevel),
+			admin.WithProcessors(processors),
+			admin.WithStats(func() any { return introspector.Status() }),
+		)
+		if err := s.adminSrv.Start(); err != nil {
+			s.log.Fatalf("failed to start admin server: %s", err)
+		}
+	}
+
 	ingressDropped := s.m.NewCounter(
 		"dropped",
 		"Total number of dropped envelopes.",
 		metrics.WithMetricLabels(map[string]string{"direction": "ingress"}),
 	)
-	diode := diodes.NewManyToOneEnvelopeV2(10000, gendiodes.AlertFunc(func(missed int) {
-		ingressDropped.Add(float64(missed))
-	}))
+	diode := s.ingressBuffer(ingressDropped)
+
+	introspector.Register("ingress", egress_v2.QueueStatus(diode))
+	s.startConsumers(consumers)
+
+	writers := []egress_v2.Writer{consumers}
+	plugins, err := s.plugins.Build(s.m, log.New(s.log.Writer(), "[PLUGINS] ", s.log.Flags()))
+	if err != nil {
+		s.log.Fatalf("failed to create plugins: %s", err)
+	}
+	for _, w := range plugins.Sinks {
+		writers = append(writers, w)
+	}
 
-	dests := downstreamDestinations(s.downstreamFilePattern, s.log)
-	writers := downstreamWriters(dests, s.grpc, s.m, s.emitOTelTraces, s.emitOTelMetrics, s.emitOTelLogs, s.log)
+	// The egress processors that run goroutines of their own stop with
+	// the agent.
+	var egressCtx context.Context
+	egressCtx, s.stopEgress = context.WithCancel(context.Background())
 	tagger := egress_v2.NewTagger(s.tags)
-	ew := egress_v2.NewEnvelopeWriter(
-		multiWriter{writers: writers},
-		egress_v2.NewCounterAggregator(tagger.TagEnvelope),
+	tagEnvelope := tagger.TagEnvelope
+	if !s.idRewriter.IsZero() {
+		enabled := processors.Add("id_rewrite_rules")
+		tagEnvelope = func(e *loggregator_v2.Envelope) {
+			if enabled() {
+				s.idRewriter.RewriteEnvelope(e)
+			}
+			tagger.TagEnvelope(e)
+		}
+	}
+	if source := s.placementSource(); source != nil {
+		placementTagger := egress_v2.NewPlacementTagger(egressCtx, source, s.placementMetadata.RefreshInterval)
+		enabled := processors.Add("placement_metadata")
+		tag := tagEnvelope
+		tagEnvelope = func(e *loggregator_v2.Envelope) {
+			tag(e)
+			if enabled() {
+				placementTagger.TagEnvelope(e)
+			}
+		}
+	}
+	if s.maxTagBytes > 0 {
+		tagLimiter := egress_v2.NewTagLimiter(s.maxTagBytes, s.m.NewCounter(
+			"tags_truncated",
+			"Total number of envelopes with tags truncated to the maximum tag size.",
+		))
+		enabled := processors.Add("max_tag_bytes")
+		tag := tagEnvelope
+		tagEnvelope = func(e *loggregator_v2.Envelope) {
+			tag(e)
+			if enabled() {
+				tagLimiter.LimitTags(e)
+			}
+		}
+	}
+	if len(plugins.Processors) > 0 {
+		enabled := processors.Add("plugins")
+		tag := tagEnvelope
+		tagEnvelope = func(e *loggregator_v2.Envelope) {
+			tag(e)
+			if enabled() {
+				plugins.Process(e)
+			}
+		}
+	}
+	// The consumers are backed by one to one diodes. The ordering lanes
+	// write to them concurrently, so writes are serialized.
+	var downstream egress_v2.Writer = egress_v2.NewMultiWriter(writers...)
+	if s.gaugeWindow > 0 {
+		downstream = switchedWriter{
+			on:      egress_v2.NewGaugeDownsampler(egressCtx, downstream, s.gaugeWindow, s.gaugeStatistics, s.m),
+			off:     downstream,
+			enabled: processors.Add("gauge_downsampling"),
+		}
+	}
+	if !s.metricRules.IsZero() {
+		// Counters are promoted to gauges after their totals are
+		// aggregated.
+		downstream = switchedWriter{
+			on:      egress_v2.NewEnvelopeWriter(downstream, s.metricRules),
+			off:     downstream,
+			enabled: processors.Add("metric_rules"),
+		}
+	}
+	var aggregatorOpts []egress_v2.CounterAggregatorOption
+	if s.counterCardinality > 0 {
+		aggregatorOpts = append(aggregatorOpts, egress_v2.WithCardinalityLimit(s.counterCardinality, s.m))
+	}
+	var ew egress_v2.Writer = egress_v2.NewEnvelopeWriter(
+		downstream,
+		egress_v2.NewCounterAggregator(tagEnvelope, aggregatorOpts...),
 	)
+	if s.orderingLanes > 0 {
+		// Each lane aggregates the counters of its own source IDs.
+		laneWriters := make([]egress_v2.Writer, s.orderingLanes)
+		for i := range laneWriters {
+			laneWriters[i] = egress_v2.NewEnvelopeWriter(
+				downstream,
+				egress_v2.NewCounterAggregator(tagEnvelope, aggregatorOpts...),
+			)
+		}
+		ew = egress_v2.NewLaneWriter(egressCtx, laneWriters, 1000)
+	}
 	go func() {
 		for {
 			e := diode.Next()
-			ew.Write(e) //nolint:errcheck
+			ew.Write(context.Background(), e) //nolint:errcheck
 		}
 	}()
 
@@ -136,7 +362,52 @@ func (s *ForwarderAgent) Run() {
 		"origin_mappings",
 		"Total number of envelopes where the origin tag is used as the source_id.",
 	)
-	rx := v2.NewReceiver(diode, im, omm)
+	var rxOpts []v2.ReceiverOption
+	if s.batchMetadata {
+		rxOpts = append(rxOpts, v2.WithBatchMetadata(s.m))
+	}
+	if s.envelopeSizes {
+		rxOpts = append(rxOpts, v2.WithEnvelopeSizes(s.m))
+	}
+	if s.futureTolerance > 0 {
+		rxOpts = append(rxOpts, v2.WithFutureTimestamps(s.futureTolerance, s.futureAction, s.m))
+	}
+	rx := v2.NewReceiver(diode, im, omm, rxOpts...)
+	s.startJournald(diode)
+	s.startFileTail(diode)
+	s.startPluginSources(plugins, diode)
+
+	if s.unixSocket.Path != "" {
+		mode, err := strconv.ParseUint(s.unixSocket.Permissions, 8, 32)
+		if err != nil {
+			s.log.Fatalf("invalid unix socket permissions %q: %s", s.unixSocket.Permissions, err)
+		}
+		s.unixSrv = v2.NewUnixServer(
+			s.unixSocket.Path,
+			os.FileMode(mode),
+			rx,
+			grpc.MaxRecvMsgSize(10*1024*1024),
+		)
+		if s.grpc.HealthAndReflection {
+			s.unixSrv.EnableHealthAndReflection()
+		}
+		go s.unixSrv.Start()
+	}
+
+	if s.namedPipe.Name != "" {
+		s.pipeSrv = v2.NewPipeServer(
+			s.namedPipe.Name,
+			s.namedPipe.SDDL,
+			rx,
+			grpc.MaxRecvMsgSize(10*1024*1024),
+		)
+		if s.grpc.HealthAndReflection {
+			s.pipeSrv.EnableHealthAndReflection()
+		}
+		go s.pipeSrv.Start()
+	}
+
+	s.startPipelines()
 
 	s.v2srv = v2.NewServer(
 		fmt.Sprintf("127.0.0.1:%d", s.grpc.Port),
@@ -144,21 +415,183 @@ func (s *ForwarderAgent) Run() {
 		grpc.Creds(serverCreds),
 		grpc.MaxRecvMsgSize(10*1024*1024),
 	)
+	if s.grpc.HealthAndReflection {
+		s.v2srv.EnableHealthAndReflection()
+	}
 	s.v2srv.Start()
 }
 
+// startConsumers starts the downstream consumers declared in the config
+// and discovers the consumers of files. If a rescan interval is
+// configured, it keeps discovering them while the agent runs.
+func (s *ForwarderAgent) startConsumers(c *consumers) {
+	dests := make([]destination, 0, len(s.staticConsumers))
+	for _, dc := range s.staticConsumers {
+		dests = append(dests, dc.destination())
+	}
+	c.addStatic(dests)
+
+	if err := c.scan(); err != nil {
+		s.log.Fatalf("Unable to read downstream port location: %s", err)
+	}
+	if s.rescanInterval <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stopConsumers = cancel
+	go c.run(ctx, s.rescanInterval)
+}
+
+// startJournald starts reading the logs of system components from
+// systemd-journald into the ingress buffer if it is enabled.
+func (s *ForwarderAgent) startJournald(buffer journald.EnvelopeSetter) {
+	if !s.journald.Enabled && s.journald.SocketPath == "" {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stopJournald = cancel
+
+	jl := log.New(s.log.Writer(), "[JOURNALD] ", s.log.Flags())
+	r := journald.NewReader(
+		buffer,
+		s.m,
+		jl,
+		journald.WithUnits(s.journald.Units),
+		journald.WithCursorFile(s.journald.CursorFile),
+	)
+	if s.journald.Enabled {
+		go r.FollowJournal(ctx)
+	}
+	if s.journald.SocketPath != "" {
+		go func() {
+			if err := r.ServeSocket(ctx, s.journald.SocketPath); err != nil {
+				jl.Printf("failed to serve journal socket %s: %s", s.journald.SocketPath, err)
+			}
+		}()
+	}
+}
+
+// startFileTail starts tailing the configured log files into the ingress
+// buffer if any globs are configured.
+func (s *ForwarderAgent) startFileTail(buffer filetail.EnvelopeSetter) {
+	if len(s.fileTail.Globs) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stopFileTail = cancel
+
+	opts := []filetail.TailerOption{
+		filetail.WithCheckpointFile(s.fileTail.CheckpointFile),
+	}
+	if s.fileTail.PollInterval > 0 {
+		opts = append(opts, filetail.WithPollInterval(s.fileTail.PollInterval))
+	}
+	fl := log.New(s.log.Writer(), "[FILE TAIL] ", s.log.Flags())
+	go filetail.NewTailer(s.fileTail.Globs, buffer, s.m, fl, opts...).Run(ctx)
+}
+
+// startPluginSources runs the sources of the plugins, which write into the
+// ingress buffer.
+func (s *ForwarderAgent) startPluginSources(plugins agentlib.Plugins, buffer envelopeBuffer) {
+	if len(plugins.Sources) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stopPlugins = cancel
+	plugins.Run(ctx, bufferWriter{buffer: buffer})
+}
+
+// ingressBuffer returns the buffer between the ingress servers and the
+// downstream writers. With priority dropping enabled, envelopes with a low
+// log priority are dropped first when the buffer is full.
+func (s *ForwarderAgent) ingressBuffer(dropped metrics.Counter) envelopeBuffer {
+	if !s.priorityDropping {
+		return diodes.NewManyToOneEnvelopeV2(s.bufferSize, gendiodes.AlertFunc(func(missed int) {
+			dropped.Add(float64(missed))
+		}))
+	}
+
+	droppedByPriority := make(map[diodes.Priority]metrics.Counter)
+	for _, p := range diodes.Priorities {
+		droppedByPriority[p] = s.m.NewCounter(
+			"dropped_by_priority",
+			"Total number of envelopes dropped on ingress by log priority.",
+			metrics.WithMetricLabels(map[string]string{"priority": p.String()}),
+		)
+	}
+
+	return diodes.NewPriorityEnvelopeV2(s.bufferSize, diodes.PriorityAlertFunc(func(p diodes.Priority, missed int) {
+		dropped.Add(float64(missed))
+		droppedByPriority[p].Add(float64(missed))
+	}))
+}
+
 func (s *ForwarderAgent) Stop() {
 	if s.pprofServer != nil {
 		s.pprofServer.Close()
 	}
+	if s.infoServer != nil {
+		s.infoServer.Close()
+	}
+	if s.unixSrv != nil {
+		s.unixSrv.Stop()
+	}
+	if s.pipeSrv != nil {
+		s.pipeSrv.Stop()
+	}
+	if s.stopConsumers != nil {
+		s.stopConsumers()
+	}
+	if s.stopJournald != nil {
+		s.stopJournald()
+	}
+	if s.stopFileTail != nil {
+		s.stopFileTail()
+	}
+	if s.stopPlugins != nil {
+		s.stopPlugins()
+	}
+	if s.stopEgress != nil {
+		s.stopEgress()
+	}
+	for _, p := range s.runningPipelines {
+		p.stop()
+	}
+	if s.adminSrv != nil {
+		s.adminSrv.Stop()
+	}
 	s.v2srv.Stop()
 }
 
+func (s *ForwarderAgent) placementSource() egress_v2.PlacementSource {
+	switch {
+	case s.placementMetadata.File != "":
+		return egress_v2.PlacementFromFile(s.placementMetadata.File)
+	case s.placementMetadata.URL != "":
+		return egress_v2.PlacementFromEndpoint(
+			s.placementMetadata.URL,
+			&http.Client{Timeout: 5 * time.Second},
+		)
+	default:
+		return nil
+	}
+}
+
+// clientWriter hands envelopes to an ingress client, which sends them to
+// the downstream agent in batches in the background. A successful write
+// only means that the client accepted the envelope: the client logs failed
+// batches instead of returning errors and its stream does not acknowledge
+// envelopes, so the delivery latency of loggregator consumers ends when the
+// envelope is handed to the client.
 type clientWriter struct {
 	c *loggregator.IngressClient
 }
 
-func (c clientWriter) Write(e *loggregator_v2.Envelope) error {
+func (c clientWriter) Write(_ context.Context, e *loggregator_v2.Envelope) error {
 	c.c.Emit(e)
 	return nil
 }
@@ -167,87 +600,254 @@ func (c clientWriter) Close() error {
 	return c.c.CloseSend()
 }
 
-type multiWriter struct {
-	writers []Writer
+// dropsondeWriter logs the envelopes that cannot be sent to a dropsonde
+// endpoint instead of returning the error to the diode.
+type dropsondeWriter struct {
+	*egress_v1.ConvertingWriter
+	log *log.Logger
 }
 
-func (mw multiWriter) Write(e *loggregator_v2.Envelope) error {
-	for _, w := range mw.writers {
-		w.Write(e) //nolint:errcheck
+func (w dropsondeWriter) Write(ctx context.Context, e *loggregator_v2.Envelope) error {
+	err := w.ConvertingWriter.Write(ctx, e)
+	if err != nil {
+		w.log.Printf("failed to write envelope: %s", err)
 	}
+	return err
+}
+
+// switchedWriter writes to on while its processor is enabled and to off
+// otherwise.
+type switchedWriter struct {
+	on      Writer
+	off     Writer
+	enabled func() bool
+}
+
+func (w switchedWriter) Write(ctx context.Context, e *loggregator_v2.Envelope) error {
+	if w.enabled() {
+		return w.on.Write(ctx, e)
+	}
+	return w.off.Write(ctx, e)
+}
+
+// bufferWriter writes envelopes to the ingress buffer.
+type bufferWriter struct {
+	buffer envelopeBuffer
+}
+
+func (w bufferWriter) Write(_ context.Context, e *loggregator_v2.Envelope) error {
+	w.buffer.Set(e)
 	return nil
 }
 
 type destination struct {
-	Ingress  string `yaml:"ingress"`
-	Protocol string `yaml:"protocol"`
+	Ingress  string              `yaml:"ingress"`
+	Protocol string              `yaml:"protocol"`
+	Selector destinationSelector `yaml:"selector"`
+	Token    string              `yaml:"token"`
+
+	// tls overrides the agent's client certificates for consumers
+	// declared in the config.
+	tls *destinationTLS
 }
 
-func downstreamDestinations(pattern string, l *log.Logger) []destination {
-	files, err := filepath.Glob(pattern)
-	if err != nil {
-		l.Fatal("Unable to read downstream port location")
+// destinationTLS are the certificates of the client of a consumer and the
+// name its certificate is verified against. Empty values are taken from
+// the agent's certificates and the default server name of the protocol.
+type destinationTLS struct {
+	CAFile     string
+	CertFile   string
+	KeyFile    string
+	ServerName string
+}
+
+// serverName returns the server name of the consumer's certificate or def
+// if none is configured.
+func (d destination) serverName(def string) string {
+	if d.tls == nil || d.tls.ServerName == "" {
+		return def
 	}
+	return d.tls.ServerName
+}
 
-	var dests []destination
-	for _, f := range files {
-		yamlFile, err := os.ReadFile(f)
-		if err != nil {
-			l.Fatalf("cannot read file: %s", err)
-		}
+// destinationSelector selects the envelopes a downstream consumer receives.
+// Consumers that only need some envelopes, e.g. the metrics of a single
+// service, set it in their ingress_port.yml so the agent does not send them
+// envelopes they would discard.
+type destinationSelector struct {
+	SourceIDPrefix string            `yaml:"source_id_prefix"`
+	EnvelopeTypes  []string          `yaml:"envelope_types"`
+	Tags           map[string]string `yaml:"tags"`
+}
 
-		var d destination
-		err = yaml.Unmarshal(yamlFile, &d)
-		if err != nil {
-			l.Fatalf("Unmarshal: %v", err)
-		}
+func (s destinationSelector) selector() egress_v2.Selector {
+	return egress_v2.Selector{
+		SourceIDPrefix: s.SourceIDPrefix,
+		EnvelopeTypes:  s.EnvelopeTypes,
+		Tags:           s.Tags,
+	}
+}
 
-		if d.Ingress == "" {
-			l.Printf("No ingress port defined in %s. Ignoring this destination.", f)
-		} else {
-			d.Ingress = fmt.Sprintf("127.0.0.1:%s", d.Ingress)
-			dests = append(dests, d)
-		}
+// parseDestination parses the ingress_port.yml file of a downstream
+// consumer. It logs why the consumer is ignored if the file is invalid.
+func parseDestination(file string, contents []byte, l *log.Logger) (destination, error) {
+	var d destination
+	if err := yaml.Unmarshal(contents, &d); err != nil {
+		l.Printf("Unmarshal %s: %v. Ignoring this destination.", file, err)
+		return destination{}, err
 	}
 
-	return dests
+	if d.Ingress == "" {
+		l.Printf("No ingress port defined in %s. Ignoring this destination.", file)
+		return destination{}, errors.New("no ingress port defined")
+	}
+	if err := d.Selector.selector().Validate(); err != nil {
+		l.Printf("Invalid selector in %s: %s. Ignoring this destination.", file, err)
+		return destination{}, fmt.Errorf("invalid selector: %s", err)
+	}
+
+	d.Ingress = fmt.Sprintf("127.0.0.1:%s", d.Ingress)
+	return d, nil
+}
+
+// maxCreditWindow is the size of the buffer of each downstream writer. A
+// larger credit window would let the buffer drop envelopes again.
+const maxCreditWindow = 10000
+
+// downstreamSettings are the settings of the writers to downstream
+// consumers.
+type downstreamSettings struct {
+	grpc            GRPC
+	m               Metrics
+	creditWindow    int
+	batchMetadata   bool
+	token           string
+	identities      []string
+	emitOTelTraces  bool
+	emitOTelMetrics bool
+	emitOTelLogs    bool
+	log             *log.Logger
+}
+
+func (s *ForwarderAgent) downstreamSettings(grpc GRPC, m Metrics, l *log.Logger) downstreamSettings {
+	return downstreamSettings{
+		grpc:            grpc,
+		m:               m,
+		creditWindow:    s.creditWindow,
+		batchMetadata:   s.batchMetadata,
+		token:           s.consumerToken,
+		identities:      s.consumerIdentities,
+		emitOTelTraces:  s.emitOTelTraces,
+		emitOTelMetrics: s.emitOTelMetrics,
+		emitOTelLogs:    s.emitOTelLogs,
+		log:             l,
+	}
+}
+
+// sloOptions returns the options of the delivery SLOs of downstream
+// consumers.
+func (ds downstreamSettings) sloOptions() []egress_v2.DeliverySLOOption {
+	if !ds.batchMetadata {
+		return nil
+	}
+	return []egress_v2.DeliverySLOOption{egress_v2.WithEmitterLatency()}
 }
 
-func downstreamWriters(dests []destination, grpc GRPC, m Metrics, emitOTelTraces, emitOTelMetrics, emitOTelLogs bool, l *log.Logger) []Writer {
+// stripEmitter removes the emitter tags added with batch metadata from the
+// envelopes written to w.
+func (ds downstreamSettings) stripEmitter(w egress.WriteCloser) egress.WriteCloser {
+	if !ds.batchMetadata {
+		return w
+	}
+	return egress_v2.NewEmitterStrippingWriter(w)
+}
+
+// authorized reports whether a consumer registered with token may receive
+// envelopes.
+func (ds downstreamSettings) authorized(token string) bool {
+	if ds.token == "" {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(ds.token)) == 1
+}
+
+// verifyIdentity makes c reject consumers whose certificate has none of
+// the allowed identities.
+func (ds downstreamSettings) verifyIdentity(c *tls.Config) {
+	if len(ds.identities) == 0 {
+		return
+	}
+	c.VerifyConnection = func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return errors.New("downstream consumer presented no certificate")
+		}
+		cert := cs.PeerCertificates[0]
+		if slices.Contains(ds.identities, cert.Subject.CommonName) {
+			return nil
+		}
+		for _, name := range cert.DNSNames {
+			if slices.Contains(ds.identities, name) {
+				return nil
+			}
+		}
+		return fmt.Errorf("identity of downstream consumer %q is not allowed", cert.Subject.CommonName)
+	}
+}
+
+// writers returns writers to dests that run until the agent stops.
+func (ds downstreamSettings) writers(dests []destination) ([]Writer, error) {
 	var writers []Writer
 	for _, d := range dests {
-		var w Writer
-		switch d.Protocol {
-		case "otelcol":
-			w = otelCollectorClient(d, grpc, m, emitOTelTraces, emitOTelMetrics, emitOTelLogs, l)
-		default:
-			w = loggregatorClient(d, grpc, m, l)
+		w, err := ds.writer(context.Background(), d, newConsumerStatus(ds.m, d.Ingress))
+		if err != nil {
+			return nil, err
 		}
 		writers = append(writers, w)
 	}
-	return writers
+	return writers, nil
+}
+
+// writer returns a writer to dest that runs until ctx is done and records
+// its connection state and errors in status. It returns an error if the
+// destination cannot be used, e.g. because its address is invalid.
+func (ds downstreamSettings) writer(ctx context.Context, dest destination, status *consumerStatus) (Writer, error) {
+	if dest.tls != nil && dest.tls.CAFile != "" {
+		ds.grpc.CAFile = dest.tls.CAFile
+		ds.grpc.CertFile = dest.tls.CertFile
+		ds.grpc.KeyFile = dest.tls.KeyFile
+	}
+
+	switch dest.Protocol {
+	case "otelcol":
+		return ds.otelCollectorClient(ctx, dest, status), nil
+	case "dropsonde":
+		return ds.dropsondeClient(ctx, dest, status)
+	default:
+		return ds.loggregatorClient(ctx, dest, status), nil
+	}
 }
 
-func otelCollectorClient(dest destination, grpc GRPC, m Metrics, emitTraces, emitMetrics, emitLogs bool, l *log.Logger) Writer {
+func (ds downstreamSettings) otelCollectorClient(ctx context.Context, dest destination, status *consumerStatus) Writer {
 	clientCreds, err := tlsconfig.Build(
 		tlsconfig.WithInternalServiceDefaults(),
-		tlsconfig.WithIdentityFromFile(grpc.CertFile, grpc.KeyFile),
+		tlsconfig.WithIdentityFromFile(ds.grpc.CertFile, ds.grpc.KeyFile),
 	).Client(
-		tlsconfig.WithAuthorityFromFile(grpc.CAFile),
-		tlsconfig.WithServerName("otel-collector"),
+		tlsconfig.WithAuthorityFromFile(ds.grpc.CAFile),
+		tlsconfig.WithServerName(dest.serverName("otel-collector")),
 	)
 	if err != nil {
-		l.Fatalf("failed to configure client TLS: %s", err)
+		ds.log.Fatalf("failed to configure client TLS: %s", err)
 	}
+	ds.verifyIdentity(clientCreds)
 
-	occl := log.New(l.Writer(), fmt.Sprintf("[OTEL COLLECTOR CLIENT] -> %s: ", dest.Ingress), l.Flags())
+	occl := log.New(ds.log.Writer(), fmt.Sprintf("[OTEL COLLECTOR CLIENT] -> %s: ", dest.Ingress), ds.log.Flags())
 
-	w, err := otelcolclient.NewGRPCWriter(dest.Ingress, clientCreds, occl)
+	w, err := otelcolclient.NewGRPCWriter(dest.Ingress, clientCreds, status.errorLogger(occl), status.dialOption(ctx))
 	if err != nil {
-		l.Fatalf("Failed to create OTel Collector gRPC writer for %s: %s", dest.Ingress, err)
+		ds.log.Fatalf("Failed to create OTel Collector gRPC writer for %s: %s", dest.Ingress, err)
 	}
 
-	expired := m.NewCounter(
+	expired := ds.m.NewCounter(
 		"egress_expired_total",
 		"Total number of envelopes that expired before they could be egressed.",
 		metrics.WithMetricLabels(map[string]string{
@@ -255,34 +855,82 @@ func otelCollectorClient(dest destination, grpc GRPC, m Metrics, emitTraces, emi
 			"destination": dest.Ingress,
 		}),
 	)
-	dw := egress.NewDiodeWriter(context.Background(), otelcolclient.New(w, emitTraces, emitMetrics, emitLogs), gendiodes.AlertFunc(func(missed int) {
+	cw := egress_v2.NewCountingWriter(
+		ds.stripEmitter(otelcolclient.New(w, ds.emitOTelTraces, ds.emitOTelMetrics, ds.emitOTelLogs)),
+		egress_v2.NewEgressCounter(ds.m, egress_v2.DestinationOTLP),
+	)
+	slo := egress_v2.NewDeliverySLO(ds.m, dest.Ingress, ds.sloOptions()...)
+	var sw egress.WriteCloser = egress_v2.NewSLOWriter(status.writer(cw), slo)
+	var window *egress_v2.CreditWindow
+	if ds.creditWindow > 0 {
+		window = egress_v2.NewCreditWindow(ds.creditWindow, ds.m, dest.Ingress)
+		sw = egress_v2.NewCreditReleasingWriter(sw, window)
+	}
+	dw := egress.NewDiodeWriter(ctx, sw, gendiodes.AlertFunc(func(missed int) {
 		expired.Add(float64(missed))
 	}), timeoutwaitgroup.New(time.Minute))
+	go slo.Run(ctx, dw, time.Second)
 
+	if window != nil {
+		return egress_v2.NewCreditWriter(dw, window)
+	}
 	return dw
 }
 
-func loggregatorClient(dest destination, grpc GRPC, m Metrics, l *log.Logger) Writer {
+// dropsondeClient converts the envelopes to v1 envelopes and sends them to
+// the dropsonde UDP endpoint of a legacy consumer. The endpoint is not
+// authenticated, so the consumer's certificates are not used. It returns
+// an error if the address of the endpoint cannot be resolved.
+func (ds downstreamSettings) dropsondeClient(ctx context.Context, dest destination, status *consumerStatus) (Writer, error) {
+	udp, err := egress_v1.NewUDPWriter(dest.Ingress)
+	status.dialed(err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dropsonde writer for %s: %s", dest.Ingress, err)
+	}
+
+	expired := ds.m.NewCounter(
+		"egress_expired_total",
+		"Total number of envelopes that expired before they could be egressed.",
+		metrics.WithMetricLabels(map[string]string{
+			"protocol":    dest.Protocol,
+			"destination": dest.Ingress,
+		}),
+	)
+	dl := log.New(ds.log.Writer(), fmt.Sprintf("[DROPSONDE CLIENT] -> %s: ", dest.Ingress), ds.log.Flags())
+
+	cw := egress_v2.NewCountingWriter(
+		ds.stripEmitter(dropsondeWriter{egress_v1.NewConvertingWriter(udp), status.errorLogger(dl)}),
+		egress_v2.NewEgressCounter(ds.m, egress_v2.DestinationDropsonde),
+	)
+	return egress.NewDiodeWriter(ctx, status.writer(cw), gendiodes.AlertFunc(func(missed int) {
+		expired.Add(float64(missed))
+	}), timeoutwaitgroup.New(time.Minute)), nil
+}
+
+func (ds downstreamSettings) loggregatorClient(ctx context.Context, dest destination, status *consumerStatus) Writer {
 	clientCreds, err := loggregator.NewIngressTLSConfig(
-		grpc.CAFile,
-		grpc.CertFile,
-		grpc.KeyFile,
+		ds.grpc.CAFile,
+		ds.grpc.CertFile,
+		ds.grpc.KeyFile,
 	)
 	if err != nil {
-		l.Fatalf("failed to configure client TLS: %s", err)
+		ds.log.Fatalf("failed to configure client TLS: %s", err)
 	}
+	clientCreds.ServerName = dest.serverName(clientCreds.ServerName)
+	ds.verifyIdentity(clientCreds)
 
-	il := log.New(l.Writer(), fmt.Sprintf("[INGRESS CLIENT] -> %s: ", dest.Ingress), l.Flags())
+	il := log.New(ds.log.Writer(), fmt.Sprintf("[INGRESS CLIENT] -> %s: ", dest.Ingress), ds.log.Flags())
 	ingressClient, err := loggregator.NewIngressClient(
 		clientCreds,
-		loggregator.WithLogger(il),
+		loggregator.WithLogger(status.errorLogger(il)),
 		loggregator.WithAddr(dest.Ingress),
+		loggregator.WithDialOptions(status.dialOption(ctx)),
 	)
 	if err != nil {
-		l.Fatalf("failed to create ingress client for %s: %s", dest.Ingress, err)
+		ds.log.Fatalf("failed to create ingress client for %s: %s", dest.Ingress, err)
 	}
 
-	expired := m.NewCounter(
+	expired := ds.m.NewCounter(
 		"egress_expired_total",
 		"Total number of envelopes that expired before they could be egressed.",
 		metrics.WithMetricLabels(map[string]string{
@@ -291,11 +939,28 @@ func loggregatorClient(dest destination, grpc GRPC, m Metrics, l *log.Logger) Wr
 		}),
 	)
 
-	ctx := context.Background()
-	wc := clientWriter{ingressClient}
-	dw := egress.NewDiodeWriter(ctx, wc, gendiodes.AlertFunc(func(missed int) {
+	wc := egress_v2.NewCountingWriter(
+		ds.stripEmitter(clientWriter{ingressClient}),
+		egress_v2.NewEgressCounter(ds.m, egress_v2.DestinationLoggregator),
+	)
+	slo := egress_v2.NewDeliverySLO(ds.m, dest.Ingress, ds.sloOptions()...)
+	var sw egress.WriteCloser = egress_v2.NewSLOWriter(status.writer(wc), slo)
+	var window *egress_v2.CreditWindow
+	if ds.creditWindow > 0 {
+		// The ingress client accepts envelopes once its stream has room
+		// for them, i.e. the downstream has sent window updates for the
+		// envelopes before them.
+		window = egress_v2.NewCreditWindow(ds.creditWindow, ds.m, dest.Ingress)
+		sw = egress_v2.NewCreditReleasingWriter(sw, window)
+	}
+	dw := egress.NewDiodeWriter(ctx, sw, gendiodes.AlertFunc(func(missed int) {
 		expired.Add(float64(missed))
 		il.Printf("Dropped %d logs for url %s", missed, dest.Ingress)
 	}), timeoutwaitgroup.New(time.Minute))
+	go slo.Run(ctx, dw, time.Second)
+
+	if window != nil {
+		return egress_v2.NewCreditWriter(dw, window)
+	}
 	return dw
 }
@@ -2,11 +2,15 @@ package app_test
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -20,10 +24,19 @@ import (
 	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
 	"code.cloudfoundry.org/loggregator-agent-release/src/cmd/forwarder-agent/app"
 	"code.cloudfoundry.org/loggregator-agent-release/src/internal/testhelper"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/admin"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/agentlib"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/buildinfo"
+	egress_v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
+	ingress_v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/ingress/v2"
 
+	"github.com/cloudfoundry/sonde-go/events"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/gbytes"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/proto"
 )
 
 var _ = Describe("App", func() {
@@ -172,6 +185,86 @@ var _ = Describe("App", func() {
 				return nil
 			}, 5).Should(BeNil())
 		})
+
+		It("exposes the pipeline status", func() {
+			var resp *http.Response
+			Eventually(func() error {
+				var err error
+				resp, err = http.Get(fmt.Sprintf("http://127.0.0.1:%d/debug/pipeline", agentCfg.MetricsServer.PprofPort))
+				return err
+			}, 5).Should(Succeed())
+			defer resp.Body.Close()
+
+			var body struct {
+				Stages []egress_v2.StageStatus `json:"stages"`
+			}
+			Expect(json.NewDecoder(resp.Body).Decode(&body)).To(Succeed())
+			Expect(body.Stages).To(ContainElement(HaveField("Stage", "ingress")))
+			Expect(body.Stages).To(HaveLen(4))
+		})
+
+		It("exposes the downstream consumers", func() {
+			var resp *http.Response
+			Eventually(func() error {
+				var err error
+				resp, err = http.Get(fmt.Sprintf("http://127.0.0.1:%d/debug/consumers", agentCfg.MetricsServer.PprofPort))
+				return err
+			}, 5).Should(Succeed())
+			defer resp.Body.Close()
+
+			var body struct {
+				Consumers []app.ConsumerStatus `json:"consumers"`
+			}
+			Expect(json.NewDecoder(resp.Body).Decode(&body)).To(Succeed())
+			Expect(body.Consumers).To(HaveLen(3))
+			Expect(body.Consumers).To(ContainElement(SatisfyAll(
+				HaveField("File", ingressServer1.cfgFile),
+				HaveField("Destination", ingressServer1.addr),
+				HaveField("State", "connected"),
+				HaveField("Envelopes", BeNumerically(">=", 1)),
+			)))
+		})
+	})
+
+	Context("when a unix socket is configured", func() {
+		var socketPath string
+
+		BeforeEach(func() {
+			socketPath = filepath.Join(GinkgoT().TempDir(), "agent.sock")
+			agentCfg.UnixSocket = app.UnixSocket{
+				Path:        socketPath,
+				Permissions: "0600",
+			}
+		})
+
+		It("creates the socket with the configured permissions", func() {
+			Eventually(func() (os.FileMode, error) {
+				fi, err := os.Stat(socketPath)
+				if err != nil {
+					return 0, err
+				}
+				return fi.Mode().Perm(), nil
+			}, 5).Should(Equal(os.FileMode(0600)))
+		})
+
+		It("forwards envelopes received on the socket downstream", func() {
+			conn, err := grpc.NewClient(
+				"unix://"+socketPath,
+				grpc.WithTransportCredentials(insecure.NewCredentials()),
+			)
+			Expect(err).ToNot(HaveOccurred())
+			defer conn.Close()
+			client := loggregator_v2.NewIngressClient(conn)
+
+			Eventually(func() error {
+				_, err := client.Send(context.Background(), &loggregator_v2.EnvelopeBatch{
+					Batch: []*loggregator_v2.Envelope{sampleEnvelope},
+				})
+				return err
+			}, 5).Should(Succeed())
+
+			Eventually(ingressServer1.envelopes, 5).Should(Receive(protoEqual(sampleEnvelope)))
+		})
 	})
 
 	It("forwards all envelopes downstream", func() {
@@ -291,6 +384,497 @@ var _ = Describe("App", func() {
 		Expect(e2.GetTags()["some-tag"]).To(Equal("some-value"))
 	})
 
+	It("emits a startup metric tagged with the version", func() {
+		Expect(agentMetrics.HasMetric("startups", map[string]string{
+			"version": buildinfo.Version,
+			"commit":  buildinfo.Get().Commit,
+		})).To(BeTrue())
+	})
+
+	It("emits a config info metric", func() {
+		Expect(agentMetrics.HasMetric("config_info", map[string]string{
+			"fingerprint":       config.Fingerprint(agentCfg, "Tags.index", "Tags.ip"),
+			"priority_dropping": "false",
+			"max_tag_bytes":     "0",
+		})).To(BeTrue())
+	})
+
+	Context("when the agent version tag is enabled", func() {
+		BeforeEach(func() {
+			agentCfg.AgentVersionTag = true
+		})
+
+		It("tags with the agent version before forwarding downstream", func() {
+			Expect(ingressClient.EmitEvent(context.TODO(), "test-title", "test-body")).To(Succeed())
+
+			var e *loggregator_v2.Envelope
+			Eventually(ingressServer1.envelopes, 5).Should(Receive(&e))
+			Expect(e.GetTags()).To(HaveKeyWithValue("agent_version", buildinfo.Version))
+		})
+	})
+
+	Context("when the info port is configured", func() {
+		var infoPort int
+
+		BeforeEach(func() {
+			infoPort = 33000 + GinkgoParallelProcess()
+			agentCfg.MetricsServer.InfoPort = uint16(infoPort)
+		})
+
+		It("serves the build info", func() {
+			var resp *http.Response
+			Eventually(func() error {
+				var err error
+				resp, err = http.Get(fmt.Sprintf("http://127.0.0.1:%d/info", infoPort))
+				return err
+			}).Should(Succeed())
+			defer resp.Body.Close()
+
+			var info buildinfo.Info
+			Expect(json.NewDecoder(resp.Body).Decode(&info)).To(Succeed())
+			Expect(info.Version).To(Equal(buildinfo.Version))
+		})
+	})
+
+	Context("when placement metadata is configured", func() {
+		BeforeEach(func() {
+			path := filepath.Join(GinkgoT().TempDir(), "placement.json")
+			Expect(os.WriteFile(path, []byte(`{"cell_id":"cell-1","some-tag":"other-value"}`), 0600)).To(Succeed())
+			agentCfg.PlacementMetadata = app.PlacementMetadata{
+				File:            path,
+				RefreshInterval: time.Minute,
+			}
+		})
+
+		It("tags with the placement metadata before forwarding downstream", func() {
+			Expect(ingressClient.EmitEvent(context.TODO(), "test-title", "test-body")).To(Succeed())
+
+			var e *loggregator_v2.Envelope
+			Eventually(ingressServer1.envelopes, 5).Should(Receive(&e))
+			Expect(e.GetTags()).To(HaveKeyWithValue("cell_id", "cell-1"))
+			Expect(e.GetTags()).To(HaveKeyWithValue("some-tag", "some-value"))
+		})
+	})
+
+	Context("when the tag size is limited", func() {
+		BeforeEach(func() {
+			agentCfg.Tags["large-tag"] = strings.Repeat("a", 1000)
+			agentCfg.MaxTagBytes = 100
+		})
+
+		It("truncates the tags before forwarding downstream", func() {
+			Expect(ingressClient.EmitEvent(context.TODO(), "test-title", "test-body")).To(Succeed())
+
+			var e *loggregator_v2.Envelope
+			Eventually(ingressServer1.envelopes, 5).Should(Receive(&e))
+			Expect(e.GetTags()).To(HaveKeyWithValue("some-tag", "some-value"))
+			Expect(e.GetTags()).To(HaveKeyWithValue("tags_truncated", "true"))
+			Expect(len(e.GetTags()["large-tag"])).To(BeNumerically("<", 100))
+			Expect(agentMetrics.GetMetricValue("tags_truncated", nil)).To(BeNumerically(">=", 1))
+		})
+	})
+
+	Context("when envelope size metrics are enabled", func() {
+		BeforeEach(func() {
+			agentCfg.EnvelopeSizeMetrics = true
+		})
+
+		It("records the sizes of the ingressed envelopes", func() {
+			ingressClient.Emit(sampleEnvelope)
+
+			Eventually(func() float64 {
+				return agentMetrics.GetMetricValue("ingress_log_payload_size_bytes", nil)
+			}, 5).Should(BeNumerically(">=", len("hello")))
+			Eventually(func() float64 {
+				return agentMetrics.GetMetricValue("ingress_envelope_size_bytes", map[string]string{"envelope_type": "event"})
+			}, 5).Should(BeNumerically(">", 0))
+		})
+	})
+
+	Context("when future timestamps are rejected", func() {
+		BeforeEach(func() {
+			agentCfg.FutureTimestampTolerance = time.Minute
+			agentCfg.FutureTimestampAction = ingress_v2.FutureTimestampReject
+		})
+
+		It("drops envelopes timestamped too far in the future", func() {
+			future := proto.Clone(sampleEnvelope).(*loggregator_v2.Envelope)
+			future.Timestamp = time.Now().Add(time.Hour).UnixNano()
+			ingressClient.Emit(future)
+
+			Eventually(func() float64 {
+				return agentMetrics.GetMetricValue("future_timestamp_envelopes", map[string]string{"action": "reject"})
+			}, 5).Should(Equal(1.0))
+			Consistently(ingressServer1.envelopes).ShouldNot(Receive())
+		})
+	})
+
+	Context("when the journald socket is configured", func() {
+		var socketPath string
+
+		BeforeEach(func() {
+			socketPath = filepath.Join(GinkgoT().TempDir(), "journald.sock")
+			agentCfg.Journald.SocketPath = socketPath
+		})
+
+		It("forwards journal entries downstream as logs", func() {
+			var conn net.Conn
+			Eventually(func() error {
+				var err error
+				conn, err = net.Dial("unix", socketPath)
+				return err
+			}).Should(Succeed())
+			_, err := conn.Write([]byte(`{"_SYSTEMD_UNIT":"nginx.service","MESSAGE":"some-message"}` + "\n"))
+			Expect(err).ToNot(HaveOccurred())
+			conn.Close()
+
+			var e *loggregator_v2.Envelope
+			Eventually(ingressServer1.envelopes, 5).Should(Receive(&e))
+			Expect(e.GetSourceId()).To(Equal("nginx.service"))
+			Expect(e.GetLog().GetPayload()).To(Equal([]byte("some-message")))
+		})
+	})
+
+	Context("when file tail globs are configured", func() {
+		var logFile string
+
+		BeforeEach(func() {
+			dir := GinkgoT().TempDir()
+			logFile = filepath.Join(dir, "component.log")
+			agentCfg.FileTail.Globs = []string{filepath.Join(dir, "*.log")}
+			agentCfg.FileTail.CheckpointFile = filepath.Join(dir, "checkpoints.json")
+			agentCfg.FileTail.PollInterval = 10 * time.Millisecond
+		})
+
+		It("forwards the lines of new files downstream as logs", func() {
+			Eventually(agentCfg.FileTail.CheckpointFile).Should(BeAnExistingFile())
+			Expect(os.WriteFile(logFile, []byte("some-line\n"), 0600)).To(Succeed())
+
+			var e *loggregator_v2.Envelope
+			Eventually(ingressServer1.envelopes, 5).Should(Receive(&e))
+			Expect(e.GetSourceId()).To(Equal("component.log"))
+			Expect(e.GetTags()).To(HaveKeyWithValue("file", logFile))
+			Expect(e.GetLog().GetPayload()).To(Equal([]byte("some-line")))
+		})
+	})
+
+	Context("when plugins are configured", func() {
+		var sink *pluginSink
+
+		BeforeEach(func() {
+			sink = &pluginSink{envelopes: make(chan *loggregator_v2.Envelope, 100)}
+			pluginSinks <- sink
+			Expect(agentCfg.Plugins.UnmarshalEnv(`[
+				{"type":"source","name":"forwarder-test-source"},
+				{"type":"sink","name":"forwarder-test-sink"}
+			]`)).To(Succeed())
+		})
+
+		It("writes the envelopes of plugin sources to plugin sinks", func() {
+			Eventually(sink.envelopes, 5).Should(Receive(HaveField("SourceId", "plugin-source")))
+		})
+	})
+
+	Context("when named pipelines are configured", func() {
+		var (
+			pipelineCerts      *testhelper.TestCerts
+			pipelinePort       int
+			pipelineDownstream *spyLoggregatorV2Ingress
+		)
+
+		BeforeEach(func() {
+			pipelineCerts = testhelper.GenerateCerts("pipeline-ca")
+			pipelinePort = 33000 + GinkgoParallelProcess()
+			// The downstream is not registered with an ingress_port.yml, so
+			// only the pipeline writes to it.
+			pipelineDownstream = startSpyLoggregatorV2Ingress(pipelineCerts, agentCN, GinkgoT().TempDir())
+			DeferCleanup(pipelineDownstream.close)
+
+			Expect(agentCfg.Pipelines.UnmarshalEnv(fmt.Sprintf(`[{
+				"name": "iso-1",
+				"port": %d,
+				"ca_file": %q,
+				"cert_file": %q,
+				"key_file": %q,
+				"tags": {"isolation_segment": "iso-1"},
+				"destinations": [{"ingress": %q}]
+			}]`,
+				pipelinePort,
+				pipelineCerts.CA(),
+				pipelineCerts.Cert(agentCN),
+				pipelineCerts.Key(agentCN),
+				pipelineDownstream.addr,
+			))).To(Succeed())
+		})
+
+		It("forwards the envelopes of a pipeline only to its destinations", func() {
+			pipelineClient := newIngressClient(pipelinePort, pipelineCerts, 1)
+			Eventually(func() error {
+				return pipelineClient.EmitEvent(context.TODO(), "pipeline-title", "pipeline-body")
+			}, 10).Should(Succeed())
+
+			var e *loggregator_v2.Envelope
+			Eventually(pipelineDownstream.envelopes, 5).Should(Receive(&e))
+			Expect(e.GetEvent().GetTitle()).To(Equal("pipeline-title"))
+			Expect(e.GetTags()).To(HaveKeyWithValue("isolation_segment", "iso-1"))
+			Expect(e.GetTags()).To(HaveKeyWithValue("some-tag", "some-value"))
+
+			Consistently(ingressServer1.envelopes).ShouldNot(Receive(
+				Satisfy(func(e *loggregator_v2.Envelope) bool {
+					return e.GetEvent().GetTitle() == "pipeline-title"
+				}),
+			))
+			Expect(agentMetrics.GetMetric("pipeline_ingress", map[string]string{"pipeline": "iso-1"}).Value()).
+				To(BeNumerically(">=", 1))
+		})
+
+		It("does not accept envelopes from clients with the agent's certificates", func() {
+			client := newIngressClient(pipelinePort, agentCerts, 1)
+			Consistently(func() error {
+				return client.EmitEvent(context.TODO(), "title", "body")
+			}).ShouldNot(Succeed())
+		})
+	})
+
+	Context("when downstream consumers are declared in the config", func() {
+		var (
+			consumerCerts *testhelper.TestCerts
+			consumer      *spyLoggregatorV2Ingress
+		)
+
+		BeforeEach(func() {
+			consumerCerts = testhelper.GenerateCerts("consumer-ca")
+			// The consumer is not registered with an ingress_port.yml.
+			consumer = startSpyLoggregatorV2Ingress(consumerCerts, "some-consumer", GinkgoT().TempDir())
+			DeferCleanup(consumer.close)
+
+			Expect(agentCfg.DownstreamConsumers.UnmarshalEnv(fmt.Sprintf(`[{
+				"ingress": %q,
+				"envelope_types": ["event"],
+				"ca_file": %q,
+				"cert_file": %q,
+				"key_file": %q,
+				"server_name": "some-consumer"
+			}]`,
+				consumer.addr,
+				consumerCerts.CA(),
+				consumerCerts.Cert("forwarder"),
+				consumerCerts.Key("forwarder"),
+			))).To(Succeed())
+		})
+
+		It("forwards the selected envelopes to them with their certificates", func() {
+			var e *loggregator_v2.Envelope
+			Eventually(consumer.envelopes, 5).Should(Receive(&e))
+			Expect(e.GetEvent().GetTitle()).To(Equal("test-title"))
+
+			ingressClient.Emit(sampleEnvelope)
+			Eventually(ingressServer1.envelopes, 5).Should(Receive(Satisfy(func(e *loggregator_v2.Envelope) bool {
+				return e.GetLog() != nil
+			})))
+			Consistently(consumer.envelopes).ShouldNot(Receive())
+			Expect(agentMetrics.GetMetricValue("downstream_consumers", nil)).To(BeNumerically("==", 4))
+		})
+
+		It("rejects consumers with only some certificates", func() {
+			var c app.DownstreamConsumers
+			Expect(c.UnmarshalEnv(`[{"ingress": "10.0.0.5:3459", "ca_file": "ca.crt"}]`)).
+				To(MatchError(ContainSubstring("requires a CA, certificate and key")))
+			Expect(c.UnmarshalEnv(`[{"ingress": "10.0.0.5"}]`)).
+				To(MatchError(ContainSubstring("invalid ingress address")))
+		})
+	})
+
+	Context("when a dropsonde consumer is declared in the config", func() {
+		var conn net.PacketConn
+
+		BeforeEach(func() {
+			var err error
+			conn, err = net.ListenPacket("udp", "127.0.0.1:0")
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(conn.Close)
+
+			Expect(agentCfg.DownstreamConsumers.UnmarshalEnv(fmt.Sprintf(`[{
+				"ingress": %q,
+				"protocol": "dropsonde",
+				"envelope_types": ["log"]
+			}]`, conn.LocalAddr().String()))).To(Succeed())
+		})
+
+		It("forwards the envelopes to it as v1 envelopes", func() {
+			ingressClient.Emit(sampleEnvelope)
+
+			buf := make([]byte, 65536)
+			Expect(conn.SetReadDeadline(time.Now().Add(5 * time.Second))).To(Succeed())
+			n, _, err := conn.ReadFrom(buf)
+			Expect(err).ToNot(HaveOccurred())
+
+			var e events.Envelope
+			Expect(proto.Unmarshal(buf[:n], &e)).To(Succeed())
+			Expect(e.GetEventType()).To(Equal(events.Envelope_LogMessage))
+			Expect(e.GetLogMessage().GetMessage()).To(Equal([]byte("hello")))
+			Expect(e.GetLogMessage().GetAppId()).To(Equal("some-id"))
+		})
+	})
+
+	Context("when a downstream consumer token is configured", func() {
+		var buf *gbytes.Buffer
+
+		BeforeEach(func() {
+			buf = gbytes.NewBuffer()
+			GinkgoWriter.TeeTo(buf)
+
+			agentCfg.DownstreamConsumerToken = "some-token"
+			for _, s := range []*spyLoggregatorV2Ingress{ingressServer1, ingressServer2, ingressServer3} {
+				f, err := os.OpenFile(s.cfgFile, os.O_APPEND|os.O_WRONLY, 0600)
+				Expect(err).ToNot(HaveOccurred())
+				_, err = f.WriteString("token: some-token\n")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(f.Close()).To(Succeed())
+			}
+
+			dir, err := os.MkdirTemp(ingressCfgPath, "")
+			Expect(err).ToNot(HaveOccurred())
+			err = os.WriteFile(filepath.Join(dir, "ingress_port.yml"), []byte("ingress: 1234\ntoken: other-token\n"), 0600)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("ignores consumers without the token", func() {
+			Eventually(buf).Should(gbytes.Say(`Invalid token in .*/ingress_port.yml. Ignoring this destination.`))
+			Expect(agentMetrics.GetMetricValue("downstream_invalid_consumers", nil)).To(BeNumerically("==", 1))
+			Expect(agentMetrics.GetMetricValue("downstream_consumers", nil)).To(BeNumerically("==", 3))
+		})
+	})
+
+	Context("when downstream consumer identities are allowed", func() {
+		var consumer *spyLoggregatorV2Ingress
+
+		BeforeEach(func() {
+			agentCfg.DownstreamConsumerIdentities = []string{agentCN}
+
+			// The consumer has a certificate signed by the agent's CA
+			// but an identity that is not allowed.
+			consumer = startSpyLoggregatorV2Ingress(agentCerts, "some-consumer", GinkgoT().TempDir())
+			DeferCleanup(consumer.close)
+			Expect(agentCfg.DownstreamConsumers.UnmarshalEnv(fmt.Sprintf(`[{
+				"ingress": %q,
+				"server_name": "some-consumer"
+			}]`, consumer.addr))).To(Succeed())
+		})
+
+		It("only forwards envelopes to consumers with an allowed identity", func() {
+			Consistently(consumer.envelopes).ShouldNot(Receive())
+		})
+	})
+
+	Context("when id rewrite rules are configured", func() {
+		BeforeEach(func() {
+			Expect(agentCfg.IDRewriteRules.UnmarshalEnv(
+				`[{"field":"source_id","pattern":"^cf-(.*)$","replacement":"$1"}]`,
+			)).To(Succeed())
+		})
+
+		It("rewrites the source id before forwarding downstream", func() {
+			ingressClient.Emit(&loggregator_v2.Envelope{
+				SourceId: "cf-some-source",
+				Message: &loggregator_v2.Envelope_Log{
+					Log: &loggregator_v2.Log{Payload: []byte("some-log")},
+				},
+			})
+
+			var e *loggregator_v2.Envelope
+			Eventually(ingressServer1.envelopes, 5).Should(Receive(&e))
+			Expect(e.GetSourceId()).To(Equal("some-source"))
+		})
+	})
+
+	Context("when the admin port is configured", func() {
+		var client *admin.Client
+
+		BeforeEach(func() {
+			agentCfg.AdminPort = uint16(33000 + GinkgoParallelProcess())
+			Expect(agentCfg.IDRewriteRules.UnmarshalEnv(
+				`[{"field":"source_id","pattern":"^cf-(.*)$","replacement":"$1"}]`,
+			)).To(Succeed())
+
+			var err error
+			client, err = admin.NewClient(fmt.Sprintf("127.0.0.1:%d", agentCfg.AdminPort))
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(client.Close)
+		})
+
+		It("disables processors at runtime", func() {
+			Expect(client.SetProcessorEnabled(context.TODO(), "id_rewrite_rules", false)).To(Succeed())
+			ingressClient.Emit(&loggregator_v2.Envelope{
+				SourceId: "cf-some-source",
+				Message: &loggregator_v2.Envelope_Log{
+					Log: &loggregator_v2.Log{Payload: []byte("some-log")},
+				},
+			})
+
+			Eventually(ingressServer1.envelopes, 5).Should(Receive(Satisfy(func(e *loggregator_v2.Envelope) bool {
+				return e.GetSourceId() == "cf-some-source"
+			})))
+		})
+
+		It("dumps the stats of the pipeline", func() {
+			stats, err := client.Stats(context.TODO())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stats).To(HaveKeyWithValue("log_level", admin.LevelInfo))
+			Expect(stats).To(HaveKeyWithValue("processors", map[string]any{"id_rewrite_rules": true}))
+			Expect(stats).To(HaveKey("pipeline"))
+		})
+	})
+
+	Context("when ordering lanes are configured", func() {
+		BeforeEach(func() {
+			agentCfg.OrderingLanes = 4
+		})
+
+		It("forwards the envelopes of a source id in order", func() {
+			for i := 0; i < 10; i++ {
+				ingressClient.Emit(&loggregator_v2.Envelope{
+					SourceId: "some-source",
+					Message: &loggregator_v2.Envelope_Log{
+						Log: &loggregator_v2.Log{Payload: []byte(strconv.Itoa(i))},
+					},
+				})
+			}
+
+			var payloads []string
+			Eventually(func() []string {
+				select {
+				case e := <-ingressServer1.envelopes:
+					if e.GetSourceId() == "some-source" {
+						payloads = append(payloads, string(e.GetLog().GetPayload()))
+					}
+				default:
+				}
+				return payloads
+			}, 5).Should(Equal([]string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9"}))
+		})
+	})
+
+	Context("when priority dropping is enabled", func() {
+		BeforeEach(func() {
+			agentCfg.PriorityDropping = true
+		})
+
+		It("emits a dropped metric for each priority", func() {
+			for _, p := range []string{"low", "normal", "high"} {
+				Expect(agentMetrics.HasMetric("dropped_by_priority", map[string]string{"priority": p})).To(BeTrue())
+			}
+		})
+
+		It("forwards envelopes downstream", func() {
+			Expect(ingressClient.EmitEvent(context.TODO(), "test-title", "test-body")).To(Succeed())
+
+			var e *loggregator_v2.Envelope
+			Eventually(ingressServer1.envelopes, 5).Should(Receive(&e))
+			Expect(e.GetEvent().GetTitle()).To(Equal("test-title"))
+		})
+	})
+
 	It("continues writing to other consumers if one is slow", func() {
 		ctx, cancel := context.WithCancel(context.Background())
 		var wg sync.WaitGroup
@@ -330,6 +914,185 @@ var _ = Describe("App", func() {
 		}, 5, 1).Should(BeTrue())
 	})
 
+	It("emits the state of each downstream consumer", func() {
+		Expect(agentMetrics.GetMetricValue("downstream_consumers", nil)).To(BeNumerically("==", 3))
+		Eventually(func() float64 {
+			return agentMetrics.GetMetricValue("downstream_consumer_connected", map[string]string{"destination": ingressServer1.addr})
+		}).Should(BeNumerically("==", 1))
+		Expect(agentMetrics.GetMetricValue("downstream_consumer_envelopes", map[string]string{"destination": ingressServer1.addr})).
+			To(BeNumerically(">=", 1))
+	})
+
+	Context("when downstream consumers are rescanned", func() {
+		BeforeEach(func() {
+			agentCfg.DownstreamRescanInterval = 100 * time.Millisecond
+		})
+
+		It("forwards envelopes to consumers added while the agent runs", func() {
+			ingressServer4 := startSpyLoggregatorV2Ingress(agentCerts, agentCN, ingressCfgPath)
+			defer ingressServer4.close()
+
+			Eventually(func() bool {
+				ingressClient.Emit(sampleEnvelope)
+				return len(ingressServer4.envelopes) > 0
+			}, 5, 100*time.Millisecond).Should(BeTrue())
+			Expect(agentMetrics.GetMetricValue("downstream_consumers", nil)).To(BeNumerically("==", 4))
+		})
+
+		It("stops forwarding envelopes to removed consumers", func() {
+			Expect(os.Remove(ingressServer2.cfgFile)).To(Succeed())
+			Eventually(func() float64 {
+				return agentMetrics.GetMetricValue("downstream_consumers", nil)
+			}, 5).Should(BeNumerically("==", 2))
+			Eventually(func() float64 {
+				return agentMetrics.GetMetricValue("downstream_consumer_connected", map[string]string{"destination": ingressServer2.addr})
+			}).Should(BeNumerically("==", 0))
+
+			// Let the envelopes written before the removal arrive.
+			time.Sleep(500 * time.Millisecond)
+			for len(ingressServer2.envelopes) > 0 {
+				<-ingressServer2.envelopes
+			}
+
+			ingressClient.Emit(sampleEnvelope)
+			Eventually(ingressServer1.envelopes, 5).Should(Receive())
+			Consistently(ingressServer2.envelopes, 1).ShouldNot(Receive())
+		})
+	})
+
+	Context("when a downstream credit window is configured", func() {
+		BeforeEach(func() {
+			agentCfg.DownstreamCreditWindow = 10
+		})
+
+		It("stops pushing to a slow consumer and counts the backpressure", func() {
+			backpressure := func(addr string) float64 {
+				return agentMetrics.GetMetricValue("egress_backpressure_total", map[string]string{"destination": addr})
+			}
+
+			Eventually(func() float64 {
+				for i := 0; i < 1000; i++ {
+					ingressClient.Emit(sampleEnvelope)
+				}
+				return backpressure(ingressServer3.addr)
+			}, 10).Should(BeNumerically(">", 0))
+
+			Eventually(ingressServer1.envelopes, 5).Should(Receive())
+		})
+	})
+
+	Context("when a downstream registers a selector", func() {
+		var selectingServer *spyLoggregatorV2Ingress
+
+		BeforeEach(func() {
+			selectingServer = startSpyLoggregatorV2Ingress(agentCerts, agentCN, ingressCfgPath)
+			appendToFile(selectingServer.cfgFile, `selector:
+  source_id_prefix: selected-
+  envelope_types: [log, event]
+  tags:
+    some-tag: some-value
+`)
+		})
+
+		AfterEach(func() {
+			selectingServer.close()
+		})
+
+		It("only forwards the selected envelopes to the downstream", func() {
+			selected := &loggregator_v2.Envelope{
+				SourceId: "selected-source",
+				Message: &loggregator_v2.Envelope_Log{
+					Log: &loggregator_v2.Log{Payload: []byte("selected")},
+				},
+			}
+			otherSource := &loggregator_v2.Envelope{
+				SourceId: "other-source",
+				Message: &loggregator_v2.Envelope_Log{
+					Log: &loggregator_v2.Log{Payload: []byte("other source")},
+				},
+			}
+			otherType := &loggregator_v2.Envelope{
+				SourceId: "selected-source",
+				Message: &loggregator_v2.Envelope_Counter{
+					Counter: &loggregator_v2.Counter{Name: "other-type", Delta: 1},
+				},
+			}
+
+			Eventually(func() bool {
+				ingressClient.Emit(otherSource)
+				ingressClient.Emit(otherType)
+				ingressClient.Emit(selected)
+
+				select {
+				case e := <-selectingServer.envelopes:
+					Expect(e.GetSourceId()).ToNot(Equal("other-source"))
+					Expect(e.GetCounter()).To(BeNil())
+					return e.GetSourceId() == "selected-source"
+				default:
+					return false
+				}
+			}, 5).Should(BeTrue())
+			Eventually(ingressServer1.envelopes, 5).Should(Receive(WithTransform(
+				(*loggregator_v2.Envelope).GetSourceId, Equal("other-source"),
+			)))
+		})
+	})
+
+	Context("when a downstream registers an invalid selector", func() {
+		var buf *gbytes.Buffer
+
+		BeforeEach(func() {
+			buf = gbytes.NewBuffer()
+			GinkgoWriter.TeeTo(buf)
+
+			dir, err := os.MkdirTemp(ingressCfgPath, "")
+			Expect(err).ToNot(HaveOccurred())
+			tmpfn := filepath.Join(dir, "ingress_port.yml")
+
+			err = os.WriteFile(tmpfn, []byte("ingress: 1234\nselector:\n  envelope_types: [metric]\n"), 0600)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("logs a message", func() {
+			Eventually(buf).Should(gbytes.Say(`Invalid selector in .*/ingress_port.yml: unknown envelope type: "metric". Ignoring this destination.`))
+		})
+
+		It("counts the destination as invalid", func() {
+			Expect(agentMetrics.GetMetricValue("downstream_invalid_consumers", nil)).To(BeNumerically("==", 1))
+			Expect(agentMetrics.GetMetricValue("downstream_consumers", nil)).To(BeNumerically("==", 3))
+		})
+	})
+
+	Context("when a downstream registers a dropsonde endpoint that cannot be dialed", func() {
+		var buf *gbytes.Buffer
+
+		BeforeEach(func() {
+			buf = gbytes.NewBuffer()
+			GinkgoWriter.TeeTo(buf)
+
+			dir, err := os.MkdirTemp(ingressCfgPath, "")
+			Expect(err).ToNot(HaveOccurred())
+			tmpfn := filepath.Join(dir, "ingress_port.yml")
+
+			err = os.WriteFile(tmpfn, []byte("ingress: 99999\nprotocol: dropsonde\n"), 0600)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("logs a message and counts the destination as invalid", func() {
+			Eventually(buf).Should(gbytes.Say(`failed to create dropsonde writer for 127.0.0.1:99999: .*. Ignoring this destination.`))
+			Eventually(func() float64 {
+				return agentMetrics.GetMetricValue("downstream_invalid_consumers", nil)
+			}).Should(BeNumerically("==", 1))
+			Expect(agentMetrics.GetMetricValue("downstream_consumers", nil)).To(BeNumerically("==", 3))
+		})
+
+		It("keeps forwarding to the other consumers", func() {
+			ingressClient.Emit(sampleEnvelope)
+
+			Eventually(ingressServer1.envelopes, 5).Should(Receive())
+		})
+	})
+
 	Context("when an OTel Collector is co-located but disabled", func() {
 		var buf *gbytes.Buffer
 
@@ -663,3 +1426,50 @@ var _ = Describe("App", func() {
 		})
 	})
 })
+
+func appendToFile(path, contents string) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+	defer f.Close()
+
+	_, err = f.WriteString(contents)
+	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+}
+
+// pluginSinks passes the sink of a test to the factory of the
+// forwarder-test-sink plugin.
+var pluginSinks = make(chan *pluginSink, 1)
+
+func init() {
+	agentlib.RegisterSource("forwarder-test-source", func(map[string]string, agentlib.MetricClient, *log.Logger) (agentlib.Source, error) {
+		return pluginSource{}, nil
+	})
+	agentlib.RegisterSink("forwarder-test-sink", func(map[string]string, agentlib.MetricClient, *log.Logger) (egress_v2.Writer, error) {
+		return <-pluginSinks, nil
+	})
+}
+
+type pluginSource struct{}
+
+func (pluginSource) Run(ctx context.Context, w egress_v2.Writer) {
+	for {
+		_ = w.Write(ctx, &loggregator_v2.Envelope{SourceId: "plugin-source"})
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+type pluginSink struct {
+	envelopes chan *loggregator_v2.Envelope
+}
+
+func (s *pluginSink) Write(_ context.Context, e *loggregator_v2.Envelope) error {
+	select {
+	case s.envelopes <- e:
+	default:
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"maps"
+
+	metrics "code.cloudfoundry.org/go-metric-registry"
+	"google.golang.org/grpc"
+
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/agentlib"
+	v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/ingress/v2"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/plumbing"
+)
+
+// runningPipeline is a started named pipeline.
+type runningPipeline struct {
+	pipeline *agentlib.Pipeline
+	srv      *v2.Server
+}
+
+func (p runningPipeline) stop() {
+	p.srv.Stop()
+	p.pipeline.Stop()
+}
+
+// startPipelines starts the named pipelines. They share nothing with the
+// main pipeline but the agent's tags and settings.
+func (s *ForwarderAgent) startPipelines() {
+	for _, cfg := range s.pipelines {
+		p, err := s.startPipeline(cfg)
+		if err != nil {
+			s.log.Fatalf("failed to start pipeline %q: %s", cfg.Name, err)
+		}
+		s.runningPipelines = append(s.runningPipelines, p)
+	}
+}
+
+func (s *ForwarderAgent) startPipeline(cfg Pipeline) (runningPipeline, error) {
+	l := log.New(s.log.Writer(), fmt.Sprintf("[PIPELINE %s] ", cfg.Name), s.log.Flags())
+	m := pipelineMetrics{Metrics: s.m, name: cfg.Name}
+
+	tags := maps.Clone(s.tags)
+	if tags == nil {
+		tags = make(map[string]string)
+	}
+	maps.Copy(tags, cfg.Tags)
+	opts := []agentlib.Option{
+		agentlib.WithTags(tags),
+		agentlib.WithMaxTagBytes(s.maxTagBytes),
+	}
+
+	dests := make([]destination, 0, len(cfg.Destinations))
+	for _, d := range cfg.Destinations {
+		dests = append(dests, destination{Ingress: d.Ingress, Protocol: d.Protocol})
+	}
+	grpcCfg := GRPC{
+		CAFile:       cfg.CAFile,
+		CertFile:     cfg.CertFile,
+		KeyFile:      cfg.KeyFile,
+		CipherSuites: s.grpc.CipherSuites,
+	}
+	writers, err := s.downstreamSettings(grpcCfg, m, l).writers(dests)
+	if err != nil {
+		return runningPipeline{}, err
+	}
+	for i, w := range writers {
+		opts = append(opts, agentlib.WithDestination(w, cfg.Destinations[i].selector()))
+	}
+
+	plugins, err := cfg.Plugins.Build(m, l)
+	if err != nil {
+		return runningPipeline{}, fmt.Errorf("failed to create plugins: %s", err)
+	}
+	opts = append(opts, agentlib.WithPlugins(plugins))
+
+	var credsOpts []plumbing.ConfigOption
+	if len(s.grpc.CipherSuites) > 0 {
+		credsOpts = append(credsOpts, plumbing.WithCipherSuites(s.grpc.CipherSuites))
+	}
+	creds, err := plumbing.NewServerCredentials(cfg.CertFile, cfg.KeyFile, cfg.CAFile, credsOpts...)
+	if err != nil {
+		return runningPipeline{}, fmt.Errorf("failed to configure server TLS: %s", err)
+	}
+
+	p := agentlib.New(m, opts...)
+	p.Start()
+
+	srv := v2.NewServer(
+		fmt.Sprintf("127.0.0.1:%d", cfg.Port),
+		p.Receiver(),
+		grpc.Creds(creds),
+		grpc.MaxRecvMsgSize(10*1024*1024),
+	)
+	if s.grpc.HealthAndReflection {
+		srv.EnableHealthAndReflection()
+	}
+	go srv.Start()
+
+	return runningPipeline{pipeline: p, srv: srv}, nil
+}
+
+// pipelineMetrics creates the metrics of a named pipeline. They are
+// prefixed with pipeline_ and labeled with the name of the pipeline, so
+// that they are told apart from the metrics of the main pipeline, which
+// have the same names but no pipeline label.
+type pipelineMetrics struct {
+	Metrics
+	name string
+}
+
+func (m pipelineMetrics) NewCounter(name, helpText string, opts ...metrics.MetricOption) metrics.Counter {
+	return m.Metrics.NewCounter("pipeline_"+name, helpText, m.labeled(opts)...)
+}
+
+func (m pipelineMetrics) NewGauge(name, helpText string, opts ...metrics.MetricOption) metrics.Gauge {
+	return m.Metrics.NewGauge("pipeline_"+name, helpText, m.labeled(opts)...)
+}
+
+func (m pipelineMetrics) labeled(opts []metrics.MetricOption) []metrics.MetricOption {
+	return append(opts, metrics.WithMetricLabels(map[string]string{"pipeline": m.name}))
+}
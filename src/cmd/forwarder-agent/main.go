@@ -21,6 +21,14 @@ func main() {
 		logger.SetOutput(new(plumbing.LogWriter))
 		logger.SetFlags(0)
 	}
+	if cfg.EventLogSource != "" {
+		if err := plumbing.AddEventLogOutput(logger, cfg.EventLogSource); err != nil {
+			logger.Fatalf("failed to open event log: %s", err)
+		}
+	}
+	if cfg.LogThrottleInterval > 0 {
+		plumbing.ThrottleLogOutput(logger, cfg.LogThrottleInterval)
+	}
 	m := metrics.NewRegistry(
 		logger,
 		metrics.WithTLSServer(
@@ -31,9 +39,12 @@ func main() {
 		),
 	)
 
-	app.NewForwarderAgent(
+	a := app.NewForwarderAgent(
 		cfg,
 		m,
 		logger,
-	).Run()
+	)
+	if err := plumbing.RunService("loggr-forwarder-agent", a.Run, a.Stop); err != nil {
+		logger.Fatalf("failed to run as a service: %s", err)
+	}
 }
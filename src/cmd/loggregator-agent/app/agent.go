@@ -1,17 +1,29 @@
 package app
 
 import (
+	"context"
 	"log"
 	"net"
 	"os"
+	"sync"
+	"time"
 
 	metrics "code.cloudfoundry.org/go-metric-registry"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/plumbing"
+	"google.golang.org/grpc/credentials"
 )
 
+// v1StopTimeout is how long Stop waits for the v1 API to write the
+// envelopes it read to Dopplers.
+const v1StopTimeout = 5 * time.Second
+
 type Agent struct {
 	config *Config
 	lookup func(string) ([]net.IP, error)
+
+	mu    sync.Mutex
+	appV1 *AppV1
+	appV2 *AppV2
 }
 
 // AgentOption configures agent options.
@@ -41,27 +53,12 @@ func NewAgent(
 }
 
 func (a *Agent) Start() {
-	clientCreds, err := plumbing.NewClientCredentials(
-		a.config.GRPC.CertFile,
-		a.config.GRPC.KeyFile,
-		a.config.GRPC.CAFile,
-		"doppler",
-	)
+	clientCreds, err := a.clientCredentials()
 	if err != nil {
 		log.Fatalf("Could not use GRPC creds for client: %s", err)
 	}
 
-	var opts []plumbing.ConfigOption
-	if len(a.config.GRPC.CipherSuites) > 0 {
-		opts = append(opts, plumbing.WithCipherSuites(a.config.GRPC.CipherSuites))
-	}
-
-	serverCreds, err := plumbing.NewServerCredentials(
-		a.config.GRPC.CertFile,
-		a.config.GRPC.KeyFile,
-		a.config.GRPC.CAFile,
-		opts...,
-	)
+	serverCreds, err := a.serverCredentials()
 	if err != nil {
 		log.Fatalf("Could not use GRPC creds for server: %s", err)
 	}
@@ -81,9 +78,54 @@ func (a *Agent) Start() {
 	)
 	logger.Printf("metrics bound to: :%s", metricClient.Port())
 
-	appV1 := NewV1App(a.config, clientCreds, metricClient)
-	go appV1.Start()
+	a.mu.Lock()
+	a.appV1 = NewV1App(a.config, clientCreds, metricClient)
+	go a.appV1.Start()
+	a.appV2 = NewV2App(a.config, clientCreds, serverCreds, metricClient)
+	appV2 := a.appV2
+	a.mu.Unlock()
 
-	appV2 := NewV2App(a.config, clientCreds, serverCreds, metricClient)
 	appV2.Start()
 }
+
+// Stop stops the v1 API, waiting up to v1StopTimeout for it to write the
+// envelopes it read, and the v2 API.
+func (a *Agent) Stop() {
+	a.mu.Lock()
+	appV1, appV2 := a.appV1, a.appV2
+	a.mu.Unlock()
+
+	if appV1 != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), v1StopTimeout)
+		defer cancel()
+		if err := appV1.Stop(ctx); err != nil {
+			log.Printf("failed to stop the v1 API: %s", err)
+		}
+	}
+	if appV2 != nil {
+		appV2.Stop()
+	}
+}
+
+func (a *Agent) clientCredentials() (credentials.TransportCredentials, error) {
+	return plumbing.NewClientCredentials(
+		a.config.GRPC.CertFile,
+		a.config.GRPC.KeyFile,
+		a.config.GRPC.CAFile,
+		"doppler",
+	)
+}
+
+func (a *Agent) serverCredentials() (credentials.TransportCredentials, error) {
+	var opts []plumbing.ConfigOption
+	if len(a.config.GRPC.CipherSuites) > 0 {
+		opts = append(opts, plumbing.WithCipherSuites(a.config.GRPC.CipherSuites))
+	}
+
+	return plumbing.NewServerCredentials(
+		a.config.GRPC.CertFile,
+		a.config.GRPC.KeyFile,
+		a.config.GRPC.CAFile,
+		opts...,
+	)
+}
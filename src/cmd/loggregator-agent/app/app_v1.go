@@ -3,10 +3,12 @@ package app
 import (
 	metrics "code.cloudfoundry.org/go-metric-registry"
 
+	"context"
 	"fmt"
 	"log"
 	"math/rand"
 	"net"
+	"sync"
 	"time"
 
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/clientpool"
@@ -24,6 +26,11 @@ type AppV1 struct {
 	creds        credentials.TransportCredentials
 	metricClient MetricClient
 	lookup       func(string) ([]net.IP, error)
+
+	mu            sync.Mutex
+	stopped       bool
+	networkReader *ingress.NetworkReader
+	unmarshaller  *ingress.EventUnmarshaller
 }
 
 // AppV1Option configures AppV1 options.
@@ -87,11 +94,37 @@ func (a *AppV1) Start() {
 		log.Panic(fmt.Errorf("Failed to listen on %s: %s", agentAddress, err))
 	}
 
+	a.mu.Lock()
+	if a.stopped {
+		a.mu.Unlock()
+		networkReader.Stop()
+		return
+	}
+	a.networkReader = networkReader
+	a.unmarshaller = dropsondeUnmarshaller
+	a.mu.Unlock()
+
 	log.Printf("agent v1 API started on addr %s", agentAddress)
 	go networkReader.StartReading()
 	networkReader.StartWriting()
 }
 
+// Stop stops the v1 API and aborts the writes to Dopplers that are in
+// progress. It waits until the v1 API is stopped or ctx is done. Start
+// returns once the v1 API is stopped.
+func (a *AppV1) Stop(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.stopped = true
+	if a.networkReader == nil {
+		return nil
+	}
+
+	a.unmarshaller.Stop()
+	return a.networkReader.Shutdown(ctx)
+}
+
 func (a *AppV1) initializeV1DopplerPool() *egress.EventMarshaller {
 	pool := a.setupGRPC()
 
@@ -1,9 +1,11 @@
 package app_test
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"sync"
+	"time"
 
 	"code.cloudfoundry.org/loggregator-agent-release/src/internal/testhelper"
 
@@ -76,6 +78,34 @@ var _ = Describe("v1 App", func() {
 	})
 })
 
+var _ = Describe("v1 App Stop", func() {
+	It("stops the v1 API", func() {
+		testCerts := testhelper.GenerateCerts("loggregatorCA")
+		clientCreds, err := plumbing.NewClientCredentials(
+			testCerts.Cert("metron"),
+			testCerts.Key("metron"),
+			testCerts.CA(),
+			"doppler",
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		config := buildAgentConfig("127.0.0.1", 1234)
+		mc := metricHelpers.NewMetricsRegistry()
+		a := app.NewV1App(&config, clientCreds, mc, app.WithV1Lookup(newSpyLookup().lookup))
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			a.Start()
+		}()
+		Eventually(hasMetric(mc, "ingress", map[string]string{"metric_version": "1.0"})).Should(BeTrue())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		Eventually(func() error { return a.Stop(ctx) }).Should(Succeed())
+		Eventually(done).Should(BeClosed())
+	})
+})
+
 func hasMetric(mc *metricHelpers.SpyMetricsRegistry, metricName string, tags map[string]string) func() bool {
 	return func() bool {
 		return mc.HasMetric(metricName, tags)
@@ -1,22 +1,30 @@
 package app
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"math/rand"
 	"net"
 	"net/http"
 	_ "net/http/pprof" //nolint:gosec
+	"runtime"
+	"strconv"
 	"time"
 
 	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
 	metrics "code.cloudfoundry.org/go-metric-registry"
 
 	gendiodes "code.cloudfoundry.org/go-diodes"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/admin"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/autotune"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/buildinfo"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/clientpool"
 	clientpoolv2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/clientpool/v2"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/config"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/diodes"
 	egress "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/flush"
 	ingress "code.cloudfoundry.org/loggregator-agent-release/src/pkg/ingress/v2"
 	v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/ingress/v2"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/plumbing"
@@ -29,6 +37,7 @@ import (
 type MetricClient interface {
 	NewCounter(name, helpText string, opts ...metrics.MetricOption) metrics.Counter
 	NewGauge(name, helpText string, opts ...metrics.MetricOption) metrics.Gauge
+	NewHistogram(name, helpText string, buckets []float64, opts ...metrics.MetricOption) metrics.Histogram
 	RegisterDebugMetrics()
 }
 
@@ -45,10 +54,17 @@ func WithV2Lookup(l func(string) ([]net.IP, error)) func(*AppV2) {
 type AppV2 struct {
 	config       *Config
 	pprofServer  *http.Server
+	infoServer   *http.Server
+	flushServer  *http.Server
+	adminSrv     *admin.Server
 	clientCreds  credentials.TransportCredentials
 	serverCreds  credentials.TransportCredentials
 	metricClient MetricClient
 	lookup       func(string) ([]net.IP, error)
+
+	// ctx is cancelled on Stop to abort in-flight writes.
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 type envelopeSetter interface {
@@ -62,12 +78,15 @@ func NewV2App(
 	metricClient MetricClient,
 	opts ...AppV2Option,
 ) *AppV2 {
+	ctx, cancel := context.WithCancel(context.Background())
 	a := &AppV2{
 		config:       c,
 		clientCreds:  clientCreds,
 		serverCreds:  serverCreds,
 		metricClient: metricClient,
 		lookup:       net.LookupIP,
+		ctx:          ctx,
+		cancel:       cancel,
 	}
 
 	for _, o := range opts {
@@ -78,15 +97,24 @@ func NewV2App(
 }
 
 func (a *AppV2) Start() {
+	introspector := egress.NewIntrospector()
 	if a.config.MetricsServer.DebugMetrics {
 		a.metricClient.RegisterDebugMetrics()
 		a.pprofServer = &http.Server{
 			Addr:              fmt.Sprintf("127.0.0.1:%d", a.config.MetricsServer.PprofPort),
-			Handler:           http.DefaultServeMux,
+			Handler:           egress.DebugHandler(introspector, http.DefaultServeMux),
 			ReadHeaderTimeout: 2 * time.Second,
 		}
 		go func() { log.Println("PPROF SERVER STOPPED " + a.pprofServer.ListenAndServe().Error()) }()
 	}
+	if a.config.MetricsServer.InfoPort != 0 {
+		a.infoServer = buildinfo.NewServer(a.config.MetricsServer.InfoPort)
+		go func() { log.Println("INFO SERVER STOPPED " + a.infoServer.ListenAndServe().Error()) }()
+	}
+	buildinfo.EmitStartup(a.metricClient)
+	config.EmitConfigInfo(a.metricClient, config.Fingerprint(a.config, "Index", "IP", "Zone", "Tags.index", "Tags.ip"), map[string]string{
+		"disable_udp": strconv.FormatBool(a.config.DisableUDP),
+	})
 
 	if a.serverCreds == nil {
 		log.Panic("Failed to load TLS server config")
@@ -97,7 +125,14 @@ func (a *AppV2) Start() {
 		"Total number of dropped envelopes.",
 		metrics.WithMetricLabels(map[string]string{"direction": "ingress", "metric_version": "2.0"}),
 	)
-	envelopeBuffer := diodes.NewManyToOneEnvelopeV2(10000, gendiodes.AlertFunc(func(missed int) {
+	diodeSize, batchSize := 10000, 100
+	if a.config.Autotune {
+		tuning := autotune.Detect()
+		tuning.SetGOMAXPROCS()
+		log.Printf("Autotuned for %s", tuning)
+		diodeSize, batchSize = tuning.DiodeSize, tuning.BatchSize
+	}
+	envelopeBuffer := diodes.NewManyToOneEnvelopeV2(diodeSize, gendiodes.AlertFunc(func(missed int) {
 		// metric-documentation-v2: (loggregator.metron.dropped) Number of v2 envelopes
 		// dropped from the agent ingress diode
 		droppedMetric.Add(float64(missed))
@@ -105,11 +140,41 @@ func (a *AppV2) Start() {
 		log.Printf("Dropped %d v2 envelopes", missed)
 	}))
 
-	pool := a.initializePool()
-	tagger := egress.NewTagger(a.config.Tags)
+	tags := a.config.Tags
+	if a.config.AgentVersionTag {
+		tags = buildinfo.WithVersionTag(tags)
+	}
+	tagger := egress.NewTagger(tags)
+	tagEnvelope := tagger.TagEnvelope
+	if a.config.MaxTagBytes > 0 {
+		tagLimiter := egress.NewTagLimiter(a.config.MaxTagBytes, a.metricClient.NewCounter(
+			"tags_truncated",
+			"Total number of envelopes with tags truncated to the maximum tag size.",
+			metrics.WithMetricLabels(map[string]string{"metric_version": "2.0"}),
+		))
+		tagEnvelope = func(e *loggregator_v2.Envelope) {
+			tagger.TagEnvelope(e)
+			tagLimiter.LimitTags(e)
+		}
+	}
+	if !a.config.IDRewriteRules.IsZero() {
+		rewriter := a.config.IDRewriteRules
+		tag := tagEnvelope
+		tagEnvelope = func(e *loggregator_v2.Envelope) {
+			rewriter.RewriteEnvelope(e)
+			tag(e)
+		}
+	}
+	writer := a.initializeWriter()
+	slo := egress.NewDeliverySLO(a.metricClient, egress.DestinationDoppler)
+	go slo.Run(a.ctx, envelopeBuffer, time.Second)
+	var aggregatorOpts []egress.CounterAggregatorOption
+	if a.config.CounterCardinalityLimit > 0 {
+		aggregatorOpts = append(aggregatorOpts, egress.WithCardinalityLimit(a.config.CounterCardinalityLimit, a.metricClient))
+	}
 	batchWriter := egress.NewBatchEnvelopeWriter(
-		pool,
-		egress.NewCounterAggregator(tagger.TagEnvelope),
+		egress.NewSLOBatchWriter(writer, slo),
+		egress.NewCounterAggregator(tagEnvelope, aggregatorOpts...),
 	)
 
 	ingressMetric := a.metricClient.NewCounter(
@@ -123,13 +188,42 @@ func (a *AppV2) Start() {
 		metrics.WithMetricLabels(map[string]string{"unit": "bytes/minute", "metric_version": "2.0"}),
 	)
 
+	txOpts := []egress.TransponderOption{egress.WithMaxBatchAge(50 * time.Millisecond)}
+	if a.config.MaxBatchBytes > 0 {
+		txOpts = append(txOpts, egress.WithMaxBatchBytes(a.config.MaxBatchBytes))
+	}
 	tx := egress.NewTransponder(
 		envelopeBuffer,
 		batchWriter,
-		100, 100*time.Millisecond,
+		batchSize, 100*time.Millisecond,
 		a.metricClient,
+		txOpts...,
 	)
-	go tx.Start()
+	go tx.Start(a.ctx)
+
+	if a.config.AdminPort != 0 {
+		logLevel := admin.NewLogLevel(log.Writer())
+		log.SetOutput(logLevel)
+		a.adminSrv = admin.NewServer(
+			a.config.AdminPort,
+			admin.WithLogLevel(logLevel),
+			admin.WithStats(func() any { return introspector.Status() }),
+		)
+		if err := a.adminSrv.Start(); err != nil {
+			log.Fatalf("failed to start admin server: %s", err)
+		}
+	}
+
+	if a.config.Flush.Port != 0 {
+		a.flushServer = flush.NewServer(a.config.Flush.Port, flush.NewHandler(a.config.Flush.Token, a.config.Flush.Timeout, tx))
+		go func() { log.Println("FLUSH SERVER STOPPED " + a.flushServer.ListenAndServe().Error()) }()
+	}
+
+	introspector.Register("ingress", egress.QueueStatus(envelopeBuffer))
+	introspector.Register("batcher", tx)
+	if w, ok := writer.(egress.Introspectable); ok {
+		introspector.Register("writer", w)
+	}
 
 	agentAddress := fmt.Sprintf("127.0.0.1:%d", a.config.GRPC.Port)
 	log.Printf("agent v2 API started on addr %s", agentAddress)
@@ -140,7 +234,18 @@ func (a *AppV2) Start() {
 		es = v2.NewFilteringSetter(envelopeBuffer)
 	}
 
-	rx := ingress.NewReceiver(es, ingressMetric, originMappings)
+	var rxOpts []ingress.ReceiverOption
+	if a.config.EnvelopeSizeMetrics {
+		rxOpts = append(rxOpts, ingress.WithEnvelopeSizes(a.metricClient))
+	}
+	if a.config.FutureTimestampTolerance > 0 {
+		rxOpts = append(rxOpts, ingress.WithFutureTimestamps(
+			a.config.FutureTimestampTolerance,
+			a.config.FutureTimestampAction,
+			a.metricClient,
+		))
+	}
+	rx := ingress.NewReceiver(es, ingressMetric, originMappings, rxOpts...)
 
 	kp := keepalive.EnforcementPolicy{
 		MinTime:             10 * time.Second,
@@ -153,19 +258,94 @@ func (a *AppV2) Start() {
 		grpc.KeepaliveEnforcementPolicy(kp),
 		grpc.MaxRecvMsgSize(10*1024*1024),
 	)
+	if a.config.GRPC.HealthAndReflection {
+		ingressServer.EnableHealthAndReflection()
+	}
 	ingressServer.Start()
 }
 
 func (a *AppV2) Stop() {
+	a.cancel()
 	if a.pprofServer != nil {
 		a.pprofServer.Close()
 	}
+	if a.infoServer != nil {
+		a.infoServer.Close()
+	}
+	if a.flushServer != nil {
+		a.flushServer.Close()
+	}
+	if a.adminSrv != nil {
+		a.adminSrv.Stop()
+	}
+}
+func (a *AppV2) initializeWriter() egress.BatchWriter {
+	if a.config.ShardBySourceID {
+		return a.initializeShardedPool()
+	}
+
+	return a.initializePool()
 }
+
 func (a *AppV2) initializePool() *clientpoolv2.ClientPool {
-	if a.clientCreds == nil {
-		log.Panic("Failed to load TLS client config")
+	connector := clientpoolv2.MakeGRPCConnector(a.senderFetcher(), a.balancers())
+	marshaller := egress.NewBatchMarshaller(runtime.GOMAXPROCS(0))
+
+	var connManagers []clientpoolv2.Conn
+	for i := 0; i < 5; i++ {
+		connManagers = append(connManagers, clientpoolv2.NewConnManager(
+			connector,
+			100000+rand.Int63n(1000), //nolint:gosec
+			time.Second,
+			clientpoolv2.WithBatchMarshaller(marshaller),
+		))
+	}
+
+	if a.config.OrderBySourceID {
+		return clientpoolv2.NewOrdered(connManagers...)
+	}
+	return clientpoolv2.New(connManagers...)
+}
+
+// initializeShardedPool returns a pool with one connection to each Doppler
+// that writes the envelopes of a source ID to the same Doppler. The
+// Dopplers are resolved from the AZ-specific router address if it resolves
+// and from the router address otherwise.
+func (a *AppV2) initializeShardedPool() *clientpoolv2.ShardedPool {
+	fetcher := a.senderFetcher()
+	balancers := a.balancers()
+	marshaller := egress.NewBatchMarshaller(runtime.GOMAXPROCS(0))
+
+	resolve := func() ([]string, error) {
+		var err error
+		for _, b := range balancers {
+			var hostPorts []string
+			hostPorts, err = b.HostPorts()
+			if err == nil {
+				return hostPorts, nil
+			}
+		}
+		return nil, err
 	}
+	newConn := func(addr string) clientpoolv2.ShardConn {
+		b := clientpoolv2.NewBalancer(addr, clientpoolv2.WithLookup(func(host string) ([]net.IP, error) {
+			return []net.IP{net.ParseIP(host)}, nil
+		}))
+		return clientpoolv2.NewConnManager(
+			clientpoolv2.MakeGRPCConnector(fetcher, []*clientpoolv2.Balancer{b}),
+			100000+rand.Int63n(1000), //nolint:gosec
+			time.Second,
+			clientpoolv2.WithBatchMarshaller(marshaller),
+		)
+	}
+
+	pool := clientpoolv2.NewShardedPool(resolve, newConn, time.Minute, a.metricClient)
+	go pool.Start(a.ctx)
+
+	return pool
+}
 
+func (a *AppV2) balancers() []*clientpoolv2.Balancer {
 	balancers := make([]*clientpoolv2.Balancer, 0, 2)
 	if a.config.RouterAddrWithAZ != "" {
 		balancers = append(balancers, clientpoolv2.NewBalancer(
@@ -178,6 +358,14 @@ func (a *AppV2) initializePool() *clientpoolv2.ClientPool {
 		clientpoolv2.WithLookup(a.lookup)),
 	)
 
+	return balancers
+}
+
+func (a *AppV2) senderFetcher() *clientpoolv2.SenderFetcher {
+	if a.clientCreds == nil {
+		log.Panic("Failed to load TLS client config")
+	}
+
 	avgEnvelopeSize := a.metricClient.NewGauge(
 		"average_envelopes",
 		"Average envelope size over the past minute.",
@@ -193,23 +381,10 @@ func (a *AppV2) initializePool() *clientpoolv2.ClientPool {
 		Timeout:             15 * time.Second,
 		PermitWithoutStream: true,
 	}
-	fetcher := clientpoolv2.NewSenderFetcher(
+	return clientpoolv2.NewSenderFetcher(
 		a.metricClient,
 		grpc.WithTransportCredentials(a.clientCreds),
 		grpc.WithStatsHandler(statsHandler),
 		grpc.WithKeepaliveParams(kp),
 	)
-
-	connector := clientpoolv2.MakeGRPCConnector(fetcher, balancers)
-
-	var connManagers []clientpoolv2.Conn
-	for i := 0; i < 5; i++ {
-		connManagers = append(connManagers, clientpoolv2.NewConnManager(
-			connector,
-			100000+rand.Int63n(1000), //nolint:gosec
-			time.Second,
-		))
-	}
-
-	return clientpoolv2.New(connManagers...)
 }
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"time"
 
 	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
 	"code.cloudfoundry.org/loggregator-agent-release/src/cmd/loggregator-agent/app"
@@ -96,6 +97,48 @@ var _ = Describe("v2 App", func() {
 		Eventually(hasMetric(mc, "average_envelopes", map[string]string{"unit": "bytes/minute", "metric_version": "2.0", "loggregator": "v2"})).Should(BeTrue())
 	})
 
+	It("shards envelopes across the resolved dopplers when sharding by source id", func() {
+		spyLookup := newSpyLookup()
+
+		clientCreds, err := plumbing.NewClientCredentials(
+			testCerts.Cert("metron"),
+			testCerts.Key("metron"),
+			testCerts.CA(),
+			"doppler",
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		serverCreds, err := plumbing.NewServerCredentials(
+			testCerts.Cert("router"),
+			testCerts.Key("router"),
+			testCerts.CA(),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		config := buildAgentConfig("127.0.0.1", 1234)
+		config.ShardBySourceID = true
+		expectedHost, _, err := net.SplitHostPort(config.RouterAddrWithAZ)
+		Expect(err).ToNot(HaveOccurred())
+
+		mc := metricsHelpers.NewMetricsRegistry()
+
+		app := app.NewV2App(
+			&config,
+			clientCreds,
+			serverCreds,
+			mc,
+			app.WithV2Lookup(spyLookup.lookup),
+		)
+		go app.Start()
+		defer app.Stop()
+
+		Eventually(spyLookup.calledWith(expectedHost)).Should(BeTrue())
+		Eventually(hasMetric(mc, "doppler_shard_endpoints", map[string]string{"metric_version": "2.0"})).Should(BeTrue())
+		Eventually(func() float64 {
+			return mc.GetMetric("doppler_shard_endpoints", map[string]string{"metric_version": "2.0"}).Value()
+		}).Should(Equal(1.0))
+	})
+
 	It("does not emit debug metrics by defualt", func() {
 		spyLookup := newSpyLookup()
 
@@ -182,4 +225,54 @@ var _ = Describe("v2 App", func() {
 		}).Should(BeNil())
 		Expect(resp.StatusCode).To(Equal(200))
 	})
+
+	It("serves the flush endpoint on localhost", func() {
+		clientCreds, err := plumbing.NewClientCredentials(
+			testCerts.Cert("metron"),
+			testCerts.Key("metron"),
+			testCerts.CA(),
+			"doppler",
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		serverCreds, err := plumbing.NewServerCredentials(
+			testCerts.Cert("router"),
+			testCerts.Key("router"),
+			testCerts.CA(),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		config := buildAgentConfig("127.0.0.1", 1234)
+		config.Flush = app.Flush{
+			Port:    testhelper.GetFreePort(),
+			Token:   "some-token",
+			Timeout: time.Second,
+		}
+
+		app := app.NewV2App(
+			&config,
+			clientCreds,
+			serverCreds,
+			metricsHelpers.NewMetricsRegistry(),
+			app.WithV2Lookup(newSpyLookup().lookup),
+		)
+		go app.Start()
+		defer app.Stop()
+
+		flushURL := fmt.Sprintf("http://127.0.0.1:%d/flush", config.Flush.Port)
+		post := func(token string) (int, error) {
+			req, err := http.NewRequest(http.MethodPost, flushURL, nil)
+			Expect(err).ToNot(HaveOccurred())
+			req.Header.Set("Authorization", "Bearer "+token)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return 0, err
+			}
+			resp.Body.Close()
+			return resp.StatusCode, nil
+		}
+
+		Eventually(func() (int, error) { return post("some-token") }).Should(Equal(http.StatusOK))
+		Expect(post("other-token")).To(Equal(http.StatusUnauthorized))
+	})
 })
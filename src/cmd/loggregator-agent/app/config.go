@@ -3,8 +3,11 @@ package app
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/config"
+	egress_v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
+	ingress_v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/ingress/v2"
 
 	"code.cloudfoundry.org/go-envstruct"
 	"golang.org/x/net/idna"
@@ -18,6 +21,19 @@ type GRPC struct {
 	CertFile     string   `env:"AGENT_CERT_FILE"`
 	KeyFile      string   `env:"AGENT_KEY_FILE"`
 	CipherSuites []string `env:"AGENT_CIPHER_SUITES"`
+	// HealthAndReflection registers the gRPC health checking and reflection
+	// services on the ingress server.
+	HealthAndReflection bool `env:"AGENT_GRPC_HEALTH_AND_REFLECTION"`
+}
+
+// Flush stores the configuration of the localhost endpoint that flushes
+// the buffered v2 envelopes, e.g. from a BOSH drain script.
+type Flush struct {
+	// Port of the endpoint. Zero disables it.
+	Port uint16 `env:"FLUSH_PORT"`
+	// Token that requests must send as a bearer token.
+	Token   string        `env:"FLUSH_TOKEN"`
+	Timeout time.Duration `env:"FLUSH_TIMEOUT"`
 }
 
 // Config stores all configurations options for the Agent.
@@ -29,6 +45,8 @@ type Config struct {
 	Index                           string            `env:"AGENT_INDEX"`
 	IP                              string            `env:"AGENT_IP"`
 	Tags                            map[string]string `env:"AGENT_TAGS"`
+	AgentVersionTag                 bool              `env:"AGENT_VERSION_TAG"`
+	MaxTagBytes                     int               `env:"AGENT_MAX_TAG_BYTES"`
 	DisableUDP                      bool              `env:"AGENT_DISABLE_UDP"`
 	LogsDisabled                    bool              `env:"LOGS_DISABLED"`
 	IncomingUDPPort                 int               `env:"AGENT_INCOMING_UDP_PORT"`
@@ -36,8 +54,46 @@ type Config struct {
 	MetricSourceID                  string            `env:"AGENT_METRIC_SOURCE_ID"`
 	RouterAddr                      string            `env:"ROUTER_ADDR"`
 	RouterAddrWithAZ                string            `env:"ROUTER_ADDR_WITH_AZ"`
+	ShardBySourceID                 bool              `env:"AGENT_SHARD_BY_SOURCE_ID"`
+	OrderBySourceID                 bool              `env:"AGENT_ORDER_BY_SOURCE_ID"`
 	GRPC                            GRPC
 	MetricsServer                   config.MetricsServer
+	Flush                           Flush
+
+	// EventLogSource additionally writes the logs to the Windows Event Log
+	// under the event source. It is only supported on Windows.
+	EventLogSource string `env:"EVENT_LOG_SOURCE, report"`
+	// LogThrottleInterval coalesces repeated identical log lines into a
+	// summary per interval. Zero disables throttling.
+	LogThrottleInterval time.Duration `env:"LOG_THROTTLE_INTERVAL, report"`
+	// IDRewriteRules rewrite the source IDs and instance IDs of v2
+	// envelopes before they are egressed.
+	IDRewriteRules egress_v2.IDRewriter `env:"AGENT_ID_REWRITE_RULES"`
+	// CounterCardinalityLimit is the number of distinct tag sets of a
+	// counter name of a source ID. Further tag sets are aggregated into a
+	// single series. Zero disables the limit.
+	CounterCardinalityLimit int `env:"COUNTER_CARDINALITY_LIMIT, report"`
+	// AdminPort is the port on localhost of the admin service used by
+	// agentctl. Zero disables it.
+	AdminPort uint16 `env:"ADMIN_PORT, report"`
+	// Autotune sizes GOMAXPROCS, the ingress diode and the batches of v2
+	// envelopes by the CPUs available to the agent, e.g. its cgroup CPU
+	// quota, instead of fixed defaults.
+	Autotune bool `env:"AUTOTUNE, report"`
+	// MaxBatchBytes writes a batch of v2 envelopes before it exceeds the
+	// size in bytes, e.g. to stay under the message size limit of Doppler.
+	// Zero only limits the number of envelopes in a batch.
+	MaxBatchBytes int `env:"MAX_BATCH_BYTES, report"`
+	// EnvelopeSizeMetrics reports the sizes of ingressed envelopes by
+	// envelope type and of the payloads of their logs in histograms.
+	EnvelopeSizeMetrics bool `env:"ENVELOPE_SIZE_METRICS, report"`
+
+	// FutureTimestampTolerance is how far in the future ingressed envelopes
+	// may be timestamped before FutureTimestampAction is applied to them.
+	// Zero disables the check.
+	FutureTimestampTolerance time.Duration `env:"FUTURE_TIMESTAMP_TOLERANCE, report"`
+	// FutureTimestampAction is pass, clamp, the default, or reject.
+	FutureTimestampAction ingress_v2.FutureTimestampAction `env:"FUTURE_TIMESTAMP_ACTION, report"`
 }
 
 // LoadConfig reads from the environment to create a Config.
@@ -52,6 +108,11 @@ func LoadConfig() (*Config, error) {
 		GRPC: GRPC{
 			Port: 3458,
 		},
+		Flush: Flush{
+			Timeout: 10 * time.Second,
+		},
+		Autotune:              true,
+		FutureTimestampAction: ingress_v2.FutureTimestampClamp,
 	}
 	err := envstruct.Load(&cfg)
 	if err != nil {
@@ -62,6 +123,10 @@ func LoadConfig() (*Config, error) {
 		return nil, fmt.Errorf("RouterAddr is required")
 	}
 
+	if cfg.Flush.Port != 0 && cfg.Flush.Token == "" {
+		return nil, fmt.Errorf("FlushToken is required when FlushPort is set")
+	}
+
 	cfg.RouterAddrWithAZ, err = idna.ToASCII(cfg.RouterAddrWithAZ)
 	if err != nil {
 		return nil, err
@@ -2,6 +2,7 @@ package app_test
 
 import (
 	"os"
+	"time"
 
 	"code.cloudfoundry.org/loggregator-agent-release/src/cmd/loggregator-agent/app"
 
@@ -43,4 +44,21 @@ var _ = Describe("Config", func() {
 		Expect(err).ToNot(HaveOccurred())
 		Expect(c.MetricSourceID).To(Equal("metron"))
 	})
+
+	It("requires a flush token when the flush port is set", func() {
+		os.Setenv("ROUTER_ADDR", "router-addr")
+		os.Setenv("FLUSH_PORT", "8085")
+		defer os.Unsetenv("FLUSH_PORT")
+
+		_, err := app.LoadConfig()
+		Expect(err).To(MatchError(ContainSubstring("FlushToken is required")))
+
+		os.Setenv("FLUSH_TOKEN", "some-token")
+		defer os.Unsetenv("FLUSH_TOKEN")
+
+		c, err := app.LoadConfig()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c.Flush.Port).To(Equal(uint16(8085)))
+		Expect(c.Flush.Timeout).To(Equal(10 * time.Second))
+	})
 })
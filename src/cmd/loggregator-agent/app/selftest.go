@@ -0,0 +1,206 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metrics "code.cloudfoundry.org/go-metric-registry"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/ingress/v2"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/plumbing"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/selftest"
+)
+
+// selfTestEnvelopes is the number of synthetic envelopes sent through the
+// pipeline by the self-test.
+const selfTestEnvelopes = 10
+
+// SelfTest checks that the agent can load its certificates, resolve its
+// destinations and deliver envelopes through its own v2 pipeline. The
+// pipeline is run in-process on a free port with plaintext gRPC and writes
+// to a loopback Doppler, so the self-test can run next to a running agent.
+func (a *Agent) SelfTest(ctx context.Context) selftest.Report {
+	checks := []selftest.Check{
+		{Name: "certificates", Run: a.checkCertificates},
+	}
+	if a.config.RouterAddrWithAZ != "" {
+		// The agent falls back to RouterAddr if the AZ-specific address
+		// does not resolve.
+		checks = append(checks, selftest.Check{
+			Name:     "dns " + a.config.RouterAddrWithAZ,
+			Optional: true,
+			Run:      selftest.Resolve(a.lookup, a.config.RouterAddrWithAZ),
+		})
+	}
+	if a.config.RouterAddr != "" {
+		checks = append(checks, selftest.Check{
+			Name: "dns " + a.config.RouterAddr,
+			Run:  selftest.Resolve(a.lookup, a.config.RouterAddr),
+		})
+	}
+	checks = append(checks, selftest.Check{Name: "pipeline", Run: a.checkPipeline})
+
+	return selftest.Run(ctx, 10*time.Second, checks...)
+}
+
+func (a *Agent) checkCertificates(context.Context) error {
+	if _, err := a.clientCredentials(); err != nil {
+		return fmt.Errorf("client: %s", err)
+	}
+	if _, err := a.serverCredentials(); err != nil {
+		return fmt.Errorf("server: %s", err)
+	}
+	if a.config.MetricsServer.CertFile != "" {
+		_, err := plumbing.NewServerCredentials(
+			a.config.MetricsServer.CertFile,
+			a.config.MetricsServer.KeyFile,
+			a.config.MetricsServer.CAFile,
+		)
+		if err != nil {
+			return fmt.Errorf("metrics server: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// checkPipeline sends synthetic envelopes to the ingress server of an
+// in-process v2 app and waits for them to arrive at a loopback Doppler.
+func (a *Agent) checkPipeline(ctx context.Context) error {
+	id, err := selfTestID()
+	if err != nil {
+		return err
+	}
+	m := metrics.NewRegistry(log.New(io.Discard, "", 0))
+
+	sink := &selfTestSink{id: id}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	doppler := grpc.NewServer()
+	loggregator_v2.RegisterIngressServer(doppler, v2.NewReceiver(
+		sink,
+		m.NewCounter("selftest_doppler_ingress", "Total number of envelopes received by the loopback Doppler."),
+		m.NewCounter("selftest_doppler_origin_mappings", "Total number of envelopes where the origin tag is used as the source_id."),
+	))
+	go doppler.Serve(lis) //nolint:errcheck
+	defer doppler.Stop()
+
+	port, err := freePort()
+	if err != nil {
+		return err
+	}
+	c := *a.config
+	c.GRPC.Port = port
+	c.RouterAddr = lis.Addr().String()
+	c.RouterAddrWithAZ = ""
+	c.MetricsServer.DebugMetrics = false
+	c.MetricsServer.InfoPort = 0
+	c.Flush.Port = 0
+
+	app := NewV2App(&c, insecure.NewCredentials(), insecure.NewCredentials(), m)
+	go app.Start()
+	defer app.Stop()
+
+	conn, err := grpc.NewClient(
+		fmt.Sprintf("127.0.0.1:%d", port),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	sender, err := loggregator_v2.NewIngressClient(conn).BatchSender(ctx, grpc.WaitForReady(true))
+	if err != nil {
+		return fmt.Errorf("failed to connect to ingress server: %s", err)
+	}
+	if err := sender.Send(selfTestBatch(id)); err != nil {
+		return fmt.Errorf("failed to send synthetic envelopes: %s", err)
+	}
+
+	t := time.NewTicker(10 * time.Millisecond)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("received %d of %d synthetic envelopes", sink.received(), selfTestEnvelopes)
+		case <-t.C:
+			if sink.received() >= selfTestEnvelopes {
+				return nil
+			}
+		}
+	}
+}
+
+func selfTestBatch(id string) *loggregator_v2.EnvelopeBatch {
+	batch := &loggregator_v2.EnvelopeBatch{}
+	for i := 0; i < selfTestEnvelopes; i++ {
+		batch.Batch = append(batch.Batch, &loggregator_v2.Envelope{
+			Timestamp: time.Now().UnixNano(),
+			SourceId:  "loggregator-agent-selftest",
+			Tags:      map[string]string{"selftest_id": id},
+			Message: &loggregator_v2.Envelope_Gauge{
+				Gauge: &loggregator_v2.Gauge{
+					Metrics: map[string]*loggregator_v2.GaugeValue{
+						"selftest": {Value: float64(i)},
+					},
+				},
+			},
+		})
+	}
+
+	return batch
+}
+
+func selfTestID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func freePort() (uint16, error) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer lis.Close()
+
+	return uint16(lis.Addr().(*net.TCPAddr).Port), nil //nolint:gosec
+}
+
+// selfTestSink counts the synthetic envelopes of a self-test.
+type selfTestSink struct {
+	id string
+
+	mu sync.Mutex
+	n  int
+}
+
+func (s *selfTestSink) Set(e *loggregator_v2.Envelope) {
+	if e.GetTags()["selftest_id"] != s.id {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.n++
+}
+
+func (s *selfTestSink) received() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.n
+}
@@ -0,0 +1,65 @@
+package app_test
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"code.cloudfoundry.org/loggregator-agent-release/src/cmd/loggregator-agent/app"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SelfTest", func() {
+	var config app.Config
+
+	BeforeEach(func() {
+		config = buildAgentConfig("doppler.service.cf.internal", 8082)
+	})
+
+	lookup := func(host string) ([]net.IP, error) {
+		if host == "doppler.service.cf.internal" {
+			return []net.IP{net.IPv4(10, 0, 0, 1)}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+
+	It("checks certificates, DNS and the pipeline", func() {
+		a := app.NewAgent(&config, app.WithLookup(lookup))
+
+		r := a.SelfTest(context.Background())
+
+		Expect(r.Passed).To(BeTrue())
+		Expect(r.Checks).To(HaveExactElements(
+			And(HaveField("Name", "certificates"), HaveField("Passed", true)),
+			And(HaveField("Name", "dns "+config.RouterAddrWithAZ), HaveField("Passed", false), HaveField("Optional", true)),
+			And(HaveField("Name", "dns doppler.service.cf.internal:8082"), HaveField("Passed", true)),
+			And(HaveField("Name", "pipeline"), HaveField("Passed", true)),
+		))
+	})
+
+	It("fails if the certificates cannot be loaded", func() {
+		config.GRPC.CertFile = "/does/not/exist"
+		a := app.NewAgent(&config, app.WithLookup(lookup))
+
+		r := a.SelfTest(context.Background())
+
+		Expect(r.Passed).To(BeFalse())
+		Expect(r.Checks[0].Name).To(Equal("certificates"))
+		Expect(r.Checks[0].Error).To(ContainSubstring("client:"))
+	})
+
+	It("fails if the router address does not resolve", func() {
+		config.RouterAddr = "unknown:8082"
+		a := app.NewAgent(&config, app.WithLookup(lookup))
+
+		r := a.SelfTest(context.Background())
+
+		Expect(r.Passed).To(BeFalse())
+		Expect(r.Checks).To(ContainElement(And(
+			HaveField("Name", "dns unknown:8082"),
+			HaveField("Error", "no such host"),
+		)))
+	})
+})
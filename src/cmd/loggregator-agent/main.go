@@ -1,9 +1,13 @@
 package main
 
 import (
+	"context"
 	"io"
 	"log"
 	_ "net/http/pprof" //nolint:gosec
+	"os"
+	"os/signal"
+	"syscall"
 
 	"code.cloudfoundry.org/loggregator-agent-release/src/cmd/loggregator-agent/app"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/plumbing"
@@ -24,7 +28,42 @@ func main() {
 	if err != nil {
 		log.Fatalf("Unable to parse config: %s", err)
 	}
+	if config.EventLogSource != "" {
+		if err := plumbing.AddEventLogOutput(log.Default(), config.EventLogSource); err != nil {
+			log.Fatalf("failed to open event log: %s", err)
+		}
+	}
+	if config.LogThrottleInterval > 0 {
+		plumbing.ThrottleLogOutput(log.Default(), config.LogThrottleInterval)
+	}
 
 	a := app.NewAgent(config)
-	a.Start()
+	if len(os.Args) > 1 && os.Args[1] == "selftest" {
+		selfTest(a)
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		a.Stop()
+		os.Exit(0)
+	}()
+
+	if err := plumbing.RunService("loggregator-agent", a.Start, a.Stop); err != nil {
+		log.Fatalf("failed to run as a service: %s", err)
+	}
+}
+
+// selfTest writes the report of the agent's self-test to stdout and exits
+// with a non-zero status if it failed.
+func selfTest(a *app.Agent) {
+	report := a.SelfTest(context.Background())
+	if err := report.Write(os.Stdout); err != nil {
+		log.Fatalf("failed to write self-test report: %s", err)
+	}
+	if !report.Passed {
+		os.Exit(1)
+	}
+	os.Exit(0)
 }
@@ -11,6 +11,9 @@ import (
 
 type Config struct {
 	UseRFC3339 bool `env:"USE_RFC3339"`
+	// EventLogSource additionally writes the logs to the Windows Event Log
+	// under the event source. It is only supported on Windows.
+	EventLogSource string `env:"EVENT_LOG_SOURCE, report"`
 	// Loggregator Agent Certs
 	ClientKeyPath  string `env:"CLIENT_KEY_PATH, report, required"`
 	ClientCertPath string `env:"CLIENT_CERT_PATH, report, required"`
@@ -21,11 +24,15 @@ type Config struct {
 	ScrapeCertPath   string `env:"SCRAPE_CERT_PATH, report"`
 	ScrapeCACertPath string `env:"SCRAPE_CA_CERT_PATH, report"`
 
-	LoggregatorIngressAddr string        `env:"LOGGREGATOR_AGENT_ADDR, report, required"`
-	DefaultSourceID        string        `env:"DEFAULT_SOURCE_ID, report, required"`
-	ConfigGlobs            []string      `env:"CONFIG_GLOBS, report"`
-	DefaultScrapeInterval  time.Duration `env:"SCRAPE_INTERVAL, report"`
-	SkipSSLValidation      bool          `env:"SKIP_SSL_VALIDATION, report"`
+	LoggregatorIngressAddr     string        `env:"LOGGREGATOR_AGENT_ADDR, report, required"`
+	DefaultSourceID            string        `env:"DEFAULT_SOURCE_ID, report, required"`
+	ConfigGlobs                []string      `env:"CONFIG_GLOBS, report"`
+	DefaultScrapeInterval      time.Duration `env:"SCRAPE_INTERVAL, report"`
+	DefaultScrapeTimeout       time.Duration `env:"SCRAPE_TIMEOUT, report"`
+	MaxConcurrentScrapes       int           `env:"MAX_CONCURRENT_SCRAPES, report"`
+	MaxConcurrentScrapesPerJob int           `env:"MAX_CONCURRENT_SCRAPES_PER_JOB, report"`
+	SkipSSLValidation          bool          `env:"SKIP_SSL_VALIDATION, report"`
+	CounterDeltas              bool          `env:"COUNTER_DELTAS, report"`
 
 	MetricsServer config.MetricsServer
 }
@@ -4,7 +4,10 @@ import (
 	"crypto/tls"
 	"fmt"
 	"log"
+	"math/rand"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -15,6 +18,7 @@ import (
 	_ "net/http/pprof" //nolint:gosec
 
 	"code.cloudfoundry.org/go-loggregator/v10"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/config"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/scraper"
 )
 
@@ -27,21 +31,29 @@ type PromScraper struct {
 	wg                   sync.WaitGroup
 	m                    promRegistry
 	scrapeTargetTotals   metrics.Counter
+	limiter              *scraper.Limiter
 }
 
 type ConfigProvider func() ([]scraper.PromScraperConfig, error)
 
 type promRegistry interface {
 	NewCounter(name, helpText string, opts ...metrics.MetricOption) metrics.Counter
+	NewGauge(name, helpText string, opts ...metrics.MetricOption) metrics.Gauge
 	RegisterDebugMetrics()
 }
 
 func NewPromScraper(cfg Config, configProvider ConfigProvider, m promRegistry, log *log.Logger) *PromScraper {
+	config.EmitConfigInfo(m, config.Fingerprint(cfg), map[string]string{
+		"counter_deltas":         strconv.FormatBool(cfg.CounterDeltas),
+		"max_concurrent_scrapes": strconv.Itoa(cfg.MaxConcurrentScrapes),
+	})
+
 	return &PromScraper{
 		scrapeConfigProvider: configProvider,
 		cfg:                  cfg,
 		log:                  log,
 		stop:                 make(chan struct{}),
+		limiter:              scraper.NewLimiter(cfg.MaxConcurrentScrapes, cfg.MaxConcurrentScrapesPerJob),
 
 		m: m,
 		scrapeTargetTotals: m.NewCounter(
@@ -77,6 +89,9 @@ func (p *PromScraper) Run() {
 
 func (p *PromScraper) validateConfigs(scrapeConfigs []scraper.PromScraperConfig) {
 	for _, scrapeConfig := range scrapeConfigs {
+		if (scrapeConfig.ClientCertPath == "") != (scrapeConfig.ClientKeyPath == "") {
+			p.log.Panicf("client_cert_path and client_key_path must be provided together in scrape config (%s)", scrapeConfig.SourceID)
+		}
 		if p.isMTLSTargetMissingServerName(scrapeConfig) {
 			p.log.Panicf("server_name is missing from mTLS scrape config (%s)", scrapeConfig.SourceID)
 		}
@@ -84,7 +99,8 @@ func (p *PromScraper) validateConfigs(scrapeConfigs []scraper.PromScraperConfig)
 }
 
 func (p *PromScraper) isMTLSTargetMissingServerName(scraperConfig scraper.PromScraperConfig) bool {
-	return p.cfg.ScrapeCertPath != "" && scraperConfig.Scheme == "https" && scraperConfig.ServerName == ""
+	hasClientCert := p.cfg.ScrapeCertPath != "" || scraperConfig.ClientCertPath != ""
+	return hasClientCert && scraperConfig.Scheme == "https" && scraperConfig.ServerName == ""
 }
 
 func (p *PromScraper) buildIngressClient() *loggregator.IngressClient {
@@ -122,8 +138,11 @@ func (p *PromScraper) startScraper(scrapeConfig scraper.PromScraperConfig, ingre
 	defer p.wg.Done()
 
 	s := p.buildScraper(scrapeConfig, ingressClient)
-	ticker := time.NewTicker(scrapeConfig.ScrapeInterval)
-	defer ticker.Stop()
+
+	// Start scraping at a random offset into the interval so that targets
+	// with the same interval are not scraped at the same time.
+	timer := time.NewTimer(time.Duration(rand.Int63n(int64(scrapeConfig.ScrapeInterval)))) //nolint:gosec
+	defer timer.Stop()
 
 	failedScrapesTotal := p.m.NewCounter(
 		"failed_scrapes_total",
@@ -134,8 +153,17 @@ func (p *PromScraper) startScraper(scrapeConfig scraper.PromScraperConfig, ingre
 	hadError := false
 	for {
 		select {
-		case <-ticker.C:
-			if err := s.Scrape(); err != nil {
+		case <-timer.C:
+			timer.Reset(scrapeConfig.ScrapeInterval)
+
+			release, ok := p.limiter.Acquire(scrapeConfig.SourceID, p.stop)
+			if !ok {
+				return
+			}
+			err := s.Scrape()
+			release()
+
+			if err != nil {
 				hadError = true
 				failedScrapesTotal.Add(1)
 				p.log.Printf("failed to scrape: %s", err)
@@ -160,13 +188,19 @@ func (p *PromScraper) buildScraper(scrapeConfig scraper.PromScraperConfig, clien
 
 	httpClient := p.buildHttpClient(scrapeConfig)
 
+	var opts []scraper.ScrapeOption
+	if p.cfg.CounterDeltas {
+		opts = append(opts, scraper.WithCounterDeltas())
+	}
+
 	return scraper.New(
 		func() []scraper.Target {
 			return []scraper.Target{scrapeTarget}
 		},
 		client,
-		p.scrape(httpClient),
+		p.scrape(httpClient, scrapeConfig.BearerTokenFile),
 		p.cfg.DefaultSourceID,
+		opts...,
 	)
 }
 
@@ -184,9 +218,22 @@ func (p *PromScraper) buildHttpClient(scrapeConfig scraper.PromScraperConfig) *h
 			MaxIdleConns:    1,
 			IdleConnTimeout: scrapeConfig.ScrapeInterval,
 		},
+		Timeout: p.scrapeTimeout(scrapeConfig),
 	}
 }
 
+// scrapeTimeout returns the timeout of the target, falling back to the
+// default timeout and then to the scrape interval.
+func (p *PromScraper) scrapeTimeout(scrapeConfig scraper.PromScraperConfig) time.Duration {
+	if scrapeConfig.ScrapeTimeout > 0 {
+		return scrapeConfig.ScrapeTimeout
+	}
+	if p.cfg.DefaultScrapeTimeout > 0 {
+		return p.cfg.DefaultScrapeTimeout
+	}
+	return scrapeConfig.ScrapeInterval
+}
+
 func (p *PromScraper) clientOptions(scrapeConfig scraper.PromScraperConfig) []tlsconfig.ClientOption {
 	clientOptions := []tlsconfig.ClientOption{withSkipSSLValidation(p.cfg.SkipSSLValidation)}
 
@@ -227,7 +274,10 @@ func (p *PromScraper) Stop() {
 	}
 }
 
-func (p *PromScraper) scrape(client *http.Client) scraper.MetricsGetter {
+// scrape returns a MetricsGetter using the given client. If a bearer token
+// file is given, it is read on every scrape so that rotated tokens are
+// picked up without a restart.
+func (p *PromScraper) scrape(client *http.Client, bearerTokenFile string) scraper.MetricsGetter {
 	return func(addr string, headers map[string]string) (*http.Response, error) {
 		req, err := http.NewRequest(http.MethodGet, addr, nil)
 		if err != nil {
@@ -240,6 +290,14 @@ func (p *PromScraper) scrape(client *http.Client) scraper.MetricsGetter {
 		}
 		req.Header = requestHeader
 
+		if bearerTokenFile != "" {
+			token, err := os.ReadFile(bearerTokenFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read bearer token file: %w", err)
+			}
+			req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+		}
+
 		return client.Do(req)
 	}
 }
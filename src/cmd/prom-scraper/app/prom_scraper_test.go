@@ -2,13 +2,17 @@ package app_test
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"code.cloudfoundry.org/loggregator-agent-release/src/cmd/prom-scraper/app"
@@ -228,6 +232,114 @@ var _ = Describe("PromScraper", func() {
 			)))
 		})
 
+		It("scrapes with a bearer token if a token file is provided", func() {
+			tokenFile := filepath.Join(metricConfigDir, "token")
+			Expect(os.WriteFile(tokenFile, []byte("some-token\n"), 0600)).To(Succeed())
+
+			spyConfigProvider.scrapeConfigs = []scraper.PromScraperConfig{{
+				Port:            promServer.port,
+				SourceID:        "some-id",
+				InstanceID:      "some-instance-id",
+				BearerTokenFile: tokenFile,
+			}}
+			promServer.resp = promOutput
+
+			ps = app.NewPromScraper(cfg, spyConfigProvider.Configs, metricClient, testLogger)
+			go ps.Run()
+
+			Eventually(promServer.requestHeaders).Should(Receive(
+				HaveKeyWithValue("Authorization", []string{"Bearer some-token"}),
+			))
+		})
+
+		It("does not scrape if the bearer token file cannot be read", func() {
+			spyConfigProvider.scrapeConfigs = []scraper.PromScraperConfig{{
+				Port:            promServer.port,
+				SourceID:        "some-id",
+				InstanceID:      "some-instance-id",
+				BearerTokenFile: filepath.Join(metricConfigDir, "missing"),
+			}}
+			promServer.resp = promOutput
+
+			ps = app.NewPromScraper(cfg, spyConfigProvider.Configs, metricClient, testLogger)
+			go ps.Run()
+
+			Consistently(promServer.requestHeaders, 1).ShouldNot(Receive())
+		})
+
+		It("cancels scrapes that exceed the scrape timeout", func() {
+			lis, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).ToNot(HaveOccurred())
+			defer lis.Close()
+
+			// Accept connections without responding and report how long
+			// the scraper waited before closing the connection.
+			waited := make(chan time.Duration, 100)
+			go func() {
+				for {
+					conn, err := lis.Accept()
+					if err != nil {
+						return
+					}
+					go func() {
+						defer conn.Close()
+						start := time.Now()
+						_, _ = io.Copy(io.Discard, conn)
+						waited <- time.Since(start)
+					}()
+				}
+			}()
+
+			spyConfigProvider.scrapeConfigs = []scraper.PromScraperConfig{{
+				Port:           strconv.Itoa(lis.Addr().(*net.TCPAddr).Port),
+				SourceID:       "some-id",
+				InstanceID:     "some-instance-id",
+				ScrapeInterval: time.Second,
+				ScrapeTimeout:  50 * time.Millisecond,
+			}}
+
+			ps = app.NewPromScraper(cfg, spyConfigProvider.Configs, metricClient, testLogger)
+			go ps.Run()
+
+			var d time.Duration
+			Eventually(waited, 3).Should(Receive(&d))
+			Expect(d).To(BeNumerically("<", 500*time.Millisecond))
+			Eventually(func() float64 {
+				return metricClient.GetMetric("failed_scrapes_total", map[string]string{"scrape_target_source_id": "some-id"}).Value()
+			}).Should(BeNumerically(">=", 1))
+		})
+
+		It("limits concurrent scrapes per job", func() {
+			var inFlight, maxInFlight, requests int64
+			slowServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := atomic.AddInt64(&inFlight, 1)
+				defer atomic.AddInt64(&inFlight, -1)
+				atomic.AddInt64(&requests, 1)
+				for {
+					m := atomic.LoadInt64(&maxInFlight)
+					if n <= m || atomic.CompareAndSwapInt64(&maxInFlight, m, n) {
+						break
+					}
+				}
+				time.Sleep(50 * time.Millisecond)
+				_, _ = w.Write([]byte(promOutput))
+			}))
+			defer slowServer.Close()
+			port := slowServer.URL[strings.LastIndex(slowServer.URL, ":")+1:]
+
+			spyConfigProvider.scrapeConfigs = []scraper.PromScraperConfig{
+				{Port: port, SourceID: "some-id", InstanceID: "instance-1", ScrapeInterval: 10 * time.Millisecond, ScrapeTimeout: time.Second},
+				{Port: port, SourceID: "some-id", InstanceID: "instance-2", ScrapeInterval: 10 * time.Millisecond, ScrapeTimeout: time.Second},
+			}
+			cfg.MaxConcurrentScrapesPerJob = 1
+
+			ps = app.NewPromScraper(cfg, spyConfigProvider.Configs, metricClient, testLogger)
+			go ps.Run()
+
+			Eventually(func() int64 { return atomic.LoadInt64(&requests) }).Should(BeNumerically(">=", 4))
+			Expect(atomic.LoadInt64(&maxInFlight)).To(Equal(int64(1)))
+		})
+
 		It("adds default tags if provided", func() {
 			spyConfigProvider.scrapeConfigs = []scraper.PromScraperConfig{{
 				Port:       promServer.port,
@@ -392,6 +504,59 @@ var _ = Describe("PromScraper", func() {
 				ContainElement(buildGauge("test_gauge_prometheus_1", "some-id", "some-instance-id", 2)),
 			))
 		})
+		It("scrapes over mTLS with target certs only", func() {
+			cfg.ScrapeCertPath = ""
+			cfg.ScrapeKeyPath = ""
+			spyConfigProvider.scrapeConfigs = []scraper.PromScraperConfig{{
+				Port:           promServer.port,
+				SourceID:       "some-id",
+				InstanceID:     "some-instance-id",
+				Scheme:         "https",
+				ServerName:     "server",
+				CaPath:         customCerts.CA(),
+				ClientKeyPath:  customCerts.Key("client"),
+				ClientCertPath: customCerts.Cert("client"),
+			}}
+
+			ps = app.NewPromScraper(cfg, spyConfigProvider.Configs, metricClient, testLogger)
+			go ps.Run()
+
+			Eventually(spyAgent.Envelopes).Should(
+				ContainElement(buildCounter("test_counter_prometheus_1", "some-id", "some-instance-id", 1)),
+			)
+		})
+
+		It("does not scrape if target certs are provided but server name is empty", func() {
+			cfg.ScrapeCertPath = ""
+			cfg.ScrapeKeyPath = ""
+			spyConfigProvider.scrapeConfigs = []scraper.PromScraperConfig{{
+				Port:           promServer.port,
+				SourceID:       "some-id",
+				InstanceID:     "some-instance-id",
+				Scheme:         "https",
+				CaPath:         customCerts.CA(),
+				ClientKeyPath:  customCerts.Key("client"),
+				ClientCertPath: customCerts.Cert("client"),
+			}}
+
+			ps = app.NewPromScraper(cfg, spyConfigProvider.Configs, metricClient, testLogger)
+			Expect(ps.Run).To(Panic())
+		})
+
+		It("does not scrape if a target cert is provided without a key", func() {
+			spyConfigProvider.scrapeConfigs = []scraper.PromScraperConfig{{
+				Port:           promServer.port,
+				SourceID:       "some-id",
+				InstanceID:     "some-instance-id",
+				Scheme:         "https",
+				ServerName:     "server",
+				CaPath:         customCerts.CA(),
+				ClientCertPath: customCerts.Cert("client"),
+			}}
+
+			ps = app.NewPromScraper(cfg, spyConfigProvider.Configs, metricClient, testLogger)
+			Expect(ps.Run).To(Panic())
+		})
 	})
 
 	Context("metrics", func() {
@@ -21,6 +21,11 @@ func main() {
 		logger.SetOutput(new(plumbing.LogWriter))
 		logger.SetFlags(0)
 	}
+	if cfg.EventLogSource != "" {
+		if err := plumbing.AddEventLogOutput(logger, cfg.EventLogSource); err != nil {
+			logger.Fatalf("failed to open event log: %s", err)
+		}
+	}
 
 	m := metrics.NewRegistry(
 		logger,
@@ -33,5 +38,8 @@ func main() {
 	)
 
 	configProvider := scraper.NewConfigProvider(cfg.ConfigGlobs, cfg.DefaultScrapeInterval, logger).Configs
-	app.NewPromScraper(cfg, configProvider, m, logger).Run()
+	p := app.NewPromScraper(cfg, configProvider, m, logger)
+	if err := plumbing.RunService("prom-scraper", p.Run, p.Stop); err != nil {
+		logger.Fatalf("failed to run as a service: %s", err)
+	}
 }
@@ -6,7 +6,9 @@ import (
 	"time"
 
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/config"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/ingress/bindings"
+	ingress_v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/ingress/v2"
 
 	"code.cloudfoundry.org/go-envstruct"
 )
@@ -19,6 +21,9 @@ type GRPC struct {
 	CertFile     string   `env:"AGENT_CERT_FILE_PATH, required, report"`
 	KeyFile      string   `env:"AGENT_KEY_FILE_PATH,  required, report"`
 	CipherSuites []string `env:"AGENT_CIPHER_SUITES,            report"`
+	// HealthAndReflection registers the gRPC health checking and reflection
+	// services on the ingress server.
+	HealthAndReflection bool `env:"AGENT_GRPC_HEALTH_AND_REFLECTION, report"`
 }
 
 type Cache struct {
@@ -29,18 +34,123 @@ type Cache struct {
 	CommonName      string                   `env:"CACHE_COMMON_NAME,         report"`
 	PollingInterval time.Duration            `env:"CACHE_POLLING_INTERVAL,    report"`
 	Blacklist       bindings.BlacklistRanges `env:"BLACKLISTED_SYSLOG_RANGES, report"`
+
+	// CircuitBreakerFailures is the number of consecutive failed requests
+	// after which requests to the cache are suspended for
+	// CircuitBreakerCooldown. Zero disables circuit breaking.
+	CircuitBreakerFailures int           `env:"CACHE_CIRCUIT_BREAKER_FAILURES, report"`
+	CircuitBreakerCooldown time.Duration `env:"CACHE_CIRCUIT_BREAKER_COOLDOWN, report"`
+	// StaleDuration is how long the last-known bindings are kept while the
+	// cache is unavailable. Zero keeps them indefinitely.
+	StaleDuration time.Duration `env:"CACHE_STALE_DURATION, report"`
+	// FailoverURLs are additional binding caches that are used in order
+	// when the cache at URL is unavailable.
+	FailoverURLs []string `env:"CACHE_FAILOVER_URLS, report"`
+	// BlacklistFile is a file with additional blacklist ranges that is
+	// re-read every BlacklistReloadInterval when it changes.
+	BlacklistFile           string        `env:"BLACKLISTED_SYSLOG_RANGES_FILE, report"`
+	BlacklistReloadInterval time.Duration `env:"BLACKLISTED_SYSLOG_RANGES_RELOAD_INTERVAL, report"`
+}
+
+// AggregateDrainsDocument stores the configuration of a JSON document with
+// the aggregate drains, read from a file or an HTTPS URL with mTLS.
+type AggregateDrainsDocument struct {
+	// Location is the path of the file or the HTTPS URL of the document.
+	// Empty disables it.
+	Location        string        `env:"AGGREGATE_DRAINS_DOCUMENT,                  report"`
+	CAFile          string        `env:"AGGREGATE_DRAINS_DOCUMENT_CA_FILE_PATH,     report"`
+	CertFile        string        `env:"AGGREGATE_DRAINS_DOCUMENT_CERT_FILE_PATH,   report"`
+	KeyFile         string        `env:"AGGREGATE_DRAINS_DOCUMENT_KEY_FILE_PATH,    report"`
+	CommonName      string        `env:"AGGREGATE_DRAINS_DOCUMENT_COMMON_NAME,      report"`
+	PollingInterval time.Duration `env:"AGGREGATE_DRAINS_DOCUMENT_POLLING_INTERVAL, report"`
 }
 
 // Config holds the configuration for the syslog agent
 type Config struct {
 	UseRFC3339           bool          `env:"USE_RFC3339"`
 	BindingsPerAppLimit  int           `env:"BINDING_PER_APP_LIMIT,  report"`
+	MaxBindings          int           `env:"MAX_BINDINGS,           report"`
 	DrainSkipCertVerify  bool          `env:"DRAIN_SKIP_CERT_VERIFY, report"`
 	DrainCipherSuites    string        `env:"DRAIN_CIPHER_SUITES,    report"`
 	DrainTrustedCAFile   string        `env:"DRAIN_TRUSTED_CA_FILE,  report"`
+	DrainTrustedCAFiles  []string      `env:"DRAIN_TRUSTED_CA_FILES, report"`
 	DefaultDrainMetadata bool          `env:"DEFAULT_DRAIN_METADATA, report"`
 	IdleDrainTimeout     time.Duration `env:"IDLE_DRAIN_TIMEOUT, report"`
-	WarnOnInvalidDrains  bool          `env:"WARN_ON_INVALID_DRAINS,    report"`
+
+	// InvalidDrainPolicies are what is done with bindings whose drain has
+	// an unsupported scheme, is blacklisted or fails to resolve.
+	InvalidDrainPolicies bindings.FilterPolicies
+	// WarnOnInvalidDrains is deprecated. When false invalid drains are not
+	// logged, the policies still apply.
+	WarnOnInvalidDrains bool `env:"WARN_ON_INVALID_DRAINS, report"`
+
+	// DrainProbe enables probing the drains of new bindings before
+	// creating writers for them.
+	DrainProbe              bool          `env:"DRAIN_PROBE, report"`
+	DrainProbeRetryInterval time.Duration `env:"DRAIN_PROBE_RETRY_INTERVAL, report"`
+	// WriterWatchdogDeadline is how long a write to an app drain may be in
+	// progress before its writer is restarted. Zero disables the watchdog.
+	WriterWatchdogDeadline time.Duration `env:"WRITER_WATCHDOG_DEADLINE, report"`
+	// BindingGracePeriod is how long app bindings missing from the binding
+	// cache keep being served before their writers are collected. Writers
+	// of removed bindings get WriterFlushTimeout to write the envelopes
+	// they buffered.
+	BindingGracePeriod time.Duration `env:"BINDING_GRACE_PERIOD, report"`
+	WriterFlushTimeout time.Duration `env:"WRITER_FLUSH_TIMEOUT, report"`
+	// DrainMaxInFlightRequests caps the concurrent batch requests of every
+	// https-batch drain and MaxInFlightHTTPSRequests those of all
+	// https-batch drains together. Zero disables the global cap.
+	DrainMaxInFlightRequests int `env:"DRAIN_MAX_IN_FLIGHT_REQUESTS, report"`
+	MaxInFlightHTTPSRequests int `env:"MAX_IN_FLIGHT_HTTPS_REQUESTS, report"`
+	// DrainLatencyBudget is the write latency above which a drain is
+	// considered slow. Slow drains shed their envelopes according to
+	// DrainSheddingMode. Zero disables shedding.
+	DrainLatencyBudget      time.Duration       `env:"DRAIN_LATENCY_BUDGET, report"`
+	DrainSheddingMode       syslog.SheddingMode `env:"DRAIN_SHEDDING_MODE, report"`
+	DrainSheddingSampleRate int                 `env:"DRAIN_SHEDDING_SAMPLE_RATE, report"`
+	// DrainDeliveryMetrics reports the time of the last successful
+	// delivery to the drain of every app binding in a gauge. The times are
+	// always served on /debug/deliveries.
+	DrainDeliveryMetrics bool `env:"DRAIN_DELIVERY_METRICS, report"`
+	// DryRun fetches bindings and probes their drains on every polling
+	// interval without sending any data to them.
+	DryRun bool `env:"DRY_RUN, report"`
+	// LoopDetection marks the log messages sent to drains and counts
+	// marked envelopes that come back to the agent.
+	LoopDetection     bool `env:"LOOP_DETECTION, report"`
+	LoopDetectionDrop bool `env:"LOOP_DETECTION_DROP, report"`
+	// DrainStatusNotices emits logs to apps when their drains fail or
+	// recover, at most once per DrainStatusNoticeInterval per drain.
+	DrainStatusNotices        bool          `env:"DRAIN_STATUS_NOTICES, report"`
+	DrainStatusNoticeInterval time.Duration `env:"DRAIN_STATUS_NOTICE_INTERVAL, report"`
+	// ErrorEventsSize is the number of recent pipeline errors served on
+	// /debug/errors when debug metrics are enabled. Zero disables it.
+	ErrorEventsSize int `env:"ERROR_EVENTS_SIZE, report"`
+	// EventLogSource additionally writes the logs to the Windows Event Log
+	// under the event source. It is only supported on Windows.
+	EventLogSource string `env:"EVENT_LOG_SOURCE, report"`
+	// LogThrottleInterval coalesces repeated identical log lines into a
+	// summary per interval. Zero disables throttling.
+	LogThrottleInterval time.Duration `env:"LOG_THROTTLE_INTERVAL, report"`
+	// AdminPort is the port on localhost of the admin service used by
+	// agentctl. Zero disables it.
+	AdminPort uint16 `env:"ADMIN_PORT, report"`
+	// Autotune sizes GOMAXPROCS and the ingress diode by the CPUs available
+	// to the agent, e.g. its cgroup CPU quota, instead of fixed defaults.
+	Autotune bool `env:"AUTOTUNE, report"`
+	// EnvelopeSizeMetrics reports the sizes of ingressed envelopes by
+	// envelope type and of the payloads of their logs in histograms.
+	EnvelopeSizeMetrics bool `env:"ENVELOPE_SIZE_METRICS, report"`
+
+	// FutureTimestampTolerance is how far in the future ingressed envelopes
+	// may be timestamped before FutureTimestampAction is applied to them.
+	// Zero disables the check.
+	FutureTimestampTolerance time.Duration `env:"FUTURE_TIMESTAMP_TOLERANCE, report"`
+	// FutureTimestampAction is pass, clamp, the default, or reject.
+	FutureTimestampAction ingress_v2.FutureTimestampAction `env:"FUTURE_TIMESTAMP_ACTION, report"`
+
+	DrainMessageTemplates    syslog.MessageTemplates    `env:"DRAIN_MESSAGE_TEMPLATES, report"`
+	DefaultDrainSanitization syslog.PayloadSanitization `env:"DEFAULT_DRAIN_SANITIZATION, report"`
 
 	GRPC          GRPC
 	Cache         Cache
@@ -48,6 +158,7 @@ type Config struct {
 
 	AggregateConnectionRefreshInterval time.Duration `env:"AGGREGATE_CONNECTION_REFRESH_INTERVAL, report"`
 	AggregateDrainURLs                 []string      `env:"AGGREGATE_DRAIN_URLS,                  report"`
+	AggregateDrainsDocument            AggregateDrainsDocument
 }
 
 // LoadConfig will load the configuration for the syslog agent from the
@@ -58,14 +169,34 @@ func LoadConfig() Config {
 		BindingsPerAppLimit: 5,
 		IdleDrainTimeout:    10 * time.Minute,
 
+		DrainProbeRetryInterval:   5 * time.Minute,
+		WriterWatchdogDeadline:    30 * time.Minute,
+		WriterFlushTimeout:        5 * time.Second,
+		DrainMaxInFlightRequests:  1,
+		MaxInFlightHTTPSRequests:  1000,
+		DrainStatusNoticeInterval: 5 * time.Minute,
+		ErrorEventsSize:           1000,
+		DrainSheddingMode:         syslog.SheddingDrop,
+		DrainSheddingSampleRate:   10,
+		InvalidDrainPolicies:      bindings.DefaultFilterPolicies(),
+		WarnOnInvalidDrains:       true,
+
 		Cache: Cache{
-			PollingInterval: 1 * time.Minute,
+			PollingInterval:         1 * time.Minute,
+			CircuitBreakerFailures:  3,
+			CircuitBreakerCooldown:  30 * time.Second,
+			BlacklistReloadInterval: 30 * time.Second,
 		},
 		GRPC: GRPC{
 			Port: 3458,
 		},
 		AggregateConnectionRefreshInterval: 1 * time.Minute,
 		DefaultDrainMetadata:               true,
+		Autotune:                           true,
+		FutureTimestampAction:              ingress_v2.FutureTimestampClamp,
+		AggregateDrainsDocument: AggregateDrainsDocument{
+			PollingInterval: 1 * time.Minute,
+		},
 	}
 	if err := envstruct.Load(&cfg); err != nil {
 		panic(fmt.Sprintf("Failed to load config from environment: %s", err))
@@ -1,6 +1,7 @@
 package app
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
@@ -8,18 +9,25 @@ import (
 	"net/http"
 	_ "net/http/pprof" //nolint:gosec
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	gendiodes "code.cloudfoundry.org/go-diodes"
 	"code.cloudfoundry.org/go-loggregator/v10"
 	metrics "code.cloudfoundry.org/go-metric-registry"
-	"code.cloudfoundry.org/tlsconfig"
 
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/admin"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/autotune"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/binding"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/binding/client"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/buildinfo"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/cache"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/config"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/diodes"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
+	egress_v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/ingress/bindings"
 	v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/ingress/v2"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/plumbing"
@@ -32,17 +40,33 @@ type SyslogAgent struct {
 	metrics             Metrics
 	pprofPort           uint16
 	pprofServer         *http.Server
+	infoPort            uint16
+	infoServer          *http.Server
 	debugMetrics        bool
 	bindingManager      BindingManager
+	debugHandler        http.Handler
+	introspector        *egress_v2.Introspector
 	grpc                GRPC
 	v2Srv               *v2.Server
 	log                 *log.Logger
 	bindingsPerAppLimit int
+	loopDetector        *syslog.LoopDetector
+	diodeSize           int
+	adminPort           uint16
+	adminSrv            *admin.Server
+	drainPauses         *syslog.DrainPauses
+	envelopeSizes       bool
+	futureTolerance     time.Duration
+	futureAction        v2.FutureTimestampAction
+	ctx                 context.Context
+	cancel              context.CancelFunc
 }
 
 type Metrics interface {
 	NewGauge(name, helpText string, options ...metrics.MetricOption) metrics.Gauge
 	NewCounter(name, helpText string, options ...metrics.MetricOption) metrics.Counter
+	NewHistogram(name, helpText string, buckets []float64, options ...metrics.MetricOption) metrics.Histogram
+	RemoveGauge(g metrics.Gauge)
 	RegisterDebugMetrics()
 }
 
@@ -57,16 +81,59 @@ func NewSyslogAgent(
 	m Metrics,
 	l *log.Logger,
 ) *SyslogAgent {
+	if !cfg.DefaultDrainSanitization.Valid() {
+		l.Panicf("invalid default drain sanitization: %q", cfg.DefaultDrainSanitization)
+	}
+
+	config.EmitConfigInfo(m, config.Fingerprint(cfg), map[string]string{
+		"max_bindings":               strconv.Itoa(cfg.MaxBindings),
+		"drain_probe":                strconv.FormatBool(cfg.DrainProbe),
+		"dry_run":                    strconv.FormatBool(cfg.DryRun),
+		"loop_detection":             strconv.FormatBool(cfg.LoopDetection),
+		"default_drain_sanitization": string(cfg.DefaultDrainSanitization),
+	})
+
+	diodeSize := 10000
+	if cfg.Autotune {
+		tuning := autotune.Detect()
+		tuning.SetGOMAXPROCS()
+		l.Printf("Autotuned for %s", tuning)
+		diodeSize = tuning.DiodeSize
+	}
+
+	errorEvents := egress.NewErrorEvents(cfg.ErrorEventsSize)
+	debugHandler := http.NewServeMux()
+	debugHandler.Handle("/debug/errors", errorEvents)
+
+	var deliveryMetrics syslog.DeliveryMetricClient
+	if cfg.DrainDeliveryMetrics {
+		deliveryMetrics = m
+	}
+	deliveries := syslog.NewDeliveries(deliveryMetrics)
+	debugHandler.Handle("/debug/deliveries", deliveries)
+	introspector := egress_v2.NewIntrospector()
+	debugHandler.Handle("/debug/pipeline", introspector)
+	debugHandler.Handle("/", http.DefaultServeMux)
+
+	factoryOpts := []syslog.WriterFactoryOption{
+		syslog.WithMessageTemplates(cfg.DrainMessageTemplates),
+		syslog.WithErrorEvents(errorEvents),
+		syslog.WithDeliveries(deliveries),
+		syslog.WithMaxInFlightRequests(cfg.DrainMaxInFlightRequests, cfg.MaxInFlightHTTPSRequests),
+	}
+	var loopDetector *syslog.LoopDetector
+	if cfg.LoopDetection {
+		factoryOpts = append(factoryOpts, syslog.WithLoopMarkers())
+		loopDetector = syslog.NewLoopDetector(m, cfg.LoopDetectionDrop)
+	}
+
 	internalTlsConfig, externalTlsConfig := drainTLSConfig(cfg)
 	writerFactory := syslog.NewWriterFactory(
 		internalTlsConfig,
 		externalTlsConfig,
-		syslog.NetworkTimeoutConfig{
-			Keepalive:    10 * time.Second,
-			DialTimeout:  10 * time.Second,
-			WriteTimeout: 10 * time.Second,
-		},
+		syslog.DefaultNetworkTimeoutConfig(),
 		m,
+		factoryOpts...,
 	)
 
 	ingressTLSConfig, err := loggregator.NewIngressTLSConfig(
@@ -86,15 +153,32 @@ func NewSyslogAgent(
 		l.Panicf("failed to create log client for syslog connector: %q", err)
 	}
 
+	drainPauses := syslog.NewDrainPauses()
+	connectorOpts := []syslog.ConnectorOption{
+		syslog.WithLogClient(logClient, "syslog_agent"),
+		syslog.WithDefaultSanitization(cfg.DefaultDrainSanitization),
+		syslog.WithDrainPauses(drainPauses),
+	}
+	if cfg.DrainStatusNotices {
+		connectorOpts = append(connectorOpts, syslog.WithDeliveryStatusNotices(cfg.DrainStatusNoticeInterval))
+	}
+	if cfg.DrainLatencyBudget > 0 {
+		slowDrains, err := syslog.NewSlowDrains(cfg.DrainLatencyBudget, cfg.DrainSheddingMode, cfg.DrainSheddingSampleRate, m)
+		if err != nil {
+			l.Panicf("failed to configure drain shedding: %s", err)
+		}
+		connectorOpts = append(connectorOpts, syslog.WithSlowDrains(slowDrains))
+		debugHandler.Handle("/debug/slow-drains", slowDrains)
+	}
 	connector := syslog.NewSyslogConnector(
 		cfg.DrainSkipCertVerify,
 		timeoutwaitgroup.New(time.Minute),
 		writerFactory,
 		m,
-		syslog.WithLogClient(logClient, "syslog_agent"),
+		connectorOpts...,
 	)
 
-	var cacheClient *cache.CacheClient
+	var cacheClient *cache.ResilientClient
 	var cupsFetcher binding.Fetcher = nil
 	if cfg.Cache.CAFile != "" {
 		tlsClient := plumbing.NewTLSHTTPClient(
@@ -105,103 +189,169 @@ func NewSyslogAgent(
 			false,
 		)
 
-		cacheClient = cache.NewClient(cfg.Cache.URL, tlsClient)
+		var endpoints []cache.Endpoint
+		for _, u := range append([]string{cfg.Cache.URL}, cfg.Cache.FailoverURLs...) {
+			endpoints = append(endpoints, cache.Endpoint{Addr: u, Getter: client.New(u, client.WithHTTPClient(tlsClient))})
+		}
+
+		cacheClient = cache.NewResilientClient(
+			cache.NewFailoverClient(endpoints, m, l),
+			m,
+			cache.WithCircuitBreaker(cfg.Cache.CircuitBreakerFailures, cfg.Cache.CircuitBreakerCooldown),
+			cache.WithStaleDuration(cfg.Cache.StaleDuration),
+			cache.WithResilientClientLogger(l),
+		)
+		var ipChecker bindings.IPChecker = &cfg.Cache.Blacklist
+		if cfg.Cache.BlacklistFile != "" {
+			ipChecker, err = bindings.NewBlacklistFile(
+				&cfg.Cache.Blacklist,
+				cfg.Cache.BlacklistFile,
+				cfg.Cache.BlacklistReloadInterval,
+				l,
+			)
+			if err != nil {
+				l.Panicf("failed to load blacklist ranges: %s", err)
+			}
+		}
+		policies := cfg.InvalidDrainPolicies
+		policies.Silent = !cfg.WarnOnInvalidDrains
 		cupsFetcher = bindings.NewFilteredBindingFetcher(
-			&cfg.Cache.Blacklist,
+			ipChecker,
 			bindings.NewBindingFetcher(cfg.BindingsPerAppLimit, cacheClient, m, l),
 			m,
-			cfg.WarnOnInvalidDrains,
+			policies,
 			l,
 		)
 		cupsFetcher = bindings.NewDrainParamParser(cupsFetcher, cfg.DefaultDrainMetadata)
 	}
 
-	aggregateFetcher := bindings.NewAggregateDrainFetcher(cfg.AggregateDrainURLs, cacheClient)
-	bindingManager := binding.NewManager(
-		cupsFetcher,
-		bindings.NewDrainParamParser(aggregateFetcher, cfg.DefaultDrainMetadata),
-		connector,
-		m,
-		cfg.Cache.PollingInterval,
-		cfg.IdleDrainTimeout,
-		cfg.AggregateConnectionRefreshInterval,
-		l,
-	)
+	ctx, cancel := context.WithCancel(context.Background())
+	var aggregateSource bindings.CacheFetcher = cacheClient
+	if cfg.AggregateDrainsDocument.Location != "" {
+		var documentClient *http.Client
+		if strings.HasPrefix(cfg.AggregateDrainsDocument.Location, "https://") {
+			documentClient = plumbing.NewTLSHTTPClient(
+				cfg.AggregateDrainsDocument.CertFile,
+				cfg.AggregateDrainsDocument.KeyFile,
+				cfg.AggregateDrainsDocument.CAFile,
+				cfg.AggregateDrainsDocument.CommonName,
+				false,
+			)
+			documentClient.Timeout = 30 * time.Second
+		}
+		aggregateSource, err = bindings.NewAggregateDrainsDocument(
+			ctx,
+			cfg.AggregateDrainsDocument.Location,
+			documentClient,
+			cfg.AggregateDrainsDocument.PollingInterval,
+			l,
+		)
+		if err != nil {
+			l.Panicf("failed to load aggregate drains document: %s", err)
+		}
+	}
 
-	return &SyslogAgent{
+	aggregateFetcher := bindings.NewDrainParamParser(
+		bindings.NewAggregateDrainFetcher(cfg.AggregateDrainURLs, aggregateSource),
+		cfg.DefaultDrainMetadata,
+	)
+	agent := &SyslogAgent{
+		ctx:                 ctx,
+		cancel:              cancel,
 		grpc:                cfg.GRPC,
 		debugMetrics:        cfg.MetricsServer.DebugMetrics,
 		pprofPort:           cfg.MetricsServer.PprofPort,
+		infoPort:            cfg.MetricsServer.InfoPort,
 		metrics:             m,
 		log:                 l,
 		bindingsPerAppLimit: cfg.BindingsPerAppLimit,
-		bindingManager:      bindingManager,
+		debugHandler:        debugHandler,
+		introspector:        introspector,
+		loopDetector:        loopDetector,
+		diodeSize:           diodeSize,
+		adminPort:           cfg.AdminPort,
+		drainPauses:         drainPauses,
+		envelopeSizes:       cfg.EnvelopeSizeMetrics,
+		futureTolerance:     cfg.FutureTimestampTolerance,
+		futureAction:        cfg.FutureTimestampAction,
 	}
-}
 
-func drainTLSConfig(cfg Config) (*tls.Config, *tls.Config) {
-	certPool := trustedCertPool(cfg.DrainTrustedCAFile)
-	internalTlsConfig, err := tlsconfig.Build(
-		tlsconfig.WithInternalServiceDefaults(),
-	).Client(
-		tlsconfig.WithAuthority(certPool),
-	)
-	if err != nil {
-		log.Panicf("failed to load create tls config for http client: %s", err)
+	if cfg.DryRun {
+		l.Println("Dry run enabled: drains are probed but no data is sent")
+		dryRunner := binding.NewDryRunner(cupsFetcher, aggregateFetcher, connector, m, cfg.Cache.PollingInterval, l)
+		debugHandler.Handle("/debug/dry-run", dryRunner)
+		agent.bindingManager = dryRunner
+		return agent
 	}
 
-	externalTlsConfig, err := tlsconfig.Build(
-		tlsconfig.WithExternalServiceDefaults(),
-	).Client(
-		tlsconfig.WithAuthority(certPool),
+	managerOpts := []binding.ManagerOption{
+		binding.WithMaxBindings(cfg.MaxBindings),
+		binding.WithErrorEvents(errorEvents),
+		binding.WithDeliveries(deliveries),
+		binding.WithWriterWatchdog(cfg.WriterWatchdogDeadline),
+		binding.WithWriterCollection(cfg.BindingGracePeriod, cfg.WriterFlushTimeout),
+	}
+	if cfg.DrainProbe {
+		managerOpts = append(managerOpts, binding.WithDrainProbe(connector, cfg.DrainProbeRetryInterval))
+	}
+	agent.bindingManager = binding.NewManager(
+		cupsFetcher,
+		aggregateFetcher,
+		connector,
+		m,
+		cfg.Cache.PollingInterval,
+		cfg.IdleDrainTimeout,
+		cfg.AggregateConnectionRefreshInterval,
+		l,
+		managerOpts...,
 	)
 
-	if err != nil {
-		log.Panicf("failed to load create tls config for http client: %s", err)
-	}
+	return agent
+}
+
+func drainTLSConfig(cfg Config) (*tls.Config, *tls.Config) {
 	cipherSuites, err := cfg.processCipherSuites()
 	if err != nil {
 		log.Panicf("failed to load create tls config for http client: %s", err)
 	}
+	var suites []uint16
 	if cipherSuites != nil {
-		externalTlsConfig, err = tlsconfig.Build(
-			func(c *tls.Config) error {
-				c.MinVersion = tls.VersionTLS12
-				c.MaxVersion = tls.VersionTLS12
-				c.CipherSuites = *cipherSuites
-				return nil
-			},
-		).Client(
-			tlsconfig.WithAuthority(certPool),
-		)
-		if err != nil {
-			log.Panicf("failed to load create tls config for http client: %s", err)
-		}
-
+		suites = *cipherSuites
 	}
 
-	internalTlsConfig.InsecureSkipVerify = cfg.DrainSkipCertVerify //nolint:gosec
-	externalTlsConfig.InsecureSkipVerify = cfg.DrainSkipCertVerify //nolint:gosec
+	internalTlsConfig, externalTlsConfig, err := syslog.NewDrainTLSConfigs(
+		trustedCertPool(append([]string{cfg.DrainTrustedCAFile}, cfg.DrainTrustedCAFiles...)...),
+		suites,
+		cfg.DrainSkipCertVerify,
+	)
+	if err != nil {
+		log.Panicf("failed to load create tls config for http client: %s", err)
+	}
 
 	return internalTlsConfig, externalTlsConfig
 }
 
-func trustedCertPool(trustedCAFile string) *x509.CertPool {
+// trustedCertPool returns the system cert pool with the CAs in the files
+// added. Files that cannot be read are skipped.
+func trustedCertPool(trustedCAFiles ...string) *x509.CertPool {
 	cp, err := x509.SystemCertPool()
 	if err != nil {
 		cp = x509.NewCertPool()
 	}
 
-	if trustedCAFile != "" {
-		cert, err := os.ReadFile(trustedCAFile)
+	for _, f := range trustedCAFiles {
+		if f == "" {
+			continue
+		}
+		cert, err := os.ReadFile(f)
 		if err != nil {
 			log.Printf("unable to read provided custom CA: %s", err)
-			return cp
+			continue
 		}
 
 		ok := cp.AppendCertsFromPEM(cert)
 		if !ok {
-			log.Println("unable to add provided custom CA")
+			log.Printf("unable to add provided custom CA %s", f)
 		}
 	}
 
@@ -213,19 +363,42 @@ func (s *SyslogAgent) Run() {
 		s.metrics.RegisterDebugMetrics()
 		s.pprofServer = &http.Server{
 			Addr:              fmt.Sprintf("127.0.0.1:%d", s.pprofPort),
-			Handler:           http.DefaultServeMux,
+			Handler:           s.debugHandler,
 			ReadHeaderTimeout: 2 * time.Second,
 		}
 		go func() { log.Println("PPROF SERVER STOPPED " + s.pprofServer.ListenAndServe().Error()) }()
 	}
+	if s.infoPort != 0 {
+		s.infoServer = buildinfo.NewServer(s.infoPort)
+		go func() { log.Println("INFO SERVER STOPPED " + s.infoServer.ListenAndServe().Error()) }()
+	}
+	if s.adminPort != 0 {
+		logLevel := admin.NewLogLevel(s.log.Writer())
+		s.log.SetOutput(logLevel)
+		log.SetOutput(logLevel.Wrap(log.Writer()))
+		s.adminSrv = admin.NewServer(
+			s.adminPort,
+			admin.WithLogLevel(logLevel),
+			admin.WithDrains(s.drainPauses),
+			admin.WithStats(func() any { return s.introspector.Status() }),
+		)
+		if err := s.adminSrv.Start(); err != nil {
+			s.log.Fatalf("failed to start admin server: %s", err)
+		}
+	}
+	buildinfo.EmitStartup(s.metrics)
 	ingressDropped := s.metrics.NewCounter(
 		"dropped",
 		"Total number of dropped envelopes.",
 		metrics.WithMetricLabels(map[string]string{"direction": "ingress"}),
 	)
-	diode := diodes.NewManyToOneEnvelopeV2(10000, gendiodes.AlertFunc(func(missed int) {
+	diode := diodes.NewManyToOneEnvelopeV2(s.diodeSize, gendiodes.AlertFunc(func(missed int) {
 		ingressDropped.Add(float64(missed))
 	}))
+	s.introspector.Register("ingress", egress_v2.QueueStatus(diode))
+	if bm, ok := s.bindingManager.(egress_v2.Introspectable); ok {
+		s.introspector.Register("drains", bm)
+	}
 	go s.bindingManager.Run()
 
 	drainIngress := s.metrics.NewCounter(
@@ -233,8 +406,12 @@ func (s *SyslogAgent) Run() {
 		"Total number of envelopes ingressed by the agent.",
 		metrics.WithMetricLabels(map[string]string{"scope": "all_drains"}),
 	)
-	envelopeWriter := syslog.NewEnvelopeWriter(s.bindingManager.GetDrains, diode.Next, drainIngress, s.log)
-	go envelopeWriter.Run()
+	var writerOpts []syslog.EnvelopeWriterOption
+	if s.loopDetector != nil {
+		writerOpts = append(writerOpts, syslog.WithLoopDetector(s.loopDetector))
+	}
+	envelopeWriter := syslog.NewEnvelopeWriter(s.bindingManager.GetDrains, diode.Next, drainIngress, s.log, writerOpts...)
+	go envelopeWriter.Run(s.ctx)
 
 	var opts []plumbing.ConfigOption
 	if len(s.grpc.CipherSuites) > 0 {
@@ -261,19 +438,49 @@ func (s *SyslogAgent) Run() {
 		"Total number of envelopes where the origin tag is used as the source_id.",
 	)
 
-	rx := v2.NewReceiver(diode, im, omm)
+	var rxOpts []v2.ReceiverOption
+	if s.envelopeSizes {
+		rxOpts = append(rxOpts, v2.WithEnvelopeSizes(s.metrics))
+	}
+	if s.futureTolerance > 0 {
+		rxOpts = append(rxOpts, v2.WithFutureTimestamps(s.futureTolerance, s.futureAction, s.metrics))
+	}
+	rx := v2.NewReceiver(diode, im, omm, rxOpts...)
 	s.v2Srv = v2.NewServer(
 		fmt.Sprintf("127.0.0.1:%d", s.grpc.Port),
 		rx,
 		grpc.Creds(serverCreds),
 		grpc.MaxRecvMsgSize(10*1024*1024),
 	)
+	if s.grpc.HealthAndReflection {
+		s.v2Srv.EnableHealthAndReflection()
+	}
 	s.v2Srv.Start()
 }
 
 func (s *SyslogAgent) Stop() {
+	s.cancel()
 	if s.pprofServer != nil {
 		s.pprofServer.Close()
 	}
+	if s.infoServer != nil {
+		s.infoServer.Close()
+	}
+	if s.adminSrv != nil {
+		s.adminSrv.Stop()
+	}
 	s.v2Srv.Stop()
 }
+
+// Pause holds the writes to all drains until Resume is called. Envelopes
+// are buffered like for drains paused with agentctl and dropped once the
+// buffers are full.
+func (s *SyslogAgent) Pause() {
+	s.drainPauses.SetAllPaused(true)
+}
+
+// Resume resumes the writes to the drains that are not paused with
+// agentctl.
+func (s *SyslogAgent) Resume() {
+	s.drainPauses.SetAllPaused(false)
+}
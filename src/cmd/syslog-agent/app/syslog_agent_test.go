@@ -3,6 +3,7 @@ package app_test
 import (
 	"context"
 	"crypto/tls"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
@@ -10,6 +11,8 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -22,8 +25,10 @@ import (
 	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
 	"code.cloudfoundry.org/loggregator-agent-release/src/cmd/syslog-agent/app"
 	"code.cloudfoundry.org/loggregator-agent-release/src/internal/testhelper"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/admin"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/binding"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/config"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/ingress/bindings"
 	"code.cloudfoundry.org/tlsconfig"
 )
@@ -266,6 +271,110 @@ var _ = Describe("SyslogAgent", func() {
 
 			Eventually(agentMetrics.GetDebugMetricsEnabled).Should(BeTrue())
 		})
+
+		It("serves recent error events", func() {
+			time.Sleep(sleepTime)
+
+			u := fmt.Sprintf("http://127.0.0.1:%d/debug/errors", agentCfg.MetricsServer.PprofPort)
+			Eventually(func() (string, error) {
+				resp, err := http.Get(u) //nolint:gosec
+				if err != nil {
+					return "", err
+				}
+				defer resp.Body.Close()
+				return resp.Header.Get("Content-Type"), nil
+			}, 3).Should(Equal("application/json"))
+		})
+
+		Context("when a drain latency budget is configured", func() {
+			BeforeEach(func() {
+				agentCfg.DrainLatencyBudget = time.Nanosecond
+				agentCfg.DrainSheddingMode = syslog.SheddingDrop
+			})
+
+			It("serves the drains that shed envelopes", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				emitLogs(ctx, appIDs, grpcPort, agentCerts)
+				defer cancel()
+
+				u := fmt.Sprintf("http://127.0.0.1:%d/debug/slow-drains", agentCfg.MetricsServer.PprofPort)
+				Eventually(func() ([]map[string]any, error) {
+					resp, err := http.Get(u) //nolint:gosec
+					if err != nil {
+						return nil, err
+					}
+					defer resp.Body.Close()
+					var drains []map[string]any
+					err = json.NewDecoder(resp.Body).Decode(&drains)
+					return drains, err
+				}, 5).Should(ContainElement(HaveKeyWithValue("drain", fmt.Sprintf("syslog-tls://localhost:%s", aggregateDrain.port()))))
+			})
+		})
+	})
+
+	Context("when the admin port is configured", func() {
+		var client *admin.Client
+
+		BeforeEach(func() {
+			agentCfg.AdminPort = uint16(33000 + GinkgoParallelProcess())
+			DeferCleanup(log.SetOutput, log.Writer())
+
+			var err error
+			client, err = admin.NewClient(fmt.Sprintf("127.0.0.1:%d", agentCfg.AdminPort))
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(client.Close)
+		})
+
+		It("pauses and resumes drains", func() {
+			drain := fmt.Sprintf("syslog-tls://localhost:%s", aggregateDrain.port())
+			Eventually(func() error {
+				return client.SetDrainPaused(context.Background(), drain, true)
+			}).Should(Succeed())
+
+			ctx, cancel := context.WithCancel(context.Background())
+			emitLogs(ctx, appIDs, grpcPort, agentCerts)
+			defer cancel()
+			go func() {
+				for {
+					select {
+					case <-appHTTPSDrain.receivedMessages:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+
+			Eventually(appTLSDrain.receivedMessages, 3).Should(Receive())
+			Consistently(aggregateDrain.receivedMessages, 1).ShouldNot(Receive())
+
+			Expect(client.SetDrainPaused(context.Background(), drain, false)).To(Succeed())
+			Eventually(aggregateDrain.receivedMessages, 3).Should(Receive())
+		})
+	})
+
+	Context("when the aggregate drains are defined in a document", func() {
+		BeforeEach(func() {
+			path := filepath.Join(GinkgoT().TempDir(), "aggregate-drains.json")
+			document := fmt.Sprintf(`[{"url": "syslog-tls://localhost:%s"}]`, aggregateDrain.port())
+			Expect(os.WriteFile(path, []byte(document), 0600)).To(Succeed())
+
+			bindingCache.aggregate = nil
+			agentCfg.AggregateDrainsDocument = app.AggregateDrainsDocument{
+				Location:        path,
+				PollingInterval: time.Minute,
+			}
+		})
+
+		It("connects to the drains of the document", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			emitLogs(ctx, appIDs, grpcPort, agentCerts)
+			defer cancel()
+
+			Eventually(func() float64 {
+				return agentMetrics.GetMetric("aggregate_drains", map[string]string{"unit": "count"}).Value()
+			}, 3).Should(Equal(1.0))
+			Eventually(aggregateDrain.receivedMessages, 3).Should(Receive())
+		})
 	})
 
 	Context("when IPs are added to the denylist configuration", func() {
@@ -411,6 +520,27 @@ var _ = Describe("SyslogAgent", func() {
 		})
 	})
 
+	Context("when dry run is enabled", func() {
+		BeforeEach(func() {
+			agentCfg.DryRun = true
+		})
+
+		It("ingresses envelopes without sending them to drains", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			emitLogs(ctx, appIDs, grpcPort, agentCerts)
+			defer cancel()
+
+			Eventually(func() float64 {
+				if !agentMetrics.HasMetric("ingress", map[string]string{"scope": "agent"}) {
+					return 0
+				}
+				return agentMetrics.GetMetric("ingress", map[string]string{"scope": "agent"}).Value()
+			}, 3).Should(BeNumerically(">", 0))
+			Consistently(appHTTPSDrain.receivedMessages, 1).ShouldNot(Receive())
+			Consistently(appTLSDrain.receivedMessages, 1).ShouldNot(Receive())
+		})
+	})
+
 	Context("when GRPC cert configuration is invalid", func() {
 		It("panics", func() {
 			// Give agent.Run() time to start the gRPC server, otherwise the
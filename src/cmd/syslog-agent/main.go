@@ -23,6 +23,14 @@ func main() {
 		logger.SetFlags(0)
 
 	}
+	if cfg.EventLogSource != "" {
+		if err := plumbing.AddEventLogOutput(logger, cfg.EventLogSource); err != nil {
+			logger.Fatalf("failed to open event log: %s", err)
+		}
+	}
+	if cfg.LogThrottleInterval > 0 {
+		plumbing.ThrottleLogOutput(logger, cfg.LogThrottleInterval)
+	}
 	m := metrics.NewRegistry(
 		logger,
 		metrics.WithTLSServer(
@@ -33,5 +41,8 @@ func main() {
 		),
 	)
 
-	app.NewSyslogAgent(cfg, m, logger).Run()
+	a := app.NewSyslogAgent(cfg, m, logger)
+	if err := plumbing.RunService("loggr-syslog-agent", a.Run, a.Stop, plumbing.WithPause(a.Pause, a.Resume)); err != nil {
+		logger.Fatalf("failed to run as a service: %s", err)
+	}
 }
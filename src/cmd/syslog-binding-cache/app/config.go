@@ -20,6 +20,8 @@ type Config struct {
 	APIPollingInterval   time.Duration `env:"API_POLLING_INTERVAL, report"`
 	APIBatchSize         int           `env:"API_BATCH_SIZE, report"`
 	APIDisableKeepAlives bool          `env:"API_DISABLE_KEEP_ALIVES, report"`
+	APIPageConcurrency   int           `env:"API_PAGE_CONCURRENCY, report"`
+	APIMaxBackoff        time.Duration `env:"API_MAX_BACKOFF, report"`
 	CipherSuites         []string      `env:"CIPHER_SUITES, report"`
 	AggregateDrainsFile  string        `env:"AGGREGATE_DRAINS_FILE, report"`
 
@@ -54,13 +54,19 @@ func (sbc *SyslogBindingCache) Run() {
 	}
 	store := binding.NewStore(sbc.metrics)
 	aggregateStore := binding.NewAggregateStore(sbc.config.AggregateDrainsFile)
-	poller := binding.NewPoller(sbc.apiClient(), sbc.config.APIPollingInterval, store, sbc.metrics, sbc.log)
+	pollerOpts := []binding.PollerOption{binding.WithPageConcurrency(sbc.config.APIPageConcurrency)}
+	if sbc.config.APIMaxBackoff > 0 {
+		pollerOpts = append(pollerOpts, binding.WithMaxBackoff(sbc.config.APIMaxBackoff))
+	}
+	poller := binding.NewPoller(sbc.apiClient(), sbc.config.APIPollingInterval, store, sbc.metrics, sbc.log, pollerOpts...)
 
 	go poller.Poll()
 
+	latencies := cache.NewServeLatencies()
 	router := chi.NewRouter()
-	router.Get("/v2/bindings", cache.Handler(store))
-	router.Get("/v2/aggregate", cache.AggregateHandler(aggregateStore))
+	router.Get("/v2/bindings", latencies.Handler("/v2/bindings", cache.Handler(store)))
+	router.Get("/v2/aggregate", latencies.Handler("/v2/aggregate", cache.AggregateHandler(aggregateStore)))
+	router.Get("/debug/stats", cache.StatsHandler(store, aggregateStore, latencies))
 
 	sbc.startServer(router)
 }
@@ -1,6 +1,7 @@
 package app
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
@@ -36,11 +37,16 @@ type UDPForwarder struct {
 	index        string
 	ip           string
 
-	nr *ingress.NetworkReader
+	nr           *ingress.NetworkReader
+	unmarshaller *ingress.EventUnmarshaller
+	v2Ingress    *loggregator.IngressClient
 
 	mu sync.Mutex
 }
 
+// shutdownTimeout is how long Stop waits for the v1 ingress path to stop.
+const shutdownTimeout = 5 * time.Second
+
 func NewUDPForwarder(cfg Config, l *log.Logger, m Metrics) *UDPForwarder {
 	return &UDPForwarder{
 		grpc:         cfg.LoggregatorAgentGRPC,
@@ -96,6 +102,8 @@ func (u *UDPForwarder) Run() {
 
 	dropsondeUnmarshaller := ingress.NewUnMarshaller(w)
 	u.mu.Lock()
+	u.unmarshaller = dropsondeUnmarshaller
+	u.v2Ingress = v2Ingress
 	u.nr, err = ingress.NewNetworkReader(
 		fmt.Sprintf("127.0.0.1:%d", u.udpPort),
 		dropsondeUnmarshaller,
@@ -109,6 +117,10 @@ func (u *UDPForwarder) Run() {
 	go u.nr.StartReading()
 	u.nr.StartWriting()
 }
+
+// Stop stops reading from the UDP socket, waits for the envelope that is
+// being forwarded and flushes the envelopes batched by the client of the
+// loggregator agent. Run returns once the forwarder is stopped.
 func (u *UDPForwarder) Stop() {
 	u.mu.Lock()
 	defer u.mu.Unlock()
@@ -118,7 +130,20 @@ func (u *UDPForwarder) Stop() {
 	}
 
 	if u.nr != nil {
-		u.nr.Stop()
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		u.unmarshaller.Stop()
+		err := u.nr.Shutdown(ctx)
+		u.nr = nil
+		if err != nil {
+			// Envelopes might still be emitted, so the client cannot be
+			// closed.
+			u.log.Printf("failed to stop UDP ingress: %s", err)
+			return
+		}
+		if err := u.v2Ingress.CloseSend(); err != nil {
+			u.log.Printf("failed to flush envelopes to the loggregator agent: %s", err)
+		}
 	}
 }
 
@@ -126,7 +151,7 @@ type v2Writer struct {
 	ingressClient *loggregator.IngressClient
 }
 
-func (w v2Writer) Write(e *events.Envelope) {
+func (w v2Writer) Write(_ context.Context, e *events.Envelope) {
 	v2e := conversion.ToV2(e, true)
 	w.ingressClient.Emit(v2e)
 }
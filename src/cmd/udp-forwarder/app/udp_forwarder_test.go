@@ -40,6 +40,7 @@ var _ = Describe("UDPForwarder", func() {
 		forwarderMetrics *metricsHelpers.SpyMetricsRegistry
 		forwarderLogr    *log.Logger
 		forwarder        *app.UDPForwarder
+		forwarderDone    chan struct{}
 	)
 
 	BeforeEach(func() {
@@ -77,7 +78,11 @@ var _ = Describe("UDPForwarder", func() {
 
 	JustBeforeEach(func() {
 		forwarder = app.NewUDPForwarder(forwarderCfg, forwarderLogr, forwarderMetrics)
-		go forwarder.Run()
+		forwarderDone = make(chan struct{})
+		go func(f *app.UDPForwarder, done chan struct{}) {
+			defer close(done)
+			f.Run()
+		}(forwarder, forwarderDone)
 
 		e, err := emitter.NewUdpEmitter(fmt.Sprintf("127.0.0.1:%d", forwarderPort))
 		Expect(err).ToNot(HaveOccurred())
@@ -129,6 +134,12 @@ var _ = Describe("UDPForwarder", func() {
 		Expect(v2e.GetTags()["ip"]).To(Equal("127.0.0.1"))
 	})
 
+	It("returns from Run when stopped", func() {
+		forwarder.Stop()
+
+		Eventually(forwarderDone).Should(BeClosed())
+	})
+
 	It("does not have debug metrics by default", func() {
 		Consistently(forwarderMetrics.GetDebugMetricsEnabled()).Should(BeFalse())
 		Consistently(func() error {
@@ -3,6 +3,8 @@ package main
 import (
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
 	metrics "code.cloudfoundry.org/go-metric-registry"
 
@@ -32,5 +34,13 @@ func main() {
 	)
 
 	forwarder := app.NewUDPForwarder(cfg, logger, m)
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		forwarder.Stop()
+	}()
+
 	forwarder.Run()
 }
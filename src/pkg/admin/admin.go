@@ -0,0 +1,123 @@
+// Package admin implements a gRPC service on localhost for runtime
+// operations on an agent, such as silencing its logs, disabling a
+// processor or pausing a drain, and a client for it.
+package admin
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// Log levels of an agent. The agents do not classify their logs, so
+// LevelInfo writes all of them and LevelSilent none.
+const (
+	LevelInfo   = "info"
+	LevelSilent = "silent"
+)
+
+// LogLevel is the output of an agent's logger that writes to the wrapped
+// writer unless the agent is silenced.
+type LogLevel struct {
+	w      io.Writer
+	silent *atomic.Bool
+}
+
+// NewLogLevel returns a LogLevel at LevelInfo that writes to w.
+func NewLogLevel(w io.Writer) *LogLevel {
+	return &LogLevel{w: w, silent: &atomic.Bool{}}
+}
+
+// Wrap returns a LogLevel that writes to w and shares the level of l, e.g.
+// for a second logger of the agent.
+func (l *LogLevel) Wrap(w io.Writer) *LogLevel {
+	return &LogLevel{w: w, silent: l.silent}
+}
+
+// Write writes p to the wrapped writer unless the level is LevelSilent.
+func (l *LogLevel) Write(p []byte) (int, error) {
+	if l.silent.Load() {
+		return len(p), nil
+	}
+	return l.w.Write(p)
+}
+
+// Set changes the level.
+func (l *LogLevel) Set(level string) error {
+	switch level {
+	case LevelInfo:
+		l.silent.Store(false)
+	case LevelSilent:
+		l.silent.Store(true)
+	default:
+		return fmt.Errorf("unknown log level %q", level)
+	}
+	return nil
+}
+
+// Level returns the current level.
+func (l *LogLevel) Level() string {
+	if l.silent.Load() {
+		return LevelSilent
+	}
+	return LevelInfo
+}
+
+// Switches enable and disable the processors of an agent at runtime.
+// Processors are enabled until they are disabled.
+type Switches struct {
+	mu       sync.RWMutex
+	switches map[string]*atomic.Bool
+}
+
+// NewSwitches returns Switches without any processors.
+func NewSwitches() *Switches {
+	return &Switches{switches: make(map[string]*atomic.Bool)}
+}
+
+// Add registers the processor with the given name and returns a function
+// that reports whether it is enabled.
+func (s *Switches) Add(name string) func() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	enabled, ok := s.switches[name]
+	if !ok {
+		enabled = &atomic.Bool{}
+		enabled.Store(true)
+		s.switches[name] = enabled
+	}
+	return enabled.Load
+}
+
+// Set enables or disables the processor with the given name.
+func (s *Switches) Set(name string, enabled bool) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sw, ok := s.switches[name]
+	if !ok {
+		return fmt.Errorf("unknown processor %q", name)
+	}
+	sw.Store(enabled)
+	return nil
+}
+
+// Status returns whether each processor is enabled.
+func (s *Switches) Status() map[string]bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	status := make(map[string]bool, len(s.switches))
+	for name, sw := range s.switches {
+		status[name] = sw.Load()
+	}
+	return status
+}
+
+// DrainPauser pauses and resumes writes to drains.
+type DrainPauser interface {
+	SetPaused(drain string, paused bool) error
+	Paused() []string
+}
@@ -0,0 +1,133 @@
+package admin_test
+
+import (
+	"bytes"
+	"context"
+	"log"
+
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/admin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Admin", func() {
+	var (
+		buf        *bytes.Buffer
+		logLevel   *admin.LogLevel
+		processors *admin.Switches
+		drains     *spyDrainPauser
+		server     *admin.Server
+		client     *admin.Client
+	)
+
+	BeforeEach(func() {
+		buf = &bytes.Buffer{}
+		logLevel = admin.NewLogLevel(buf)
+		processors = admin.NewSwitches()
+		drains = &spyDrainPauser{paused: make(map[string]bool)}
+		server = admin.NewServer(0,
+			admin.WithLogLevel(logLevel),
+			admin.WithProcessors(processors),
+			admin.WithDrains(drains),
+			admin.WithStats(func() any {
+				return []map[string]any{{"name": "ingress", "depth": 3}}
+			}),
+		)
+		Expect(server.Start()).To(Succeed())
+		DeferCleanup(server.Stop)
+
+		var err error
+		client, err = admin.NewClient(server.Addr())
+		Expect(err).ToNot(HaveOccurred())
+		DeferCleanup(client.Close)
+	})
+
+	It("listens on localhost", func() {
+		Expect(server.Addr()).To(HavePrefix("127.0.0.1:"))
+	})
+
+	It("sets the log level", func() {
+		l := log.New(logLevel, "", 0)
+
+		Expect(client.SetLogLevel(context.Background(), admin.LevelSilent)).To(Succeed())
+		l.Print("hidden")
+		Expect(client.SetLogLevel(context.Background(), admin.LevelInfo)).To(Succeed())
+		l.Print("shown")
+
+		Expect(buf.String()).To(Equal("shown\n"))
+		err := client.SetLogLevel(context.Background(), "debug")
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	})
+
+	It("enables and disables processors", func() {
+		enabled := processors.Add("metric_rules")
+		Expect(enabled()).To(BeTrue())
+
+		Expect(client.SetProcessorEnabled(context.Background(), "metric_rules", false)).To(Succeed())
+		Expect(enabled()).To(BeFalse())
+		Expect(client.SetProcessorEnabled(context.Background(), "metric_rules", true)).To(Succeed())
+		Expect(enabled()).To(BeTrue())
+
+		err := client.SetProcessorEnabled(context.Background(), "unknown", false)
+		Expect(status.Code(err)).To(Equal(codes.NotFound))
+	})
+
+	It("pauses and resumes drains", func() {
+		Expect(client.SetDrainPaused(context.Background(), "some-drain", true)).To(Succeed())
+		Expect(drains.paused).To(HaveKeyWithValue("some-drain", true))
+		Expect(client.SetDrainPaused(context.Background(), "some-drain", false)).To(Succeed())
+		Expect(drains.paused).To(HaveKeyWithValue("some-drain", false))
+	})
+
+	It("dumps the stats", func() {
+		processors.Add("metric_rules")
+		Expect(client.SetLogLevel(context.Background(), admin.LevelSilent)).To(Succeed())
+		Expect(client.SetDrainPaused(context.Background(), "some-drain", true)).To(Succeed())
+
+		stats, err := client.Stats(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stats).To(Equal(map[string]any{
+			"log_level":     "silent",
+			"processors":    map[string]any{"metric_rules": true},
+			"paused_drains": []any{"some-drain"},
+			"pipeline":      []any{map[string]any{"name": "ingress", "depth": 3.0}},
+		}))
+	})
+
+	It("does not implement operations it is not configured with", func() {
+		s := admin.NewServer(0)
+		Expect(s.Start()).To(Succeed())
+		defer s.Stop()
+		c, err := admin.NewClient(s.Addr())
+		Expect(err).ToNot(HaveOccurred())
+		defer c.Close()
+
+		err = c.SetDrainPaused(context.Background(), "some-drain", true)
+		Expect(status.Code(err)).To(Equal(codes.Unimplemented))
+		stats, err := c.Stats(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stats).To(BeEmpty())
+	})
+})
+
+type spyDrainPauser struct {
+	paused map[string]bool
+}
+
+func (s *spyDrainPauser) SetPaused(drain string, paused bool) error {
+	s.paused[drain] = paused
+	return nil
+}
+
+func (s *spyDrainPauser) Paused() []string {
+	var drains []string
+	for d, p := range s.paused {
+		if p {
+			drains = append(drains, d)
+		}
+	}
+	return drains
+}
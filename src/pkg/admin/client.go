@@ -0,0 +1,73 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Client calls the admin service of an agent.
+type Client struct {
+	conn *grpc.ClientConn
+}
+
+// NewClient returns a Client of the admin service at addr. The service
+// only listens on localhost, so the connection is not encrypted.
+func NewClient(addr string) (*Client, error) {
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn}, nil
+}
+
+// Close closes the connection to the service.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// SetLogLevel sets the log level of the agent to LevelInfo or LevelSilent.
+func (c *Client) SetLogLevel(ctx context.Context, level string) error {
+	_, err := c.call(ctx, "SetLogLevel", map[string]any{"level": level})
+	return err
+}
+
+// SetProcessorEnabled enables or disables the processor with the given
+// name.
+func (c *Client) SetProcessorEnabled(ctx context.Context, name string, enabled bool) error {
+	_, err := c.call(ctx, "SetProcessor", map[string]any{"name": name, "enabled": enabled})
+	return err
+}
+
+// SetDrainPaused pauses or resumes writes to the drain with the given URL
+// or drain hash. A URL has to be the exact URL of the binding including
+// its credentials and query parameters.
+func (c *Client) SetDrainPaused(ctx context.Context, drain string, paused bool) error {
+	_, err := c.call(ctx, "SetDrainPaused", map[string]any{"drain": drain, "paused": paused})
+	return err
+}
+
+// Stats returns the log level, processors, paused drains and pipeline
+// stats of the agent.
+func (c *Client) Stats(ctx context.Context) (map[string]any, error) {
+	resp, err := c.call(ctx, "Stats", nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.AsMap(), nil
+}
+
+func (c *Client) call(ctx context.Context, method string, fields map[string]any) (*structpb.Struct, error) {
+	req, err := structpb.NewStruct(fields)
+	if err != nil {
+		return nil, err
+	}
+	resp := new(structpb.Struct)
+	if err := c.conn.Invoke(ctx, fmt.Sprintf("/%s/%s", serviceName, method), req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,208 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// The requests and responses of the admin service are structpb.Structs,
+// so the service needs no generated code. The fields of each request are
+// documented on the methods of Client.
+const serviceName = "loggregator.admin.v1.Admin"
+
+type adminServer interface {
+	SetLogLevel(context.Context, *structpb.Struct) (*structpb.Struct, error)
+	SetProcessor(context.Context, *structpb.Struct) (*structpb.Struct, error)
+	SetDrainPaused(context.Context, *structpb.Struct) (*structpb.Struct, error)
+	Stats(context.Context, *structpb.Struct) (*structpb.Struct, error)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*adminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "SetLogLevel", Handler: unaryHandler("SetLogLevel", adminServer.SetLogLevel)},
+		{MethodName: "SetProcessor", Handler: unaryHandler("SetProcessor", adminServer.SetProcessor)},
+		{MethodName: "SetDrainPaused", Handler: unaryHandler("SetDrainPaused", adminServer.SetDrainPaused)},
+		{MethodName: "Stats", Handler: unaryHandler("Stats", adminServer.Stats)},
+	},
+}
+
+func unaryHandler(
+	method string,
+	call func(adminServer, context.Context, *structpb.Struct) (*structpb.Struct, error),
+) func(any, context.Context, func(any) error, grpc.UnaryServerInterceptor) (any, error) {
+	return func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+		in := new(structpb.Struct)
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		if interceptor == nil {
+			return call(srv.(adminServer), ctx, in)
+		}
+		info := &grpc.UnaryServerInfo{
+			Server:     srv,
+			FullMethod: fmt.Sprintf("/%s/%s", serviceName, method),
+		}
+		return interceptor(ctx, in, info, func(ctx context.Context, req any) (any, error) {
+			return call(srv.(adminServer), ctx, req.(*structpb.Struct))
+		})
+	}
+}
+
+// Server serves the admin service of an agent on localhost. Operations
+// that are not configured with a ServerOption are unimplemented.
+type Server struct {
+	addr       string
+	lis        net.Listener
+	grpcSrv    *grpc.Server
+	logLevel   *LogLevel
+	processors *Switches
+	drains     DrainPauser
+	stats      func() any
+}
+
+// ServerOption configures the operations of a Server.
+type ServerOption func(*Server)
+
+// WithLogLevel lets the admin service change the log level.
+func WithLogLevel(l *LogLevel) ServerOption {
+	return func(s *Server) {
+		s.logLevel = l
+	}
+}
+
+// WithProcessors lets the admin service enable and disable processors.
+func WithProcessors(sw *Switches) ServerOption {
+	return func(s *Server) {
+		s.processors = sw
+	}
+}
+
+// WithDrains lets the admin service pause and resume drains.
+func WithDrains(d DrainPauser) ServerOption {
+	return func(s *Server) {
+		s.drains = d
+	}
+}
+
+// WithStats adds the pipeline stats returned by f to the stats of the
+// admin service. They must marshal to a JSON object or array.
+func WithStats(f func() any) ServerOption {
+	return func(s *Server) {
+		s.stats = f
+	}
+}
+
+// NewServer returns a Server that listens on the port of localhost.
+func NewServer(port uint16, opts ...ServerOption) *Server {
+	s := &Server{addr: fmt.Sprintf("127.0.0.1:%d", port)}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
+}
+
+// Start listens and serves the admin service in the background.
+func (s *Server) Start() error {
+	lis, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	s.lis = lis
+	s.grpcSrv = grpc.NewServer()
+	s.grpcSrv.RegisterService(&serviceDesc, s)
+
+	go func() {
+		if err := s.grpcSrv.Serve(lis); err != nil {
+			log.Printf("admin server stopped: %s", err)
+		}
+	}()
+	return nil
+}
+
+// Addr returns the address the server listens on once it is started.
+func (s *Server) Addr() string {
+	if s.lis == nil {
+		return s.addr
+	}
+	return s.lis.Addr().String()
+}
+
+// Stop stops the server.
+func (s *Server) Stop() {
+	if s.grpcSrv != nil {
+		s.grpcSrv.Stop()
+	}
+}
+
+func (s *Server) SetLogLevel(_ context.Context, req *structpb.Struct) (*structpb.Struct, error) {
+	if s.logLevel == nil {
+		return nil, status.Error(codes.Unimplemented, "the agent does not support log levels")
+	}
+	if err := s.logLevel.Set(req.GetFields()["level"].GetStringValue()); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return &structpb.Struct{}, nil
+}
+
+func (s *Server) SetProcessor(_ context.Context, req *structpb.Struct) (*structpb.Struct, error) {
+	if s.processors == nil {
+		return nil, status.Error(codes.Unimplemented, "the agent does not support switching processors")
+	}
+	fields := req.GetFields()
+	if err := s.processors.Set(fields["name"].GetStringValue(), fields["enabled"].GetBoolValue()); err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	return &structpb.Struct{}, nil
+}
+
+func (s *Server) SetDrainPaused(_ context.Context, req *structpb.Struct) (*structpb.Struct, error) {
+	if s.drains == nil {
+		return nil, status.Error(codes.Unimplemented, "the agent does not support pausing drains")
+	}
+	fields := req.GetFields()
+	if err := s.drains.SetPaused(fields["drain"].GetStringValue(), fields["paused"].GetBoolValue()); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return &structpb.Struct{}, nil
+}
+
+func (s *Server) Stats(context.Context, *structpb.Struct) (*structpb.Struct, error) {
+	stats := make(map[string]any)
+	if s.logLevel != nil {
+		stats["log_level"] = s.logLevel.Level()
+	}
+	if s.processors != nil {
+		stats["processors"] = s.processors.Status()
+	}
+	if s.drains != nil {
+		stats["paused_drains"] = s.drains.Paused()
+	}
+	if s.stats != nil {
+		stats["pipeline"] = s.stats()
+	}
+
+	// structpb only accepts the types encoding/json unmarshals to.
+	b, err := json.Marshal(stats)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	resp, err := structpb.NewStruct(fields)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return resp, nil
+}
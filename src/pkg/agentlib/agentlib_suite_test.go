@@ -0,0 +1,13 @@
+package agentlib_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestAgentlib(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Agentlib Suite")
+}
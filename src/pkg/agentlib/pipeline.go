@@ -0,0 +1,251 @@
+// Package agentlib runs the agent's envelope pipeline in-process, so that
+// other Go programs and tests can reuse it without running the agent
+// binaries.
+//
+// A Pipeline buffers the envelopes it receives, tags them, aggregates
+// counters and writes them to its destinations, like the forwarder agent:
+//
+//	p := agentlib.New(
+//		metrics.NewRegistry(logger),
+//		agentlib.WithTags(map[string]string{"deployment": "cf"}),
+//		agentlib.WithDestination(w, egress_v2.Selector{EnvelopeTypes: []string{"log"}}),
+//	)
+//	p.Start()
+//	defer p.Stop()
+//
+//	srv := v2.NewServer("127.0.0.1:3458", p.Receiver(), grpc.Creds(creds))
+//	go srv.Start()
+//
+// Envelopes can also be written to the Pipeline directly with Write.
+//
+// Sources, processors and sinks registered by name, e.g. by packages
+// linked into a fork of an agent, are added with WithPlugins:
+//
+//	plugins, err := agentlib.PluginConfigs{{Type: "sink", Name: "kafka"}}.Build(m, logger)
+//	p := agentlib.New(m, agentlib.WithPlugins(plugins))
+package agentlib
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	gendiodes "code.cloudfoundry.org/go-diodes"
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metrics "code.cloudfoundry.org/go-metric-registry"
+
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/diodes"
+	egress_v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
+	v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/ingress/v2"
+)
+
+const defaultBufferSize = 10000
+
+// MetricClient creates the metrics of a Pipeline.
+type MetricClient interface {
+	NewCounter(name, helpText string, opts ...metrics.MetricOption) metrics.Counter
+}
+
+// Pipeline receives envelopes and writes them to its destinations.
+type Pipeline struct {
+	m            MetricClient
+	tags         map[string]string
+	maxTagBytes  int
+	bufferSize   int
+	destinations []egress_v2.Writer
+	plugins      Plugins
+
+	buffer         *diodes.ManyToOneEnvelopeV2
+	writer         egress_v2.EnvelopeWriter
+	ingress        metrics.Counter
+	originMappings metrics.Counter
+
+	mu      sync.Mutex
+	started bool
+	stopped bool
+	stop    chan struct{}
+	done    chan struct{}
+	cancel  context.CancelFunc
+}
+
+// Option configures a Pipeline.
+type Option func(*Pipeline)
+
+// WithTags adds the tags to all envelopes that do not have them already.
+func WithTags(tags map[string]string) Option {
+	return func(p *Pipeline) {
+		p.tags = tags
+	}
+}
+
+// WithMaxTagBytes truncates tags of envelopes whose tags exceed n bytes. A
+// max of zero disables truncation.
+func WithMaxTagBytes(n int) Option {
+	return func(p *Pipeline) {
+		p.maxTagBytes = n
+	}
+}
+
+// WithBufferSize sets the number of envelopes buffered between ingress and
+// the destinations. When the buffer is full the oldest envelopes are
+// dropped. Defaults to 10000, which is also used for sizes that are not
+// positive.
+func WithBufferSize(n int) Option {
+	return func(p *Pipeline) {
+		p.bufferSize = n
+	}
+}
+
+// WithDestination adds a destination that receives the envelopes selected
+// by s. The zero Selector selects all envelopes. Destinations are written
+// to sequentially, so slow destinations should buffer writes, e.g. with
+// egress.NewDiodeWriter.
+func WithDestination(w egress_v2.Writer, s egress_v2.Selector) Option {
+	return func(p *Pipeline) {
+		if !s.IsZero() {
+			w = egress_v2.NewSelectingWriter(w, s)
+		}
+		p.destinations = append(p.destinations, w)
+	}
+}
+
+// WithPlugins adds the sinks of the plugins as destinations that receive
+// all envelopes, processes envelopes with the processors after they are
+// tagged, and runs the sources while the Pipeline is started.
+func WithPlugins(plugins Plugins) Option {
+	return func(p *Pipeline) {
+		p.plugins.Sources = append(p.plugins.Sources, plugins.Sources...)
+		p.plugins.Processors = append(p.plugins.Processors, plugins.Processors...)
+		p.destinations = append(p.destinations, plugins.Sinks...)
+	}
+}
+
+// New returns a Pipeline. The metrics of the Pipeline are created with m,
+// e.g. a metrics.Registry that is not served.
+func New(m MetricClient, opts ...Option) *Pipeline {
+	p := &Pipeline{
+		m:          m,
+		bufferSize: defaultBufferSize,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+		cancel:     func() {},
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	if p.bufferSize <= 0 {
+		p.bufferSize = defaultBufferSize
+	}
+
+	dropped := m.NewCounter(
+		"dropped",
+		"Total number of dropped envelopes.",
+		metrics.WithMetricLabels(map[string]string{"direction": "ingress"}),
+	)
+	p.buffer = diodes.NewManyToOneEnvelopeV2(p.bufferSize, gendiodes.AlertFunc(func(missed int) {
+		dropped.Add(float64(missed))
+	}))
+	p.ingress = m.NewCounter(
+		"ingress",
+		"Total number of envelopes ingressed by the agent.",
+	)
+	p.originMappings = m.NewCounter(
+		"origin_mappings",
+		"Total number of envelopes where the origin tag is used as the source_id.",
+	)
+	p.writer = egress_v2.NewEnvelopeWriter(
+		egress_v2.NewMultiWriter(p.destinations...),
+		egress_v2.NewCounterAggregator(p.tagEnvelope()),
+	)
+
+	return p
+}
+
+func (p *Pipeline) tagEnvelope() func(*loggregator_v2.Envelope) {
+	tagger := egress_v2.NewTagger(p.tags)
+	tagEnvelope := tagger.TagEnvelope
+	if p.maxTagBytes > 0 {
+		tagLimiter := egress_v2.NewTagLimiter(p.maxTagBytes, p.m.NewCounter(
+			"tags_truncated",
+			"Total number of envelopes with tags truncated to the maximum tag size.",
+		))
+		tagEnvelope = func(e *loggregator_v2.Envelope) {
+			tagger.TagEnvelope(e)
+			tagLimiter.LimitTags(e)
+		}
+	}
+	if len(p.plugins.Processors) == 0 {
+		return tagEnvelope
+	}
+
+	return func(e *loggregator_v2.Envelope) {
+		tagEnvelope(e)
+		p.plugins.Process(e)
+	}
+}
+
+// Receiver returns a receiver for the Loggregator V2 Ingress API that
+// writes to the Pipeline, e.g. to serve it with v2.NewServer.
+func (p *Pipeline) Receiver() *v2.Receiver {
+	return v2.NewReceiver(p.buffer, p.ingress, p.originMappings)
+}
+
+// Write buffers the envelope. It does not block and never fails.
+func (p *Pipeline) Write(_ context.Context, e *loggregator_v2.Envelope) error {
+	p.buffer.Set(e)
+	p.ingress.Add(1)
+	return nil
+}
+
+// Start starts writing buffered envelopes to the destinations and runs
+// the sources of the plugins. A stopped Pipeline can not be started again.
+func (p *Pipeline) Start() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.started || p.stopped {
+		return
+	}
+	p.started = true
+
+	var ctx context.Context
+	ctx, p.cancel = context.WithCancel(context.Background())
+	p.plugins.Run(ctx, p)
+	go p.run()
+}
+
+// Stop writes the envelopes that are still buffered and stops the
+// Pipeline. If the Pipeline was never started buffered envelopes are
+// dropped.
+func (p *Pipeline) Stop() {
+	p.mu.Lock()
+	if !p.stopped {
+		p.stopped = true
+		p.cancel()
+		close(p.stop)
+		if !p.started {
+			close(p.done)
+		}
+	}
+	p.mu.Unlock()
+
+	<-p.done
+}
+
+func (p *Pipeline) run() {
+	defer close(p.done)
+
+	for {
+		e, ok := p.buffer.TryNext()
+		if ok {
+			p.writer.Write(context.Background(), e) //nolint:errcheck
+			continue
+		}
+
+		select {
+		case <-p.stop:
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package agentlib_test
+
+import (
+	"context"
+	"sync"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/agentlib"
+	egress_v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Pipeline", func() {
+	var (
+		sm   *metricsHelpers.SpyMetricsRegistry
+		dest *spyWriter
+	)
+
+	BeforeEach(func() {
+		sm = metricsHelpers.NewMetricsRegistry()
+		dest = &spyWriter{}
+	})
+
+	It("tags envelopes and writes them to the destinations", func() {
+		other := &spyWriter{}
+		p := agentlib.New(
+			sm,
+			agentlib.WithTags(map[string]string{"deployment": "cf"}),
+			agentlib.WithDestination(dest, egress_v2.Selector{}),
+			agentlib.WithDestination(other, egress_v2.Selector{}),
+		)
+		p.Start()
+		defer p.Stop()
+
+		Expect(p.Write(context.Background(), &loggregator_v2.Envelope{SourceId: "some-source"})).To(Succeed())
+
+		for _, w := range []*spyWriter{dest, other} {
+			Eventually(w.Envelopes).Should(ConsistOf(SatisfyAll(
+				HaveField("SourceId", "some-source"),
+				HaveField("Tags", HaveKeyWithValue("deployment", "cf")),
+			)))
+		}
+		Expect(sm.GetMetric("ingress", nil).Value()).To(Equal(1.0))
+	})
+
+	It("only writes the selected envelopes to a destination", func() {
+		p := agentlib.New(
+			sm,
+			agentlib.WithDestination(dest, egress_v2.Selector{SourceIDPrefix: "selected"}),
+		)
+		p.Start()
+		defer p.Stop()
+
+		_ = p.Write(context.Background(), &loggregator_v2.Envelope{SourceId: "other"})
+		_ = p.Write(context.Background(), &loggregator_v2.Envelope{SourceId: "selected"})
+
+		Eventually(dest.Envelopes).Should(ConsistOf(HaveField("SourceId", "selected")))
+	})
+
+	It("aggregates counter totals", func() {
+		p := agentlib.New(sm, agentlib.WithDestination(dest, egress_v2.Selector{}))
+		p.Start()
+		defer p.Stop()
+
+		for i := 0; i < 2; i++ {
+			_ = p.Write(context.Background(), &loggregator_v2.Envelope{
+				SourceId: "some-source",
+				Message: &loggregator_v2.Envelope_Counter{
+					Counter: &loggregator_v2.Counter{Name: "some-counter", Delta: 5},
+				},
+			})
+		}
+
+		Eventually(func() uint64 {
+			envs := dest.Envelopes()
+			if len(envs) < 2 {
+				return 0
+			}
+			return envs[1].GetCounter().GetTotal()
+		}).Should(Equal(uint64(10)))
+	})
+
+	It("truncates tags over the max tag size", func() {
+		p := agentlib.New(
+			sm,
+			agentlib.WithMaxTagBytes(10),
+			agentlib.WithDestination(dest, egress_v2.Selector{}),
+		)
+		p.Start()
+		defer p.Stop()
+
+		_ = p.Write(context.Background(), &loggregator_v2.Envelope{
+			Tags: map[string]string{"some-tag": "some-long-tag-value"},
+		})
+
+		Eventually(dest.Envelopes).Should(HaveLen(1))
+		Expect(sm.GetMetric("tags_truncated", nil).Value()).To(Equal(1.0))
+	})
+
+	It("writes envelopes received with the ingress API", func() {
+		p := agentlib.New(sm, agentlib.WithDestination(dest, egress_v2.Selector{}))
+		p.Start()
+		defer p.Stop()
+
+		_, err := p.Receiver().Send(context.Background(), &loggregator_v2.EnvelopeBatch{
+			Batch: []*loggregator_v2.Envelope{{SourceId: "some-source"}},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		Eventually(dest.Envelopes).Should(ConsistOf(HaveField("SourceId", "some-source")))
+	})
+
+	It("writes the buffered envelopes when stopped", func() {
+		p := agentlib.New(sm, agentlib.WithDestination(dest, egress_v2.Selector{}))
+		for i := 0; i < 100; i++ {
+			_ = p.Write(context.Background(), &loggregator_v2.Envelope{SourceId: "some-source"})
+		}
+
+		p.Start()
+		p.Stop()
+
+		Expect(dest.Envelopes()).To(HaveLen(100))
+	})
+
+	It("does not block when stopped without being started", func() {
+		p := agentlib.New(sm, agentlib.WithDestination(dest, egress_v2.Selector{}))
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			p.Stop()
+			p.Stop()
+		}()
+		Eventually(done).Should(BeClosed())
+
+		p.Start()
+		_ = p.Write(context.Background(), &loggregator_v2.Envelope{SourceId: "some-source"})
+		Consistently(dest.Envelopes).Should(BeEmpty())
+	})
+
+	It("uses the default buffer size for sizes that are not positive", func() {
+		p := agentlib.New(
+			sm,
+			agentlib.WithBufferSize(0),
+			agentlib.WithDestination(dest, egress_v2.Selector{}),
+		)
+		p.Start()
+		defer p.Stop()
+
+		Expect(p.Write(context.Background(), &loggregator_v2.Envelope{SourceId: "some-source"})).To(Succeed())
+		Eventually(dest.Envelopes).Should(HaveLen(1))
+	})
+})
+
+type spyWriter struct {
+	mu        sync.Mutex
+	envelopes []*loggregator_v2.Envelope
+}
+
+func (s *spyWriter) Write(_ context.Context, e *loggregator_v2.Envelope) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.envelopes = append(s.envelopes, e)
+	return nil
+}
+
+func (s *spyWriter) Envelopes() []*loggregator_v2.Envelope {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*loggregator_v2.Envelope(nil), s.envelopes...)
+}
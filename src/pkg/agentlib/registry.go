@@ -0,0 +1,208 @@
+package agentlib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+
+	egress_v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
+)
+
+// Source produces envelopes, e.g. by reading them from a file or a
+// socket, and writes them to w until ctx is done.
+type Source interface {
+	Run(ctx context.Context, w egress_v2.Writer)
+}
+
+// Processor modifies envelopes after they are tagged and before they are
+// written to the sinks.
+type Processor interface {
+	Process(e *loggregator_v2.Envelope)
+}
+
+// SourceFactory creates a Source from the options of its configuration.
+type SourceFactory func(opts map[string]string, m MetricClient, l *log.Logger) (Source, error)
+
+// ProcessorFactory creates a Processor from the options of its
+// configuration.
+type ProcessorFactory func(opts map[string]string, m MetricClient, l *log.Logger) (Processor, error)
+
+// SinkFactory creates a sink from the options of its configuration. Sinks
+// are written to sequentially, so slow sinks should buffer writes, e.g.
+// with egress.NewDiodeWriter.
+type SinkFactory func(opts map[string]string, m MetricClient, l *log.Logger) (egress_v2.Writer, error)
+
+var registry = struct {
+	sync.RWMutex
+	sources    map[string]SourceFactory
+	processors map[string]ProcessorFactory
+	sinks      map[string]SinkFactory
+}{
+	sources:    make(map[string]SourceFactory),
+	processors: make(map[string]ProcessorFactory),
+	sinks:      make(map[string]SinkFactory),
+}
+
+// RegisterSource makes a source available by name. It is meant to be
+// called from the init function of the package implementing the source,
+// so that linking the package is enough to use the source in the
+// configuration. It panics if the name is already registered.
+func RegisterSource(name string, f SourceFactory) {
+	registry.Lock()
+	defer registry.Unlock()
+	if _, ok := registry.sources[name]; ok {
+		panic(fmt.Sprintf("agentlib: source %q registered twice", name))
+	}
+	registry.sources[name] = f
+}
+
+// RegisterProcessor makes a processor available by name. It panics if the
+// name is already registered.
+func RegisterProcessor(name string, f ProcessorFactory) {
+	registry.Lock()
+	defer registry.Unlock()
+	if _, ok := registry.processors[name]; ok {
+		panic(fmt.Sprintf("agentlib: processor %q registered twice", name))
+	}
+	registry.processors[name] = f
+}
+
+// RegisterSink makes a sink available by name. It panics if the name is
+// already registered.
+func RegisterSink(name string, f SinkFactory) {
+	registry.Lock()
+	defer registry.Unlock()
+	if _, ok := registry.sinks[name]; ok {
+		panic(fmt.Sprintf("agentlib: sink %q registered twice", name))
+	}
+	registry.sinks[name] = f
+}
+
+// Registered returns the sorted names of the registered sources,
+// processors and sinks.
+func Registered() (sources, processors, sinks []string) {
+	registry.RLock()
+	defer registry.RUnlock()
+	for name := range registry.sources {
+		sources = append(sources, name)
+	}
+	for name := range registry.processors {
+		processors = append(processors, name)
+	}
+	for name := range registry.sinks {
+		sinks = append(sinks, name)
+	}
+	sort.Strings(sources)
+	sort.Strings(processors)
+	sort.Strings(sinks)
+	return sources, processors, sinks
+}
+
+// PluginConfig names a registered source, processor or sink and the
+// options it is created with.
+type PluginConfig struct {
+	// Type is source, processor or sink.
+	Type    string            `json:"type"`
+	Name    string            `json:"name"`
+	Options map[string]string `json:"options,omitempty"`
+}
+
+// PluginConfigs configures the plugins of an agent.
+type PluginConfigs []PluginConfig
+
+// UnmarshalEnv implements envstruct.Unmarshaller.
+// Example input:
+// [{"type":"sink","name":"kafka","options":{"brokers":"10.0.0.1:9092"}}]
+func (c *PluginConfigs) UnmarshalEnv(v string) error {
+	if v == "" {
+		return nil
+	}
+
+	var configs []PluginConfig
+	if err := json.Unmarshal([]byte(v), &configs); err != nil {
+		return fmt.Errorf("invalid plugins: %s", err)
+	}
+	for _, pc := range configs {
+		if pc.Type != "source" && pc.Type != "processor" && pc.Type != "sink" {
+			return fmt.Errorf("unknown plugin type %q of plugin %q", pc.Type, pc.Name)
+		}
+	}
+	*c = configs
+
+	return nil
+}
+
+// Plugins are the sources, processors and sinks created from
+// PluginConfigs.
+type Plugins struct {
+	Sources    []Source
+	Processors []Processor
+	Sinks      []egress_v2.Writer
+}
+
+// Build creates the configured plugins with the registered factories. It
+// fails if a plugin is not registered or its factory fails.
+func (c PluginConfigs) Build(m MetricClient, l *log.Logger) (Plugins, error) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	var p Plugins
+	for _, pc := range c {
+		var err error
+		switch pc.Type {
+		case "source":
+			f, ok := registry.sources[pc.Name]
+			if !ok {
+				return Plugins{}, fmt.Errorf("unknown source %q", pc.Name)
+			}
+			var s Source
+			if s, err = f(pc.Options, m, l); err == nil {
+				p.Sources = append(p.Sources, s)
+			}
+		case "processor":
+			f, ok := registry.processors[pc.Name]
+			if !ok {
+				return Plugins{}, fmt.Errorf("unknown processor %q", pc.Name)
+			}
+			var pr Processor
+			if pr, err = f(pc.Options, m, l); err == nil {
+				p.Processors = append(p.Processors, pr)
+			}
+		case "sink":
+			f, ok := registry.sinks[pc.Name]
+			if !ok {
+				return Plugins{}, fmt.Errorf("unknown sink %q", pc.Name)
+			}
+			var w egress_v2.Writer
+			if w, err = f(pc.Options, m, l); err == nil {
+				p.Sinks = append(p.Sinks, w)
+			}
+		default:
+			return Plugins{}, fmt.Errorf("unknown plugin type %q of plugin %q", pc.Type, pc.Name)
+		}
+		if err != nil {
+			return Plugins{}, fmt.Errorf("failed to create %s %q: %s", pc.Type, pc.Name, err)
+		}
+	}
+
+	return p, nil
+}
+
+// Process applies the processors to the envelope in order.
+func (p Plugins) Process(e *loggregator_v2.Envelope) {
+	for _, pr := range p.Processors {
+		pr.Process(e)
+	}
+}
+
+// Run runs the sources until ctx is done. Each source writes to w.
+func (p Plugins) Run(ctx context.Context, w egress_v2.Writer) {
+	for _, s := range p.Sources {
+		go s.Run(ctx, w)
+	}
+}
@@ -0,0 +1,111 @@
+package agentlib_test
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/agentlib"
+	egress_v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var testSink = &spyWriter{}
+
+func init() {
+	agentlib.RegisterSource("test-source", func(opts map[string]string, _ agentlib.MetricClient, _ *log.Logger) (agentlib.Source, error) {
+		return sourceFunc(func(ctx context.Context, w egress_v2.Writer) {
+			_ = w.Write(ctx, &loggregator_v2.Envelope{SourceId: opts["source_id"]})
+		}), nil
+	})
+	agentlib.RegisterProcessor("test-processor", func(opts map[string]string, _ agentlib.MetricClient, _ *log.Logger) (agentlib.Processor, error) {
+		return processorFunc(func(e *loggregator_v2.Envelope) {
+			if e.Tags == nil {
+				e.Tags = make(map[string]string)
+			}
+			e.Tags["processed"] = opts["value"]
+		}), nil
+	})
+	agentlib.RegisterSink("test-sink", func(map[string]string, agentlib.MetricClient, *log.Logger) (egress_v2.Writer, error) {
+		return testSink, nil
+	})
+	agentlib.RegisterSink("failing-sink", func(map[string]string, agentlib.MetricClient, *log.Logger) (egress_v2.Writer, error) {
+		return nil, errors.New("some-error")
+	})
+}
+
+var _ = Describe("Registry", func() {
+	var (
+		sm     *metricsHelpers.SpyMetricsRegistry
+		logger *log.Logger
+	)
+
+	BeforeEach(func() {
+		sm = metricsHelpers.NewMetricsRegistry()
+		logger = log.New(GinkgoWriter, "", 0)
+	})
+
+	It("runs the configured plugins in a pipeline", func() {
+		var configs agentlib.PluginConfigs
+		Expect(configs.UnmarshalEnv(`[
+			{"type":"source","name":"test-source","options":{"source_id":"some-source"}},
+			{"type":"processor","name":"test-processor","options":{"value":"some-value"}},
+			{"type":"sink","name":"test-sink"}
+		]`)).To(Succeed())
+		plugins, err := configs.Build(sm, logger)
+		Expect(err).ToNot(HaveOccurred())
+
+		p := agentlib.New(sm, agentlib.WithPlugins(plugins))
+		p.Start()
+		defer p.Stop()
+
+		Eventually(testSink.Envelopes).Should(ContainElement(SatisfyAll(
+			HaveField("SourceId", "some-source"),
+			HaveField("Tags", HaveKeyWithValue("processed", "some-value")),
+		)))
+	})
+
+	It("lists the registered plugins", func() {
+		sources, processors, sinks := agentlib.Registered()
+
+		Expect(sources).To(Equal([]string{"test-source"}))
+		Expect(processors).To(Equal([]string{"test-processor"}))
+		Expect(sinks).To(Equal([]string{"failing-sink", "test-sink"}))
+	})
+
+	It("panics when a name is registered twice", func() {
+		Expect(func() {
+			agentlib.RegisterSink("test-sink", nil)
+		}).To(Panic())
+	})
+
+	It("fails to build unknown plugins", func() {
+		_, err := agentlib.PluginConfigs{{Type: "sink", Name: "unknown"}}.Build(sm, logger)
+
+		Expect(err).To(MatchError(`unknown sink "unknown"`))
+	})
+
+	It("fails to build plugins whose factory fails", func() {
+		_, err := agentlib.PluginConfigs{{Type: "sink", Name: "failing-sink"}}.Build(sm, logger)
+
+		Expect(err).To(MatchError(`failed to create sink "failing-sink": some-error`))
+	})
+
+	It("rejects unknown plugin types", func() {
+		var configs agentlib.PluginConfigs
+
+		Expect(configs.UnmarshalEnv(`[{"type":"other","name":"test-sink"}]`)).ToNot(Succeed())
+	})
+})
+
+type sourceFunc func(context.Context, egress_v2.Writer)
+
+func (f sourceFunc) Run(ctx context.Context, w egress_v2.Writer) { f(ctx, w) }
+
+type processorFunc func(*loggregator_v2.Envelope)
+
+func (f processorFunc) Process(e *loggregator_v2.Envelope) { f(e) }
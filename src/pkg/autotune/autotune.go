@@ -0,0 +1,131 @@
+// Package autotune sizes the worker pools, buffers and batches of the
+// agents by the CPUs available to them instead of hard-coded defaults that
+// are too large for tiny cells and too small for huge ones.
+package autotune
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// CgroupRoot is where the cgroup filesystem of the process is mounted.
+const CgroupRoot = "/sys/fs/cgroup"
+
+// The settings scale linearly with the CPUs and match the former defaults
+// at baselineCPUs.
+const (
+	baselineCPUs = 4
+
+	diodeSizePerCPU = 2500
+	minDiodeSize    = 2500
+	maxDiodeSize    = 50000
+
+	batchSizePerCPU = 25
+	minBatchSize    = 100
+	maxBatchSize    = 1000
+)
+
+// Settings are the sizes chosen for the CPUs available to an agent.
+type Settings struct {
+	// CPUs available to the agent.
+	CPUs int
+	// Quota is whether CPUs is limited by a cgroup CPU quota.
+	Quota bool
+	// Workers is the number of goroutines of worker pools.
+	Workers int
+	// DiodeSize is the number of envelopes of ingress diodes.
+	DiodeSize int
+	// BatchSize is the number of envelopes of egress batches.
+	BatchSize int
+}
+
+// Detect returns the settings for the CPUs available to the process: the
+// CPU quota of its cgroup rounded up, or the number of CPUs of the host if
+// it has no quota.
+func Detect() Settings {
+	cpus := runtime.NumCPU()
+	quota, ok := CPUQuota(CgroupRoot)
+	if !ok || int(math.Ceil(quota)) >= cpus {
+		return ForCPUs(cpus)
+	}
+
+	s := ForCPUs(int(math.Ceil(quota)))
+	s.Quota = true
+	return s
+}
+
+// ForCPUs returns the settings for the given number of CPUs.
+func ForCPUs(cpus int) Settings {
+	cpus = max(cpus, 1)
+	return Settings{
+		CPUs:      cpus,
+		Workers:   cpus,
+		DiodeSize: min(max(cpus*diodeSizePerCPU, minDiodeSize), maxDiodeSize),
+		BatchSize: min(max(cpus*batchSizePerCPU, minBatchSize), maxBatchSize),
+	}
+}
+
+// SetGOMAXPROCS limits the goroutines running at once to the CPUs unless
+// the GOMAXPROCS environment variable is set.
+func (s Settings) SetGOMAXPROCS() {
+	if os.Getenv("GOMAXPROCS") != "" {
+		return
+	}
+	runtime.GOMAXPROCS(s.CPUs)
+}
+
+func (s Settings) String() string {
+	source := "host"
+	if s.Quota {
+		source = "cgroup quota"
+	}
+	return fmt.Sprintf(
+		"%d CPUs (%s): workers %d, diode size %d, batch size %d",
+		s.CPUs, source, s.Workers, s.DiodeSize, s.BatchSize,
+	)
+}
+
+// CPUQuota returns the CPU quota of the cgroup mounted at root in CPUs. It
+// reads cpu.max of cgroups v2 and falls back to cpu.cfs_quota_us and
+// cpu.cfs_period_us of cgroups v1. It returns false if the cgroup has no
+// quota or it cannot be read.
+func CPUQuota(root string) (float64, bool) {
+	if b, err := os.ReadFile(filepath.Join(root, "cpu.max")); err == nil {
+		fields := strings.Fields(string(b))
+		if len(fields) != 2 || fields[0] == "max" {
+			return 0, false
+		}
+		return quota(fields[0], fields[1])
+	}
+
+	for _, dir := range []string{"cpu", "cpu,cpuacct"} {
+		q, err := os.ReadFile(filepath.Join(root, dir, "cpu.cfs_quota_us"))
+		if err != nil {
+			continue
+		}
+		p, err := os.ReadFile(filepath.Join(root, dir, "cpu.cfs_period_us"))
+		if err != nil {
+			return 0, false
+		}
+		return quota(strings.TrimSpace(string(q)), strings.TrimSpace(string(p)))
+	}
+
+	return 0, false
+}
+
+func quota(quota, period string) (float64, bool) {
+	q, err := strconv.ParseFloat(quota, 64)
+	if err != nil || q <= 0 {
+		return 0, false
+	}
+	p, err := strconv.ParseFloat(period, 64)
+	if err != nil || p <= 0 {
+		return 0, false
+	}
+	return q / p, true
+}
@@ -0,0 +1,13 @@
+package autotune_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestAutotune(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Autotune Suite")
+}
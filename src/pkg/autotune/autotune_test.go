@@ -0,0 +1,82 @@
+package autotune_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/autotune"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Autotune", func() {
+	var root string
+
+	BeforeEach(func() {
+		root = GinkgoT().TempDir()
+	})
+
+	writeFile := func(name, contents string) {
+		path := filepath.Join(root, name)
+		Expect(os.MkdirAll(filepath.Dir(path), 0700)).To(Succeed())
+		Expect(os.WriteFile(path, []byte(contents), 0600)).To(Succeed())
+	}
+
+	Describe("CPUQuota", func() {
+		It("reads the quota of cgroups v2", func() {
+			writeFile("cpu.max", "150000 100000\n")
+
+			quota, ok := autotune.CPUQuota(root)
+			Expect(ok).To(BeTrue())
+			Expect(quota).To(Equal(1.5))
+		})
+
+		It("reads the quota of cgroups v1", func() {
+			writeFile("cpu,cpuacct/cpu.cfs_quota_us", "200000\n")
+			writeFile("cpu,cpuacct/cpu.cfs_period_us", "100000\n")
+
+			quota, ok := autotune.CPUQuota(root)
+			Expect(ok).To(BeTrue())
+			Expect(quota).To(Equal(2.0))
+		})
+
+		It("reports cgroups without a quota", func() {
+			writeFile("cpu.max", "max 100000\n")
+			_, ok := autotune.CPUQuota(root)
+			Expect(ok).To(BeFalse())
+
+			root = GinkgoT().TempDir()
+			writeFile("cpu/cpu.cfs_quota_us", "-1\n")
+			writeFile("cpu/cpu.cfs_period_us", "100000\n")
+			_, ok = autotune.CPUQuota(root)
+			Expect(ok).To(BeFalse())
+
+			_, ok = autotune.CPUQuota(GinkgoT().TempDir())
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	Describe("ForCPUs", func() {
+		It("matches the former defaults at 4 CPUs", func() {
+			Expect(autotune.ForCPUs(4)).To(Equal(autotune.Settings{
+				CPUs:      4,
+				Workers:   4,
+				DiodeSize: 10000,
+				BatchSize: 100,
+			}))
+		})
+
+		It("scales the settings within bounds", func() {
+			small := autotune.ForCPUs(0)
+			Expect(small.CPUs).To(Equal(1))
+			Expect(small.DiodeSize).To(Equal(2500))
+			Expect(small.BatchSize).To(Equal(100))
+
+			large := autotune.ForCPUs(64)
+			Expect(large.Workers).To(Equal(64))
+			Expect(large.DiodeSize).To(Equal(50000))
+			Expect(large.BatchSize).To(Equal(1000))
+		})
+	})
+})
@@ -0,0 +1,218 @@
+// Package client is a client for the syslog binding cache API.
+//
+// The binding cache serves the syslog drain bindings of all apps at
+// /v2/bindings and the aggregate drains at /v2/aggregate. Both endpoints
+// require mutual TLS:
+//
+//	c, err := client.NewMTLS(
+//		"https://binding-cache:9000",
+//		"client.crt", "client.key", "ca.crt", "binding-cache",
+//		client.WithRetries(3, time.Second),
+//	)
+//	if err != nil {
+//		return err
+//	}
+//	bindings, err := c.Bindings(ctx)
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"code.cloudfoundry.org/tlsconfig"
+
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/binding"
+)
+
+// Binding is a syslog drain URL and the apps bound to it along with the
+// credentials used to connect to the drain.
+type Binding = binding.Binding
+
+// Doer sends HTTP requests. *http.Client implements Doer.
+type Doer interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+// StatusError is returned when the binding cache responds with a status
+// other than 200 OK.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e StatusError) Error() string {
+	return fmt.Sprintf("unexpected http response from binding cache: %d", e.StatusCode)
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sets the client used to send requests. Defaults to
+// http.DefaultClient.
+func WithHTTPClient(d Doer) Option {
+	return func(c *Client) {
+		c.doer = d
+	}
+}
+
+// WithRetries retries failed requests up to n times, waiting backoff
+// before the first retry and doubling the wait for every further retry.
+// Requests are not retried when the binding cache responds with a client
+// error. Defaults to no retries.
+func WithRetries(n int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = n
+		c.backoff = backoff
+	}
+}
+
+// WithPageSize fetches bindings in pages of the given size rather than in
+// a single response. Zero disables paging.
+func WithPageSize(n int) Option {
+	return func(c *Client) {
+		c.pageSize = n
+	}
+}
+
+// Client fetches bindings from a binding cache.
+type Client struct {
+	addr     string
+	doer     Doer
+	retries  int
+	backoff  time.Duration
+	pageSize int
+}
+
+// New returns a Client for the binding cache at addr, e.g.
+// https://binding-cache:9000.
+func New(addr string, opts ...Option) *Client {
+	c := &Client{
+		addr: addr,
+		doer: http.DefaultClient,
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	return c
+}
+
+// NewMTLS returns a Client that authenticates to the binding cache at addr
+// with the given client certificate and verifies the cache certificate
+// against the CA and common name.
+func NewMTLS(addr, certFile, keyFile, caFile, commonName string, opts ...Option) (*Client, error) {
+	tlsConfig, err := tlsconfig.Build(
+		tlsconfig.WithInternalServiceDefaults(),
+		tlsconfig.WithIdentityFromFile(certFile, keyFile),
+	).Client(
+		tlsconfig.WithAuthorityFromFile(caFile),
+		tlsconfig.WithServerName(commonName),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load binding cache client certificates: %w", err)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	h := &http.Client{Transport: transport}
+
+	return New(addr, append([]Option{WithHTTPClient(h)}, opts...)...), nil
+}
+
+// Bindings returns the syslog drain bindings of all apps.
+func (c *Client) Bindings(ctx context.Context) ([]Binding, error) {
+	return c.fetch(ctx, "v2/bindings")
+}
+
+// Aggregate returns the aggregate drains which receive the logs of all
+// apps.
+func (c *Client) Aggregate(ctx context.Context) ([]Binding, error) {
+	return c.fetch(ctx, "v2/aggregate")
+}
+
+// Get returns the syslog drain bindings of all apps.
+func (c *Client) Get() ([]Binding, error) {
+	return c.Bindings(context.Background())
+}
+
+// GetAggregate returns the aggregate drains.
+func (c *Client) GetAggregate() ([]Binding, error) {
+	return c.Aggregate(context.Background())
+}
+
+func (c *Client) fetch(ctx context.Context, path string) ([]Binding, error) {
+	u := fmt.Sprintf("%s/%s", c.addr, path)
+	if c.pageSize <= 0 {
+		return c.getWithRetries(ctx, u)
+	}
+
+	bindings := []Binding{}
+	for offset := 0; ; offset += c.pageSize {
+		q := url.Values{}
+		q.Set("limit", strconv.Itoa(c.pageSize))
+		q.Set("offset", strconv.Itoa(offset))
+		page, err := c.getWithRetries(ctx, u+"?"+q.Encode())
+		if err != nil {
+			return nil, err
+		}
+		bindings = append(bindings, page...)
+		if len(page) < c.pageSize {
+			return bindings, nil
+		}
+	}
+}
+
+func (c *Client) getWithRetries(ctx context.Context, u string) ([]Binding, error) {
+	backoff := c.backoff
+	for attempt := 0; ; attempt++ {
+		bindings, err := c.get(ctx, u)
+		if err == nil || attempt >= c.retries || !retryable(err) {
+			return bindings, err
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+func (c *Client) get(ctx context.Context, u string) ([]Binding, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.doer.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, StatusError{StatusCode: resp.StatusCode}
+	}
+
+	var bindings []Binding
+	err = json.NewDecoder(resp.Body).Decode(&bindings)
+	if err != nil {
+		return nil, err
+	}
+	return bindings, nil
+}
+
+func retryable(err error) bool {
+	se, ok := err.(StatusError)
+	if !ok {
+		return true
+	}
+	return se.StatusCode >= http.StatusInternalServerError
+}
@@ -0,0 +1,166 @@
+package client_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	"code.cloudfoundry.org/tlsconfig"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/loggregator-agent-release/src/internal/testhelper"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/binding"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/binding/client"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/cache"
+)
+
+var _ = Describe("Client", func() {
+	var (
+		bindings = []binding.Binding{
+			{
+				Url: "syslog://drain-1",
+				Credentials: []binding.Credentials{
+					{Cert: "cert", Key: "key", Apps: []binding.App{{Hostname: "host-1", AppID: "app-id-1"}}},
+				},
+			},
+			{Url: "syslog://drain-2"},
+			{Url: "syslog://drain-3"},
+		}
+		aggregate = []binding.Binding{
+			{Url: "syslog://aggregate", Credentials: []binding.Credentials{{Cert: "cert", Key: "key", CA: "ca"}}},
+		}
+
+		server *httptest.Server
+	)
+
+	BeforeEach(func() {
+		mux := http.NewServeMux()
+		mux.Handle("/v2/bindings", cache.Handler(stubStore(bindings)))
+		mux.Handle("/v2/aggregate", cache.AggregateHandler(stubStore(aggregate)))
+		server = httptest.NewServer(mux)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("returns bindings from the cache", func() {
+		c := client.New(server.URL)
+
+		Expect(c.Bindings(context.Background())).To(Equal(bindings))
+		Expect(c.Get()).To(Equal(bindings))
+	})
+
+	It("returns aggregate drains from the cache", func() {
+		c := client.New(server.URL)
+
+		Expect(c.Aggregate(context.Background())).To(Equal(aggregate))
+		Expect(c.GetAggregate()).To(Equal(aggregate))
+	})
+
+	It("fetches bindings in pages", func() {
+		var requests int64
+		server.Config.Handler = countRequests(&requests, server.Config.Handler)
+		c := client.New(server.URL, client.WithPageSize(2))
+
+		Expect(c.Bindings(context.Background())).To(Equal(bindings))
+		Expect(atomic.LoadInt64(&requests)).To(Equal(int64(2)))
+	})
+
+	It("returns a StatusError if the cache returns a non-OK status code", func() {
+		server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		})
+		c := client.New(server.URL)
+
+		_, err := c.Bindings(context.Background())
+		Expect(err).To(MatchError("unexpected http response from binding cache: 404"))
+		Expect(err).To(BeAssignableToTypeOf(client.StatusError{}))
+	})
+
+	It("retries server errors", func() {
+		var requests int64
+		next := server.Config.Handler
+		server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt64(&requests, 1) <= 2 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+		c := client.New(server.URL, client.WithRetries(2, time.Millisecond))
+
+		Expect(c.Bindings(context.Background())).To(Equal(bindings))
+		Expect(atomic.LoadInt64(&requests)).To(Equal(int64(3)))
+	})
+
+	It("does not retry client errors", func() {
+		var requests int64
+		server.Config.Handler = countRequests(&requests, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		}))
+		c := client.New(server.URL, client.WithRetries(2, time.Millisecond))
+
+		_, err := c.Bindings(context.Background())
+		Expect(err).To(MatchError(client.StatusError{StatusCode: http.StatusForbidden}))
+		Expect(atomic.LoadInt64(&requests)).To(Equal(int64(1)))
+	})
+
+	It("stops retrying when the context is done", func() {
+		server.Close()
+		c := client.New(server.URL, client.WithRetries(5, time.Minute))
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		_, err := c.Bindings(ctx)
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+	})
+
+	It("authenticates with mutual TLS", func() {
+		testCerts := testhelper.GenerateCerts("binding-cache-ca")
+		tlsConfig, err := tlsconfig.Build(
+			tlsconfig.WithInternalServiceDefaults(),
+			tlsconfig.WithIdentityFromFile(testCerts.Cert("binding-cache"), testCerts.Key("binding-cache")),
+		).Server(
+			tlsconfig.WithClientAuthenticationFromFile(testCerts.CA()),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		tlsServer := httptest.NewUnstartedServer(server.Config.Handler)
+		tlsServer.TLS = tlsConfig
+		tlsServer.StartTLS()
+		defer tlsServer.Close()
+
+		c, err := client.NewMTLS(
+			tlsServer.URL,
+			testCerts.Cert("syslog-agent"),
+			testCerts.Key("syslog-agent"),
+			testCerts.CA(),
+			"binding-cache",
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(c.Bindings(context.Background())).To(Equal(bindings))
+	})
+
+	It("returns an error if the certificates cannot be loaded", func() {
+		_, err := client.NewMTLS(server.URL, "missing.crt", "missing.key", "missing.ca", "binding-cache")
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+type stubStore []binding.Binding
+
+func (s stubStore) Get() []binding.Binding {
+	return s
+}
+
+func countRequests(n *int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(n, 1)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,176 @@
+package binding
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	metrics "code.cloudfoundry.org/go-metric-registry"
+
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
+)
+
+// dryRunWorkers is the number of drains probed concurrently.
+const dryRunWorkers = 16
+
+// DryRunResult is the outcome of probing the drain of a binding.
+type DryRunResult struct {
+	AppID     string    `json:"app_id,omitempty"`
+	Drain     string    `json:"drain"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// DryRunner fetches bindings and probes their drains on an interval
+// without creating writers, so drain configuration can be verified without
+// sending app data.
+type DryRunner struct {
+	bf       Fetcher
+	af       Fetcher
+	prober   Prober
+	interval time.Duration
+	log      *log.Logger
+
+	reachable   metrics.Gauge
+	unreachable metrics.Gauge
+
+	mu      sync.Mutex
+	results []DryRunResult
+}
+
+// NewDryRunner returns a DryRunner for the app and aggregate bindings of
+// the given fetchers. Either fetcher may be nil.
+func NewDryRunner(
+	bf Fetcher,
+	af Fetcher,
+	p Prober,
+	m Metrics,
+	interval time.Duration,
+	log *log.Logger,
+) *DryRunner {
+	return &DryRunner{
+		bf:       bf,
+		af:       af,
+		prober:   p,
+		interval: interval,
+		log:      log,
+		reachable: m.NewGauge(
+			"dry_run_drains",
+			"Number of drains checked in the last dry run by result.",
+			metrics.WithMetricLabels(map[string]string{"unit": "count", "result": "reachable"}),
+		),
+		unreachable: m.NewGauge(
+			"dry_run_drains",
+			"Number of drains checked in the last dry run by result.",
+			metrics.WithMetricLabels(map[string]string{"unit": "count", "result": "unreachable"}),
+		),
+	}
+}
+
+// Run checks the drains immediately and then on every interval. It blocks
+// forever.
+func (d *DryRunner) Run() {
+	d.Check()
+
+	t := time.NewTicker(d.interval)
+	defer t.Stop()
+	for range t.C {
+		d.Check()
+	}
+}
+
+// Check fetches the bindings and probes all of their drains once.
+func (d *DryRunner) Check() {
+	var bindings []syslog.Binding
+	for _, f := range []Fetcher{d.bf, d.af} {
+		if f == nil {
+			continue
+		}
+		bs, err := f.FetchBindings()
+		if err != nil {
+			d.log.Printf("dry run: failed to fetch bindings: %s", err)
+			continue
+		}
+		bindings = append(bindings, bs...)
+	}
+
+	results := make([]DryRunResult, len(bindings))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < dryRunWorkers && i < len(bindings); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range indexes {
+				results[idx] = d.probe(bindings[idx])
+			}
+		}()
+	}
+	for i := range bindings {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	var unreachable int
+	for _, r := range results {
+		if r.Error != "" {
+			unreachable++
+			d.log.Printf("dry run: drain %s for app %q is unreachable: %s", r.Drain, r.AppID, r.Error)
+		}
+	}
+	d.log.Printf("dry run: checked %d drains, %d unreachable", len(results), unreachable)
+	d.reachable.Set(float64(len(results) - unreachable))
+	d.unreachable.Set(float64(unreachable))
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.results = results
+}
+
+func (d *DryRunner) probe(b syslog.Binding) DryRunResult {
+	r := DryRunResult{
+		AppID:     b.AppId,
+		Drain:     anonymize(b.Drain.Url),
+		CheckedAt: time.Now(),
+	}
+	if err := d.prober.Probe(context.Background(), b); err != nil {
+		r.Error = err.Error()
+	}
+	return r
+}
+
+// GetDrains returns no drains so that no app data is sent.
+func (d *DryRunner) GetDrains(string) []egress.Writer {
+	return nil
+}
+
+// Results returns the results of the last check.
+func (d *DryRunner) Results() []DryRunResult {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return append([]DryRunResult(nil), d.results...)
+}
+
+// ServeHTTP serves the results of the last check as JSON.
+func (d *DryRunner) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(d.Results())
+}
+
+// anonymize removes credentials and query parameters from a drain URL.
+func anonymize(drain string) string {
+	u, err := url.Parse(drain)
+	if err != nil {
+		return "<invalid url>"
+	}
+	u.User = nil
+	u.RawQuery = ""
+	return u.String()
+}
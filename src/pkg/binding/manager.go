@@ -2,6 +2,7 @@ package binding
 
 import (
 	"context"
+	"errors"
 	"log"
 	"math/rand"
 	"sync"
@@ -11,6 +12,7 @@ import (
 
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
+	egress_v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
 )
 
 type Fetcher interface {
@@ -18,15 +20,118 @@ type Fetcher interface {
 	DrainLimit() int
 }
 
+type gaugeClient interface {
+	NewGauge(name, helpText string, o ...metrics.MetricOption) metrics.Gauge
+}
+
 type Metrics interface {
 	NewGauge(name, helpText string, o ...metrics.MetricOption) metrics.Gauge
 	NewCounter(name, helpText string, o ...metrics.MetricOption) metrics.Counter
 }
 
+// Phases of a binding refresh reported by the binding_refresh_phase_duration
+// metric.
+const (
+	// PhaseFetch is the request to the binding cache.
+	PhaseFetch = "fetch"
+	// PhaseFilter is the validation of the fetched bindings including DNS
+	// resolution.
+	PhaseFilter = "filter"
+	// PhaseDNS is the time spent resolving drain hosts, summed across the
+	// concurrent filter workers.
+	PhaseDNS = "dns"
+	// PhaseReconcile is the update of the served drains.
+	PhaseReconcile = "reconcile"
+)
+
+// NewPhaseDurationGauge returns the gauge reporting the duration of the
+// phase of the last binding refresh.
+func NewPhaseDurationGauge(m gaugeClient, phase string) metrics.Gauge {
+	return m.NewGauge(
+		"binding_refresh_phase_duration",
+		"Duration in milliseconds of a phase of the last binding refresh.",
+		metrics.WithMetricLabels(map[string]string{"unit": "ms", "phase": phase}),
+	)
+}
+
 type Connector interface {
 	Connect(context.Context, syslog.Binding) (egress.Writer, error)
 }
 
+// Prober checks that the drain of a binding is reachable.
+type Prober interface {
+	Probe(context.Context, syslog.Binding) error
+}
+
+// ManagerOption configures a Manager.
+type ManagerOption func(*Manager)
+
+// WithMaxBindings caps the number of app bindings the Manager serves. When
+// a refresh returns more bindings than the cap, bindings that are already
+// served are kept and the newest bindings are rejected. A max of zero
+// disables the cap.
+func WithMaxBindings(max int) ManagerOption {
+	return func(m *Manager) {
+		m.maxBindings = max
+	}
+}
+
+// WithDrainProbe makes the Manager probe the drain of new app bindings
+// before creating a writer for them. Probes run asynchronously and
+// envelopes are not written to the drain until a probe succeeds. Drains
+// that fail the probe are counted as degraded and probed again after the
+// retry interval, unless the failure is a syslog.PermanentProbeError.
+func WithDrainProbe(p Prober, retryInterval time.Duration) ManagerOption {
+	return func(m *Manager) {
+		m.prober = p
+		m.probeRetryInterval = retryInterval
+	}
+}
+
+// WithWriterWatchdog makes the Manager restart the writers of app drains
+// whose current write has been in progress for longer than deadline, e.g.
+// because of a deadlock. The context of a stalled writer is cancelled and
+// a new writer is created on the next write to the drain. Aggregate drain
+// writers are recreated on every connection refresh and are not watched.
+func WithWriterWatchdog(deadline time.Duration) ManagerOption {
+	return func(m *Manager) {
+		m.watchdogDeadline = deadline
+	}
+}
+
+// WithErrorEvents records binding fetch, drain connection and drain probe
+// errors in e.
+func WithErrorEvents(e *egress.ErrorEvents) ManagerOption {
+	return func(m *Manager) {
+		m.errorEvents = e
+	}
+}
+
+// WithDeliveries forgets the last deliveries of bindings in d when the
+// bindings are removed.
+func WithDeliveries(d *syslog.Deliveries) ManagerOption {
+	return func(m *Manager) {
+		m.deliveries = d
+	}
+}
+
+// WithWriterCollection keeps serving app bindings that are missing from
+// refreshes for the grace period, so that bindings briefly missing from the
+// binding cache keep their writers. Once a missing binding is removed, its
+// writer is given up to flushTimeout to write the envelopes it buffered
+// before it is closed. A grace period of zero removes missing bindings on
+// the next refresh.
+func WithWriterCollection(gracePeriod, flushTimeout time.Duration) ManagerOption {
+	return func(m *Manager) {
+		m.bindingGracePeriod = gracePeriod
+		m.writerFlushTimeout = flushTimeout
+	}
+}
+
+// collectPollInterval is how often the pending envelopes of a collected
+// writer are checked.
+const collectPollInterval = 50 * time.Millisecond
+
 type Manager struct {
 	bf                    Fetcher
 	aggregateDrainFetcher Fetcher
@@ -36,14 +141,34 @@ type Manager struct {
 	pollingInterval                    time.Duration
 	idleTimeout                        time.Duration
 	aggregateConnectionRefreshInterval time.Duration
+	maxBindings                        int
+	prober                             Prober
+	probeRetryInterval                 time.Duration
+	watchdogDeadline                   time.Duration
+	errorEvents                        *egress.ErrorEvents
+	deliveries                         *syslog.Deliveries
+	bindingGracePeriod                 time.Duration
+	writerFlushTimeout                 time.Duration
 
 	drainCountMetric          metrics.Gauge
 	aggregateDrainCountMetric metrics.Gauge
 	activeDrainCountMetric    metrics.Gauge
 	activeDrainCount          int64
+	rejectedBindingsMetric    metrics.Gauge
+	bindingSaturationMetric   metrics.Gauge
+	degradedDrainCountMetric  metrics.Gauge
+	degradedDrainCount        int64
+	reconcilePhaseMetric      metrics.Gauge
+	writerRestartsMetric      metrics.Counter
+	missingBindingsMetric     metrics.Gauge
+	flushedWritersMetric      metrics.Counter
+	expiredWritersMetric      metrics.Counter
 
 	sourceDrainMap    map[string]map[syslog.Binding]drainHolder
 	sourceAccessTimes map[string]time.Time
+	// excludedApps are the apps with a binding that excludes them from
+	// aggregate drains.
+	excludedApps map[string]bool
 
 	log *log.Logger
 	mu  sync.Mutex
@@ -58,6 +183,7 @@ func NewManager(
 	idleTimeout time.Duration,
 	aggregateConnectionRefreshInterval time.Duration,
 	log *log.Logger,
+	opts ...ManagerOption,
 ) *Manager {
 	tagOpt := metrics.WithMetricLabels(map[string]string{"unit": "count"})
 	drainCount := m.NewGauge(
@@ -75,6 +201,42 @@ func NewManager(
 		"Current number of active syslog drains including app and aggregate drains.",
 		tagOpt,
 	)
+	rejectedBindings := m.NewGauge(
+		"rejected_bindings",
+		"Number of syslog drain bindings rejected in the last refresh because the binding limit was reached.",
+		tagOpt,
+	)
+	bindingSaturation := m.NewGauge(
+		"binding_saturation",
+		"Ratio of served syslog drain bindings to the binding limit.",
+		metrics.WithMetricLabels(map[string]string{"unit": "ratio"}),
+	)
+	degradedDrains := m.NewGauge(
+		"degraded_drains",
+		"Current number of syslog drains that failed the drain probe.",
+		tagOpt,
+	)
+	writerRestarts := m.NewCounter(
+		"writer_restarts",
+		"Total number of drain writers restarted because a write stalled.",
+	)
+
+	missingBindings := m.NewGauge(
+		"missing_bindings",
+		"Current number of syslog drain bindings missing from the last refresh that are kept for the grace period.",
+		tagOpt,
+	)
+	collectedWritersHelp := "Total number of writers of removed syslog drain bindings that were closed."
+	flushedWriters := m.NewCounter(
+		"collected_writers",
+		collectedWritersHelp,
+		metrics.WithMetricLabels(map[string]string{"result": "flushed"}),
+	)
+	expiredWriters := m.NewCounter(
+		"collected_writers",
+		collectedWritersHelp,
+		metrics.WithMetricLabels(map[string]string{"result": "expired"}),
+	)
 
 	manager := &Manager{
 		bf:                                 bf,
@@ -86,12 +248,27 @@ func NewManager(
 		drainCountMetric:                   drainCount,
 		aggregateDrainCountMetric:          aggregateDrainCount,
 		activeDrainCountMetric:             activeDrains,
+		rejectedBindingsMetric:             rejectedBindings,
+		bindingSaturationMetric:            bindingSaturation,
+		degradedDrainCountMetric:           degradedDrains,
+		reconcilePhaseMetric:               NewPhaseDurationGauge(m, PhaseReconcile),
+		writerRestartsMetric:               writerRestarts,
+		missingBindingsMetric:              missingBindings,
+		flushedWritersMetric:               flushedWriters,
+		expiredWritersMetric:               expiredWriters,
 		sourceDrainMap:                     make(map[string]map[syslog.Binding]drainHolder),
 		sourceAccessTimes:                  make(map[string]time.Time),
 		log:                                log,
 	}
 
+	for _, o := range opts {
+		o(manager)
+	}
+
 	go manager.idleCleanupLoop()
+	if manager.watchdogDeadline > 0 {
+		go manager.watchdogLoop()
+	}
 
 	return manager
 }
@@ -121,6 +298,7 @@ func (m *Manager) Run() {
 				bindings, err := m.bf.FetchBindings()
 				if err != nil {
 					m.log.Printf("failed to fetch bindings: %s", err)
+					m.errorEvents.Record("binding_fetch", err, "")
 					continue
 				}
 
@@ -135,14 +313,21 @@ func (m *Manager) GetDrains(sourceID string) []egress.Writer {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	m.sourceAccessTimes[sourceID] = time.Now()
+	if _, ok := m.sourceDrainMap[sourceID]; ok {
+		m.sourceAccessTimes[sourceID] = time.Now()
+	}
 	var drains []egress.Writer
 	for binding, drainHolder := range m.sourceDrainMap[sourceID] {
 		// Create drain writer if one does not already exist
 		if drainHolder.drainWriter == nil {
+			if !m.admit(binding, drainHolder) {
+				continue
+			}
+
 			writer, err := m.connector.Connect(drainHolder.ctx, binding)
 			if err != nil {
 				m.log.Printf("failed to create binding: %s", err)
+				m.errorEvents.Record("drain_connect", err, binding.Drain.Url)
 				continue
 			}
 
@@ -155,6 +340,9 @@ func (m *Manager) GetDrains(sourceID string) []egress.Writer {
 		drains = append(drains, drainHolder.drainWriter)
 	}
 
+	if m.excludedApps[sourceID] {
+		return drains
+	}
 	for _, drainHolder := range m.aggregateDrains {
 		drains = append(drains, drainHolder.drainWriter)
 	}
@@ -162,17 +350,100 @@ func (m *Manager) GetDrains(sourceID string) []egress.Writer {
 	return drains
 }
 
-func (m *Manager) updateAppDrains(bindings []syslog.Binding) {
+// Status reports the number of envelopes buffered by the writers of all
+// drains as the queue depth of the drains stage.
+func (m *Manager) Status() egress_v2.StageStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var depth int
+	for _, drains := range m.sourceDrainMap {
+		for _, dh := range drains {
+			depth += pending(dh.drainWriter)
+		}
+	}
+	for _, dh := range m.aggregateDrains {
+		depth += pending(dh.drainWriter)
+	}
+	return egress_v2.StageStatus{QueueDepth: depth}
+}
+
+// admit reports whether a writer may be created for the binding. If a
+// prober is configured and the drain has not passed a probe yet, a probe is
+// started unless one is already running or the drain is waiting for its
+// next probe.
+func (m *Manager) admit(b syslog.Binding, dh drainHolder) bool {
+	if m.prober == nil || dh.probed {
+		return true
+	}
+	if dh.probing || dh.probeFailed || time.Now().Before(dh.nextProbe) {
+		return false
+	}
+
+	dh.probing = true
+	m.sourceDrainMap[b.AppId][b] = dh
+	go m.probe(dh.ctx, b)
+
+	return false
+}
+
+func (m *Manager) probe(ctx context.Context, b syslog.Binding) {
+	err := m.prober.Probe(ctx, b)
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	dh, ok := m.sourceDrainMap[b.AppId][b]
+	if !ok || dh.ctx != ctx {
+		// The binding was removed or reset while it was probed.
+		return
+	}
+
+	dh.probing = false
+	if err != nil {
+		m.errorEvents.Record("drain_probe", err, b.Drain.Url)
+		if errors.As(err, &syslog.PermanentProbeError{}) {
+			m.log.Printf("drain probe failed, not probing again until the binding changes: %s", err)
+			dh.probeFailed = true
+		} else {
+			m.log.Printf("drain probe failed: %s", err)
+			dh.nextProbe = time.Now().Add(m.probeRetryInterval)
+		}
+		if !dh.degraded {
+			dh.degraded = true
+			m.updateDegradedDrainCount(1)
+		}
+	} else {
+		dh.probed = true
+		if dh.degraded {
+			dh.degraded = false
+			m.updateDegradedDrainCount(-1)
+		}
+	}
+	m.sourceDrainMap[b.AppId][b] = dh
+}
+
+func (m *Manager) updateAppDrains(bindings []syslog.Binding) {
+	start := time.Now()
+	m.mu.Lock()
+	defer func() {
+		m.mu.Unlock()
+		m.reconcilePhaseMetric.Set(float64(time.Since(start)) / float64(time.Millisecond))
+	}()
+
+	m.excludedApps = excludedApps(bindings)
+	bindings = m.limitBindings(bindings)
 	newBindings := make(map[syslog.Binding]bool)
 
 	for _, b := range bindings {
 		newBindings[b] = true
 
-		_, ok := m.sourceDrainMap[b.AppId][b]
+		dh, ok := m.sourceDrainMap[b.AppId][b]
 		if ok {
+			if !dh.missingSince.IsZero() {
+				dh.missingSince = time.Time{}
+				m.sourceDrainMap[b.AppId][b] = dh
+			}
 			continue
 		}
 
@@ -184,17 +455,83 @@ func (m *Manager) updateAppDrains(bindings []syslog.Binding) {
 		m.sourceDrainMap[b.AppId][b] = newDrainHolder()
 	}
 
-	// Delete all bindings that are not in updated list of bindings.
+	// Delete all bindings that have been missing from the updated list of
+	// bindings for longer than the grace period.
 	// TODO: this is not optimal, consider lazily storing bindings
+	var missing int
 	for _, bindingWriterMap := range m.sourceDrainMap {
-		for b := range bindingWriterMap {
+		for b, dh := range bindingWriterMap {
 			if newBindings[b] {
 				continue
 			}
 
+			if dh.missingSince.IsZero() {
+				dh.missingSince = start
+				bindingWriterMap[b] = dh
+			}
+			if start.Sub(dh.missingSince) < m.bindingGracePeriod {
+				missing++
+				continue
+			}
+
 			m.removeDrain(bindingWriterMap, b)
 		}
 	}
+	m.missingBindingsMetric.Set(float64(missing))
+}
+
+// excludedApps returns the apps with a binding whose metadata excludes
+// them from aggregate drains. Bindings rejected by the binding limit still
+// exclude their app.
+func excludedApps(bindings []syslog.Binding) map[string]bool {
+	var apps map[string]bool
+	for _, b := range bindings {
+		v, ok := b.Drain.Metadata.Get(syslog.DrainExcludeKey)
+		if !ok || !syslog.ExcludedFromAggregate(v) {
+			continue
+		}
+		if apps == nil {
+			apps = make(map[string]bool)
+		}
+		apps[b.AppId] = true
+	}
+	return apps
+}
+
+// limitBindings applies the binding limit. Bindings that are already served
+// take precedence over new bindings so that a flood of new bindings cannot
+// displace existing drains.
+func (m *Manager) limitBindings(bindings []syslog.Binding) []syslog.Binding {
+	if m.maxBindings <= 0 {
+		return bindings
+	}
+
+	if len(bindings) > m.maxBindings {
+		limited := make([]syslog.Binding, 0, m.maxBindings)
+		var newest []syslog.Binding
+		for _, b := range bindings {
+			if _, ok := m.sourceDrainMap[b.AppId][b]; ok && len(limited) < m.maxBindings {
+				limited = append(limited, b)
+				continue
+			}
+			newest = append(newest, b)
+		}
+		for _, b := range newest {
+			if len(limited) == m.maxBindings {
+				break
+			}
+			limited = append(limited, b)
+		}
+
+		m.log.Printf("binding limit of %d reached, rejected %d bindings", m.maxBindings, len(bindings)-len(limited))
+		m.rejectedBindingsMetric.Set(float64(len(bindings) - len(limited)))
+		bindings = limited
+	} else {
+		m.rejectedBindingsMetric.Set(0)
+	}
+
+	m.bindingSaturationMetric.Set(float64(len(bindings)) / float64(m.maxBindings))
+	return bindings
 }
 
 func (m *Manager) resetAggregateDrains() {
@@ -202,6 +539,7 @@ func (m *Manager) resetAggregateDrains() {
 	bindings, err := m.aggregateDrainFetcher.FetchBindings()
 	if err != nil {
 		m.log.Printf("failed to connect to cache for aggregate drains: %s", err)
+		m.errorEvents.Record("binding_fetch", err, "")
 		return
 	}
 
@@ -211,6 +549,7 @@ func (m *Manager) resetAggregateDrains() {
 		writer, err := m.connector.Connect(aggregateDrainHolder.ctx, b)
 		if err != nil {
 			m.log.Printf("failed to connect to aggregate drain %s: %s", b.Drain, err)
+			m.errorEvents.Record("drain_connect", err, b.Drain.Url)
 			aggregateDrainHolder.cancel()
 			continue
 		}
@@ -230,16 +569,23 @@ func (m *Manager) removeDrain(
 	bindingWriterMap map[syslog.Binding]drainHolder,
 	b syslog.Binding,
 ) {
-	var active bool
-	if bindingWriterMap[b].drainWriter != nil {
-		active = true
+	dh := bindingWriterMap[b]
+	active := dh.drainWriter != nil
+	if dh.degraded {
+		m.updateDegradedDrainCount(-1)
 	}
 
-	bindingWriterMap[b].cancel()
+	if active && m.writerFlushTimeout > 0 {
+		go m.collectWriter(dh)
+	} else {
+		m.closeCollectedWriter(dh)
+	}
 	delete(bindingWriterMap, b)
+	m.deliveries.Forget(b.AppId, b.Drain.Url)
 	if len(bindingWriterMap) == 0 {
 		// Prevent memory leak
 		delete(m.sourceDrainMap, b.AppId)
+		delete(m.sourceAccessTimes, b.AppId)
 	}
 
 	if active {
@@ -247,6 +593,52 @@ func (m *Manager) removeDrain(
 	}
 }
 
+// collectWriter waits for the writer of a removed binding to write the
+// envelopes it buffered, for up to the flush timeout, and closes it.
+func (m *Manager) collectWriter(dh drainHolder) {
+	t := time.NewTicker(collectPollInterval)
+	defer t.Stop()
+	timeout := time.NewTimer(m.writerFlushTimeout)
+	defer timeout.Stop()
+
+	defer m.closeCollectedWriter(dh)
+
+	for pending(dh.drainWriter) > 0 {
+		select {
+		case <-t.C:
+		case <-timeout.C:
+			return
+		}
+	}
+}
+
+// closeCollectedWriter closes the writer of a removed binding and counts
+// whether it was closed with envelopes left unwritten.
+func (m *Manager) closeCollectedWriter(dh drainHolder) {
+	if dh.drainWriter == nil {
+		dh.cancel()
+		return
+	}
+
+	unwritten := pending(dh.drainWriter)
+	dh.cancel()
+	if unwritten > 0 {
+		m.expiredWritersMetric.Add(1)
+		return
+	}
+	m.flushedWritersMetric.Add(1)
+}
+
+// pending returns the number of envelopes the writer has not written yet.
+// Writers that do not implement egress.PendingReporter have none.
+func pending(w egress.Writer) int {
+	pr, ok := w.(egress.PendingReporter)
+	if !ok {
+		return 0
+	}
+	return pr.Pending()
+}
+
 func (m *Manager) idleCleanupLoop() {
 	t := time.NewTicker(m.idleTimeout)
 	for range t.C {
@@ -264,7 +656,9 @@ func (m *Manager) idleCleanup() {
 			for b, dh := range m.sourceDrainMap[sID] {
 				if dh.drainWriter != nil {
 					dh.cancel()
-					m.sourceDrainMap[sID][b] = newDrainHolder()
+					reset := newDrainHolder()
+					reset.missingSince = dh.missingSince
+					m.sourceDrainMap[sID][b] = reset
 					m.updateActiveDrainCount(-1)
 				}
 			}
@@ -274,11 +668,50 @@ func (m *Manager) idleCleanup() {
 	}
 }
 
+func (m *Manager) watchdogLoop() {
+	t := time.NewTicker(m.watchdogDeadline / 2)
+	for range t.C {
+		m.restartStalledWriters()
+	}
+}
+
+// restartStalledWriters cancels the writers of app drains with a stalled
+// write and resets their drain holders, so that new writers are created on
+// the next write. A writer that does not return after its context is
+// cancelled is abandoned.
+func (m *Manager) restartStalledWriters() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for sID, drains := range m.sourceDrainMap {
+		for b, dh := range drains {
+			sr, ok := dh.drainWriter.(egress.StallReporter)
+			if !ok || !sr.Stalled(m.watchdogDeadline) {
+				continue
+			}
+
+			m.log.Printf("restarting stalled writer of drain %s for app %s", egress.DrainHash(b.Drain.Url), sID)
+			dh.cancel()
+			restarted := newDrainHolder()
+			restarted.probed = dh.probed
+			restarted.missingSince = dh.missingSince
+			m.sourceDrainMap[sID][b] = restarted
+			m.updateActiveDrainCount(-1)
+			m.writerRestartsMetric.Add(1)
+		}
+	}
+}
+
 func (m *Manager) updateActiveDrainCount(delta int64) {
 	m.activeDrainCount += delta
 	m.activeDrainCountMetric.Set(float64(m.activeDrainCount))
 }
 
+func (m *Manager) updateDegradedDrainCount(delta int64) {
+	m.degradedDrainCount += delta
+	m.degradedDrainCountMetric.Set(float64(m.degradedDrainCount))
+}
+
 func (m *Manager) refreshAggregateConnections() {
 	drainsToBeClosed := m.copyDrains()
 
@@ -303,6 +736,16 @@ type drainHolder struct {
 	ctx         context.Context
 	cancel      func()
 	drainWriter egress.Writer
+
+	probing  bool
+	probed   bool
+	degraded bool
+	// probeFailed is set when the probe failed permanently.
+	probeFailed bool
+	nextProbe   time.Time
+	// missingSince is when the binding first went missing from the
+	// refreshed bindings, or zero if it was part of the last refresh.
+	missingSince time.Time
 }
 
 func newDrainHolder() drainHolder {
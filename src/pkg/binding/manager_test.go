@@ -2,6 +2,7 @@ package binding_test
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"log"
 	"strings"
@@ -92,7 +93,7 @@ var _ = Describe("Manager", func() {
 				},
 			}
 
-			err := appDrains[0].Write(e)
+			err := appDrains[0].Write(context.Background(), e)
 			Expect(err).To(BeNil())
 			Eventually(appDrains[0].(*spyDrain).envelopes).Should(Receive(Equal(e)))
 		})
@@ -128,15 +129,41 @@ var _ = Describe("Manager", func() {
 				},
 			}
 
-			err := appDrains[0].Write(e)
+			err := appDrains[0].Write(context.Background(), e)
 			Expect(err).To(BeNil())
 			Eventually(appDrains[0].(*spyDrain).envelopes).Should(Receive(Equal(e)))
 
-			err = appDrains[1].Write(e)
+			err = appDrains[1].Write(context.Background(), e)
 			Expect(err).To(BeNil())
 			Eventually(appDrains[1].(*spyDrain).envelopes).Should(Receive(Equal(e)))
 		})
 
+		It("does not return aggregate drains for apps excluded by binding metadata", func() {
+			excludedBinding := binding1
+			excludedBinding.Drain.Metadata = syslog.NewDrainMetadata(map[string]string{
+				syslog.DrainExcludeKey: "true",
+			})
+			stubAppBindingFetcher.bindings <- []syslog.Binding{excludedBinding, binding2}
+			stubAggregateBindingFetcher.bindings <- []syslog.Binding{aggregateBinding1}
+
+			m := binding.NewManager(
+				stubAppBindingFetcher,
+				stubAggregateBindingFetcher,
+				spyConnector,
+				spyMetricClient, 10*time.Second,
+				10*time.Minute,
+				10*time.Minute,
+				log.New(GinkgoWriter, "", 0),
+			)
+			go m.Run()
+
+			Eventually(func() []egress.Writer {
+				return m.GetDrains("app-2")
+			}).Should(HaveLen(2))
+			Expect(m.GetDrains("app-1")).To(HaveLen(1))
+			Expect(m.GetDrains("app-3")).To(HaveLen(1))
+		})
+
 		It("creates connections when asked for them", func() {
 			stubAppBindingFetcher.bindings <- []syslog.Binding{
 				binding1,
@@ -253,6 +280,89 @@ var _ = Describe("Manager", func() {
 		Expect(closedCtx.Err()).To(Equal(errors.New("context canceled")))
 	})
 
+	Context("when the binding limit is reached", func() {
+		It("rejects bindings over the limit", func() {
+			stubAppBindingFetcher.bindings <- []syslog.Binding{binding1, binding2, binding3}
+			stubAggregateBindingFetcher.bindings <- []syslog.Binding{}
+
+			m := binding.NewManager(
+				stubAppBindingFetcher,
+				stubAggregateBindingFetcher,
+				spyConnector,
+				spyMetricClient,
+				10*time.Second,
+				10*time.Minute,
+				10*time.Minute,
+				log.New(GinkgoWriter, "", 0),
+				binding.WithMaxBindings(2),
+			)
+			go m.Run()
+
+			Eventually(func() []egress.Writer {
+				return m.GetDrains("app-2")
+			}).Should(HaveLen(1))
+			Expect(m.GetDrains("app-1")).To(HaveLen(1))
+			Expect(m.GetDrains("app-3")).To(BeEmpty())
+
+			Expect(spyMetricClient.GetMetric("rejected_bindings", map[string]string{"unit": "count"}).Value()).To(Equal(1.0))
+			Expect(spyMetricClient.GetMetric("binding_saturation", map[string]string{"unit": "ratio"}).Value()).To(Equal(1.0))
+		})
+
+		It("keeps serving existing bindings and rejects the newest", func() {
+			stubAppBindingFetcher.bindings <- []syslog.Binding{binding1, binding2}
+			stubAggregateBindingFetcher.bindings <- []syslog.Binding{}
+
+			m := binding.NewManager(
+				stubAppBindingFetcher,
+				stubAggregateBindingFetcher,
+				spyConnector,
+				spyMetricClient,
+				100*time.Millisecond,
+				10*time.Minute,
+				10*time.Minute,
+				log.New(GinkgoWriter, "", 0),
+				binding.WithMaxBindings(2),
+			)
+			go m.Run()
+
+			Eventually(func() []egress.Writer {
+				return m.GetDrains("app-1")
+			}).Should(HaveLen(1))
+
+			stubAppBindingFetcher.bindings <- []syslog.Binding{binding3, binding1, binding2}
+
+			Eventually(func() float64 {
+				return spyMetricClient.GetMetric("rejected_bindings", map[string]string{"unit": "count"}).Value()
+			}).Should(Equal(1.0))
+			Expect(m.GetDrains("app-1")).To(HaveLen(1))
+			Expect(m.GetDrains("app-2")).To(HaveLen(1))
+			Expect(m.GetDrains("app-3")).To(BeEmpty())
+		})
+
+		It("reports the saturation of the binding limit", func() {
+			stubAppBindingFetcher.bindings <- []syslog.Binding{binding1}
+			stubAggregateBindingFetcher.bindings <- []syslog.Binding{}
+
+			m := binding.NewManager(
+				stubAppBindingFetcher,
+				stubAggregateBindingFetcher,
+				spyConnector,
+				spyMetricClient,
+				10*time.Second,
+				10*time.Minute,
+				10*time.Minute,
+				log.New(GinkgoWriter, "", 0),
+				binding.WithMaxBindings(4),
+			)
+			go m.Run()
+
+			Eventually(func() float64 {
+				return spyMetricClient.GetMetric("binding_saturation", map[string]string{"unit": "ratio"}).Value()
+			}).Should(Equal(0.25))
+			Expect(spyMetricClient.GetMetric("rejected_bindings", map[string]string{"unit": "count"}).Value()).To(Equal(0.0))
+		})
+	})
+
 	It("reports the number of bindings that come from the fetcher", func() {
 		stubAppBindingFetcher.bindings <- []syslog.Binding{
 			binding1,
@@ -402,6 +512,45 @@ var _ = Describe("Manager", func() {
 		Expect(spyMetricClient.GetMetric("active_drains", map[string]string{"unit": "count"}).Value()).To(Equal(0.0))
 	})
 
+	It("forgets the deliveries of deleted drains", func() {
+		deliveries := syslog.NewDeliveries(nil)
+		f := syslog.NewWriterFactory(&tls.Config{}, &tls.Config{}, syslog.NetworkTimeoutConfig{}, spyMetricClient, syslog.WithDeliveries(deliveries)) //nolint:gosec
+		for _, b := range []syslog.Binding{binding1, binding2} {
+			_, err := f.NewDrainWriter(context.Background(), b)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		Expect(deliveries.Deliveries("")).To(HaveLen(2))
+
+		stubAppBindingFetcher.bindings <- []syslog.Binding{binding1, binding2}
+		stubAggregateBindingFetcher.bindings <- []syslog.Binding{}
+
+		m := binding.NewManager(
+			stubAppBindingFetcher,
+			stubAggregateBindingFetcher,
+			spyConnector,
+			spyMetricClient, 100*time.Millisecond,
+			10*time.Minute,
+			10*time.Minute,
+			log.New(GinkgoWriter, "", 0),
+			binding.WithDeliveries(deliveries),
+		)
+		go m.Run()
+
+		Eventually(func() []egress.Writer {
+			return m.GetDrains("app-1")
+		}).Should(HaveLen(1))
+
+		go func(bindings chan []syslog.Binding) {
+			for {
+				bindings <- []syslog.Binding{binding2}
+			}
+		}(stubAppBindingFetcher.bindings)
+
+		Eventually(func() []syslog.Delivery {
+			return deliveries.Deliveries("")
+		}).Should(ConsistOf(HaveField("AppID", "app-2")))
+	})
+
 	It("removes drain holders for inactive drains", func() {
 		stubAppBindingFetcher.bindings <- []syslog.Binding{
 			binding1,
@@ -546,10 +695,307 @@ var _ = Describe("Manager", func() {
 			return m.GetDrains("app-1")
 		}).Should(HaveLen(0))
 	})
+
+	It("records fetch and connection errors as error events", func() {
+		invalid := syslog.Binding{
+			AppId: "app-1", Hostname: "host-1",
+			Drain: syslog.Drain{Url: "syslog-invalid-scheme://drain.url.com"},
+		}
+		stubAppBindingFetcher.bindings <- []syslog.Binding{invalid}
+		stubAggregateBindingFetcher.bindings <- []syslog.Binding{}
+		errorEvents := egress.NewErrorEvents(10)
+
+		m := binding.NewManager(
+			stubAppBindingFetcher,
+			stubAggregateBindingFetcher,
+			spyConnector,
+			spyMetricClient, 10*time.Millisecond,
+			10*time.Minute,
+			10*time.Minute,
+			log.New(GinkgoWriter, "", 0),
+			binding.WithErrorEvents(errorEvents),
+		)
+		go m.Run()
+
+		Eventually(func() []egress.ErrorEvent {
+			m.GetDrains("app-1")
+			return errorEvents.Events()
+		}).ShouldNot(BeEmpty())
+		stubAppBindingFetcher.errors <- errors.New("boom")
+
+		Eventually(errorEvents.Events).Should(ContainElements(
+			SatisfyAll(
+				HaveField("Subsystem", "drain_connect"),
+				HaveField("Class", "other"),
+				HaveField("DrainHash", egress.DrainHash(invalid.Drain.Url)),
+			),
+			SatisfyAll(
+				HaveField("Subsystem", "binding_fetch"),
+				HaveField("DrainHash", ""),
+			),
+		))
+	})
+
+	It("reports the duration of reconciling drains", func() {
+		stubAppBindingFetcher.bindings <- []syslog.Binding{binding1}
+		stubAggregateBindingFetcher.bindings <- []syslog.Binding{}
+
+		m := binding.NewManager(
+			stubAppBindingFetcher,
+			stubAggregateBindingFetcher,
+			spyConnector,
+			spyMetricClient,
+			10*time.Second,
+			10*time.Minute,
+			10*time.Minute,
+			log.New(GinkgoWriter, "", 0),
+		)
+		go m.Run()
+
+		Eventually(func() bool {
+			return spyMetricClient.HasMetric("binding_refresh_phase_duration", map[string]string{"unit": "ms", "phase": "reconcile"})
+		}).Should(BeTrue())
+		Eventually(func() float64 {
+			return spyMetricClient.GetMetric("binding_refresh_phase_duration", map[string]string{"unit": "ms", "phase": "reconcile"}).Value()
+		}).Should(BeNumerically(">", 0))
+	})
+
+	Context("when the writer watchdog is enabled", func() {
+		It("restarts stalled writers", func() {
+			stubAppBindingFetcher.bindings <- []syslog.Binding{binding1}
+			stubAggregateBindingFetcher.bindings <- []syslog.Binding{}
+			m := binding.NewManager(
+				stubAppBindingFetcher,
+				stubAggregateBindingFetcher,
+				spyConnector,
+				spyMetricClient,
+				10*time.Second,
+				10*time.Minute,
+				10*time.Minute,
+				log.New(GinkgoWriter, "", 0),
+				binding.WithWriterWatchdog(10*time.Millisecond),
+			)
+			go m.Run()
+
+			Eventually(func() []egress.Writer {
+				return m.GetDrains("app-1")
+			}).Should(HaveLen(1))
+			stalled := m.GetDrains("app-1")[0].(*spyDrain)
+			stalled.stalled.Store(true)
+
+			Eventually(func() float64 {
+				return spyMetricClient.GetMetric("writer_restarts", nil).Value()
+			}).Should(Equal(1.0))
+			Expect(spyConnector.bindingContextMap[binding1].Err()).To(MatchError(context.Canceled))
+
+			Expect(m.GetDrains("app-1")).ToNot(ContainElement(stalled))
+			Expect(spyConnector.ConnectionCount()).To(Equal(int64(2)))
+		})
+	})
+
+	Context("when writer collection is enabled", func() {
+		BeforeEach(func() {
+			stubAggregateBindingFetcher.bindings <- []syslog.Binding{}
+		})
+
+		newManager := func(gracePeriod, flushTimeout time.Duration) *binding.Manager {
+			return binding.NewManager(
+				stubAppBindingFetcher,
+				stubAggregateBindingFetcher,
+				spyConnector,
+				spyMetricClient,
+				10*time.Millisecond,
+				10*time.Minute,
+				10*time.Minute,
+				log.New(GinkgoWriter, "", 0),
+				binding.WithWriterCollection(gracePeriod, flushTimeout),
+			)
+		}
+
+		deleteBinding1 := func() {
+			go func(bindings chan []syslog.Binding) {
+				for {
+					bindings <- []syslog.Binding{binding2}
+				}
+			}(stubAppBindingFetcher.bindings)
+		}
+
+		It("keeps serving missing bindings for the grace period", func() {
+			stubAppBindingFetcher.bindings <- []syslog.Binding{binding1, binding2}
+			m := newManager(500*time.Millisecond, time.Second)
+			go m.Run()
+
+			Eventually(func() []egress.Writer {
+				return m.GetDrains("app-1")
+			}).Should(HaveLen(1))
+			deleteBinding1()
+
+			Eventually(func() float64 {
+				return spyMetricClient.GetMetric("missing_bindings", map[string]string{"unit": "count"}).Value()
+			}).Should(Equal(1.0))
+			Expect(m.GetDrains("app-1")).To(HaveLen(1))
+
+			Eventually(func() []egress.Writer {
+				return m.GetDrains("app-1")
+			}).Should(BeEmpty())
+			Expect(spyMetricClient.GetMetric("missing_bindings", map[string]string{"unit": "count"}).Value()).To(Equal(0.0))
+			Expect(m.GetDrains("app-2")).To(HaveLen(1))
+		})
+
+		It("closes the writers of removed bindings once they are flushed", func() {
+			stubAppBindingFetcher.bindings <- []syslog.Binding{binding1, binding2}
+			m := newManager(0, time.Minute)
+			go m.Run()
+
+			Eventually(func() []egress.Writer {
+				return m.GetDrains("app-1")
+			}).Should(HaveLen(1))
+			drain := m.GetDrains("app-1")[0].(*spyDrain)
+			drain.pending.Store(2)
+			deleteBinding1()
+
+			Eventually(func() []egress.Writer {
+				return m.GetDrains("app-1")
+			}).Should(BeEmpty())
+			Consistently(spyConnector.bindingContextMap[binding1].Done(), 200*time.Millisecond).ShouldNot(BeClosed())
+
+			drain.pending.Store(0)
+			Eventually(spyConnector.bindingContextMap[binding1].Done()).Should(BeClosed())
+			Expect(spyMetricClient.GetMetric("collected_writers", map[string]string{"result": "flushed"}).Value()).To(Equal(1.0))
+			Expect(spyMetricClient.GetMetric("collected_writers", map[string]string{"result": "expired"}).Value()).To(Equal(0.0))
+		})
+
+		It("closes the writers of removed bindings after the flush timeout", func() {
+			stubAppBindingFetcher.bindings <- []syslog.Binding{binding1, binding2}
+			m := newManager(0, 100*time.Millisecond)
+			go m.Run()
+
+			Eventually(func() []egress.Writer {
+				return m.GetDrains("app-1")
+			}).Should(HaveLen(1))
+			m.GetDrains("app-1")[0].(*spyDrain).pending.Store(2)
+			deleteBinding1()
+
+			Eventually(func() float64 {
+				return spyMetricClient.GetMetric("collected_writers", map[string]string{"result": "expired"}).Value()
+			}).Should(Equal(1.0))
+			Expect(spyConnector.bindingContextMap[binding1].Done()).To(BeClosed())
+			Expect(spyMetricClient.GetMetric("collected_writers", map[string]string{"result": "flushed"}).Value()).To(Equal(0.0))
+		})
+
+		It("reports the envelopes pending in the drain writers", func() {
+			stubAppBindingFetcher.bindings <- []syslog.Binding{binding1, binding2}
+			m := newManager(0, time.Minute)
+			go m.Run()
+
+			Eventually(func() []egress.Writer {
+				return m.GetDrains("app-1")
+			}).Should(HaveLen(1))
+			Expect(m.GetDrains("app-2")).To(HaveLen(1))
+			m.GetDrains("app-1")[0].(*spyDrain).pending.Store(2)
+			m.GetDrains("app-2")[0].(*spyDrain).pending.Store(3)
+
+			Expect(m.Status().QueueDepth).To(Equal(5))
+		})
+	})
+
+	Context("when drain probes are enabled", func() {
+		var prober *stubProber
+
+		BeforeEach(func() {
+			prober = &stubProber{}
+			stubAggregateBindingFetcher.bindings <- []syslog.Binding{}
+		})
+
+		newManager := func() *binding.Manager {
+			return binding.NewManager(
+				stubAppBindingFetcher,
+				stubAggregateBindingFetcher,
+				spyConnector,
+				spyMetricClient,
+				10*time.Second,
+				10*time.Minute,
+				10*time.Minute,
+				log.New(GinkgoWriter, "", 0),
+				binding.WithDrainProbe(prober, 10*time.Millisecond),
+			)
+		}
+
+		It("creates writers once the probe succeeds", func() {
+			stubAppBindingFetcher.bindings <- []syslog.Binding{binding1}
+			m := newManager()
+			go m.Run()
+
+			Eventually(func() []egress.Writer {
+				return m.GetDrains("app-1")
+			}).Should(HaveLen(1))
+			Expect(prober.Probes()).To(Equal(int64(1)))
+		})
+
+		It("marks unreachable drains as degraded and probes them again", func() {
+			prober.failures = 3
+			stubAppBindingFetcher.bindings <- []syslog.Binding{binding1}
+			m := newManager()
+			go m.Run()
+
+			Eventually(func() float64 {
+				m.GetDrains("app-1")
+				return spyMetricClient.GetMetric("degraded_drains", map[string]string{"unit": "count"}).Value()
+			}).Should(Equal(1.0))
+			Expect(spyConnector.ConnectionCount()).To(BeZero())
+
+			Eventually(func() []egress.Writer {
+				return m.GetDrains("app-1")
+			}).Should(HaveLen(1))
+			Expect(prober.Probes()).To(Equal(int64(4)))
+			Expect(spyMetricClient.GetMetric("degraded_drains", map[string]string{"unit": "count"}).Value()).To(Equal(0.0))
+		})
+
+		It("does not probe drains again that failed permanently", func() {
+			prober.failures = 3
+			prober.permanent = true
+			stubAppBindingFetcher.bindings <- []syslog.Binding{binding1}
+			m := newManager()
+			go m.Run()
+
+			Eventually(func() float64 {
+				m.GetDrains("app-1")
+				return spyMetricClient.GetMetric("degraded_drains", map[string]string{"unit": "count"}).Value()
+			}).Should(Equal(1.0))
+
+			Consistently(func() []egress.Writer {
+				return m.GetDrains("app-1")
+			}, 100*time.Millisecond).Should(BeEmpty())
+			Expect(prober.Probes()).To(Equal(int64(1)))
+			Expect(spyConnector.ConnectionCount()).To(BeZero())
+		})
+	})
 })
 
+type stubProber struct {
+	failures  int64
+	probes    int64
+	permanent bool
+}
+
+func (p *stubProber) Probe(context.Context, syslog.Binding) error {
+	if atomic.AddInt64(&p.probes, 1) <= atomic.LoadInt64(&p.failures) {
+		if p.permanent {
+			return syslog.PermanentProbeError{Err: errors.New("unsupported protocol")}
+		}
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func (p *stubProber) Probes() int64 {
+	return atomic.LoadInt64(&p.probes)
+}
+
 type spyDrain struct {
 	envelopes chan *loggregator_v2.Envelope
+	stalled   atomic.Bool
+	pending   atomic.Int64
 }
 
 func newSpyDrain() *spyDrain {
@@ -558,11 +1004,19 @@ func newSpyDrain() *spyDrain {
 	}
 }
 
-func (s *spyDrain) Write(e *loggregator_v2.Envelope) error {
+func (s *spyDrain) Write(_ context.Context, e *loggregator_v2.Envelope) error {
 	s.envelopes <- e
 	return nil
 }
 
+func (s *spyDrain) Stalled(time.Duration) bool {
+	return s.stalled.Load()
+}
+
+func (s *spyDrain) Pending() int {
+	return int(s.pending.Load())
+}
+
 type spyConnector struct {
 	mu                   sync.Mutex
 	connectionCount      int64
@@ -2,8 +2,12 @@ package binding
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	metrics "code.cloudfoundry.org/go-metric-registry"
@@ -12,15 +16,65 @@ import (
 type Poller struct {
 	apiClient       client
 	pollingInterval time.Duration
+	maxBackoff      time.Duration
+	pageConcurrency int
 	store           Setter
 
+	// interval is the wait until the next poll. It grows while the API
+	// throttles or fails and is reset to the polling interval otherwise.
+	interval time.Duration
+	// pages are the pages of the last successful poll by next_id, which
+	// are reused when the API responds that they are not modified.
+	pages map[int]cachedPage
+
 	logger                     *log.Logger
 	bindingRefreshErrorCounter metrics.Counter
 	lastBindingCount           metrics.Gauge
+	apiRequests                map[string]metrics.Counter
+	apiRequestSeconds          metrics.Counter
+	pollIntervalGauge          metrics.Gauge
 }
 
 type client interface {
-	Get(int) (*http.Response, error)
+	// Get requests the page of bindings starting at nextID. If etag is not
+	// empty, the page is only returned if it does not match etag.
+	Get(nextID int, etag string) (*http.Response, error)
+}
+
+type cachedPage struct {
+	etag string
+	resp apiResponse
+}
+
+// throttledError is returned when the API responds with 429 Too Many
+// Requests or a server error.
+type throttledError struct {
+	statusCode int
+	retryAfter time.Duration
+}
+
+func (e *throttledError) Error() string {
+	return fmt.Sprintf("unexpected response from internal bindings endpoint. status code: %d", e.statusCode)
+}
+
+// PollerOption configures a Poller.
+type PollerOption func(*Poller)
+
+// WithPageConcurrency requests up to n pages of bindings in parallel. This
+// relies on next_id being the offset of the next page, as it is for Cloud
+// Controller. Pages are requested one after the other if n is 1 or less.
+func WithPageConcurrency(n int) PollerOption {
+	return func(p *Poller) {
+		p.pageConcurrency = n
+	}
+}
+
+// WithMaxBackoff limits the wait between polls while the API throttles or
+// fails. It defaults to eight times the polling interval.
+func WithMaxBackoff(d time.Duration) PollerOption {
+	return func(p *Poller) {
+		p.maxBackoff = d
+	}
 }
 
 type Credentials struct {
@@ -36,26 +90,31 @@ type App struct {
 }
 
 type Binding struct {
-	Url         string        `json:"url" yaml:"url"`
-	Credentials []Credentials `json:"credentials" yaml:"credentials"`
+	Url         string            `json:"url" yaml:"url"`
+	Credentials []Credentials     `json:"credentials" yaml:"credentials"`
+	Metadata    map[string]string `json:"metadata,omitempty" yaml:"metadata,omitempty"`
 }
 
 type AggBinding struct {
-	Url  string `yaml:"url"`
-	Cert string `yaml:"cert"`
-	Key  string `yaml:"key"`
-	CA   string `yaml:"ca"`
+	Url      string            `yaml:"url"`
+	Cert     string            `yaml:"cert"`
+	Key      string            `yaml:"key"`
+	CA       string            `yaml:"ca"`
+	Metadata map[string]string `yaml:"metadata"`
 }
 
 type Setter interface {
 	Set(bindings []Binding, bindingCount int)
 }
 
-func NewPoller(ac client, pi time.Duration, s Setter, m Metrics, logger *log.Logger) *Poller {
+func NewPoller(ac client, pi time.Duration, s Setter, m Metrics, logger *log.Logger, opts ...PollerOption) *Poller {
 	p := &Poller{
 		apiClient:       ac,
 		pollingInterval: pi,
+		maxBackoff:      8 * pi,
+		pageConcurrency: 1,
 		store:           s,
+		interval:        pi,
 		logger:          logger,
 		bindingRefreshErrorCounter: m.NewCounter(
 			"binding_refresh_error",
@@ -65,7 +124,28 @@ func NewPoller(ac client, pi time.Duration, s Setter, m Metrics, logger *log.Log
 			"last_binding_refresh_count",
 			"Current number of bindings received from binding provider during last refresh.",
 		),
+		apiRequests: make(map[string]metrics.Counter),
+		apiRequestSeconds: m.NewCounter(
+			"binding_api_request_seconds",
+			"Total time spent in requests to the binding provider.",
+		),
+		pollIntervalGauge: m.NewGauge(
+			"binding_refresh_interval",
+			"Current wait in seconds until the next request for bindings, including backoff.",
+			metrics.WithMetricLabels(map[string]string{"unit": "seconds"}),
+		),
+	}
+	for _, status := range []string{"2xx", "3xx", "4xx", "5xx", "error"} {
+		p.apiRequests[status] = m.NewCounter(
+			"binding_api_requests",
+			"Total number of requests to the binding provider by response status.",
+			metrics.WithMetricLabels(map[string]string{"status": status}),
+		)
+	}
+	for _, o := range opts {
+		o(p)
 	}
+
 	p.poll()
 	return p
 }
@@ -73,43 +153,183 @@ func NewPoller(ac client, pi time.Duration, s Setter, m Metrics, logger *log.Log
 func (p *Poller) Poll() {
 	for {
 		p.poll()
-		time.Sleep(p.pollingInterval)
+		time.Sleep(p.interval)
 	}
 }
 
 func (p *Poller) poll() {
-	nextID := 0
+	bindings, pages, err := p.fetchBindings()
+	p.updateInterval(err)
+	if err != nil {
+		p.logger.Print(err)
+		return
+	}
+	p.pages = pages
+
+	bindingCount := CalculateBindingCount(bindings)
+	p.lastBindingCount.Set(float64(bindingCount))
+	p.store.Set(bindings, bindingCount)
+}
+
+// updateInterval doubles the wait until the next poll, up to the maximum
+// backoff, if the API throttled or failed, and resets it otherwise. A
+// longer Retry-After of the API is honored.
+func (p *Poller) updateInterval(err error) {
+	var te *throttledError
+	if !errors.As(err, &te) {
+		p.interval = p.pollingInterval
+	} else {
+		p.interval = min(max(2*p.interval, te.retryAfter), max(p.maxBackoff, p.pollingInterval))
+	}
+	p.pollIntervalGauge.Set(p.interval.Seconds())
+}
+
+// fetchBindings requests all pages of bindings. It returns the pages by
+// next_id along with the bindings.
+func (p *Poller) fetchBindings() ([]Binding, map[int]cachedPage, error) {
+	pages := &pageSet{pages: make(map[int]cachedPage)}
+
+	first, err := p.fetchPage(0, pages)
+	if err != nil {
+		return nil, nil, err
+	}
+	bindings := first.Results
+	if first.NextID == 0 {
+		return bindings, pages.pages, nil
+	}
+
+	var rest []Binding
+	if p.pageConcurrency > 1 {
+		rest, err = p.fetchParallel(first.NextID, first.NextID, pages)
+	} else {
+		rest, err = p.fetchSequential(first.NextID, pages)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return append(bindings, rest...), pages.pages, nil
+}
+
+func (p *Poller) fetchSequential(nextID int, pages *pageSet) ([]Binding, error) {
 	var bindings []Binding
-	for {
-		resp, err := p.apiClient.Get(nextID)
+	for nextID != 0 {
+		resp, err := p.fetchPage(nextID, pages)
 		if err != nil {
-			p.bindingRefreshErrorCounter.Add(1)
-			p.logger.Printf("failed to get page %d from internal bindings endpoint: %s", nextID, err)
-			return
+			return nil, err
 		}
-		if resp.StatusCode != http.StatusOK {
-			p.logger.Printf("unexpected response from internal bindings endpoint. status code: %d", resp.StatusCode)
-			return
+		bindings = append(bindings, resp.Results...)
+		nextID = resp.NextID
+	}
+	return bindings, nil
+}
+
+// fetchParallel requests the pages starting at offset in windows of
+// pageConcurrency pages that are stride apart. The last page is the first
+// with a next_id of zero. Pages requested beyond it are discarded.
+func (p *Poller) fetchParallel(offset, stride int, pages *pageSet) ([]Binding, error) {
+	var bindings []Binding
+	for ; ; offset += p.pageConcurrency * stride {
+		resps := make([]apiResponse, p.pageConcurrency)
+		errs := make([]error, p.pageConcurrency)
+
+		var wg sync.WaitGroup
+		for i := range resps {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				resps[i], errs[i] = p.fetchPage(offset+i*stride, pages)
+			}(i)
 		}
+		wg.Wait()
 
-		var aResp apiResponse
-		err = json.NewDecoder(resp.Body).Decode(&aResp)
-		if err != nil {
-			p.logger.Printf("failed to decode JSON: %s", err)
-			return
+		for i, resp := range resps {
+			if errs[i] != nil {
+				return nil, errs[i]
+			}
+			bindings = append(bindings, resp.Results...)
+			if resp.NextID == 0 {
+				return bindings, nil
+			}
+			if want := offset + (i+1)*stride; resp.NextID != want {
+				return nil, fmt.Errorf("unexpected next_id %d from internal bindings endpoint, expected %d: disable parallel paging", resp.NextID, want)
+			}
 		}
+	}
+}
+
+// fetchPage requests the page starting at nextID. The page of the last
+// poll is reused if the API responds that it is not modified.
+func (p *Poller) fetchPage(nextID int, pages *pageSet) (apiResponse, error) {
+	cached, hasCached := p.pages[nextID]
 
-		bindings = append(bindings, aResp.Results...)
-		nextID = aResp.NextID
+	start := time.Now()
+	resp, err := p.apiClient.Get(nextID, cached.etag)
+	p.apiRequestSeconds.Add(time.Since(start).Seconds())
+	if err != nil {
+		p.apiRequests["error"].Add(1)
+		p.bindingRefreshErrorCounter.Add(1)
+		return apiResponse{}, fmt.Errorf("failed to get page %d from internal bindings endpoint: %s", nextID, err)
+	}
+	defer resp.Body.Close()
+	p.countRequest(resp.StatusCode)
 
-		if nextID == 0 {
-			break
+	switch {
+	case resp.StatusCode == http.StatusNotModified && hasCached:
+		pages.set(nextID, cached)
+		return cached.resp, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return apiResponse{}, &throttledError{
+			statusCode: resp.StatusCode,
+			retryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
 		}
+	case resp.StatusCode != http.StatusOK:
+		return apiResponse{}, fmt.Errorf("unexpected response from internal bindings endpoint. status code: %d", resp.StatusCode)
 	}
 
-	bindingCount := CalculateBindingCount(bindings)
-	p.lastBindingCount.Set(float64(bindingCount))
-	p.store.Set(bindings, bindingCount)
+	var aResp apiResponse
+	err = json.NewDecoder(resp.Body).Decode(&aResp)
+	if err != nil {
+		return apiResponse{}, fmt.Errorf("failed to decode JSON: %s", err)
+	}
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		pages.set(nextID, cachedPage{etag: etag, resp: aResp})
+	}
+
+	return aResp, nil
+}
+
+func (p *Poller) countRequest(statusCode int) {
+	if c, ok := p.apiRequests[fmt.Sprintf("%dxx", statusCode/100)]; ok {
+		c.Add(1)
+	}
+}
+
+// parseRetryAfter returns the wait of a Retry-After header in seconds or
+// as an HTTP date. It returns zero if the header is empty or invalid.
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if s, err := strconv.Atoi(v); err == nil && s > 0 {
+		return time.Duration(s) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0)
+	}
+	return 0
+}
+
+// pageSet collects the pages of a poll from concurrent requests.
+type pageSet struct {
+	mu    sync.Mutex
+	pages map[int]cachedPage
+}
+
+func (s *pageSet) set(nextID int, page cachedPage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pages[nextID] = page
 }
 
 func CalculateBindingCount(bindings []Binding) int {
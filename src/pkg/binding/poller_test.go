@@ -4,9 +4,13 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -16,6 +20,7 @@ import (
 	. "github.com/onsi/gomega"
 
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/binding"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/ingress/api"
 )
 
 var _ = Describe("Poller", func() {
@@ -234,6 +239,76 @@ var _ = Describe("Poller", func() {
 			To(BeNumerically("==", 2))
 	})
 
+	Context("with Cloud Controller", func() {
+		var capi *fakeCAPI
+
+		BeforeEach(func() {
+			capi = newFakeCAPI(7)
+		})
+
+		AfterEach(func() {
+			capi.Close()
+		})
+
+		newAPIClient := func() api.Client {
+			return api.Client{Client: http.DefaultClient, Addr: capi.URL, BatchSize: 2}
+		}
+
+		It("requests pages in parallel", func() {
+			binding.NewPoller(newAPIClient(), time.Hour, store, metrics, logger, binding.WithPageConcurrency(3))
+
+			var bindings []binding.Binding
+			Expect(store.bindings).To(Receive(&bindings))
+			Expect(bindings).To(Equal(capi.bindings))
+			Expect(capi.requestedIDs()).To(ConsistOf("0", "2", "4", "6", "8", "10", "12"))
+			Expect(metrics.GetMetric("binding_api_requests", map[string]string{"status": "2xx"}).Value()).
+				To(BeNumerically(">=", 5))
+		})
+
+		It("reuses pages that are not modified", func() {
+			capi.etags = true
+			p := binding.NewPoller(newAPIClient(), 10*time.Millisecond, store, metrics, logger)
+			go p.Poll()
+
+			var first, second []binding.Binding
+			Eventually(store.bindings).Should(Receive(&first))
+			Eventually(store.bindings).Should(Receive(&second))
+			Expect(second).To(Equal(first))
+			Expect(second).To(Equal(capi.bindings))
+			Eventually(func() float64 {
+				return metrics.GetMetric("binding_api_requests", map[string]string{"status": "3xx"}).Value()
+			}).Should(BeNumerically(">=", 4))
+		})
+
+		It("backs off while the API throttles", func() {
+			capi.setStatus(http.StatusTooManyRequests)
+			p := binding.NewPoller(newAPIClient(), 10*time.Millisecond, store, metrics, logger, binding.WithMaxBackoff(40*time.Millisecond))
+			interval := func() float64 {
+				return metrics.GetMetric("binding_refresh_interval", map[string]string{"unit": "seconds"}).Value()
+			}
+			Expect(interval()).To(Equal(0.02))
+
+			go p.Poll()
+			Eventually(interval).Should(Equal(0.04))
+			Consistently(store.bindings).ShouldNot(Receive())
+
+			capi.setStatus(http.StatusOK)
+			Eventually(interval).Should(Equal(0.01))
+			Eventually(store.bindings).Should(Receive())
+		})
+
+		It("honors the Retry-After of the API", func() {
+			capi.setStatus(http.StatusServiceUnavailable)
+			capi.retryAfter = "120"
+			binding.NewPoller(newAPIClient(), time.Second, store, metrics, logger, binding.WithMaxBackoff(time.Hour))
+
+			Expect(metrics.GetMetric("binding_refresh_interval", map[string]string{"unit": "seconds"}).Value()).
+				To(Equal(float64(120)))
+			Expect(metrics.GetMetric("binding_api_requests", map[string]string{"status": "5xx"}).Value()).
+				To(Equal(float64(1)))
+		})
+	})
+
 	It("tracks the isolated CalculateBindingsCount call", func() {
 		noBinding := []binding.Binding{}
 		singleBinding := []binding.Binding{
@@ -297,7 +372,7 @@ func newFakeAPIClient() *fakeAPIClient {
 	}
 }
 
-func (c *fakeAPIClient) Get(nextID int) (*http.Response, error) {
+func (c *fakeAPIClient) Get(nextID int, etag string) (*http.Response, error) {
 	atomic.AddInt64(&c.numRequests, 1)
 
 	var binding response
@@ -346,3 +421,76 @@ type response struct {
 	Results []binding.Binding
 	NextID  int `json:"next_id"`
 }
+
+// fakeCAPI serves bindings in offset based pages like the internal
+// bindings endpoint of Cloud Controller.
+type fakeCAPI struct {
+	*httptest.Server
+	bindings   []binding.Binding
+	etags      bool
+	retryAfter string
+
+	mu        sync.Mutex
+	status    int
+	requested []string
+}
+
+func newFakeCAPI(n int) *fakeCAPI {
+	c := &fakeCAPI{status: http.StatusOK}
+	for i := 0; i < n; i++ {
+		c.bindings = append(c.bindings, binding.Binding{
+			Url: fmt.Sprintf("syslog://drain-%d", i),
+			Credentials: []binding.Credentials{
+				{Apps: []binding.App{{Hostname: "app-hostname", AppID: fmt.Sprintf("app-id-%d", i)}}},
+			},
+		})
+	}
+	c.Server = httptest.NewServer(http.HandlerFunc(c.serve))
+	return c
+}
+
+func (c *fakeCAPI) setStatus(status int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status = status
+}
+
+func (c *fakeCAPI) requestedIDs() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.requested...)
+}
+
+func (c *fakeCAPI) serve(w http.ResponseWriter, r *http.Request) {
+	nextID := r.URL.Query().Get("next_id")
+	c.mu.Lock()
+	c.requested = append(c.requested, nextID)
+	status := c.status
+	c.mu.Unlock()
+
+	if status != http.StatusOK {
+		if c.retryAfter != "" {
+			w.Header().Set("Retry-After", c.retryAfter)
+		}
+		w.WriteHeader(status)
+		return
+	}
+
+	etag := `"v1-` + nextID + `"`
+	if c.etags {
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+	}
+
+	offset, _ := strconv.Atoi(nextID)
+	size, _ := strconv.Atoi(r.URL.Query().Get("batch_size"))
+	resp := response{Results: []binding.Binding{}}
+	if offset < len(c.bindings) {
+		resp.Results = c.bindings[offset:min(offset+size, len(c.bindings))]
+		resp.NextID = offset + size
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -4,6 +4,7 @@ import (
 	"io"
 	"os"
 	"sync"
+	"time"
 
 	metrics "code.cloudfoundry.org/go-metric-registry"
 	"gopkg.in/yaml.v2"
@@ -12,6 +13,7 @@ import (
 type Store struct {
 	mu           sync.Mutex
 	bindings     []Binding
+	lastSet      time.Time
 	bindingCount metrics.Gauge
 }
 
@@ -39,10 +41,20 @@ func (s *Store) Set(bindings []Binding, bindingCount int) {
 
 	s.mu.Lock()
 	s.bindings = bindings
+	s.lastSet = time.Now()
 	s.bindingCount.Set(float64(bindingCount))
 	s.mu.Unlock()
 }
 
+// LastSet returns when the bindings were last set, i.e. the time of the
+// last successful poll of the binding provider. It is zero if they were
+// never set.
+func (s *Store) LastSet() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastSet
+}
+
 type AggregateStore struct {
 	Drains []Binding
 }
@@ -73,6 +85,7 @@ func NewAggregateStore(drainFileName string) *AggregateStore {
 					CA:   binding.CA,
 				},
 			},
+			Metadata: binding.Metadata,
 		})
 	}
 	return &AggregateStore{Drains: bindings}
@@ -2,6 +2,7 @@ package binding_test
 
 import (
 	"os"
+	"time"
 
 	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/binding"
@@ -92,6 +93,15 @@ var _ = Describe("Store", func() {
 		Expect(metrics.GetMetric("cached_bindings", nil).Value()).
 			To(BeNumerically("==", 2))
 	})
+	It("records when the bindings were last set", func() {
+		store := binding.NewStore(metricsHelpers.NewMetricsRegistry())
+		Expect(store.LastSet()).To(BeZero())
+
+		store.Set([]binding.Binding{{Url: "drain-1"}}, 1)
+
+		Expect(store.LastSet()).To(BeTemporally("~", time.Now(), time.Second))
+	})
+
 	It("can read and store drains using the new file format with certs", func() {
 		aggDrainFile := makeAggDrainFile(`---
 - url: "syslog://test-hostname:1000"
@@ -127,6 +137,22 @@ var _ = Describe("Store", func() {
 			},
 		))
 	})
+
+	It("reads drain metadata from the aggregate drain file", func() {
+		aggDrainFile := makeAggDrainFile(`---
+- url: "https://test-hostname:1000"
+  metadata:
+    format: splunk-hec
+    tenant: t-1
+`)
+		aggStore := binding.NewAggregateStore(aggDrainFile)
+
+		Expect(aggStore.Get()).To(HaveLen(1))
+		Expect(aggStore.Get()[0].Metadata).To(Equal(map[string]string{
+			"format": "splunk-hec",
+			"tenant": "t-1",
+		}))
+	})
 })
 
 func makeAggDrainFile(write string) string {
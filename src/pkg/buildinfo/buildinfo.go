@@ -0,0 +1,114 @@
+// Package buildinfo exposes the version and commit an agent binary was
+// built from.
+//
+// The values are set at link time, for example:
+//
+//	go build -ldflags "-X code.cloudfoundry.org/loggregator-agent-release/src/pkg/buildinfo.Version=7.2.0"
+//
+// The agent packages of the release set the version from src/version.
+package buildinfo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	metrics "code.cloudfoundry.org/go-metric-registry"
+)
+
+var (
+	// Version is the release version the binary was built from.
+	Version = "dev"
+	// Commit is the git commit the binary was built from. If it is not set
+	// at link time the VCS revision recorded by the Go toolchain is used.
+	Commit = ""
+)
+
+// Info describes the build of the running binary.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the build information of the running binary.
+func Get() Info {
+	return Info{
+		Version:   Version,
+		Commit:    commit(),
+		GoVersion: runtime.Version(),
+	}
+}
+
+func commit() string {
+	if Commit != "" {
+		return Commit
+	}
+
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	for _, s := range bi.Settings {
+		if s.Key == "vcs.revision" {
+			return s.Value
+		}
+	}
+
+	return "unknown"
+}
+
+// Handler serves the build information as JSON.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(Get())
+	})
+}
+
+// NewServer returns a server for the /info endpoint on localhost at the
+// given port.
+func NewServer(port uint16) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/info", Handler())
+
+	return &http.Server{
+		Addr:              fmt.Sprintf("127.0.0.1:%d", port),
+		Handler:           mux,
+		ReadHeaderTimeout: 2 * time.Second,
+	}
+}
+
+// MetricClient is used to emit the startup metric.
+type MetricClient interface {
+	NewCounter(name, helpText string, opts ...metrics.MetricOption) metrics.Counter
+}
+
+// EmitStartup increments a counter tagged with the build version and commit
+// so that rollouts can be tracked across a fleet.
+func EmitStartup(m MetricClient) {
+	info := Get()
+	m.NewCounter(
+		"startups",
+		"Total number of times the process started, tagged with its build version.",
+		metrics.WithMetricLabels(map[string]string{
+			"version": info.Version,
+			"commit":  info.Commit,
+		}),
+	).Add(1)
+}
+
+// WithVersionTag returns a copy of tags with the agent_version tag set to
+// the build version.
+func WithVersionTag(tags map[string]string) map[string]string {
+	t := make(map[string]string, len(tags)+1)
+	for k, v := range tags {
+		t[k] = v
+	}
+	t["agent_version"] = Version
+
+	return t
+}
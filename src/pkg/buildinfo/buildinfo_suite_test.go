@@ -0,0 +1,13 @@
+package buildinfo_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestBuildInfo(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "BuildInfo Suite")
+}
@@ -0,0 +1,65 @@
+package buildinfo_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+
+	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/buildinfo"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("BuildInfo", func() {
+	BeforeEach(func() {
+		v, c := buildinfo.Version, buildinfo.Commit
+		buildinfo.Version = "1.2.3"
+		buildinfo.Commit = "abc123"
+		DeferCleanup(func() {
+			buildinfo.Version, buildinfo.Commit = v, c
+		})
+	})
+
+	It("returns the linked version and commit", func() {
+		Expect(buildinfo.Get()).To(Equal(buildinfo.Info{
+			Version:   "1.2.3",
+			Commit:    "abc123",
+			GoVersion: runtime.Version(),
+		}))
+	})
+
+	It("serves the build info as JSON", func() {
+		rec := httptest.NewRecorder()
+		buildinfo.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/info", nil))
+
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Header().Get("Content-Type")).To(Equal("application/json"))
+
+		var info buildinfo.Info
+		Expect(json.Unmarshal(rec.Body.Bytes(), &info)).To(Succeed())
+		Expect(info.Version).To(Equal("1.2.3"))
+		Expect(info.Commit).To(Equal("abc123"))
+	})
+
+	It("emits a startup metric tagged with the version", func() {
+		m := metricsHelpers.NewMetricsRegistry()
+
+		buildinfo.EmitStartup(m)
+
+		metric := m.GetMetric("startups", map[string]string{"version": "1.2.3", "commit": "abc123"})
+		Expect(metric.Value()).To(Equal(1.0))
+	})
+
+	It("adds the version tag to a copy of the tags", func() {
+		tags := map[string]string{"deployment": "cf"}
+
+		Expect(buildinfo.WithVersionTag(tags)).To(Equal(map[string]string{
+			"deployment":    "cf",
+			"agent_version": "1.2.3",
+		}))
+		Expect(tags).ToNot(HaveKey("agent_version"))
+	})
+})
@@ -0,0 +1,101 @@
+package cache
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	metrics "code.cloudfoundry.org/go-metric-registry"
+
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/binding"
+)
+
+// Endpoint is a binding cache that a FailoverClient can fetch bindings
+// from.
+type Endpoint struct {
+	Addr   string
+	Getter BindingGetter
+}
+
+// FailoverClient fetches bindings from one of several binding caches. It
+// keeps using the active endpoint until a request to it fails and then
+// tries the remaining endpoints in order.
+type FailoverClient struct {
+	endpoints []Endpoint
+	active    []metrics.Gauge
+	log       *log.Logger
+
+	mu      sync.Mutex
+	current int
+}
+
+// NewFailoverClient returns a FailoverClient for the given endpoints. The
+// first endpoint is active initially.
+func NewFailoverClient(endpoints []Endpoint, m Metrics, l *log.Logger) *FailoverClient {
+	c := &FailoverClient{
+		endpoints: endpoints,
+		log:       l,
+	}
+
+	for _, e := range endpoints {
+		c.active = append(c.active, m.NewGauge(
+			"binding_cache_active_endpoint",
+			"Whether the binding cache endpoint is the one bindings are currently fetched from.",
+			metrics.WithMetricLabels(map[string]string{"endpoint": e.Addr}),
+		))
+	}
+	c.setActive(0)
+
+	return c
+}
+
+// Get returns the app bindings.
+func (c *FailoverClient) Get() ([]binding.Binding, error) {
+	return c.fetch(func(g BindingGetter) ([]binding.Binding, error) {
+		return g.Get()
+	})
+}
+
+// GetAggregate returns the aggregate drains.
+func (c *FailoverClient) GetAggregate() ([]binding.Binding, error) {
+	return c.fetch(func(g BindingGetter) ([]binding.Binding, error) {
+		return g.GetAggregate()
+	})
+}
+
+func (c *FailoverClient) fetch(get func(BindingGetter) ([]binding.Binding, error)) ([]binding.Binding, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var err error
+	for i := 0; i < len(c.endpoints); i++ {
+		idx := (c.current + i) % len(c.endpoints)
+		e := c.endpoints[idx]
+
+		var bindings []binding.Binding
+		bindings, err = get(e.Getter)
+		if err != nil {
+			c.log.Printf("failed to fetch bindings from %s: %s", e.Addr, err)
+			continue
+		}
+
+		if idx != c.current {
+			c.log.Printf("failing over to binding cache %s", e.Addr)
+			c.setActive(idx)
+		}
+		return bindings, nil
+	}
+
+	return nil, fmt.Errorf("all binding cache endpoints failed, last error: %w", err)
+}
+
+func (c *FailoverClient) setActive(idx int) {
+	c.current = idx
+	for i, g := range c.active {
+		if i == idx {
+			g.Set(1)
+			continue
+		}
+		g.Set(0)
+	}
+}
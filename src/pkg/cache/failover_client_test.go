@@ -0,0 +1,71 @@
+package cache_test
+
+import (
+	"errors"
+	"log"
+
+	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/binding"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/cache"
+)
+
+var _ = Describe("FailoverClient", func() {
+	var (
+		primary   *spyGetter
+		secondary *spyGetter
+		m         *metricsHelpers.SpyMetricsRegistry
+		c         *cache.FailoverClient
+		logger    = log.New(GinkgoWriter, "", 0)
+	)
+
+	BeforeEach(func() {
+		primary = &spyGetter{bindings: []binding.Binding{{Url: "syslog://primary"}}}
+		secondary = &spyGetter{bindings: []binding.Binding{{Url: "syslog://secondary"}}}
+		m = metricsHelpers.NewMetricsRegistry()
+		c = cache.NewFailoverClient([]cache.Endpoint{
+			{Addr: "https://cache-1:9000", Getter: primary},
+			{Addr: "https://cache-2:9000", Getter: secondary},
+		}, m, logger)
+	})
+
+	active := func(addr string) float64 {
+		return m.GetMetric("binding_cache_active_endpoint", map[string]string{"endpoint": addr}).Value()
+	}
+
+	It("fetches from the first endpoint", func() {
+		Expect(c.Get()).To(Equal(primary.bindings))
+		Expect(c.GetAggregate()).To(Equal(primary.bindings))
+		Expect(secondary.calls()).To(BeZero())
+
+		Expect(active("https://cache-1:9000")).To(Equal(1.0))
+		Expect(active("https://cache-2:9000")).To(Equal(0.0))
+	})
+
+	It("fails over to the next endpoint on errors", func() {
+		primary.setErr(errors.New("unreachable"))
+
+		Expect(c.Get()).To(Equal(secondary.bindings))
+		Expect(active("https://cache-1:9000")).To(Equal(0.0))
+		Expect(active("https://cache-2:9000")).To(Equal(1.0))
+	})
+
+	It("keeps using the endpoint it failed over to", func() {
+		primary.setErr(errors.New("unreachable"))
+		Expect(c.Get()).To(Equal(secondary.bindings))
+
+		primary.setErr(nil)
+		Expect(c.Get()).To(Equal(secondary.bindings))
+		Expect(primary.calls()).To(Equal(1))
+	})
+
+	It("returns an error if all endpoints fail", func() {
+		primary.setErr(errors.New("unreachable"))
+		secondary.setErr(errors.New("also unreachable"))
+
+		_, err := c.Get()
+		Expect(err).To(MatchError(ContainSubstring("also unreachable")))
+	})
+})
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"strconv"
 
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/binding"
 )
@@ -18,20 +19,58 @@ type AggregateGetter interface {
 
 func Handler(store Getter) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		err := json.NewEncoder(w).Encode(store.Get())
-		if err != nil {
-			log.Printf("failed to encode response body: %s", err)
-			return
-		}
+		writeBindings(w, r, store.Get())
 	}
 }
 
 func AggregateHandler(store AggregateGetter) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		err := json.NewEncoder(w).Encode(store.Get())
-		if err != nil {
-			log.Printf("failed to encode response body: %s", err)
-			return
+		writeBindings(w, r, store.Get())
+	}
+}
+
+// writeBindings writes the bindings as JSON. If the request has a limit
+// query parameter only the page of bindings starting at offset is written.
+func writeBindings(w http.ResponseWriter, r *http.Request, bindings []binding.Binding) {
+	bindings, err := page(r, bindings)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(bindings)
+	if err != nil {
+		log.Printf("failed to encode response body: %s", err)
+		return
+	}
+}
+
+func page(r *http.Request, bindings []binding.Binding) ([]binding.Binding, error) {
+	q := r.URL.Query()
+	if q.Get("limit") == "" {
+		return bindings, nil
+	}
+
+	limit, err := strconv.Atoi(q.Get("limit"))
+	if err != nil || limit < 1 {
+		return nil, errInvalidParam("limit")
+	}
+	offset := 0
+	if q.Get("offset") != "" {
+		offset, err = strconv.Atoi(q.Get("offset"))
+		if err != nil || offset < 0 {
+			return nil, errInvalidParam("offset")
 		}
 	}
+
+	if offset >= len(bindings) {
+		return []binding.Binding{}, nil
+	}
+	return bindings[offset:min(offset+limit, len(bindings))], nil
+}
+
+type errInvalidParam string
+
+func (e errInvalidParam) Error() string {
+	return "invalid " + string(e) + " parameter"
 }
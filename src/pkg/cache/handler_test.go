@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -61,10 +62,43 @@ var _ = Describe("Handler", func() {
 		Expect(err).ToNot(HaveOccurred())
 		Expect(rw.Body.String()).To(MatchJSON(j))
 	})
+
+	DescribeTable("pages results with the limit and offset parameters", func(query string, urls []string) {
+		bindings := []binding.Binding{{Url: "drain-1"}, {Url: "drain-2"}, {Url: "drain-3"}}
+
+		handler := cache.Handler(newStubStore(bindings))
+		rw := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodGet, "/v2/bindings?"+query, nil)
+		Expect(err).ToNot(HaveOccurred())
+		handler.ServeHTTP(rw, req)
+
+		var page []binding.Binding
+		Expect(json.Unmarshal(rw.Body.Bytes(), &page)).To(Succeed())
+		var pageURLs []string
+		for _, b := range page {
+			pageURLs = append(pageURLs, b.Url)
+		}
+		Expect(pageURLs).To(Equal(urls))
+	},
+		Entry("first page", "limit=2", []string{"drain-1", "drain-2"}),
+		Entry("last page", "limit=2&offset=2", []string{"drain-3"}),
+		Entry("past the end", "limit=2&offset=4", nil),
+	)
+
+	It("rejects invalid paging parameters", func() {
+		handler := cache.Handler(newStubStore(nil))
+		rw := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodGet, "/v2/bindings?limit=0", nil)
+		Expect(err).ToNot(HaveOccurred())
+		handler.ServeHTTP(rw, req)
+
+		Expect(rw.Code).To(Equal(http.StatusBadRequest))
+	})
 })
 
 type stubStore struct {
 	bindings []binding.Binding
+	lastSet  time.Time
 }
 
 type stubAggregateStore struct {
@@ -77,6 +111,10 @@ func newStubStore(bindings []binding.Binding) *stubStore {
 	}
 }
 
+func (s *stubStore) LastSet() time.Time {
+	return s.lastSet
+}
+
 func (s *stubStore) Get() []binding.Binding {
 	return s.bindings
 }
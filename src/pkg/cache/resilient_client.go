@@ -0,0 +1,207 @@
+package cache
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	metrics "code.cloudfoundry.org/go-metric-registry"
+
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/binding"
+)
+
+// ErrCircuitOpen is returned while requests to the binding cache are
+// suspended and no last-known bindings can be served.
+var ErrCircuitOpen = errors.New("binding cache circuit is open")
+
+// BindingGetter fetches app and aggregate bindings from the binding cache.
+type BindingGetter interface {
+	Get() ([]binding.Binding, error)
+	GetAggregate() ([]binding.Binding, error)
+}
+
+// Metrics is used to create the metrics of the ResilientClient.
+type Metrics interface {
+	NewGauge(name, helpText string, opts ...metrics.MetricOption) metrics.Gauge
+	NewCounter(name, helpText string, opts ...metrics.MetricOption) metrics.Counter
+}
+
+// ResilientClientOption configures a ResilientClient.
+type ResilientClientOption func(*ResilientClient)
+
+// WithCircuitBreaker suspends requests to the binding cache for cooldown
+// after failures consecutive failed requests. After the cooldown a single
+// request is let through to probe whether the cache has recovered. A
+// failures value of zero disables circuit breaking.
+func WithCircuitBreaker(failures int, cooldown time.Duration) ResilientClientOption {
+	return func(c *ResilientClient) {
+		c.failureThreshold = failures
+		c.cooldown = cooldown
+	}
+}
+
+// WithStaleDuration sets how long the last-known bindings are served while
+// the binding cache is unavailable. Once exceeded no bindings are returned.
+// A duration of zero serves the last-known bindings indefinitely.
+func WithStaleDuration(d time.Duration) ResilientClientOption {
+	return func(c *ResilientClient) {
+		c.staleDuration = d
+	}
+}
+
+// WithResilientClientLogger sets the logger of the ResilientClient.
+func WithResilientClientLogger(l *log.Logger) ResilientClientOption {
+	return func(c *ResilientClient) {
+		c.log = l
+	}
+}
+
+// ResilientClient wraps a BindingGetter with client-side circuit
+// breaking and serves the last-known bindings while the cache is
+// unreachable.
+type ResilientClient struct {
+	getter           BindingGetter
+	failureThreshold int
+	cooldown         time.Duration
+	staleDuration    time.Duration
+	log              *log.Logger
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	lastKnown map[string]lastKnownBindings
+
+	freshFetches  metrics.Counter
+	staleFetches  metrics.Counter
+	failedFetches metrics.Counter
+	circuitOpen   metrics.Gauge
+}
+
+type lastKnownBindings struct {
+	bindings  []binding.Binding
+	fetchedAt time.Time
+}
+
+// NewResilientClient returns a ResilientClient wrapping g.
+func NewResilientClient(g BindingGetter, m Metrics, opts ...ResilientClientOption) *ResilientClient {
+	fetches := func(state string) metrics.Counter {
+		return m.NewCounter(
+			"binding_cache_fetches",
+			"Total number of binding fetches by whether fresh or last-known bindings were returned.",
+			metrics.WithMetricLabels(map[string]string{"state": state}),
+		)
+	}
+
+	c := &ResilientClient{
+		getter:        g,
+		log:           log.Default(),
+		lastKnown:     make(map[string]lastKnownBindings),
+		freshFetches:  fetches("fresh"),
+		staleFetches:  fetches("stale"),
+		failedFetches: fetches("failed"),
+		circuitOpen: m.NewGauge(
+			"binding_cache_circuit_open",
+			"Whether requests to the binding cache are currently suspended.",
+		),
+	}
+
+	for _, o := range opts {
+		o(c)
+	}
+
+	return c
+}
+
+// Get returns the app bindings.
+func (c *ResilientClient) Get() ([]binding.Binding, error) {
+	return c.fetch("bindings", c.getter.Get)
+}
+
+// GetAggregate returns the aggregate drains.
+func (c *ResilientClient) GetAggregate() ([]binding.Binding, error) {
+	return c.fetch("aggregate", c.getter.GetAggregate)
+}
+
+func (c *ResilientClient) fetch(key string, get func() ([]binding.Binding, error)) ([]binding.Binding, error) {
+	if c.isOpen() {
+		return c.stale(key, ErrCircuitOpen)
+	}
+
+	bindings, err := get()
+	if err != nil {
+		c.recordFailure()
+		return c.stale(key, err)
+	}
+	c.recordSuccess()
+
+	c.mu.Lock()
+	c.lastKnown[key] = lastKnownBindings{bindings: bindings, fetchedAt: time.Now()}
+	c.mu.Unlock()
+
+	c.freshFetches.Add(1)
+	return bindings, nil
+}
+
+// stale returns the last-known bindings for key if they are within the
+// stale duration. Bindings older than the stale duration are discarded so
+// that drains are torn down rather than kept indefinitely.
+func (c *ResilientClient) stale(key string, err error) ([]binding.Binding, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	lk, ok := c.lastKnown[key]
+	if !ok {
+		c.failedFetches.Add(1)
+		return nil, err
+	}
+
+	if c.staleDuration > 0 && time.Now().Sub(lk.fetchedAt) > c.staleDuration {
+		c.log.Printf("binding cache unavailable for longer than %s, discarding last-known %s: %s", c.staleDuration, key, err)
+		c.failedFetches.Add(1)
+		return []binding.Binding{}, nil
+	}
+
+	c.log.Printf("binding cache unavailable, serving last-known %s: %s", key, err)
+	c.staleFetches.Add(1)
+	return lk.bindings, nil
+}
+
+// isOpen reports whether requests to the binding cache are suspended. Once
+// the cooldown has passed the circuit is reported as closed again, and the
+// next failed request reopens it.
+func (c *ResilientClient) isOpen() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.openUntil.IsZero() {
+		return false
+	}
+	if time.Now().Before(c.openUntil) {
+		return true
+	}
+	c.openUntil = time.Time{}
+	c.circuitOpen.Set(0)
+	return false
+}
+
+func (c *ResilientClient) recordFailure() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.failures++
+	if c.failureThreshold > 0 && c.failures >= c.failureThreshold {
+		c.log.Printf("binding cache failed %d times, suspending requests for %s", c.failures, c.cooldown)
+		c.openUntil = time.Now().Add(c.cooldown)
+		c.circuitOpen.Set(1)
+	}
+}
+
+func (c *ResilientClient) recordSuccess() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.failures = 0
+	c.openUntil = time.Time{}
+	c.circuitOpen.Set(0)
+}
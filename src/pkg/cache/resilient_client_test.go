@@ -0,0 +1,204 @@
+package cache_test
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/binding"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/cache"
+)
+
+var _ = Describe("ResilientClient", func() {
+	var (
+		getter   *spyGetter
+		m        *metricsHelpers.SpyMetricsRegistry
+		bindings []binding.Binding
+		logger   = log.New(GinkgoWriter, "", 0)
+	)
+
+	BeforeEach(func() {
+		getter = &spyGetter{}
+		m = metricsHelpers.NewMetricsRegistry()
+		bindings = []binding.Binding{{Url: "syslog://drain-1"}}
+	})
+
+	fetches := func(state string) float64 {
+		return m.GetMetric("binding_cache_fetches", map[string]string{"state": state}).Value()
+	}
+
+	It("returns fresh bindings from the cache", func() {
+		getter.bindings = bindings
+		c := cache.NewResilientClient(getter, m, cache.WithResilientClientLogger(logger))
+
+		Expect(c.Get()).To(Equal(bindings))
+		Expect(c.GetAggregate()).To(Equal(bindings))
+		Expect(fetches("fresh")).To(Equal(2.0))
+	})
+
+	It("returns the error if there are no last-known bindings", func() {
+		getter.err = errors.New("unreachable")
+		c := cache.NewResilientClient(getter, m, cache.WithResilientClientLogger(logger))
+
+		_, err := c.Get()
+		Expect(err).To(MatchError("unreachable"))
+		Expect(fetches("failed")).To(Equal(1.0))
+	})
+
+	It("serves the last-known bindings while the cache is unavailable", func() {
+		getter.bindings = bindings
+		c := cache.NewResilientClient(getter, m, cache.WithResilientClientLogger(logger))
+		Expect(c.Get()).To(Equal(bindings))
+
+		getter.setErr(errors.New("unreachable"))
+
+		Expect(c.Get()).To(Equal(bindings))
+		Expect(fetches("stale")).To(Equal(1.0))
+	})
+
+	It("keeps last-known bindings separately for app and aggregate drains", func() {
+		getter.bindings = bindings
+		c := cache.NewResilientClient(getter, m, cache.WithResilientClientLogger(logger))
+		Expect(c.Get()).To(Equal(bindings))
+
+		getter.setErr(errors.New("unreachable"))
+
+		_, err := c.GetAggregate()
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("discards last-known bindings after the stale duration", func() {
+		getter.bindings = bindings
+		c := cache.NewResilientClient(
+			getter,
+			m,
+			cache.WithStaleDuration(10*time.Millisecond),
+			cache.WithResilientClientLogger(logger),
+		)
+		Expect(c.Get()).To(Equal(bindings))
+
+		getter.setErr(errors.New("unreachable"))
+		time.Sleep(20 * time.Millisecond)
+
+		Expect(c.Get()).To(BeEmpty())
+		Expect(fetches("failed")).To(Equal(1.0))
+	})
+
+	It("stops calling the cache after consecutive failures", func() {
+		getter.err = errors.New("unreachable")
+		c := cache.NewResilientClient(
+			getter,
+			m,
+			cache.WithCircuitBreaker(2, time.Hour),
+			cache.WithResilientClientLogger(logger),
+		)
+
+		_, _ = c.Get()
+		_, _ = c.Get()
+		_, err := c.Get()
+
+		Expect(err).To(MatchError(cache.ErrCircuitOpen))
+		Expect(getter.calls()).To(Equal(2))
+		Expect(m.GetMetric("binding_cache_circuit_open", nil).Value()).To(Equal(1.0))
+	})
+
+	It("probes the cache again after the cooldown", func() {
+		getter.err = errors.New("unreachable")
+		c := cache.NewResilientClient(
+			getter,
+			m,
+			cache.WithCircuitBreaker(1, 10*time.Millisecond),
+			cache.WithResilientClientLogger(logger),
+		)
+		_, _ = c.Get()
+
+		getter.setErr(nil)
+		getter.bindings = bindings
+		time.Sleep(20 * time.Millisecond)
+
+		Expect(c.Get()).To(Equal(bindings))
+		Expect(m.GetMetric("binding_cache_circuit_open", nil).Value()).To(Equal(0.0))
+	})
+
+	It("reports the circuit as closed while the cache recovers after the cooldown", func() {
+		getter.err = errors.New("unreachable")
+		c := cache.NewResilientClient(
+			getter,
+			m,
+			cache.WithCircuitBreaker(1, 10*time.Millisecond),
+			cache.WithResilientClientLogger(logger),
+		)
+		_, _ = c.Get()
+		Expect(m.GetMetric("binding_cache_circuit_open", nil).Value()).To(Equal(1.0))
+
+		getter.setErr(nil)
+		getter.onGet = func() {
+			Expect(m.GetMetric("binding_cache_circuit_open", nil).Value()).To(Equal(0.0))
+		}
+		time.Sleep(20 * time.Millisecond)
+
+		_, err := c.Get()
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("reopens the circuit when the cache still fails after the cooldown", func() {
+		getter.err = errors.New("unreachable")
+		c := cache.NewResilientClient(
+			getter,
+			m,
+			cache.WithCircuitBreaker(1, 10*time.Millisecond),
+			cache.WithResilientClientLogger(logger),
+		)
+		_, _ = c.Get()
+		time.Sleep(20 * time.Millisecond)
+
+		_, _ = c.Get()
+		_, err := c.Get()
+
+		Expect(err).To(MatchError(cache.ErrCircuitOpen))
+		Expect(getter.calls()).To(Equal(2))
+		Expect(m.GetMetric("binding_cache_circuit_open", nil).Value()).To(Equal(1.0))
+	})
+})
+
+type spyGetter struct {
+	mu       sync.Mutex
+	bindings []binding.Binding
+	err      error
+	count    int
+	onGet    func()
+}
+
+func (s *spyGetter) Get() ([]binding.Binding, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.count++
+	if s.onGet != nil {
+		s.onGet()
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.bindings, nil
+}
+
+func (s *spyGetter) GetAggregate() ([]binding.Binding, error) {
+	return s.Get()
+}
+
+func (s *spyGetter) setErr(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+func (s *spyGetter) calls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count
+}
@@ -0,0 +1,173 @@
+package cache
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/binding"
+)
+
+// latencySamples is the number of most recent requests per endpoint that
+// latency percentiles are calculated from.
+const latencySamples = 1000
+
+// StatsGetter is a store of bindings that knows when it was last updated.
+type StatsGetter interface {
+	Getter
+	LastSet() time.Time
+}
+
+// Stats describes the state of the binding cache for diagnosing delays in
+// the propagation of drains.
+type Stats struct {
+	// Bindings is the number of drain URLs with bindings.
+	Bindings int `json:"bindings"`
+	// BindingsByType counts the drain URLs by the data they receive: logs,
+	// metrics, traces or all.
+	BindingsByType map[string]int `json:"bindings_by_type"`
+	// BindingsByScheme counts the drain URLs by URL scheme.
+	BindingsByScheme map[string]int `json:"bindings_by_scheme"`
+	AggregateDrains  int            `json:"aggregate_drains"`
+	// Apps is the number of apps with at least one binding.
+	Apps int `json:"apps"`
+	// LastSync is the time of the last successful poll of the Cloud
+	// Controller, or null if there was none yet.
+	LastSync           *time.Time `json:"last_sync"`
+	LastSyncAgeSeconds float64    `json:"last_sync_age_seconds"`
+	// Endpoints are the serve latencies by endpoint.
+	Endpoints map[string]EndpointStats `json:"endpoints"`
+}
+
+// EndpointStats are the requests served by an endpoint and the
+// percentiles of their latency over the most recent requests.
+type EndpointStats struct {
+	Requests   uint64  `json:"requests"`
+	P50Seconds float64 `json:"p50_seconds"`
+	P90Seconds float64 `json:"p90_seconds"`
+	P99Seconds float64 `json:"p99_seconds"`
+}
+
+// ServeLatencies records the latencies of the requests served per
+// endpoint.
+type ServeLatencies struct {
+	mu        sync.Mutex
+	endpoints map[string]*latencies
+}
+
+type latencies struct {
+	requests uint64
+	samples  []time.Duration
+}
+
+// NewServeLatencies returns an empty ServeLatencies.
+func NewServeLatencies() *ServeLatencies {
+	return &ServeLatencies{endpoints: make(map[string]*latencies)}
+}
+
+// Handler returns a handler that serves requests with h and records their
+// latency for the endpoint.
+func (s *ServeLatencies) Handler(endpoint string, h http.Handler) http.HandlerFunc {
+	s.mu.Lock()
+	s.endpoints[endpoint] = &latencies{}
+	s.mu.Unlock()
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		h.ServeHTTP(w, r)
+		s.record(endpoint, time.Since(start))
+	}
+}
+
+func (s *ServeLatencies) record(endpoint string, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l := s.endpoints[endpoint]
+	if len(l.samples) < latencySamples {
+		l.samples = append(l.samples, d)
+	} else {
+		l.samples[l.requests%latencySamples] = d
+	}
+	l.requests++
+}
+
+func (s *ServeLatencies) stats() map[string]EndpointStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := make(map[string]EndpointStats, len(s.endpoints))
+	for endpoint, l := range s.endpoints {
+		sorted := slices.Clone(l.samples)
+		slices.Sort(sorted)
+		stats[endpoint] = EndpointStats{
+			Requests:   l.requests,
+			P50Seconds: percentile(sorted, 0.5).Seconds(),
+			P90Seconds: percentile(sorted, 0.9).Seconds(),
+			P99Seconds: percentile(sorted, 0.99).Seconds(),
+		}
+	}
+	return stats
+}
+
+// percentile returns the nearest rank percentile of the sorted latencies.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(p*float64(len(sorted))+0.5) - 1
+	return sorted[max(0, min(i, len(sorted)-1))]
+}
+
+// StatsHandler serves the Stats of the binding cache as JSON.
+func StatsHandler(store StatsGetter, aggregate AggregateGetter, l *ServeLatencies) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bindings := store.Get()
+		stats := Stats{
+			Bindings:         len(bindings),
+			BindingsByType:   make(map[string]int),
+			BindingsByScheme: make(map[string]int),
+			AggregateDrains:  len(aggregate.Get()),
+			Apps:             binding.CalculateBindingCount(bindings),
+			Endpoints:        l.stats(),
+		}
+		for _, b := range bindings {
+			drainType, scheme := classify(b.Url)
+			stats.BindingsByType[drainType]++
+			stats.BindingsByScheme[scheme]++
+		}
+		if t := store.LastSet(); !t.IsZero() {
+			stats.LastSync = &t
+			stats.LastSyncAgeSeconds = time.Since(t).Seconds()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		err := json.NewEncoder(w).Encode(stats)
+		if err != nil {
+			log.Printf("failed to encode response body: %s", err)
+		}
+	}
+}
+
+// classify returns the type of data a drain receives and its URL scheme.
+// The drain-data parameter takes precedence over drain-type, as it does
+// for the syslog agent.
+func classify(drainURL string) (drainType, scheme string) {
+	u, err := url.Parse(drainURL)
+	if err != nil {
+		return "unknown", "unknown"
+	}
+
+	drainType = "logs"
+	if t := u.Query().Get("drain-type"); t != "" {
+		drainType = t
+	}
+	if d := u.Query().Get("drain-data"); d != "" {
+		drainType = d
+	}
+	return drainType, u.Scheme
+}
@@ -0,0 +1,99 @@
+package cache_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/binding"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/cache"
+)
+
+var _ = Describe("StatsHandler", func() {
+	getStats := func(h http.Handler) cache.Stats {
+		rw := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodGet, "/debug/stats", nil)
+		Expect(err).ToNot(HaveOccurred())
+		h.ServeHTTP(rw, req)
+
+		Expect(rw.Code).To(Equal(http.StatusOK))
+		Expect(rw.Header().Get("Content-Type")).To(Equal("application/json"))
+		var stats cache.Stats
+		Expect(json.Unmarshal(rw.Body.Bytes(), &stats)).To(Succeed())
+		return stats
+	}
+
+	It("reports the bindings and the last sync", func() {
+		store := newStubStore([]binding.Binding{
+			{
+				Url: "syslog-tls://drain-1?drain-type=metrics",
+				Credentials: []binding.Credentials{
+					{Apps: []binding.App{{AppID: "app-1"}, {AppID: "app-2"}}},
+				},
+			},
+			{
+				Url: "https://drain-2?drain-data=all",
+				Credentials: []binding.Credentials{
+					{Apps: []binding.App{{AppID: "app-1"}}},
+				},
+			},
+			{
+				Url: "syslog-tls://drain-3",
+				Credentials: []binding.Credentials{
+					{Apps: []binding.App{{AppID: "app-3"}}},
+				},
+			},
+		})
+		store.lastSet = time.Now().Add(-time.Minute)
+		aggregate := newStubAggregateStore([]binding.Binding{{Url: "syslog://aggregate"}})
+
+		stats := getStats(cache.StatsHandler(store, aggregate, cache.NewServeLatencies()))
+
+		Expect(stats.Bindings).To(Equal(3))
+		Expect(stats.BindingsByType).To(Equal(map[string]int{"metrics": 1, "all": 1, "logs": 1}))
+		Expect(stats.BindingsByScheme).To(Equal(map[string]int{"syslog-tls": 2, "https": 1}))
+		Expect(stats.AggregateDrains).To(Equal(1))
+		Expect(stats.Apps).To(Equal(3))
+		Expect(stats.LastSync).ToNot(BeNil())
+		Expect(*stats.LastSync).To(BeTemporally("~", store.lastSet, time.Millisecond))
+		Expect(stats.LastSyncAgeSeconds).To(BeNumerically("~", 60, 1))
+	})
+
+	It("reports no last sync before the first sync", func() {
+		stats := getStats(cache.StatsHandler(newStubStore(nil), newStubAggregateStore(nil), cache.NewServeLatencies()))
+
+		Expect(stats.LastSync).To(BeNil())
+		Expect(stats.Bindings).To(BeZero())
+	})
+
+	It("reports the serve latency percentiles per endpoint", func() {
+		latencies := cache.NewServeLatencies()
+		var delay time.Duration
+		slow := latencies.Handler("/v2/bindings", http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+			time.Sleep(delay)
+		}))
+		latencies.Handler("/v2/aggregate", http.NotFoundHandler())
+
+		for i := 0; i < 10; i++ {
+			delay = time.Millisecond
+			if i == 9 {
+				delay = 50 * time.Millisecond
+			}
+			slow.ServeHTTP(httptest.NewRecorder(), &http.Request{})
+		}
+
+		stats := getStats(cache.StatsHandler(newStubStore(nil), newStubAggregateStore(nil), latencies))
+
+		Expect(stats.Endpoints).To(HaveLen(2))
+		Expect(stats.Endpoints["/v2/aggregate"]).To(Equal(cache.EndpointStats{}))
+		bindings := stats.Endpoints["/v2/bindings"]
+		Expect(bindings.Requests).To(Equal(uint64(10)))
+		Expect(bindings.P50Seconds).To(BeNumerically("<", 0.05))
+		Expect(bindings.P90Seconds).To(BeNumerically("<", 0.05))
+		Expect(bindings.P99Seconds).To(BeNumerically(">=", 0.05))
+	})
+})
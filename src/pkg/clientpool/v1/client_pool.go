@@ -1,6 +1,7 @@
 package v1
 
 import (
+	"context"
 	"errors"
 	"math/rand"
 	"sync/atomic"
@@ -8,7 +9,7 @@ import (
 )
 
 type Conn interface {
-	Write(data []byte) (err error)
+	Write(ctx context.Context, data []byte) (err error)
 }
 
 type ClientPool struct {
@@ -27,13 +28,19 @@ func New(conns ...Conn) *ClientPool {
 	return pool
 }
 
-func (c *ClientPool) Write(msg []byte) error {
+// Write writes the message to one of the connections. Connections are
+// tried in random order until a write succeeds or ctx is done.
+func (c *ClientPool) Write(ctx context.Context, msg []byte) error {
 	seed := rand.Int() //nolint:gosec
 	for i := range c.conns {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		idx := (i + seed) % len(c.conns)
 		conn := *(*Conn)(atomic.LoadPointer(&c.conns[idx]))
 
-		if err := conn.Write(msg); err == nil {
+		if err := conn.Write(ctx, msg); err == nil {
 			return nil
 		}
 	}
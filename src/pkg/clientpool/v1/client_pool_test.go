@@ -1,6 +1,7 @@
 package v1_test
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 
@@ -36,12 +37,12 @@ var _ = Describe("ClientPool", func() {
 			})
 
 			It("returns an error", func() {
-				err := pool.Write([]byte("some-data"))
+				err := pool.Write(context.Background(), []byte("some-data"))
 				Expect(err).ToNot(Succeed())
 			})
 
 			It("tries all conns before erroring", func() {
-				err := pool.Write([]byte("some-data"))
+				err := pool.Write(context.Background(), []byte("some-data"))
 				Expect(err).ToNot(Succeed())
 
 				for len(mockConns) > 0 {
@@ -60,13 +61,13 @@ var _ = Describe("ClientPool", func() {
 			})
 
 			It("returns a nil error", func() {
-				err := pool.Write([]byte("some-data"))
+				err := pool.Write(context.Background(), []byte("some-data"))
 				Expect(err).To(Succeed())
 			})
 
 			It("uses the given data once", func() {
 				data := []byte("some-data")
-				err := pool.Write(data)
+				err := pool.Write(context.Background(), data)
 				Expect(err).To(Succeed())
 
 				idx, msg := chooseData(mockConns)
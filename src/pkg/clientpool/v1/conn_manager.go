@@ -1,6 +1,7 @@
 package v1
 
 import (
+	"context"
 	"errors"
 	"io"
 	"log"
@@ -43,7 +44,12 @@ func NewConnManager(c Connector, maxWrites int64, pollDuration time.Duration) *C
 	return m
 }
 
-func (m *ConnManager) Write(data []byte) error {
+// Write sends the data on the current connection unless ctx is done.
+func (m *ConnManager) Write(ctx context.Context, data []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	conn := atomic.LoadPointer(&m.conn)
 	if conn == nil || (*grpcConn)(conn) == nil {
 		return errors.New("no connection to doppler present")
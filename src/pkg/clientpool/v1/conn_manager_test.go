@@ -1,6 +1,7 @@
 package v1_test
 
 import (
+	"context"
 	"errors"
 	"time"
 
@@ -41,7 +42,7 @@ var _ = Describe("ConnManager", func() {
 			It("sends the message down the connection", func() {
 				msg := []byte("some-data")
 				f := func() error {
-					return connManager.Write(msg)
+					return connManager.Write(context.Background(), msg)
 				}
 				Eventually(f).Should(Succeed())
 
@@ -63,7 +64,7 @@ var _ = Describe("ConnManager", func() {
 				It("recycles the connections after max writes and reconnects", func() {
 					msg := []byte("some-data")
 					f := func() int {
-						_ = connManager.Write(msg)
+						_ = connManager.Write(context.Background(), msg)
 						return len(mockConnector.ConnectCalled)
 					}
 					Eventually(f).Should(Equal(2))
@@ -77,7 +78,7 @@ var _ = Describe("ConnManager", func() {
 			BeforeEach(func() {
 				mockPusherClient.SendOutput.Ret0 <- nil
 				f := func() error {
-					return connManager.Write([]byte("some-data"))
+					return connManager.Write(context.Background(), []byte("some-data"))
 				}
 				Eventually(f).Should(Succeed())
 
@@ -86,7 +87,7 @@ var _ = Describe("ConnManager", func() {
 			})
 
 			It("returns an error and closes the closer", func() {
-				err := connManager.Write([]byte("some-data"))
+				err := connManager.Write(context.Background(), []byte("some-data"))
 				Expect(err).To(HaveOccurred())
 				Expect(mockCloser.CloseCalled).To(HaveLen(1))
 			})
@@ -114,7 +115,7 @@ var _ = Describe("ConnManager", func() {
 
 		It("always returns an error", func() {
 			f := func() error {
-				return connManager.Write([]byte("some-data"))
+				return connManager.Write(context.Background(), []byte("some-data"))
 			}
 			Consistently(f).Should(HaveOccurred())
 
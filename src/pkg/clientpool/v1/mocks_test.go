@@ -11,6 +11,7 @@ import (
 type mockConn struct {
 	WriteCalled chan bool
 	WriteInput  struct {
+		Ctx  chan context.Context
 		Data chan []byte
 	}
 	WriteOutput struct {
@@ -21,12 +22,14 @@ type mockConn struct {
 func newMockConn() *mockConn {
 	m := &mockConn{}
 	m.WriteCalled = make(chan bool, 100)
+	m.WriteInput.Ctx = make(chan context.Context, 100)
 	m.WriteInput.Data = make(chan []byte, 100)
 	m.WriteOutput.Err = make(chan error, 100)
 	return m
 }
-func (m *mockConn) Write(data []byte) (err error) {
+func (m *mockConn) Write(ctx context.Context, data []byte) (err error) {
 	m.WriteCalled <- true
+	m.WriteInput.Ctx <- ctx
 	m.WriteInput.Data <- data
 	return <-m.WriteOutput.Err
 }
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math/rand"
 	"net"
+	"sort"
 )
 
 // Balancer provides IPs resolved from a DNS address in random order
@@ -63,3 +64,29 @@ func (b *Balancer) NextHostPort() (string, error) {
 	}
 	return net.JoinHostPort(ips[b.randSource()%len(ips)].String(), port), nil //nolint:gosec // randomly pick an IP not a security issue
 }
+
+// HostPorts returns all hostports resolved from the balancer's addr,
+// sorted. It returns error for an invalid addr or if lookup failed or
+// doesn't resolve to anything.
+func (b *Balancer) HostPorts() ([]string, error) {
+	host, port, err := net.SplitHostPort(b.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	ips, err := b.lookup(host)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("lookup failed with addr %s", b.addr)
+	}
+
+	hostPorts := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		hostPorts = append(hostPorts, net.JoinHostPort(ip.String(), port))
+	}
+	sort.Strings(hostPorts)
+	return hostPorts, nil
+}
@@ -0,0 +1,41 @@
+package v2
+
+import (
+	"fmt"
+
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/protobuf/proto"
+)
+
+// marshalledBatch is a loggregator_v2.EnvelopeBatch that has already been
+// marshalled, e.g. by an egress_v2.BatchMarshaller.
+type marshalledBatch []byte
+
+// batchCodec is the proto codec, except that it sends marshalled batches
+// as they are. It is forced on the streams of the SenderFetcher.
+type batchCodec struct{}
+
+var _ encoding.Codec = batchCodec{}
+
+func (batchCodec) Marshal(v any) ([]byte, error) {
+	switch m := v.(type) {
+	case marshalledBatch:
+		return m, nil
+	case proto.Message:
+		return proto.Marshal(m)
+	default:
+		return nil, fmt.Errorf("failed to marshal, message is %T, want proto.Message", v)
+	}
+}
+
+func (batchCodec) Unmarshal(data []byte, v any) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("failed to unmarshal, message is %T, want proto.Message", v)
+	}
+	return proto.Unmarshal(data, m)
+}
+
+func (batchCodec) Name() string {
+	return "proto"
+}
@@ -1,20 +1,26 @@
 package v2
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"math/rand"
+	"sync"
 	"sync/atomic"
 	"unsafe"
 
 	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+
+	egress_v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
 )
 
 type Conn interface {
-	Write(data []*loggregator_v2.Envelope) (err error)
+	Write(ctx context.Context, data []*loggregator_v2.Envelope) (err error)
 }
 
 type ClientPool struct {
-	conns []unsafe.Pointer
+	conns           []unsafe.Pointer
+	orderBySourceID bool
 }
 
 func New(conns ...Conn) *ClientPool {
@@ -28,16 +34,75 @@ func New(conns ...Conn) *ClientPool {
 	return pool
 }
 
-func (c *ClientPool) Write(msgs []*loggregator_v2.Envelope) error {
+// NewOrdered returns a ClientPool that writes all envelopes of a source ID
+// to the same connection, so that they keep their order. Envelopes of
+// different source IDs are written to their connections in parallel. A
+// failed connection is not replaced by another one, so the envelopes of
+// its source IDs are dropped until it reconnects.
+func NewOrdered(conns ...Conn) *ClientPool {
+	pool := New(conns...)
+	pool.orderBySourceID = true
+	return pool
+}
+
+// Write writes the envelopes to one of the connections. Connections are
+// tried in random order until a write succeeds or ctx is done.
+func (c *ClientPool) Write(ctx context.Context, msgs []*loggregator_v2.Envelope) error {
+	if c.orderBySourceID {
+		return c.writeOrdered(ctx, msgs)
+	}
+
 	seed := rand.Int() //nolint:gosec
 	for i := range c.conns {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		idx := (i + seed) % len(c.conns)
 		conn := *(*Conn)(atomic.LoadPointer(&c.conns[idx]))
 
-		if err := conn.Write(msgs); err == nil {
+		if err := conn.Write(ctx, msgs); err == nil {
 			return nil
 		}
 	}
 
 	return errors.New("unable to write to any dopplers")
 }
+
+// writeOrdered writes the envelopes of each source ID to the connection of
+// its lane.
+func (c *ClientPool) writeOrdered(ctx context.Context, msgs []*loggregator_v2.Envelope) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	batches := make([][]*loggregator_v2.Envelope, len(c.conns))
+	for _, e := range msgs {
+		i := egress_v2.LaneIndex(e.GetSourceId(), len(c.conns))
+		batches[i] = append(batches[i], e)
+	}
+
+	var (
+		wg     sync.WaitGroup
+		failed int64
+	)
+	for i, batch := range batches {
+		if len(batch) == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, batch []*loggregator_v2.Envelope) {
+			defer wg.Done()
+			conn := *(*Conn)(atomic.LoadPointer(&c.conns[i]))
+			if err := conn.Write(ctx, batch); err != nil {
+				atomic.AddInt64(&failed, int64(len(batch)))
+			}
+		}(i, batch)
+	}
+	wg.Wait()
+
+	if failed > 0 {
+		return fmt.Errorf("unable to write %d of %d envelopes to dopplers", failed, len(msgs))
+	}
+	return nil
+}
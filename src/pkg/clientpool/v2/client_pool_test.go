@@ -1,10 +1,12 @@
 package v2_test
 
 import (
+	"context"
 	"fmt"
 
 	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
 	clientpool "code.cloudfoundry.org/loggregator-agent-release/src/pkg/clientpool/v2"
+	egress_v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -15,7 +17,7 @@ type SpyConn struct {
 	data []*loggregator_v2.Envelope
 }
 
-func (s *SpyConn) Write(e []*loggregator_v2.Envelope) error {
+func (s *SpyConn) Write(_ context.Context, e []*loggregator_v2.Envelope) error {
 	s.data = append(s.data, e...)
 	return s.err
 }
@@ -46,12 +48,12 @@ var _ = Describe("ClientPool", func() {
 			})
 
 			It("returns an error", func() {
-				err := pool.Write(nil)
+				err := pool.Write(context.Background(), nil)
 				Expect(err.Error()).To(Equal("unable to write to any dopplers"))
 			})
 
 			It("tries all conns before erroring", func() {
-				err := pool.Write([]*loggregator_v2.Envelope{{SourceId: "some-uuid"}})
+				err := pool.Write(context.Background(), []*loggregator_v2.Envelope{{SourceId: "some-uuid"}})
 				Expect(err).To(HaveOccurred())
 
 				for len(conns) > 0 {
@@ -64,15 +66,68 @@ var _ = Describe("ClientPool", func() {
 
 		Context("all conns succeed", func() {
 			It("returns a nil error", func() {
-				Expect(pool.Write(nil)).To(Succeed())
+				Expect(pool.Write(context.Background(), nil)).To(Succeed())
 			})
 
 			It("writes only to one connection", func() {
-				Expect(pool.Write([]*loggregator_v2.Envelope{{SourceId: "some-uuid"}})).To(Succeed())
+				Expect(pool.Write(context.Background(), []*loggregator_v2.Envelope{{SourceId: "some-uuid"}})).To(Succeed())
 
 				Expect(envelopeCount(conns)).To(Equal(1))
 			})
 		})
+
+		Context("with a done context", func() {
+			It("returns the context error without writing", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+
+				err := pool.Write(ctx, []*loggregator_v2.Envelope{{SourceId: "some-uuid"}})
+				Expect(err).To(MatchError(context.Canceled))
+				Expect(envelopeCount(conns)).To(Equal(0))
+			})
+		})
+	})
+
+	Describe("NewOrdered()", func() {
+		BeforeEach(func() {
+			var poolConns []clientpool.Conn
+			for _, c := range conns {
+				poolConns = append(poolConns, c)
+			}
+			pool = clientpool.NewOrdered(poolConns...)
+		})
+
+		It("writes all envelopes of a source ID to the same connection in order", func() {
+			for i := 0; i < 3; i++ {
+				Expect(pool.Write(context.Background(), []*loggregator_v2.Envelope{
+					{SourceId: "some-uuid", Timestamp: int64(i)},
+					{SourceId: "other-uuid", Timestamp: int64(i)},
+				})).To(Succeed())
+			}
+
+			for _, id := range []string{"some-uuid", "other-uuid"} {
+				c := conns[egress_v2.LaneIndex(id, len(conns))]
+				var timestamps []int64
+				for _, e := range c.data {
+					if e.GetSourceId() == id {
+						timestamps = append(timestamps, e.GetTimestamp())
+					}
+				}
+				Expect(timestamps).To(Equal([]int64{0, 1, 2}))
+			}
+			Expect(envelopeCount(conns)).To(Equal(6))
+		})
+
+		It("does not write to other connections if a connection fails", func() {
+			c := conns[egress_v2.LaneIndex("some-uuid", len(conns))]
+			c.err = fmt.Errorf("some-error")
+
+			err := pool.Write(context.Background(), []*loggregator_v2.Envelope{{SourceId: "some-uuid"}})
+
+			Expect(err).To(MatchError("unable to write 1 of 1 envelopes to dopplers"))
+			Expect(envelopeCount(conns)).To(Equal(1))
+			Expect(c.data).To(HaveLen(1))
+		})
 	})
 })
 
@@ -1,14 +1,18 @@
 package v2
 
 import (
+	"context"
 	"errors"
 	"io"
 	"log"
+	"sync"
 	"sync/atomic"
 	"time"
 	"unsafe"
 
 	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+
+	egress_v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
 )
 
 type Connector interface {
@@ -26,31 +30,56 @@ type ConnManager struct {
 	maxWrites    int64
 	pollDuration time.Duration
 	connector    Connector
+	marshaller   *egress_v2.BatchMarshaller
 
 	ticker *time.Ticker
 	reset  chan bool
+	done   chan struct{}
+	// mu guards storing new connections against Close.
+	mu     sync.Mutex
+	closed bool
+}
+
+// ConnManagerOption configures a ConnManager.
+type ConnManagerOption func(*ConnManager)
+
+// WithBatchMarshaller marshals the batches with m before they are sent
+// instead of on the stream. It requires the streams of a SenderFetcher.
+func WithBatchMarshaller(m *egress_v2.BatchMarshaller) ConnManagerOption {
+	return func(c *ConnManager) {
+		c.marshaller = m
+	}
 }
 
-func NewConnManager(c Connector, maxWrites int64, pollDuration time.Duration) *ConnManager {
+func NewConnManager(c Connector, maxWrites int64, pollDuration time.Duration, opts ...ConnManagerOption) *ConnManager {
 	m := &ConnManager{
 		maxWrites:    maxWrites,
 		pollDuration: pollDuration,
 		connector:    c,
 		ticker:       time.NewTicker(pollDuration),
 		reset:        make(chan bool, 100),
+		done:         make(chan struct{}),
+	}
+	for _, o := range opts {
+		o(m)
 	}
 	go m.maintainConn()
 	return m
 }
 
-func (m *ConnManager) Write(envelopes []*loggregator_v2.Envelope) error {
+// Write sends the envelopes on the current connection unless ctx is done.
+func (m *ConnManager) Write(ctx context.Context, envelopes []*loggregator_v2.Envelope) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	conn := atomic.LoadPointer(&m.conn)
 	if conn == nil || (*v2GRPCConn)(conn) == nil {
 		return errors.New("no connection to doppler present")
 	}
 
 	gRPCConn := (*v2GRPCConn)(conn)
-	err := gRPCConn.client.Send(&loggregator_v2.EnvelopeBatch{Batch: envelopes})
+	err := m.send(gRPCConn.client, envelopes)
 
 	if err != nil {
 		log.Printf("error writing to doppler: %s", err)
@@ -70,13 +99,27 @@ func (m *ConnManager) Write(envelopes []*loggregator_v2.Envelope) error {
 	return nil
 }
 
+func (m *ConnManager) send(client loggregator_v2.Ingress_BatchSenderClient, envelopes []*loggregator_v2.Envelope) error {
+	if m.marshaller == nil {
+		return client.Send(&loggregator_v2.EnvelopeBatch{Batch: envelopes})
+	}
+
+	b, err := m.marshaller.Marshal(envelopes)
+	if err != nil {
+		return err
+	}
+	return client.SendMsg(marshalledBatch(b))
+}
+
 func (m *ConnManager) maintainConn() {
 
 	// Ensure initial connection does not wait on timer
 	m.reset <- true
 
 	for {
-		m.checkConnectionTimer()
+		if !m.checkConnectionTimer() {
+			return
+		}
 
 		conn := atomic.LoadPointer(&m.conn)
 		if conn != nil && (*v2GRPCConn)(conn) != nil {
@@ -89,16 +132,44 @@ func (m *ConnManager) maintainConn() {
 			continue
 		}
 
+		m.mu.Lock()
+		if m.closed {
+			m.mu.Unlock()
+			closer.Close()
+			return
+		}
 		atomic.StorePointer(&m.conn, unsafe.Pointer(&v2GRPCConn{
 			client: senderClient,
 			closer: closer,
 		}))
+		m.mu.Unlock()
 	}
 }
 
-func (m *ConnManager) checkConnectionTimer() {
+// checkConnectionTimer waits until the connection should be checked. It
+// returns false once the ConnManager is closed.
+func (m *ConnManager) checkConnectionTimer() bool {
 	select {
 	case <-m.ticker.C:
 	case <-m.reset:
+	case <-m.done:
+		return false
+	}
+	return true
+}
+
+// Close stops maintaining the connection and closes the current
+// connection.
+func (m *ConnManager) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return
+	}
+	m.closed = true
+	close(m.done)
+	m.ticker.Stop()
+	if conn := atomic.SwapPointer(&m.conn, nil); conn != nil && (*v2GRPCConn)(conn) != nil {
+		(*v2GRPCConn)(conn).closer.Close()
 	}
 }
@@ -1,6 +1,7 @@
 package v2_test
 
 import (
+	"context"
 	"errors"
 	"io"
 	"sync"
@@ -82,7 +83,7 @@ var _ = Describe("ConnManager", func() {
 		It("sends the message down the connection", func() {
 			e := &loggregator_v2.Envelope{SourceId: "some-uuid"}
 			f := func() error {
-				return connManager.Write([]*loggregator_v2.Envelope{e})
+				return connManager.Write(context.Background(), []*loggregator_v2.Envelope{e})
 			}
 			Eventually(f).Should(Succeed())
 
@@ -93,7 +94,7 @@ var _ = Describe("ConnManager", func() {
 		It("recycles the connections after max writes", func() {
 			e := &loggregator_v2.Envelope{SourceId: "some-uuid"}
 			f := func() int {
-				_ = connManager.Write([]*loggregator_v2.Envelope{e})
+				_ = connManager.Write(context.Background(), []*loggregator_v2.Envelope{e})
 				return connector.called()
 			}
 			Eventually(f).Should(Equal(2))
@@ -103,7 +104,7 @@ var _ = Describe("ConnManager", func() {
 		Context("when Send() returns an error", func() {
 			BeforeEach(func() {
 				f := func() error {
-					return connManager.Write(nil)
+					return connManager.Write(context.Background(), nil)
 				}
 				Eventually(f).Should(Succeed())
 			})
@@ -112,7 +113,7 @@ var _ = Describe("ConnManager", func() {
 				expectedErr := errors.New("It is the error")
 				senderClient.err = expectedErr
 
-				actualErr := connManager.Write([]*loggregator_v2.Envelope{{SourceId: "some-uuid"}})
+				actualErr := connManager.Write(context.Background(), []*loggregator_v2.Envelope{{SourceId: "some-uuid"}})
 				Expect(actualErr).To(Equal(expectedErr))
 				Expect(closer.called).To(Equal(1))
 			})
@@ -129,7 +130,7 @@ var _ = Describe("ConnManager", func() {
 
 		It("always returns an error", func() {
 			f := func() error {
-				return connManager.Write(nil)
+				return connManager.Write(context.Background(), nil)
 			}
 			Consistently(f).Should(HaveOccurred())
 		})
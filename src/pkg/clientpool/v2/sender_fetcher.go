@@ -50,7 +50,8 @@ func (p *SenderFetcher) Fetch(addr string) (io.Closer, loggregator_v2.Ingress_Ba
 	}
 
 	client := loggregator_v2.NewIngressClient(conn)
-	sender, err := client.BatchSender(context.Background())
+	// The codec lets the ConnManager send batches it has marshalled.
+	sender, err := client.BatchSender(context.Background(), grpc.ForceCodec(batchCodec{}))
 	if err != nil {
 		conn.Close()
 		return nil, nil, fmt.Errorf("failed to establish stream to doppler (%s): %s", addr, err)
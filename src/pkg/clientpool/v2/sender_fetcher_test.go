@@ -1,12 +1,15 @@
 package v2_test
 
 import (
+	"fmt"
 	"io"
 	"net"
+	"time"
 
 	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
 	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
 	v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/clientpool/v2"
+	egress_v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
@@ -69,6 +72,36 @@ var _ = Describe("PusherFetcher", func() {
 		Expect(mc.GetMetric("doppler_v2_streams", tags).Value()).To(Equal(float64(0)))
 	})
 
+	It("sends batches marshalled by a ConnManager", func() {
+		server := newSpyIngestorServer()
+		Expect(server.Start()).To(Succeed())
+		defer server.Stop()
+
+		fetcher := v2.NewSenderFetcher(mc, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		connManager := v2.NewConnManager(
+			fetcherConnector{fetcher: fetcher, addr: server.addr},
+			100,
+			time.Minute,
+			v2.WithBatchMarshaller(egress_v2.NewBatchMarshaller(4)),
+		)
+		defer connManager.Close()
+
+		envs := make([]*loggregator_v2.Envelope, 1000)
+		for i := range envs {
+			envs[i] = &loggregator_v2.Envelope{SourceId: fmt.Sprintf("source-%d", i)}
+		}
+		Eventually(func() error {
+			return connManager.Write(context.Background(), envs)
+		}).Should(Succeed())
+
+		var b *loggregator_v2.EnvelopeBatch
+		Eventually(server.batch).Should(Receive(&b))
+		Expect(b.Batch).To(HaveLen(1000))
+		for i, e := range b.Batch {
+			Expect(e.GetSourceId()).To(Equal(fmt.Sprintf("source-%d", i)))
+		}
+	})
+
 	It("returns an error when the server is unavailable", func() {
 		fetcher := v2.NewSenderFetcher(mc, grpc.WithTransportCredentials(insecure.NewCredentials()))
 		_, _, err := fetcher.Fetch("127.0.0.1:1122")
@@ -76,6 +109,15 @@ var _ = Describe("PusherFetcher", func() {
 	})
 })
 
+type fetcherConnector struct {
+	fetcher *v2.SenderFetcher
+	addr    string
+}
+
+func (c fetcherConnector) Connect() (io.Closer, loggregator_v2.Ingress_BatchSenderClient, error) {
+	return c.fetcher.Fetch(c.addr)
+}
+
 type SpyIngestorServer struct {
 	addr            string
 	server          *grpc.Server
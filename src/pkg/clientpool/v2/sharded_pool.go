@@ -0,0 +1,246 @@
+package v2
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metrics "code.cloudfoundry.org/go-metric-registry"
+)
+
+// ringReplicas is the number of points each endpoint has on the hash ring.
+// More points spread the source IDs more evenly across the endpoints.
+const ringReplicas = 128
+
+// ShardConn is a connection to a single endpoint of a ShardedPool.
+type ShardConn interface {
+	Conn
+	Close()
+}
+
+// ShardMetricClient creates the metrics of a ShardedPool.
+type ShardMetricClient interface {
+	NewGauge(name, helpText string, opts ...metrics.MetricOption) metrics.Gauge
+	NewCounter(name, helpText string, opts ...metrics.MetricOption) metrics.Counter
+}
+
+// ShardedPool writes envelopes to one of several endpoints chosen by a
+// consistent hash of their source ID, so that all envelopes of a source
+// are sent on the same stream and keep their order. When endpoints are
+// added or removed, only the source IDs of the changed endpoints move to
+// other endpoints.
+type ShardedPool struct {
+	resolve  func() ([]string, error)
+	newConn  func(addr string) ShardConn
+	interval time.Duration
+
+	mu    sync.RWMutex
+	ring  hashRing
+	conns map[string]ShardConn
+
+	endpoints  metrics.Gauge
+	rebalances metrics.Counter
+}
+
+// NewShardedPool returns a ShardedPool that shards envelopes across the
+// endpoints returned by resolve. Connections to the endpoints are created
+// with newConn. The endpoints are resolved again every interval once the
+// pool is started.
+func NewShardedPool(
+	resolve func() ([]string, error),
+	newConn func(addr string) ShardConn,
+	interval time.Duration,
+	m ShardMetricClient,
+) *ShardedPool {
+	p := &ShardedPool{
+		resolve:  resolve,
+		newConn:  newConn,
+		interval: interval,
+		conns:    make(map[string]ShardConn),
+		endpoints: m.NewGauge(
+			"doppler_shard_endpoints",
+			"Current number of endpoints envelopes are sharded across by source ID.",
+			metrics.WithMetricLabels(map[string]string{"metric_version": "2.0"}),
+		),
+		rebalances: m.NewCounter(
+			"doppler_shard_rebalances",
+			"Total number of times source IDs were rebalanced because the endpoints changed.",
+			metrics.WithMetricLabels(map[string]string{"metric_version": "2.0"}),
+		),
+	}
+	p.refresh()
+
+	return p
+}
+
+// Start resolves the endpoints every interval until ctx is done and then
+// closes the connections.
+func (p *ShardedPool) Start(ctx context.Context) {
+	t := time.NewTicker(p.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			p.closeConns()
+			return
+		case <-t.C:
+			p.refresh()
+		}
+	}
+}
+
+// Write writes each envelope to the endpoint its source ID hashes to. The
+// envelopes of an endpoint are written in one batch and in their order.
+func (p *ShardedPool) Write(ctx context.Context, msgs []*loggregator_v2.Envelope) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if len(p.ring.points) == 0 {
+		return fmt.Errorf("no doppler endpoints to shard across")
+	}
+
+	batches := make(map[string][]*loggregator_v2.Envelope)
+	var order []string
+	for _, e := range msgs {
+		addr := p.ring.get(e.GetSourceId())
+		if _, ok := batches[addr]; !ok {
+			order = append(order, addr)
+		}
+		batches[addr] = append(batches[addr], e)
+	}
+
+	var failed int
+	for _, addr := range order {
+		if err := p.conns[addr].Write(ctx, batches[addr]); err != nil {
+			failed += len(batches[addr])
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("unable to write %d of %d envelopes to dopplers", failed, len(msgs))
+	}
+
+	return nil
+}
+
+// refresh resolves the endpoints and rebuilds the hash ring if they
+// changed. The endpoints are kept if they cannot be resolved.
+func (p *ShardedPool) refresh() {
+	addrs, err := p.resolve()
+	if err != nil {
+		log.Printf("failed to resolve doppler endpoints: %s", err)
+		return
+	}
+	sort.Strings(addrs)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if equalEndpoints(addrs, p.ring.endpoints) {
+		return
+	}
+	if len(p.ring.endpoints) > 0 {
+		log.Printf("rebalancing source ids from dopplers %v to %v", p.ring.endpoints, addrs)
+		p.rebalances.Add(1)
+	}
+
+	conns := make(map[string]ShardConn, len(addrs))
+	for _, addr := range addrs {
+		if c, ok := p.conns[addr]; ok {
+			conns[addr] = c
+			delete(p.conns, addr)
+			continue
+		}
+		conns[addr] = p.newConn(addr)
+	}
+	for _, c := range p.conns {
+		c.Close()
+	}
+
+	p.conns = conns
+	p.ring = newHashRing(addrs)
+	p.endpoints.Set(float64(len(addrs)))
+}
+
+func (p *ShardedPool) closeConns() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, c := range p.conns {
+		c.Close()
+	}
+	p.conns = make(map[string]ShardConn)
+	p.ring = hashRing{}
+}
+
+func equalEndpoints(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// hashRing maps keys to endpoints by consistent hashing. Each endpoint has
+// ringReplicas points on the ring and a key belongs to the endpoint of the
+// first point at or after the hash of the key.
+type hashRing struct {
+	endpoints []string
+	points    []uint32
+	owners    map[uint32]string
+}
+
+func newHashRing(endpoints []string) hashRing {
+	r := hashRing{
+		endpoints: endpoints,
+		points:    make([]uint32, 0, len(endpoints)*ringReplicas),
+		owners:    make(map[uint32]string, len(endpoints)*ringReplicas),
+	}
+	for _, e := range endpoints {
+		for i := 0; i < ringReplicas; i++ {
+			h := hash(e + "#" + strconv.Itoa(i))
+			if _, ok := r.owners[h]; ok {
+				continue
+			}
+			r.owners[h] = e
+			r.points = append(r.points, h)
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+
+	return r
+}
+
+func (r hashRing) get(key string) string {
+	h := hash(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]]
+}
+
+// hash returns the FNV-1a hash of s with the murmur3 finalizer applied,
+// since FNV alone spreads similar keys, e.g. GUIDs with a common
+// prefix, unevenly over the ring.
+func hash(s string) uint32 {
+	f := fnv.New32a()
+	f.Write([]byte(s)) //nolint:errcheck
+	h := f.Sum32()
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
@@ -0,0 +1,208 @@
+package v2_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
+	clientpool "code.cloudfoundry.org/loggregator-agent-release/src/pkg/clientpool/v2"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ShardedPool", func() {
+	var (
+		mu        sync.Mutex
+		endpoints []string
+		conns     map[string]*spyShardConn
+		spy       *metricsHelpers.SpyMetricsRegistry
+		pool      *clientpool.ShardedPool
+		cancel    context.CancelFunc
+		done      chan struct{}
+	)
+
+	start := func() {
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		done = make(chan struct{})
+		go func() {
+			defer close(done)
+			pool.Start(ctx)
+		}()
+	}
+
+	resolve := func() ([]string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if endpoints == nil {
+			return nil, errors.New("some-error")
+		}
+		return append([]string(nil), endpoints...), nil
+	}
+
+	newConn := func(addr string) clientpool.ShardConn {
+		mu.Lock()
+		defer mu.Unlock()
+		c := &spyShardConn{}
+		conns[addr] = c
+		return c
+	}
+
+	setEndpoints := func(addrs ...string) {
+		mu.Lock()
+		defer mu.Unlock()
+		endpoints = addrs
+	}
+
+	envelopes := func(n int) []*loggregator_v2.Envelope {
+		var envs []*loggregator_v2.Envelope
+		for i := 0; i < n; i++ {
+			envs = append(envs, &loggregator_v2.Envelope{SourceId: fmt.Sprintf("source-%d", i)})
+		}
+		return envs
+	}
+
+	// owners returns the endpoint each source ID was written to.
+	owners := func() map[string]string {
+		mu.Lock()
+		defer mu.Unlock()
+		o := make(map[string]string)
+		for addr, c := range conns {
+			for _, e := range c.Envelopes() {
+				o[e.GetSourceId()] = addr
+			}
+		}
+		return o
+	}
+
+	BeforeEach(func() {
+		endpoints = []string{"10.0.0.1:8082", "10.0.0.2:8082", "10.0.0.3:8082"}
+		conns = make(map[string]*spyShardConn)
+		spy = metricsHelpers.NewMetricsRegistry()
+		pool = clientpool.NewShardedPool(resolve, newConn, 10*time.Millisecond, spy)
+	})
+
+	AfterEach(func() {
+		if cancel != nil {
+			cancel()
+			Eventually(done).Should(BeClosed())
+			cancel = nil
+		}
+	})
+
+	It("writes all envelopes of a source ID to the same endpoint in order", func() {
+		Expect(pool.Write(context.Background(), []*loggregator_v2.Envelope{
+			{SourceId: "some-source", Timestamp: 1},
+			{SourceId: "some-source", Timestamp: 2},
+		})).To(Succeed())
+		Expect(pool.Write(context.Background(), []*loggregator_v2.Envelope{
+			{SourceId: "some-source", Timestamp: 3},
+		})).To(Succeed())
+
+		var written [][]*loggregator_v2.Envelope
+		for _, c := range conns {
+			if envs := c.Envelopes(); len(envs) > 0 {
+				written = append(written, envs)
+			}
+		}
+		Expect(written).To(HaveLen(1))
+		Expect(written[0]).To(HaveExactElements(
+			HaveField("Timestamp", int64(1)),
+			HaveField("Timestamp", int64(2)),
+			HaveField("Timestamp", int64(3)),
+		))
+	})
+
+	It("spreads source IDs across the endpoints", func() {
+		Expect(pool.Write(context.Background(), envelopes(300))).To(Succeed())
+
+		for _, c := range conns {
+			Expect(len(c.Envelopes())).To(BeNumerically(">", 30))
+		}
+		Expect(spy.GetMetric("doppler_shard_endpoints", map[string]string{"metric_version": "2.0"}).Value()).To(Equal(3.0))
+	})
+
+	It("only moves the source IDs of removed endpoints", func() {
+		Expect(pool.Write(context.Background(), envelopes(300))).To(Succeed())
+		before := owners()
+
+		start()
+		setEndpoints("10.0.0.1:8082", "10.0.0.2:8082")
+		Eventually(func() float64 {
+			return spy.GetMetric("doppler_shard_rebalances", map[string]string{"metric_version": "2.0"}).Value()
+		}).Should(Equal(1.0))
+		Expect(conns["10.0.0.3:8082"].Closed()).To(BeTrue())
+
+		for _, c := range conns {
+			c.Reset()
+		}
+		Expect(pool.Write(context.Background(), envelopes(300))).To(Succeed())
+		after := owners()
+
+		for id, addr := range before {
+			if addr != "10.0.0.3:8082" {
+				Expect(after[id]).To(Equal(addr))
+			}
+		}
+	})
+
+	It("keeps the endpoints if they cannot be resolved", func() {
+		start()
+		setEndpoints()
+
+		Consistently(func() error {
+			return pool.Write(context.Background(), envelopes(1))
+		}, 50*time.Millisecond).Should(Succeed())
+	})
+
+	It("returns an error if writing to an endpoint fails", func() {
+		for _, c := range conns {
+			c.err = errors.New("some-error")
+		}
+
+		Expect(pool.Write(context.Background(), envelopes(10))).To(MatchError("unable to write 10 of 10 envelopes to dopplers"))
+	})
+})
+
+type spyShardConn struct {
+	mu        sync.Mutex
+	envelopes []*loggregator_v2.Envelope
+	err       error
+	closed    bool
+}
+
+func (s *spyShardConn) Write(_ context.Context, e []*loggregator_v2.Envelope) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.envelopes = append(s.envelopes, e...)
+	return s.err
+}
+
+func (s *spyShardConn) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+}
+
+func (s *spyShardConn) Closed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+func (s *spyShardConn) Envelopes() []*loggregator_v2.Envelope {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*loggregator_v2.Envelope(nil), s.envelopes...)
+}
+
+func (s *spyShardConn) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.envelopes = nil
+}
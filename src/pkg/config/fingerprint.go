@@ -0,0 +1,70 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	metrics "code.cloudfoundry.org/go-metric-registry"
+)
+
+// Fingerprint returns a short hash of the configuration so that agents
+// with the same configuration report the same fingerprint. The
+// configuration is hashed as JSON. Fields that differ between instances,
+// such as the instance index or IP, can be ignored by their dotted JSON
+// path, e.g. "Tags.ip".
+func Fingerprint(cfg any, ignore ...string) string {
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		return "unknown"
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return "unknown"
+	}
+	for _, path := range ignore {
+		deletePath(fields, strings.Split(path, "."))
+	}
+
+	// Maps are marshalled with sorted keys which keeps the hash stable.
+	b, err = json.Marshal(fields)
+	if err != nil {
+		return "unknown"
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8])
+}
+
+func deletePath(fields map[string]any, path []string) {
+	if len(path) == 1 {
+		delete(fields, path[0])
+		return
+	}
+	if nested, ok := fields[path[0]].(map[string]any); ok {
+		deletePath(nested, path[1:])
+	}
+}
+
+// GaugeClient is used to emit the config_info metric.
+type GaugeClient interface {
+	NewGauge(name, helpText string, opts ...metrics.MetricOption) metrics.Gauge
+}
+
+// EmitConfigInfo sets a config_info gauge to 1. The gauge is tagged with
+// the fingerprint of the configuration and the given labels, which must not
+// contain secrets, so configuration drift across a fleet can be detected.
+func EmitConfigInfo(m GaugeClient, fingerprint string, labels map[string]string) {
+	l := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		l[k] = v
+	}
+	l["fingerprint"] = fingerprint
+
+	m.NewGauge(
+		"config_info",
+		"Always 1. Tagged with a fingerprint of the effective configuration and key configuration values.",
+		metrics.WithMetricLabels(l),
+	).Set(1)
+}
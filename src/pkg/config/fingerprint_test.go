@@ -0,0 +1,53 @@
+package config_test
+
+import (
+	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/config"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type testConfig struct {
+	Port  int
+	Tags  map[string]string
+	Index string
+}
+
+var _ = Describe("Fingerprint", func() {
+	It("returns the same fingerprint for the same configuration", func() {
+		a := testConfig{Port: 1, Tags: map[string]string{"a": "1", "b": "2"}}
+		b := testConfig{Port: 1, Tags: map[string]string{"b": "2", "a": "1"}}
+
+		Expect(config.Fingerprint(a)).To(Equal(config.Fingerprint(b)))
+		Expect(config.Fingerprint(a)).To(HaveLen(16))
+	})
+
+	It("returns a different fingerprint for a different configuration", func() {
+		a := testConfig{Port: 1}
+		b := testConfig{Port: 2}
+
+		Expect(config.Fingerprint(a)).ToNot(Equal(config.Fingerprint(b)))
+	})
+
+	It("ignores the given fields", func() {
+		a := testConfig{Port: 1, Index: "0", Tags: map[string]string{"ip": "10.0.0.1", "deployment": "cf"}}
+		b := testConfig{Port: 1, Index: "1", Tags: map[string]string{"ip": "10.0.0.2", "deployment": "cf"}}
+
+		Expect(config.Fingerprint(a, "Index", "Tags.ip")).To(Equal(config.Fingerprint(b, "Index", "Tags.ip")))
+		Expect(config.Fingerprint(a, "Index")).ToNot(Equal(config.Fingerprint(b, "Index")))
+	})
+})
+
+var _ = Describe("EmitConfigInfo", func() {
+	It("emits a gauge tagged with the fingerprint and labels", func() {
+		m := metricsHelpers.NewMetricsRegistry()
+
+		config.EmitConfigInfo(m, "abc", map[string]string{"mode": "fast"})
+
+		Expect(m.GetMetricValue("config_info", map[string]string{
+			"fingerprint": "abc",
+			"mode":        "fast",
+		})).To(Equal(1.0))
+	})
+})
@@ -0,0 +1,91 @@
+package diodes
+
+import (
+	"sync/atomic"
+	"time"
+
+	gendiodes "code.cloudfoundry.org/go-diodes"
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+)
+
+// depth tracks the approximate number of items in a diode from the number
+// of items written, read and dropped, and when the items at the head of the
+// diode were written.
+type depth struct {
+	size    int64
+	written atomic.Int64
+	read    atomic.Int64
+	dropped atomic.Int64
+
+	// lastRead is when the item read last was written in unix nanoseconds.
+	lastRead atomic.Int64
+	// refilled is when the first item written to the empty diode was
+	// written in unix nanoseconds.
+	refilled atomic.Int64
+}
+
+// queuedEnvelope is an envelope in a diode with the time it was written.
+type queuedEnvelope struct {
+	env      *loggregator_v2.Envelope
+	enqueued int64
+}
+
+// enqueue returns the envelope to write to the diode.
+func (d *depth) enqueue(e *loggregator_v2.Envelope) gendiodes.GenericDataType {
+	now := time.Now().UnixNano()
+	if d.len() == 0 {
+		d.refilled.Store(now)
+	}
+	return gendiodes.GenericDataType(&queuedEnvelope{env: e, enqueued: now})
+}
+
+// dequeue returns the envelope read from the diode.
+func (d *depth) dequeue(data gendiodes.GenericDataType) *loggregator_v2.Envelope {
+	q := (*queuedEnvelope)(data)
+	d.read.Add(1)
+	d.lastRead.Store(q.enqueued)
+	return q.env
+}
+
+// readEnqueued returns when the item read last was written.
+func (d *depth) readEnqueued() time.Time {
+	return time.Unix(0, d.lastRead.Load())
+}
+
+// oldestEnqueued returns when the item at the head of the diode was
+// written, or the zero time if the diode is empty. Since items are read in
+// order, the head was written after the item read last and, if the diode
+// ran empty since, after the first item written to it again.
+func (d *depth) oldestEnqueued() time.Time {
+	if d.len() == 0 {
+		return time.Time{}
+	}
+	oldest := max(d.lastRead.Load(), d.refilled.Load())
+	return time.Unix(0, oldest)
+}
+
+func newDepth(size int) *depth {
+	return &depth{size: int64(size)}
+}
+
+// alerter wraps a to also count dropped items.
+func (d *depth) alerter(a gendiodes.Alerter) gendiodes.Alerter {
+	return gendiodes.AlertFunc(func(missed int) {
+		d.dropped.Add(int64(missed))
+		if a != nil {
+			a.Alert(missed)
+		}
+	})
+}
+
+func (d *depth) len() int {
+	n := d.written.Load() - d.read.Load() - d.dropped.Load()
+	switch {
+	case n < 0:
+		return 0
+	case n > d.size:
+		return int(d.size)
+	default:
+		return int(n)
+	}
+}
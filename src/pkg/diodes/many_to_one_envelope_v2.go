@@ -1,6 +1,8 @@
 package diodes
 
 import (
+	"time"
+
 	gendiodes "code.cloudfoundry.org/go-diodes"
 	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
 )
@@ -8,20 +10,24 @@ import (
 // ManyToOneEnvelopeV2 diode is optimal for many writers and a single reader for
 // V2 envelopes.
 type ManyToOneEnvelopeV2 struct {
-	d *gendiodes.Waiter
+	d     *gendiodes.Waiter
+	depth *depth
 }
 
 // NewManyToOneEnvelopeV2 returns a new ManyToOneEnvelopeV2 diode to be used
 // with many writers and a single reader.
 func NewManyToOneEnvelopeV2(size int, alerter gendiodes.Alerter) *ManyToOneEnvelopeV2 {
+	depth := newDepth(size)
 	return &ManyToOneEnvelopeV2{
-		d: gendiodes.NewWaiter(gendiodes.NewManyToOne(size, alerter)),
+		d:     gendiodes.NewWaiter(gendiodes.NewManyToOne(size, depth.alerter(alerter))),
+		depth: depth,
 	}
 }
 
 // Set inserts the given V2 envelope into the diode.
 func (d *ManyToOneEnvelopeV2) Set(data *loggregator_v2.Envelope) {
-	d.d.Set(gendiodes.GenericDataType(data))
+	d.d.Set(d.depth.enqueue(data))
+	d.depth.written.Add(1)
 }
 
 // TryNext returns the next V2 envelope to be read from the diode. If the
@@ -31,8 +37,7 @@ func (d *ManyToOneEnvelopeV2) TryNext() (*loggregator_v2.Envelope, bool) {
 	if !ok {
 		return nil, ok
 	}
-
-	return (*loggregator_v2.Envelope)(data), true
+	return d.depth.dequeue(data), true
 }
 
 // Next will return the next V2 envelope to be read from the diode. If the
@@ -40,5 +45,25 @@ func (d *ManyToOneEnvelopeV2) TryNext() (*loggregator_v2.Envelope, bool) {
 // read.
 func (d *ManyToOneEnvelopeV2) Next() *loggregator_v2.Envelope {
 	data := d.d.Next()
-	return (*loggregator_v2.Envelope)(data)
+	if data == nil {
+		return nil
+	}
+	return d.depth.dequeue(data)
+}
+
+// Len returns the approximate number of envelopes in the diode.
+func (d *ManyToOneEnvelopeV2) Len() int {
+	return d.depth.len()
+}
+
+// OldestEnqueued returns approximately when the envelope at the head of the
+// diode was written, or the zero time if the diode is empty.
+func (d *ManyToOneEnvelopeV2) OldestEnqueued() time.Time {
+	return d.depth.oldestEnqueued()
+}
+
+// ReadEnqueued returns when the envelope read last was written to the
+// diode.
+func (d *ManyToOneEnvelopeV2) ReadEnqueued() time.Time {
+	return d.depth.readEnqueued()
 }
@@ -0,0 +1,72 @@
+package diodes_test
+
+import (
+	"time"
+
+	gendiodes "code.cloudfoundry.org/go-diodes"
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/diodes"
+)
+
+var _ = Describe("ManyToOneEnvelopeV2", func() {
+	It("reports the number of envelopes in the diode", func() {
+		d := diodes.NewManyToOneEnvelopeV2(5, gendiodes.AlertFunc(func(int) {}))
+		Expect(d.Len()).To(BeZero())
+
+		for i := 0; i < 3; i++ {
+			d.Set(&loggregator_v2.Envelope{})
+		}
+		Expect(d.Len()).To(Equal(3))
+
+		_, ok := d.TryNext()
+		Expect(ok).To(BeTrue())
+		Expect(d.Len()).To(Equal(2))
+	})
+
+	It("does not report more envelopes than fit in the diode", func() {
+		d := diodes.NewManyToOneEnvelopeV2(5, nil)
+		for i := 0; i < 8; i++ {
+			d.Set(&loggregator_v2.Envelope{})
+		}
+		Expect(d.Len()).To(Equal(5))
+
+		_, ok := d.TryNext()
+		Expect(ok).To(BeTrue())
+		Expect(d.Len()).To(BeNumerically("<", 5))
+	})
+
+	It("reports when the envelope at the head of the diode was written", func() {
+		d := diodes.NewManyToOneEnvelopeV2(5, nil)
+		Expect(d.OldestEnqueued().IsZero()).To(BeTrue())
+
+		before := time.Now()
+		d.Set(&loggregator_v2.Envelope{SourceId: "first"})
+		time.Sleep(10 * time.Millisecond)
+		second := time.Now()
+		d.Set(&loggregator_v2.Envelope{SourceId: "second"})
+		Expect(d.OldestEnqueued()).To(BeTemporally(">=", before))
+		Expect(d.OldestEnqueued()).To(BeTemporally("<", second))
+
+		e, _ := d.TryNext()
+		Expect(e.GetSourceId()).To(Equal("first"))
+		Expect(d.ReadEnqueued()).To(BeTemporally("<", second))
+
+		_, _ = d.TryNext()
+		Expect(d.OldestEnqueued().IsZero()).To(BeTrue())
+		Expect(d.ReadEnqueued()).To(BeTemporally(">=", second))
+	})
+
+	It("reports the first envelope written after the diode ran empty as the head", func() {
+		d := diodes.NewManyToOneEnvelopeV2(5, nil)
+		d.Set(&loggregator_v2.Envelope{})
+		_, _ = d.TryNext()
+
+		time.Sleep(10 * time.Millisecond)
+		refilled := time.Now()
+		d.Set(&loggregator_v2.Envelope{})
+		Expect(d.OldestEnqueued()).To(BeTemporally(">=", refilled))
+	})
+})
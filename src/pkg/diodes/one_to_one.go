@@ -34,8 +34,12 @@ func (d *OneToOne) TryNext() ([]byte, bool) {
 }
 
 // Next will return the next item to be read from the diode. If the diode is
-// empty this method will block until an item is available to be read.
+// empty this method will block until an item is available to be read. It
+// returns nil once the context of the diode is done.
 func (d *OneToOne) Next() []byte {
 	data := d.d.Next()
+	if data == nil {
+		return nil
+	}
 	return *(*[]byte)(data)
 }
@@ -1,6 +1,8 @@
 package diodes
 
 import (
+	"time"
+
 	gendiodes "code.cloudfoundry.org/go-diodes"
 	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
 )
@@ -8,21 +10,25 @@ import (
 // OneToOneEnvelopeV2 diode is optimized for a single writer and a single
 // reader for byte slices.
 type OneToOneEnvelopeV2 struct {
-	d *gendiodes.Waiter
+	d     *gendiodes.Waiter
+	depth *depth
 }
 
 // NewOneToOneEnvelopeV2 initializes a new one to one diode of a given size
 // and alerter.  The alerter is called whenever data is dropped with an
 // integer representing the number of byte slices that were dropped.
 func NewOneToOneEnvelopeV2(size int, alerter gendiodes.Alerter, opts ...gendiodes.WaiterConfigOption) *OneToOneEnvelopeV2 {
+	depth := newDepth(size)
 	return &OneToOneEnvelopeV2{
-		d: gendiodes.NewWaiter(gendiodes.NewOneToOne(size, alerter), opts...),
+		d:     gendiodes.NewWaiter(gendiodes.NewOneToOne(size, depth.alerter(alerter)), opts...),
+		depth: depth,
 	}
 }
 
 // Set inserts the given data into the diode.
 func (d *OneToOneEnvelopeV2) Set(data *loggregator_v2.Envelope) {
-	d.d.Set(gendiodes.GenericDataType(data))
+	d.d.Set(d.depth.enqueue(data))
+	d.depth.written.Add(1)
 }
 
 // TryNext returns the next item to be read from the diode. If the diode is
@@ -32,13 +38,32 @@ func (d *OneToOneEnvelopeV2) TryNext() (*loggregator_v2.Envelope, bool) {
 	if !ok {
 		return nil, ok
 	}
-
-	return (*loggregator_v2.Envelope)(data), true
+	return d.depth.dequeue(data), true
 }
 
 // Next will return the next item to be read from the diode. If the diode is
 // empty this method will block until an item is available to be read.
 func (d *OneToOneEnvelopeV2) Next() *loggregator_v2.Envelope {
 	data := d.d.Next()
-	return (*loggregator_v2.Envelope)(data)
+	if data == nil {
+		return nil
+	}
+	return d.depth.dequeue(data)
+}
+
+// Len returns the approximate number of envelopes in the diode.
+func (d *OneToOneEnvelopeV2) Len() int {
+	return d.depth.len()
+}
+
+// OldestEnqueued returns approximately when the envelope at the head of the
+// diode was written, or the zero time if the diode is empty.
+func (d *OneToOneEnvelopeV2) OldestEnqueued() time.Time {
+	return d.depth.oldestEnqueued()
+}
+
+// ReadEnqueued returns when the envelope read last was written to the
+// diode.
+func (d *OneToOneEnvelopeV2) ReadEnqueued() time.Time {
+	return d.depth.readEnqueued()
 }
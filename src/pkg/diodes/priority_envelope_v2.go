@@ -0,0 +1,186 @@
+package diodes
+
+import (
+	"strings"
+	"sync"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+)
+
+// PriorityTag is the envelope tag apps use to set the priority of their
+// logs. Valid values are "low", "normal" and "high".
+const PriorityTag = "log_priority"
+
+// Priority is the priority of an envelope. Envelopes with a lower priority
+// are dropped first when a PriorityEnvelopeV2 is full.
+type Priority int
+
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+)
+
+// Priorities lists all priorities from lowest to highest.
+var Priorities = []Priority{PriorityLow, PriorityNormal, PriorityHigh}
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityHigh:
+		return "high"
+	default:
+		return "normal"
+	}
+}
+
+// EnvelopePriority returns the priority set by the PriorityTag of the
+// envelope. Envelopes without a valid tag have normal priority.
+func EnvelopePriority(e *loggregator_v2.Envelope) Priority {
+	switch strings.ToLower(e.GetTags()[PriorityTag]) {
+	case "low":
+		return PriorityLow
+	case "high":
+		return PriorityHigh
+	default:
+		return PriorityNormal
+	}
+}
+
+// PriorityAlerter is called whenever a PriorityEnvelopeV2 drops envelopes
+// with the priority and number of the dropped envelopes.
+type PriorityAlerter interface {
+	Alert(p Priority, missed int)
+}
+
+// PriorityAlertFunc type is an adapter to allow the use of ordinary
+// functions as a PriorityAlerter.
+type PriorityAlertFunc func(p Priority, missed int)
+
+// Alert calls f(p, missed).
+func (f PriorityAlertFunc) Alert(p Priority, missed int) {
+	f(p, missed)
+}
+
+// PriorityEnvelopeV2 is a bounded buffer for V2 envelopes for many writers
+// and a single reader. Envelopes are read in the order they were written.
+// When the buffer is full the oldest envelope with the lowest priority is
+// dropped. An envelope is dropped on write if only envelopes with a higher
+// priority are buffered.
+type PriorityEnvelopeV2 struct {
+	size    int
+	alerter PriorityAlerter
+	notify  chan struct{}
+
+	mu     sync.Mutex
+	queues [3][]prioritizedEnvelope
+	len    int
+	seq    uint64
+}
+
+type prioritizedEnvelope struct {
+	seq uint64
+	env *loggregator_v2.Envelope
+}
+
+// NewPriorityEnvelopeV2 returns a new PriorityEnvelopeV2 that holds up to
+// size envelopes.
+func NewPriorityEnvelopeV2(size int, alerter PriorityAlerter) *PriorityEnvelopeV2 {
+	return &PriorityEnvelopeV2{
+		size:    size,
+		alerter: alerter,
+		notify:  make(chan struct{}, 1),
+	}
+}
+
+// Set inserts the given V2 envelope into the buffer.
+func (d *PriorityEnvelopeV2) Set(data *loggregator_v2.Envelope) {
+	p := EnvelopePriority(data)
+
+	d.mu.Lock()
+	if d.len >= d.size {
+		dropped, ok := d.dropLowest(p)
+		if !ok {
+			d.mu.Unlock()
+			d.alerter.Alert(p, 1)
+			return
+		}
+		defer d.alerter.Alert(dropped, 1)
+	}
+
+	d.seq++
+	d.queues[p] = append(d.queues[p], prioritizedEnvelope{seq: d.seq, env: data})
+	d.len++
+	d.mu.Unlock()
+
+	select {
+	case d.notify <- struct{}{}:
+	default:
+	}
+}
+
+// dropLowest drops the oldest envelope with the lowest priority not above
+// p. It returns false if only envelopes with a higher priority than p are
+// buffered.
+func (d *PriorityEnvelopeV2) dropLowest(p Priority) (Priority, bool) {
+	for q := PriorityLow; q <= p; q++ {
+		if len(d.queues[q]) == 0 {
+			continue
+		}
+
+		d.queues[q][0] = prioritizedEnvelope{}
+		d.queues[q] = d.queues[q][1:]
+		d.len--
+		return q, true
+	}
+
+	return 0, false
+}
+
+// TryNext returns the next V2 envelope to be read from the buffer. If the
+// buffer is empty it will return a nil envelope and false for the bool.
+func (d *PriorityEnvelopeV2) TryNext() (*loggregator_v2.Envelope, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	next := -1
+	for i, q := range d.queues {
+		if len(q) == 0 {
+			continue
+		}
+		if next == -1 || q[0].seq < d.queues[next][0].seq {
+			next = i
+		}
+	}
+	if next == -1 {
+		return nil, false
+	}
+
+	e := d.queues[next][0].env
+	d.queues[next][0] = prioritizedEnvelope{}
+	d.queues[next] = d.queues[next][1:]
+	d.len--
+
+	return e, true
+}
+
+// Next will return the next V2 envelope to be read from the buffer. If the
+// buffer is empty this method will block until an envelope is available to
+// be read.
+func (d *PriorityEnvelopeV2) Next() *loggregator_v2.Envelope {
+	for {
+		if e, ok := d.TryNext(); ok {
+			return e
+		}
+		<-d.notify
+	}
+}
+
+// Len returns the number of envelopes in the buffer.
+func (d *PriorityEnvelopeV2) Len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.len
+}
@@ -0,0 +1,123 @@
+package diodes_test
+
+import (
+	"sync"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/diodes"
+)
+
+var _ = Describe("PriorityEnvelopeV2", func() {
+	var (
+		alerter *spyPriorityAlerter
+		d       *diodes.PriorityEnvelopeV2
+	)
+
+	BeforeEach(func() {
+		alerter = newSpyPriorityAlerter()
+		d = diodes.NewPriorityEnvelopeV2(3, alerter)
+	})
+
+	It("returns envelopes in the order they were written", func() {
+		d.Set(envelope("a", "high"))
+		d.Set(envelope("b", "low"))
+		d.Set(envelope("c", ""))
+
+		Expect(readAll(d)).To(Equal([]string{"a", "b", "c"}))
+	})
+
+	It("drops the oldest low priority envelope when full", func() {
+		d.Set(envelope("a", "low"))
+		d.Set(envelope("b", "low"))
+		d.Set(envelope("c", "high"))
+		d.Set(envelope("d", ""))
+
+		Expect(readAll(d)).To(Equal([]string{"b", "c", "d"}))
+		Expect(alerter.missed(diodes.PriorityLow)).To(Equal(1))
+	})
+
+	It("drops the incoming envelope if only higher priorities are buffered", func() {
+		d.Set(envelope("a", "high"))
+		d.Set(envelope("b", "high"))
+		d.Set(envelope("c", "normal"))
+		d.Set(envelope("d", "low"))
+
+		Expect(readAll(d)).To(Equal([]string{"a", "b", "c"}))
+		Expect(alerter.missed(diodes.PriorityLow)).To(Equal(1))
+	})
+
+	It("drops envelopes of the same priority if nothing lower is buffered", func() {
+		d.Set(envelope("a", "HIGH"))
+		d.Set(envelope("b", "high"))
+		d.Set(envelope("c", "high"))
+		d.Set(envelope("d", "high"))
+
+		Expect(readAll(d)).To(Equal([]string{"b", "c", "d"}))
+		Expect(alerter.missed(diodes.PriorityHigh)).To(Equal(1))
+	})
+
+	It("blocks on Next until an envelope is written", func() {
+		envs := make(chan *loggregator_v2.Envelope)
+		go func() { envs <- d.Next() }()
+
+		Consistently(envs).ShouldNot(Receive())
+		d.Set(envelope("a", ""))
+
+		Eventually(envs).Should(Receive(Equal(envelope("a", ""))))
+	})
+})
+
+var _ = Describe("EnvelopePriority", func() {
+	DescribeTable("reads the priority tag", func(tag string, p diodes.Priority) {
+		Expect(diodes.EnvelopePriority(envelope("", tag))).To(Equal(p))
+	},
+		Entry("low", "low", diodes.PriorityLow),
+		Entry("high", "high", diodes.PriorityHigh),
+		Entry("normal", "normal", diodes.PriorityNormal),
+		Entry("missing", "", diodes.PriorityNormal),
+		Entry("invalid", "urgent", diodes.PriorityNormal),
+	)
+})
+
+func envelope(sourceID, priority string) *loggregator_v2.Envelope {
+	e := &loggregator_v2.Envelope{SourceId: sourceID}
+	if priority != "" {
+		e.Tags = map[string]string{diodes.PriorityTag: priority}
+	}
+	return e
+}
+
+func readAll(d *diodes.PriorityEnvelopeV2) []string {
+	var ids []string
+	for {
+		e, ok := d.TryNext()
+		if !ok {
+			return ids
+		}
+		ids = append(ids, e.GetSourceId())
+	}
+}
+
+type spyPriorityAlerter struct {
+	mu    sync.Mutex
+	drops map[diodes.Priority]int
+}
+
+func newSpyPriorityAlerter() *spyPriorityAlerter {
+	return &spyPriorityAlerter{drops: make(map[diodes.Priority]int)}
+}
+
+func (s *spyPriorityAlerter) Alert(p diodes.Priority, missed int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.drops[p] += missed
+}
+
+func (s *spyPriorityAlerter) missed(p diodes.Priority) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.drops[p]
+}
@@ -2,6 +2,8 @@ package egress
 
 import (
 	"io"
+	"sync/atomic"
+	"time"
 
 	"golang.org/x/net/context"
 
@@ -15,12 +17,27 @@ type WaitGroup interface {
 	Done()
 }
 
+// Writer writes envelopes. Implementations that perform network operations
+// abort them when the context is done.
 type Writer interface {
-	Write(*loggregator_v2.Envelope) error
+	Write(context.Context, *loggregator_v2.Envelope) error
+}
+
+// StallReporter is implemented by writers that can report whether a write
+// has been in progress for longer than a deadline, e.g. because the
+// wrapped writer is wedged.
+type StallReporter interface {
+	Stalled(deadline time.Duration) bool
+}
+
+// PendingReporter is implemented by writers that buffer envelopes and can
+// report how many of them have not been written yet.
+type PendingReporter interface {
+	Pending() int
 }
 
 type WriteCloser interface {
-	Write(*loggregator_v2.Envelope) error
+	Write(context.Context, *loggregator_v2.Envelope) error
 	io.Closer
 }
 
@@ -30,6 +47,9 @@ type DiodeWriter struct {
 	wg    WaitGroup
 
 	ctx context.Context
+	// writeStarted is the start of the in-flight write to wc in unix
+	// nanoseconds or zero when no write is in flight.
+	writeStarted atomic.Int64
 }
 
 func NewDiodeWriter(
@@ -50,13 +70,48 @@ func NewDiodeWriter(
 	return dw
 }
 
-// Write writes an envelope into the diode. This can not fail.
-func (d *DiodeWriter) Write(env *loggregator_v2.Envelope) error {
+// Write writes an envelope into the diode. This can not fail. The envelope
+// is written to the wrapped writer with the context of the DiodeWriter so
+// that in-flight writes are cancelled when the DiodeWriter is stopped.
+func (d *DiodeWriter) Write(_ context.Context, env *loggregator_v2.Envelope) error {
 	d.diode.Set(env)
 
 	return nil
 }
 
+// Len returns the approximate number of envelopes waiting to be written.
+func (d *DiodeWriter) Len() int {
+	return d.diode.Len()
+}
+
+// Stalled reports whether a write to the wrapped writer has been in
+// progress for longer than deadline.
+func (d *DiodeWriter) Stalled(deadline time.Duration) bool {
+	started := d.writeStarted.Load()
+	return started != 0 && time.Since(time.Unix(0, started)) > deadline
+}
+
+// Pending returns the approximate number of envelopes that have not been
+// written to the wrapped writer yet, including an in-flight write.
+func (d *DiodeWriter) Pending() int {
+	n := d.diode.Len()
+	if d.writeStarted.Load() != 0 {
+		n++
+	}
+	return n
+}
+
+// OldestEnqueued returns approximately when the oldest envelope that has
+// not been written to the wrapped writer yet, including an in-flight
+// write, was written to the DiodeWriter. It returns the zero time if there
+// is none.
+func (d *DiodeWriter) OldestEnqueued() time.Time {
+	if d.writeStarted.Load() != 0 {
+		return d.diode.ReadEnqueued()
+	}
+	return d.diode.OldestEnqueued()
+}
+
 func (d *DiodeWriter) start() {
 	defer d.wc.Close()
 	defer d.wg.Done()
@@ -67,7 +122,9 @@ func (d *DiodeWriter) start() {
 			return
 		}
 
-		err := d.wc.Write(e)
+		d.writeStarted.Store(time.Now().UnixNano())
+		err := d.wc.Write(d.ctx, e)
+		d.writeStarted.Store(0)
 		if err != nil && ContextDone(d.ctx) {
 			return
 		}
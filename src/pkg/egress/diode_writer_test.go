@@ -25,7 +25,7 @@ var _ = Describe("DiodeWriter", func() {
 		spyAlerter := &SpyAlerter{}
 		dw := egress.NewDiodeWriter(context.TODO(), spyWriter, spyAlerter, spyWaitGroup)
 
-		_ = dw.Write(expectedEnv)
+		_ = dw.Write(context.Background(), expectedEnv)
 
 		Eventually(spyWriter.calledWith).Should(Equal([]*loggregator_v2.Envelope{
 			expectedEnv,
@@ -56,11 +56,56 @@ var _ = Describe("DiodeWriter", func() {
 			}
 			spyAlerter := &SpyAlerter{}
 			dw := egress.NewDiodeWriter(context.TODO(), spyWriter, spyAlerter, spyWaitGroup)
-			_ = dw.Write(nil)
+			_ = dw.Write(context.Background(), nil)
 		}()
 		Eventually(done).Should(BeClosed())
 	})
 
+	It("reports writes in progress for longer than a deadline as stalled", func() {
+		spyWriter := &SpyWriter{blockWrites: true}
+		dw := egress.NewDiodeWriter(context.TODO(), spyWriter, &SpyAlerter{}, &SpyWaitGroup{})
+		Expect(dw.Stalled(0)).To(BeFalse())
+
+		_ = dw.Write(context.Background(), &loggregator_v2.Envelope{})
+		Eventually(func() bool { return dw.Stalled(10 * time.Millisecond) }).Should(BeTrue())
+		Expect(dw.Stalled(time.Hour)).To(BeFalse())
+
+		spyWriter.WriteBlocked(false)
+		Eventually(func() bool { return dw.Stalled(0) }).Should(BeFalse())
+	})
+
+	It("reports the envelopes that have not been written yet as pending", func() {
+		spyWriter := &SpyWriter{blockWrites: true}
+		dw := egress.NewDiodeWriter(context.TODO(), spyWriter, &SpyAlerter{}, &SpyWaitGroup{})
+		Expect(dw.Pending()).To(BeZero())
+
+		for i := 0; i < 3; i++ {
+			_ = dw.Write(context.Background(), &loggregator_v2.Envelope{})
+		}
+		Eventually(dw.Pending).Should(Equal(3))
+
+		spyWriter.WriteBlocked(false)
+		Eventually(dw.Pending).Should(BeZero())
+		Expect(spyWriter.calledWith()).To(HaveLen(3))
+	})
+
+	It("reports when the oldest envelope that has not been written yet was written to it", func() {
+		spyWriter := &SpyWriter{blockWrites: true}
+		dw := egress.NewDiodeWriter(context.TODO(), spyWriter, &SpyAlerter{}, &SpyWaitGroup{})
+		Expect(dw.OldestEnqueued().IsZero()).To(BeTrue())
+
+		before := time.Now()
+		_ = dw.Write(context.Background(), &loggregator_v2.Envelope{})
+		time.Sleep(10 * time.Millisecond)
+		_ = dw.Write(context.Background(), &loggregator_v2.Envelope{})
+		Eventually(dw.Pending).Should(Equal(2))
+		Consistently(dw.OldestEnqueued, 200*time.Millisecond).Should(BeTemporally("~", before, 5*time.Millisecond))
+
+		spyWriter.WriteBlocked(false)
+		Eventually(dw.Pending).Should(BeZero())
+		Expect(dw.OldestEnqueued().IsZero()).To(BeTrue())
+	})
+
 	It("flushes existing messages after close", func() {
 		spyWaitGroup := &SpyWaitGroup{}
 		spyWriter := &SpyWriter{
@@ -73,7 +118,7 @@ var _ = Describe("DiodeWriter", func() {
 
 		e := &loggregator_v2.Envelope{}
 		for i := 0; i < 100; i++ {
-			_ = dw.Write(e)
+			_ = dw.Write(context.Background(), e)
 		}
 		cancel()
 		spyWriter.WriteBlocked(false)
@@ -92,7 +137,7 @@ var _ = Describe("DiodeWriter", func() {
 
 		go func() {
 			for {
-				_ = dw.Write(&loggregator_v2.Envelope{})
+				_ = dw.Write(context.Background(), &loggregator_v2.Envelope{})
 			}
 		}()
 
@@ -128,7 +173,7 @@ type SpyWriter struct {
 	writeError  error
 }
 
-func (s *SpyWriter) Write(env *loggregator_v2.Envelope) error {
+func (s *SpyWriter) Write(_ context.Context, env *loggregator_v2.Envelope) error {
 	for {
 		s.mu.Lock()
 		block := s.blockWrites
@@ -0,0 +1,97 @@
+package egress
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ErrorEvent is a pipeline error recorded by ErrorEvents.
+type ErrorEvent struct {
+	Time      time.Time `json:"time"`
+	Subsystem string    `json:"subsystem"`
+	Class     string    `json:"class"`
+	DrainHash string    `json:"drain_hash,omitempty"`
+}
+
+// ErrorEvents keeps the most recent pipeline errors in a ring buffer, so
+// that transient failures can be investigated after the fact without
+// verbose logging. A nil ErrorEvents records nothing.
+type ErrorEvents struct {
+	mu     sync.Mutex
+	events []ErrorEvent
+	next   int
+	full   bool
+}
+
+// NewErrorEvents returns an ErrorEvents that keeps the last size events.
+func NewErrorEvents(size int) *ErrorEvents {
+	return &ErrorEvents{
+		events: make([]ErrorEvent, size),
+	}
+}
+
+// Record records err for the subsystem. The error is classified by
+// ErrorReason and the drain URL, if any, is recorded as DrainHash so that
+// drain hosts and credentials are not exposed.
+func (e *ErrorEvents) Record(subsystem string, err error, drain string) {
+	if e == nil || len(e.events) == 0 {
+		return
+	}
+
+	ev := ErrorEvent{
+		Time:      time.Now(),
+		Subsystem: subsystem,
+		Class:     ErrorReason(err),
+	}
+	if drain != "" {
+		ev.DrainHash = DrainHash(drain)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.events[e.next] = ev
+	e.next = (e.next + 1) % len(e.events)
+	if e.next == 0 {
+		e.full = true
+	}
+}
+
+// Events returns the recorded events, oldest first.
+func (e *ErrorEvents) Events() []ErrorEvent {
+	if e == nil {
+		return nil
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.full {
+		return append([]ErrorEvent(nil), e.events[:e.next]...)
+	}
+	return append(append([]ErrorEvent(nil), e.events[e.next:]...), e.events[:e.next]...)
+}
+
+// ServeHTTP serves the recorded events as JSON.
+func (e *ErrorEvents) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(e.Events())
+}
+
+// DrainHash returns a short hash of the drain URL without its credentials
+// and query parameters, so drains can be told apart in error events
+// without exposing them.
+func DrainHash(drain string) string {
+	if u, err := url.Parse(drain); err == nil {
+		u.User = nil
+		u.RawQuery = ""
+		drain = u.String()
+	}
+	sum := sha256.Sum256([]byte(drain))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,81 @@
+package egress
+
+import (
+	"errors"
+	"net"
+	"net/http"
+)
+
+// Errors returned by egress writers are categorized with these errors so
+// that callers can branch on the category with errors.Is.
+var (
+	// ErrOversizeEnvelope is returned when a destination rejects a write
+	// because it is too large. Retrying the write does not help.
+	ErrOversizeEnvelope = errors.New("envelope too large")
+	// ErrBackpressure is returned when a destination asks the writer to
+	// slow down.
+	ErrBackpressure = errors.New("destination applied backpressure")
+	// ErrDialTimeout is returned when connecting to a destination timed out.
+	ErrDialTimeout = errors.New("dial timeout")
+)
+
+// ErrorReasons are the values returned by ErrorReason.
+var ErrorReasons = []string{"oversize", "backpressure", "dial_timeout", "other"}
+
+// ErrorReason returns the category of err for use as a metric label.
+func ErrorReason(err error) string {
+	switch {
+	case errors.Is(err, ErrOversizeEnvelope):
+		return "oversize"
+	case errors.Is(err, ErrBackpressure):
+		return "backpressure"
+	case errors.Is(err, ErrDialTimeout):
+		return "dial_timeout"
+	default:
+		return "other"
+	}
+}
+
+// WithCategory returns an error with the message of err that also matches
+// category with errors.Is. It returns err if category is nil.
+func WithCategory(err, category error) error {
+	if err == nil || category == nil {
+		return err
+	}
+	return categorizedError{err: err, category: category}
+}
+
+// DialError categorizes err if it is the error of a dial that timed out.
+func DialError(err error) error {
+	var oe *net.OpError
+	if errors.As(err, &oe) && oe.Op == "dial" && oe.Timeout() {
+		return WithCategory(err, ErrDialTimeout)
+	}
+	return err
+}
+
+// StatusCategory returns the category of an unsuccessful HTTP status code
+// or nil if it has none.
+func StatusCategory(code int) error {
+	switch code {
+	case http.StatusRequestEntityTooLarge:
+		return ErrOversizeEnvelope
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return ErrBackpressure
+	default:
+		return nil
+	}
+}
+
+type categorizedError struct {
+	err      error
+	category error
+}
+
+func (e categorizedError) Error() string {
+	return e.err.Error()
+}
+
+func (e categorizedError) Unwrap() []error {
+	return []error{e.err, e.category}
+}
@@ -0,0 +1,71 @@
+package egress_test
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
+)
+
+var _ = Describe("Errors", func() {
+	Describe("ErrorReason()", func() {
+		It("returns the reason of categorized errors", func() {
+			Expect(egress.ErrorReason(egress.WithCategory(errors.New("413"), egress.ErrOversizeEnvelope))).To(Equal("oversize"))
+			Expect(egress.ErrorReason(egress.WithCategory(errors.New("429"), egress.ErrBackpressure))).To(Equal("backpressure"))
+			Expect(egress.ErrorReason(egress.WithCategory(errors.New("dial"), egress.ErrDialTimeout))).To(Equal("dial_timeout"))
+			Expect(egress.ErrorReason(errors.New("some-error"))).To(Equal("other"))
+		})
+
+		It("only returns known reasons", func() {
+			Expect(egress.ErrorReasons).To(ContainElement(egress.ErrorReason(errors.New("some-error"))))
+		})
+	})
+
+	Describe("WithCategory()", func() {
+		It("keeps the message and matches the error and the category", func() {
+			orig := errors.New("some-error")
+			err := egress.WithCategory(orig, egress.ErrBackpressure)
+
+			Expect(err).To(MatchError("some-error"))
+			Expect(errors.Is(err, orig)).To(BeTrue())
+			Expect(errors.Is(err, egress.ErrBackpressure)).To(BeTrue())
+		})
+
+		It("returns the error without a category", func() {
+			orig := errors.New("some-error")
+
+			Expect(egress.WithCategory(orig, nil)).To(BeIdenticalTo(orig))
+			Expect(egress.WithCategory(nil, egress.ErrBackpressure)).To(BeNil())
+		})
+	})
+
+	Describe("DialError()", func() {
+		It("categorizes dial timeouts", func() {
+			err := &net.OpError{Op: "dial", Net: "tcp", Err: os.ErrDeadlineExceeded}
+
+			Expect(errors.Is(egress.DialError(err), egress.ErrDialTimeout)).To(BeTrue())
+		})
+
+		It("does not categorize other errors", func() {
+			refused := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+			readTimeout := &net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}
+
+			Expect(egress.DialError(refused)).To(BeIdenticalTo(refused))
+			Expect(egress.DialError(readTimeout)).To(BeIdenticalTo(readTimeout))
+		})
+	})
+
+	Describe("StatusCategory()", func() {
+		It("categorizes HTTP status codes", func() {
+			Expect(egress.StatusCategory(http.StatusRequestEntityTooLarge)).To(Equal(egress.ErrOversizeEnvelope))
+			Expect(egress.StatusCategory(http.StatusTooManyRequests)).To(Equal(egress.ErrBackpressure))
+			Expect(egress.StatusCategory(http.StatusServiceUnavailable)).To(Equal(egress.ErrBackpressure))
+			Expect(egress.StatusCategory(http.StatusBadRequest)).To(BeNil())
+		})
+	})
+})
@@ -0,0 +1,281 @@
+package syslog
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	metrics "code.cloudfoundry.org/go-metric-registry"
+
+	egress_v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
+)
+
+// batchSender collects entries into batches and sends them in the
+// background. A batch is sent once the size of its entries reaches
+// batchSize, every sendInterval and when no entry was added for idleFlush.
+// Failed batches are resent with the same batch ID until they are sent,
+// the retries are exhausted or the sender is closed. Requests are
+// cancelled when the context of the sender is done. The envelopes of a
+// batch are counted as egressed once the batch is sent. A panic in the
+// background is raised again by the next add, so that it reaches the
+// recoveringWriter of the drain.
+type batchSender[T any] struct {
+	ctx           context.Context
+	host          string
+	size          func(T) int
+	send          func(ctx context.Context, batch []T, batchID string) error
+	batchSize     int
+	sendInterval  time.Duration
+	idleFlush     time.Duration
+	retries       int
+	retryDuration RetryDuration
+	batchAge      metrics.Gauge
+	inFlight      *InFlightLimiter
+	globalLimiter *InFlightLimiter
+	egressByType  atomic.Pointer[egress_v2.EgressCounter]
+	entries       chan batchEntry[T]
+	quit          chan struct{}
+	wg            sync.WaitGroup
+	requests      sync.WaitGroup
+	panicOnce     sync.Once
+	panicked      chan struct{}
+	panicValue    any
+}
+
+// newBatchSender returns a batchSender with the default settings that
+// sends batches to host with send. size returns the size of an entry that
+// counts towards batchSize. ctx is usually the context of the binding, a
+// nil ctx never cancels requests. The sender has to be started after its
+// settings are applied.
+func newBatchSender[T any](
+	ctx context.Context,
+	host string,
+	batchSize int,
+	size func(T) int,
+	send func(ctx context.Context, batch []T, batchID string) error,
+) *batchSender[T] {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return &batchSender[T]{
+		ctx:           ctx,
+		host:          host,
+		size:          size,
+		send:          send,
+		batchSize:     batchSize,
+		sendInterval:  1 * time.Second,        // Default value
+		idleFlush:     100 * time.Millisecond, // Default value
+		retries:       3,                      // Default value
+		retryDuration: ExponentialDuration,    // Default value
+		inFlight:      NewInFlightLimiter(1),  // Default value
+		entries:       make(chan batchEntry[T]),
+		quit:          make(chan struct{}),
+		panicked:      make(chan struct{}),
+	}
+}
+
+// batchEntry is an entry of a batch with the type of the envelope it was
+// converted from. Only the last entry of an envelope that is converted to
+// several entries has a type so the envelope is counted once.
+type batchEntry[T any] struct {
+	value        T
+	envelopeType string
+}
+
+func (s *batchSender[T]) start() {
+	s.wg.Add(1)
+	go s.run()
+}
+
+// countEgress counts the envelopes of sent batches with c. It reports
+// true since the sender counts envelopes only once the drain accepted
+// them.
+func (s *batchSender[T]) countEgress(c *egress_v2.EgressCounter) bool {
+	s.egressByType.Store(c)
+	return true
+}
+
+// add queues the entry to be sent with the next batch. It blocks until the
+// sender accepts the entry or ctx is done. envelopeType is the type of the
+// envelope the entry was converted from as returned by
+// egress_v2.EnvelopeType, or empty if the envelope is not to be counted
+// with this entry.
+func (s *batchSender[T]) add(ctx context.Context, e T, envelopeType string) error {
+	select {
+	case <-s.panicked:
+		s.raisePanic()
+	default:
+	}
+
+	select {
+	case s.entries <- batchEntry[T]{value: e, envelopeType: envelopeType}:
+		return nil
+	case <-s.panicked:
+		s.raisePanic()
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// recoverPanic recovers from a panic of a goroutine of the sender and
+// keeps the first one to be raised by add.
+func (s *batchSender[T]) recoverPanic() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	log.Printf("recovered from panic in batch sender of %s: %v\n%s", s.host, r, debug.Stack())
+	s.panicOnce.Do(func() {
+		s.panicValue = r
+		close(s.panicked)
+	})
+}
+
+func (s *batchSender[T]) raisePanic() {
+	panic(fmt.Sprintf("batch sender of %s panicked: %v", s.host, s.panicValue))
+}
+
+func (s *batchSender[T]) run() {
+	defer s.wg.Done()
+	defer s.recoverPanic()
+
+	ticker := time.NewTicker(s.sendInterval)
+	defer ticker.Stop()
+
+	var idle <-chan time.Time
+	var idleTimer *time.Timer
+	if s.idleFlush > 0 {
+		idleTimer = time.NewTimer(s.idleFlush)
+		defer idleTimer.Stop()
+		idle = idleTimer.C
+	}
+
+	var batch []batchEntry[T]
+	var batchBytes int
+	var batchStart time.Time
+
+	sendBatch := func() {
+		if len(batch) > 0 {
+			s.dispatch(batch)
+			batch = nil
+			batchBytes = 0
+		}
+	}
+
+	for {
+		select {
+		case e := <-s.entries:
+			if len(batch) == 0 {
+				batchStart = time.Now()
+			}
+			batch = append(batch, e)
+			batchBytes += s.size(e.value)
+			if batchBytes >= s.batchSize {
+				sendBatch()
+			}
+			if idleTimer != nil {
+				idleTimer.Reset(s.idleFlush)
+			}
+		case <-idle:
+			sendBatch()
+		case <-ticker.C:
+			sendBatch()
+		case <-s.quit:
+			sendBatch()
+			return
+		}
+
+		s.reportBatchAge(len(batch), batchStart)
+	}
+}
+
+func (s *batchSender[T]) reportBatchAge(pending int, batchStart time.Time) {
+	if s.batchAge == nil {
+		return
+	}
+	if pending == 0 {
+		s.batchAge.Set(0)
+		return
+	}
+	s.batchAge.Set(time.Since(batchStart).Seconds())
+}
+
+// dispatch sends the batch in the background once a request slot of the
+// drain and of the shared limiter is free. While all slots are taken it
+// blocks, so batches queue up in the sender and writes apply backpressure
+// instead of requests piling up against a slow drain.
+func (s *batchSender[T]) dispatch(batch []batchEntry[T]) {
+	values := make([]T, len(batch))
+	types := make([]string, len(batch))
+	for i, e := range batch {
+		values[i] = e.value
+		types[i] = e.envelopeType
+	}
+
+	s.inFlight.acquire()
+	if s.globalLimiter != nil {
+		s.globalLimiter.acquire()
+	}
+
+	s.requests.Add(1)
+	go func() {
+		defer s.requests.Done()
+		defer s.inFlight.release()
+		if s.globalLimiter != nil {
+			defer s.globalLimiter.release()
+		}
+		defer s.recoverPanic()
+
+		if s.sendWithRetries(values) {
+			s.egressByType.Load().AddTypes(types...)
+		}
+	}()
+}
+
+// sendWithRetries sends the batch and resends it with the same batch ID
+// until it succeeds, the retries are exhausted, the sender is closed or
+// its context is done. It reports whether the batch was sent.
+func (s *batchSender[T]) sendWithRetries(batch []T) bool {
+	batchID := newBatchID()
+	for attempt := 0; ; attempt++ {
+		err := s.send(s.ctx, batch, batchID)
+		if err == nil {
+			return true
+		}
+
+		if s.ctx.Err() != nil {
+			log.Printf("failed to send batch %s to %s, dropping %d messages, err: %s", batchID, s.host, len(batch), err)
+			return false
+		}
+		if attempt >= s.retries {
+			log.Printf("failed to send batch %s to %s after %d attempts, dropping %d messages, err: %s", batchID, s.host, attempt+1, len(batch), err)
+			return false
+		}
+
+		sleepDuration := s.retryDuration(attempt)
+		log.Printf("failed to send batch %s to %s, retrying in %s, err: %s", batchID, s.host, sleepDuration, err)
+
+		t := time.NewTimer(sleepDuration)
+		select {
+		case <-t.C:
+		case <-s.quit:
+			t.Stop()
+			return false
+		case <-s.ctx.Done():
+			t.Stop()
+			return false
+		}
+	}
+}
+
+// close sends the pending batch and waits for the requests in flight.
+func (s *batchSender[T]) close() {
+	close(s.quit)
+	s.wg.Wait()
+	s.requests.Wait()
+}
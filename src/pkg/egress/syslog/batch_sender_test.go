@@ -0,0 +1,27 @@
+package syslog
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("batchSender", func() {
+	It("raises a panic of a request in the next add", func() {
+		s := newBatchSender(nil, "some-host", 1, func(int) int { return 1 }, func(context.Context, []int, string) error {
+			panic("some-panic")
+		})
+		s.start()
+		defer s.close()
+
+		Expect(s.add(context.Background(), 1, "")).To(Succeed())
+
+		add := func() (r any) {
+			defer func() { r = recover() }()
+			_ = s.add(context.Background(), 2, "")
+			return nil
+		}
+		Eventually(add).Should(Equal("batch sender of some-host panicked: some-panic"))
+	})
+})
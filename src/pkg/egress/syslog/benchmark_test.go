@@ -0,0 +1,165 @@
+package syslog_test
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
+	"code.cloudfoundry.org/loggregator-agent-release/src/internal/testhelper"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
+)
+
+// benchmarkEnvelopes are representative envelopes by kind. "mix" cycles
+// through envelopes in the proportions of a typical cell, where most
+// envelopes are app logs.
+func benchmarkEnvelopes() []benchmarkCase {
+	small := buildLogEnvelope("APP/PROC/WEB", "0", "GET /v2/info 200 12ms", loggregator_v2.Log_OUT)
+	large := buildLogEnvelope("APP/PROC/WEB", "0", strings.Repeat("a", 4096), loggregator_v2.Log_OUT)
+	multiline := buildLogEnvelope("APP/PROC/WEB", "0", strings.Repeat("at com.example.Class.method(Class.java:42)\n", 20), loggregator_v2.Log_ERR)
+	counter := buildCounterEnvelope("0")
+	gauge := buildGaugeEnvelope("0")
+	timer := buildTimerEnvelope("0")
+	event := buildEventEnvelope("0")
+
+	return []benchmarkCase{
+		{"log-small", []*loggregator_v2.Envelope{small}},
+		{"log-4KiB", []*loggregator_v2.Envelope{large}},
+		{"log-multiline", []*loggregator_v2.Envelope{multiline}},
+		{"counter", []*loggregator_v2.Envelope{counter}},
+		{"gauge", []*loggregator_v2.Envelope{gauge}},
+		{"timer", []*loggregator_v2.Envelope{timer}},
+		{"event", []*loggregator_v2.Envelope{event}},
+		{"mix", []*loggregator_v2.Envelope{small, small, small, small, small, small, large, multiline, counter, gauge}},
+	}
+}
+
+type benchmarkCase struct {
+	name string
+	envs []*loggregator_v2.Envelope
+}
+
+func BenchmarkToRFC5424(b *testing.B) {
+	c := syslog.NewConverter()
+	for _, bc := range benchmarkEnvelopes() {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := c.ToRFC5424(bc.envs[i%len(bc.envs)], "org.space.app"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkTCPWriter(b *testing.B) {
+	for _, framing := range []syslog.Framing{syslog.FramingOctetCounting, syslog.FramingNonTransparent} {
+		for _, bc := range benchmarkEnvelopes() {
+			b.Run(fmt.Sprintf("%s/%s", framing, bc.name), func(b *testing.B) {
+				addr := discardServer(b, nil)
+				w := syslog.NewTCPWriter(
+					benchmarkBinding("syslog", addr, framing),
+					syslog.DefaultNetworkTimeoutConfig(),
+					&metricsHelpers.SpyMetric{},
+					syslog.NewConverter(),
+				)
+				benchmarkWriter(b, w, bc.envs)
+			})
+		}
+	}
+}
+
+func BenchmarkTLSWriter(b *testing.B) {
+	certs := testhelper.GenerateCerts("benchmarkCA")
+	cert, err := tls.LoadX509KeyPair(certs.Cert("localhost"), certs.Key("localhost"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	serverConf := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	for _, framing := range []syslog.Framing{syslog.FramingOctetCounting, syslog.FramingNonTransparent} {
+		for _, bc := range benchmarkEnvelopes() {
+			b.Run(fmt.Sprintf("%s/%s", framing, bc.name), func(b *testing.B) {
+				addr := discardServer(b, serverConf)
+				w := syslog.NewTLSWriter(
+					benchmarkBinding("syslog-tls", addr, framing),
+					syslog.DefaultNetworkTimeoutConfig(),
+					&tls.Config{InsecureSkipVerify: true}, //nolint:gosec
+					&metricsHelpers.SpyMetric{},
+					syslog.NewConverter(),
+				)
+				benchmarkWriter(b, w, bc.envs)
+			})
+		}
+	}
+}
+
+func benchmarkWriter(b *testing.B, w egress.WriteCloser, envs []*loggregator_v2.Envelope) {
+	defer w.Close()
+
+	// The writers log every connection.
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(out)
+
+	// Connect before the timer is started.
+	if err := w.Write(context.Background(), envs[0]); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := w.Write(context.Background(), envs[i%len(envs)]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkBinding(scheme, addr string, framing syslog.Framing) *syslog.URLBinding {
+	return &syslog.URLBinding{
+		AppID:    "test-app-id",
+		Hostname: "org.space.app",
+		URL:      &url.URL{Scheme: scheme, Host: addr},
+		Framing:  framing,
+	}
+}
+
+// discardServer accepts connections and discards what is written to them
+// until the benchmark is done. If conf is not nil the connections use TLS.
+func discardServer(b *testing.B, conf *tls.Config) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	if conf != nil {
+		lis = tls.NewListener(lis, conf)
+	}
+	b.Cleanup(func() { lis.Close() })
+
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_ = conn.SetReadDeadline(time.Now().Add(time.Hour))
+				_, _ = io.Copy(io.Discard, conn)
+			}()
+		}
+	}()
+
+	return lis.Addr().String()
+}
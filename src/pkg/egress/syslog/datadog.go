@@ -0,0 +1,160 @@
+package syslog
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metrics "code.cloudfoundry.org/go-metric-registry"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
+	egress_v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
+	"github.com/valyala/fasthttp"
+)
+
+const defaultDatadogSource = "cloudfoundry"
+
+// datadogQueryParams are consumed by the DatadogWriter and are not forwarded
+// to the Datadog intake.
+var datadogQueryParams = []string{"format", "ddsource", "service"}
+
+// DatadogWriter sends log envelopes to the Datadog HTTP logs intake in
+// batches. Envelopes other than logs are ignored.
+type DatadogWriter struct {
+	hostname        string
+	url             *url.URL
+	apiKey          string
+	source          string
+	service         string
+	client          *fasthttp.Client
+	egressMetric    metrics.Counter
+	syslogConverter *Converter
+	batcher         *batchSender[datadogEntry]
+}
+
+type datadogEntry struct {
+	Source    string `json:"ddsource"`
+	Tags      string `json:"ddtags,omitempty"`
+	Hostname  string `json:"hostname,omitempty"`
+	Service   string `json:"service,omitempty"`
+	Status    string `json:"status,omitempty"`
+	Timestamp int64  `json:"timestamp"`
+	Message   string `json:"message"`
+}
+
+// NewDatadogWriter creates a new DatadogWriter. The API key is taken from
+// the token binding metadata, the password of the binding URL, or the
+// username if no password is given. The ddsource and service query
+// parameters override the respective attributes. By default the service is
+// the app name.
+func NewDatadogWriter(
+	binding *URLBinding,
+	netConf NetworkTimeoutConfig,
+	tlsConf *tls.Config,
+	egressMetric metrics.Counter,
+	c *Converter,
+) egress.WriteCloser {
+	q := binding.URL.Query()
+	source := q.Get("ddsource")
+	if source == "" {
+		source = defaultDatadogSource
+	}
+
+	w := &DatadogWriter{
+		hostname:        binding.Hostname,
+		url:             stripQueryParams(binding.URL, datadogQueryParams...),
+		apiKey:          credentialFromBinding(binding),
+		source:          source,
+		service:         q.Get("service"),
+		client:          httpClient(netConf, tlsConf),
+		egressMetric:    egressMetric,
+		syslogConverter: c,
+	}
+	w.batcher = newBatchSender(binding.Context, w.url.Host, defaultPushBatchSize, countEntry[datadogEntry], w.send)
+	w.batcher.start()
+
+	return w
+}
+
+// Write queues the envelope to be sent with the next batch. It blocks
+// until the sender accepts the envelope or ctx is done.
+func (w *DatadogWriter) Write(ctx context.Context, env *loggregator_v2.Envelope) error {
+	if env.GetLog() == nil {
+		return nil
+	}
+
+	service := w.service
+	if service == "" {
+		service = env.GetTags()["app_name"]
+	}
+	if service == "" {
+		service = env.GetSourceId()
+	}
+
+	status := "info"
+	if env.GetLog().GetType() == loggregator_v2.Log_ERR {
+		status = "error"
+	}
+
+	return w.batcher.add(ctx, datadogEntry{
+		Source:    w.source,
+		Tags:      datadogTags(env),
+		Hostname:  w.syslogConverter.BuildHostname(env, w.hostname),
+		Service:   service,
+		Status:    status,
+		Timestamp: env.GetTimestamp() / 1e6,
+		Message:   string(removeNulls(env.GetLog().GetPayload())),
+	}, egress_v2.EnvelopeType(env))
+}
+
+// countEgress counts the envelopes of the batches the drain accepted with
+// c.
+func (w *DatadogWriter) countEgress(c *egress_v2.EgressCounter) bool {
+	return w.batcher.countEgress(c)
+}
+
+func (w *DatadogWriter) send(ctx context.Context, entries []datadogEntry, _ string) error {
+	body, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	err = sendPushRequest(ctx, w.client, pushRequest{
+		url:         w.url,
+		contentType: "application/json",
+		headers:     map[string]string{"DD-API-KEY": w.apiKey},
+		body:        body,
+	})
+	if err != nil {
+		return err
+	}
+
+	w.egressMetric.Add(float64(len(entries)))
+	return nil
+}
+
+// Close sends any queued entries.
+func (w *DatadogWriter) Close() error {
+	w.batcher.close()
+	return nil
+}
+
+// datadogTags formats the envelope tags, source_id and instance_id as a
+// sorted, comma separated list of key:value pairs.
+func datadogTags(env *loggregator_v2.Envelope) string {
+	tags := make([]string, 0, len(env.GetTags())+2)
+	for k, v := range env.GetTags() {
+		tags = append(tags, fmt.Sprintf("%s:%s", k, v))
+	}
+	tags = append(tags, "source_id:"+env.GetSourceId())
+	if env.GetInstanceId() != "" {
+		tags = append(tags, "instance_id:"+env.GetInstanceId())
+	}
+	sort.Strings(tags)
+
+	return strings.Join(tags, ",")
+}
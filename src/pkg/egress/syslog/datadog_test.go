@@ -0,0 +1,116 @@
+package syslog_test
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DatadogWriter", func() {
+	var (
+		netConf          syslog.NetworkTimeoutConfig
+		skipSSLTLSConfig = &tls.Config{
+			InsecureSkipVerify: true, //nolint:gosec
+		}
+		c = syslog.NewConverter()
+	)
+
+	It("posts batches of log envelopes to the logs intake", func() {
+		drain := newSpyPushDrain(http.StatusAccepted, "")
+		defer drain.Close()
+
+		b := buildURLBinding(
+			withUserInfo(drain.URL, "", "dd-api-key")+"/api/v2/logs?format=datadog&service=my-service",
+			"test-app-id",
+			"test-hostname",
+		)
+		sm := &metricsHelpers.SpyMetric{}
+		writer := syslog.NewDatadogWriter(b, netConf, skipSSLTLSConfig, sm, c)
+
+		Expect(writer.Write(context.Background(), buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT))).To(Succeed())
+		Expect(writer.Write(context.Background(), buildLogEnvelope("APP", "2", "an error", loggregator_v2.Log_ERR))).To(Succeed())
+		Expect(writer.Close()).To(Succeed())
+
+		Expect(drain.requests()).To(HaveLen(1))
+		req := drain.requests()[0]
+		Expect(req.path).To(Equal("/api/v2/logs"))
+		Expect(req.query).To(BeEmpty())
+		Expect(req.header.Get("DD-API-KEY")).To(Equal("dd-api-key"))
+		Expect(req.header.Get("Content-Encoding")).To(Equal("gzip"))
+
+		var entries []map[string]any
+		Expect(json.Unmarshal(req.body, &entries)).To(Succeed())
+		Expect(entries).To(HaveLen(2))
+		Expect(entries[0]).To(HaveKeyWithValue("ddsource", "cloudfoundry"))
+		Expect(entries[0]).To(HaveKeyWithValue("ddtags", "instance_id:1,source_id:test-app-id,source_type:APP"))
+		Expect(entries[0]).To(HaveKeyWithValue("hostname", "test-hostname"))
+		Expect(entries[0]).To(HaveKeyWithValue("service", "my-service"))
+		Expect(entries[0]).To(HaveKeyWithValue("status", "info"))
+		Expect(entries[0]).To(HaveKeyWithValue("message", "just a test"))
+		Expect(entries[1]).To(HaveKeyWithValue("status", "error"))
+
+		Expect(sm.Value()).To(BeNumerically("==", 2))
+	})
+
+	It("defaults the service to the app name", func() {
+		drain := newSpyPushDrain(http.StatusAccepted, "")
+		defer drain.Close()
+
+		b := buildURLBinding(drain.URL+"?format=datadog", "test-app-id", "test-hostname")
+		writer := syslog.NewDatadogWriter(b, netConf, skipSSLTLSConfig, &metricsHelpers.SpyMetric{}, c)
+
+		env := buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT)
+		env.Tags["app_name"] = "my-app"
+		Expect(writer.Write(context.Background(), env)).To(Succeed())
+		Expect(writer.Close()).To(Succeed())
+
+		var entries []map[string]any
+		Expect(json.Unmarshal(drain.requests()[0].body, &entries)).To(Succeed())
+		Expect(entries[0]).To(HaveKeyWithValue("service", "my-app"))
+	})
+
+	It("sends batches on an interval", func() {
+		drain := newSpyPushDrain(http.StatusAccepted, "")
+		defer drain.Close()
+
+		b := buildURLBinding(drain.URL+"?format=datadog", "test-app-id", "test-hostname")
+		writer := syslog.NewDatadogWriter(b, netConf, skipSSLTLSConfig, &metricsHelpers.SpyMetric{}, c)
+		defer writer.Close()
+
+		Expect(writer.Write(context.Background(), buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT))).To(Succeed())
+		Eventually(drain.requests, 3).Should(HaveLen(1))
+	})
+
+	It("ignores non-log envelopes", func() {
+		drain := newSpyPushDrain(http.StatusAccepted, "")
+		defer drain.Close()
+
+		b := buildURLBinding(drain.URL+"?format=datadog", "test-app-id", "test-hostname")
+		writer := syslog.NewDatadogWriter(b, netConf, skipSSLTLSConfig, &metricsHelpers.SpyMetric{}, c)
+
+		Expect(writer.Write(context.Background(), buildGaugeEnvelope("1"))).To(Succeed())
+		Expect(writer.Close()).To(Succeed())
+		Expect(drain.requests()).To(BeEmpty())
+	})
+
+	It("does not emit egress metrics when the intake rejects the batch", func() {
+		drain := newSpyPushDrain(http.StatusForbidden, "")
+		defer drain.Close()
+
+		sm := &metricsHelpers.SpyMetric{}
+		b := buildURLBinding(drain.URL+"?format=datadog", "test-app-id", "test-hostname")
+		writer := syslog.NewDatadogWriter(b, netConf, skipSSLTLSConfig, sm, c)
+
+		Expect(writer.Write(context.Background(), buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT))).To(Succeed())
+		Expect(writer.Close()).To(Succeed())
+		Expect(drain.requests()).To(HaveLen(1))
+		Expect(sm.Value()).To(BeNumerically("==", 0))
+	})
+})
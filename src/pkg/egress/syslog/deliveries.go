@@ -0,0 +1,185 @@
+package syslog
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	metrics "code.cloudfoundry.org/go-metric-registry"
+
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
+)
+
+// DeliveryMetricClient creates and removes the gauges of the last
+// deliveries.
+type DeliveryMetricClient interface {
+	NewGauge(name, helpText string, o ...metrics.MetricOption) metrics.Gauge
+	RemoveGauge(g metrics.Gauge)
+}
+
+// Delivery is the last successful delivery to the drain of an app binding.
+type Delivery struct {
+	AppID       string `json:"app_id"`
+	Drain       string `json:"drain"`
+	BindingHash string `json:"binding_hash"`
+	// LastDelivery is zero if nothing was delivered to the drain since
+	// the agent started.
+	LastDelivery time.Time `json:"last_delivery"`
+}
+
+// Deliveries tracks when envelopes were last delivered successfully to the
+// drain of every app binding, so that support can tell when a drain last
+// received data without access to the receiver. Deliveries survive writers
+// being closed while their app is idle and are forgotten when the binding
+// is removed.
+type Deliveries struct {
+	m DeliveryMetricClient
+
+	mu       sync.Mutex
+	bindings map[deliveryKey]*delivery
+}
+
+type deliveryKey struct {
+	appID     string
+	drainHash string
+}
+
+// newDeliveryKey returns the key of the binding of the app to the drain
+// URL u. Bindings are tracked and forgotten by the parsed drain URL, so
+// that both agree on URLs that change when they are parsed.
+func newDeliveryKey(appID string, u *url.URL) deliveryKey {
+	return deliveryKey{appID: appID, drainHash: egress.DrainHash(u.String())}
+}
+
+type delivery struct {
+	appID       string
+	drain       string
+	bindingHash string
+	last        atomic.Int64
+	gauge       metrics.Gauge
+}
+
+// NewDeliveries returns Deliveries. If m is not nil the time of the last
+// delivery of every binding is reported in the
+// drain_last_delivery_timestamp_seconds gauge, labelled with a hash of the
+// app ID and drain so that app IDs and drain URLs are not exposed.
+func NewDeliveries(m DeliveryMetricClient) *Deliveries {
+	return &Deliveries{
+		m:        m,
+		bindings: make(map[deliveryKey]*delivery),
+	}
+}
+
+// Deliveries returns the last deliveries of the bindings of the app or of
+// all apps if appID is empty, ordered by app ID and binding hash.
+func (d *Deliveries) Deliveries(appID string) []Delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	deliveries := make([]Delivery, 0, len(d.bindings))
+	for k, b := range d.bindings {
+		if appID != "" && k.appID != appID {
+			continue
+		}
+		dl := Delivery{AppID: b.appID, Drain: b.drain, BindingHash: b.bindingHash}
+		if last := b.last.Load(); last != 0 {
+			dl.LastDelivery = time.Unix(0, last).UTC()
+		}
+		deliveries = append(deliveries, dl)
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		if deliveries[i].AppID != deliveries[j].AppID {
+			return deliveries[i].AppID < deliveries[j].AppID
+		}
+		return deliveries[i].BindingHash < deliveries[j].BindingHash
+	})
+	return deliveries
+}
+
+// ServeHTTP serves the last deliveries as JSON. The app_id query parameter
+// limits them to the bindings of an app.
+func (d *Deliveries) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(d.Deliveries(r.URL.Query().Get("app_id")))
+}
+
+// Forget stops tracking the binding of the app to the drain URL.
+func (d *Deliveries) Forget(appID, drainURL string) {
+	if d == nil {
+		return
+	}
+	u, err := url.Parse(drainURL)
+	if err != nil {
+		// Writers are not created for drain URLs that cannot be parsed,
+		// so the binding was never tracked.
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	k := newDeliveryKey(appID, u)
+	b, ok := d.bindings[k]
+	if !ok {
+		return
+	}
+	delete(d.bindings, k)
+	if b.gauge != nil {
+		d.m.RemoveGauge(b.gauge)
+	}
+}
+
+// track returns the delivery of the binding of ub, which is created if it
+// is not tracked yet. drain is the drain URL without credentials.
+func (d *Deliveries) track(ub *URLBinding, drain string) *delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	k := newDeliveryKey(ub.AppID, ub.URL)
+	if b, ok := d.bindings[k]; ok {
+		return b
+	}
+
+	sum := sha256.Sum256([]byte(k.appID + " " + k.drainHash))
+	b := &delivery{
+		appID:       ub.AppID,
+		drain:       drain,
+		bindingHash: hex.EncodeToString(sum[:8]),
+	}
+	if d.m != nil {
+		b.gauge = d.m.NewGauge(
+			"drain_last_delivery_timestamp_seconds",
+			"Unix time of the last successful delivery to the drain of an app binding.",
+			metrics.WithMetricLabels(map[string]string{"binding_hash": b.bindingHash}),
+		)
+	}
+	d.bindings[k] = b
+	return b
+}
+
+func (b *delivery) record(t time.Time) {
+	b.last.Store(t.UnixNano())
+	if b.gauge != nil {
+		b.gauge.Set(float64(t.UnixNano()) / float64(time.Second))
+	}
+}
+
+// deliveryCounter records a delivery whenever a writer counts envelopes as
+// egressed, which writers only do once they were sent successfully.
+type deliveryCounter struct {
+	metrics.Counter
+	delivery *delivery
+}
+
+func (c deliveryCounter) Add(n float64) {
+	c.Counter.Add(n)
+	if n > 0 {
+		c.delivery.record(time.Now())
+	}
+}
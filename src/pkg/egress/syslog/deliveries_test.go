@@ -0,0 +1,155 @@
+package syslog_test
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Deliveries", func() {
+	var (
+		sm         *metricsHelpers.SpyMetricsRegistry
+		deliveries *syslog.Deliveries
+		f          syslog.WriterFactory
+	)
+
+	BeforeEach(func() {
+		sm = metricsHelpers.NewMetricsRegistry()
+		deliveries = syslog.NewDeliveries(sm)
+		f = syslog.NewWriterFactory(
+			&tls.Config{},                         //nolint:gosec
+			&tls.Config{InsecureSkipVerify: true}, //nolint:gosec
+			syslog.NetworkTimeoutConfig{},
+			sm,
+			syslog.WithDeliveries(deliveries),
+		)
+	})
+
+	write := func(drain *SpyDrain, appID string) {
+		w, err := f.NewWriter(buildURLBinding(drain.URL+"/?user=x", appID, "host"))
+		Expect(err).ToNot(HaveOccurred())
+		defer w.Close()
+
+		env := buildLogEnvelope("APP", "1", "message", loggregator_v2.Log_OUT)
+		Expect(w.Write(context.Background(), env)).To(Succeed())
+	}
+
+	It("records the last successful delivery of app bindings", func() {
+		drain := newMockOKDrain()
+		defer drain.Close()
+
+		write(drain, "app-1")
+
+		d := deliveries.Deliveries("")
+		Expect(d).To(HaveLen(1))
+		Expect(d[0].AppID).To(Equal("app-1"))
+		Expect(d[0].Drain).To(Equal(drain.URL + "/"))
+		Expect(d[0].BindingHash).To(HaveLen(16))
+		Expect(d[0].LastDelivery).To(BeTemporally("~", time.Now(), time.Second))
+
+		g := sm.GetMetric("drain_last_delivery_timestamp_seconds", map[string]string{"binding_hash": d[0].BindingHash})
+		Expect(g.Value()).To(BeNumerically("~", time.Now().Unix(), 1))
+	})
+
+	It("does not record failed deliveries", func() {
+		drain := newMockErrorDrain()
+		defer drain.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		ub := buildURLBinding(drain.URL, "app-1", "host")
+		ub.Context = ctx
+		w, err := f.NewWriter(ub)
+		Expect(err).ToNot(HaveOccurred())
+		defer w.Close()
+
+		err = w.Write(context.Background(), buildLogEnvelope("APP", "1", "message", loggregator_v2.Log_OUT))
+		Expect(err).To(HaveOccurred())
+
+		d := deliveries.Deliveries("app-1")
+		Expect(d).To(HaveLen(1))
+		Expect(d[0].LastDelivery.IsZero()).To(BeTrue())
+	})
+
+	It("does not track aggregate drains", func() {
+		drain := newMockOKDrain()
+		defer drain.Close()
+
+		write(drain, "")
+
+		Expect(deliveries.Deliveries("")).To(BeEmpty())
+	})
+
+	It("forgets removed bindings", func() {
+		drain := newMockOKDrain()
+		defer drain.Close()
+
+		write(drain, "app-1")
+		write(drain, "app-2")
+		hash := deliveries.Deliveries("app-1")[0].BindingHash
+
+		deliveries.Forget("app-1", drain.URL+"/?other=param")
+
+		Expect(deliveries.Deliveries("")).To(ConsistOf(HaveField("AppID", "app-2")))
+		Expect(sm.HasMetric("drain_last_delivery_timestamp_seconds", map[string]string{"binding_hash": hash})).To(BeFalse())
+	})
+
+	It("forgets bindings by the drain URL of the binding", func() {
+		drain := newMockOKDrain()
+		defer drain.Close()
+
+		drainURL := strings.Replace(drain.URL, "https://", "HTTPS://", 1) + "/?user=x"
+		w, err := f.NewDrainWriter(context.Background(), syslog.Binding{
+			AppId: "app-1",
+			Drain: syslog.Drain{Url: drainURL},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		defer w.Close()
+		Expect(w.Write(context.Background(), buildLogEnvelope("APP", "1", "message", loggregator_v2.Log_OUT))).To(Succeed())
+		hash := deliveries.Deliveries("app-1")[0].BindingHash
+
+		deliveries.Forget("app-1", drainURL)
+
+		Expect(deliveries.Deliveries("")).To(BeEmpty())
+		Expect(sm.HasMetric("drain_last_delivery_timestamp_seconds", map[string]string{"binding_hash": hash})).To(BeFalse())
+	})
+
+	It("serves the deliveries of an app", func() {
+		drain := newMockOKDrain()
+		defer drain.Close()
+
+		write(drain, "app-1")
+		write(drain, "app-2")
+
+		rec := httptest.NewRecorder()
+		deliveries.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/deliveries?app_id=app-2", nil))
+
+		var body []syslog.Delivery
+		Expect(json.NewDecoder(rec.Body).Decode(&body)).To(Succeed())
+		Expect(body).To(HaveLen(1))
+		Expect(body[0].AppID).To(Equal("app-2"))
+		Expect(body[0].LastDelivery).ToNot(BeZero())
+	})
+
+	It("does not report gauges without a metric client", func() {
+		deliveries = syslog.NewDeliveries(nil)
+		f = syslog.NewWriterFactory(&tls.Config{}, &tls.Config{InsecureSkipVerify: true}, syslog.NetworkTimeoutConfig{}, sm, syslog.WithDeliveries(deliveries)) //nolint:gosec
+		drain := newMockOKDrain()
+		defer drain.Close()
+
+		write(drain, "app-1")
+
+		Expect(deliveries.Deliveries("app-1")[0].LastDelivery).ToNot(BeZero())
+		Expect(sm.HasMetric("drain_last_delivery_timestamp_seconds", map[string]string{"binding_hash": deliveries.Deliveries("app-1")[0].BindingHash})).To(BeFalse())
+	})
+})
@@ -0,0 +1,57 @@
+package syslog
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
+)
+
+// deliveryStatusWriter notifies the app bound to a drain when writes to the
+// drain fail after all retries and when they succeed again. Notices are
+// sent at most once per interval so a flapping drain does not flood the
+// app's logs.
+type deliveryStatusWriter struct {
+	egress.WriteCloser
+	drain    string
+	notify   func(message string)
+	interval time.Duration
+
+	failing    bool
+	lastNotice time.Time
+}
+
+func newDeliveryStatusWriter(w egress.WriteCloser, drain string, interval time.Duration, notify func(string)) *deliveryStatusWriter {
+	return &deliveryStatusWriter{
+		WriteCloser: w,
+		drain:       drain,
+		notify:      notify,
+		interval:    interval,
+	}
+}
+
+// Write writes the envelope to the drain. It is not safe to call Write
+// concurrently.
+func (w *deliveryStatusWriter) Write(ctx context.Context, env *loggregator_v2.Envelope) error {
+	err := w.WriteCloser.Write(ctx, env)
+	switch {
+	case err != nil && !w.failing && !egress.ContextDone(ctx):
+		w.failing = true
+		w.emit(fmt.Sprintf("syslog drain %s unreachable: %s", w.drain, err))
+	case err == nil && w.failing:
+		w.failing = false
+		w.emit(fmt.Sprintf("syslog drain %s recovered", w.drain))
+	}
+	return err
+}
+
+func (w *deliveryStatusWriter) emit(message string) {
+	now := time.Now()
+	if !w.lastNotice.IsZero() && now.Sub(w.lastNotice) < w.interval {
+		return
+	}
+	w.lastNotice = now
+	w.notify(message)
+}
@@ -0,0 +1,69 @@
+package syslog
+
+import (
+	"encoding/json"
+	"net/url"
+)
+
+// DrainMetadata is opaque per-binding metadata, such as format hints or
+// tenant IDs, passed from the binding provider to the writers. It is stored
+// in a canonical encoding so that bindings remain comparable and can be used
+// as map keys.
+type DrainMetadata struct {
+	encoded string
+}
+
+// NewDrainMetadata returns DrainMetadata holding the given key value pairs.
+func NewDrainMetadata(m map[string]string) DrainMetadata {
+	if len(m) == 0 {
+		return DrainMetadata{}
+	}
+
+	v := make(url.Values, len(m))
+	for k, val := range m {
+		v.Set(k, val)
+	}
+
+	// Encode sorts by key, which makes the encoding canonical.
+	return DrainMetadata{encoded: v.Encode()}
+}
+
+// Get returns the value for the given key and whether it was set.
+func (m DrainMetadata) Get(key string) (string, bool) {
+	if m.encoded == "" {
+		return "", false
+	}
+
+	v, err := url.ParseQuery(m.encoded)
+	if err != nil {
+		return "", false
+	}
+	if _, ok := v[key]; !ok {
+		return "", false
+	}
+
+	return v.Get(key), true
+}
+
+// Map returns a copy of the metadata as a map.
+func (m DrainMetadata) Map() map[string]string {
+	v, _ := url.ParseQuery(m.encoded)
+	result := make(map[string]string, len(v))
+	for k := range v {
+		result[k] = v.Get(k)
+	}
+	return result
+}
+
+func (m DrainMetadata) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.Map())
+}
+
+func (m *DrainMetadata) UnmarshalJSON(b []byte) error {
+	var raw map[string]string
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	*m = NewDrainMetadata(raw)
+	return nil
+}
@@ -0,0 +1,45 @@
+package syslog_test
+
+import (
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
+)
+
+var _ = Describe("DrainMetadata", func() {
+	It("returns the stored values", func() {
+		m := syslog.NewDrainMetadata(map[string]string{"tenant": "t-1", "format": "loki"})
+
+		v, ok := m.Get("tenant")
+		Expect(ok).To(BeTrue())
+		Expect(v).To(Equal("t-1"))
+
+		_, ok = m.Get("missing")
+		Expect(ok).To(BeFalse())
+
+		Expect(m.Map()).To(Equal(map[string]string{"tenant": "t-1", "format": "loki"}))
+	})
+
+	It("is comparable regardless of insertion order", func() {
+		a := syslog.NewDrainMetadata(map[string]string{"a": "1", "b": "2"})
+		b := syslog.NewDrainMetadata(map[string]string{"b": "2", "a": "1"})
+
+		Expect(a == b).To(BeTrue())
+		Expect(syslog.NewDrainMetadata(nil) == syslog.DrainMetadata{}).To(BeTrue())
+	})
+
+	It("round trips through JSON", func() {
+		m := syslog.NewDrainMetadata(map[string]string{"tenant": "t-1"})
+
+		j, err := json.Marshal(m)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(j).To(MatchJSON(`{"tenant":"t-1"}`))
+
+		var decoded syslog.DrainMetadata
+		Expect(json.Unmarshal(j, &decoded)).To(Succeed())
+		Expect(decoded).To(Equal(m))
+	})
+})
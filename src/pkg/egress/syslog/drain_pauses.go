@@ -0,0 +1,147 @@
+package syslog
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
+)
+
+// DrainPauses pauses writes to drains at runtime, e.g. with agentctl.
+// Drains are identified by their drain hash. While a drain is paused its
+// envelopes are buffered in its diode and dropped once the diode is full,
+// as if the drain was slow. Held writes of paused drains do not count as
+// stalled.
+type DrainPauses struct {
+	mu     sync.Mutex
+	paused map[string]chan struct{}
+	// all is closed when all drains are resumed, nil while they are not
+	// paused.
+	all chan struct{}
+}
+
+// NewDrainPauses returns DrainPauses without any paused drains.
+func NewDrainPauses() *DrainPauses {
+	return &DrainPauses{paused: make(map[string]chan struct{})}
+}
+
+// SetPaused pauses or resumes the drain with the given URL or drain hash.
+// The drain hash covers the full drain URL, so a URL has to be the exact
+// URL of the binding including its credentials and query parameters.
+func (p *DrainPauses) SetPaused(drain string, paused bool) error {
+	if drain == "" {
+		return errors.New("no drain given")
+	}
+	hash := drain
+	if strings.Contains(drain, "://") {
+		// Hash the URL like the connector does.
+		u, err := url.Parse(drain)
+		if err != nil {
+			return err
+		}
+		hash = egress.DrainHash(u.String())
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	resume, ok := p.paused[hash]
+	switch {
+	case paused && !ok:
+		p.paused[hash] = make(chan struct{})
+	case !paused && ok:
+		close(resume)
+		delete(p.paused, hash)
+	}
+	return nil
+}
+
+// SetAllPaused pauses or resumes all drains, e.g. when the agent is paused
+// by the Windows service control manager. Drains paused with SetPaused stay
+// paused when all drains are resumed.
+func (p *DrainPauses) SetAllPaused(paused bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch {
+	case paused && p.all == nil:
+		p.all = make(chan struct{})
+	case !paused && p.all != nil:
+		close(p.all)
+		p.all = nil
+	}
+}
+
+// Paused returns the hashes of the paused drains.
+func (p *DrainPauses) Paused() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	hashes := make([]string, 0, len(p.paused))
+	for hash := range p.paused {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+	return hashes
+}
+
+func (p *DrainPauses) isPaused(hash string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, ok := p.paused[hash]
+	return ok || p.all != nil
+}
+
+// wait blocks while the drain is paused or until ctx is done.
+func (p *DrainPauses) wait(ctx context.Context, hash string) error {
+	for {
+		p.mu.Lock()
+		resume, ok := p.paused[hash]
+		if !ok {
+			resume = p.all
+		}
+		p.mu.Unlock()
+		if resume == nil {
+			return nil
+		}
+
+		select {
+		case <-resume:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// pausingWriter holds writes to a drain while it is paused.
+type pausingWriter struct {
+	egress.WriteCloser
+	hash   string
+	pauses *DrainPauses
+}
+
+func (w pausingWriter) Write(ctx context.Context, env *loggregator_v2.Envelope) error {
+	if err := w.pauses.wait(ctx, w.hash); err != nil {
+		return err
+	}
+	return w.WriteCloser.Write(ctx, env)
+}
+
+// pausableDiodeWriter does not report the writes held by a paused drain as
+// stalled, so that the watchdog does not restart paused drains.
+type pausableDiodeWriter struct {
+	*egress.DiodeWriter
+	hash   string
+	pauses *DrainPauses
+}
+
+func (w pausableDiodeWriter) Stalled(deadline time.Duration) bool {
+	return !w.pauses.isPaused(w.hash) && w.DiodeWriter.Stalled(deadline)
+}
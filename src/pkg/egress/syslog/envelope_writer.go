@@ -1,6 +1,7 @@
 package syslog
 
 import (
+	"context"
 	"log"
 
 	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
@@ -16,29 +17,51 @@ type EnvelopeWriter struct {
 	nextEnvelope nextEnvelope
 	ingress      metrics.Counter
 	log          *log.Logger
+	loopDetector *LoopDetector
 }
 
-func NewEnvelopeWriter(drainGetter drainGetter, nextEnvelope nextEnvelope, ingress metrics.Counter, log *log.Logger) *EnvelopeWriter {
-	return &EnvelopeWriter{
+// EnvelopeWriterOption allows an envelope writer to be customized.
+type EnvelopeWriterOption func(*EnvelopeWriter)
+
+// WithLoopDetector checks every envelope for the loop marker before it is
+// written to drains.
+func WithLoopDetector(d *LoopDetector) EnvelopeWriterOption {
+	return func(w *EnvelopeWriter) {
+		w.loopDetector = d
+	}
+}
+
+func NewEnvelopeWriter(drainGetter drainGetter, nextEnvelope nextEnvelope, ingress metrics.Counter, log *log.Logger, opts ...EnvelopeWriterOption) *EnvelopeWriter {
+	w := &EnvelopeWriter{
 		drainGetter:  drainGetter,
 		nextEnvelope: nextEnvelope,
 		ingress:      ingress,
 		log:          log,
 	}
+	for _, o := range opts {
+		o(w)
+	}
+	return w
 }
 
-func (w *EnvelopeWriter) Run() {
-	for {
+// Run writes envelopes to the drains of their source with ctx until ctx is
+// done.
+func (w *EnvelopeWriter) Run(ctx context.Context) {
+	for ctx.Err() == nil {
 		envelope := w.nextEnvelope()
-		w.writeEnvelope(envelope)
+		w.writeEnvelope(ctx, envelope)
 	}
 }
 
-func (w *EnvelopeWriter) writeEnvelope(envelope *loggregator_v2.Envelope) {
+func (w *EnvelopeWriter) writeEnvelope(ctx context.Context, envelope *loggregator_v2.Envelope) {
+	if w.loopDetector != nil && w.loopDetector.Drop(envelope) {
+		return
+	}
+
 	drains := w.drainGetter(envelope.GetSourceId())
 	for _, drain := range drains {
 		w.ingress.Add(1)
-		err := drain.Write(envelope)
+		err := drain.Write(ctx, envelope)
 		if err != nil {
 			w.log.Print(err)
 		}
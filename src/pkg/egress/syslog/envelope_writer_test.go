@@ -1,6 +1,8 @@
 package syslog_test
 
 import (
+	"context"
+
 	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
 	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
@@ -31,7 +33,7 @@ var _ = Describe("EnvelopeWriter", func() {
 
 		writer := syslog.NewEnvelopeWriter(drainGetter, nextEnvelope, &metricsHelpers.SpyMetric{}, nil)
 
-		go writer.Run()
+		go writer.Run(context.Background())
 		Eventually(spyWriter1.envelopes).Should(Receive(Equal(envelope)))
 		Eventually(spyWriter2.envelopes).Should(Receive(Equal(envelope)))
 	})
@@ -51,7 +53,7 @@ var _ = Describe("EnvelopeWriter", func() {
 
 		writer := syslog.NewEnvelopeWriter(drainGetter, nextEnvelope, &metricsHelpers.SpyMetric{}, nil)
 
-		go writer.Run()
+		go writer.Run(context.Background())
 		Eventually(spyWriter.envelopes).Should(HaveLen(100))
 	})
 
@@ -76,9 +78,35 @@ var _ = Describe("EnvelopeWriter", func() {
 		ingressMetric := &metricsHelpers.SpyMetric{}
 		writer := syslog.NewEnvelopeWriter(drainGetter, nextEnvelope, ingressMetric, nil)
 
-		go writer.Run()
+		go writer.Run(context.Background())
 		Eventually(ingressMetric.Value).Should(BeNumerically("==", 2))
 	})
+
+	It("does not write envelopes dropped by the loop detector", func() {
+		spyWriter := newSpyWriter()
+		drainGetter := func(string) []egress.Writer {
+			return []egress.Writer{spyWriter}
+		}
+
+		envelopes := make(chan *loggregator_v2.Envelope, 2)
+		envelopes <- buildLogEnvelope("APP", "1", "[loop@47450] looped", loggregator_v2.Log_OUT)
+		envelopes <- buildLogEnvelope("APP", "1", "not looped", loggregator_v2.Log_OUT)
+
+		spyMetricClient := metricsHelpers.NewMetricsRegistry()
+		writer := syslog.NewEnvelopeWriter(
+			drainGetter,
+			func() *loggregator_v2.Envelope { return <-envelopes },
+			&metricsHelpers.SpyMetric{},
+			nil,
+			syslog.WithLoopDetector(syslog.NewLoopDetector(spyMetricClient, true)),
+		)
+
+		go writer.Run(context.Background())
+		var env *loggregator_v2.Envelope
+		Eventually(spyWriter.envelopes).Should(Receive(&env))
+		Expect(string(env.GetLog().GetPayload())).To(Equal("not looped"))
+		Expect(spyMetricClient.GetMetric("loops_detected", nil).Value()).To(Equal(1.0))
+	})
 })
 
 type spyWriter struct {
@@ -91,7 +119,7 @@ func newSpyWriter() *spyWriter {
 	}
 }
 
-func (w *spyWriter) Write(env *loggregator_v2.Envelope) error {
+func (w *spyWriter) Write(_ context.Context, env *loggregator_v2.Envelope) error {
 	w.envelopes <- env
 	return nil
 }
@@ -0,0 +1,78 @@
+package syslog
+
+import (
+	"strings"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+)
+
+// FieldFormat composes the PROCID or MSGID header field of syslog messages
+// from envelope fields. Placeholders in braces are replaced and any other
+// text is kept:
+//
+//   - {source_type} is the source type tag, e.g. APP/PROC/WEB
+//   - {source} is the source type without qualifiers, e.g. APP
+//   - {process_type} is the process_type tag or otherwise the process type
+//     of APP/PROC source types, e.g. WEB
+//   - {instance} is the instance ID, e.g. 0
+//   - {source_id} is the source ID, usually the app GUID
+//
+// For example "{process_type}.{instance}" results in "WEB.0". Whitespace
+// and non-printable characters are removed from the result.
+type FieldFormat string
+
+var fieldFormatPlaceholders = map[string]func(env *loggregator_v2.Envelope) string{
+	"source_type": func(env *loggregator_v2.Envelope) string {
+		return env.GetTags()["source_type"]
+	},
+	"source": func(env *loggregator_v2.Envelope) string {
+		st, _, _ := strings.Cut(env.GetTags()["source_type"], "/")
+		return st
+	},
+	"process_type": func(env *loggregator_v2.Envelope) string {
+		if pt := env.GetTags()["process_type"]; pt != "" {
+			return pt
+		}
+		if pt, ok := strings.CutPrefix(env.GetTags()["source_type"], "APP/PROC/"); ok {
+			return pt
+		}
+		return ""
+	},
+	"instance": func(env *loggregator_v2.Envelope) string {
+		return env.GetInstanceId()
+	},
+	"source_id": func(env *loggregator_v2.Envelope) string {
+		return env.GetSourceId()
+	},
+}
+
+// Valid reports whether all braces of f enclose known placeholders.
+func (f FieldFormat) Valid() bool {
+	_, ok := f.expand(&loggregator_v2.Envelope{})
+	return ok
+}
+
+// Expand returns the field for the envelope.
+func (f FieldFormat) Expand(env *loggregator_v2.Envelope) string {
+	s, _ := f.expand(env)
+	return findInvalidCharactersProcID.ReplaceAllString(findSpaces.ReplaceAllString(s, "-"), "")
+}
+
+func (f FieldFormat) expand(env *loggregator_v2.Envelope) (string, bool) {
+	var b strings.Builder
+	rest := string(f)
+	for {
+		before, after, found := strings.Cut(rest, "{")
+		b.WriteString(before)
+		if !found {
+			return b.String(), !strings.Contains(before, "}")
+		}
+		name, after, found := strings.Cut(after, "}")
+		value, ok := fieldFormatPlaceholders[name]
+		if !found || !ok {
+			return b.String(), false
+		}
+		b.WriteString(value(env))
+		rest = after
+	}
+}
@@ -0,0 +1,183 @@
+package syslog
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metrics "code.cloudfoundry.org/go-metric-registry"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// DefaultFileDrainDir is the directory file drains must write to unless
+// configured otherwise with WithFileDrainDir.
+const DefaultFileDrainDir = "/var/vcap/sys/log"
+
+const (
+	defaultFileMaxSize  = 100 * 1024 * 1024
+	defaultFileMaxAge   = 24 * time.Hour
+	defaultFileMaxFiles = 5
+)
+
+// FileWriter writes envelopes as JSON Lines to a file. Envelopes are
+// written in their protobuf JSON mapping, or in the json drain format if
+// the drain has format=json. The file is rotated
+// when it exceeds the max-size (bytes) or max-age (duration) URL query
+// parameters. Rotated files are renamed to <path>.1, <path>.2, ... and at
+// most max-files of them are kept.
+type FileWriter struct {
+	path         string
+	maxSize      int64
+	maxAge       time.Duration
+	maxFiles     int
+	marshal      func(*loggregator_v2.Envelope) ([]byte, error)
+	egressMetric metrics.Counter
+
+	mu       sync.Mutex
+	f        *os.File
+	size     int64
+	openedAt time.Time
+}
+
+// NewFileWriter creates a FileWriter for a file:// drain URL. The file must
+// be located in dir.
+func NewFileWriter(binding *URLBinding, dir string, egressMetric metrics.Counter) (*FileWriter, error) {
+	path := filepath.Clean(binding.URL.Path)
+	if !strings.HasPrefix(path, filepath.Clean(dir)+string(filepath.Separator)) {
+		return nil, NewWriterFactoryErrorf(binding.URL, "file drains must be located in %s", dir)
+	}
+
+	w := &FileWriter{
+		path:         path,
+		maxSize:      defaultFileMaxSize,
+		maxAge:       defaultFileMaxAge,
+		maxFiles:     defaultFileMaxFiles,
+		marshal:      marshalProtoJSON,
+		egressMetric: egressMetric,
+	}
+	if binding.Format == FormatJSON {
+		w.marshal = MarshalJSONEnvelope
+	}
+
+	q := binding.URL.Query()
+	if v := q.Get("max-size"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			return nil, NewWriterFactoryErrorf(binding.URL, "invalid max-size: %q", v)
+		}
+		w.maxSize = n
+	}
+	if v := q.Get("max-age"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, NewWriterFactoryErrorf(binding.URL, "invalid max-age: %q", v)
+		}
+		w.maxAge = d
+	}
+	if v := q.Get("max-files"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, NewWriterFactoryErrorf(binding.URL, "invalid max-files: %q", v)
+		}
+		w.maxFiles = n
+	}
+
+	return w, nil
+}
+
+// Write appends the envelope to the file as a single line of JSON.
+func (w *FileWriter) Write(_ context.Context, env *loggregator_v2.Envelope) error {
+	line, err := w.marshal(env)
+	if err != nil || line == nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.f != nil && (w.size+int64(len(line)) > w.maxSize || time.Since(w.openedAt) > w.maxAge) {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+	if w.f == nil {
+		if err := w.open(); err != nil {
+			return err
+		}
+	}
+
+	n, err := w.f.Write(line)
+	w.size += int64(n)
+	if err != nil {
+		return err
+	}
+
+	w.egressMetric.Add(1)
+	return nil
+}
+
+// Close closes the file.
+func (w *FileWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.f == nil {
+		return nil
+	}
+	err := w.f.Close()
+	w.f = nil
+	return err
+}
+
+func marshalProtoJSON(env *loggregator_v2.Envelope) ([]byte, error) {
+	return protojson.Marshal(env)
+}
+
+func (w *FileWriter) open() error {
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0640)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	w.f = f
+	w.size = info.Size()
+	w.openedAt = time.Now()
+	return nil
+}
+
+// rotate closes the file and shifts it and the previously rotated files by
+// one, removing the oldest.
+func (w *FileWriter) rotate() error {
+	if err := w.f.Close(); err != nil {
+		return err
+	}
+	w.f = nil
+
+	if w.maxFiles == 0 {
+		return os.Remove(w.path)
+	}
+
+	for i := w.maxFiles - 1; i > 0; i-- {
+		err := os.Rename(w.rotatedPath(i), w.rotatedPath(i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(w.path, w.rotatedPath(1))
+}
+
+func (w *FileWriter) rotatedPath(i int) string {
+	return fmt.Sprintf("%s.%d", w.path, i)
+}
@@ -0,0 +1,167 @@
+package syslog_test
+
+import (
+	"bufio"
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
+)
+
+var _ = Describe("FileWriter", func() {
+	var (
+		dir           string
+		egressCounter *metricsHelpers.SpyMetric
+	)
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		egressCounter = &metricsHelpers.SpyMetric{}
+	})
+
+	newWriter := func(rawURL string) (*syslog.FileWriter, error) {
+		u, err := url.Parse(rawURL)
+		Expect(err).ToNot(HaveOccurred())
+		return syslog.NewFileWriter(&syslog.URLBinding{URL: u}, dir, egressCounter)
+	}
+
+	readLines := func(path string) []string {
+		f, err := os.Open(path)
+		Expect(err).ToNot(HaveOccurred())
+		defer f.Close()
+
+		var lines []string
+		s := bufio.NewScanner(f)
+		for s.Scan() {
+			lines = append(lines, s.Text())
+		}
+		Expect(s.Err()).ToNot(HaveOccurred())
+		return lines
+	}
+
+	It("writes envelopes as JSON lines", func() {
+		path := filepath.Join(dir, "drain.jsonl")
+		w, err := newWriter("file://" + path)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(w.Write(context.Background(), buildLogEnvelope("APP", "1", "message 1", loggregator_v2.Log_OUT))).To(Succeed())
+		Expect(w.Write(context.Background(), buildGaugeEnvelope("2"))).To(Succeed())
+		Expect(w.Close()).To(Succeed())
+
+		lines := readLines(path)
+		Expect(lines).To(HaveLen(2))
+
+		var env loggregator_v2.Envelope
+		Expect(protojson.Unmarshal([]byte(lines[0]), &env)).To(Succeed())
+		Expect(env.GetLog().GetPayload()).To(Equal([]byte("message 1")))
+		Expect(protojson.Unmarshal([]byte(lines[1]), &env)).To(Succeed())
+		Expect(env.GetGauge().GetMetrics()).To(HaveKey("cpu"))
+
+		Expect(egressCounter.Value()).To(BeNumerically("==", 2))
+	})
+
+	It("writes envelopes in the json drain format with format=json", func() {
+		path := filepath.Join(dir, "drain.jsonl")
+		u, err := url.Parse("file://" + path)
+		Expect(err).ToNot(HaveOccurred())
+		w, err := syslog.NewFileWriter(&syslog.URLBinding{URL: u, Format: syslog.FormatJSON}, dir, egressCounter)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(w.Write(context.Background(), buildCounterEnvelope("1"))).To(Succeed())
+		Expect(w.Close()).To(Succeed())
+
+		lines := readLines(path)
+		Expect(lines).To(HaveLen(1))
+		Expect(lines[0]).To(MatchJSON(`{
+			"schema_version": 1,
+			"type": "counter",
+			"timestamp": "1970-01-01T00:00:00.012345678Z",
+			"source_id": "test-app-id",
+			"instance_id": "1",
+			"tags": {},
+			"counter": {"name": "some-counter", "delta": 1, "total": 99}
+		}`))
+	})
+
+	It("appends to an existing file", func() {
+		path := filepath.Join(dir, "drain.jsonl")
+		Expect(os.WriteFile(path, []byte("{}\n"), 0600)).To(Succeed())
+
+		w, err := newWriter("file://" + path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(w.Write(context.Background(), buildLogEnvelope("APP", "1", "message", loggregator_v2.Log_OUT))).To(Succeed())
+		Expect(w.Close()).To(Succeed())
+
+		Expect(readLines(path)).To(HaveLen(2))
+	})
+
+	It("rotates the file when it exceeds max-size", func() {
+		path := filepath.Join(dir, "drain.jsonl")
+		w, err := newWriter("file://" + path + "?max-size=1&max-files=2")
+		Expect(err).ToNot(HaveOccurred())
+
+		for _, p := range []string{"1", "2", "3", "4"} {
+			Expect(w.Write(context.Background(), buildLogEnvelope("APP", "1", p, loggregator_v2.Log_OUT))).To(Succeed())
+		}
+		Expect(w.Close()).To(Succeed())
+
+		Expect(readLines(path)).To(HaveLen(1))
+		Expect(readLines(path + ".1")).To(HaveLen(1))
+		Expect(readLines(path + ".2")).To(HaveLen(1))
+		Expect(path + ".3").ToNot(BeAnExistingFile())
+
+		var env loggregator_v2.Envelope
+		Expect(protojson.Unmarshal([]byte(readLines(path)[0]), &env)).To(Succeed())
+		Expect(env.GetLog().GetPayload()).To(Equal([]byte("4")))
+		Expect(protojson.Unmarshal([]byte(readLines(path + ".2")[0]), &env)).To(Succeed())
+		Expect(env.GetLog().GetPayload()).To(Equal([]byte("2")))
+	})
+
+	It("discards rotated files when max-files is 0", func() {
+		path := filepath.Join(dir, "drain.jsonl")
+		w, err := newWriter("file://" + path + "?max-size=1&max-files=0")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(w.Write(context.Background(), buildLogEnvelope("APP", "1", "1", loggregator_v2.Log_OUT))).To(Succeed())
+		Expect(w.Write(context.Background(), buildLogEnvelope("APP", "1", "2", loggregator_v2.Log_OUT))).To(Succeed())
+		Expect(w.Close()).To(Succeed())
+
+		Expect(readLines(path)).To(HaveLen(1))
+		Expect(path + ".1").ToNot(BeAnExistingFile())
+	})
+
+	It("rotates the file when it exceeds max-age", func() {
+		path := filepath.Join(dir, "drain.jsonl")
+		w, err := newWriter("file://" + path + "?max-age=1ns")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(w.Write(context.Background(), buildLogEnvelope("APP", "1", "1", loggregator_v2.Log_OUT))).To(Succeed())
+		Expect(w.Write(context.Background(), buildLogEnvelope("APP", "1", "2", loggregator_v2.Log_OUT))).To(Succeed())
+		Expect(w.Close()).To(Succeed())
+
+		Expect(readLines(path)).To(HaveLen(1))
+		Expect(readLines(path + ".1")).To(HaveLen(1))
+	})
+
+	DescribeTable("Errors",
+		func(rawURL string, expectedErr string) {
+			_, err := newWriter(strings.ReplaceAll(rawURL, "/DIR", dir))
+			Expect(err).To(MatchError(ContainSubstring(expectedErr)))
+		},
+		Entry("outside the drain directory", "file:///etc/drain.jsonl", "file drains must be located in"),
+		Entry("directory traversal", "file:///DIR/../drain.jsonl", "file drains must be located in"),
+		Entry("invalid max-size", "file:///DIR/drain.jsonl?max-size=big", `invalid max-size: "big"`),
+		Entry("invalid max-age", "file:///DIR/drain.jsonl?max-age=0s", `invalid max-age: "0s"`),
+		Entry("invalid max-files", "file:///DIR/drain.jsonl?max-files=-1", `invalid max-files: "-1"`),
+	)
+})
@@ -1,7 +1,12 @@
 package syslog
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
@@ -18,9 +23,23 @@ const (
 	LOGS_AND_METRICS
 )
 
+// DrainExcludeKey is the envelope tag and binding metadata key that
+// excludes envelopes from aggregate drains when set to true. Drains bound
+// to the app itself still receive them.
+const DrainExcludeKey = "drain-exclude"
+
+// ExcludedFromAggregate reports whether the value of a DrainExcludeKey tag
+// or metadata entry excludes envelopes from aggregate drains.
+func ExcludedFromAggregate(value string) bool {
+	excluded, _ := strconv.ParseBool(value)
+	return excluded
+}
+
 type FilteringDrainWriter struct {
-	binding Binding
-	writer  egress.Writer
+	binding        Binding
+	instances      map[string]bool
+	excludeSources map[string]bool
+	writer         egress.Writer
 }
 
 func NewFilteringDrainWriter(binding Binding, writer egress.Writer) (*FilteringDrainWriter, error) {
@@ -28,35 +47,114 @@ func NewFilteringDrainWriter(binding Binding, writer egress.Writer) (*FilteringD
 		return nil, errors.New("invalid binding type")
 	}
 
+	instances, err := parseInstances(binding.Instances)
+	if err != nil {
+		return nil, err
+	}
+
 	return &FilteringDrainWriter{
-		binding: binding,
-		writer:  writer,
+		binding:        binding,
+		instances:      instances,
+		excludeSources: parseSources(binding.ExcludeSources),
+		writer:         writer,
 	}, nil
 }
 
-func (w *FilteringDrainWriter) Write(env *loggregator_v2.Envelope) error {
+// parseSources parses a comma separated list of source types. It returns
+// nil if the list is empty.
+func parseSources(s string) map[string]bool {
+	var sources map[string]bool
+	for _, src := range strings.Split(s, ",") {
+		src = strings.ToUpper(strings.TrimSpace(src))
+		if src == "" {
+			continue
+		}
+		if sources == nil {
+			sources = make(map[string]bool)
+		}
+		sources[src] = true
+	}
+	return sources
+}
+
+// sourceType returns the source type of the envelope without its
+// qualifiers, e.g. APP for APP/PROC/WEB.
+func sourceType(env *loggregator_v2.Envelope) string {
+	st, _, _ := strings.Cut(env.GetTags()["source_type"], "/")
+	return strings.ToUpper(st)
+}
+
+// parseInstances parses a comma separated list of instance indexes. It
+// returns nil if the list is empty.
+func parseInstances(s string) (map[string]bool, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	instances := make(map[string]bool)
+	for _, i := range strings.Split(s, ",") {
+		i = strings.TrimSpace(i)
+		n, err := strconv.Atoi(i)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid instance index: %q", i)
+		}
+		instances[strconv.Itoa(n)] = true
+	}
+	return instances, nil
+}
+
+// Stalled reports whether the wrapped writer has a write in progress for
+// longer than deadline. Writers that do not implement egress.StallReporter
+// never stall.
+func (w *FilteringDrainWriter) Stalled(deadline time.Duration) bool {
+	sr, ok := w.writer.(egress.StallReporter)
+	return ok && sr.Stalled(deadline)
+}
+
+// Pending returns the number of envelopes the wrapped writer has not
+// written yet. Writers that do not implement egress.PendingReporter have
+// no pending envelopes.
+func (w *FilteringDrainWriter) Pending() int {
+	pr, ok := w.writer.(egress.PendingReporter)
+	if !ok {
+		return 0
+	}
+	return pr.Pending()
+}
+
+func (w *FilteringDrainWriter) Write(ctx context.Context, env *loggregator_v2.Envelope) error {
+	if w.binding.AppId == "" && ExcludedFromAggregate(env.GetTags()[DrainExcludeKey]) {
+		return nil
+	}
+	if w.instances != nil && !w.instances[env.GetInstanceId()] {
+		return nil
+	}
+	if w.excludeSources != nil && w.excludeSources[sourceType(env)] {
+		return nil
+	}
+
 	if w.binding.DrainData == ALL {
-		return w.writer.Write(env)
+		return w.writer.Write(ctx, env)
 	}
 
 	if env.GetTimer() != nil {
 		if w.binding.DrainData == TRACES {
-			return w.writer.Write(env)
+			return w.writer.Write(ctx, env)
 		}
 	}
 	if env.GetEvent() != nil {
 		if w.binding.DrainData == LOGS {
-			return w.writer.Write(env)
+			return w.writer.Write(ctx, env)
 		}
 	}
 	if env.GetLog() != nil {
 		if sendsLogs(w.binding.DrainData) {
-			return w.writer.Write(env)
+			return w.writer.Write(ctx, env)
 		}
 	}
 	if env.GetCounter() != nil || env.GetGauge() != nil {
 		if sendsMetrics(w.binding.DrainData) {
-			return w.writer.Write(env)
+			return w.writer.Write(ctx, env)
 		}
 	}
 
@@ -1,6 +1,8 @@
 package syslog_test
 
 import (
+	"context"
+
 	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
 	. "github.com/onsi/ginkgo/v2"
@@ -28,7 +30,7 @@ var _ = Describe("Filtering Drain Writer", func() {
 		}
 		shouldReceive := []bool{logs, metrics, metrics, events, traces}
 		for index := range envs {
-			err = drain.Write(envs[index])
+			err = drain.Write(context.Background(), envs[index])
 			Expect(err).To(BeNil())
 			if shouldReceive[index] {
 				length += 1
@@ -44,6 +46,38 @@ var _ = Describe("Filtering Drain Writer", func() {
 		Entry("metrics and logs", syslog.LOGS_AND_METRICS, true, true, false, false),
 	)
 
+	It("does not write envelopes tagged drain-exclude to aggregate drains", func() {
+		excluded := &loggregator_v2.Envelope{
+			Tags:    map[string]string{syslog.DrainExcludeKey: "true"},
+			Message: &loggregator_v2.Envelope_Log{Log: &loggregator_v2.Log{}},
+		}
+		included := &loggregator_v2.Envelope{
+			Tags:    map[string]string{syslog.DrainExcludeKey: "false"},
+			Message: &loggregator_v2.Envelope_Log{Log: &loggregator_v2.Log{}},
+		}
+
+		aggregateWriter := &fakeWriter{}
+		aggregate, err := syslog.NewFilteringDrainWriter(syslog.Binding{
+			Drain: syslog.Drain{Url: "syslog://drain.url.com"},
+		}, aggregateWriter)
+		Expect(err).ToNot(HaveOccurred())
+
+		appWriter := &fakeWriter{}
+		app, err := syslog.NewFilteringDrainWriter(syslog.Binding{
+			AppId: "app-1",
+			Drain: syslog.Drain{Url: "syslog://drain.url.com"},
+		}, appWriter)
+		Expect(err).ToNot(HaveOccurred())
+
+		for _, env := range []*loggregator_v2.Envelope{excluded, included} {
+			Expect(aggregate.Write(context.Background(), env)).To(Succeed())
+			Expect(app.Write(context.Background(), env)).To(Succeed())
+		}
+
+		Expect(aggregateWriter.received).To(Equal(1))
+		Expect(appWriter.received).To(Equal(2))
+	})
+
 	It("errors on invalid binding type", func() {
 		binding := syslog.Binding{AppId: "app-1", Hostname: "host-1",
 			Drain: syslog.Drain{
@@ -53,13 +87,64 @@ var _ = Describe("Filtering Drain Writer", func() {
 		_, err := syslog.NewFilteringDrainWriter(binding, &fakeWriter{})
 		Expect(err).To(HaveOccurred())
 	})
+
+	It("only writes envelopes from the given instances", func() {
+		binding := syslog.Binding{
+			Drain:     syslog.Drain{Url: "syslog://drain.url.com"},
+			DrainData: syslog.ALL,
+			Instances: "0, 2",
+		}
+		fakeWriter := &fakeWriter{}
+		drainWriter, err := syslog.NewFilteringDrainWriter(binding, fakeWriter)
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, id := range []string{"0", "1", "2", ""} {
+			env := &loggregator_v2.Envelope{
+				InstanceId: id,
+				Message:    &loggregator_v2.Envelope_Log{Log: &loggregator_v2.Log{}},
+			}
+			Expect(drainWriter.Write(context.Background(), env)).To(Succeed())
+		}
+
+		Expect(fakeWriter.received).To(Equal(2))
+	})
+
+	It("does not write envelopes from excluded sources", func() {
+		binding := syslog.Binding{
+			Drain:          syslog.Drain{Url: "syslog://drain.url.com"},
+			DrainData:      syslog.ALL,
+			ExcludeSources: "rtr, STG",
+		}
+		fakeWriter := &fakeWriter{}
+		drainWriter, err := syslog.NewFilteringDrainWriter(binding, fakeWriter)
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, st := range []string{"RTR", "STG", "APP/PROC/WEB", "CELL", ""} {
+			env := &loggregator_v2.Envelope{
+				Tags:    map[string]string{"source_type": st},
+				Message: &loggregator_v2.Envelope_Log{Log: &loggregator_v2.Log{}},
+			}
+			Expect(drainWriter.Write(context.Background(), env)).To(Succeed())
+		}
+
+		Expect(fakeWriter.received).To(Equal(3))
+	})
+
+	It("errors on invalid instances", func() {
+		binding := syslog.Binding{
+			Drain:     syslog.Drain{Url: "syslog://drain.url.com"},
+			Instances: "0,first",
+		}
+		_, err := syslog.NewFilteringDrainWriter(binding, &fakeWriter{})
+		Expect(err).To(MatchError(`invalid instance index: "first"`))
+	})
 })
 
 type fakeWriter struct {
 	received int
 }
 
-func (f *fakeWriter) Write(env *loggregator_v2.Envelope) error {
+func (f *fakeWriter) Write(_ context.Context, env *loggregator_v2.Envelope) error {
 	f.received += 1
 	return nil
 }
@@ -0,0 +1,374 @@
+package syslog
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metrics "code.cloudfoundry.org/go-metric-registry"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
+)
+
+const defaultForwardTag = "cf"
+
+// ForwardWriter sends envelopes to a Fluentd or Fluent Bit aggregator with
+// the Fluentd forward protocol. Each envelope is sent in message mode as a
+// record with the envelope fields. When the drain has a shared key the
+// writer authenticates with the handshake of the protocol and when ack is
+// enabled it waits for the aggregator to acknowledge every message.
+//
+// This writer is not meant to be used from multiple goroutines. The same
+// goroutine that calls `.Write()` should be the one that calls `.Close()`.
+type ForwardWriter struct {
+	addr         string
+	hostname     string
+	tag          string
+	ack          bool
+	sharedKey    string
+	selfHostname string
+	username     string
+	password     string
+	dialFunc     DialFunc
+	writeTimeout time.Duration
+
+	conn   net.Conn
+	reader *bufio.Reader
+
+	egressMetric metrics.Counter
+}
+
+// NewForwardWriter creates a new forward protocol writer. The connection is
+// encrypted if tlsConf is not nil. The tag of the records, ack mode and the
+// shared key are read from the tag, ack and shared-key query parameters of
+// the drain URL and the user info is used for user authentication.
+func NewForwardWriter(
+	binding *URLBinding,
+	netConf NetworkTimeoutConfig,
+	tlsConf *tls.Config,
+	egressMetric metrics.Counter,
+) (egress.WriteCloser, error) {
+	dialer := &net.Dialer{
+		Timeout:   netConf.DialTimeout,
+		KeepAlive: netConf.Keepalive,
+	}
+	df := func(ctx context.Context, addr string) (net.Conn, error) {
+		return dialer.DialContext(ctx, "tcp", addr)
+	}
+	if tlsConf != nil {
+		df = func(ctx context.Context, addr string) (net.Conn, error) {
+			return dialTLS(ctx, dialer, tlsConf, addr, netConf.handshakes)
+		}
+	}
+
+	w := &ForwardWriter{
+		addr:         binding.URL.Host,
+		hostname:     binding.Hostname,
+		tag:          defaultForwardTag,
+		dialFunc:     df,
+		writeTimeout: netConf.WriteTimeout,
+		egressMetric: egressMetric,
+	}
+
+	q := binding.URL.Query()
+	if v := q.Get("tag"); v != "" {
+		w.tag = v
+	}
+	if v := q.Get("ack"); v != "" {
+		ack, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, NewWriterFactoryErrorf(binding.URL, "invalid ack: %q", v)
+		}
+		w.ack = ack
+	}
+
+	w.sharedKey = q.Get("shared-key")
+	if k, ok := binding.Metadata.Get("shared-key"); ok {
+		w.sharedKey = k
+	}
+	if binding.URL.User != nil {
+		if w.sharedKey == "" {
+			return nil, NewWriterFactoryErrorf(binding.URL, "user authentication requires a shared-key")
+		}
+		w.username = binding.URL.User.Username()
+		w.password, _ = binding.URL.User.Password()
+	}
+	w.selfHostname = q.Get("self-hostname")
+	if w.selfHostname == "" {
+		w.selfHostname, _ = os.Hostname()
+	}
+
+	return w, nil
+}
+
+// Write sends the envelope to the aggregator. Envelopes without a message
+// are skipped. Writes are aborted when ctx is done or its deadline is
+// exceeded.
+func (w *ForwardWriter) Write(ctx context.Context, env *loggregator_v2.Envelope) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	record := forwardRecord(env, w.hostname)
+	if record == nil {
+		return nil
+	}
+
+	t := time.Now()
+	if env.GetTimestamp() != 0 {
+		t = time.Unix(0, env.GetTimestamp())
+	}
+	entry := []any{w.tag, t, record}
+	var chunk string
+	if w.ack {
+		chunk = newChunkID()
+		entry = append(entry, map[string]any{"chunk": chunk})
+	}
+
+	var e msgpackEncoder
+	if err := e.encode(entry); err != nil {
+		return err
+	}
+
+	conn, err := w.connection(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Expire the deadline when the context is done to unblock an in-flight
+	// write or a pending ack.
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	err = w.send(ctx, conn, e.buf, chunk)
+	if err != nil {
+		_ = w.Close()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+
+	w.egressMetric.Add(1)
+	return nil
+}
+
+func (w *ForwardWriter) send(ctx context.Context, conn net.Conn, msg []byte, chunk string) error {
+	err := conn.SetDeadline(w.deadline(ctx))
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.Write(msg)
+	if err != nil {
+		return err
+	}
+
+	if chunk == "" {
+		return nil
+	}
+	resp, err := decodeMsgpack(w.reader)
+	if err != nil {
+		return fmt.Errorf("failed to read ack: %w", err)
+	}
+	m, _ := resp.(map[string]any)
+	if ack, _ := m["ack"].(string); ack != chunk {
+		return fmt.Errorf("unexpected ack: %v", resp)
+	}
+	return nil
+}
+
+// deadline returns the write timeout from now or the deadline of the
+// context if it is earlier.
+func (w *ForwardWriter) deadline(ctx context.Context) time.Time {
+	deadline := time.Now().Add(w.writeTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		return d
+	}
+	return deadline
+}
+
+func (w *ForwardWriter) connection(ctx context.Context) (net.Conn, error) {
+	if w.conn != nil {
+		return w.conn, nil
+	}
+
+	conn, err := w.dialFunc(ctx, w.addr)
+	if err != nil {
+		return nil, egress.DialError(err)
+	}
+	w.conn = conn
+	w.reader = bufio.NewReader(conn)
+
+	if w.sharedKey != "" {
+		err = conn.SetDeadline(w.deadline(ctx))
+		if err == nil {
+			err = w.handshake()
+		}
+		if err != nil {
+			_ = w.Close()
+			return nil, err
+		}
+	}
+
+	log.Printf("created conn to forward drain: %s", w.addr)
+
+	return conn, nil
+}
+
+// handshake authenticates the connection with the shared key as described
+// in the forward protocol: the server sends a HELO with a nonce, the client
+// answers with a PING proving that it knows the shared key and the server
+// replies with a PONG proving the same.
+func (w *ForwardWriter) handshake() error {
+	helo, err := w.readHandshakeMessage("HELO", 2)
+	if err != nil {
+		return err
+	}
+	options, _ := helo[1].(map[string]any)
+	nonce, _ := options["nonce"].(string)
+	authSalt, _ := options["auth"].(string)
+
+	salt := newChunkID()
+	passwordDigest := ""
+	if authSalt != "" {
+		passwordDigest = sha512Hex(authSalt, w.username, w.password)
+	}
+
+	var e msgpackEncoder
+	err = e.encode([]any{
+		"PING",
+		w.selfHostname,
+		salt,
+		sha512Hex(salt, w.selfHostname, nonce, w.sharedKey),
+		w.username,
+		passwordDigest,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := w.conn.Write(e.buf); err != nil {
+		return err
+	}
+
+	pong, err := w.readHandshakeMessage("PONG", 5)
+	if err != nil {
+		return err
+	}
+	if ok, _ := pong[1].(bool); !ok {
+		return fmt.Errorf("forward authentication failed: %v", pong[2])
+	}
+	serverHostname, _ := pong[3].(string)
+	if pong[4] != sha512Hex(salt, serverHostname, nonce, w.sharedKey) {
+		return errors.New("forward authentication failed: server shared key mismatch")
+	}
+	return nil
+}
+
+func (w *ForwardWriter) readHandshakeMessage(kind string, n int) ([]any, error) {
+	v, err := decodeMsgpack(w.reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", kind, err)
+	}
+	msg, _ := v.([]any)
+	if len(msg) < n || msg[0] != kind {
+		return nil, fmt.Errorf("expected %s, got: %v", kind, v)
+	}
+	return msg, nil
+}
+
+// Close tears down any active connection to the drain. The next write
+// reconnects.
+func (w *ForwardWriter) Close() error {
+	if w.conn != nil {
+		err := w.conn.Close()
+		w.conn = nil
+		w.reader = nil
+
+		return err
+	}
+
+	return nil
+}
+
+// forwardRecord returns the record of the envelope in the forward drain
+// format or nil for envelopes without a message. Log payloads are in the
+// log field as with the Docker logging driver of Fluentd, other messages
+// are in a field named after their type.
+func forwardRecord(env *loggregator_v2.Envelope, hostname string) map[string]any {
+	tags := env.GetTags()
+	if tags == nil {
+		tags = map[string]string{}
+	}
+	r := map[string]any{
+		"source_id":   env.GetSourceId(),
+		"instance_id": env.GetInstanceId(),
+		"tags":        tags,
+		"host":        hostname,
+	}
+
+	switch m := env.GetMessage().(type) {
+	case *loggregator_v2.Envelope_Log:
+		r["type"] = "log"
+		r["log"] = string(m.Log.GetPayload())
+		r["stream"] = logStream(m.Log.GetType())
+	case *loggregator_v2.Envelope_Counter:
+		r["type"] = "counter"
+		r["counter"] = map[string]any{
+			"name":  m.Counter.GetName(),
+			"delta": m.Counter.GetDelta(),
+			"total": m.Counter.GetTotal(),
+		}
+	case *loggregator_v2.Envelope_Gauge:
+		r["type"] = "gauge"
+		gauge := make(map[string]any, len(m.Gauge.GetMetrics()))
+		for name, v := range m.Gauge.GetMetrics() {
+			gauge[name] = map[string]any{"unit": v.GetUnit(), "value": v.GetValue()}
+		}
+		r["gauge"] = gauge
+	case *loggregator_v2.Envelope_Timer:
+		r["type"] = "timer"
+		r["timer"] = map[string]any{
+			"name":  m.Timer.GetName(),
+			"start": m.Timer.GetStart(),
+			"stop":  m.Timer.GetStop(),
+		}
+	case *loggregator_v2.Envelope_Event:
+		r["type"] = "event"
+		r["event"] = map[string]any{
+			"title": m.Event.GetTitle(),
+			"body":  m.Event.GetBody(),
+		}
+	default:
+		return nil
+	}
+
+	return r
+}
+
+func newChunkID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func sha512Hex(parts ...string) string {
+	h := sha512.New()
+	for _, p := range parts {
+		h.Write([]byte(p))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
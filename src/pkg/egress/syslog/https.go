@@ -1,6 +1,7 @@
 package syslog
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -43,24 +44,32 @@ func NewHTTPSWriter(
 	}
 }
 
-func (w *HTTPSWriter) sendHttpRequest(msg []byte, msgCount float64) error {
+// sendHttpRequest posts msg to the drain. If batchID is not empty it is
+// sent in the BatchIDHeader.
+func (w *HTTPSWriter) sendHttpRequest(ctx context.Context, msg []byte, msgCount float64, batchID string) error {
 	req := fasthttp.AcquireRequest()
 	req.SetRequestURI(w.url.String())
 	req.Header.SetMethod("POST")
 	req.Header.SetContentType("text/plain")
+	if batchID != "" {
+		req.Header.Set(BatchIDHeader, batchID)
+	}
 	req.SetBody(msg)
 
 	resp := fasthttp.AcquireResponse()
 	defer fasthttp.ReleaseRequest(req)
 	defer fasthttp.ReleaseResponse(resp)
 
-	err := w.client.Do(req, resp)
+	err := doRequest(ctx, w.client, req, resp)
 	if err != nil {
-		return w.sanitizeError(w.url, err)
+		return egress.WithCategory(w.sanitizeError(w.url, err), requestErrorCategory(err))
 	}
 
 	if resp.StatusCode() < 200 || resp.StatusCode() > 299 {
-		return fmt.Errorf("syslog Writer: Post responded with %d status code", resp.StatusCode())
+		return egress.WithCategory(
+			fmt.Errorf("syslog Writer: Post responded with %d status code", resp.StatusCode()),
+			egress.StatusCategory(resp.StatusCode()),
+		)
 	}
 
 	w.egressMetric.Add(msgCount)
@@ -68,7 +77,7 @@ func (w *HTTPSWriter) sendHttpRequest(msg []byte, msgCount float64) error {
 	return nil
 }
 
-func (w *HTTPSWriter) Write(env *loggregator_v2.Envelope) error {
+func (w *HTTPSWriter) Write(ctx context.Context, env *loggregator_v2.Envelope) error {
 	msgs, err := w.syslogConverter.ToRFC5424(env, w.hostname)
 	if err != nil {
 		log.Printf("failed to parse syslog, dropping faulty message, err: %s", err)
@@ -76,7 +85,7 @@ func (w *HTTPSWriter) Write(env *loggregator_v2.Envelope) error {
 	}
 
 	for _, msg := range msgs {
-		err = w.sendHttpRequest(msg, 1)
+		err = w.sendHttpRequest(ctx, msg, 1, "")
 		if err != nil {
 			return err
 		}
@@ -104,12 +113,86 @@ func (*HTTPSWriter) Close() error {
 	return nil
 }
 
-func httpClient(_ NetworkTimeoutConfig, tlsConf *tls.Config) *fasthttp.Client {
-	return &fasthttp.Client{
+// doRequest sends the request unless ctx is already done. The request
+// times out at the deadline of ctx if it has one. fasthttp cannot abort a
+// request, so when ctx is cancelled while the request is in flight
+// doRequest returns right away and leaves the request to finish on copies
+// of req and resp within the timeouts of the client. A panic of the
+// request is raised again by doRequest unless it already returned.
+func doRequest(ctx context.Context, client *fasthttp.Client, req *fasthttp.Request, resp *fasthttp.Response) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	do := func(req *fasthttp.Request, resp *fasthttp.Response) error {
+		if deadline, ok := ctx.Deadline(); ok {
+			return client.DoDeadline(req, resp, deadline)
+		}
+		return client.Do(req, resp)
+	}
+	if ctx.Done() == nil {
+		return do(req, resp)
+	}
+
+	inFlightReq := fasthttp.AcquireRequest()
+	inFlightResp := fasthttp.AcquireResponse()
+	req.CopyTo(inFlightReq)
+	release := func() {
+		fasthttp.ReleaseRequest(inFlightReq)
+		fasthttp.ReleaseResponse(inFlightResp)
+	}
+
+	done := make(chan error, 1)
+	var panicked any
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				panicked = r
+				done <- nil
+			}
+		}()
+		done <- do(inFlightReq, inFlightResp)
+	}()
+
+	select {
+	case err := <-done:
+		if panicked != nil {
+			panic(panicked)
+		}
+		inFlightResp.CopyTo(resp)
+		release()
+		return err
+	case <-ctx.Done():
+		go func() {
+			<-done
+			if panicked != nil {
+				log.Printf("recovered from panic of cancelled request: %v", panicked)
+				return
+			}
+			release()
+		}()
+		return ctx.Err()
+	}
+}
+
+// requestErrorCategory returns the category of an error returned by
+// doRequest or nil if it has none.
+func requestErrorCategory(err error) error {
+	if errors.Is(err, fasthttp.ErrDialTimeout) {
+		return egress.ErrDialTimeout
+	}
+	return nil
+}
+
+func httpClient(netConf NetworkTimeoutConfig, tlsConf *tls.Config) *fasthttp.Client {
+	c := &fasthttp.Client{
 		MaxConnsPerHost:     5,
 		MaxIdleConnDuration: 90 * time.Second,
 		TLSConfig:           tlsConf,
 		ReadTimeout:         20 * time.Second,
 		WriteTimeout:        20 * time.Second,
 	}
+	if tlsConf != nil {
+		c.Dial = fasthttpDialTLS(tlsConf, c.WriteTimeout, netConf.handshakes)
+	}
+	return c
 }
@@ -2,23 +2,54 @@ package syslog
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
 	"crypto/tls"
+	"fmt"
 	"log"
-	"sync"
 	"time"
 
 	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
 	metrics "code.cloudfoundry.org/go-metric-registry"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
+	egress_v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
 )
 
+// BatchIDHeader is the header carrying the ID of a batch. Retries of a
+// batch are sent with the same ID so drains that support idempotency can
+// deduplicate them.
+const BatchIDHeader = "Idempotency-Key"
+
+// HTTPSBatchWriter sends RFC 5424 messages to HTTPS drains in batches.
 type HTTPSBatchWriter struct {
 	HTTPSWriter
-	batchSize    int
-	sendInterval time.Duration
-	msgChan      chan []byte
-	quit         chan struct{}
-	wg           sync.WaitGroup
+	*batchSender[[]byte]
+}
+
+// InFlightLimiter caps the number of concurrent requests. A limiter can be
+// shared by the writers of all drains to cap their requests in total.
+type InFlightLimiter struct {
+	slots chan struct{}
+}
+
+// NewInFlightLimiter returns a limiter that allows up to n concurrent
+// requests.
+func NewInFlightLimiter(n int) *InFlightLimiter {
+	return &InFlightLimiter{slots: make(chan struct{}, n)}
+}
+
+// acquire blocks until a request slot is free.
+func (l *InFlightLimiter) acquire() {
+	l.slots <- struct{}{}
+}
+
+func (l *InFlightLimiter) release() {
+	<-l.slots
+}
+
+// InFlight returns the number of requests in flight.
+func (l *InFlightLimiter) InFlight() int {
+	return len(l.slots)
 }
 
 type Option func(*HTTPSBatchWriter)
@@ -35,6 +66,50 @@ func WithSendInterval(interval time.Duration) Option {
 	}
 }
 
+// WithIdleFlush sends a partial batch when no message has been written for
+// the given duration, so messages of low traffic apps are not held back
+// until the next send interval. Zero disables idle flushes.
+func WithIdleFlush(d time.Duration) Option {
+	return func(w *HTTPSBatchWriter) {
+		w.idleFlush = d
+	}
+}
+
+// WithBatchAgeGauge reports the age in seconds of the oldest message
+// waiting to be sent with the gauge.
+func WithBatchAgeGauge(g metrics.Gauge) Option {
+	return func(w *HTTPSBatchWriter) {
+		w.batchAge = g
+	}
+}
+
+// WithBatchRetries sets how often a batch is resent after a failed request
+// before it is dropped.
+func WithBatchRetries(retries int, d RetryDuration) Option {
+	return func(w *HTTPSBatchWriter) {
+		w.retries = retries
+		w.retryDuration = d
+	}
+}
+
+// WithMaxInFlight sets how many batch requests of the drain may be in
+// flight at the same time. Further batches wait until a request completes.
+// With more than 1 request in flight batches may complete, and so arrive at
+// the drain, out of order. Defaults to 1.
+func WithMaxInFlight(n int) Option {
+	return func(w *HTTPSBatchWriter) {
+		w.inFlight = NewInFlightLimiter(n)
+	}
+}
+
+// WithInFlightLimiter additionally limits the batch requests of the drain
+// with a limiter shared with other drains.
+func WithInFlightLimiter(l *InFlightLimiter) Option {
+	return func(w *HTTPSBatchWriter) {
+		w.globalLimiter = l
+	}
+}
+
 func NewHTTPSBatchWriter(
 	binding *URLBinding,
 	netConf NetworkTimeoutConfig,
@@ -55,79 +130,60 @@ func NewHTTPSBatchWriter(
 			egressMetric:    egressMetric,
 			syslogConverter: c,
 		},
-		batchSize:    256 * 1024,        // Default value
-		sendInterval: 1 * time.Second,   // Default value
-		msgChan:      make(chan []byte), // Buffered channel for messages
-		quit:         make(chan struct{}),
 	}
+	writer.batchSender = newBatchSender(
+		binding.Context,
+		binding.URL.Host,
+		256*1024, // Default value
+		func(msg []byte) int { return len(msg) },
+		writer.sendBatch,
+	)
 
 	for _, opt := range options {
 		opt(writer)
 	}
 
-	writer.wg.Add(1)
-	go writer.startSender()
+	writer.start()
 
 	return writer
 }
 
-func (w *HTTPSBatchWriter) Write(env *loggregator_v2.Envelope) error {
+// Write queues the envelope to be sent with the next batch. It blocks
+// until the sender accepts the envelope or ctx is done.
+func (w *HTTPSBatchWriter) Write(ctx context.Context, env *loggregator_v2.Envelope) error {
 	msgs, err := w.syslogConverter.ToRFC5424(env, w.hostname)
 	if err != nil {
 		log.Printf("Failed to parse syslog, dropping message, err: %s", err)
 		return nil
 	}
 
-	for _, msg := range msgs {
-		w.msgChan <- msg
+	for i, msg := range msgs {
+		var envelopeType string
+		if i == len(msgs)-1 {
+			envelopeType = egress_v2.EnvelopeType(env)
+		}
+		if err := w.add(ctx, msg, envelopeType); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-func (w *HTTPSBatchWriter) startSender() {
-	defer w.wg.Done()
-
-	ticker := time.NewTicker(w.sendInterval)
-	defer ticker.Stop()
-
-	var msgBatch bytes.Buffer
-	var msgCount float64
-
-	sendBatch := func() {
-		if msgBatch.Len() > 0 {
-			w.sendHttpRequest(msgBatch.Bytes(), msgCount) // nolint:errcheck
-			msgBatch.Reset()
-			msgCount = 0
-		}
-	}
+func (w *HTTPSBatchWriter) sendBatch(ctx context.Context, msgs [][]byte, batchID string) error {
+	return w.sendHttpRequest(ctx, bytes.Join(msgs, nil), float64(len(msgs)), batchID)
+}
 
-	for {
-		select {
-		case msg := <-w.msgChan:
-			_, err := msgBatch.Write(msg)
-			if err != nil {
-				log.Printf("Failed to write to buffer, dropping buffer of size %d , err: %s", msgBatch.Len(), err)
-				msgBatch.Reset()
-				msgCount = 0
-			} else {
-				msgCount++
-				if msgBatch.Len() >= w.batchSize {
-					sendBatch()
-				}
-			}
-		case <-ticker.C:
-			sendBatch()
-		case <-w.quit:
-			sendBatch()
-			return
-		}
-	}
+// newBatchID returns a random (version 4) UUID.
+func newBatchID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
 }
 
 func (w *HTTPSBatchWriter) Close() error {
-	close(w.quit)
-	w.wg.Wait() // Ensure sender finishes processing before closing
-	close(w.msgChan)
+	w.close()
 	return nil
 }
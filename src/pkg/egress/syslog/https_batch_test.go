@@ -2,10 +2,12 @@ package syslog_test
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"sync/atomic"
 	"time"
 
 	"code.cloudfoundry.org/go-loggregator/v10/rfc5424"
@@ -13,6 +15,7 @@ import (
 	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
+	egress_v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 )
@@ -67,9 +70,9 @@ var _ = Describe("HTTPS_batch", func() {
 
 	It("testing simple appending of one log", func() {
 		env1 := buildLogEnvelope("APP", "1", "message 1", loggregator_v2.Log_OUT)
-		Expect(writer.Write(env1)).To(Succeed())
+		Expect(writer.Write(context.Background(), env1)).To(Succeed())
 		env2 := buildLogEnvelope("APP", "2", "message 2", loggregator_v2.Log_OUT)
-		Expect(writer.Write(env2)).To(Succeed())
+		Expect(writer.Write(context.Background(), env2)).To(Succeed())
 		Eventually(drain.getMessagesSize, sendInterval+waitTime).Should(Equal(2))
 
 		expected := &rfc5424.Message{
@@ -101,7 +104,7 @@ var _ = Describe("HTTPS_batch", func() {
 	It("test batch dispatching with all logs in a given timeframe", func() {
 		env1 := buildLogEnvelope("APP", "1", "short message", loggregator_v2.Log_OUT)
 		for i := 0; i < 5; i++ {
-			Expect(writer.Write(env1)).To(Succeed())
+			Expect(writer.Write(context.Background(), env1)).To(Succeed())
 		}
 		Expect(drain.getMessagesSize()).To(Equal(0))
 		Eventually(drain.getMessagesSize, sendInterval+waitTime).Should(Equal(5))
@@ -110,7 +113,7 @@ var _ = Describe("HTTPS_batch", func() {
 	It("triggers multiple flushes when exceeding the batch", func() {
 		env := buildLogEnvelope("APP", "1", "string to get log to 400 characters:"+stringTo256Chars, loggregator_v2.Log_OUT)
 		for i := 0; i < 15; i++ {
-			Expect(writer.Write(env)).To(Succeed())
+			Expect(writer.Write(context.Background(), env)).To(Succeed())
 		}
 		// This is a less flaky approach to test for batch size triggered sends:
 		// with only Time based sends, it either takes
@@ -125,11 +128,278 @@ var _ = Describe("HTTPS_batch", func() {
 		// it works fine with a ticker based implementation.
 		env1 := buildLogEnvelope("APP", "1", "only a short test message", loggregator_v2.Log_OUT)
 		for i := 0; i < 5; i++ {
-			Expect(writer.Write(env1)).To(Succeed())
+			Expect(writer.Write(context.Background(), env1)).To(Succeed())
 			time.Sleep((sendInterval * 2) + (sendInterval / 5)) // this sleeps at least 2 ticks, to trigger once without events
 		}
 		Eventually(drain.getMessagesSize, sendInterval+waitTime).Should(Equal(5))
 	})
+
+	Describe("partial batches", func() {
+		BeforeEach(func() {
+			writer.Close()
+		})
+
+		It("sends a partial batch when no messages arrive", func() {
+			writer = syslog.NewHTTPSBatchWriter(
+				b,
+				netConf,
+				skipSSLTLSConfig,
+				&metricsHelpers.SpyMetric{},
+				c,
+				syslog.WithSendInterval(time.Hour),
+				syslog.WithIdleFlush(10*time.Millisecond),
+			)
+
+			env := buildLogEnvelope("APP", "1", "message", loggregator_v2.Log_OUT)
+			Expect(writer.Write(context.Background(), env)).To(Succeed())
+			Eventually(drain.getMessagesSize, waitTime).Should(Equal(1))
+		})
+
+		It("reports the age of the oldest unsent message", func() {
+			batchAge := &metricsHelpers.SpyMetric{}
+			writer = syslog.NewHTTPSBatchWriter(
+				b,
+				netConf,
+				skipSSLTLSConfig,
+				&metricsHelpers.SpyMetric{},
+				c,
+				syslog.WithSendInterval(time.Hour),
+				syslog.WithIdleFlush(0),
+				syslog.WithBatchAgeGauge(batchAge),
+			)
+
+			env := buildLogEnvelope("APP", "1", "message", loggregator_v2.Log_OUT)
+			Expect(writer.Write(context.Background(), env)).To(Succeed())
+			time.Sleep(50 * time.Millisecond)
+			Expect(writer.Write(context.Background(), env)).To(Succeed())
+
+			Eventually(batchAge.Value).Should(BeNumerically(">=", 0.05))
+			Expect(drain.getMessagesSize()).To(Equal(0))
+		})
+	})
+
+	Describe("batch IDs", func() {
+		var (
+			ids      chan string
+			statuses chan int
+			server   *httptest.Server
+		)
+
+		BeforeEach(func() {
+			ids = make(chan string, 10)
+			statuses = make(chan int, 10)
+			server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ids <- r.Header.Get(syslog.BatchIDHeader)
+				select {
+				case status := <-statuses:
+					w.WriteHeader(status)
+				default:
+				}
+			}))
+
+			writer.Close()
+			writer = syslog.NewHTTPSBatchWriter(
+				buildURLBinding(server.URL, "test-app-id", "test-hostname"),
+				netConf,
+				skipSSLTLSConfig,
+				&metricsHelpers.SpyMetric{},
+				c,
+				syslog.WithSendInterval(sendInterval),
+				syslog.WithBatchRetries(2, func(int) time.Duration { return time.Millisecond }),
+			)
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("sends a UUID with every batch", func() {
+			env := buildLogEnvelope("APP", "1", "message", loggregator_v2.Log_OUT)
+			Expect(writer.Write(context.Background(), env)).To(Succeed())
+			var first string
+			Eventually(ids, waitTime).Should(Receive(&first))
+			Expect(first).To(MatchRegexp(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`))
+
+			Expect(writer.Write(context.Background(), env)).To(Succeed())
+			var second string
+			Eventually(ids, waitTime).Should(Receive(&second))
+			Expect(second).ToNot(Equal(first))
+		})
+
+		It("resends failed batches with the same ID", func() {
+			statuses <- http.StatusServiceUnavailable
+			statuses <- http.StatusBadGateway
+
+			env := buildLogEnvelope("APP", "1", "message", loggregator_v2.Log_OUT)
+			Expect(writer.Write(context.Background(), env)).To(Succeed())
+
+			var id string
+			Eventually(ids, waitTime).Should(Receive(&id))
+			Eventually(ids, waitTime).Should(Receive(Equal(id)))
+			Eventually(ids, waitTime).Should(Receive(Equal(id)))
+			Consistently(ids, 2*sendInterval).ShouldNot(Receive())
+		})
+
+		It("drops the batch when the retries are exhausted", func() {
+			for i := 0; i < 3; i++ {
+				statuses <- http.StatusServiceUnavailable
+			}
+
+			env := buildLogEnvelope("APP", "1", "message", loggregator_v2.Log_OUT)
+			Expect(writer.Write(context.Background(), env)).To(Succeed())
+
+			Eventually(ids, waitTime).Should(HaveLen(3))
+			Consistently(ids, 2*sendInterval).Should(HaveLen(3))
+		})
+
+		It("counts envelopes as egressed once the drain accepted their batch", func() {
+			spy := metricsHelpers.NewMetricsRegistry()
+			w, err := syslog.NewRetryWriter(
+				buildURLBinding(server.URL, "test-app-id", "test-hostname"),
+				syslog.ExponentialDuration,
+				1,
+				writer,
+				syslog.WithEgressCounter(egress_v2.NewEgressCounter(spy, egress_v2.DestinationHTTPS)),
+			)
+			Expect(err).ToNot(HaveOccurred())
+			egressed := func() float64 {
+				return spy.GetMetric("egress_envelopes", map[string]string{
+					"envelope_type": "log",
+					"destination":   "https",
+				}).Value()
+			}
+
+			for i := 0; i < 3; i++ {
+				statuses <- http.StatusServiceUnavailable
+			}
+			env := buildLogEnvelope("APP", "1", "message", loggregator_v2.Log_OUT)
+			Expect(w.Write(context.Background(), env)).To(Succeed())
+			Eventually(ids, waitTime).Should(HaveLen(3))
+			Consistently(egressed, 2*sendInterval).Should(BeZero())
+
+			Expect(w.Write(context.Background(), env)).To(Succeed())
+			Eventually(egressed, waitTime).Should(Equal(1.0))
+		})
+	})
+
+	Describe("in-flight requests", func() {
+		var (
+			inFlight    atomic.Int64
+			maxInFlight atomic.Int64
+			release     chan struct{}
+			server      *httptest.Server
+		)
+
+		newWriter := func(opts ...syslog.Option) egress.WriteCloser {
+			opts = append([]syslog.Option{
+				syslog.WithBatchSize(1),
+				syslog.WithSendInterval(sendInterval),
+			}, opts...)
+			return syslog.NewHTTPSBatchWriter(
+				buildURLBinding(server.URL, "test-app-id", "test-hostname"),
+				netConf,
+				skipSSLTLSConfig,
+				&metricsHelpers.SpyMetric{},
+				c,
+				opts...,
+			)
+		}
+
+		BeforeEach(func() {
+			inFlight.Store(0)
+			maxInFlight.Store(0)
+			release = make(chan struct{})
+			server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := inFlight.Add(1)
+				defer inFlight.Add(-1)
+				for {
+					m := maxInFlight.Load()
+					if n <= m || maxInFlight.CompareAndSwap(m, n) {
+						break
+					}
+				}
+				<-release
+			}))
+			DeferCleanup(server.Close)
+		})
+
+		AfterEach(func() {
+			close(release)
+		})
+
+		It("sends one batch at a time by default", func() {
+			writer.Close()
+			writer = newWriter()
+
+			env := buildLogEnvelope("APP", "1", "message", loggregator_v2.Log_OUT)
+			for i := 0; i < 2; i++ {
+				Expect(writer.Write(context.Background(), env)).To(Succeed())
+			}
+
+			Eventually(inFlight.Load, waitTime).Should(Equal(int64(1)))
+			Consistently(maxInFlight.Load, 2*sendInterval).Should(Equal(int64(1)))
+		})
+
+		It("queues batches beyond the limit of the drain", func() {
+			writer.Close()
+			writer = newWriter(syslog.WithMaxInFlight(2))
+
+			env := buildLogEnvelope("APP", "1", "message", loggregator_v2.Log_OUT)
+			for i := 0; i < 3; i++ {
+				Expect(writer.Write(context.Background(), env)).To(Succeed())
+			}
+			Eventually(inFlight.Load, waitTime).Should(Equal(int64(2)))
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*sendInterval)
+			defer cancel()
+			Expect(writer.Write(ctx, env)).To(MatchError(context.DeadlineExceeded))
+			Expect(maxInFlight.Load()).To(Equal(int64(2)))
+		})
+
+		It("limits the batches of all drains sharing a limiter", func() {
+			limiter := syslog.NewInFlightLimiter(1)
+			writer.Close()
+			writer = newWriter(syslog.WithMaxInFlight(2), syslog.WithInFlightLimiter(limiter))
+			other := newWriter(syslog.WithMaxInFlight(2), syslog.WithInFlightLimiter(limiter))
+			DeferCleanup(other.Close)
+
+			env := buildLogEnvelope("APP", "1", "message", loggregator_v2.Log_OUT)
+			Expect(writer.Write(context.Background(), env)).To(Succeed())
+			Expect(other.Write(context.Background(), env)).To(Succeed())
+
+			Eventually(inFlight.Load, waitTime).Should(Equal(int64(1)))
+			Consistently(maxInFlight.Load, 2*sendInterval).Should(Equal(int64(1)))
+			Expect(limiter.InFlight()).To(Equal(1))
+		})
+
+		It("cancels the batch in flight when the context of the binding is done", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			binding := buildURLBinding(server.URL, "test-app-id", "test-hostname")
+			binding.Context = ctx
+			w := syslog.NewHTTPSBatchWriter(
+				binding,
+				netConf,
+				skipSSLTLSConfig,
+				&metricsHelpers.SpyMetric{},
+				c,
+				syslog.WithBatchSize(1),
+				syslog.WithSendInterval(sendInterval),
+			)
+
+			env := buildLogEnvelope("APP", "1", "message", loggregator_v2.Log_OUT)
+			Expect(w.Write(context.Background(), env)).To(Succeed())
+			Eventually(inFlight.Load, waitTime).Should(Equal(int64(1)))
+
+			cancel()
+			closed := make(chan struct{})
+			go func() {
+				defer close(closed)
+				w.Close()
+			}()
+			Eventually(closed, waitTime).Should(BeClosed())
+		})
+	})
 })
 
 func newBatchMockDrain(status int) *SpyDrain {
@@ -1,16 +1,19 @@
 package syslog_test
 
 import (
+	"context"
 	"crypto/tls"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"sync"
+	"time"
 
 	"code.cloudfoundry.org/go-loggregator/v10/rfc5424"
 	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
 	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -39,7 +42,7 @@ var _ = Describe("HTTPWriter", func() {
 		)
 
 		env := buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT)
-		Expect(writer.Write(env)).To(HaveOccurred()) //nolint
+		Expect(writer.Write(context.Background(), env)).To(HaveOccurred()) //nolint
 	})
 
 	It("errors when the http POST fails", func() {
@@ -59,7 +62,29 @@ var _ = Describe("HTTPWriter", func() {
 			c,
 		)
 		env := buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT)
-		Expect(writer.Write(env)).To(HaveOccurred())
+		Expect(writer.Write(context.Background(), env)).To(HaveOccurred())
+	})
+
+	It("categorizes rejected POSTs by status code", func() {
+		for status, category := range map[int]error{
+			http.StatusRequestEntityTooLarge: egress.ErrOversizeEnvelope,
+			http.StatusTooManyRequests:       egress.ErrBackpressure,
+		} {
+			drain := newMockDrain(status)
+			b := buildURLBinding(drain.URL, "test-app-id", "test-hostname")
+			writer := syslog.NewHTTPSWriter(
+				b,
+				netConf,
+				skipSSLTLSConfig,
+				&metricsHelpers.SpyMetric{},
+				c,
+			)
+
+			env := buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT)
+			err := writer.Write(context.Background(), env)
+			Expect(err).To(MatchError(category))
+			Expect(err).To(MatchError(ContainSubstring("%d status code", status)))
+		}
 	})
 
 	It("does not leak creds when reporting a POST error", func() {
@@ -78,7 +103,7 @@ var _ = Describe("HTTPWriter", func() {
 		)
 
 		env := buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT)
-		err := writer.Write(env)
+		err := writer.Write(context.Background(), env)
 		Expect(err).To(HaveOccurred())
 
 		Expect(err.Error()).ToNot(ContainSubstring("user"))
@@ -103,7 +128,7 @@ var _ = Describe("HTTPWriter", func() {
 		)
 
 		env1 := buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT)
-		Expect(writer.Write(env1)).To(Succeed())
+		Expect(writer.Write(context.Background(), env1)).To(Succeed())
 
 		Expect(drain.messages).To(HaveLen(1))
 		Expect(drain.headers).To(HaveLen(1))
@@ -128,7 +153,7 @@ var _ = Describe("HTTPWriter", func() {
 		)
 
 		env1 := buildGaugeEnvelope("1")
-		Expect(writer.Write(env1)).To(Succeed())
+		Expect(writer.Write(context.Background(), env1)).To(Succeed())
 
 		Expect(drain.messages).To(HaveLen(5))
 
@@ -177,7 +202,7 @@ var _ = Describe("HTTPWriter", func() {
 		)
 
 		env1 := buildCounterEnvelope("1")
-		Expect(writer.Write(env1)).To(Succeed())
+		Expect(writer.Write(context.Background(), env1)).To(Succeed())
 
 		Expect(drain.messages).To(HaveLen(1))
 
@@ -213,7 +238,7 @@ var _ = Describe("HTTPWriter", func() {
 		)
 
 		env := buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT)
-		err := writer.Write(env)
+		err := writer.Write(context.Background(), env)
 		Expect(err).To(BeNil())
 
 		Expect(sm.Value()).To(BeNumerically("==", 1))
@@ -239,8 +264,35 @@ var _ = Describe("HTTPWriter", func() {
 		counterEnv := buildTimerEnvelope("1")
 		logEnv := buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_OUT)
 
-		Expect(writer.Write(counterEnv)).To(Succeed())
-		Expect(writer.Write(logEnv)).To(Succeed())
+		Expect(writer.Write(context.Background(), counterEnv)).To(Succeed())
+		Expect(writer.Write(context.Background(), logEnv)).To(Succeed())
+	})
+
+	It("returns when the context is cancelled while the request is in flight", func() {
+		release := make(chan struct{})
+		drain := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		}))
+		defer drain.Close()
+		defer close(release)
+
+		writer := syslog.NewHTTPSWriter(
+			buildURLBinding(drain.URL, "test-app-id", "test-hostname"),
+			netConf,
+			skipSSLTLSConfig,
+			&metricsHelpers.SpyMetric{},
+			c,
+		)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		errs := make(chan error, 1)
+		go func() {
+			errs <- writer.Write(ctx, buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT))
+		}()
+		Consistently(errs, 100*time.Millisecond).ShouldNot(Receive())
+
+		cancel()
+		Eventually(errs).Should(Receive(MatchError(context.Canceled)))
 	})
 })
 
@@ -0,0 +1,211 @@
+package syslog
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metrics "code.cloudfoundry.org/go-metric-registry"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
+	egress_v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// JSONSchemaVersion is the version of the schema of the objects written by
+// drains with the json format. It is incremented whenever a field is
+// removed or changes its meaning. Fields may be added without a new
+// version.
+const JSONSchemaVersion = 1
+
+// jsonEnvelope is an envelope in the json drain format. Exactly one of the
+// payload fields is set and its name is the type of the envelope.
+type jsonEnvelope struct {
+	SchemaVersion int               `json:"schema_version"`
+	Type          string            `json:"type"`
+	Timestamp     string            `json:"timestamp"`
+	SourceID      string            `json:"source_id"`
+	InstanceID    string            `json:"instance_id"`
+	Tags          map[string]string `json:"tags"`
+
+	Log     *jsonLog     `json:"log,omitempty"`
+	Counter *jsonCounter `json:"counter,omitempty"`
+	Gauge   *jsonGauge   `json:"gauge,omitempty"`
+	Timer   *jsonTimer   `json:"timer,omitempty"`
+	Event   *jsonEvent   `json:"event,omitempty"`
+}
+
+type jsonLog struct {
+	Payload string `json:"payload"`
+	Type    string `json:"type"`
+}
+
+type jsonCounter struct {
+	Name  string `json:"name"`
+	Delta uint64 `json:"delta"`
+	Total uint64 `json:"total"`
+}
+
+type jsonGauge struct {
+	Metrics map[string]jsonGaugeValue `json:"metrics"`
+}
+
+type jsonGaugeValue struct {
+	Unit  string  `json:"unit"`
+	Value float64 `json:"value"`
+}
+
+type jsonTimer struct {
+	Name  string `json:"name"`
+	Start string `json:"start"`
+	Stop  string `json:"stop"`
+}
+
+type jsonEvent struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+// MarshalJSONEnvelope returns the envelope as a single line JSON object in
+// the json drain format. It returns nil for envelopes without a message.
+func MarshalJSONEnvelope(env *loggregator_v2.Envelope) ([]byte, error) {
+	je := jsonEnvelope{
+		SchemaVersion: JSONSchemaVersion,
+		Timestamp:     jsonTime(env.GetTimestamp()),
+		SourceID:      env.GetSourceId(),
+		InstanceID:    env.GetInstanceId(),
+		Tags:          env.GetTags(),
+	}
+	if je.Tags == nil {
+		je.Tags = map[string]string{}
+	}
+
+	switch m := env.GetMessage().(type) {
+	case *loggregator_v2.Envelope_Log:
+		je.Type = "log"
+		je.Log = &jsonLog{
+			Payload: string(m.Log.GetPayload()),
+			Type:    m.Log.GetType().String(),
+		}
+	case *loggregator_v2.Envelope_Counter:
+		je.Type = "counter"
+		je.Counter = &jsonCounter{
+			Name:  m.Counter.GetName(),
+			Delta: m.Counter.GetDelta(),
+			Total: m.Counter.GetTotal(),
+		}
+	case *loggregator_v2.Envelope_Gauge:
+		je.Type = "gauge"
+		je.Gauge = &jsonGauge{Metrics: make(map[string]jsonGaugeValue, len(m.Gauge.GetMetrics()))}
+		for name, v := range m.Gauge.GetMetrics() {
+			je.Gauge.Metrics[name] = jsonGaugeValue{Unit: v.GetUnit(), Value: v.GetValue()}
+		}
+	case *loggregator_v2.Envelope_Timer:
+		je.Type = "timer"
+		je.Timer = &jsonTimer{
+			Name:  m.Timer.GetName(),
+			Start: jsonTime(m.Timer.GetStart()),
+			Stop:  jsonTime(m.Timer.GetStop()),
+		}
+	case *loggregator_v2.Envelope_Event:
+		je.Type = "event"
+		je.Event = &jsonEvent{
+			Title: m.Event.GetTitle(),
+			Body:  m.Event.GetBody(),
+		}
+	default:
+		return nil, nil
+	}
+
+	return json.Marshal(je)
+}
+
+func jsonTime(ns int64) string {
+	return time.Unix(0, ns).UTC().Format(time.RFC3339Nano)
+}
+
+// JSONWriter sends envelopes to an HTTPS endpoint in batches of newline
+// delimited JSON objects in the json drain format.
+type JSONWriter struct {
+	url           *url.URL
+	authorization string
+	client        *fasthttp.Client
+	egressMetric  metrics.Counter
+	batcher       *batchSender[[]byte]
+}
+
+// NewJSONWriter creates a new JSONWriter. User info on the binding URL is
+// sent as basic auth.
+func NewJSONWriter(
+	binding *URLBinding,
+	netConf NetworkTimeoutConfig,
+	tlsConf *tls.Config,
+	egressMetric metrics.Counter,
+) egress.WriteCloser {
+	var authorization string
+	if binding.URL.User != nil {
+		p, _ := binding.URL.User.Password()
+		creds := binding.URL.User.Username() + ":" + p
+		authorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(creds))
+	}
+
+	w := &JSONWriter{
+		url:           stripQueryParams(binding.URL, "format"),
+		authorization: authorization,
+		client:        httpClient(netConf, tlsConf),
+		egressMetric:  egressMetric,
+	}
+	w.batcher = newBatchSender(binding.Context, w.url.Host, defaultPushBatchSize, countEntry[[]byte], w.send)
+	w.batcher.start()
+
+	return w
+}
+
+// Write queues the envelope to be sent with the next batch. It blocks
+// until the sender accepts the envelope or ctx is done.
+func (w *JSONWriter) Write(ctx context.Context, env *loggregator_v2.Envelope) error {
+	line, err := MarshalJSONEnvelope(env)
+	if err != nil || line == nil {
+		return err
+	}
+
+	return w.batcher.add(ctx, line, egress_v2.EnvelopeType(env))
+}
+
+// countEgress counts the envelopes of the batches the drain accepted with
+// c.
+func (w *JSONWriter) countEgress(c *egress_v2.EgressCounter) bool {
+	return w.batcher.countEgress(c)
+}
+
+func (w *JSONWriter) send(ctx context.Context, lines [][]byte, _ string) error {
+	body := append(bytes.Join(lines, []byte{'\n'}), '\n')
+
+	headers := map[string]string{}
+	if w.authorization != "" {
+		headers["Authorization"] = w.authorization
+	}
+
+	err := sendPushRequest(ctx, w.client, pushRequest{
+		url:         w.url,
+		contentType: "application/x-ndjson",
+		headers:     headers,
+		body:        body,
+	})
+	if err != nil {
+		return err
+	}
+
+	w.egressMetric.Add(float64(len(lines)))
+	return nil
+}
+
+// Close sends any queued envelopes.
+func (w *JSONWriter) Close() error {
+	w.batcher.close()
+	return nil
+}
@@ -0,0 +1,166 @@
+package syslog_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"net/http"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("JSON format", func() {
+	DescribeTable("MarshalJSONEnvelope",
+		func(env *loggregator_v2.Envelope, expected string) {
+			b, err := syslog.MarshalJSONEnvelope(env)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(b).To(MatchJSON(expected))
+			Expect(b).ToNot(ContainSubstring("\n"))
+		},
+		Entry("log",
+			buildLogEnvelope("APP/PROC/WEB", "1", "line 1\nline 2", loggregator_v2.Log_ERR),
+			`{
+				"schema_version": 1,
+				"type": "log",
+				"timestamp": "1970-01-01T00:00:00.012345678Z",
+				"source_id": "test-app-id",
+				"instance_id": "1",
+				"tags": {"source_type": "APP/PROC/WEB"},
+				"log": {"payload": "line 1\nline 2", "type": "ERR"}
+			}`,
+		),
+		Entry("counter",
+			buildCounterEnvelope("1"),
+			`{
+				"schema_version": 1,
+				"type": "counter",
+				"timestamp": "1970-01-01T00:00:00.012345678Z",
+				"source_id": "test-app-id",
+				"instance_id": "1",
+				"tags": {},
+				"counter": {"name": "some-counter", "delta": 1, "total": 99}
+			}`,
+		),
+		Entry("gauge",
+			&loggregator_v2.Envelope{
+				Timestamp: 12345678,
+				SourceId:  "test-app-id",
+				Tags:      map[string]string{"deployment": "cf"},
+				Message: &loggregator_v2.Envelope_Gauge{
+					Gauge: &loggregator_v2.Gauge{
+						Metrics: map[string]*loggregator_v2.GaugeValue{
+							"cpu":    {Unit: "percentage", Value: 0.23},
+							"memory": {Unit: "bytes", Value: 5423},
+						},
+					},
+				},
+			},
+			`{
+				"schema_version": 1,
+				"type": "gauge",
+				"timestamp": "1970-01-01T00:00:00.012345678Z",
+				"source_id": "test-app-id",
+				"instance_id": "",
+				"tags": {"deployment": "cf"},
+				"gauge": {"metrics": {
+					"cpu": {"unit": "percentage", "value": 0.23},
+					"memory": {"unit": "bytes", "value": 5423}
+				}}
+			}`,
+		),
+		Entry("timer",
+			buildTimerEnvelope("1"),
+			`{
+				"schema_version": 1,
+				"type": "timer",
+				"timestamp": "1970-01-01T00:00:00.012345678Z",
+				"source_id": "test-app-id",
+				"instance_id": "1",
+				"tags": {},
+				"timer": {
+					"name": "http",
+					"start": "1970-01-01T00:00:00.00000001Z",
+					"stop": "1970-01-01T00:00:00.00000002Z"
+				}
+			}`,
+		),
+		Entry("event",
+			buildEventEnvelope("1"),
+			`{
+				"schema_version": 1,
+				"type": "event",
+				"timestamp": "1970-01-01T00:00:00.012345678Z",
+				"source_id": "test-app-id",
+				"instance_id": "1",
+				"tags": {},
+				"event": {"title": "event-title", "body": "event-body"}
+			}`,
+		),
+	)
+
+	It("returns nil for envelopes without a message", func() {
+		b, err := syslog.MarshalJSONEnvelope(&loggregator_v2.Envelope{SourceId: "test-app-id"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(b).To(BeNil())
+	})
+
+	Describe("JSONWriter", func() {
+		var (
+			netConf          syslog.NetworkTimeoutConfig
+			skipSSLTLSConfig = &tls.Config{
+				InsecureSkipVerify: true, //nolint:gosec
+			}
+		)
+
+		It("posts envelopes as newline delimited JSON", func() {
+			drain := newSpyPushDrain(http.StatusOK, "")
+			defer drain.Close()
+
+			b := buildURLBinding(
+				withUserInfo(drain.URL, "user", "secret")+"/ingest?format=json&index=cf",
+				"",
+				"test-hostname",
+			)
+			sm := &metricsHelpers.SpyMetric{}
+			writer := syslog.NewJSONWriter(b, netConf, skipSSLTLSConfig, sm)
+
+			Expect(writer.Write(context.Background(), buildLogEnvelope("APP", "1", "first", loggregator_v2.Log_OUT))).To(Succeed())
+			Expect(writer.Write(context.Background(), buildCounterEnvelope("1"))).To(Succeed())
+			Expect(writer.Write(context.Background(), &loggregator_v2.Envelope{})).To(Succeed())
+			Expect(writer.Close()).To(Succeed())
+
+			Expect(drain.requests()).To(HaveLen(1))
+			req := drain.requests()[0]
+			Expect(req.path).To(Equal("/ingest"))
+			Expect(req.query).To(Equal("index=cf"))
+			Expect(req.header.Get("Content-Type")).To(Equal("application/x-ndjson"))
+			Expect(req.header.Get("Authorization")).To(Equal("Basic dXNlcjpzZWNyZXQ="))
+
+			lines := bytes.Split(bytes.TrimSuffix(req.body, []byte("\n")), []byte("\n"))
+			Expect(lines).To(HaveLen(2))
+			Expect(string(lines[0])).To(ContainSubstring(`"type":"log"`))
+			Expect(string(lines[1])).To(ContainSubstring(`"type":"counter"`))
+
+			Expect(sm.Value()).To(BeNumerically("==", 2))
+		})
+
+		It("does not count envelopes of failed requests", func() {
+			drain := newSpyPushDrain(http.StatusInternalServerError, "")
+			defer drain.Close()
+
+			b := buildURLBinding(drain.URL+"?format=json", "", "test-hostname")
+			sm := &metricsHelpers.SpyMetric{}
+			writer := syslog.NewJSONWriter(b, netConf, skipSSLTLSConfig, sm)
+
+			Expect(writer.Write(context.Background(), buildCounterEnvelope("1"))).To(Succeed())
+			Expect(writer.Close()).To(Succeed())
+
+			Expect(drain.requests()).To(HaveLen(1))
+			Expect(sm.Value()).To(BeNumerically("==", 0))
+		})
+	})
+})
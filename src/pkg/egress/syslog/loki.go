@@ -0,0 +1,212 @@
+package syslog
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metrics "code.cloudfoundry.org/go-metric-registry"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
+	egress_v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
+	"github.com/valyala/fasthttp"
+)
+
+var findInvalidCharactersLokiLabel = regexp.MustCompile("[^a-zA-Z0-9_]")
+
+// lokiLabelTags are the envelope tags that become stream labels. Loki
+// performs poorly with many streams, so tags with a high cardinality such
+// as instance IDs or IPs are added to the log line instead.
+var lokiLabelTags = map[string]bool{
+	"app_name":          true,
+	"space_name":        true,
+	"organization_name": true,
+	"source_type":       true,
+	"deployment":        true,
+	"job":               true,
+}
+
+// LokiWriter sends log envelopes to the Loki push API in batches. The
+// source ID and the lokiLabelTags become stream labels and the other tags
+// are appended to the log line as key=value pairs. Envelopes other than
+// logs are ignored.
+type LokiWriter struct {
+	url           *url.URL
+	authorization string
+	client        *fasthttp.Client
+	egressMetric  metrics.Counter
+	batcher       *batchSender[lokiEntry]
+}
+
+type lokiEntry struct {
+	labels    map[string]string
+	timestamp int64
+	line      string
+}
+
+type lokiPush struct {
+	Streams []lokiStream `json:"streams"`
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// NewLokiWriter creates a new LokiWriter. User info on the binding URL is
+// sent as basic auth.
+func NewLokiWriter(
+	binding *URLBinding,
+	netConf NetworkTimeoutConfig,
+	tlsConf *tls.Config,
+	egressMetric metrics.Counter,
+) egress.WriteCloser {
+	var authorization string
+	if binding.URL.User != nil {
+		p, _ := binding.URL.User.Password()
+		creds := binding.URL.User.Username() + ":" + p
+		authorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(creds))
+	}
+
+	w := &LokiWriter{
+		url:           stripQueryParams(binding.URL, "format"),
+		authorization: authorization,
+		client:        httpClient(netConf, tlsConf),
+		egressMetric:  egressMetric,
+	}
+	w.batcher = newBatchSender(binding.Context, w.url.Host, defaultPushBatchSize, countEntry[lokiEntry], w.send)
+	w.batcher.start()
+
+	return w
+}
+
+// Write queues the envelope to be sent with the next batch. It blocks
+// until the sender accepts the envelope or ctx is done.
+func (w *LokiWriter) Write(ctx context.Context, env *loggregator_v2.Envelope) error {
+	if env.GetLog() == nil {
+		return nil
+	}
+
+	labels := map[string]string{"source_id": env.GetSourceId()}
+	var fields []string
+	for k, v := range env.GetTags() {
+		if lokiLabelTags[k] {
+			labels[k] = v
+			continue
+		}
+		fields = append(fields, lokiLabelName(k)+"="+lokiFieldValue(v))
+	}
+	sort.Strings(fields)
+
+	line := string(removeNulls(env.GetLog().GetPayload()))
+	if len(fields) > 0 {
+		line += " " + strings.Join(fields, " ")
+	}
+
+	return w.batcher.add(ctx, lokiEntry{
+		labels:    labels,
+		timestamp: env.GetTimestamp(),
+		line:      line,
+	}, egress_v2.EnvelopeType(env))
+}
+
+// countEgress counts the envelopes of the batches the drain accepted with
+// c.
+func (w *LokiWriter) countEgress(c *egress_v2.EgressCounter) bool {
+	return w.batcher.countEgress(c)
+}
+
+func (w *LokiWriter) send(ctx context.Context, entries []lokiEntry, _ string) error {
+	body, err := json.Marshal(toLokiPush(entries))
+	if err != nil {
+		return err
+	}
+
+	headers := map[string]string{}
+	if w.authorization != "" {
+		headers["Authorization"] = w.authorization
+	}
+
+	err = sendPushRequest(ctx, w.client, pushRequest{
+		url:         w.url,
+		contentType: "application/json",
+		headers:     headers,
+		body:        body,
+	})
+	if err != nil {
+		return err
+	}
+
+	w.egressMetric.Add(float64(len(entries)))
+	return nil
+}
+
+// Close sends any queued entries.
+func (w *LokiWriter) Close() error {
+	w.batcher.close()
+	return nil
+}
+
+// toLokiPush groups entries with identical label sets into streams.
+func toLokiPush(entries []lokiEntry) lokiPush {
+	var push lokiPush
+	streams := make(map[string]int)
+	for _, e := range entries {
+		key := lokiStreamKey(e.labels)
+		i, ok := streams[key]
+		if !ok {
+			i = len(push.Streams)
+			streams[key] = i
+			push.Streams = append(push.Streams, lokiStream{Stream: e.labels})
+		}
+		push.Streams[i].Values = append(
+			push.Streams[i].Values,
+			[2]string{strconv.FormatInt(e.timestamp, 10), e.line},
+		)
+	}
+
+	return push
+}
+
+func lokiStreamKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(labels[k]))
+		b.WriteByte(',')
+	}
+
+	return b.String()
+}
+
+// lokiLabelName replaces characters that are not valid in a Loki label
+// name. Names of key=value pairs in the log line are sanitized the same way.
+func lokiLabelName(name string) string {
+	name = findInvalidCharactersLokiLabel.ReplaceAllString(name, "_")
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
+
+// lokiFieldValue quotes values of key=value pairs in the log line that are
+// empty or contain spaces, quotes or equal signs.
+func lokiFieldValue(v string) string {
+	if v == "" || strings.ContainsAny(v, " \t\"=") {
+		return strconv.Quote(v)
+	}
+	return v
+}
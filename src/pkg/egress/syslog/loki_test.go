@@ -0,0 +1,121 @@
+package syslog_test
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LokiWriter", func() {
+	var (
+		netConf          syslog.NetworkTimeoutConfig
+		skipSSLTLSConfig = &tls.Config{
+			InsecureSkipVerify: true, //nolint:gosec
+		}
+	)
+
+	type lokiPush struct {
+		Streams []struct {
+			Stream map[string]string `json:"stream"`
+			Values [][]string        `json:"values"`
+		} `json:"streams"`
+	}
+
+	It("posts log envelopes grouped into streams by label set", func() {
+		drain := newSpyPushDrain(http.StatusNoContent, "")
+		defer drain.Close()
+
+		b := buildURLBinding(
+			withUserInfo(drain.URL, "tenant", "secret")+"/loki/api/v1/push?format=loki",
+			"test-app-id",
+			"test-hostname",
+		)
+		sm := &metricsHelpers.SpyMetric{}
+		writer := syslog.NewLokiWriter(b, netConf, skipSSLTLSConfig, sm)
+
+		Expect(writer.Write(context.Background(), buildLogEnvelope("APP/PROC/WEB", "1", "first", loggregator_v2.Log_OUT))).To(Succeed())
+		Expect(writer.Write(context.Background(), buildLogEnvelope("APP/PROC/WEB", "2", "second", loggregator_v2.Log_OUT))).To(Succeed())
+		Expect(writer.Write(context.Background(), buildLogEnvelope("STG", "0", "third", loggregator_v2.Log_OUT))).To(Succeed())
+		Expect(writer.Close()).To(Succeed())
+
+		Expect(drain.requests()).To(HaveLen(1))
+		req := drain.requests()[0]
+		Expect(req.path).To(Equal("/loki/api/v1/push"))
+		Expect(req.query).To(BeEmpty())
+		Expect(req.header.Get("Authorization")).To(Equal("Basic dGVuYW50OnNlY3JldA=="))
+		Expect(req.header.Get("Content-Encoding")).To(Equal("gzip"))
+
+		var push lokiPush
+		Expect(json.Unmarshal(req.body, &push)).To(Succeed())
+		Expect(push.Streams).To(HaveLen(2))
+		Expect(push.Streams[0].Stream).To(Equal(map[string]string{
+			"source_type": "APP/PROC/WEB",
+			"source_id":   "test-app-id",
+		}))
+		Expect(push.Streams[0].Values).To(Equal([][]string{
+			{"12345678", "first"},
+			{"12345678", "second"},
+		}))
+		Expect(push.Streams[1].Stream).To(HaveKeyWithValue("source_type", "STG"))
+
+		Expect(sm.Value()).To(BeNumerically("==", 3))
+	})
+
+	It("only uses a fixed set of tags as labels", func() {
+		drain := newSpyPushDrain(http.StatusNoContent, "")
+		defer drain.Close()
+
+		b := buildURLBinding(drain.URL+"?format=loki", "test-app-id", "test-hostname")
+		writer := syslog.NewLokiWriter(b, netConf, skipSSLTLSConfig, &metricsHelpers.SpyMetric{})
+
+		env := buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT)
+		env.Tags["app_name"] = "my-app"
+		env.Tags["app.kubernetes.io/name"] = "my-app"
+		env.Tags["instance_id"] = "3"
+		env.Tags["message"] = "some value"
+		Expect(writer.Write(context.Background(), env)).To(Succeed())
+		Expect(writer.Close()).To(Succeed())
+
+		var push lokiPush
+		Expect(json.Unmarshal(drain.requests()[0].body, &push)).To(Succeed())
+		Expect(push.Streams[0].Stream).To(Equal(map[string]string{
+			"app_name":    "my-app",
+			"source_type": "APP",
+			"source_id":   "test-app-id",
+		}))
+		Expect(push.Streams[0].Values[0][1]).To(Equal(`just a test app_kubernetes_io_name=my-app instance_id=3 message="some value"`))
+		Expect(drain.requests()[0].header.Get("Authorization")).To(BeEmpty())
+	})
+
+	It("resends batches the push API rejects", func() {
+		drain := newSpyPushDrain(http.StatusServiceUnavailable, "")
+		defer drain.Close()
+
+		b := buildURLBinding(drain.URL+"?format=loki", "test-app-id", "test-hostname")
+		writer := syslog.NewLokiWriter(b, netConf, skipSSLTLSConfig, &metricsHelpers.SpyMetric{})
+
+		Expect(writer.Write(context.Background(), buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT))).To(Succeed())
+		Eventually(func() int { return len(drain.requests()) }, 5*time.Second).Should(BeNumerically(">=", 2))
+		Expect(writer.Close()).To(Succeed())
+	})
+
+	It("ignores non-log envelopes", func() {
+		drain := newSpyPushDrain(http.StatusNoContent, "")
+		defer drain.Close()
+
+		b := buildURLBinding(drain.URL+"?format=loki", "test-app-id", "test-hostname")
+		writer := syslog.NewLokiWriter(b, netConf, skipSSLTLSConfig, &metricsHelpers.SpyMetric{})
+
+		Expect(writer.Write(context.Background(), buildCounterEnvelope("1"))).To(Succeed())
+		Expect(writer.Close()).To(Succeed())
+		Expect(drain.requests()).To(BeEmpty())
+	})
+})
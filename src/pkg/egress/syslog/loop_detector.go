@@ -0,0 +1,42 @@
+package syslog
+
+import (
+	"bytes"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metrics "code.cloudfoundry.org/go-metric-registry"
+)
+
+// loopMarker is how the loop structured data element appears in a log
+// payload when a drain sends a syslog message back to the platform.
+var loopMarker = []byte("[" + loopStructuredDataID)
+
+// LoopDetector detects log envelopes that were written to a drain with the
+// loop marker (see WithLoopMarker) and have come back to the agent, e.g.
+// because the drain points at the platform's own log ingress.
+type LoopDetector struct {
+	drop     bool
+	detected metrics.Counter
+}
+
+// NewLoopDetector returns a LoopDetector. If drop is true looped
+// envelopes are dropped rather than only counted.
+func NewLoopDetector(m MetricClient, drop bool) *LoopDetector {
+	return &LoopDetector{
+		drop: drop,
+		detected: m.NewCounter(
+			"loops_detected",
+			"Total number of envelopes received back from a drain that writes into the platform.",
+		),
+	}
+}
+
+// Drop counts the envelope if it carries the loop marker and reports
+// whether it should be dropped.
+func (d *LoopDetector) Drop(env *loggregator_v2.Envelope) bool {
+	if !bytes.Contains(env.GetLog().GetPayload(), loopMarker) {
+		return false
+	}
+	d.detected.Add(1)
+	return d.drop
+}
@@ -0,0 +1,46 @@
+package syslog_test
+
+import (
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LoopDetector", func() {
+	var (
+		spyMetricClient *metricsHelpers.SpyMetricsRegistry
+		looped          *loggregator_v2.Envelope
+	)
+
+	BeforeEach(func() {
+		spyMetricClient = metricsHelpers.NewMetricsRegistry()
+
+		msgs, err := syslog.NewConverter(syslog.WithLoopMarker()).ToRFC5424(
+			buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT),
+			"test-hostname",
+		)
+		Expect(err).ToNot(HaveOccurred())
+		looped = buildLogEnvelope("APP", "0", string(msgs[0]), loggregator_v2.Log_OUT)
+	})
+
+	It("counts envelopes that came back from a drain", func() {
+		d := syslog.NewLoopDetector(spyMetricClient, false)
+
+		Expect(d.Drop(looped)).To(BeFalse())
+		Expect(d.Drop(buildLogEnvelope("APP", "0", "just a test", loggregator_v2.Log_OUT))).To(BeFalse())
+		Expect(d.Drop(buildGaugeEnvelope("1"))).To(BeFalse())
+
+		Expect(spyMetricClient.GetMetric("loops_detected", nil).Value()).To(Equal(1.0))
+	})
+
+	It("drops envelopes that came back from a drain", func() {
+		d := syslog.NewLoopDetector(spyMetricClient, true)
+
+		Expect(d.Drop(looped)).To(BeTrue())
+		Expect(d.Drop(buildLogEnvelope("APP", "0", "just a test", loggregator_v2.Log_OUT))).To(BeFalse())
+		Expect(spyMetricClient.GetMetric("loops_detected", nil).Value()).To(Equal(1.0))
+	})
+})
@@ -0,0 +1,96 @@
+package syslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"text/template"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+)
+
+// MessageTemplates are named Go templates that operators can configure to
+// render log messages for receivers that expect a specific line format.
+// Drains select a template with the template URL parameter.
+type MessageTemplates struct {
+	templates map[string]*template.Template
+}
+
+// NewMessageTemplates parses the given template texts keyed by name.
+func NewMessageTemplates(texts map[string]string) (MessageTemplates, error) {
+	t := MessageTemplates{templates: make(map[string]*template.Template, len(texts))}
+	for name, text := range texts {
+		tmpl, err := template.New(name).Option("missingkey=zero").Parse(text)
+		if err != nil {
+			return MessageTemplates{}, fmt.Errorf("invalid message template %q: %s", name, err)
+		}
+		t.templates[name] = tmpl
+	}
+
+	return t, nil
+}
+
+// UnmarshalEnv implements envstruct.Unmarshaller.
+// Example input:
+// {"plain":"{{.SourceID}}[{{.InstanceID}}]: {{.Payload}}"}
+func (t *MessageTemplates) UnmarshalEnv(v string) error {
+	if v == "" {
+		return nil
+	}
+
+	var texts map[string]string
+	if err := json.Unmarshal([]byte(v), &texts); err != nil {
+		return fmt.Errorf("invalid message templates: %s", err)
+	}
+
+	parsed, err := NewMessageTemplates(texts)
+	if err != nil {
+		return err
+	}
+	*t = parsed
+
+	return nil
+}
+
+// MarshalJSON encodes the template texts keyed by name.
+func (t MessageTemplates) MarshalJSON() ([]byte, error) {
+	texts := make(map[string]string, len(t.templates))
+	for name, tmpl := range t.templates {
+		texts[name] = tmpl.Root.String()
+	}
+	return json.Marshal(texts)
+}
+
+// Get returns the template with the given name.
+func (t MessageTemplates) Get(name string) (*template.Template, bool) {
+	tmpl, ok := t.templates[name]
+	return tmpl, ok
+}
+
+// messageTemplateData is the data available to message templates.
+type messageTemplateData struct {
+	SourceID   string
+	InstanceID string
+	Hostname   string
+	Timestamp  time.Time
+	Tags       map[string]string
+	Payload    string
+}
+
+func renderMessageTemplate(tmpl *template.Template, env *loggregator_v2.Envelope, hostname string) ([]byte, error) {
+	var buf bytes.Buffer
+	err := tmpl.Execute(&buf, messageTemplateData{
+		SourceID:   env.GetSourceId(),
+		InstanceID: env.GetInstanceId(),
+		Hostname:   hostname,
+		Timestamp:  time.Unix(0, env.GetTimestamp()).UTC(),
+		Tags:       env.GetTags(),
+		Payload:    string(removeNulls(env.GetLog().GetPayload())),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return appendNewline(buf.Bytes()), nil
+}
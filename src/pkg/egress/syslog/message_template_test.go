@@ -0,0 +1,91 @@
+package syslog_test
+
+import (
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
+)
+
+var _ = Describe("MessageTemplates", func() {
+	Describe("UnmarshalEnv", func() {
+		It("parses named templates from JSON", func() {
+			var t syslog.MessageTemplates
+			Expect(t.UnmarshalEnv(`{"plain":"{{.SourceID}}: {{.Payload}}"}`)).To(Succeed())
+
+			_, ok := t.Get("plain")
+			Expect(ok).To(BeTrue())
+			_, ok = t.Get("other")
+			Expect(ok).To(BeFalse())
+		})
+
+		It("accepts an empty value", func() {
+			var t syslog.MessageTemplates
+			Expect(t.UnmarshalEnv("")).To(Succeed())
+		})
+
+		It("errors on invalid JSON", func() {
+			var t syslog.MessageTemplates
+			Expect(t.UnmarshalEnv("invalid")).ToNot(Succeed())
+		})
+
+		It("errors on invalid templates", func() {
+			var t syslog.MessageTemplates
+			Expect(t.UnmarshalEnv(`{"broken":"{{.SourceID"}`)).To(MatchError(ContainSubstring(`invalid message template "broken"`)))
+		})
+	})
+
+	It("marshals the template texts as JSON", func() {
+		var t syslog.MessageTemplates
+		Expect(t.UnmarshalEnv(`{"plain":"{{.SourceID}}: {{.Payload}}"}`)).To(Succeed())
+
+		b, err := json.Marshal(t)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(b).To(MatchJSON(`{"plain":"{{.SourceID}}: {{.Payload}}"}`))
+	})
+
+	It("renders log envelopes with the converter", func() {
+		t, err := syslog.NewMessageTemplates(map[string]string{
+			"custom": `{{.Timestamp.Format "2006-01-02T15:04:05Z07:00"}} {{.Hostname}} {{.SourceID}}/{{.InstanceID}} {{index .Tags "source_type"}} {{.Payload}}`,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		tmpl, _ := t.Get("custom")
+		c := syslog.NewConverter(syslog.WithMessageTemplate(tmpl))
+
+		env := buildLogEnvelope("APP/PROC/WEB", "2", "just a test", loggregator_v2.Log_OUT)
+		env.Timestamp = 1e18
+
+		Expect(c.ToRFC5424(env, "test-hostname")).To(Equal([][]byte{
+			[]byte("2001-09-09T01:46:40Z test-hostname test-app-id/2 APP/PROC/WEB just a test\n"),
+		}))
+	})
+
+	It("renders missing tags as empty", func() {
+		t, err := syslog.NewMessageTemplates(map[string]string{
+			"custom": `[{{index .Tags "app_name"}}] {{.Payload}}`,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		tmpl, _ := t.Get("custom")
+		c := syslog.NewConverter(syslog.WithMessageTemplate(tmpl))
+
+		env := buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_OUT)
+
+		Expect(c.ToRFC5424(env, "test-hostname")).To(Equal([][]byte{
+			[]byte("[] just a test\n"),
+		}))
+	})
+
+	It("does not apply to non-log envelopes", func() {
+		t, err := syslog.NewMessageTemplates(map[string]string{"custom": `{{.Payload}}`})
+		Expect(err).ToNot(HaveOccurred())
+		tmpl, _ := t.Get("custom")
+		c := syslog.NewConverter(syslog.WithMessageTemplate(tmpl))
+
+		result, err := c.ToRFC5424(buildCounterEnvelope("1"), "test-hostname")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(result[0])).To(ContainSubstring("counter@47450"))
+	})
+})
@@ -0,0 +1,102 @@
+package syslog
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// PermanentProbeError is returned by probes that cannot succeed without
+// changing the binding, e.g. because of an unsupported protocol or invalid
+// TLS material, so probing the drain again is pointless.
+type PermanentProbeError struct {
+	Err error
+}
+
+func (e PermanentProbeError) Error() string {
+	return e.Err.Error()
+}
+
+func (e PermanentProbeError) Unwrap() error {
+	return e.Err
+}
+
+// Probe checks that the drain of the binding is reachable without creating
+// a writer. Syslog and forward drains are probed with a TCP connect,
+// syslog-tls and forward-tls drains with a TLS handshake and HTTPS drains
+// with a HEAD request where any response counts as reachable. File drains
+// are not probed. Failures that probing again cannot fix are returned as
+// PermanentProbeError.
+func (f WriterFactory) Probe(ctx context.Context, ub *URLBinding) error {
+	// The drain CA of the probe is only recorded while probing.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	probeBinding := *ub
+	probeBinding.Context = ctx
+
+	tlsCfg, err := f.tlsConfig(&probeBinding)
+	if err != nil {
+		return PermanentProbeError{Err: err}
+	}
+
+	dialer := &net.Dialer{Timeout: f.netConf.DialTimeout}
+
+	switch ub.URL.Scheme {
+	case "syslog", "forward":
+		err = closeConn(dialer.DialContext(ctx, "tcp", ub.URL.Host))
+	case "syslog-tls", "forward-tls":
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: tlsCfg}
+		err = closeConn(tlsDialer.DialContext(ctx, "tcp", ub.URL.Host))
+	case "https", "https-batch":
+		err = probeHTTPS(ctx, ub.URL, dialer, tlsCfg)
+	case "file":
+		return nil
+	default:
+		return PermanentProbeError{Err: NewWriterFactoryErrorf(ub.URL, "unsupported protocol: %q", ub.URL.Scheme)}
+	}
+
+	if err != nil {
+		return NewWriterFactoryErrorf(ub.URL, "drain probe failed: %s", err)
+	}
+	return nil
+}
+
+func probeHTTPS(ctx context.Context, u *url.URL, dialer *net.Dialer, tlsCfg *tls.Config) error {
+	probeURL := *u
+	probeURL.Scheme = "https"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, probeURL.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{
+		Timeout: dialer.Timeout,
+		Transport: &http.Transport{
+			DialContext:     dialer.DialContext,
+			TLSClientConfig: tlsCfg,
+		},
+	}
+	defer client.CloseIdleConnections()
+
+	resp, err := client.Do(req)
+	if err != nil {
+		// Do not leak the drain URL, which may contain credentials.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return urlErr.Err
+		}
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func closeConn(conn net.Conn, err error) error {
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
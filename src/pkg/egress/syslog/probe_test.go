@@ -0,0 +1,131 @@
+package syslog_test
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WriterFactory Probe", func() {
+	var f syslog.WriterFactory
+
+	BeforeEach(func() {
+		f = syslog.NewWriterFactory(
+			&tls.Config{InsecureSkipVerify: true}, //nolint:gosec
+			&tls.Config{InsecureSkipVerify: true}, //nolint:gosec
+			syslog.NetworkTimeoutConfig{DialTimeout: time.Second},
+			metricsHelpers.NewMetricsRegistry(),
+		)
+	})
+
+	probe := func(rawURL string) error {
+		u, err := url.Parse(rawURL)
+		Expect(err).ToNot(HaveOccurred())
+		return f.Probe(context.Background(), &syslog.URLBinding{URL: u})
+	}
+
+	closedAddr := func() string {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		addr := l.Addr().String()
+		l.Close()
+		return addr
+	}
+
+	It("connects to syslog drains", func() {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		defer l.Close()
+
+		Expect(probe("syslog://" + l.Addr().String())).To(Succeed())
+	})
+
+	It("returns an error for unreachable syslog drains", func() {
+		err := probe("syslog://" + closedAddr())
+
+		Expect(err).To(MatchError(ContainSubstring("drain probe failed")))
+	})
+
+	It("performs a TLS handshake with syslog-tls drains", func() {
+		server := httptest.NewTLSServer(http.NotFoundHandler())
+		defer server.Close()
+
+		Expect(probe("syslog-tls://" + server.Listener.Addr().String())).To(Succeed())
+	})
+
+	It("returns an error if the TLS handshake fails", func() {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		defer l.Close()
+		go func() {
+			conn, err := l.Accept()
+			if err == nil {
+				conn.Close()
+			}
+		}()
+
+		Expect(probe("syslog-tls://" + l.Addr().String())).ToNot(Succeed())
+	})
+
+	It("sends a HEAD request to HTTPS drains", func() {
+		methods := make(chan string, 1)
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			methods <- r.Method
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}))
+		defer server.Close()
+
+		Expect(probe(strings.Replace(server.URL, "https", "https-batch", 1))).To(Succeed())
+		Expect(methods).To(Receive(Equal(http.MethodHead)))
+	})
+
+	It("does not include the drain credentials in errors", func() {
+		err := probe("https://user:secret@" + closedAddr() + "/?token=secret")
+
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).ToNot(ContainSubstring("secret"))
+	})
+
+	It("does not probe file drains", func() {
+		Expect(probe("file:///tmp/drain.log")).To(Succeed())
+	})
+
+	It("returns a permanent error for unsupported protocols", func() {
+		err := probe("foo://example.com")
+
+		Expect(err).To(MatchError(ContainSubstring("unsupported protocol")))
+		Expect(errors.As(err, &syslog.PermanentProbeError{})).To(BeTrue())
+	})
+
+	It("returns a permanent error for invalid TLS material", func() {
+		u, err := url.Parse("syslog-tls://example.com")
+		Expect(err).ToNot(HaveOccurred())
+
+		err = f.Probe(context.Background(), &syslog.URLBinding{
+			URL:         u,
+			Certificate: []byte("invalid"),
+			PrivateKey:  []byte("invalid"),
+		})
+
+		Expect(err).To(MatchError(ContainSubstring("failed to load certificate")))
+		Expect(errors.As(err, &syslog.PermanentProbeError{})).To(BeTrue())
+	})
+
+	It("returns errors of unreachable drains as temporary", func() {
+		err := probe("syslog://" + closedAddr())
+
+		Expect(errors.As(err, &syslog.PermanentProbeError{})).To(BeFalse())
+	})
+})
@@ -0,0 +1,102 @@
+package syslog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"net/url"
+
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
+	"github.com/valyala/fasthttp"
+)
+
+// defaultPushBatchSize is the number of entries of a batch to a native
+// push API.
+const defaultPushBatchSize = 1000
+
+// countEntry counts every entry of a push batch towards the batch size.
+func countEntry[T any](T) int {
+	return 1
+}
+
+// pushRequest is a gzip compressed POST to a native push API.
+type pushRequest struct {
+	url         *url.URL
+	contentType string
+	headers     map[string]string
+	body        []byte
+}
+
+func sendPushRequest(ctx context.Context, client *fasthttp.Client, r pushRequest) error {
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	if _, err := gz.Write(r.body); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	req := fasthttp.AcquireRequest()
+	req.SetRequestURI(r.url.String())
+	req.Header.SetMethod("POST")
+	req.Header.SetContentType(r.contentType)
+	req.Header.Set("Content-Encoding", "gzip")
+	for k, v := range r.headers {
+		req.Header.Set(k, v)
+	}
+	req.SetBody(compressed.Bytes())
+
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+
+	err := doRequest(ctx, client, req, resp)
+	if err != nil {
+		return egress.WithCategory(err, requestErrorCategory(err))
+	}
+
+	if resp.StatusCode() < 200 || resp.StatusCode() > 299 {
+		return egress.WithCategory(
+			fmt.Errorf("push Writer: Post to %s responded with %d status code", r.url.Host, resp.StatusCode()),
+			egress.StatusCategory(resp.StatusCode()),
+		)
+	}
+
+	return nil
+}
+
+// credentialFromBinding returns the token from the binding metadata, or
+// otherwise the password of the URL user info, or the username if no
+// password is set. Push APIs authenticate with a single token rather than a
+// username and password pair.
+func credentialFromBinding(b *URLBinding) string {
+	if t, ok := b.Metadata.Get("token"); ok {
+		return t
+	}
+	if b.URL.User == nil {
+		return ""
+	}
+	if p, ok := b.URL.User.Password(); ok {
+		return p
+	}
+	return b.URL.User.Username()
+}
+
+// stripQueryParams removes the user info and the given query parameters
+// from a copy of u. It is used to avoid forwarding agent specific drain
+// parameters and credentials to the receiver.
+func stripQueryParams(u *url.URL, params ...string) *url.URL {
+	stripped := *u
+	stripped.Scheme = "https"
+	stripped.User = nil
+
+	q := stripped.Query()
+	for _, p := range params {
+		q.Del(p)
+	}
+	stripped.RawQuery = q.Encode()
+
+	return &stripped
+}
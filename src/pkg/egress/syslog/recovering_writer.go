@@ -0,0 +1,155 @@
+package syslog
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metrics "code.cloudfoundry.org/go-metric-registry"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
+)
+
+// recoveringWriter recovers from panics of the writer of a drain, so that
+// an edge case in one drain's writer cannot crash the agent. The writer is
+// recreated after a panic since its state may be inconsistent.
+type recoveringWriter struct {
+	writer    egress.WriteCloser
+	newWriter func() (egress.WriteCloser, error)
+	drain     string
+	panics    metrics.Counter
+	release   func()
+}
+
+// newRecoveringWriter returns a recoveringWriter that counts panics with
+// panics and calls release when it is closed.
+func newRecoveringWriter(
+	w egress.WriteCloser,
+	newWriter func() (egress.WriteCloser, error),
+	drain string,
+	panics metrics.Counter,
+	release func(),
+) *recoveringWriter {
+	return &recoveringWriter{
+		writer:    w,
+		newWriter: newWriter,
+		drain:     drain,
+		panics:    panics,
+		release:   release,
+	}
+}
+
+// Write writes the envelope to the drain writer and returns an error if it
+// panics. It is not safe to call Write concurrently.
+func (w *recoveringWriter) Write(ctx context.Context, env *loggregator_v2.Envelope) (err error) {
+	if w.writer == nil {
+		w.writer, err = w.newWriter()
+		if err != nil {
+			return err
+		}
+	}
+
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		log.Printf("recovered from panic in writer of drain %s: %v\n%s", w.drain, r, debug.Stack())
+		w.panics.Add(1)
+		w.discardWriter()
+		err = fmt.Errorf("drain writer panicked: %v", r)
+	}()
+
+	return w.writer.Write(ctx, env)
+}
+
+// discardWriter closes the writer that panicked. A panic of Close is
+// ignored.
+func (w *recoveringWriter) discardWriter() {
+	defer func() {
+		_ = recover()
+	}()
+
+	wc := w.writer
+	w.writer = nil
+	_ = wc.Close()
+}
+
+// Close closes the drain writer.
+func (w *recoveringWriter) Close() error {
+	w.release()
+	if w.writer == nil {
+		return nil
+	}
+	return w.writer.Close()
+}
+
+// counterRemover is implemented by metric clients that can remove
+// counters.
+type counterRemover interface {
+	RemoveCounter(c metrics.Counter)
+}
+
+// writerPanicCounters hands out the writer_panics counters of drains. A
+// counter is shared by the writers of all bindings to the drain and
+// removed once the last of them is closed.
+type writerPanicCounters struct {
+	m MetricClient
+
+	mu       sync.Mutex
+	counters map[string]*writerPanicCounter
+}
+
+type writerPanicCounter struct {
+	metrics.Counter
+	writers int
+}
+
+func newWriterPanicCounters(m MetricClient) *writerPanicCounters {
+	return &writerPanicCounters{
+		m:        m,
+		counters: make(map[string]*writerPanicCounter),
+	}
+}
+
+// acquire returns the counter of the drain with the hash and the func to
+// call once the writer that uses it is closed.
+func (c *writerPanicCounters) acquire(drainHash string) (metrics.Counter, func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pc, ok := c.counters[drainHash]
+	if !ok {
+		pc = &writerPanicCounter{
+			Counter: c.m.NewCounter(
+				"writer_panics",
+				"Total number of panics recovered in drain writers.",
+				metrics.WithMetricLabels(map[string]string{"drain_hash": drainHash}),
+			),
+		}
+		c.counters[drainHash] = pc
+	}
+	pc.writers++
+
+	var once sync.Once
+	return pc.Counter, func() {
+		once.Do(func() { c.release(drainHash) })
+	}
+}
+
+func (c *writerPanicCounters) release(drainHash string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pc := c.counters[drainHash]
+	pc.writers--
+	if pc.writers > 0 {
+		return
+	}
+	delete(c.counters, drainHash)
+	if r, ok := c.m.(counterRemover); ok {
+		r.RemoveCounter(pc.Counter)
+	}
+}
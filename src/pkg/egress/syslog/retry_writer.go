@@ -1,12 +1,16 @@
 package syslog
 
 import (
+	"context"
+	"errors"
 	"log"
 	"math"
 	"time"
 
 	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/clock"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
+	egress_v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
 )
 
 // maxRetries for the backoff, results in around an hour of total delay
@@ -21,6 +25,44 @@ type RetryWriter struct {
 	retryDuration RetryDuration
 	maxRetries    int
 	binding       *URLBinding
+	onError       func(error)
+	egressByType  *egress_v2.EgressCounter
+	clock         clock.Clock
+}
+
+// egressCounter is implemented by writers that queue envelopes and count
+// them once the drain accepted them instead of when they are written.
+// countEgress reports whether the writer counts its envelopes with c.
+type egressCounter interface {
+	countEgress(c *egress_v2.EgressCounter) bool
+}
+
+// RetryWriterOption allows a RetryWriter to be customized.
+type RetryWriterOption func(*RetryWriter)
+
+// WithWriteErrorHandler calls f with the error of every failed write
+// attempt, e.g. to count errors by egress.ErrorReason.
+func WithWriteErrorHandler(f func(error)) RetryWriterOption {
+	return func(r *RetryWriter) {
+		r.onError = f
+	}
+}
+
+// WithEgressCounter counts successfully written envelopes with c. Writers
+// that send envelopes in batches count them with c once the drain accepted
+// their batch instead.
+func WithEgressCounter(c *egress_v2.EgressCounter) RetryWriterOption {
+	return func(r *RetryWriter) {
+		r.egressByType = c
+	}
+}
+
+// WithRetryClock sets the clock that a RetryWriter waits on between
+// attempts. It is meant for tests.
+func WithRetryClock(c clock.Clock) RetryWriterOption {
+	return func(r *RetryWriter) {
+		r.clock = c
+	}
 }
 
 func NewRetryWriter(
@@ -28,35 +70,58 @@ func NewRetryWriter(
 	retryDuration RetryDuration,
 	maxRetries int,
 	writer egress.WriteCloser,
+	opts ...RetryWriterOption,
 ) (egress.WriteCloser, error) {
-	return &RetryWriter{
+	r := &RetryWriter{
 		Writer:        writer,
 		retryDuration: retryDuration,
 		maxRetries:    maxRetries,
 		binding:       urlBinding,
-	}, nil
+		onError:       func(error) {},
+		clock:         clock.New(),
+	}
+	for _, o := range opts {
+		o(r)
+	}
+	if ec, ok := writer.(egressCounter); ok && ec.countEgress(r.egressByType) {
+		r.egressByType = nil
+	}
+	return r, nil
 }
 
-// Write will retry writes unitl maxRetries has been reached.
-func (r *RetryWriter) Write(e *loggregator_v2.Envelope) error {
+// Write will retry writes unitl maxRetries has been reached or ctx is done.
+// Writes that fail with egress.ErrOversizeEnvelope are not retried.
+func (r *RetryWriter) Write(ctx context.Context, e *loggregator_v2.Envelope) error {
 	logTemplate := "failed to write to %s, retrying in %s, err: %s"
 
 	var err error
 
 	for i := 0; i < r.maxRetries; i++ {
-		err = r.Writer.Write(e)
+		err = r.Writer.Write(ctx, e)
 		if err == nil {
+			r.egressByType.Add(e)
 			return nil
 		}
+		r.onError(err)
 
-		if egress.ContextDone(r.binding.Context) {
+		if errors.Is(err, egress.ErrOversizeEnvelope) {
+			return err
+		}
+
+		if egress.ContextDone(ctx) || egress.ContextDone(r.binding.Context) {
 			return err
 		}
 
 		sleepDuration := r.retryDuration(i)
 		log.Printf(logTemplate, r.binding.URL.Host, sleepDuration, err)
 
-		time.Sleep(sleepDuration)
+		t := r.clock.NewTimer(sleepDuration)
+		select {
+		case <-t.C():
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		}
 	}
 
 	return err
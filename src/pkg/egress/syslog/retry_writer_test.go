@@ -9,8 +9,11 @@ import (
 
 	"code.cloudfoundry.org/go-loggregator/v10"
 	v2 "code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
+	egress_v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/testhelpers"
 	"golang.org/x/net/context"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -29,7 +32,7 @@ var _ = Describe("Retry Writer", func() {
 			Expect(err).ToNot(HaveOccurred())
 			env := &v2.Envelope{}
 
-			_ = r.Write(env)
+			_ = r.Write(context.Background(), env)
 
 			Expect(writeCloser.writeCalled).To(BeTrue())
 			Expect(writeCloser.writeEnvelope).To(Equal(env))
@@ -47,7 +50,7 @@ var _ = Describe("Retry Writer", func() {
 			r, err := buildRetryWriter(writeCloser, binding, 3, 0)
 			Expect(err).ToNot(HaveOccurred())
 
-			_ = r.Write(&v2.Envelope{})
+			_ = r.Write(context.Background(), &v2.Envelope{})
 
 			Eventually(writeCloser.WriteAttempts).Should(Equal(2))
 		})
@@ -64,11 +67,82 @@ var _ = Describe("Retry Writer", func() {
 			r, err := buildRetryWriter(writeCloser, binding, 2, 0)
 			Expect(err).ToNot(HaveOccurred())
 
-			err = r.Write(&v2.Envelope{})
+			err = r.Write(context.Background(), &v2.Envelope{})
 
 			Expect(err).To(HaveOccurred())
 		})
 
+		It("does not retry oversize envelopes", func() {
+			binding := &syslog.URLBinding{
+				URL:     &url.URL{},
+				Context: context.Background(),
+			}
+			writeCloser := &spyWriteCloser{
+				returnErrCount: 3,
+				writeErr:       egress.WithCategory(errors.New("413"), egress.ErrOversizeEnvelope),
+			}
+			r, err := buildRetryWriter(writeCloser, binding, 3, 0)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = r.Write(context.Background(), &v2.Envelope{})
+
+			Expect(err).To(MatchError(egress.ErrOversizeEnvelope))
+			Expect(writeCloser.WriteAttempts()).To(Equal(1))
+		})
+
+		It("calls the write error handler for every failed attempt", func() {
+			binding := &syslog.URLBinding{
+				URL:     &url.URL{},
+				Context: context.Background(),
+			}
+			writeCloser := &spyWriteCloser{
+				returnErrCount: 2,
+				writeErr:       errors.New("write error"),
+			}
+			var errs []error
+			r, err := syslog.NewRetryWriter(
+				binding,
+				syslog.RetryDuration(buildDelay(0)),
+				3,
+				writeCloser,
+				syslog.WithWriteErrorHandler(func(err error) {
+					errs = append(errs, err)
+				}),
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(r.Write(context.Background(), &v2.Envelope{})).To(Succeed())
+			Expect(errs).To(HaveLen(2))
+		})
+
+		It("counts successfully written envelopes", func() {
+			binding := &syslog.URLBinding{
+				URL:     &url.URL{},
+				Context: context.Background(),
+			}
+			writeCloser := &spyWriteCloser{
+				returnErrCount: 1,
+				writeErr:       errors.New("write error"),
+			}
+			spy := metricsHelpers.NewMetricsRegistry()
+			r, err := syslog.NewRetryWriter(
+				binding,
+				syslog.RetryDuration(buildDelay(0)),
+				3,
+				writeCloser,
+				syslog.WithEgressCounter(egress_v2.NewEgressCounter(spy, egress_v2.DestinationSyslog)),
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(r.Write(context.Background(), &v2.Envelope{
+				Message: &v2.Envelope_Log{Log: &v2.Log{}},
+			})).To(Succeed())
+			Expect(spy.GetMetric("egress_envelopes", map[string]string{
+				"envelope_type": "log",
+				"destination":   "syslog",
+			}).Value()).To(Equal(1.0))
+		})
+
 		It("continues retrying when context is done", func() {
 			ctx, cancel := context.WithCancel(context.Background())
 			binding := &syslog.URLBinding{
@@ -83,11 +157,67 @@ var _ = Describe("Retry Writer", func() {
 			Expect(err).ToNot(HaveOccurred())
 			cancel()
 
-			err = r.Write(&v2.Envelope{})
+			err = r.Write(context.Background(), &v2.Envelope{})
 
 			Expect(err).To(HaveOccurred())
 			Expect(writeCloser.WriteAttempts()).To(Equal(1))
 		})
+
+		It("stops retrying when the write context is done", func() {
+			binding := &syslog.URLBinding{
+				URL:     &url.URL{},
+				Context: context.Background(),
+			}
+			writeCloser := &spyWriteCloser{
+				returnErrCount: 3,
+				writeErr:       errors.New("write error"),
+			}
+			r, err := buildRetryWriter(writeCloser, binding, 3, time.Hour)
+			Expect(err).ToNot(HaveOccurred())
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			errs := make(chan error, 1)
+			go func() {
+				errs <- r.Write(ctx, &v2.Envelope{})
+			}()
+
+			Eventually(errs).Should(Receive(MatchError("write error")))
+			Expect(writeCloser.WriteAttempts()).To(Equal(2))
+		})
+
+		It("waits for the retry duration on its clock", func() {
+			binding := &syslog.URLBinding{
+				URL:     &url.URL{},
+				Context: context.Background(),
+			}
+			writeCloser := &spyWriteCloser{
+				returnErrCount: 1,
+				writeErr:       errors.New("write error"),
+			}
+			clock := testhelpers.NewFakeClock(time.Now())
+			r, err := syslog.NewRetryWriter(
+				binding,
+				func(int) time.Duration { return time.Minute },
+				2,
+				writeCloser,
+				syslog.WithRetryClock(clock),
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			errs := make(chan error, 1)
+			go func() {
+				errs <- r.Write(context.Background(), &v2.Envelope{})
+			}()
+
+			Eventually(clock.Waiters).Should(Equal(1))
+			clock.Advance(59 * time.Second)
+			Consistently(writeCloser.WriteAttempts).Should(Equal(1))
+
+			clock.Advance(time.Second)
+			Eventually(errs).Should(Receive(BeNil()))
+			Expect(writeCloser.WriteAttempts()).To(Equal(2))
+		})
 	})
 
 	Describe("Close()", func() {
@@ -143,7 +273,7 @@ type spyWriteCloser struct {
 	closeCalled bool
 }
 
-func (s *spyWriteCloser) Write(env *v2.Envelope) error {
+func (s *spyWriteCloser) Write(_ context.Context, env *v2.Envelope) error {
 	var err error
 	if s.WriteAttempts() < s.returnErrCount {
 		err = s.writeErr
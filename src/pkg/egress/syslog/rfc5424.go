@@ -1,11 +1,15 @@
 package syslog
 
 import (
+	"bytes"
 	"fmt"
 	"regexp"
 	"sort"
 	"strconv"
+	"strings"
+	"text/template"
 	"time"
+	"unicode/utf8"
 
 	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
 
@@ -32,8 +36,16 @@ const (
 	counterStructuredDataID = "counter@47450"
 	eventStructuredDataID   = "event@47450"
 	tagsStructuredDataID    = "tags@47450"
+	loopStructuredDataID    = "loop@47450"
+	logStructuredDataID     = "log@47450"
 )
 
+// utf8BOM marks the MSG of syslog messages as UTF-8 encoded.
+const utf8BOM = "\xEF\xBB\xBF"
+
+// facilityUser is the syslog facility of all messages.
+const facilityUser = 1
+
 type ConverterOption func(*Converter)
 
 func WithoutSyslogMetadata() ConverterOption {
@@ -42,12 +54,174 @@ func WithoutSyslogMetadata() ConverterOption {
 	}
 }
 
+// WithMessageTemplate renders log envelopes with the given template instead
+// of as RFC 5424 messages. Other envelope types are unaffected.
+func WithMessageTemplate(t *template.Template) ConverterOption {
+	return func(c *Converter) {
+		c.messageTemplate = t
+	}
+}
+
+// WithLoopMarker adds an empty loop@47450 structured data element to log
+// messages. A LoopDetector recognizes envelopes carrying the marker when a
+// drain sends them back to the platform.
+func WithLoopMarker() ConverterOption {
+	return func(c *Converter) {
+		c.loopMarker = true
+	}
+}
+
+// WithStreamStructuredData adds a log@47450 structured data element to log
+// messages whose stream parameter is stdout or stderr, so receivers can
+// tell them apart without relying on the severity.
+func WithStreamStructuredData() ConverterOption {
+	return func(c *Converter) {
+		c.streamSD = true
+	}
+}
+
+// WithSeverityMapping sets the severities of stdout and stderr log
+// messages. Invalid mappings are ignored, see SeverityMapping.Valid.
+func WithSeverityMapping(m SeverityMapping) ConverterOption {
+	return func(c *Converter) {
+		if out, err, ok := m.severities(); ok {
+			c.stdoutSeverity = out
+			c.stderrSeverity = err
+		}
+	}
+}
+
+// WithProcIDFormat composes the PROCID of messages with the given format
+// instead of [SOURCE_TYPE/INSTANCE] for logs and [INSTANCE] for metrics.
+func WithProcIDFormat(f FieldFormat) ConverterOption {
+	return func(c *Converter) {
+		c.procIDFormat = f
+	}
+}
+
+// WithMsgIDFormat composes the MSGID of messages, which is empty by
+// default, with the given format.
+func WithMsgIDFormat(f FieldFormat) ConverterOption {
+	return func(c *Converter) {
+		c.msgIDFormat = f
+	}
+}
+
+// syslogSeverities are the severities of RFC 5424 by name.
+var syslogSeverities = map[string]int{
+	"emerg":   0,
+	"alert":   1,
+	"crit":    2,
+	"err":     3,
+	"warning": 4,
+	"notice":  5,
+	"info":    6,
+	"debug":   7,
+}
+
+// SeverityMapping is the comma separated pair of severities of stdout and
+// stderr log messages, e.g. "info,warning". Severities are named as in RFC
+// 5424: emerg, alert, crit, err, warning, notice, info and debug. The zero
+// value is "info,err".
+type SeverityMapping string
+
+// Valid reports whether m is empty or names two known severities.
+func (m SeverityMapping) Valid() bool {
+	_, _, ok := m.severities()
+	return ok
+}
+
+func (m SeverityMapping) severities() (int, int, bool) {
+	if m == "" {
+		return syslogSeverities["info"], syslogSeverities["err"], true
+	}
+	out, err, found := strings.Cut(string(m), ",")
+	if !found {
+		return 0, 0, false
+	}
+	outSeverity, outOK := syslogSeverities[strings.TrimSpace(out)]
+	errSeverity, errOK := syslogSeverities[strings.TrimSpace(err)]
+	return outSeverity, errSeverity, outOK && errOK
+}
+
+// NewlinePolicy selects how newlines embedded in log payloads are handled
+// when converting them to syslog messages. The zero value passes payloads
+// through unchanged.
+type NewlinePolicy string
+
+const (
+	NewlinePassThrough NewlinePolicy = "pass-through"
+	NewlineSplit       NewlinePolicy = "split"
+	NewlineEscape      NewlinePolicy = "escape"
+)
+
+// Valid reports whether p is a known newline policy.
+func (p NewlinePolicy) Valid() bool {
+	switch p {
+	case "", NewlinePassThrough, NewlineSplit, NewlineEscape:
+		return true
+	default:
+		return false
+	}
+}
+
+// UTF8Mode selects how the encoding of log payloads is declared in syslog
+// messages. The zero value is lenient.
+type UTF8Mode string
+
+const (
+	// UTF8Lenient passes payloads through as raw bytes without a BOM.
+	UTF8Lenient UTF8Mode = "lenient"
+	// UTF8Strict validates payloads and prefixes valid UTF-8 with a BOM as
+	// described in RFC 5424. Invalid payloads are sent as raw bytes without
+	// a BOM, so receivers do not reject them for invalid sequences.
+	UTF8Strict UTF8Mode = "strict"
+)
+
+// Valid reports whether m is a known UTF-8 mode.
+func (m UTF8Mode) Valid() bool {
+	switch m {
+	case "", UTF8Lenient, UTF8Strict:
+		return true
+	default:
+		return false
+	}
+}
+
+// WithUTF8Mode configures how the encoding of log payloads is declared.
+func WithUTF8Mode(m UTF8Mode) ConverterOption {
+	return func(c *Converter) {
+		c.utf8Mode = m
+	}
+}
+
+// WithNewlinePolicy configures how newlines embedded in log payloads are
+// handled. With NewlineSplit every line is sent as a separate message and
+// empty lines are dropped. With NewlineEscape newlines and carriage returns
+// are replaced with \n and \r. A single trailing newline is kept as the
+// message terminator in either case.
+func WithNewlinePolicy(p NewlinePolicy) ConverterOption {
+	return func(c *Converter) {
+		c.newlinePolicy = p
+	}
+}
+
 type Converter struct {
-	omitTags bool
+	omitTags        bool
+	messageTemplate *template.Template
+	newlinePolicy   NewlinePolicy
+	loopMarker      bool
+	streamSD        bool
+	stdoutSeverity  int
+	stderrSeverity  int
+	procIDFormat    FieldFormat
+	msgIDFormat     FieldFormat
+	utf8Mode        UTF8Mode
 }
 
 func NewConverter(opts ...ConverterOption) *Converter {
 	c := &Converter{}
+	c.stdoutSeverity, c.stderrSeverity, _ = SeverityMapping("").severities()
 
 	for _, o := range opts {
 		o(c)
@@ -63,6 +237,10 @@ func (c *Converter) ToRFC5424(env *loggregator_v2.Envelope, defaultHostname stri
 
 	switch env.GetMessage().(type) {
 	case *loggregator_v2.Envelope_Log:
+		if c.messageTemplate != nil {
+			msg, err := renderMessageTemplate(c.messageTemplate, env, hostname)
+			return [][]byte{msg}, err
+		}
 		return c.toRFC5424LogMessage(env, hostname, appID)
 	case *loggregator_v2.Envelope_Gauge:
 		return c.toRFC5424GaugeMessage(env, hostname, appID)
@@ -155,25 +333,76 @@ func (c *Converter) toRFC5424LogMessage(env *loggregator_v2.Envelope, hostname,
 		c.sanitizeProcID(env.Tags["source_type"]),
 		env.InstanceId,
 	))
-	msg := appendNewline(removeNulls(env.GetLog().Payload))
-
+	if c.procIDFormat != "" {
+		pid = c.procIDFormat.Expand(env)
+	}
 	structuredDatas := []rfc5424.StructuredData{}
 	baseSD := c.buildTagsStructuredData(env.GetTags())
 	if baseSD.ID != "" {
 		structuredDatas = append(structuredDatas, baseSD)
 	}
-	message := rfc5424.Message{
-		Priority:       rfc5424.Priority(priority),
-		Timestamp:      ts,
-		Hostname:       hostname,
-		AppName:        appID,
-		ProcessID:      pid,
-		Message:        msg,
-		StructuredData: structuredDatas,
+	if c.streamSD {
+		if stream := logStream(env.GetLog().GetType()); stream != "" {
+			structuredDatas = append(structuredDatas, rfc5424.StructuredData{
+				ID:         logStructuredDataID,
+				Parameters: []rfc5424.SDParam{{Name: "stream", Value: stream}},
+			})
+		}
+	}
+	if c.loopMarker {
+		structuredDatas = append(structuredDatas, rfc5424.StructuredData{ID: loopStructuredDataID})
 	}
-	messageBinary, err := message.MarshalBinary()
 
-	return [][]byte{messageBinary}, err
+	lines := c.payloadLines(removeNulls(env.GetLog().Payload))
+	messages := make([][]byte, 0, len(lines))
+	for _, msg := range lines {
+		if c.utf8Mode == UTF8Strict && utf8.Valid(msg) {
+			msg = append([]byte(utf8BOM), msg...)
+		}
+		message := rfc5424.Message{
+			Priority:       rfc5424.Priority(priority),
+			Timestamp:      ts,
+			Hostname:       hostname,
+			AppName:        appID,
+			ProcessID:      pid,
+			MessageID:      c.msgIDFormat.Expand(env),
+			Message:        msg,
+			StructuredData: structuredDatas,
+		}
+		messageBinary, err := message.MarshalBinary()
+		if err != nil {
+			return messages, err
+		}
+		messages = append(messages, messageBinary)
+	}
+
+	return messages, nil
+}
+
+// payloadLines applies the newline policy to the payload and returns the
+// messages to send, each terminated by a newline.
+func (c *Converter) payloadLines(payload []byte) [][]byte {
+	switch c.newlinePolicy {
+	case NewlineSplit:
+		var lines [][]byte
+		for _, l := range bytes.Split(payload, []byte("\n")) {
+			l = bytes.TrimSuffix(l, []byte("\r"))
+			if len(l) > 0 {
+				lines = append(lines, append(bytes.Clone(l), '\n'))
+			}
+		}
+		if len(lines) == 0 {
+			return [][]byte{appendNewline(nil)}
+		}
+		return lines
+	case NewlineEscape:
+		payload = bytes.TrimSuffix(payload, []byte("\n"))
+		payload = bytes.ReplaceAll(payload, []byte("\r"), []byte(`\r`))
+		payload = bytes.ReplaceAll(payload, []byte("\n"), []byte(`\n`))
+		return [][]byte{appendNewline(payload)}
+	default:
+		return [][]byte{appendNewline(payload)}
+	}
 }
 
 func (c *Converter) buildTagsStructuredData(tags map[string]string) rfc5424.StructuredData {
@@ -206,6 +435,9 @@ func (c *Converter) toRFC5424MetricMessage(env *loggregator_v2.Envelope, hostnam
 	hostname = c.nilify(hostname)
 	appID = c.nilify(appID)
 	pid := "[" + env.InstanceId + "]"
+	if c.procIDFormat != "" {
+		pid = c.procIDFormat.Expand(env)
+	}
 	priority := 14
 	structuredDatas := []rfc5424.StructuredData{structuredData}
 	baseSD := c.buildTagsStructuredData(env.GetTags())
@@ -218,6 +450,7 @@ func (c *Converter) toRFC5424MetricMessage(env *loggregator_v2.Envelope, hostnam
 		Hostname:       hostname,
 		AppName:        appID,
 		ProcessID:      pid,
+		MessageID:      c.msgIDFormat.Expand(env),
 		Message:        []byte(""),
 		StructuredData: structuredDatas, //TODO: Fix this to get both structured datas
 	}
@@ -228,14 +461,27 @@ func (c *Converter) toRFC5424MetricMessage(env *loggregator_v2.Envelope, hostnam
 func (c *Converter) genPriority(logType loggregator_v2.Log_Type) int {
 	switch logType {
 	case loggregator_v2.Log_OUT:
-		return 14
+		return facilityUser*8 + c.stdoutSeverity
 	case loggregator_v2.Log_ERR:
-		return 11
+		return facilityUser*8 + c.stderrSeverity
 	default:
 		return -1
 	}
 }
 
+// logStream returns the name of the stream of a log type or an empty
+// string for unknown types.
+func logStream(t loggregator_v2.Log_Type) string {
+	switch t {
+	case loggregator_v2.Log_OUT:
+		return "stdout"
+	case loggregator_v2.Log_ERR:
+		return "stderr"
+	default:
+		return ""
+	}
+}
+
 func (c *Converter) nilify(x string) string {
 	if x == "" {
 		return "-"
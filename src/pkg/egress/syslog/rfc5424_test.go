@@ -192,6 +192,146 @@ var _ = Describe("RFC5424", func() {
 		expectConversion(receivedMsgs, expectedMsg+"\n")
 	})
 
+	DescribeTable("handles newlines in log payloads", func(policy syslog.NewlinePolicy, payload string, expected []string) {
+		c = syslog.NewConverter(syslog.WithNewlinePolicy(policy))
+		env := buildLogEnvelope("APP", "2", payload, loggregator_v2.Log_OUT)
+
+		result, err := c.ToRFC5424(env, "test-hostname")
+		Expect(err).ToNot(HaveOccurred())
+
+		var msgs []string
+		for _, r := range result {
+			msgs = append(msgs, strings.TrimPrefix(string(r), "<14>1 1970-01-01T00:00:00.012345+00:00 test-hostname test-app-id [APP/2] - [tags@47450 source_type=\"APP\"] "))
+		}
+		Expect(msgs).To(Equal(expected))
+	},
+		Entry("pass-through by default", syslog.NewlinePolicy(""), "line 1\nline 2\n", []string{"line 1\nline 2\n"}),
+		Entry("pass-through", syslog.NewlinePassThrough, "line 1\nline 2", []string{"line 1\nline 2\n"}),
+		Entry("split", syslog.NewlineSplit, "line 1\r\nline 2\n\nline 3\n", []string{"line 1\n", "line 2\n", "line 3\n"}),
+		Entry("split without newlines", syslog.NewlineSplit, "line 1", []string{"line 1\n"}),
+		Entry("split an empty payload", syslog.NewlineSplit, "", []string{"\n"}),
+		Entry("escape", syslog.NewlineEscape, "line 1\r\nline 2\n", []string{`line 1\r\nline 2` + "\n"}),
+	)
+
+	It("validates newline policies", func() {
+		Expect(syslog.NewlinePolicy("").Valid()).To(BeTrue())
+		Expect(syslog.NewlinePassThrough.Valid()).To(BeTrue())
+		Expect(syslog.NewlineSplit.Valid()).To(BeTrue())
+		Expect(syslog.NewlineEscape.Valid()).To(BeTrue())
+		Expect(syslog.NewlinePolicy("join").Valid()).To(BeFalse())
+	})
+
+	It("adds the loop marker to log messages", func() {
+		c = syslog.NewConverter(syslog.WithLoopMarker())
+		env := buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_OUT)
+
+		result, err := c.ToRFC5424(env, "test-hostname")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(result[0])).To(Equal(
+			"<14>1 1970-01-01T00:00:00.012345+00:00 test-hostname test-app-id [APP/2] - [tags@47450 source_type=\"APP\"][loop@47450] just a test\n",
+		))
+	})
+
+	It("adds the stream of log messages as structured data", func() {
+		c = syslog.NewConverter(syslog.WithStreamStructuredData())
+
+		result, err := c.ToRFC5424(buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_ERR), "test-hostname")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(result[0])).To(Equal(
+			"<11>1 1970-01-01T00:00:00.012345+00:00 test-hostname test-app-id [APP/2] - [tags@47450 source_type=\"APP\"][log@47450 stream=\"stderr\"] just a test\n",
+		))
+
+		result, err = c.ToRFC5424(buildLogEnvelope("APP", "2", "just a test", 20), "test-hostname")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(result[0])).ToNot(ContainSubstring("log@47450"))
+	})
+
+	It("uses the severities of the severity mapping", func() {
+		c = syslog.NewConverter(syslog.WithSeverityMapping("notice,warning"))
+
+		result, err := c.ToRFC5424(buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_OUT), "test-hostname")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(result[0])).To(HavePrefix("<13>1 "))
+
+		result, err = c.ToRFC5424(buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_ERR), "test-hostname")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(result[0])).To(HavePrefix("<12>1 "))
+	})
+
+	It("validates severity mappings", func() {
+		Expect(syslog.SeverityMapping("").Valid()).To(BeTrue())
+		Expect(syslog.SeverityMapping("info,err").Valid()).To(BeTrue())
+		Expect(syslog.SeverityMapping("debug, crit").Valid()).To(BeTrue())
+		Expect(syslog.SeverityMapping("info").Valid()).To(BeFalse())
+		Expect(syslog.SeverityMapping("info,error").Valid()).To(BeFalse())
+	})
+
+	It("composes the PROCID and MSGID with the configured formats", func() {
+		c = syslog.NewConverter(
+			syslog.WithoutSyslogMetadata(),
+			syslog.WithProcIDFormat("{process_type}.{instance}"),
+			syslog.WithMsgIDFormat("{source}"),
+		)
+		env := buildLogEnvelope("APP/PROC/WEB", "2", "just a test", loggregator_v2.Log_OUT)
+
+		result, err := c.ToRFC5424(env, "test-hostname")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(result[0])).To(Equal(
+			"<14>1 1970-01-01T00:00:00.012345+00:00 test-hostname test-app-id WEB.2 APP - just a test\n",
+		))
+	})
+
+	DescribeTable("expands field formats", func(format syslog.FieldFormat, tags map[string]string, expected string) {
+		env := &loggregator_v2.Envelope{SourceId: "some-source-id", InstanceId: "1", Tags: tags}
+		Expect(format.Valid()).To(BeTrue())
+		Expect(format.Expand(env)).To(Equal(expected))
+	},
+		Entry("source type", syslog.FieldFormat("[{source_type}/{instance}]"), map[string]string{"source_type": "APP/PROC/WEB"}, "[APP/PROC/WEB/1]"),
+		Entry("process type tag", syslog.FieldFormat("{process_type}"), map[string]string{"source_type": "APP/PROC/WEB", "process_type": "worker"}, "worker"),
+		Entry("no process type", syslog.FieldFormat("{process_type}"), map[string]string{"source_type": "RTR"}, ""),
+		Entry("source id", syslog.FieldFormat("{source_id}"), nil, "some-source-id"),
+		Entry("whitespace", syslog.FieldFormat("{source} {instance}"), map[string]string{"source_type": "MY TASK"}, "MY-TASK-1"),
+	)
+
+	It("validates field formats", func() {
+		Expect(syslog.FieldFormat("").Valid()).To(BeTrue())
+		Expect(syslog.FieldFormat("{source}-{instance}").Valid()).To(BeTrue())
+		Expect(syslog.FieldFormat("{app_name}").Valid()).To(BeFalse())
+		Expect(syslog.FieldFormat("{source").Valid()).To(BeFalse())
+		Expect(syslog.FieldFormat("source}").Valid()).To(BeFalse())
+	})
+
+	Describe("UTF-8 modes", func() {
+		It("passes payloads through without a BOM by default", func() {
+			result, err := c.ToRFC5424(buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_OUT), "test-hostname")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(result[0])).To(HaveSuffix("] just a test\n"))
+		})
+
+		It("prefixes valid UTF-8 payloads with a BOM in strict mode", func() {
+			c = syslog.NewConverter(syslog.WithUTF8Mode(syslog.UTF8Strict))
+
+			result, err := c.ToRFC5424(buildLogEnvelope("APP", "2", "just a tést", loggregator_v2.Log_OUT), "test-hostname")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(result[0])).To(HaveSuffix("] \xEF\xBB\xBFjust a tést\n"))
+		})
+
+		It("sends invalid UTF-8 payloads without a BOM in strict mode", func() {
+			c = syslog.NewConverter(syslog.WithUTF8Mode(syslog.UTF8Strict))
+
+			result, err := c.ToRFC5424(buildLogEnvelope("APP", "2", "just a \xff test", loggregator_v2.Log_OUT), "test-hostname")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(result[0])).To(HaveSuffix("] just a \xff test\n"))
+		})
+
+		It("validates UTF-8 modes", func() {
+			Expect(syslog.UTF8Mode("").Valid()).To(BeTrue())
+			Expect(syslog.UTF8Lenient.Valid()).To(BeTrue())
+			Expect(syslog.UTF8Strict.Valid()).To(BeTrue())
+			Expect(syslog.UTF8Mode("replace").Valid()).To(BeFalse())
+		})
+	})
+
 	Describe("validation", func() {
 
 		It("returns an error if app name includes unprintable characters", func() {
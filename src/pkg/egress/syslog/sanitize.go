@@ -0,0 +1,123 @@
+package syslog
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"unicode/utf8"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"google.golang.org/protobuf/proto"
+
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
+)
+
+// PayloadSanitization selects how ANSI escape sequences and control
+// characters in log payloads are handled before egress. The zero value
+// leaves payloads unchanged.
+type PayloadSanitization string
+
+const (
+	SanitizeNone   PayloadSanitization = ""
+	SanitizeStrip  PayloadSanitization = "strip"
+	SanitizeEscape PayloadSanitization = "escape"
+)
+
+// Valid reports whether s is a known sanitization mode.
+func (s PayloadSanitization) Valid() bool {
+	switch s {
+	case SanitizeNone, SanitizeStrip, SanitizeEscape:
+		return true
+	default:
+		return false
+	}
+}
+
+// findANSISequences matches CSI (e.g. colors), OSC and two character escape
+// sequences.
+var findANSISequences = regexp.MustCompile(`\x1b(\[[0-?]*[ -/]*[@-~]|\][^\x07\x1b]*(\x07|\x1b\\)|[@-Z\\-_])`)
+
+// SanitizingWriter removes or escapes ANSI escape sequences and control
+// characters in log payloads before writing them to the wrapped writer.
+// Tabs are preserved. Other envelope types are written unchanged.
+type SanitizingWriter struct {
+	mode   PayloadSanitization
+	writer egress.WriteCloser
+}
+
+// NewSanitizingWriter returns a SanitizingWriter for the given mode.
+func NewSanitizingWriter(w egress.WriteCloser, mode PayloadSanitization) *SanitizingWriter {
+	return &SanitizingWriter{
+		mode:   mode,
+		writer: w,
+	}
+}
+
+// Write sanitizes the payload of log envelopes. The envelope is copied
+// before it is modified because it is shared with other drains.
+func (w *SanitizingWriter) Write(ctx context.Context, env *loggregator_v2.Envelope) error {
+	payload := env.GetLog().GetPayload()
+	if w.mode == SanitizeNone || !hasControlCharacters(payload) {
+		return w.writer.Write(ctx, env)
+	}
+
+	sanitized := proto.Clone(env).(*loggregator_v2.Envelope)
+	switch w.mode {
+	case SanitizeStrip:
+		sanitized.GetLog().Payload = stripControlCharacters(payload)
+	case SanitizeEscape:
+		sanitized.GetLog().Payload = escapeControlCharacters(payload)
+	}
+
+	return w.writer.Write(ctx, sanitized)
+}
+
+// Close closes the wrapped writer.
+func (w *SanitizingWriter) Close() error {
+	return w.writer.Close()
+}
+
+func isControl(r rune) bool {
+	return (r < 0x20 && r != '\t') || r == 0x7f || (r >= 0x80 && r <= 0x9f)
+}
+
+func hasControlCharacters(b []byte) bool {
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		if isControl(r) {
+			return true
+		}
+		b = b[size:]
+	}
+	return false
+}
+
+func stripControlCharacters(b []byte) []byte {
+	b = findANSISequences.ReplaceAll(b, nil)
+	return mapControlCharacters(b, func(out []byte, r rune) []byte { return out })
+}
+
+func escapeControlCharacters(b []byte) []byte {
+	return mapControlCharacters(b, func(out []byte, r rune) []byte {
+		if r < 0x80 {
+			return fmt.Appendf(out, `\x%02x`, r)
+		}
+		return fmt.Appendf(out, `\u%04x`, r)
+	})
+}
+
+// mapControlCharacters copies b replacing each control character with the
+// result of f. Invalid UTF-8 is copied unchanged.
+func mapControlCharacters(b []byte, f func(out []byte, r rune) []byte) []byte {
+	out := make([]byte, 0, len(b))
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		if isControl(r) {
+			out = f(out, r)
+		} else {
+			out = append(out, b[:size]...)
+		}
+		b = b[size:]
+	}
+	return out
+}
@@ -0,0 +1,77 @@
+package syslog_test
+
+import (
+	"context"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
+)
+
+var _ = Describe("SanitizingWriter", func() {
+	var spy *spyWriteCloser
+
+	BeforeEach(func() {
+		spy = &spyWriteCloser{}
+	})
+
+	DescribeTable("sanitizes log payloads",
+		func(mode syslog.PayloadSanitization, payload, expected string) {
+			w := syslog.NewSanitizingWriter(spy, mode)
+			env := buildLogEnvelope("APP", "1", payload, loggregator_v2.Log_OUT)
+
+			Expect(w.Write(context.Background(), env)).To(Succeed())
+
+			Expect(spy.writeAttempts).To(BeNumerically("==", 1))
+			Expect(string(spy.writeEnvelope.GetLog().GetPayload())).To(Equal(expected))
+		},
+		Entry("strip leaves clean payloads", syslog.SanitizeStrip, "hello\tworld", "hello\tworld"),
+		Entry("strip removes ANSI colors", syslog.SanitizeStrip, "\x1b[31mred\x1b[0m text", "red text"),
+		Entry("strip removes OSC sequences", syslog.SanitizeStrip, "\x1b]0;title\x07text", "text"),
+		Entry("strip removes control characters", syslog.SanitizeStrip, "line\r\nfake entry\x08\x7f", "linefake entry"),
+		Entry("strip removes C1 control characters", syslog.SanitizeStrip, "a\u0085b", "ab"),
+		Entry("strip keeps unicode", syslog.SanitizeStrip, "héllo ✓", "héllo ✓"),
+		Entry("strip keeps invalid UTF-8", syslog.SanitizeStrip, "a\xffb\n", "a\xffb"),
+		Entry("escape escapes ANSI colors", syslog.SanitizeEscape, "\x1b[31mred", `\x1b[31mred`),
+		Entry("escape escapes control characters", syslog.SanitizeEscape, "line\nfake\tentry", `line\x0afake`+"\tentry"),
+		Entry("escape escapes C1 control characters", syslog.SanitizeEscape, "a\u0085b", `a\u0085b`),
+		Entry("none leaves payloads unchanged", syslog.SanitizeNone, "\x1b[31mred\n", "\x1b[31mred\n"),
+	)
+
+	It("does not modify the original envelope", func() {
+		w := syslog.NewSanitizingWriter(spy, syslog.SanitizeStrip)
+		env := buildLogEnvelope("APP", "1", "\x1b[31mred", loggregator_v2.Log_OUT)
+
+		Expect(w.Write(context.Background(), env)).To(Succeed())
+
+		Expect(string(env.GetLog().GetPayload())).To(Equal("\x1b[31mred"))
+		Expect(string(spy.writeEnvelope.GetLog().GetPayload())).To(Equal("red"))
+	})
+
+	It("writes other envelopes unchanged", func() {
+		w := syslog.NewSanitizingWriter(spy, syslog.SanitizeStrip)
+		env := buildGaugeEnvelope("1")
+
+		Expect(w.Write(context.Background(), env)).To(Succeed())
+
+		Expect(spy.writeEnvelope).To(BeIdenticalTo(env))
+	})
+
+	It("closes the wrapped writer", func() {
+		w := syslog.NewSanitizingWriter(spy, syslog.SanitizeStrip)
+
+		Expect(w.Close()).To(Succeed())
+
+		Expect(spy.closeCalled).To(BeTrue())
+	})
+
+	It("validates modes", func() {
+		Expect(syslog.SanitizeNone.Valid()).To(BeTrue())
+		Expect(syslog.SanitizeStrip.Valid()).To(BeTrue())
+		Expect(syslog.SanitizeEscape.Valid()).To(BeTrue())
+		Expect(syslog.PayloadSanitization("remove").Valid()).To(BeFalse())
+	})
+})
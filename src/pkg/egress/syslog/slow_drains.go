@@ -0,0 +1,235 @@
+package syslog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	metrics "code.cloudfoundry.org/go-metric-registry"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
+)
+
+// SheddingMode selects what happens to the envelopes of a drain that
+// exceeds its latency budget.
+type SheddingMode string
+
+const (
+	// SheddingDrop drops the envelopes of a slow drain. One envelope per
+	// second is still written to detect when the drain recovers.
+	SheddingDrop SheddingMode = "drop"
+	// SheddingSample writes one in every sample rate envelopes of a slow
+	// drain and drops the others.
+	SheddingSample SheddingMode = "sample"
+)
+
+// Valid reports whether m is a known shedding mode.
+func (m SheddingMode) Valid() bool {
+	return m == SheddingDrop || m == SheddingSample
+}
+
+const (
+	// slowWrites is the number of consecutive writes over the latency
+	// budget after which a drain starts shedding, and of consecutive
+	// writes within the budget after which it stops.
+	slowWrites = 10
+	// sheddingProbeInterval is how often an envelope is written to a drain
+	// that drops its envelopes.
+	sheddingProbeInterval = time.Second
+)
+
+// SlowDrain is a drain that sheds its envelopes.
+type SlowDrain struct {
+	Drain     string    `json:"drain"`
+	DrainHash string    `json:"drain_hash"`
+	Since     time.Time `json:"since"`
+}
+
+// SlowDrains detects drains whose writes consistently exceed a latency
+// budget and sheds their envelopes, so that a slow drain does not hold up
+// its diode and the envelopes behind it. A drain starts shedding after
+// 10 consecutive writes over the budget and stops after 10 consecutive
+// writes within it.
+type SlowDrains struct {
+	budget     time.Duration
+	mode       SheddingMode
+	sampleRate int
+	m          MetricClient
+	gauge      metrics.Gauge
+
+	mu       sync.Mutex
+	shedding map[string]*slowDrain
+}
+
+type slowDrain struct {
+	SlowDrain
+	writers int
+}
+
+// NewSlowDrains returns SlowDrains for the latency budget. In
+// SheddingSample mode one in every sampleRate envelopes is written.
+func NewSlowDrains(budget time.Duration, mode SheddingMode, sampleRate int, m MetricClient) (*SlowDrains, error) {
+	if !mode.Valid() {
+		return nil, fmt.Errorf("unsupported shedding mode: %q", mode)
+	}
+	if mode == SheddingSample && sampleRate < 1 {
+		return nil, fmt.Errorf("invalid shedding sample rate: %d", sampleRate)
+	}
+
+	return &SlowDrains{
+		budget:     budget,
+		mode:       mode,
+		sampleRate: sampleRate,
+		m:          m,
+		gauge: m.NewGauge(
+			"shedding_drains",
+			"Current number of drains that shed envelopes because they exceed the latency budget.",
+		),
+		shedding: make(map[string]*slowDrain),
+	}, nil
+}
+
+// Shedding returns the drains that currently shed envelopes.
+func (s *SlowDrains) Shedding() []SlowDrain {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	drains := make([]SlowDrain, 0, len(s.shedding))
+	for _, d := range s.shedding {
+		drains = append(drains, d.SlowDrain)
+	}
+	sort.Slice(drains, func(i, j int) bool {
+		return drains[i].DrainHash < drains[j].DrainHash
+	})
+	return drains
+}
+
+// ServeHTTP serves the drains that currently shed envelopes as JSON.
+func (s *SlowDrains) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(s.Shedding())
+}
+
+func (s *SlowDrains) start(drain, hash string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, ok := s.shedding[hash]
+	if !ok {
+		d = &slowDrain{SlowDrain: SlowDrain{Drain: drain, DrainHash: hash, Since: time.Now()}}
+		s.shedding[hash] = d
+		log.Printf("Drain %s exceeds the latency budget of %s, shedding envelopes", drain, s.budget)
+	}
+	d.writers++
+	s.gauge.Set(float64(len(s.shedding)))
+}
+
+func (s *SlowDrains) stop(hash string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, ok := s.shedding[hash]
+	if !ok {
+		return
+	}
+	d.writers--
+	if d.writers == 0 {
+		delete(s.shedding, hash)
+		log.Printf("Drain %s is within the latency budget of %s again", d.Drain, s.budget)
+	}
+	s.gauge.Set(float64(len(s.shedding)))
+}
+
+func (s *SlowDrains) newWriter(w egress.WriteCloser, drain, hash string) *sheddingWriter {
+	return &sheddingWriter{
+		WriteCloser: w,
+		drains:      s,
+		drain:       drain,
+		hash:        hash,
+		shed: s.m.NewCounter(
+			"shed_envelopes",
+			"Total number of envelopes dropped because the drain exceeds the latency budget.",
+			metrics.WithMetricLabels(map[string]string{"drain_hash": hash}),
+		),
+	}
+}
+
+// sheddingWriter measures the latency of the writes to a drain and sheds
+// its envelopes while it is slow.
+type sheddingWriter struct {
+	egress.WriteCloser
+	drains *SlowDrains
+	drain  string
+	hash   string
+	shed   metrics.Counter
+
+	shedding  bool
+	slow      int
+	fast      int
+	skipped   int
+	lastWrite time.Time
+}
+
+// Write writes the envelope unless the drain sheds it. It is not safe to
+// call Write concurrently.
+func (w *sheddingWriter) Write(ctx context.Context, env *loggregator_v2.Envelope) error {
+	if w.shedding && !w.pass() {
+		w.shed.Add(1)
+		return nil
+	}
+
+	start := time.Now()
+	err := w.WriteCloser.Write(ctx, env)
+	w.lastWrite = time.Now()
+	w.record(w.lastWrite.Sub(start))
+	return err
+}
+
+// pass reports whether a shed envelope is written anyway, either as a
+// sample or to probe the latency of the drain.
+func (w *sheddingWriter) pass() bool {
+	if w.drains.mode == SheddingSample {
+		w.skipped++
+		if w.skipped < w.drains.sampleRate {
+			return false
+		}
+		w.skipped = 0
+		return true
+	}
+	return time.Since(w.lastWrite) >= sheddingProbeInterval
+}
+
+func (w *sheddingWriter) record(latency time.Duration) {
+	if latency > w.drains.budget {
+		w.slow++
+		w.fast = 0
+	} else {
+		w.fast++
+		w.slow = 0
+	}
+
+	switch {
+	case !w.shedding && w.slow >= slowWrites:
+		w.shedding = true
+		w.skipped = 0
+		w.drains.start(w.drain, w.hash)
+	case w.shedding && w.fast >= slowWrites:
+		w.shedding = false
+		w.drains.stop(w.hash)
+	}
+}
+
+// Close stops shedding before the writer is closed.
+func (w *sheddingWriter) Close() error {
+	if w.shedding {
+		w.shedding = false
+		w.drains.stop(w.hash)
+	}
+	return w.WriteCloser.Close()
+}
@@ -0,0 +1,139 @@
+package syslog
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SPKIPins are SHA-256 hashes of the subject public key info of
+// certificates. A drain with pins only accepts server certificate chains
+// that contain a certificate with one of the pins, e.g. the CA of a
+// receiver with a private PKI that is not in the trust store.
+type SPKIPins [][sha256.Size]byte
+
+// ParseSPKIPins parses a comma separated list of pins. Each pin is the hex
+// or base64 encoded SHA-256 hash of a subject public key info, optionally
+// prefixed with "sha256:" or "sha256/".
+func ParseSPKIPins(s string) (SPKIPins, error) {
+	var pins SPKIPins
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		p = strings.TrimPrefix(strings.TrimPrefix(p, "sha256:"), "sha256/")
+
+		b, err := hex.DecodeString(p)
+		if err != nil {
+			b, err = base64.StdEncoding.DecodeString(p)
+		}
+		if err != nil || len(b) != sha256.Size {
+			return nil, fmt.Errorf("invalid SHA-256 pin %q", p)
+		}
+		var pin [sha256.Size]byte
+		copy(pin[:], b)
+		pins = append(pins, pin)
+	}
+	if len(pins) == 0 {
+		return nil, errors.New("no pins")
+	}
+
+	return pins, nil
+}
+
+// SPKIPin returns the pin of the certificate.
+func SPKIPin(c *x509.Certificate) [sha256.Size]byte {
+	return sha256.Sum256(c.RawSubjectPublicKeyInfo)
+}
+
+func (p SPKIPins) match(c *x509.Certificate) bool {
+	pin := SPKIPin(c)
+	for _, q := range p {
+		if bytes.Equal(pin[:], q[:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply makes cfg verify the server certificate of host against the pins.
+// If only is true, or cfg skips verification against its root CAs, the
+// chain must be signed by a pinned certificate instead of a trusted CA.
+// Otherwise the chain must be signed by a trusted CA and contain a pinned
+// certificate.
+func (p SPKIPins) Apply(cfg *tls.Config, host string, only bool) {
+	if only || cfg.InsecureSkipVerify {
+		cfg.InsecureSkipVerify = true //nolint:gosec
+		cfg.VerifyConnection = chainVerifiers(p.verifyPinnedChain(host), cfg.VerifyConnection)
+		return
+	}
+	cfg.VerifyConnection = chainVerifiers(p.verifyTrustedChain, cfg.VerifyConnection)
+}
+
+// verifyPinnedChain verifies the presented chain with the pinned
+// certificates in it as roots.
+func (p SPKIPins) verifyPinnedChain(host string) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return errors.New("drain presented no certificate")
+		}
+
+		roots := x509.NewCertPool()
+		intermediates := x509.NewCertPool()
+		var pinned bool
+		for _, c := range cs.PeerCertificates {
+			if p.match(c) {
+				roots.AddCert(c)
+				pinned = true
+				continue
+			}
+			intermediates.AddCert(c)
+		}
+		if !pinned {
+			return errors.New("no certificate presented by the drain matches its ca-fingerprint")
+		}
+
+		_, err := cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+			DNSName:       host,
+			Roots:         roots,
+			Intermediates: intermediates,
+		})
+		return err
+	}
+}
+
+// verifyTrustedChain checks that a verified chain contains a pinned
+// certificate.
+func (p SPKIPins) verifyTrustedChain(cs tls.ConnectionState) error {
+	for _, chain := range cs.VerifiedChains {
+		for _, c := range chain {
+			if p.match(c) {
+				return nil
+			}
+		}
+	}
+	return errors.New("no certificate in the verified chain matches the drain's ca-fingerprint")
+}
+
+// chainVerifiers returns a VerifyConnection func that calls the verifiers
+// in order until one fails. Nil verifiers are skipped.
+func chainVerifiers(verifiers ...func(tls.ConnectionState) error) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		for _, v := range verifiers {
+			if v == nil {
+				continue
+			}
+			if err := v(cs); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
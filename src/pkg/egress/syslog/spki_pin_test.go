@@ -0,0 +1,142 @@
+package syslog_test
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"io"
+	"net"
+	"os"
+
+	"code.cloudfoundry.org/loggregator-agent-release/src/internal/testhelper"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SPKIPins", func() {
+	var (
+		certs      = testhelper.GenerateCerts("pinnedCA")
+		otherCerts = testhelper.GenerateCerts("otherCA")
+	)
+
+	parseCert := func(file string) *x509.Certificate {
+		b, err := os.ReadFile(file)
+		Expect(err).ToNot(HaveOccurred())
+		block, _ := pem.Decode(b)
+		Expect(block).ToNot(BeNil())
+		c, err := x509.ParseCertificate(block.Bytes)
+		Expect(err).ToNot(HaveOccurred())
+		return c
+	}
+
+	pinOf := func(file string) string {
+		pin := syslog.SPKIPin(parseCert(file))
+		return hex.EncodeToString(pin[:])
+	}
+
+	Describe("ParseSPKIPins", func() {
+		It("parses hex and base64 pins with optional prefixes", func() {
+			sum := sha256.Sum256([]byte("some-key"))
+
+			pins, err := syslog.ParseSPKIPins(
+				hex.EncodeToString(sum[:]) + ", sha256/" + base64.StdEncoding.EncodeToString(sum[:]) + ",sha256:" + hex.EncodeToString(sum[:]),
+			)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pins).To(HaveLen(3))
+			for _, p := range pins {
+				Expect(p).To(Equal(sum))
+			}
+		})
+
+		It("rejects invalid pins", func() {
+			_, err := syslog.ParseSPKIPins("abc")
+			Expect(err).To(MatchError(`invalid SHA-256 pin "abc"`))
+
+			_, err = syslog.ParseSPKIPins(" , ")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("Apply", func() {
+		var addr string
+
+		BeforeEach(func() {
+			leaf, err := tls.LoadX509KeyPair(certs.Cert("localhost"), certs.Key("localhost"))
+			Expect(err).ToNot(HaveOccurred())
+			// Present the CA as well, like receivers with a private PKI
+			// that send their full chain.
+			leaf.Certificate = append(leaf.Certificate, parseCert(certs.CA()).Raw)
+
+			lis, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{leaf}}) //nolint:gosec
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(lis.Close)
+			go func() {
+				for {
+					conn, err := lis.Accept()
+					if err != nil {
+						return
+					}
+					go func() {
+						defer conn.Close()
+						conn.(*tls.Conn).Handshake() //nolint:errcheck
+						io.Copy(io.Discard, conn)    //nolint:errcheck
+					}()
+				}
+			}()
+
+			_, port, err := net.SplitHostPort(lis.Addr().String())
+			Expect(err).ToNot(HaveOccurred())
+			addr = net.JoinHostPort("localhost", port)
+		})
+
+		dial := func(roots *x509.CertPool, pin string, only bool) error {
+			pins, err := syslog.ParseSPKIPins(pin)
+			Expect(err).ToNot(HaveOccurred())
+			cfg := &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+			pins.Apply(cfg, "localhost", only)
+
+			conn, err := tls.Dial("tcp", addr, cfg)
+			if err != nil {
+				return err
+			}
+			return conn.Close()
+		}
+
+		trusted := func() *x509.CertPool {
+			p := x509.NewCertPool()
+			p.AddCert(parseCert(certs.CA()))
+			return p
+		}
+
+		It("requires a pinned certificate in the trusted chain", func() {
+			Expect(dial(trusted(), pinOf(certs.CA()), false)).To(Succeed())
+			Expect(dial(trusted(), pinOf(otherCerts.CA()), false)).To(MatchError(ContainSubstring("matches the drain's ca-fingerprint")))
+		})
+
+		It("still requires a trusted CA", func() {
+			Expect(dial(x509.NewCertPool(), pinOf(certs.CA()), false)).ToNot(Succeed())
+		})
+
+		It("verifies the chain against the pins only", func() {
+			Expect(dial(x509.NewCertPool(), pinOf(certs.CA()), true)).To(Succeed())
+			Expect(dial(x509.NewCertPool(), pinOf(certs.Cert("localhost")), true)).To(Succeed())
+			Expect(dial(x509.NewCertPool(), pinOf(otherCerts.CA()), true)).To(MatchError(ContainSubstring("matches its ca-fingerprint")))
+		})
+
+		It("verifies the host name in pin only mode", func() {
+			pins, err := syslog.ParseSPKIPins(pinOf(certs.CA()))
+			Expect(err).ToNot(HaveOccurred())
+			cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+			pins.Apply(cfg, "other-host", true)
+
+			_, err = tls.Dial("tcp", addr, cfg)
+			Expect(err).To(MatchError(ContainSubstring("other-host")))
+		})
+	})
+})
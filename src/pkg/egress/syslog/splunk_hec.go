@@ -0,0 +1,233 @@
+package syslog
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metrics "code.cloudfoundry.org/go-metric-registry"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
+	egress_v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
+	"github.com/valyala/fasthttp"
+)
+
+const defaultSplunkSourceType = "cloudfoundry"
+
+// splunkQueryParams are consumed by the SplunkHECWriter and are not
+// forwarded to the HTTP Event Collector.
+var splunkQueryParams = []string{"format", "sourcetype", "index", "channel"}
+
+// SplunkHECWriter posts envelopes to a Splunk HTTP Event Collector using the
+// native HEC JSON event format. Events of https-batch drains are sent in
+// batches, other drains post every event on its own.
+type SplunkHECWriter struct {
+	hostname        string
+	url             *url.URL
+	token           string
+	channel         string
+	sourceType      string
+	index           string
+	client          *fasthttp.Client
+	egressMetric    metrics.Counter
+	syslogConverter *Converter
+	batcher         *batchSender[[]byte]
+}
+
+type splunkHECEvent struct {
+	Time       json.Number    `json:"time"`
+	Host       string         `json:"host,omitempty"`
+	Source     string         `json:"source,omitempty"`
+	SourceType string         `json:"sourcetype,omitempty"`
+	Index      string         `json:"index,omitempty"`
+	Event      any            `json:"event"`
+	Fields     map[string]any `json:"fields,omitempty"`
+}
+
+type splunkHECResponse struct {
+	Text string `json:"text"`
+	Code int    `json:"code"`
+}
+
+// NewSplunkHECWriter creates a new SplunkHECWriter. The HEC token is taken
+// from the token binding metadata, the password of the binding URL, or the
+// username if no password is given. The sourcetype, index and channel query
+// parameters configure the respective HEC fields. Collectors with indexer
+// acknowledgement enabled require a channel. The writer does not poll the
+// collector for acknowledgements, so events count as egressed once the
+// collector accepted them rather than once they are indexed.
+func NewSplunkHECWriter(
+	binding *URLBinding,
+	netConf NetworkTimeoutConfig,
+	tlsConf *tls.Config,
+	egressMetric metrics.Counter,
+	c *Converter,
+) egress.WriteCloser {
+	q := binding.URL.Query()
+	sourceType := q.Get("sourcetype")
+	if sourceType == "" {
+		sourceType = defaultSplunkSourceType
+	}
+
+	w := &SplunkHECWriter{
+		hostname:        binding.Hostname,
+		url:             stripQueryParams(binding.URL, splunkQueryParams...),
+		token:           credentialFromBinding(binding),
+		channel:         q.Get("channel"),
+		sourceType:      sourceType,
+		index:           q.Get("index"),
+		client:          httpClient(netConf, tlsConf),
+		egressMetric:    egressMetric,
+		syslogConverter: c,
+	}
+	if binding.URL.Scheme == "https-batch" {
+		w.batcher = newBatchSender(binding.Context, w.url.Host, defaultPushBatchSize, countEntry[[]byte], w.sendBatch)
+		w.batcher.start()
+	}
+
+	return w
+}
+
+// Write converts the envelope into a HEC event and posts it to the
+// collector. Events of https-batch drains are queued to be sent with the
+// next batch instead, which blocks until the sender accepts the event or
+// ctx is done.
+func (w *SplunkHECWriter) Write(ctx context.Context, env *loggregator_v2.Envelope) error {
+	event, ok := w.toHECEvent(env)
+	if !ok {
+		return nil
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	if w.batcher != nil {
+		return w.batcher.add(ctx, body, egress_v2.EnvelopeType(env))
+	}
+
+	return w.send(ctx, body, 1)
+}
+
+// sendBatch posts the events in a single request. The collector accepts
+// multiple concatenated events in a request body.
+func (w *SplunkHECWriter) sendBatch(ctx context.Context, events [][]byte, _ string) error {
+	return w.send(ctx, bytes.Join(events, []byte{'\n'}), float64(len(events)))
+}
+
+func (w *SplunkHECWriter) send(ctx context.Context, body []byte, msgCount float64) error {
+	req := fasthttp.AcquireRequest()
+	req.SetRequestURI(w.url.String())
+	req.Header.SetMethod("POST")
+	req.Header.SetContentType("application/json")
+	if w.token != "" {
+		req.Header.Set("Authorization", "Splunk "+w.token)
+	}
+	if w.channel != "" {
+		req.Header.Set("X-Splunk-Request-Channel", w.channel)
+	}
+	req.SetBody(body)
+
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+
+	err := doRequest(ctx, w.client, req, resp)
+	if err != nil {
+		return egress.WithCategory(err, requestErrorCategory(err))
+	}
+
+	if resp.StatusCode() < 200 || resp.StatusCode() > 299 {
+		return egress.WithCategory(
+			fmt.Errorf("splunk HEC Writer: Post responded with %d status code", resp.StatusCode()),
+			egress.StatusCategory(resp.StatusCode()),
+		)
+	}
+
+	var hecResp splunkHECResponse
+	if err := json.Unmarshal(resp.Body(), &hecResp); err == nil && hecResp.Code != 0 {
+		return fmt.Errorf("splunk HEC Writer: collector responded with code %d: %s", hecResp.Code, hecResp.Text)
+	}
+
+	w.egressMetric.Add(msgCount)
+
+	return nil
+}
+
+func (w *SplunkHECWriter) toHECEvent(env *loggregator_v2.Envelope) (splunkHECEvent, bool) {
+	e := splunkHECEvent{
+		Time:       hecTime(env.GetTimestamp()),
+		Host:       w.syslogConverter.BuildHostname(env, w.hostname),
+		Source:     env.GetSourceId(),
+		SourceType: w.sourceType,
+		Index:      w.index,
+	}
+
+	fields := make(map[string]any, len(env.GetTags())+1)
+	for k, v := range env.GetTags() {
+		fields[k] = v
+	}
+	if env.GetInstanceId() != "" {
+		fields["instance_id"] = env.GetInstanceId()
+	}
+
+	switch m := env.GetMessage().(type) {
+	case *loggregator_v2.Envelope_Log:
+		e.Event = string(removeNulls(m.Log.GetPayload()))
+	case *loggregator_v2.Envelope_Gauge:
+		for name, g := range m.Gauge.GetMetrics() {
+			fields["metric_name:"+name] = g.GetValue()
+		}
+		e.Event = "metric"
+	case *loggregator_v2.Envelope_Counter:
+		fields["metric_name:"+m.Counter.GetName()] = m.Counter.GetTotal()
+		fields["delta"] = m.Counter.GetDelta()
+		e.Event = "metric"
+	case *loggregator_v2.Envelope_Timer:
+		e.Event = map[string]any{
+			"name":  m.Timer.GetName(),
+			"start": m.Timer.GetStart(),
+			"stop":  m.Timer.GetStop(),
+		}
+	case *loggregator_v2.Envelope_Event:
+		e.Event = map[string]any{
+			"title": m.Event.GetTitle(),
+			"body":  m.Event.GetBody(),
+		}
+	default:
+		return splunkHECEvent{}, false
+	}
+	e.Fields = fields
+
+	return e, true
+}
+
+// hecTime formats a nanosecond timestamp as epoch seconds with millisecond
+// precision.
+func hecTime(ns int64) json.Number {
+	t := time.Unix(0, ns)
+	return json.Number(fmt.Sprintf("%d.%03d", t.Unix(), t.Nanosecond()/int(time.Millisecond)))
+}
+
+// countEgress counts the envelopes of the batches of https-batch drains
+// that the collector accepted with c. It reports false for other drains
+// whose envelopes are counted once written.
+func (w *SplunkHECWriter) countEgress(c *egress_v2.EgressCounter) bool {
+	if w.batcher == nil {
+		return false
+	}
+	return w.batcher.countEgress(c)
+}
+
+// Close sends any queued events.
+func (w *SplunkHECWriter) Close() error {
+	if w.batcher != nil {
+		w.batcher.close()
+	}
+	return nil
+}
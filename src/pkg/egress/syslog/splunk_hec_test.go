@@ -0,0 +1,245 @@
+package syslog_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SplunkHECWriter", func() {
+	var (
+		netConf          syslog.NetworkTimeoutConfig
+		skipSSLTLSConfig = &tls.Config{
+			InsecureSkipVerify: true, //nolint:gosec
+		}
+		c = syslog.NewConverter()
+	)
+
+	It("posts log envelopes as HEC events", func() {
+		drain := newSpyPushDrain(http.StatusOK, `{"text":"Success","code":0}`)
+		defer drain.Close()
+
+		b := buildURLBinding(
+			withUserInfo(drain.URL, "x", "hec-token")+"/services/collector/event?format=splunk-hec&sourcetype=cf:app&index=main",
+			"test-app-id",
+			"test-hostname",
+		)
+		writer := syslog.NewSplunkHECWriter(b, netConf, skipSSLTLSConfig, &metricsHelpers.SpyMetric{}, c)
+
+		env := buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT)
+		env.Timestamp = 1426279439123000000
+		Expect(writer.Write(context.Background(), env)).To(Succeed())
+
+		Expect(drain.requests()).To(HaveLen(1))
+		req := drain.requests()[0]
+		Expect(req.path).To(Equal("/services/collector/event"))
+		Expect(req.query).To(BeEmpty())
+		Expect(req.header.Get("Authorization")).To(Equal("Splunk hec-token"))
+		Expect(req.header.Get("Content-Type")).To(Equal("application/json"))
+
+		var event map[string]any
+		Expect(json.Unmarshal(req.body, &event)).To(Succeed())
+		Expect(event).To(HaveKeyWithValue("time", 1426279439.123))
+		Expect(event).To(HaveKeyWithValue("host", "test-hostname"))
+		Expect(event).To(HaveKeyWithValue("source", "test-app-id"))
+		Expect(event).To(HaveKeyWithValue("sourcetype", "cf:app"))
+		Expect(event).To(HaveKeyWithValue("index", "main"))
+		Expect(event).To(HaveKeyWithValue("event", "just a test"))
+		Expect(event["fields"]).To(HaveKeyWithValue("source_type", "APP"))
+		Expect(event["fields"]).To(HaveKeyWithValue("instance_id", "1"))
+	})
+
+	It("defaults the sourcetype", func() {
+		drain := newSpyPushDrain(http.StatusOK, "")
+		defer drain.Close()
+
+		b := buildURLBinding(drain.URL+"?format=splunk-hec", "test-app-id", "test-hostname")
+		writer := syslog.NewSplunkHECWriter(b, netConf, skipSSLTLSConfig, &metricsHelpers.SpyMetric{}, c)
+
+		Expect(writer.Write(context.Background(), buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT))).To(Succeed())
+
+		var event map[string]any
+		Expect(json.Unmarshal(drain.requests()[0].body, &event)).To(Succeed())
+		Expect(event).To(HaveKeyWithValue("sourcetype", "cloudfoundry"))
+		Expect(drain.requests()[0].header.Get("Authorization")).To(BeEmpty())
+	})
+
+	It("prefers the token from the binding metadata", func() {
+		drain := newSpyPushDrain(http.StatusOK, "")
+		defer drain.Close()
+
+		b := buildURLBinding(withUserInfo(drain.URL, "x", "url-token")+"?format=splunk-hec", "test-app-id", "test-hostname")
+		b.Metadata = syslog.NewDrainMetadata(map[string]string{"token": "metadata-token"})
+		writer := syslog.NewSplunkHECWriter(b, netConf, skipSSLTLSConfig, &metricsHelpers.SpyMetric{}, c)
+
+		Expect(writer.Write(context.Background(), buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT))).To(Succeed())
+		Expect(drain.requests()[0].header.Get("Authorization")).To(Equal("Splunk metadata-token"))
+	})
+
+	It("sends the events of https-batch drains in batches", func() {
+		drain := newSpyPushDrain(http.StatusOK, `{"text":"Success","code":0}`)
+		defer drain.Close()
+
+		sm := &metricsHelpers.SpyMetric{}
+		b := buildURLBinding(strings.Replace(drain.URL, "https", "https-batch", 1)+"?format=splunk-hec", "test-app-id", "test-hostname")
+		writer := syslog.NewSplunkHECWriter(b, netConf, skipSSLTLSConfig, sm, c)
+
+		Expect(writer.Write(context.Background(), buildLogEnvelope("APP", "1", "first", loggregator_v2.Log_OUT))).To(Succeed())
+		Expect(writer.Write(context.Background(), buildLogEnvelope("APP", "1", "second", loggregator_v2.Log_OUT))).To(Succeed())
+		Expect(writer.Close()).To(Succeed())
+
+		Expect(drain.requests()).To(HaveLen(1))
+		dec := json.NewDecoder(bytes.NewReader(drain.requests()[0].body))
+		var events []string
+		for dec.More() {
+			var event map[string]any
+			Expect(dec.Decode(&event)).To(Succeed())
+			events = append(events, event["event"].(string))
+		}
+		Expect(events).To(Equal([]string{"first", "second"}))
+		Expect(sm.Value()).To(BeNumerically("==", 2))
+	})
+
+	It("sets the request channel header for indexer acknowledgement", func() {
+		drain := newSpyPushDrain(http.StatusOK, `{"text":"Success","code":0,"ackId":7}`)
+		defer drain.Close()
+
+		b := buildURLBinding(drain.URL+"?format=splunk-hec&channel=FE0ECFAD-13D5-401B-847D-77833BD77131", "test-app-id", "test-hostname")
+		writer := syslog.NewSplunkHECWriter(b, netConf, skipSSLTLSConfig, &metricsHelpers.SpyMetric{}, c)
+
+		Expect(writer.Write(context.Background(), buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT))).To(Succeed())
+		Expect(drain.requests()[0].header.Get("X-Splunk-Request-Channel")).To(Equal("FE0ECFAD-13D5-401B-847D-77833BD77131"))
+	})
+
+	It("writes gauges as HEC multi-metric events", func() {
+		drain := newSpyPushDrain(http.StatusOK, "")
+		defer drain.Close()
+
+		b := buildURLBinding(drain.URL+"?format=splunk-hec", "test-app-id", "test-hostname")
+		writer := syslog.NewSplunkHECWriter(b, netConf, skipSSLTLSConfig, &metricsHelpers.SpyMetric{}, c)
+
+		Expect(writer.Write(context.Background(), buildGaugeEnvelope("1"))).To(Succeed())
+
+		var event map[string]any
+		Expect(json.Unmarshal(drain.requests()[0].body, &event)).To(Succeed())
+		Expect(event).To(HaveKeyWithValue("event", "metric"))
+		Expect(event["fields"]).To(HaveKeyWithValue("metric_name:cpu", 0.23))
+		Expect(event["fields"]).To(HaveKeyWithValue("metric_name:memory", 5423.0))
+	})
+
+	It("writes counters as HEC metric events", func() {
+		drain := newSpyPushDrain(http.StatusOK, "")
+		defer drain.Close()
+
+		b := buildURLBinding(drain.URL+"?format=splunk-hec", "test-app-id", "test-hostname")
+		writer := syslog.NewSplunkHECWriter(b, netConf, skipSSLTLSConfig, &metricsHelpers.SpyMetric{}, c)
+
+		Expect(writer.Write(context.Background(), buildCounterEnvelope("1"))).To(Succeed())
+
+		var event map[string]any
+		Expect(json.Unmarshal(drain.requests()[0].body, &event)).To(Succeed())
+		Expect(event["fields"]).To(HaveKeyWithValue("metric_name:some-counter", 99.0))
+		Expect(event["fields"]).To(HaveKeyWithValue("delta", 1.0))
+	})
+
+	It("errors when the collector responds with a non-2xx status", func() {
+		drain := newSpyPushDrain(http.StatusForbidden, `{"text":"Invalid token","code":4}`)
+		defer drain.Close()
+
+		b := buildURLBinding(drain.URL+"?format=splunk-hec", "test-app-id", "test-hostname")
+		writer := syslog.NewSplunkHECWriter(b, netConf, skipSSLTLSConfig, &metricsHelpers.SpyMetric{}, c)
+
+		Expect(writer.Write(context.Background(), buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT))).To(HaveOccurred())
+	})
+
+	It("errors when the collector responds with a non-zero code", func() {
+		drain := newSpyPushDrain(http.StatusOK, `{"text":"Data channel is missing","code":10}`)
+		defer drain.Close()
+
+		b := buildURLBinding(drain.URL+"?format=splunk-hec", "test-app-id", "test-hostname")
+		writer := syslog.NewSplunkHECWriter(b, netConf, skipSSLTLSConfig, &metricsHelpers.SpyMetric{}, c)
+
+		err := writer.Write(context.Background(), buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT))
+		Expect(err).To(MatchError(ContainSubstring("Data channel is missing")))
+	})
+
+	It("emits an egress metric for each event", func() {
+		drain := newSpyPushDrain(http.StatusOK, "")
+		defer drain.Close()
+
+		sm := &metricsHelpers.SpyMetric{}
+		b := buildURLBinding(drain.URL+"?format=splunk-hec", "test-app-id", "test-hostname")
+		writer := syslog.NewSplunkHECWriter(b, netConf, skipSSLTLSConfig, sm, c)
+
+		Expect(writer.Write(context.Background(), buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT))).To(Succeed())
+		Expect(sm.Value()).To(BeNumerically("==", 1))
+	})
+})
+
+type spyPushRequest struct {
+	path   string
+	query  string
+	header http.Header
+	body   []byte
+}
+
+type spyPushDrain struct {
+	*httptest.Server
+	mu   sync.Mutex
+	reqs []spyPushRequest
+}
+
+func (d *spyPushDrain) requests() []spyPushRequest {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.reqs
+}
+
+func newSpyPushDrain(status int, response string) *spyPushDrain {
+	drain := &spyPushDrain{}
+	drain.Server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		var reader io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			Expect(err).ToNot(HaveOccurred())
+			reader = gz
+		}
+		body, err := io.ReadAll(reader)
+		Expect(err).ToNot(HaveOccurred())
+
+		drain.mu.Lock()
+		drain.reqs = append(drain.reqs, spyPushRequest{
+			path:   r.URL.Path,
+			query:  r.URL.RawQuery,
+			header: r.Header,
+			body:   body,
+		})
+		drain.mu.Unlock()
+
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(response))
+	}))
+	return drain
+}
+
+func withUserInfo(rawURL, user, password string) string {
+	u, err := url.Parse(rawURL)
+	Expect(err).ToNot(HaveOccurred())
+	u.User = url.UserPassword(user, password)
+	return u.String()
+}
@@ -3,6 +3,7 @@ package syslog
 import (
 	"fmt"
 	"log"
+	"time"
 
 	"golang.org/x/net/context"
 
@@ -20,11 +21,40 @@ type Binding struct {
 	DrainData    DrainData `json:"type,omitempty"`
 	OmitMetadata bool
 	InternalTls  bool
+	Format       DrainFormat
+	Template     string
+	Sanitize     PayloadSanitization
+	Newline      NewlinePolicy
+	Framing      Framing
+	// StreamStructuredData adds the stream of log messages as structured
+	// data. See WithStreamStructuredData.
+	StreamStructuredData bool
+	// Severity sets the severities of stdout and stderr log messages.
+	Severity SeverityMapping
+	// ProcIDFormat and MsgIDFormat compose the PROCID and MSGID of syslog
+	// messages. See FieldFormat.
+	ProcIDFormat FieldFormat
+	MsgIDFormat  FieldFormat
+	// UTF8 selects whether log payloads are validated and marked as UTF-8.
+	UTF8 UTF8Mode
+	// Instances is a comma separated list of app instance indexes. When set
+	// only envelopes from these instances are written to the drain.
+	Instances string
+	// ExcludeSources is a comma separated list of source types, e.g. RTR,
+	// whose envelopes are not written to the drain.
+	ExcludeSources string
+	// CAFingerprint is a comma separated list of SPKI pins the server
+	// certificate chain of the drain must contain. See SPKIPins.
+	CAFingerprint string
+	// CAFingerprintOnly verifies the drain against CAFingerprint instead
+	// of the trusted CAs.
+	CAFingerprintOnly bool
 }
 
 type Drain struct {
-	Url         string      `json:"url"`
-	Credentials Credentials `json:"credentials"`
+	Url         string        `json:"url"`
+	Credentials Credentials   `json:"credentials"`
+	Metadata    DrainMetadata `json:"metadata"`
 }
 
 type Credentials struct {
@@ -47,6 +77,7 @@ func (nullLogClient) EmitLog(message string, opts ...loggregator.EmitLogOption)
 
 type writerFactory interface {
 	NewWriter(*URLBinding) (egress.WriteCloser, error)
+	Probe(context.Context, *URLBinding) error
 }
 
 // SyslogConnector creates the various egress syslog writers.
@@ -57,8 +88,15 @@ type SyslogConnector struct {
 	sourceIndex    string
 	writerFactory  writerFactory
 
-	metricClient  metricClient
+	metricClient  MetricClient
 	droppedMetric metrics.Counter
+	writerPanics  *writerPanicCounters
+
+	defaultSanitize PayloadSanitization
+
+	deliveryStatusInterval time.Duration
+	drainPauses            *DrainPauses
+	slowDrains             *SlowDrains
 }
 
 // NewSyslogConnector configures and returns a new SyslogConnector.
@@ -66,7 +104,7 @@ func NewSyslogConnector(
 	skipCertVerify bool,
 	wg egress.WaitGroup,
 	f writerFactory,
-	m metricClient,
+	m MetricClient,
 	opts ...ConnectorOption,
 ) *SyslogConnector {
 	droppedMetric := m.NewCounter(
@@ -83,6 +121,7 @@ func NewSyslogConnector(
 
 		metricClient:  m,
 		droppedMetric: droppedMetric,
+		writerPanics:  newWriterPanicCounters(m),
 	}
 	for _, o := range opts {
 		o(sc)
@@ -102,15 +141,67 @@ func WithLogClient(logClient LogClient, sourceIndex string) ConnectorOption {
 	}
 }
 
+// WithDefaultSanitization returns a ConnectorOption that sanitizes log
+// payloads of drains that do not set the sanitize parameter.
+func WithDefaultSanitization(s PayloadSanitization) ConnectorOption {
+	return func(sc *SyslogConnector) {
+		sc.defaultSanitize = s
+	}
+}
+
+// WithDeliveryStatusNotices returns a ConnectorOption that emits a log to
+// the app bound to a drain when writes to the drain fail after all retries
+// and when the drain recovers. At most one notice per drain is emitted per
+// interval.
+func WithDeliveryStatusNotices(interval time.Duration) ConnectorOption {
+	return func(sc *SyslogConnector) {
+		sc.deliveryStatusInterval = interval
+	}
+}
+
+// WithDrainPauses returns a ConnectorOption that holds writes to drains
+// while they are paused in p.
+func WithDrainPauses(p *DrainPauses) ConnectorOption {
+	return func(sc *SyslogConnector) {
+		sc.drainPauses = p
+	}
+}
+
+// WithSlowDrains returns a ConnectorOption that sheds the envelopes of
+// drains that exceed the latency budget of s.
+func WithSlowDrains(s *SlowDrains) ConnectorOption {
+	return func(sc *SyslogConnector) {
+		sc.slowDrains = s
+	}
+}
+
 // Connect returns an egress writer based on the scheme of the binding drain
 // URL.
 func (w *SyslogConnector) Connect(ctx context.Context, b Binding) (egress.Writer, error) {
-	urlBinding, err := buildBinding(ctx, b)
+	urlBinding, err := NewURLBinding(ctx, b)
 	if err != nil {
 		return nil, err
 	}
 
-	writer, err := w.writerFactory.NewWriter(urlBinding)
+	sanitize := b.Sanitize
+	if sanitize == SanitizeNone {
+		sanitize = w.defaultSanitize
+	}
+	if !sanitize.Valid() {
+		return nil, NewWriterFactoryErrorf(urlBinding.URL, "unsupported sanitize mode: %q", sanitize)
+	}
+
+	newWriter := func() (egress.WriteCloser, error) {
+		writer, err := w.writerFactory.NewWriter(urlBinding)
+		if err != nil {
+			return nil, err
+		}
+		if sanitize != SanitizeNone {
+			writer = NewSanitizingWriter(writer, sanitize)
+		}
+		return writer, nil
+	}
+	writer, err := newWriter()
 	if err != nil {
 		return nil, err
 	}
@@ -119,6 +210,22 @@ func (w *SyslogConnector) Connect(ctx context.Context, b Binding) (egress.Writer
 	anonymousUrl.User = nil
 	anonymousUrl.RawQuery = ""
 
+	drainHash := egress.DrainHash(urlBinding.URL.String())
+	writerPanics, releaseWriterPanics := w.writerPanics.acquire(drainHash)
+	writer = newRecoveringWriter(writer, newWriter, drainHash, writerPanics, releaseWriterPanics)
+	if w.slowDrains != nil {
+		writer = w.slowDrains.newWriter(writer, anonymousUrl.String(), drainHash)
+	}
+	if w.drainPauses != nil {
+		writer = pausingWriter{WriteCloser: writer, hash: drainHash, pauses: w.drainPauses}
+	}
+
+	if w.deliveryStatusInterval > 0 && b.AppId != "" {
+		writer = newDeliveryStatusWriter(writer, anonymousUrl.String(), w.deliveryStatusInterval, func(message string) {
+			w.emitLoggregatorErrorLog(b.AppId, message)
+		})
+	}
+
 	drainScope := "app"
 	if b.AppId == "" {
 		drainScope = "aggregate"
@@ -141,8 +248,12 @@ func (w *SyslogConnector) Connect(ctx context.Context, b Binding) (egress.Writer
 		w.emitLoggregatorErrorLog(b.AppId, fmt.Sprintf("%d messages lost for application %s in user provided syslog drain with url %s", missed, b.AppId, anonymousUrl.String()))
 		w.emitStandardOutErrorLog(b.AppId, urlBinding.Scheme(), anonymousUrl.String(), missed)
 	}), w.wg)
+	var drainWriter egress.Writer = dw
+	if w.drainPauses != nil {
+		drainWriter = pausableDiodeWriter{DiodeWriter: dw, hash: drainHash, pauses: w.drainPauses}
+	}
 
-	filteredWriter, err := NewFilteringDrainWriter(b, dw)
+	filteredWriter, err := NewFilteringDrainWriter(b, drainWriter)
 	if err != nil {
 		log.Printf("failed to create filtered writer: %s", err)
 		return nil, err
@@ -151,6 +262,17 @@ func (w *SyslogConnector) Connect(ctx context.Context, b Binding) (egress.Writer
 	return filteredWriter, nil
 }
 
+// Probe checks that the drain of the binding is reachable without creating
+// a writer.
+func (w *SyslogConnector) Probe(ctx context.Context, b Binding) error {
+	urlBinding, err := NewURLBinding(ctx, b)
+	if err != nil {
+		return PermanentProbeError{Err: err}
+	}
+
+	return w.writerFactory.Probe(ctx, urlBinding)
+}
+
 func (w *SyslogConnector) emitLoggregatorErrorLog(appID, message string) {
 	if appID == "" {
 		return
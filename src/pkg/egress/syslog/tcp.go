@@ -2,6 +2,7 @@ package syslog
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"log"
 	"net"
@@ -15,8 +16,27 @@ import (
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
 )
 
+// Framing selects how syslog messages are delimited on TCP and TLS
+// connections as described in RFC 6587. The zero value is octet counting.
+type Framing string
+
+const (
+	FramingOctetCounting  Framing = "octet-counting"
+	FramingNonTransparent Framing = "non-transparent"
+)
+
+// Valid reports whether f is a known framing.
+func (f Framing) Valid() bool {
+	switch f {
+	case "", FramingOctetCounting, FramingNonTransparent:
+		return true
+	default:
+		return false
+	}
+}
+
 // DialFunc represents a method for creating a connection, either TCP or TLS.
-type DialFunc func(addr string) (net.Conn, error)
+type DialFunc func(ctx context.Context, addr string) (net.Conn, error)
 
 // TCPWriter represents a syslog writer that connects over unencrypted TCP.
 // This writer is not meant to be used from multiple goroutines. The same
@@ -30,6 +50,7 @@ type TCPWriter struct {
 	scheme          string
 	conn            net.Conn
 	syslogConverter *Converter
+	framing         Framing
 
 	egressMetric metrics.Counter
 }
@@ -45,8 +66,8 @@ func NewTCPWriter(
 		Timeout:   netConf.DialTimeout,
 		KeepAlive: netConf.Keepalive,
 	}
-	df := func(addr string) (net.Conn, error) {
-		return dialer.Dial("tcp", addr)
+	df := func(ctx context.Context, addr string) (net.Conn, error) {
+		return dialer.DialContext(ctx, "tcp", addr)
 	}
 
 	w := &TCPWriter{
@@ -58,14 +79,20 @@ func NewTCPWriter(
 		scheme:          "syslog",
 		egressMetric:    egressMetric,
 		syslogConverter: c,
+		framing:         binding.Framing,
 	}
 
 	return w
 }
 
-// Write writes an envelope to the syslog drain connection.
-func (w *TCPWriter) Write(env *loggregator_v2.Envelope) error {
-	conn, err := w.connection()
+// Write writes an envelope to the syslog drain connection. Writes are
+// aborted when ctx is done or its deadline is exceeded.
+func (w *TCPWriter) Write(ctx context.Context, env *loggregator_v2.Envelope) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	conn, err := w.connection(ctx)
 	if err != nil {
 		return err
 	}
@@ -75,16 +102,31 @@ func (w *TCPWriter) Write(env *loggregator_v2.Envelope) error {
 		return err
 	}
 
+	// Expire the write deadline when the context is done to unblock an
+	// in-flight write.
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetWriteDeadline(time.Now())
+	})
+	defer stop()
+
 	for _, msg := range msgs {
-		err = conn.SetWriteDeadline(time.Now().Add(w.writeTimeout))
+		err = conn.SetWriteDeadline(w.writeDeadline(ctx))
 		if err != nil {
 			_ = w.Close()
 			return err
 		}
+		// The deadline may have replaced the one set when ctx was done.
+		if err := ctx.Err(); err != nil {
+			_ = w.Close()
+			return err
+		}
 
-		_, err = conn.Write([]byte(strconv.Itoa(len(msg)) + " " + string(msg)))
+		_, err = conn.Write(w.frame(msg))
 		if err != nil {
 			_ = w.Close()
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
 			return err
 		}
 
@@ -94,17 +136,36 @@ func (w *TCPWriter) Write(env *loggregator_v2.Envelope) error {
 	return nil
 }
 
-func (w *TCPWriter) connection() (net.Conn, error) {
+// frame prefixes the message with its length or, with non-transparent
+// framing, terminates it with a newline.
+func (w *TCPWriter) frame(msg []byte) []byte {
+	if w.framing == FramingNonTransparent {
+		return appendNewline(msg)
+	}
+	return []byte(strconv.Itoa(len(msg)) + " " + string(msg))
+}
+
+// writeDeadline returns the write timeout from now or the deadline of the
+// context if it is earlier.
+func (w *TCPWriter) writeDeadline(ctx context.Context) time.Time {
+	deadline := time.Now().Add(w.writeTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		return d
+	}
+	return deadline
+}
+
+func (w *TCPWriter) connection(ctx context.Context) (net.Conn, error) {
 	if w.conn == nil {
-		return w.connect()
+		return w.connect(ctx)
 	}
 	return w.conn, nil
 }
 
-func (w *TCPWriter) connect() (net.Conn, error) {
-	conn, err := w.dialFunc(w.url.Host)
+func (w *TCPWriter) connect(ctx context.Context) (net.Conn, error) {
+	conn, err := w.dialFunc(ctx, w.url.Host)
 	if err != nil {
-		return nil, err
+		return nil, egress.DialError(err)
 	}
 	w.conn = conn
 
@@ -2,6 +2,7 @@ package syslog_test
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"net"
@@ -63,7 +64,7 @@ var _ = Describe("TCPWriter", func() {
 
 		DescribeTable("envelopes are written out with proper priority", func(logType loggregator_v2.Log_Type, expectedPriority int) {
 			env := buildLogEnvelope("APP", "2", "just a test", logType)
-			Expect(writer.Write(env)).To(Succeed())
+			Expect(writer.Write(context.Background(), env)).To(Succeed())
 
 			conn, err := listener.Accept()
 			Expect(err).ToNot(HaveOccurred())
@@ -82,7 +83,7 @@ var _ = Describe("TCPWriter", func() {
 
 		DescribeTable("envelopes are written out with proper process id", func(sourceType, sourceInstance, expectedProcessID string, expectedLength int) {
 			env := buildLogEnvelope(sourceType, sourceInstance, "just a test", loggregator_v2.Log_OUT)
-			Expect(writer.Write(env)).To(Succeed())
+			Expect(writer.Write(context.Background(), env)).To(Succeed())
 
 			conn, err := listener.Accept()
 			Expect(err).ToNot(HaveOccurred())
@@ -98,9 +99,73 @@ var _ = Describe("TCPWriter", func() {
 			Entry("other source type", "other", "1", "OTHER/1", 122),
 		)
 
+		Describe("framing", func() {
+			var newWriter = func(framing syslog.Framing, newline syslog.NewlinePolicy) egress.WriteCloser {
+				b := *binding
+				b.Framing = framing
+				return syslog.NewTCPWriter(
+					&b,
+					netConf,
+					egressCounter,
+					syslog.NewConverter(syslog.WithoutSyslogMetadata(), syslog.WithNewlinePolicy(newline)),
+				)
+			}
+
+			var readAll = func(w egress.WriteCloser) string {
+				conn, err := listener.Accept()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(w.Close()).To(Succeed())
+
+				b, err := io.ReadAll(conn)
+				Expect(err).ToNot(HaveOccurred())
+				return string(b)
+			}
+
+			const header = "<14>1 1970-01-01T00:00:00.012345+00:00 test-hostname test-app-id [APP/2] - - "
+
+			It("uses octet counting by default", func() {
+				w := newWriter("", syslog.NewlinePassThrough)
+				Expect(w.Write(context.Background(), buildLogEnvelope("APP", "2", "line 1\nline 2", loggregator_v2.Log_OUT))).To(Succeed())
+
+				msg := header + "line 1\nline 2\n"
+				Expect(readAll(w)).To(Equal(fmt.Sprintf("%d %s", len(msg), msg)))
+			})
+
+			It("writes a frame per line with octet counting and split newlines", func() {
+				w := newWriter(syslog.FramingOctetCounting, syslog.NewlineSplit)
+				Expect(w.Write(context.Background(), buildLogEnvelope("APP", "2", "line 1\nline 2", loggregator_v2.Log_OUT))).To(Succeed())
+
+				msg1 := header + "line 1\n"
+				msg2 := header + "line 2\n"
+				Expect(readAll(w)).To(Equal(fmt.Sprintf("%d %s%d %s", len(msg1), msg1, len(msg2), msg2)))
+				Expect(egressCounter.Value()).To(BeNumerically("==", 2))
+			})
+
+			It("delimits messages with newlines with non-transparent framing", func() {
+				w := newWriter(syslog.FramingNonTransparent, syslog.NewlineSplit)
+				Expect(w.Write(context.Background(), buildLogEnvelope("APP", "2", "line 1\nline 2", loggregator_v2.Log_OUT))).To(Succeed())
+
+				Expect(readAll(w)).To(Equal(header + "line 1\n" + header + "line 2\n"))
+			})
+
+			It("keeps one message per payload with non-transparent framing and escaped newlines", func() {
+				w := newWriter(syslog.FramingNonTransparent, syslog.NewlineEscape)
+				Expect(w.Write(context.Background(), buildLogEnvelope("APP", "2", "line 1\nline 2\n", loggregator_v2.Log_OUT))).To(Succeed())
+
+				Expect(readAll(w)).To(Equal(header + `line 1\nline 2` + "\n"))
+			})
+
+			It("terminates metric messages with a newline with non-transparent framing", func() {
+				w := newWriter(syslog.FramingNonTransparent, "")
+				Expect(w.Write(context.Background(), buildTimerEnvelope("1"))).To(Succeed())
+
+				Expect(readAll(w)).To(HaveSuffix("\n"))
+			})
+		})
+
 		It("writes gauge metrics to the tcp drain", func() {
 			env := buildGaugeEnvelope("1")
-			Expect(writer.Write(env)).To(Succeed())
+			Expect(writer.Write(context.Background(), env)).To(Succeed())
 
 			conn, err := listener.Accept()
 			Expect(err).ToNot(HaveOccurred())
@@ -125,7 +190,7 @@ var _ = Describe("TCPWriter", func() {
 
 		It("writes counter metrics to tcp drain", func() {
 			env := buildCounterEnvelope("1")
-			Expect(writer.Write(env)).To(Succeed())
+			Expect(writer.Write(context.Background(), env)).To(Succeed())
 
 			conn, err := listener.Accept()
 			Expect(err).ToNot(HaveOccurred())
@@ -141,7 +206,7 @@ var _ = Describe("TCPWriter", func() {
 
 		It("strips null termination char from message", func() {
 			env := buildLogEnvelope("OTHER", "1", "no null `\x00` please", loggregator_v2.Log_OUT)
-			Expect(writer.Write(env)).To(Succeed())
+			Expect(writer.Write(context.Background(), env)).To(Succeed())
 
 			conn, err := listener.Accept()
 			Expect(err).ToNot(HaveOccurred())
@@ -156,7 +221,7 @@ var _ = Describe("TCPWriter", func() {
 
 		It("emits an egress metric for each message", func() {
 			env := buildLogEnvelope("OTHER", "1", "no null `\x00` please", loggregator_v2.Log_OUT)
-			err := writer.Write(env)
+			err := writer.Write(context.Background(), env)
 			Expect(err).To(BeNil())
 
 			Expect(egressCounter.Value()).To(BeNumerically("==", 1))
@@ -164,7 +229,7 @@ var _ = Describe("TCPWriter", func() {
 
 		It("replaces spaces with dashes in the process ID", func() {
 			env := buildLogEnvelope("MY TASK", "2", "just a test", loggregator_v2.Log_OUT)
-			Expect(writer.Write(env)).To(Succeed())
+			Expect(writer.Write(context.Background(), env)).To(Succeed())
 
 			conn, err := listener.Accept()
 			Expect(err).ToNot(HaveOccurred())
@@ -179,6 +244,30 @@ var _ = Describe("TCPWriter", func() {
 		})
 	})
 
+	Describe("when the write context is done", func() {
+		It("returns the context error without connecting", func() {
+			writer := syslog.NewTCPWriter(
+				binding,
+				netConf,
+				&metricsHelpers.SpyMetric{},
+				syslog.NewConverter(),
+			)
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			env := buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_OUT)
+			Expect(writer.Write(ctx, env)).To(MatchError(context.Canceled))
+
+			accepted := make(chan struct{})
+			go func() {
+				if _, err := listener.Accept(); err == nil {
+					close(accepted)
+				}
+			}()
+			Consistently(accepted, 100*time.Millisecond).ShouldNot(BeClosed())
+		})
+	})
+
 	Describe("when write fails to connect", func() {
 		It("write returns an error", func() {
 			env := buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_OUT)
@@ -193,7 +282,7 @@ var _ = Describe("TCPWriter", func() {
 
 			errs := make(chan error, 1)
 			go func() {
-				errs <- writer.Write(env)
+				errs <- writer.Write(context.Background(), env)
 			}()
 			Eventually(errs).Should(Receive(HaveOccurred()))
 		})
@@ -218,7 +307,7 @@ var _ = Describe("TCPWriter", func() {
 
 				By("writing to establish connection")
 				logEnv := buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_OUT)
-				err = writer.Write(logEnv)
+				err = writer.Write(context.Background(), logEnv)
 				Expect(err).ToNot(HaveOccurred())
 
 				conn, err = listener.Accept()
@@ -1,7 +1,9 @@
 package syslog
 
 import (
+	"context"
 	"crypto/tls"
+	"io"
 	"net"
 	"time"
 
@@ -19,6 +21,20 @@ type NetworkTimeoutConfig struct {
 	Keepalive    time.Duration
 	DialTimeout  time.Duration
 	WriteTimeout time.Duration
+
+	// handshakes records the TLS handshakes of writers created by a
+	// WriterFactory.
+	handshakes *handshakeMetrics
+}
+
+// DefaultNetworkTimeoutConfig returns the timeouts used by the syslog
+// agent.
+func DefaultNetworkTimeoutConfig() NetworkTimeoutConfig {
+	return NetworkTimeoutConfig{
+		Keepalive:    10 * time.Second,
+		DialTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
 }
 
 func NewTLSWriter(
@@ -34,8 +50,16 @@ func NewTLSWriter(
 		KeepAlive: netConf.Keepalive,
 	}
 
-	df := func(addr string) (net.Conn, error) {
-		return tls.DialWithDialer(dialer, "tcp", addr, tlsConf)
+	df := func(ctx context.Context, addr string) (net.Conn, error) {
+		conn, err := dialTLS(ctx, dialer, tlsConf, addr, netConf.handshakes)
+		if err != nil {
+			return nil, err
+		}
+		// Syslog drains do not send data, but TLS 1.3 servers send the
+		// session tickets for resumption after the handshake and they are
+		// only processed when reading.
+		go io.Copy(io.Discard, conn) //nolint:errcheck
+		return conn, nil
 	}
 
 	w := &TLSWriter{
@@ -48,6 +72,7 @@ func NewTLSWriter(
 			scheme:          "syslog-tls",
 			egressMetric:    egressMetric,
 			syslogConverter: syslogConverter,
+			framing:         binding.Framing,
 		},
 	}
 
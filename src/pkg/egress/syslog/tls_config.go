@@ -0,0 +1,143 @@
+package syslog
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sync"
+
+	"code.cloudfoundry.org/tlsconfig"
+)
+
+// NewDrainTLSConfigs returns the TLS configs for internal and external
+// drains that trust the given CAs. If cipherSuites is not empty external
+// drains are restricted to TLS 1.2 with these cipher suites.
+func NewDrainTLSConfigs(trustedCAs *x509.CertPool, cipherSuites []uint16, skipCertVerify bool) (*tls.Config, *tls.Config, error) {
+	internalTlsConfig, err := tlsconfig.Build(
+		tlsconfig.WithInternalServiceDefaults(),
+	).Client(
+		tlsconfig.WithAuthority(trustedCAs),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	externalTlsConfig, err := tlsconfig.Build(
+		tlsconfig.WithExternalServiceDefaults(),
+	).Client(
+		tlsconfig.WithAuthority(trustedCAs),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(cipherSuites) > 0 {
+		externalTlsConfig, err = tlsconfig.Build(
+			func(c *tls.Config) error {
+				c.MinVersion = tls.VersionTLS12
+				c.MaxVersion = tls.VersionTLS12
+				c.CipherSuites = cipherSuites
+				return nil
+			},
+		).Client(
+			tlsconfig.WithAuthority(trustedCAs),
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	internalTlsConfig.InsecureSkipVerify = skipCertVerify //nolint:gosec
+	externalTlsConfig.InsecureSkipVerify = skipCertVerify //nolint:gosec
+
+	return internalTlsConfig, externalTlsConfig, nil
+}
+
+// drainCAs logs the CA that verified the server certificate of each drain
+// host whenever it changes. When trusting an old and a new CA during a CA
+// rotation, the logs show which drain receivers have moved to the new CA.
+// A host is forgotten once the contexts of all its bindings are done.
+type drainCAs struct {
+	mu  sync.Mutex
+	cas map[string]*drainCA
+}
+
+type drainCA struct {
+	ca       string
+	bindings int
+}
+
+func newDrainCAs() *drainCAs {
+	return &drainCAs{cas: make(map[string]*drainCA)}
+}
+
+// verifyConnection returns a tls.Config VerifyConnection func that records
+// the CA that verified the server certificate of host until ctx is done.
+// Connections that skip certificate verification are not recorded.
+func (d *drainCAs) verifyConnection(ctx context.Context, host string) func(tls.ConnectionState) error {
+	d.acquire(ctx, host)
+
+	return func(cs tls.ConnectionState) error {
+		if len(cs.VerifiedChains) == 0 || len(cs.VerifiedChains[0]) == 0 {
+			return nil
+		}
+		chain := cs.VerifiedChains[0]
+		ca := DescribeCA(chain[len(chain)-1])
+
+		d.mu.Lock()
+		dc, ok := d.cas[host]
+		if !ok {
+			d.mu.Unlock()
+			return nil
+		}
+		prev := dc.ca
+		dc.ca = ca
+		d.mu.Unlock()
+
+		if prev != ca {
+			log.Printf("server certificate of syslog drain %s verified by CA %s", host, ca)
+		}
+		return nil
+	}
+}
+
+func (d *drainCAs) acquire(ctx context.Context, host string) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	d.mu.Lock()
+	dc, ok := d.cas[host]
+	if !ok {
+		dc = &drainCA{}
+		d.cas[host] = dc
+	}
+	dc.bindings++
+	d.mu.Unlock()
+
+	context.AfterFunc(ctx, func() {
+		d.release(host)
+	})
+}
+
+func (d *drainCAs) release(host string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	dc := d.cas[host]
+	dc.bindings--
+	if dc.bindings == 0 {
+		delete(d.cas, host)
+	}
+}
+
+// DescribeCA returns the subject and the SHA-256 fingerprint of the CA
+// certificate, which tells apart an old and a new CA with the same subject.
+func DescribeCA(ca *x509.Certificate) string {
+	sum := sha256.Sum256(ca.Raw)
+	return fmt.Sprintf("%q (sha256:%s)", ca.Subject.String(), hex.EncodeToString(sum[:]))
+}
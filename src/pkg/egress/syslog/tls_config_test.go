@@ -0,0 +1,133 @@
+package syslog_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
+	"code.cloudfoundry.org/loggregator-agent-release/src/internal/testhelper"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("Drain CAs", func() {
+	var (
+		oldCerts = testhelper.GenerateCerts("oldCA")
+		newCerts = testhelper.GenerateCerts("newCA")
+	)
+
+	readPEM := func(file string) []byte {
+		b, err := os.ReadFile(file)
+		Expect(err).ToNot(HaveOccurred())
+		return b
+	}
+
+	readCA := func(file string) *x509.Certificate {
+		block, _ := pem.Decode(readPEM(file))
+		Expect(block).ToNot(BeNil())
+		ca, err := x509.ParseCertificate(block.Bytes)
+		Expect(err).ToNot(HaveOccurred())
+		return ca
+	}
+
+	It("describes a CA by its subject and fingerprint", func() {
+		ca := readCA(newCerts.CA())
+
+		Expect(syslog.DescribeCA(ca)).To(MatchRegexp(`^"CN=newCA.*" \(sha256:[0-9a-f]{64}\)$`))
+		Expect(syslog.DescribeCA(ca)).ToNot(Equal(syslog.DescribeCA(readCA(oldCerts.CA()))))
+	})
+
+	Context("with a drain", func() {
+		var (
+			logs *gbytes.Buffer
+			port string
+			f    syslog.WriterFactory
+		)
+
+		BeforeEach(func() {
+			logs = gbytes.NewBuffer()
+			log.SetOutput(io.MultiWriter(GinkgoWriter, logs))
+			DeferCleanup(log.SetOutput, GinkgoWriter)
+
+			serverCert, err := tls.LoadX509KeyPair(newCerts.Cert("localhost"), newCerts.Key("localhost"))
+			Expect(err).ToNot(HaveOccurred())
+			listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{serverCert}}) //nolint:gosec
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(listener.Close)
+			go func(listener net.Listener) {
+				for {
+					conn, err := listener.Accept()
+					if err != nil {
+						return
+					}
+					go func() {
+						defer conn.Close()
+						io.Copy(io.Discard, conn) //nolint:errcheck
+					}()
+				}
+			}(listener)
+
+			pool := x509.NewCertPool()
+			for _, f := range []string{oldCerts.CA(), newCerts.CA()} {
+				Expect(pool.AppendCertsFromPEM(readPEM(f))).To(BeTrue())
+			}
+			internal, external, err := syslog.NewDrainTLSConfigs(pool, nil, false)
+			Expect(err).ToNot(HaveOccurred())
+			f = syslog.NewWriterFactory(internal, external, syslog.NetworkTimeoutConfig{
+				DialTimeout:  time.Second,
+				WriteTimeout: time.Second,
+			}, metricsHelpers.NewMetricsRegistry())
+
+			_, port, err = net.SplitHostPort(listener.Addr().String())
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		write := func(ctx context.Context) {
+			u, err := url.Parse(fmt.Sprintf("syslog-tls://localhost:%s", port))
+			Expect(err).ToNot(HaveOccurred())
+			w, err := f.NewWriter(&syslog.URLBinding{Context: ctx, URL: u, AppID: "some-app"})
+			Expect(err).ToNot(HaveOccurred())
+			defer w.Close()
+
+			Expect(w.Write(context.Background(), buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_OUT))).To(Succeed())
+		}
+
+		It("trusts several CAs and logs the CA that verified a drain", func() {
+			write(context.Background())
+
+			Eventually(logs).Should(gbytes.Say(`server certificate of syslog drain localhost:%s verified by CA "CN=newCA`, port))
+		})
+
+		It("logs the CA again once the bindings of the drain were removed", func() {
+			ctx1, cancel1 := context.WithCancel(context.Background())
+			write(ctx1)
+			Eventually(logs).Should(gbytes.Say(`verified by CA "CN=newCA`))
+
+			ctx2, cancel2 := context.WithCancel(context.Background())
+			write(ctx2)
+			Consistently(logs, 100*time.Millisecond).ShouldNot(gbytes.Say(`verified by CA`))
+
+			cancel1()
+			cancel2()
+			Eventually(func() *gbytes.Buffer {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				write(ctx)
+				return logs
+			}).Should(gbytes.Say(`verified by CA "CN=newCA`))
+		})
+	})
+})
@@ -0,0 +1,148 @@
+package syslog
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"net"
+	"strconv"
+	"time"
+
+	metrics "code.cloudfoundry.org/go-metric-registry"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
+	"github.com/valyala/fasthttp"
+)
+
+// sessionCacheSize is the number of TLS sessions kept for resumption
+// across all drains.
+const sessionCacheSize = 1000
+
+// drainSessionCache is the view of a shared session cache for a drain.
+// Sessions are only resumed by writers of drains with the same URL and TLS
+// settings, so that a session established with the client certificate or
+// CA of one binding is never resumed by another binding to the same host.
+type drainSessionCache struct {
+	prefix string
+	cache  tls.ClientSessionCache
+}
+
+func newDrainSessionCache(cache tls.ClientSessionCache, ub *URLBinding) drainSessionCache {
+	h := sha256.New()
+	for _, b := range [][]byte{
+		[]byte(egress.DrainHash(ub.URL.String())),
+		ub.Certificate,
+		ub.CA,
+		[]byte(ub.CAFingerprint),
+		[]byte(strconv.FormatBool(ub.CAFingerprintOnly)),
+		[]byte(strconv.FormatBool(ub.InternalTls)),
+	} {
+		// Prefix each value with its length so that values cannot run
+		// into each other.
+		_ = binary.Write(h, binary.BigEndian, uint64(len(b)))
+		h.Write(b)
+	}
+
+	return drainSessionCache{
+		prefix: hex.EncodeToString(h.Sum(nil)[:16]) + "/",
+		cache:  cache,
+	}
+}
+
+func (c drainSessionCache) Get(sessionKey string) (*tls.ClientSessionState, bool) {
+	return c.cache.Get(c.prefix + sessionKey)
+}
+
+func (c drainSessionCache) Put(sessionKey string, cs *tls.ClientSessionState) {
+	c.cache.Put(c.prefix+sessionKey, cs)
+}
+
+// handshakeMetrics records the TLS handshakes with a drain. The resumption
+// rate is the rate of resumed handshakes of all handshakes, and the mean
+// handshake duration is drain_tls_handshake_seconds divided by the number
+// of handshakes.
+type handshakeMetrics struct {
+	full    metrics.Counter
+	resumed metrics.Counter
+	seconds metrics.Counter
+}
+
+func newHandshakeMetrics(m MetricClient, drainHash string) *handshakeMetrics {
+	counter := func(resumed string) metrics.Counter {
+		return m.NewCounter(
+			"drain_tls_handshakes",
+			"Total number of TLS handshakes with a drain by whether a session was resumed.",
+			metrics.WithMetricLabels(map[string]string{"drain_hash": drainHash, "resumed": resumed}),
+		)
+	}
+
+	return &handshakeMetrics{
+		full:    counter("false"),
+		resumed: counter("true"),
+		seconds: m.NewCounter(
+			"drain_tls_handshake_seconds",
+			"Total time spent in TLS handshakes with a drain.",
+			metrics.WithMetricLabels(map[string]string{"drain_hash": drainHash}),
+		),
+	}
+}
+
+// observe records a handshake. It does nothing if h is nil.
+func (h *handshakeMetrics) observe(d time.Duration, resumed bool) {
+	if h == nil {
+		return
+	}
+	if resumed {
+		h.resumed.Add(1)
+	} else {
+		h.full.Add(1)
+	}
+	h.seconds.Add(d.Seconds())
+}
+
+// dialTLS connects to addr and performs the TLS handshake, which is
+// recorded in h. Sessions are resumed if cfg has a ClientSessionCache.
+func dialTLS(ctx context.Context, dialer *net.Dialer, cfg *tls.Config, addr string, h *handshakeMetrics) (net.Conn, error) {
+	raw, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		cfg = cfg.Clone()
+		cfg.ServerName = host
+	}
+
+	conn := tls.Client(raw, cfg)
+	start := time.Now()
+	if err := conn.HandshakeContext(ctx); err != nil {
+		raw.Close()
+		return nil, err
+	}
+	h.observe(time.Since(start), conn.ConnectionState().DidResume)
+
+	return conn, nil
+}
+
+// fasthttpDialTLS returns a fasthttp dial func that establishes TLS
+// connections with dialTLS. The handshake must complete within
+// handshakeTimeout.
+func fasthttpDialTLS(cfg *tls.Config, handshakeTimeout time.Duration, h *handshakeMetrics) fasthttp.DialFunc {
+	dialer := &net.Dialer{Timeout: fasthttp.DefaultDialTimeout}
+	return func(addr string) (net.Conn, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), handshakeTimeout)
+		defer cancel()
+
+		conn, err := dialTLS(ctx, dialer, cfg, addr, h)
+		if errors.Is(egress.DialError(err), egress.ErrDialTimeout) {
+			return nil, fasthttp.ErrDialTimeout
+		}
+		return conn, err
+	}
+}
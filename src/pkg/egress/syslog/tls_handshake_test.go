@@ -0,0 +1,139 @@
+package syslog_test
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
+	"code.cloudfoundry.org/loggregator-agent-release/src/internal/testhelper"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TLS session resumption", func() {
+	var (
+		testCerts = testhelper.GenerateCerts("loggregatorCA")
+		env       = buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_OUT)
+
+		sm *metricsHelpers.SpyMetricsRegistry
+		f  syslog.WriterFactory
+	)
+
+	BeforeEach(func() {
+		sm = metricsHelpers.NewMetricsRegistry()
+		skipVerify := &tls.Config{InsecureSkipVerify: true} //nolint:gosec
+		f = syslog.NewWriterFactory(skipVerify, skipVerify.Clone(), syslog.DefaultNetworkTimeoutConfig(), sm)
+	})
+
+	serverConfig := func() *tls.Config {
+		cert, err := tls.LoadX509KeyPair(testCerts.Cert("metron"), testCerts.Key("metron"))
+		Expect(err).ToNot(HaveOccurred())
+		return &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+
+	handshakes := func(u string, resumed string) func() float64 {
+		tags := map[string]string{"drain_hash": egress.DrainHash(u), "resumed": resumed}
+		return func() float64 {
+			if !sm.HasMetric("drain_tls_handshakes", tags) {
+				return 0
+			}
+			return sm.GetMetric("drain_tls_handshakes", tags).Value()
+		}
+	}
+
+	// writeOnce writes an envelope with a new writer for the binding, as
+	// after the bindings of the drain were refreshed.
+	writeOnce := func(ub *syslog.URLBinding) {
+		w, err := f.NewWriter(ub)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(w.Write(context.Background(), env)).To(Succeed())
+		Expect(w.Close()).To(Succeed())
+	}
+
+	It("resumes sessions of syslog-tls drains across writers", func() {
+		listener, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig())
+		Expect(err).ToNot(HaveOccurred())
+		defer listener.Close()
+		go func() {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				go io.Copy(io.Discard, conn) //nolint:errcheck
+			}
+		}()
+
+		u := fmt.Sprintf("syslog-tls://%s", listener.Addr())
+		parsed, err := url.Parse(u)
+		Expect(err).ToNot(HaveOccurred())
+		ub := &syslog.URLBinding{URL: parsed, Context: context.Background()}
+
+		writeOnce(ub)
+		Expect(handshakes(u, "false")()).To(Equal(1.0))
+		Expect(sm.GetMetric("drain_tls_handshake_seconds", map[string]string{"drain_hash": egress.DrainHash(u)}).Value()).To(BeNumerically(">", 0))
+
+		Eventually(func() float64 {
+			writeOnce(ub)
+			return handshakes(u, "true")()
+		}).Should(BeNumerically(">", 0))
+	})
+
+	It("resumes sessions of https drains", func() {
+		server := httptest.NewUnstartedServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+		server.TLS = serverConfig()
+		server.StartTLS()
+		defer server.Close()
+
+		parsed, err := url.Parse(server.URL)
+		Expect(err).ToNot(HaveOccurred())
+		ub := &syslog.URLBinding{URL: parsed, Context: context.Background()}
+
+		Eventually(func() float64 {
+			server.CloseClientConnections()
+			writeOnce(ub)
+			return handshakes(server.URL, "true")()
+		}).Should(BeNumerically(">", 0))
+		Expect(handshakes(server.URL, "false")()).To(BeNumerically(">", 0))
+	})
+
+	It("does not resume sessions of other bindings to the same drain", func() {
+		listener, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig())
+		Expect(err).ToNot(HaveOccurred())
+		defer listener.Close()
+		go func() {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				go io.Copy(io.Discard, conn) //nolint:errcheck
+			}
+		}()
+
+		u := fmt.Sprintf("syslog-tls://%s", listener.Addr())
+		parsed, err := url.Parse(u)
+		Expect(err).ToNot(HaveOccurred())
+		ub := &syslog.URLBinding{URL: parsed, Context: context.Background()}
+		internal := &syslog.URLBinding{URL: parsed, Context: context.Background(), InternalTls: true}
+
+		Eventually(func() float64 {
+			writeOnce(ub)
+			return handshakes(u, "true")()
+		}).Should(BeNumerically(">", 0))
+
+		resumed, full := handshakes(u, "true")(), handshakes(u, "false")()
+		writeOnce(internal)
+		Expect(handshakes(u, "true")()).To(Equal(resumed))
+		Expect(handshakes(u, "false")()).To(Equal(full + 1))
+	})
+})
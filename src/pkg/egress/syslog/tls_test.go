@@ -2,6 +2,7 @@ package syslog_test
 
 import (
 	"bufio"
+	"context"
 	"crypto/tls"
 	"fmt"
 	"net"
@@ -80,7 +81,7 @@ var _ = Describe("TLSWriter", func() {
 			Expect(err).ToNot(HaveOccurred())
 		}()
 
-		Expect(writer.Write(env)).To(Succeed())
+		Expect(writer.Write(context.Background(), env)).To(Succeed())
 
 		buf := bufio.NewReader(conn)
 
@@ -14,10 +14,29 @@ type URLBinding struct {
 	Hostname     string
 	OmitMetadata bool
 	InternalTls  bool
+	Format       DrainFormat
+	Template     string
+	Newline      NewlinePolicy
+	Framing      Framing
+	Metadata     DrainMetadata
 	URL          *url.URL
 	PrivateKey   []byte
 	Certificate  []byte
 	CA           []byte
+	// CAFingerprint and CAFingerprintOnly pin the server certificate of
+	// the drain. See Binding.
+	CAFingerprint     string
+	CAFingerprintOnly bool
+	// StreamStructuredData and Severity configure the stream structured
+	// data and severities of log messages. See Binding.
+	StreamStructuredData bool
+	Severity             SeverityMapping
+	// ProcIDFormat and MsgIDFormat compose the PROCID and MSGID of syslog
+	// messages. See FieldFormat.
+	ProcIDFormat FieldFormat
+	MsgIDFormat  FieldFormat
+	// UTF8 selects whether log payloads are validated and marked as UTF-8.
+	UTF8 UTF8Mode
 }
 
 // Scheme is a convenience wrapper around the *url.URL Scheme field
@@ -25,7 +44,9 @@ func (u *URLBinding) Scheme() string {
 	return u.URL.Scheme
 }
 
-func buildBinding(c context.Context, b Binding) (*URLBinding, error) {
+// NewURLBinding returns the URLBinding for the drain of the binding. The
+// context is used to stop the writer created for the binding.
+func NewURLBinding(c context.Context, b Binding) (*URLBinding, error) {
 	url, err := url.Parse(b.Drain.Url)
 	if err != nil {
 		return nil, err
@@ -35,12 +56,26 @@ func buildBinding(c context.Context, b Binding) (*URLBinding, error) {
 		AppID:        b.AppId,
 		OmitMetadata: b.OmitMetadata,
 		InternalTls:  b.InternalTls,
+		Format:       b.Format,
+		Template:     b.Template,
+		Newline:      b.Newline,
+		Framing:      b.Framing,
+		Metadata:     b.Drain.Metadata,
 		URL:          url,
 		Hostname:     b.Hostname,
 		Context:      c,
 		PrivateKey:   []byte(b.Drain.Credentials.Key),
 		Certificate:  []byte(b.Drain.Credentials.Cert),
 		CA:           []byte(b.Drain.Credentials.CA),
+
+		CAFingerprint:     b.CAFingerprint,
+		CAFingerprintOnly: b.CAFingerprintOnly,
+
+		StreamStructuredData: b.StreamStructuredData,
+		Severity:             b.Severity,
+		ProcIDFormat:         b.ProcIDFormat,
+		MsgIDFormat:          b.MsgIDFormat,
+		UTF8:                 b.UTF8,
 	}
 
 	return u, nil
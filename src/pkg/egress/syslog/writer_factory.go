@@ -1,18 +1,55 @@
+// Package syslog writes envelopes to syslog drains.
+//
+// A WriterFactory creates the writer for a drain based on the scheme of the
+// drain URL (syslog, syslog-tls, https, https-batch, forward, forward-tls or
+// file) and the drain parameters, and wraps it to retry failed writes:
+//
+//	internal, external, err := syslog.NewDrainTLSConfigs(trustedCAs, nil, false)
+//	if err != nil {
+//		return err
+//	}
+//	f := syslog.NewWriterFactory(internal, external, syslog.DefaultNetworkTimeoutConfig(), m)
+//	w, err := f.NewDrainWriter(ctx, syslog.Binding{
+//		AppId: appID,
+//		Drain: syslog.Drain{Url: "syslog-tls://logs.example.com:6514"},
+//	})
+//
+// The SyslogConnector additionally buffers writes in a diode, reports
+// dropped envelopes and filters envelopes by drain type.
 package syslog
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"net/url"
+	"strconv"
 
 	metrics "code.cloudfoundry.org/go-metric-registry"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
+	egress_v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
 )
 
-type metricClient interface {
+// MetricClient is used to create the egress metrics of drain writers.
+type MetricClient interface {
 	NewCounter(name, helpText string, o ...metrics.MetricOption) metrics.Counter
+	NewGauge(name, helpText string, o ...metrics.MetricOption) metrics.Gauge
 }
 
+// DrainFormat is the wire format a drain writer emits. The zero value is
+// RFC 5424 syslog.
+type DrainFormat string
+
+const (
+	FormatRFC5424   DrainFormat = ""
+	FormatSplunkHEC DrainFormat = "splunk-hec"
+	FormatDatadog   DrainFormat = "datadog"
+	FormatLoki      DrainFormat = "loki"
+	// FormatJSON writes one JSON object per envelope, see
+	// MarshalJSONEnvelope. It is only available for aggregate drains.
+	FormatJSON DrainFormat = "json"
+)
+
 type WriterFactoryError struct {
 	Message string
 	URL     *url.URL
@@ -40,37 +77,152 @@ type WriterFactory struct {
 	internalTlsConfig *tls.Config
 	externalTlsConfig *tls.Config
 	netConf           NetworkTimeoutConfig
-	m                 metricClient
+	m                 MetricClient
+	messageTemplates  MessageTemplates
+	fileDrainDir      string
+	loopMarker        bool
+	writeErrors       map[string]metrics.Counter
+	errorEvents       *egress.ErrorEvents
+	deliveries        *Deliveries
+	egressByType      map[string]*egress_v2.EgressCounter
+	drainCAs          *drainCAs
+	sessionCache      tls.ClientSessionCache
+	maxInFlight       int
+	inFlightLimiter   *InFlightLimiter
+}
+
+// WriterFactoryOption allows a writer factory to be customized.
+type WriterFactoryOption func(*WriterFactory)
+
+// WithMessageTemplates configures the named message templates drains can
+// select with the template URL parameter.
+func WithMessageTemplates(t MessageTemplates) WriterFactoryOption {
+	return func(f *WriterFactory) {
+		f.messageTemplates = t
+	}
+}
+
+// WithFileDrainDir configures the directory file drains must write to.
+// Defaults to DefaultFileDrainDir.
+func WithFileDrainDir(dir string) WriterFactoryOption {
+	return func(f *WriterFactory) {
+		f.fileDrainDir = dir
+	}
+}
+
+// WithLoopMarkers adds the loop marker to the log messages of all drains so
+// that a LoopDetector can detect drains that write back into the platform.
+func WithLoopMarkers() WriterFactoryOption {
+	return func(f *WriterFactory) {
+		f.loopMarker = true
+	}
+}
+
+// WithErrorEvents records failed write attempts of all drains in e.
+func WithErrorEvents(e *egress.ErrorEvents) WriterFactoryOption {
+	return func(f *WriterFactory) {
+		f.errorEvents = e
+	}
+}
+
+// WithDeliveries records the successful deliveries to the drains of app
+// bindings in d.
+func WithDeliveries(d *Deliveries) WriterFactoryOption {
+	return func(f *WriterFactory) {
+		f.deliveries = d
+	}
 }
 
-func NewWriterFactory(internalTlsConfig *tls.Config, externalTlsConfig *tls.Config, netConf NetworkTimeoutConfig, m metricClient) WriterFactory {
-	return WriterFactory{
+// WithMaxInFlightRequests limits the concurrent batch requests of every
+// https-batch drain to perDrain and of all https-batch drains together to
+// global. Drains can lower their limit with the max-in-flight parameter.
+// With a per drain limit above 1 batches may arrive out of order.
+// A global limit of zero disables the global limit and a per drain limit
+// of zero keeps the default of 1.
+func WithMaxInFlightRequests(perDrain, global int) WriterFactoryOption {
+	return func(f *WriterFactory) {
+		if perDrain > 0 {
+			f.maxInFlight = perDrain
+		}
+		f.inFlightLimiter = nil
+		if global > 0 {
+			f.inFlightLimiter = NewInFlightLimiter(global)
+		}
+	}
+}
+
+// NewWriterFactory returns a WriterFactory. Drains with the
+// ssl-strict-internal parameter use internalTlsConfig and all other drains
+// use externalTlsConfig.
+func NewWriterFactory(internalTlsConfig *tls.Config, externalTlsConfig *tls.Config, netConf NetworkTimeoutConfig, m MetricClient, opts ...WriterFactoryOption) WriterFactory {
+	f := WriterFactory{
 		internalTlsConfig: internalTlsConfig,
 		externalTlsConfig: externalTlsConfig,
 		netConf:           netConf,
 		m:                 m,
+		fileDrainDir:      DefaultFileDrainDir,
+		drainCAs:          newDrainCAs(),
+		sessionCache:      tls.NewLRUClientSessionCache(sessionCacheSize),
+		maxInFlight:       1,
 	}
+	for _, o := range opts {
+		o(&f)
+	}
+
+	f.writeErrors = make(map[string]metrics.Counter, len(egress.ErrorReasons))
+	for _, r := range egress.ErrorReasons {
+		f.writeErrors[r] = m.NewCounter(
+			"drain_write_errors",
+			"Total number of failed drain write attempts by reason.",
+			metrics.WithMetricLabels(map[string]string{"reason": r}),
+		)
+	}
+
+	f.egressByType = map[string]*egress_v2.EgressCounter{
+		egress_v2.DestinationSyslog: egress_v2.NewEgressCounter(m, egress_v2.DestinationSyslog),
+		egress_v2.DestinationHTTPS:  egress_v2.NewEgressCounter(m, egress_v2.DestinationHTTPS),
+	}
+	return f
 }
 
-func (f WriterFactory) NewWriter(ub *URLBinding) (egress.WriteCloser, error) {
-	tlsCfg := f.externalTlsConfig.Clone()
-	if ub.InternalTls {
-		tlsCfg = f.internalTlsConfig.Clone()
+// egressCounter returns the counter of the destination class of the drain
+// of ub or nil for file drains, which are not counted.
+func (f WriterFactory) egressCounter(ub *URLBinding) *egress_v2.EgressCounter {
+	switch ub.URL.Scheme {
+	case "syslog", "syslog-tls", "forward", "forward-tls":
+		return f.egressByType[egress_v2.DestinationSyslog]
+	case "https", "https-batch":
+		return f.egressByType[egress_v2.DestinationHTTPS]
+	default:
+		return nil
 	}
-	if len(ub.Certificate) > 0 && len(ub.PrivateKey) > 0 {
-		cert, err := tls.X509KeyPair(ub.Certificate, ub.PrivateKey)
-		if err != nil {
-			err = NewWriterFactoryErrorf(ub.URL, "failed to load certificate: %s", err.Error())
-			return nil, err
-		}
-		tlsCfg.Certificates = []tls.Certificate{cert}
+}
+
+// writeErrorHandler returns the handler for failed write attempts to the
+// drain of ub. It counts them by reason and records them as error events.
+func (f WriterFactory) writeErrorHandler(ub *URLBinding) func(error) {
+	drain := ub.URL.String()
+	return func(err error) {
+		f.writeErrors[egress.ErrorReason(err)].Add(1)
+		f.errorEvents.Record("drain_write", err, drain)
 	}
-	if len(ub.CA) > 0 {
-		ok := tlsCfg.RootCAs.AppendCertsFromPEM(ub.CA)
-		if !ok {
-			err := NewWriterFactoryErrorf(ub.URL, "failed to load root CA")
-			return nil, err
-		}
+}
+
+// NewDrainWriter returns the writer for the drain of the binding. The
+// writer is stopped when ctx is done.
+func (f WriterFactory) NewDrainWriter(ctx context.Context, b Binding) (egress.WriteCloser, error) {
+	ub, err := NewURLBinding(ctx, b)
+	if err != nil {
+		return nil, err
+	}
+	return f.NewWriter(ub)
+}
+
+// NewWriter returns the writer for the URL binding.
+func (f WriterFactory) NewWriter(ub *URLBinding) (egress.WriteCloser, error) {
+	tlsCfg, err := f.tlsConfig(ub)
+	if err != nil {
+		return nil, err
 	}
 
 	drainScope := "app"
@@ -89,46 +241,160 @@ func (f WriterFactory) NewWriter(ub *URLBinding) (egress.WriteCloser, error) {
 			"drain_url":   anonymousURL.String(),
 		}),
 	)
+	if f.deliveries != nil && ub.AppID != "" {
+		egressMetric = deliveryCounter{
+			Counter:  egressMetric,
+			delivery: f.deliveries.track(ub, anonymousURL.String()),
+		}
+	}
+
+	netConf := f.netConf
+	switch ub.URL.Scheme {
+	case "syslog-tls", "https", "https-batch", "forward-tls":
+		netConf.handshakes = newHandshakeMetrics(f.m, egress.DrainHash(ub.URL.String()))
+	}
+
+	if !ub.Newline.Valid() {
+		return nil, NewWriterFactoryErrorf(ub.URL, "unsupported newline policy: %q", ub.Newline)
+	}
+	if !ub.Framing.Valid() {
+		return nil, NewWriterFactoryErrorf(ub.URL, "unsupported framing: %q", ub.Framing)
+	}
+	if !ub.Severity.Valid() {
+		return nil, NewWriterFactoryErrorf(ub.URL, "unsupported severity mapping: %q", ub.Severity)
+	}
+	if !ub.ProcIDFormat.Valid() {
+		return nil, NewWriterFactoryErrorf(ub.URL, "invalid procid format: %q", ub.ProcIDFormat)
+	}
+	if !ub.MsgIDFormat.Valid() {
+		return nil, NewWriterFactoryErrorf(ub.URL, "invalid msgid format: %q", ub.MsgIDFormat)
+	}
+	if !ub.UTF8.Valid() {
+		return nil, NewWriterFactoryErrorf(ub.URL, "unsupported utf8 mode: %q", ub.UTF8)
+	}
 
 	var o []ConverterOption
 	if ub.OmitMetadata {
 		o = append(o, WithoutSyslogMetadata())
 	}
+	if ub.Newline != "" {
+		o = append(o, WithNewlinePolicy(ub.Newline))
+	}
+	if ub.StreamStructuredData {
+		o = append(o, WithStreamStructuredData())
+	}
+	if ub.Severity != "" {
+		o = append(o, WithSeverityMapping(ub.Severity))
+	}
+	if ub.ProcIDFormat != "" {
+		o = append(o, WithProcIDFormat(ub.ProcIDFormat))
+	}
+	if ub.MsgIDFormat != "" {
+		o = append(o, WithMsgIDFormat(ub.MsgIDFormat))
+	}
+	if ub.UTF8 != "" {
+		o = append(o, WithUTF8Mode(ub.UTF8))
+	}
+	if f.loopMarker {
+		o = append(o, WithLoopMarker())
+	}
+	if ub.Template != "" {
+		tmpl, ok := f.messageTemplates.Get(ub.Template)
+		if !ok {
+			return nil, NewWriterFactoryErrorf(ub.URL, "unknown message template: %q", ub.Template)
+		}
+		o = append(o, WithMessageTemplate(tmpl))
+	}
 	converter := NewConverter(o...)
 
+	if ub.Format != FormatRFC5424 {
+		w, err := f.newFormattedWriter(ub, netConf, tlsCfg, egressMetric, converter)
+		if err != nil {
+			return nil, err
+		}
+		return NewRetryWriter(
+			ub,
+			ExponentialDuration,
+			maxRetries,
+			w,
+			WithWriteErrorHandler(f.writeErrorHandler(ub)),
+			WithEgressCounter(f.egressCounter(ub)),
+		)
+	}
+
 	var w egress.WriteCloser
 	switch ub.URL.Scheme {
 	case "https":
 		w = NewHTTPSWriter(
 			ub,
-			f.netConf,
+			netConf,
 			tlsCfg,
 			egressMetric,
 			converter,
 		)
 	case "https-batch":
+		batchAge := f.m.NewGauge(
+			"oldest_unflushed_envelope_age",
+			"Age of the oldest envelope waiting to be sent in a partial batch.",
+			metrics.WithMetricLabels(map[string]string{
+				"unit":        "seconds",
+				"drain_scope": drainScope,
+				"drain_url":   anonymousURL.String(),
+			}),
+		)
+		maxInFlight, err := f.drainMaxInFlight(ub)
+		if err != nil {
+			return nil, err
+		}
+		batchOpts := []Option{
+			WithBatchAgeGauge(batchAge),
+			WithMaxInFlight(maxInFlight),
+		}
+		if f.inFlightLimiter != nil {
+			batchOpts = append(batchOpts, WithInFlightLimiter(f.inFlightLimiter))
+		}
 		w = NewHTTPSBatchWriter(
 			ub,
-			f.netConf,
+			netConf,
 			tlsCfg,
 			egressMetric,
 			converter,
+			batchOpts...,
 		)
 	case "syslog":
 		w = NewTCPWriter(
 			ub,
-			f.netConf,
+			netConf,
 			egressMetric,
 			converter,
 		)
 	case "syslog-tls":
 		w = NewTLSWriter(
 			ub,
-			f.netConf,
+			netConf,
 			tlsCfg,
 			egressMetric,
 			converter,
 		)
+	case "forward", "forward-tls":
+		var forwardTLS *tls.Config
+		if ub.URL.Scheme == "forward-tls" {
+			forwardTLS = tlsCfg
+		}
+		fw, err := NewForwardWriter(ub, netConf, forwardTLS, egressMetric)
+		if err != nil {
+			return nil, err
+		}
+		w = fw
+	case "file":
+		if ub.AppID != "" {
+			return nil, NewWriterFactoryErrorf(ub.URL, "file drains are only supported for aggregate drains")
+		}
+		fw, err := NewFileWriter(ub, f.fileDrainDir, egressMetric)
+		if err != nil {
+			return nil, err
+		}
+		w = fw
 	}
 
 	if w == nil {
@@ -140,5 +406,121 @@ func (f WriterFactory) NewWriter(ub *URLBinding) (egress.WriteCloser, error) {
 		ExponentialDuration,
 		maxRetries,
 		w,
+		WithWriteErrorHandler(f.writeErrorHandler(ub)),
+		WithEgressCounter(f.egressCounter(ub)),
 	)
 }
+
+// drainMaxInFlight returns the limit of concurrent batch requests of the
+// drain of ub, which is the max-in-flight parameter if set.
+func (f WriterFactory) drainMaxInFlight(ub *URLBinding) (int, error) {
+	v := ub.URL.Query().Get("max-in-flight")
+	if v == "" {
+		return f.maxInFlight, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return 0, NewWriterFactoryErrorf(ub.URL, "invalid max-in-flight: %q", v)
+	}
+	if n > f.maxInFlight {
+		return 0, NewWriterFactoryErrorf(ub.URL, "max-in-flight exceeds the limit of %d", f.maxInFlight)
+	}
+	return n, nil
+}
+
+// tlsConfig returns the TLS config for the binding including its client
+// certificate, CA and pins. The CA that verifies the drain is logged when
+// it changes.
+func (f WriterFactory) tlsConfig(ub *URLBinding) (*tls.Config, error) {
+	tlsCfg := f.externalTlsConfig.Clone()
+	if ub.InternalTls {
+		tlsCfg = f.internalTlsConfig.Clone()
+	}
+	tlsCfg.VerifyConnection = f.drainCAs.verifyConnection(ub.Context, ub.URL.Host)
+	tlsCfg.ClientSessionCache = newDrainSessionCache(f.sessionCache, ub)
+	if len(ub.Certificate) > 0 && len(ub.PrivateKey) > 0 {
+		cert, err := tls.X509KeyPair(ub.Certificate, ub.PrivateKey)
+		if err != nil {
+			err = NewWriterFactoryErrorf(ub.URL, "failed to load certificate: %s", err.Error())
+			return nil, err
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	if len(ub.CA) > 0 {
+		ok := tlsCfg.RootCAs.AppendCertsFromPEM(ub.CA)
+		if !ok {
+			err := NewWriterFactoryErrorf(ub.URL, "failed to load root CA")
+			return nil, err
+		}
+	}
+	if ub.CAFingerprint != "" {
+		pins, err := ParseSPKIPins(ub.CAFingerprint)
+		if err != nil {
+			return nil, NewWriterFactoryErrorf(ub.URL, "invalid ca-fingerprint: %s", err)
+		}
+		pins.Apply(tlsCfg, ub.URL.Hostname(), ub.CAFingerprintOnly)
+	}
+	return tlsCfg, nil
+}
+
+// newFormattedWriter returns a writer that emits a format other than RFC
+// 5424. These formats are only available for HTTPS drains, except for the
+// json format which can also be written to file drains.
+func (f WriterFactory) newFormattedWriter(
+	ub *URLBinding,
+	netConf NetworkTimeoutConfig,
+	tlsCfg *tls.Config,
+	egressMetric metrics.Counter,
+	converter *Converter,
+) (egress.WriteCloser, error) {
+	if ub.Format == FormatJSON {
+		if ub.AppID != "" {
+			return nil, NewWriterFactoryErrorf(ub.URL, "format %q is only supported for aggregate drains", ub.Format)
+		}
+		if ub.URL.Scheme == "file" {
+			fw, err := NewFileWriter(ub, f.fileDrainDir, egressMetric)
+			if err != nil {
+				return nil, err
+			}
+			return fw, nil
+		}
+	}
+	if ub.URL.Scheme != "https" && ub.URL.Scheme != "https-batch" {
+		return nil, NewWriterFactoryErrorf(ub.URL, "format %q is not supported for protocol %q", ub.Format, ub.URL.Scheme)
+	}
+
+	switch ub.Format {
+	case FormatSplunkHEC:
+		return NewSplunkHECWriter(
+			ub,
+			netConf,
+			tlsCfg,
+			egressMetric,
+			converter,
+		), nil
+	case FormatDatadog:
+		return NewDatadogWriter(
+			ub,
+			netConf,
+			tlsCfg,
+			egressMetric,
+			converter,
+		), nil
+	case FormatLoki:
+		return NewLokiWriter(
+			ub,
+			netConf,
+			tlsCfg,
+			egressMetric,
+		), nil
+	case FormatJSON:
+		return NewJSONWriter(
+			ub,
+			netConf,
+			tlsCfg,
+			egressMetric,
+		), nil
+	default:
+		return nil, NewWriterFactoryErrorf(ub.URL, "unsupported format: %q", ub.Format)
+	}
+}
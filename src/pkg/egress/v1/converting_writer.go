@@ -0,0 +1,47 @@
+package v1
+
+import (
+	"context"
+	"io"
+
+	"code.cloudfoundry.org/go-loggregator/v10/conversion"
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"google.golang.org/protobuf/proto"
+)
+
+// ConvertingWriter converts v2 envelopes back to dropsonde v1 envelopes and
+// writes them marshalled to a byte writer, so that legacy consumers can be
+// fed from the v2 pipeline. A gauge with several metrics is written as one
+// v1 envelope per metric. Events have no v1 equivalent and are dropped.
+type ConvertingWriter struct {
+	w BatchChainByteWriter
+}
+
+// NewConvertingWriter returns a ConvertingWriter that writes to w.
+func NewConvertingWriter(w BatchChainByteWriter) *ConvertingWriter {
+	return &ConvertingWriter{w: w}
+}
+
+// Write converts the envelope and writes the v1 envelopes. The envelope is
+// copied before it is converted because the conversion modifies it and it
+// is shared with other writers.
+func (c *ConvertingWriter) Write(ctx context.Context, env *loggregator_v2.Envelope) error {
+	for _, v1e := range conversion.ToV1(proto.Clone(env).(*loggregator_v2.Envelope)) {
+		b, err := proto.Marshal(v1e)
+		if err != nil {
+			return err
+		}
+		if err := c.w.Write(ctx, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the byte writer if it is an io.Closer.
+func (c *ConvertingWriter) Close() error {
+	if closer, ok := c.w.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
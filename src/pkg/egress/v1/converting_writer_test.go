@@ -0,0 +1,110 @@
+package v1_test
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	egress "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v1"
+	"github.com/cloudfoundry/sonde-go/events"
+	"google.golang.org/protobuf/proto"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ConvertingWriter", func() {
+	var (
+		conn   net.PacketConn
+		writer *egress.ConvertingWriter
+	)
+
+	BeforeEach(func() {
+		var err error
+		conn, err = net.ListenPacket("udp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		DeferCleanup(conn.Close)
+
+		udp, err := egress.NewUDPWriter(conn.LocalAddr().String())
+		Expect(err).ToNot(HaveOccurred())
+		writer = egress.NewConvertingWriter(udp)
+		DeferCleanup(writer.Close)
+	})
+
+	receive := func() *events.Envelope {
+		buf := make([]byte, 65536)
+		Expect(conn.SetReadDeadline(time.Now().Add(time.Second))).To(Succeed())
+		n, _, err := conn.ReadFrom(buf)
+		Expect(err).ToNot(HaveOccurred())
+
+		var e events.Envelope
+		Expect(proto.Unmarshal(buf[:n], &e)).To(Succeed())
+		return &e
+	}
+
+	It("writes logs as v1 log messages", func() {
+		env := &loggregator_v2.Envelope{
+			Timestamp:  1000,
+			SourceId:   "some-app",
+			InstanceId: "1",
+			Tags:       map[string]string{"source_type": "APP/PROC/WEB", "origin": "some-origin"},
+			Message: &loggregator_v2.Envelope_Log{
+				Log: &loggregator_v2.Log{Payload: []byte("some-message"), Type: loggregator_v2.Log_ERR},
+			},
+		}
+		Expect(writer.Write(context.Background(), env)).To(Succeed())
+
+		e := receive()
+		Expect(e.GetEventType()).To(Equal(events.Envelope_LogMessage))
+		Expect(e.GetOrigin()).To(Equal("some-origin"))
+		Expect(e.GetLogMessage().GetMessage()).To(Equal([]byte("some-message")))
+		Expect(e.GetLogMessage().GetMessageType()).To(Equal(events.LogMessage_ERR))
+		Expect(e.GetLogMessage().GetAppId()).To(Equal("some-app"))
+		Expect(e.GetLogMessage().GetSourceType()).To(Equal("APP/PROC/WEB"))
+		Expect(e.GetLogMessage().GetSourceInstance()).To(Equal("1"))
+
+		Expect(env.Tags).To(HaveKey("origin"))
+	})
+
+	It("writes counters as v1 counter events", func() {
+		Expect(writer.Write(context.Background(), &loggregator_v2.Envelope{
+			SourceId: "some-source",
+			Message: &loggregator_v2.Envelope_Counter{
+				Counter: &loggregator_v2.Counter{Name: "requests", Delta: 2, Total: 10},
+			},
+		})).To(Succeed())
+
+		e := receive()
+		Expect(e.GetEventType()).To(Equal(events.Envelope_CounterEvent))
+		Expect(e.GetCounterEvent().GetName()).To(Equal("requests"))
+		Expect(e.GetCounterEvent().GetTotal()).To(Equal(uint64(10)))
+	})
+
+	It("writes a v1 value metric per gauge metric", func() {
+		Expect(writer.Write(context.Background(), &loggregator_v2.Envelope{
+			SourceId: "some-source",
+			Message: &loggregator_v2.Envelope_Gauge{
+				Gauge: &loggregator_v2.Gauge{Metrics: map[string]*loggregator_v2.GaugeValue{
+					"memory": {Unit: "bytes", Value: 1024},
+					"disk":   {Unit: "bytes", Value: 2048},
+				}},
+			},
+		})).To(Succeed())
+
+		names := []string{receive().GetValueMetric().GetName(), receive().GetValueMetric().GetName()}
+		Expect(names).To(ConsistOf("memory", "disk"))
+	})
+
+	It("drops events", func() {
+		Expect(writer.Write(context.Background(), &loggregator_v2.Envelope{
+			Message: &loggregator_v2.Envelope_Event{
+				Event: &loggregator_v2.Event{Title: "some-title"},
+			},
+		})).To(Succeed())
+
+		Expect(conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))).To(Succeed())
+		_, _, err := conn.ReadFrom(make([]byte, 65536))
+		Expect(err).To(HaveOccurred())
+	})
+})
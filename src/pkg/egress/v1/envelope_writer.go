@@ -1,8 +1,12 @@
 //go:generate hel
 package v1
 
-import "github.com/cloudfoundry/sonde-go/events"
+import (
+	"context"
+
+	"github.com/cloudfoundry/sonde-go/events"
+)
 
 type EnvelopeWriter interface {
-	Write(event *events.Envelope)
+	Write(ctx context.Context, event *events.Envelope)
 }
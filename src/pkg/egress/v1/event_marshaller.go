@@ -1,6 +1,7 @@
 package v1
 
 import (
+	"context"
 	"log"
 	"sync"
 
@@ -16,7 +17,7 @@ type MetricClient interface {
 }
 
 type BatchChainByteWriter interface {
-	Write(message []byte) (err error)
+	Write(ctx context.Context, message []byte) (err error)
 }
 
 type EventMarshaller struct {
@@ -48,7 +49,7 @@ func (m *EventMarshaller) writer() BatchChainByteWriter {
 	return m.byteWriter
 }
 
-func (m *EventMarshaller) Write(envelope *events.Envelope) {
+func (m *EventMarshaller) Write(ctx context.Context, envelope *events.Envelope) {
 	writer := m.writer()
 	if writer == nil {
 		log.Print("EventMarshaller: Write called while byteWriter is nil")
@@ -61,7 +62,7 @@ func (m *EventMarshaller) Write(envelope *events.Envelope) {
 		return
 	}
 
-	err = writer.Write(envelopeBytes)
+	err = writer.Write(ctx, envelopeBytes)
 	if err != nil {
 		log.Printf("writing error: %v", err)
 		return
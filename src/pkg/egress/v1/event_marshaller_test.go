@@ -1,6 +1,8 @@
 package v1_test
 
 import (
+	"context"
+
 	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
 	egress "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v1"
 	"github.com/cloudfoundry/sonde-go/events"
@@ -44,7 +46,7 @@ var _ = Describe("EventMarshaller", func() {
 
 			It("does not panic", func() {
 				Expect(func() {
-					marshaller.Write(envelope)
+					marshaller.Write(context.Background(), envelope)
 				}).ToNot(Panic())
 			})
 		})
@@ -56,7 +58,7 @@ var _ = Describe("EventMarshaller", func() {
 			})
 
 			It("doesn't write the bytes", func() {
-				marshaller.Write(envelope)
+				marshaller.Write(context.Background(), envelope)
 				Consistently(mockChainWriter.WriteCalled).ShouldNot(Receive())
 			})
 		})
@@ -71,7 +73,7 @@ var _ = Describe("EventMarshaller", func() {
 			})
 
 			It("writes messages to the writer", func() {
-				marshaller.Write(envelope)
+				marshaller.Write(context.Background(), envelope)
 				expected, err := proto.Marshal(envelope)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(mockChainWriter.WriteInput.Message).To(Receive(Equal(expected)))
@@ -92,7 +94,7 @@ var _ = Describe("EventMarshaller", func() {
 				Origin:    proto.String("The Negative Zone"),
 				EventType: events.Envelope_LogMessage.Enum(),
 			}
-			marshaller.Write(envelope)
+			marshaller.Write(context.Background(), envelope)
 
 			expected, err := proto.Marshal(envelope)
 			Expect(err).ToNot(HaveOccurred())
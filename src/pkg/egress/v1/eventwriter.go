@@ -1,6 +1,7 @@
 package v1
 
 import (
+	"context"
 	"errors"
 	"sync"
 	"time"
@@ -36,7 +37,7 @@ func (e *EventWriter) EmitEnvelope(envelope *events.Envelope) error {
 	if e.writer == nil {
 		return errors.New("EventWriter: No envelope writer set (see SetWriter)")
 	}
-	e.writer.Write(envelope)
+	e.writer.Write(context.Background(), envelope)
 	return nil
 }
 
@@ -6,12 +6,15 @@
 package v1_test
 
 import (
+	"context"
+
 	"github.com/cloudfoundry/sonde-go/events"
 )
 
 type mockEnvelopeWriter struct {
 	WriteCalled chan bool
 	WriteInput  struct {
+		Ctx   chan context.Context
 		Event chan *events.Envelope
 	}
 }
@@ -19,17 +22,20 @@ type mockEnvelopeWriter struct {
 func newMockEnvelopeWriter() *mockEnvelopeWriter {
 	m := &mockEnvelopeWriter{}
 	m.WriteCalled = make(chan bool, 100)
+	m.WriteInput.Ctx = make(chan context.Context, 100)
 	m.WriteInput.Event = make(chan *events.Envelope, 100)
 	return m
 }
-func (m *mockEnvelopeWriter) Write(event *events.Envelope) {
+func (m *mockEnvelopeWriter) Write(ctx context.Context, event *events.Envelope) {
 	m.WriteCalled <- true
+	m.WriteInput.Ctx <- ctx
 	m.WriteInput.Event <- event
 }
 
 type mockBatchChainByteWriter struct {
 	WriteCalled chan bool
 	WriteInput  struct {
+		Ctx     chan context.Context
 		Message chan []byte
 	}
 	WriteOutput struct {
@@ -40,12 +46,14 @@ type mockBatchChainByteWriter struct {
 func newMockBatchChainByteWriter() *mockBatchChainByteWriter {
 	m := &mockBatchChainByteWriter{}
 	m.WriteCalled = make(chan bool, 100)
+	m.WriteInput.Ctx = make(chan context.Context, 100)
 	m.WriteInput.Message = make(chan []byte, 100)
 	m.WriteOutput.Err = make(chan error, 100)
 	return m
 }
-func (m *mockBatchChainByteWriter) Write(message []byte) (err error) {
+func (m *mockBatchChainByteWriter) Write(ctx context.Context, message []byte) (err error) {
 	m.WriteCalled <- true
+	m.WriteInput.Ctx <- ctx
 	m.WriteInput.Message <- message
 	return <-m.WriteOutput.Err
 }
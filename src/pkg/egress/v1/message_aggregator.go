@@ -1,6 +1,7 @@
 package v1
 
 import (
+	"context"
 	"crypto/sha256"
 	"fmt"
 	"io"
@@ -26,11 +27,11 @@ func NewAggregator(outputWriter EnvelopeWriter) *MessageAggregator {
 	}
 }
 
-func (m *MessageAggregator) Write(envelope *events.Envelope) {
+func (m *MessageAggregator) Write(ctx context.Context, envelope *events.Envelope) {
 	if envelope.GetEventType() == events.Envelope_CounterEvent {
 		envelope = m.handleCounter(envelope)
 	}
-	m.outputWriter.Write(envelope)
+	m.outputWriter.Write(ctx, envelope)
 }
 
 func (m *MessageAggregator) handleCounter(envelope *events.Envelope) *events.Envelope {
@@ -1,6 +1,7 @@
 package v1_test
 
 import (
+	"context"
 	"time"
 
 	egress "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v1"
@@ -32,7 +33,7 @@ var _ = Describe("MessageAggregator", func() {
 
 	It("passes value messages through", func() {
 		inputMessage := createValueMessage()
-		messageAggregator.Write(inputMessage)
+		messageAggregator.Write(context.Background(), inputMessage)
 
 		Expect(mockWriter.WriteInput.Event).To(HaveLen(1))
 		Expect(<-mockWriter.WriteInput.Event).To(Equal(inputMessage))
@@ -44,18 +45,18 @@ var _ = Describe("MessageAggregator", func() {
 		go func() {
 			defer close(done)
 			for i := 0; i < 40; i++ {
-				messageAggregator.Write(inputMessage)
+				messageAggregator.Write(context.Background(), inputMessage)
 			}
 		}()
 		for i := 0; i < 40; i++ {
-			messageAggregator.Write(inputMessage)
+			messageAggregator.Write(context.Background(), inputMessage)
 		}
 		<-done
 	})
 
 	Describe("counter processing", func() {
 		It("sets the Total field on a CounterEvent ", func() {
-			messageAggregator.Write(createCounterMessage("total", "fake-origin-4", nil))
+			messageAggregator.Write(context.Background(), createCounterMessage("total", "fake-origin-4", nil))
 
 			Expect(mockWriter.WriteInput.Event).To(HaveLen(1))
 			outputMessage := <-mockWriter.WriteInput.Event
@@ -64,21 +65,21 @@ var _ = Describe("MessageAggregator", func() {
 		})
 
 		It("accumulates Deltas for CounterEvents with the same name, origin, and tags", func() {
-			messageAggregator.Write(createCounterMessage(
+			messageAggregator.Write(context.Background(), createCounterMessage(
 				"total",
 				"fake-origin-4",
 				map[string]string{
 					"protocol": "tcp",
 				},
 			))
-			messageAggregator.Write(createCounterMessage(
+			messageAggregator.Write(context.Background(), createCounterMessage(
 				"total",
 				"fake-origin-4",
 				map[string]string{
 					"protocol": "tcp",
 				},
 			))
-			messageAggregator.Write(createCounterMessage(
+			messageAggregator.Write(context.Background(), createCounterMessage(
 				"total",
 				"fake-origin-4",
 				map[string]string{
@@ -96,21 +97,21 @@ var _ = Describe("MessageAggregator", func() {
 		})
 
 		It("overwrites aggregated total when total is set", func() {
-			messageAggregator.Write(createCounterMessage(
+			messageAggregator.Write(context.Background(), createCounterMessage(
 				"total",
 				"fake-origin-4",
 				map[string]string{
 					"protocol": "tcp",
 				},
 			))
-			messageAggregator.Write(createCounterMessageWithTotal(
+			messageAggregator.Write(context.Background(), createCounterMessageWithTotal(
 				"total",
 				"fake-origin-4",
 				map[string]string{
 					"protocol": "tcp",
 				},
 			))
-			messageAggregator.Write(createCounterMessage(
+			messageAggregator.Write(context.Background(), createCounterMessage(
 				"total",
 				"fake-origin-4",
 				map[string]string{
@@ -128,8 +129,8 @@ var _ = Describe("MessageAggregator", func() {
 		})
 
 		It("accumulates differently-named counters separately", func() {
-			messageAggregator.Write(createCounterMessage("total1", "fake-origin-4", nil))
-			messageAggregator.Write(createCounterMessage("total2", "fake-origin-4", nil))
+			messageAggregator.Write(context.Background(), createCounterMessage("total1", "fake-origin-4", nil))
+			messageAggregator.Write(context.Background(), createCounterMessage("total2", "fake-origin-4", nil))
 
 			Expect(mockWriter.WriteInput.Event).To(HaveLen(2))
 			e := <-mockWriter.WriteInput.Event
@@ -140,21 +141,21 @@ var _ = Describe("MessageAggregator", func() {
 
 		It("accumulates differently-tagged counters separately", func() {
 			By("writing protocol tagged counters")
-			messageAggregator.Write(createCounterMessage(
+			messageAggregator.Write(context.Background(), createCounterMessage(
 				"total",
 				"fake-origin-4",
 				map[string]string{
 					"protocol": "grpc",
 				},
 			))
-			messageAggregator.Write(createCounterMessage(
+			messageAggregator.Write(context.Background(), createCounterMessage(
 				"total",
 				"fake-origin-4",
 				map[string]string{
 					"protocol": "tcp",
 				},
 			))
-			messageAggregator.Write(createCounterMessage(
+			messageAggregator.Write(context.Background(), createCounterMessage(
 				"total",
 				"fake-origin-4",
 				map[string]string{
@@ -163,7 +164,7 @@ var _ = Describe("MessageAggregator", func() {
 			))
 
 			By("writing counters tagged with key/value strings split differently")
-			messageAggregator.Write(createCounterMessage(
+			messageAggregator.Write(context.Background(), createCounterMessage(
 				"total",
 				"fake-origin-4",
 				map[string]string{
@@ -179,8 +180,8 @@ var _ = Describe("MessageAggregator", func() {
 		})
 
 		It("does not accumulate for counters when receiving a non-counter event", func() {
-			messageAggregator.Write(createValueMessage())
-			messageAggregator.Write(createCounterMessage("counter1", "fake-origin-4", nil))
+			messageAggregator.Write(context.Background(), createValueMessage())
+			messageAggregator.Write(context.Background(), createCounterMessage("counter1", "fake-origin-4", nil))
 
 			Expect(mockWriter.WriteInput.Event).To(HaveLen(2))
 			e := <-mockWriter.WriteInput.Event
@@ -191,9 +192,9 @@ var _ = Describe("MessageAggregator", func() {
 		})
 
 		It("accumulates independently for different origins", func() {
-			messageAggregator.Write(createCounterMessage("counter1", "fake-origin-4", nil))
-			messageAggregator.Write(createCounterMessage("counter1", "fake-origin-5", nil))
-			messageAggregator.Write(createCounterMessage("counter1", "fake-origin-4", nil))
+			messageAggregator.Write(context.Background(), createCounterMessage("counter1", "fake-origin-4", nil))
+			messageAggregator.Write(context.Background(), createCounterMessage("counter1", "fake-origin-5", nil))
+			messageAggregator.Write(context.Background(), createCounterMessage("counter1", "fake-origin-4", nil))
 
 			Expect(mockWriter.WriteInput.Event).To(HaveLen(3))
 
@@ -1,6 +1,8 @@
 package v1
 
 import (
+	"context"
+
 	"github.com/cloudfoundry/sonde-go/events"
 	"google.golang.org/protobuf/proto"
 )
@@ -23,10 +25,10 @@ func NewTagger(deploymentName, job, index, ip string, outputWriter EnvelopeWrite
 	}
 }
 
-func (t *Tagger) Write(envelope *events.Envelope) {
+func (t *Tagger) Write(ctx context.Context, envelope *events.Envelope) {
 	newEnvelope := envelope
 	t.setDefaultTags(newEnvelope)
-	t.outputWriter.Write(newEnvelope)
+	t.outputWriter.Write(ctx, newEnvelope)
 }
 
 func (t *Tagger) setDefaultTags(envelope *events.Envelope) {
@@ -1,6 +1,8 @@
 package v1_test
 
 import (
+	"context"
+
 	egress "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v1"
 	"github.com/cloudfoundry/sonde-go/events"
 	"google.golang.org/protobuf/proto"
@@ -28,7 +30,7 @@ var _ = Describe("Tagger", func() {
 			},
 		}
 
-		t.Write(envelope)
+		t.Write(context.Background(), envelope)
 
 		Expect(mockWriter.WriteInput.Event).To(HaveLen(1))
 		expected := &events.Envelope{
@@ -75,7 +77,7 @@ var _ = Describe("Tagger", func() {
 
 		It("when deployment is already set", func() {
 			envelope.Deployment = proto.String("another-deployment")
-			t.Write(envelope)
+			t.Write(context.Background(), envelope)
 
 			Expect(mockWriter.WriteInput.Event).To(HaveLen(1))
 			writtenEnvelope := <-mockWriter.WriteInput.Event
@@ -84,7 +86,7 @@ var _ = Describe("Tagger", func() {
 
 		It("when job is already set", func() {
 			envelope.Job = proto.String("another-job")
-			t.Write(envelope)
+			t.Write(context.Background(), envelope)
 
 			Expect(mockWriter.WriteInput.Event).To(HaveLen(1))
 			writtenEnvelope := <-mockWriter.WriteInput.Event
@@ -93,7 +95,7 @@ var _ = Describe("Tagger", func() {
 
 		It("when index is already set", func() {
 			envelope.Index = proto.String("3")
-			t.Write(envelope)
+			t.Write(context.Background(), envelope)
 
 			Expect(mockWriter.WriteInput.Event).To(HaveLen(1))
 			writtenEnvelope := <-mockWriter.WriteInput.Event
@@ -102,7 +104,7 @@ var _ = Describe("Tagger", func() {
 
 		It("when ip is already set", func() {
 			envelope.Ip = proto.String("1.1.1.1")
-			t.Write(envelope)
+			t.Write(context.Background(), envelope)
 
 			Expect(mockWriter.WriteInput.Event).To(HaveLen(1))
 			writtenEnvelope := <-mockWriter.WriteInput.Event
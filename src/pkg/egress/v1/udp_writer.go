@@ -0,0 +1,32 @@
+package v1
+
+import (
+	"context"
+	"net"
+)
+
+// UDPWriter writes marshalled v1 envelopes as datagrams to a dropsonde UDP
+// endpoint, e.g. the v1 ingress of a legacy Metron or Loggregator Agent.
+type UDPWriter struct {
+	conn net.Conn
+}
+
+// NewUDPWriter returns a UDPWriter that writes to addr.
+func NewUDPWriter(addr string) (*UDPWriter, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &UDPWriter{conn: conn}, nil
+}
+
+// Write writes the message as a single datagram.
+func (w *UDPWriter) Write(_ context.Context, message []byte) error {
+	_, err := w.conn.Write(message)
+	return err
+}
+
+// Close closes the connection.
+func (w *UDPWriter) Close() error {
+	return w.conn.Close()
+}
@@ -1,6 +1,10 @@
 package v2
 
-import "code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+import (
+	"context"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+)
 
 type BatchEnvelopeWriter struct {
 	writer     BatchWriter
@@ -14,12 +18,12 @@ func NewBatchEnvelopeWriter(w BatchWriter, ps ...EnvelopeProcessor) BatchEnvelop
 	}
 }
 
-func (bw BatchEnvelopeWriter) Write(envs []*loggregator_v2.Envelope) error {
+func (bw BatchEnvelopeWriter) Write(ctx context.Context, envs []*loggregator_v2.Envelope) error {
 	for _, env := range envs {
 		for _, processor := range bw.processors {
 			_ = processor.Process(env)
 		}
 	}
 
-	return bw.writer.Write(envs)
+	return bw.writer.Write(ctx, envs)
 }
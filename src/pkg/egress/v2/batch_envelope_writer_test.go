@@ -1,15 +1,18 @@
 package v2_test
 
 import (
+	"context"
+
 	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
 	v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/testhelpers"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 )
 
 var _ = Describe("BatchEnvelopeWriter", func() {
 	It("processes each envelope before writing", func() {
-		mockWriter := newMockBatchWriter()
+		mockWriter := testhelpers.NewChanBatchWriter()
 		close(mockWriter.WriteOutput.Ret0)
 
 		tagger := v2.NewTagger(nil)
@@ -19,7 +22,7 @@ var _ = Describe("BatchEnvelopeWriter", func() {
 			buildCounterEnvelope(14, "name-2", "origin-1"),
 		}
 
-		Expect(ew.Write(envs)).ToNot(HaveOccurred())
+		Expect(ew.Write(context.Background(), envs)).ToNot(HaveOccurred())
 
 		var batch []*loggregator_v2.Envelope
 		Eventually(mockWriter.WriteInput.Msgs).Should(Receive(&batch))
@@ -0,0 +1,105 @@
+package v2
+
+import (
+	"slices"
+	"sync"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// minMarshalChunk is the smallest number of envelopes a worker marshals.
+// Smaller batches are marshalled by the caller.
+const minMarshalChunk = 64
+
+// batchField is the field number of loggregator_v2.EnvelopeBatch.Batch.
+const batchField protowire.Number = 1
+
+// BatchMarshaller marshals batches of envelopes to the wire format of a
+// loggregator_v2.EnvelopeBatch. Large batches are split into chunks that
+// are marshalled in parallel and joined in their original order, so that
+// marshalling does not limit the throughput of a single writer.
+type BatchMarshaller struct {
+	workers chan struct{}
+}
+
+// NewBatchMarshaller returns a BatchMarshaller that marshals at most
+// workers chunks at once across all of its callers. It is usually sized to
+// GOMAXPROCS.
+func NewBatchMarshaller(workers int) *BatchMarshaller {
+	if workers < 1 {
+		workers = 1
+	}
+	return &BatchMarshaller{
+		workers: make(chan struct{}, workers),
+	}
+}
+
+// Marshal returns the envelopes marshalled as a loggregator_v2.EnvelopeBatch.
+func (m *BatchMarshaller) Marshal(msgs []*loggregator_v2.Envelope) ([]byte, error) {
+	chunks := min(cap(m.workers), len(msgs)/minMarshalChunk)
+	if chunks <= 1 {
+		return appendEnvelopes(nil, msgs)
+	}
+
+	var (
+		wg   sync.WaitGroup
+		bufs = make([][]byte, chunks)
+		errs = make([]error, chunks)
+		size = (len(msgs) + chunks - 1) / chunks
+	)
+	for i := 0; i < chunks; i++ {
+		start := i * size
+		end := min(start+size, len(msgs))
+
+		m.workers <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-m.workers
+				wg.Done()
+			}()
+			bufs[i], errs[i] = appendEnvelopes(nil, msgs[start:end])
+		}(i)
+	}
+	wg.Wait()
+
+	n := 0
+	for i, b := range bufs {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		n += len(b)
+	}
+	out := make([]byte, 0, n)
+	for _, b := range bufs {
+		out = append(out, b...)
+	}
+	return out, nil
+}
+
+// appendEnvelopes appends the envelopes to b as repeated batch fields.
+func appendEnvelopes(b []byte, msgs []*loggregator_v2.Envelope) ([]byte, error) {
+	sizes := make([]int, len(msgs))
+	n := 0
+	for i, e := range msgs {
+		sizes[i] = proto.Size(e)
+		n += protowire.SizeTag(batchField) + protowire.SizeBytes(sizes[i])
+	}
+	b = slices.Grow(b, n)
+
+	// The sizes are cached by proto.Size, so they are not computed again.
+	opts := proto.MarshalOptions{UseCachedSize: true}
+	for i, e := range msgs {
+		b = protowire.AppendTag(b, batchField, protowire.BytesType)
+		b = protowire.AppendVarint(b, uint64(sizes[i]))
+
+		var err error
+		b, err = opts.MarshalAppend(b, e)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
@@ -0,0 +1,93 @@
+package v2_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
+	"google.golang.org/protobuf/proto"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("BatchMarshaller", func() {
+	unmarshal := func(b []byte) *loggregator_v2.EnvelopeBatch {
+		var batch loggregator_v2.EnvelopeBatch
+		Expect(proto.Unmarshal(b, &batch)).To(Succeed())
+		return &batch
+	}
+
+	It("marshals small batches", func() {
+		envs := buildEnvelopes(10)
+		b, err := v2.NewBatchMarshaller(4).Marshal(envs)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(proto.Equal(unmarshal(b), &loggregator_v2.EnvelopeBatch{Batch: envs})).To(BeTrue())
+	})
+
+	It("marshals large batches in parallel in their order", func() {
+		envs := buildEnvelopes(1001)
+		b, err := v2.NewBatchMarshaller(4).Marshal(envs)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(proto.Equal(unmarshal(b), &loggregator_v2.EnvelopeBatch{Batch: envs})).To(BeTrue())
+	})
+
+	It("marshals empty batches", func() {
+		b, err := v2.NewBatchMarshaller(4).Marshal(nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(unmarshal(b).Batch).To(BeEmpty())
+	})
+
+	It("returns an error if an envelope cannot be marshalled", func() {
+		envs := buildEnvelopes(1000)
+		envs[500].SourceId = "\xff"
+
+		_, err := v2.NewBatchMarshaller(4).Marshal(envs)
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+func buildEnvelopes(n int) []*loggregator_v2.Envelope {
+	envs := make([]*loggregator_v2.Envelope, n)
+	for i := range envs {
+		envs[i] = &loggregator_v2.Envelope{
+			SourceId: fmt.Sprintf("source-%d", i),
+			Tags:     map[string]string{"deployment": "cf", "job": "diego-cell", "index": "0"},
+			Message: &loggregator_v2.Envelope_Log{
+				Log: &loggregator_v2.Log{Payload: bytes.Repeat([]byte("a"), 256)},
+			},
+		}
+	}
+	return envs
+}
+
+func BenchmarkMarshalBatchProto(b *testing.B) {
+	envs := buildEnvelopes(1000)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := proto.Marshal(&loggregator_v2.EnvelopeBatch{Batch: envs}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBatchMarshaller1Worker(b *testing.B)  { benchmarkBatchMarshaller(b, 1) }
+func BenchmarkBatchMarshaller4Workers(b *testing.B) { benchmarkBatchMarshaller(b, 4) }
+func BenchmarkBatchMarshaller8Workers(b *testing.B) { benchmarkBatchMarshaller(b, 8) }
+
+func benchmarkBatchMarshaller(b *testing.B, workers int) {
+	m := v2.NewBatchMarshaller(workers)
+	envs := buildEnvelopes(1000)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := m.Marshal(envs); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -1,31 +1,82 @@
 package v2
 
 import (
+	"log"
+
 	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metrics "code.cloudfoundry.org/go-metric-registry"
 )
 
+// OverflowTag is the tag of the series that counters are aggregated into
+// once their name exceeds the cardinality limit of a CounterAggregator.
+const OverflowTag = "cardinality_overflow"
+
 type counterID struct {
 	name     string
 	sourceID string
 	tagsHash string
 }
 
+type counterName struct {
+	name     string
+	sourceID string
+}
+
 type CounterAggregator struct {
 	counterTotals map[counterID]uint64
 	processor     func(env *loggregator_v2.Envelope)
+
+	cardinalityLimit int
+	tagSets          map[counterName]*tagSets
+	overflowMetric   metrics.Counter
+}
+
+// tagSets are the hashes of the distinct tag sets of a counter name.
+type tagSets struct {
+	hashes     map[string]struct{}
+	overflowed bool
+}
+
+// CounterAggregatorOption configures a CounterAggregator.
+type CounterAggregatorOption func(*CounterAggregator)
+
+// WithCardinalityLimit limits the number of distinct tag sets of a counter
+// name of a source ID. Counters with further tag sets have their tags
+// replaced with the OverflowTag, so they are aggregated into a single
+// "other" series, and are counted in the counter_cardinality_overflow
+// metric. This protects the agent's memory against sources that emit
+// unique tags, e.g. per request.
+func WithCardinalityLimit(limit int, m MetricClient) CounterAggregatorOption {
+	return func(ca *CounterAggregator) {
+		ca.cardinalityLimit = limit
+		ca.overflowMetric = m.NewCounter(
+			"counter_cardinality_overflow",
+			"Total number of counter envelopes aggregated into the other series because their name exceeded the tag set limit.",
+			metrics.WithMetricLabels(map[string]string{"metric_version": "2.0"}),
+		)
+	}
 }
 
-func NewCounterAggregator(processor func(env *loggregator_v2.Envelope)) *CounterAggregator {
-	return &CounterAggregator{
+func NewCounterAggregator(processor func(env *loggregator_v2.Envelope), opts ...CounterAggregatorOption) *CounterAggregator {
+	ca := &CounterAggregator{
 		counterTotals: make(map[counterID]uint64),
 		processor:     processor,
+		tagSets:       make(map[counterName]*tagSets),
+	}
+	for _, o := range opts {
+		o(ca)
 	}
+	return ca
 }
 
 func (ca *CounterAggregator) Process(env *loggregator_v2.Envelope) error {
+	c := env.GetCounter()
+	if c != nil && ca.cardinalityLimit > 0 {
+		ca.limitCardinality(env)
+	}
+
 	ca.processor(env)
 
-	c := env.GetCounter()
 	if c != nil {
 		if len(ca.counterTotals) > 10000 {
 			ca.resetTotals()
@@ -49,6 +100,52 @@ func (ca *CounterAggregator) Process(env *loggregator_v2.Envelope) error {
 	return nil
 }
 
+// limitCardinality replaces the tags of the counter with the OverflowTag
+// if its name already has the maximum number of tag sets. Tags are
+// compared before the processor adds its tags.
+func (ca *CounterAggregator) limitCardinality(env *loggregator_v2.Envelope) {
+	name := counterName{name: env.GetCounter().GetName(), sourceID: env.GetSourceId()}
+	hash := HashTags(originTags(env))
+
+	sets, ok := ca.tagSets[name]
+	if !ok {
+		sets = &tagSets{hashes: make(map[string]struct{})}
+		ca.tagSets[name] = sets
+	}
+	if _, ok := sets.hashes[hash]; ok {
+		return
+	}
+	if len(sets.hashes) < ca.cardinalityLimit {
+		sets.hashes[hash] = struct{}{}
+		return
+	}
+
+	if !sets.overflowed {
+		sets.overflowed = true
+		log.Printf("counter %q of source %q exceeds %d tag sets, aggregating further tag sets into the %s series", name.name, name.sourceID, ca.cardinalityLimit, OverflowTag)
+	}
+	env.Tags = map[string]string{OverflowTag: "other"}
+	env.DeprecatedTags = nil
+	ca.overflowMetric.Add(1)
+}
+
+// originTags returns the tags and deprecated tags the envelope was
+// emitted with.
+func originTags(env *loggregator_v2.Envelope) map[string]string {
+	if len(env.GetDeprecatedTags()) == 0 {
+		return env.GetTags()
+	}
+	tags := make(map[string]string, len(env.GetTags())+len(env.GetDeprecatedTags()))
+	for k, v := range env.GetTags() {
+		tags[k] = v
+	}
+	for k, v := range env.GetDeprecatedTags() {
+		tags[k] = v.String()
+	}
+	return tags
+}
+
 func (ca *CounterAggregator) resetTotals() {
 	ca.counterTotals = make(map[counterID]uint64)
+	ca.tagSets = make(map[counterName]*tagSets)
 }
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
 	egress "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -108,6 +109,100 @@ var _ = Describe("CounterAggregator", func() {
 	})
 })
 
+var _ = Describe("CounterAggregator with a cardinality limit", func() {
+	var (
+		spyMetrics *metricsHelpers.SpyMetricsRegistry
+		aggregator *egress.CounterAggregator
+	)
+
+	BeforeEach(func() {
+		spyMetrics = metricsHelpers.NewMetricsRegistry()
+		aggregator = egress.NewCounterAggregator(
+			egress.NewTagger(nil).TagEnvelope,
+			egress.WithCardinalityLimit(2, spyMetrics),
+		)
+	})
+
+	overflowCount := func() float64 {
+		return spyMetrics.GetMetric("counter_cardinality_overflow", map[string]string{"metric_version": "2.0"}).Value()
+	}
+
+	It("keeps the tags of counters within the limit", func() {
+		for i := 0; i < 5; i++ {
+			env1 := buildCounterEnvelope(1, "name-1", "origin-1")
+			env2 := buildCounterEnvelope(1, "name-1", "origin-2")
+			Expect(aggregator.Process(env1)).To(Succeed())
+			Expect(aggregator.Process(env2)).To(Succeed())
+
+			Expect(env1.GetTags()).To(Equal(map[string]string{"origin": "origin-1"}))
+			Expect(env2.GetTags()).To(Equal(map[string]string{"origin": "origin-2"}))
+			Expect(env2.GetCounter().GetTotal()).To(Equal(uint64(i + 1)))
+		}
+
+		Expect(overflowCount()).To(BeZero())
+	})
+
+	It("aggregates counters beyond the limit into the overflow series", func() {
+		Expect(aggregator.Process(buildCounterEnvelope(1, "name-1", "origin-1"))).To(Succeed())
+		Expect(aggregator.Process(buildCounterEnvelope(1, "name-1", "origin-2"))).To(Succeed())
+
+		env3 := buildCounterEnvelope(10, "name-1", "origin-3")
+		env4 := buildCounterEnvelope(15, "name-1", "origin-4")
+		Expect(aggregator.Process(env3)).To(Succeed())
+		Expect(aggregator.Process(env4)).To(Succeed())
+
+		Expect(env3.GetTags()).To(Equal(map[string]string{egress.OverflowTag: "other"}))
+		Expect(env4.GetTags()).To(Equal(map[string]string{egress.OverflowTag: "other"}))
+		Expect(env3.GetCounter().GetTotal()).To(Equal(uint64(10)))
+		Expect(env4.GetCounter().GetTotal()).To(Equal(uint64(25)))
+		Expect(overflowCount()).To(Equal(float64(2)))
+	})
+
+	It("limits the tag sets of each name and source ID separately", func() {
+		Expect(aggregator.Process(buildCounterEnvelope(1, "name-1", "origin-1"))).To(Succeed())
+		Expect(aggregator.Process(buildCounterEnvelope(1, "name-1", "origin-2"))).To(Succeed())
+
+		env1 := buildCounterEnvelope(1, "name-2", "origin-3")
+		env2 := buildCounterEnvelope(1, "name-1", "origin-3")
+		env2.SourceId = "other-source"
+		Expect(aggregator.Process(env1)).To(Succeed())
+		Expect(aggregator.Process(env2)).To(Succeed())
+
+		Expect(env1.GetTags()).To(HaveKeyWithValue("origin", "origin-3"))
+		Expect(env2.GetTags()).To(HaveKeyWithValue("origin", "origin-3"))
+		Expect(overflowCount()).To(BeZero())
+	})
+
+	It("counts empty tags and deprecated tags as tag sets", func() {
+		env1 := buildCounterEnvelope(1, "name-1", "origin-1")
+		env1.Tags = nil
+		env2 := buildCounterEnvelope(1, "name-1", "origin-1")
+		env2.Tags = nil
+		env2.DeprecatedTags = map[string]*loggregator_v2.Value{
+			"origin": {Data: &loggregator_v2.Value_Text{Text: "origin-1"}},
+		}
+		env3 := buildCounterEnvelope(1, "name-1", "origin-1")
+		env3.Tags = nil
+		env3.DeprecatedTags = map[string]*loggregator_v2.Value{
+			"origin": {Data: &loggregator_v2.Value_Text{Text: "origin-2"}},
+		}
+		Expect(aggregator.Process(env1)).To(Succeed())
+		Expect(aggregator.Process(env2)).To(Succeed())
+		Expect(aggregator.Process(env3)).To(Succeed())
+
+		Expect(env1.GetTags()).To(BeEmpty())
+		Expect(env2.GetTags()).To(Equal(map[string]string{"origin": "origin-1"}))
+		Expect(env3.GetTags()).To(Equal(map[string]string{egress.OverflowTag: "other"}))
+		Expect(env3.GetDeprecatedTags()).To(BeNil())
+
+		env4 := buildCounterEnvelope(1, "name-1", "origin-1")
+		env4.Tags = nil
+		Expect(aggregator.Process(env4)).To(Succeed())
+		Expect(env4.GetTags()).To(BeEmpty())
+		Expect(overflowCount()).To(Equal(float64(1)))
+	})
+})
+
 func buildCounterEnvelope(delta uint64, name, origin string) *loggregator_v2.Envelope {
 	return &loggregator_v2.Envelope{
 		Message: &loggregator_v2.Envelope_Counter{
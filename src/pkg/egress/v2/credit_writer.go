@@ -0,0 +1,129 @@
+package v2
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metrics "code.cloudfoundry.org/go-metric-registry"
+
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
+)
+
+// ErrNoCredits is returned by a CreditWriter when its window has no
+// credits left.
+var ErrNoCredits = errors.New("no credits left in the window of the destination")
+
+// CreditWindow is a credit-based flow control window for a destination.
+// Each envelope pushed to the destination takes a credit, which is
+// returned once the destination has accepted the envelope. While no
+// credits are left, envelopes are not pushed and are counted as
+// backpressure instead of being dropped silently by a buffer downstream.
+type CreditWindow struct {
+	size      int64
+	available atomic.Int64
+
+	credits   metrics.Gauge
+	exhausted metrics.Counter
+}
+
+// NewCreditWindow returns a CreditWindow with size credits whose metrics
+// are labeled with the destination.
+func NewCreditWindow(size int, m MetricClient, destination string) *CreditWindow {
+	labels := metrics.WithMetricLabels(map[string]string{"destination": destination})
+	cw := &CreditWindow{
+		size: int64(size),
+		credits: m.NewGauge(
+			"egress_credits_available",
+			"Number of envelopes that can be pushed to the destination before it accepts more.",
+			labels,
+		),
+		exhausted: m.NewCounter(
+			"egress_backpressure_total",
+			"Total number of envelopes not pushed to the destination because its credit window was exhausted.",
+			labels,
+		),
+	}
+	cw.available.Store(cw.size)
+	cw.credits.Set(float64(size))
+
+	return cw
+}
+
+// Acquire takes a credit. It returns false and counts the envelope as
+// backpressure if no credits are left.
+func (cw *CreditWindow) Acquire() bool {
+	n := cw.available.Add(-1)
+	if n < 0 {
+		cw.available.Add(1)
+		cw.exhausted.Add(1)
+		return false
+	}
+	cw.credits.Set(float64(n))
+	return true
+}
+
+// Release returns a credit.
+func (cw *CreditWindow) Release() {
+	cw.credits.Set(float64(cw.available.Add(1)))
+}
+
+// InFlight returns the number of envelopes pushed to the destination that
+// it has not accepted yet.
+func (cw *CreditWindow) InFlight() int {
+	return int(cw.size - cw.available.Load())
+}
+
+// CreditWriter writes envelopes to a destination while its CreditWindow
+// has credits.
+type CreditWriter struct {
+	w      Writer
+	window *CreditWindow
+}
+
+// NewCreditWriter returns a CreditWriter that takes a credit of window for
+// each envelope it writes to w.
+func NewCreditWriter(w Writer, window *CreditWindow) *CreditWriter {
+	return &CreditWriter{
+		w:      w,
+		window: window,
+	}
+}
+
+// Write writes the envelope if a credit is available and returns
+// ErrNoCredits otherwise.
+func (w *CreditWriter) Write(ctx context.Context, e *loggregator_v2.Envelope) error {
+	if !w.window.Acquire() {
+		return ErrNoCredits
+	}
+	return w.w.Write(ctx, e)
+}
+
+// Len returns the number of envelopes in flight, so that a CreditWriter
+// can be introspected as a Queue.
+func (w *CreditWriter) Len() int {
+	return w.window.InFlight()
+}
+
+// CreditReleasingWriter returns the credit of each envelope to a
+// CreditWindow once the wrapped writer has accepted or failed to write it.
+type CreditReleasingWriter struct {
+	egress.WriteCloser
+	window *CreditWindow
+}
+
+// NewCreditReleasingWriter returns a CreditReleasingWriter that writes to
+// w and returns credits to window.
+func NewCreditReleasingWriter(w egress.WriteCloser, window *CreditWindow) CreditReleasingWriter {
+	return CreditReleasingWriter{
+		WriteCloser: w,
+		window:      window,
+	}
+}
+
+// Write writes the envelope and returns its credit.
+func (w CreditReleasingWriter) Write(ctx context.Context, e *loggregator_v2.Envelope) error {
+	defer w.window.Release()
+	return w.WriteCloser.Write(ctx, e)
+}
@@ -0,0 +1,71 @@
+package v2_test
+
+import (
+	"context"
+	"errors"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
+	v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CreditWriter", func() {
+	var (
+		spy       *metricsHelpers.SpyMetricsRegistry
+		window    *v2.CreditWindow
+		spyWriter *laneSpyWriter
+		w         *v2.CreditWriter
+	)
+
+	BeforeEach(func() {
+		spy = metricsHelpers.NewMetricsRegistry()
+		window = v2.NewCreditWindow(2, spy, "some-destination")
+		spyWriter = &laneSpyWriter{}
+		w = v2.NewCreditWriter(spyWriter, window)
+	})
+
+	metric := func(name string) float64 {
+		return spy.GetMetric(name, map[string]string{"destination": "some-destination"}).Value()
+	}
+
+	It("stops writing when the window is exhausted", func() {
+		Expect(w.Write(context.Background(), &loggregator_v2.Envelope{SourceId: "1"})).To(Succeed())
+		Expect(w.Write(context.Background(), &loggregator_v2.Envelope{SourceId: "2"})).To(Succeed())
+		Expect(w.Write(context.Background(), &loggregator_v2.Envelope{SourceId: "3"})).To(MatchError(v2.ErrNoCredits))
+
+		Expect(spyWriter.Envelopes()).To(HaveLen(2))
+		Expect(w.Len()).To(Equal(2))
+		Expect(metric("egress_credits_available")).To(BeNumerically("==", 0))
+		Expect(metric("egress_backpressure_total")).To(BeNumerically("==", 1))
+	})
+
+	It("writes again once credits are released", func() {
+		releasing := v2.NewCreditReleasingWriter(&spyWriteCloser{}, window)
+
+		Expect(w.Write(context.Background(), &loggregator_v2.Envelope{})).To(Succeed())
+		Expect(w.Write(context.Background(), &loggregator_v2.Envelope{})).To(Succeed())
+		Expect(releasing.Write(context.Background(), &loggregator_v2.Envelope{})).To(Succeed())
+
+		Expect(w.Len()).To(Equal(1))
+		Expect(metric("egress_credits_available")).To(BeNumerically("==", 1))
+		Expect(w.Write(context.Background(), &loggregator_v2.Envelope{})).To(Succeed())
+		Expect(spyWriter.Envelopes()).To(HaveLen(3))
+	})
+
+	It("releases credits of failed writes", func() {
+		releasing := v2.NewCreditReleasingWriter(&spyWriteCloser{err: errors.New("some-error")}, window)
+
+		Expect(w.Write(context.Background(), &loggregator_v2.Envelope{})).To(Succeed())
+		Expect(releasing.Write(context.Background(), &loggregator_v2.Envelope{})).To(MatchError("some-error"))
+		Expect(w.Len()).To(Equal(0))
+	})
+
+	It("closes the wrapped writer", func() {
+		spyWriter := &spyWriteCloser{}
+		Expect(v2.NewCreditReleasingWriter(spyWriter, window).Close()).To(Succeed())
+		Expect(spyWriter.closed).To(BeTrue())
+	})
+})
@@ -0,0 +1,355 @@
+package v2
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metrics "code.cloudfoundry.org/go-metric-registry"
+
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
+)
+
+const (
+	// sloWindowSlots is the number of one minute slots latencies are
+	// kept in, so that quantiles cover the last five minutes.
+	sloWindowSlots = 5
+	sloSlotLength  = time.Minute
+
+	// Latency buckets grow by latencyBucketFactor from minLatency. Quantiles
+	// are reported as the upper bound of their bucket, so they are at most
+	// 25% above the actual latency.
+	minLatency          = time.Millisecond
+	latencyBucketFactor = 1.25
+	latencyBuckets      = 80
+)
+
+// DeliverySLO reports delivery SLO gauges for a destination so that
+// operators can alert on them directly: the age of the oldest envelope
+// still waiting for delivery and the 99.9th percentile delivery latency
+// over the last five minutes. The age of a waiting envelope is the time
+// since it was queued for the destination. The latency of an envelope is
+// the time from its timestamp to its successful delivery.
+type DeliverySLO struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	latency latencyWindow
+
+	oldestAge  metrics.Gauge
+	latency999 metrics.Gauge
+
+	m           MetricClient
+	destination string
+	emitters    map[string]*emitterLatency
+}
+
+// emitterLatency is the delivery latency of the envelopes of an emitter.
+type emitterLatency struct {
+	latency    latencyWindow
+	latency999 metrics.Gauge
+}
+
+// EmitterTag is the tag with the identity of the emitter of an envelope.
+// The ingress receiver adds it when batch metadata is enabled.
+const EmitterTag = "emitter"
+
+// MaxEmitters is the number of emitters whose metrics are reported
+// separately. The metrics of further emitters are reported as
+// OtherEmitter.
+const MaxEmitters = 100
+
+// OtherEmitter is the emitter label of the metrics of emitters beyond
+// MaxEmitters.
+const OtherEmitter = "other"
+
+// DeliverySLOOption configures a DeliverySLO.
+type DeliverySLOOption func(*DeliverySLO)
+
+// WithSLOClock sets the clock of a DeliverySLO. It is meant for tests.
+func WithSLOClock(now func() time.Time) DeliverySLOOption {
+	return func(s *DeliverySLO) {
+		s.now = now
+	}
+}
+
+// WithEmitterLatency additionally reports the 99.9th percentile delivery
+// latency per emitter of envelopes tagged with EmitterTag, so that it can
+// be compared with the ingress batch delay of the emitter.
+func WithEmitterLatency() DeliverySLOOption {
+	return func(s *DeliverySLO) {
+		s.emitters = make(map[string]*emitterLatency)
+	}
+}
+
+// NewDeliverySLO returns a DeliverySLO whose gauges are labeled with the
+// destination.
+func NewDeliverySLO(m MetricClient, destination string, opts ...DeliverySLOOption) *DeliverySLO {
+	labels := metrics.WithMetricLabels(map[string]string{"destination": destination})
+	s := &DeliverySLO{
+		now: time.Now,
+		oldestAge: m.NewGauge(
+			"egress_oldest_envelope_age_seconds",
+			"Age of the oldest envelope waiting to be delivered to the destination.",
+			labels,
+		),
+		latency999: m.NewGauge(
+			"egress_delivery_latency_p999_seconds",
+			"99.9th percentile of the delivery latency to the destination over the last five minutes.",
+			labels,
+		),
+		m:           m,
+		destination: destination,
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	s.latency.slotStart = s.now()
+
+	return s
+}
+
+// EnqueueReporter is a queue that reports when the envelope at its head,
+// i.e. the oldest envelope waiting in it, was queued.
+type EnqueueReporter interface {
+	// OldestEnqueued returns the zero time if the queue is empty.
+	OldestEnqueued() time.Time
+}
+
+// Delivered records the latencies of envelopes that were delivered.
+// Envelopes without a timestamp are ignored.
+func (s *DeliverySLO) Delivered(envs ...*loggregator_v2.Envelope) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.latency.rotate(now)
+	for _, e := range envs {
+		if e.GetTimestamp() <= 0 {
+			continue
+		}
+		latency := now.Sub(time.Unix(0, e.GetTimestamp()))
+		if latency < 0 {
+			latency = 0
+		}
+		s.latency.add(latency)
+
+		if emitter, ok := e.GetTags()[EmitterTag]; ok && s.emitters != nil {
+			el := s.emitter(emitter, now)
+			el.latency.rotate(now)
+			el.latency.add(latency)
+		}
+	}
+}
+
+// emitter returns the latency of the emitter and creates it if it is not
+// known yet.
+func (s *DeliverySLO) emitter(name string, now time.Time) *emitterLatency {
+	if el, ok := s.emitters[name]; ok {
+		return el
+	}
+	if len(s.emitters) >= MaxEmitters {
+		name = OtherEmitter
+		if el, ok := s.emitters[name]; ok {
+			return el
+		}
+	}
+
+	el := &emitterLatency{
+		latency: latencyWindow{slotStart: now},
+		latency999: s.m.NewGauge(
+			"egress_emitter_delivery_latency_p999_seconds",
+			"99.9th percentile of the delivery latency of the envelopes of an emitter to the destination over the last five minutes.",
+			metrics.WithMetricLabels(map[string]string{
+				"destination": s.destination,
+				"emitter":     name,
+			}),
+		),
+	}
+	s.emitters[name] = el
+	return el
+}
+
+// Report sets the gauges. oldest is when the oldest envelope waiting to be
+// delivered was queued; with the zero time the oldest envelope age is zero.
+func (s *DeliverySLO) Report(oldest time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.latency.rotate(now)
+	var age time.Duration
+	if !oldest.IsZero() && now.After(oldest) {
+		age = now.Sub(oldest)
+	}
+	s.oldestAge.Set(age.Seconds())
+	s.latency999.Set(s.latency.quantile(0.999).Seconds())
+
+	for _, el := range s.emitters {
+		el.latency.rotate(now)
+		el.latency999.Set(el.latency.quantile(0.999).Seconds())
+	}
+}
+
+// Run reports the gauges every interval until ctx is done. q is the queue
+// of the envelopes waiting to be delivered.
+func (s *DeliverySLO) Run(ctx context.Context, q EnqueueReporter, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			s.Report(q.OldestEnqueued())
+		}
+	}
+}
+
+// latencyWindow counts latencies in buckets per one minute slot.
+type latencyWindow struct {
+	slots     [sloWindowSlots][latencyBuckets]uint64
+	current   int
+	slotStart time.Time
+}
+
+func (w *latencyWindow) add(latency time.Duration) {
+	w.slots[w.current][latencyBucket(latency)]++
+}
+
+// rotate clears the slots that are older than the window.
+func (w *latencyWindow) rotate(now time.Time) {
+	for i := 0; i < sloWindowSlots && now.Sub(w.slotStart) >= sloSlotLength; i++ {
+		w.current = (w.current + 1) % sloWindowSlots
+		w.slots[w.current] = [latencyBuckets]uint64{}
+		w.slotStart = w.slotStart.Add(sloSlotLength)
+	}
+	if now.Sub(w.slotStart) >= sloSlotLength {
+		w.slotStart = now
+	}
+}
+
+func (w *latencyWindow) quantile(q float64) time.Duration {
+	var merged [latencyBuckets]uint64
+	var total uint64
+	for _, slot := range w.slots {
+		for i, n := range slot {
+			merged[i] += n
+			total += n
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+
+	rank := uint64(math.Ceil(q * float64(total)))
+	var seen uint64
+	for i, n := range merged {
+		seen += n
+		if seen >= rank {
+			return latencyUpperBound(i)
+		}
+	}
+	return latencyUpperBound(latencyBuckets - 1)
+}
+
+func latencyBucket(d time.Duration) int {
+	if d <= minLatency {
+		return 0
+	}
+	i := int(math.Ceil(math.Log(float64(d)/float64(minLatency)) / math.Log(latencyBucketFactor)))
+	if i >= latencyBuckets {
+		return latencyBuckets - 1
+	}
+	return i
+}
+
+func latencyUpperBound(i int) time.Duration {
+	return time.Duration(float64(minLatency) * math.Pow(latencyBucketFactor, float64(i)))
+}
+
+// SLOWriter records the envelopes it delivers with a DeliverySLO.
+type SLOWriter struct {
+	egress.WriteCloser
+	slo *DeliverySLO
+}
+
+// NewSLOWriter returns an SLOWriter that writes to w and records
+// successful writes with slo.
+func NewSLOWriter(w egress.WriteCloser, slo *DeliverySLO) SLOWriter {
+	return SLOWriter{
+		WriteCloser: w,
+		slo:         slo,
+	}
+}
+
+// Write writes the envelope and records it if the write succeeds.
+func (w SLOWriter) Write(ctx context.Context, e *loggregator_v2.Envelope) error {
+	if err := w.WriteCloser.Write(ctx, e); err != nil {
+		return err
+	}
+	w.slo.Delivered(e)
+	return nil
+}
+
+// SLOBatchWriter records the batches it delivers with a DeliverySLO.
+type SLOBatchWriter struct {
+	BatchWriter
+	slo *DeliverySLO
+}
+
+// NewSLOBatchWriter returns an SLOBatchWriter that writes to w and records
+// successful writes with slo.
+func NewSLOBatchWriter(w BatchWriter, slo *DeliverySLO) SLOBatchWriter {
+	return SLOBatchWriter{
+		BatchWriter: w,
+		slo:         slo,
+	}
+}
+
+// Write writes the batch and records it if the write succeeds.
+func (w SLOBatchWriter) Write(ctx context.Context, msgs []*loggregator_v2.Envelope) error {
+	if err := w.BatchWriter.Write(ctx, msgs); err != nil {
+		return err
+	}
+	w.slo.Delivered(msgs...)
+	return nil
+}
+
+// EmitterStrippingWriter removes the EmitterTag from envelopes before it
+// writes them, so that the emitter that is only known to the agent is not
+// egressed. Envelopes with the tag are copied, since they may be written
+// to other writers, e.g. to record their delivery with the emitter.
+type EmitterStrippingWriter struct {
+	egress.WriteCloser
+}
+
+// NewEmitterStrippingWriter returns an EmitterStrippingWriter that writes
+// to w.
+func NewEmitterStrippingWriter(w egress.WriteCloser) EmitterStrippingWriter {
+	return EmitterStrippingWriter{WriteCloser: w}
+}
+
+// Write writes the envelope without its EmitterTag.
+func (w EmitterStrippingWriter) Write(ctx context.Context, e *loggregator_v2.Envelope) error {
+	if _, ok := e.GetTags()[EmitterTag]; !ok {
+		return w.WriteCloser.Write(ctx, e)
+	}
+
+	tags := make(map[string]string, len(e.GetTags())-1)
+	for k, v := range e.GetTags() {
+		if k != EmitterTag {
+			tags[k] = v
+		}
+	}
+	return w.WriteCloser.Write(ctx, &loggregator_v2.Envelope{
+		Timestamp:      e.GetTimestamp(),
+		SourceId:       e.GetSourceId(),
+		InstanceId:     e.GetInstanceId(),
+		DeprecatedTags: e.GetDeprecatedTags(),
+		Tags:           tags,
+		Message:        e.Message,
+	})
+}
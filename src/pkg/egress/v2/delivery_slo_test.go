@@ -0,0 +1,215 @@
+package v2_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
+	v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/testhelpers"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DeliverySLO", func() {
+	var (
+		spy   *metricsHelpers.SpyMetricsRegistry
+		clock *fakeClock
+		slo   *v2.DeliverySLO
+	)
+
+	BeforeEach(func() {
+		spy = metricsHelpers.NewMetricsRegistry()
+		clock = &fakeClock{now: time.Unix(1000, 0)}
+		slo = v2.NewDeliverySLO(spy, "some-destination", v2.WithSLOClock(clock.Now))
+	})
+
+	gauge := func(name string) float64 {
+		return spy.GetMetric(name, map[string]string{"destination": "some-destination"}).Value()
+	}
+
+	// sentAgo returns an envelope whose timestamp is d before now.
+	sentAgo := func(d time.Duration) *loggregator_v2.Envelope {
+		return &loggregator_v2.Envelope{Timestamp: clock.Now().Add(-d).UnixNano()}
+	}
+
+	It("reports the 99.9th percentile delivery latency", func() {
+		for i := 0; i < 999; i++ {
+			slo.Delivered(sentAgo(10 * time.Millisecond))
+		}
+		slo.Report(time.Time{})
+		Expect(gauge("egress_delivery_latency_p999_seconds")).To(BeNumerically("~", 0.010, 0.003))
+
+		for i := 0; i < 10; i++ {
+			slo.Delivered(sentAgo(2 * time.Second))
+		}
+		slo.Report(time.Time{})
+		Expect(gauge("egress_delivery_latency_p999_seconds")).To(BeNumerically("~", 2, 0.5))
+	})
+
+	It("only reports the latencies of the last five minutes", func() {
+		slo.Delivered(sentAgo(2 * time.Second))
+		clock.Add(4 * time.Minute)
+		slo.Report(time.Time{})
+		Expect(gauge("egress_delivery_latency_p999_seconds")).To(BeNumerically("~", 2, 0.5))
+
+		clock.Add(2 * time.Minute)
+		slo.Report(time.Time{})
+		Expect(gauge("egress_delivery_latency_p999_seconds")).To(Equal(0.0))
+	})
+
+	It("reports the age of the oldest envelope waiting", func() {
+		slo.Delivered(sentAgo(time.Minute))
+		slo.Report(clock.Now().Add(-3 * time.Second))
+		Expect(gauge("egress_oldest_envelope_age_seconds")).To(Equal(3.0))
+
+		slo.Report(time.Time{})
+		Expect(gauge("egress_oldest_envelope_age_seconds")).To(Equal(0.0))
+	})
+
+	It("ignores envelopes without a timestamp", func() {
+		slo.Delivered(&loggregator_v2.Envelope{})
+		slo.Report(time.Time{})
+
+		Expect(gauge("egress_delivery_latency_p999_seconds")).To(Equal(0.0))
+	})
+
+	It("reports periodically", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go slo.Run(ctx, spyEnqueueReporter(clock.Now().Add(-time.Second)), 10*time.Millisecond)
+
+		Eventually(func() float64 {
+			return gauge("egress_oldest_envelope_age_seconds")
+		}).Should(Equal(1.0))
+	})
+
+	Describe("with emitter latency", func() {
+		BeforeEach(func() {
+			slo = v2.NewDeliverySLO(spy, "some-destination", v2.WithSLOClock(clock.Now), v2.WithEmitterLatency())
+		})
+
+		emitterGauge := func(emitter string) float64 {
+			return spy.GetMetric("egress_emitter_delivery_latency_p999_seconds", map[string]string{
+				"destination": "some-destination",
+				"emitter":     emitter,
+			}).Value()
+		}
+
+		sentBy := func(emitter string, d time.Duration) *loggregator_v2.Envelope {
+			e := sentAgo(d)
+			e.Tags = map[string]string{v2.EmitterTag: emitter}
+			return e
+		}
+
+		It("reports the latency of every emitter", func() {
+			slo.Delivered(sentBy("diego-cell", time.Second), sentBy("router", 3*time.Second), sentAgo(5*time.Second))
+			slo.Report(time.Time{})
+
+			Expect(emitterGauge("diego-cell")).To(BeNumerically("~", 1, 0.25))
+			Expect(emitterGauge("router")).To(BeNumerically("~", 3, 0.75))
+			Expect(gauge("egress_delivery_latency_p999_seconds")).To(BeNumerically("~", 5, 1.25))
+		})
+
+		It("reports emitters beyond the limit as other", func() {
+			for i := 0; i < 101; i++ {
+				slo.Delivered(sentBy(fmt.Sprintf("emitter-%d", i), time.Second))
+			}
+			slo.Report(time.Time{})
+
+			Expect(spy.HasMetric("egress_emitter_delivery_latency_p999_seconds", map[string]string{
+				"destination": "some-destination",
+				"emitter":     "emitter-100",
+			})).To(BeFalse())
+			Expect(emitterGauge(v2.OtherEmitter)).To(BeNumerically("~", 1, 0.25))
+		})
+	})
+
+	Describe("SLOWriter", func() {
+		It("records successfully written envelopes", func() {
+			spyWriter := &spyWriteCloser{}
+			w := v2.NewSLOWriter(spyWriter, slo)
+
+			spyWriter.err = errors.New("some-error")
+			Expect(w.Write(context.Background(), sentAgo(2*time.Second))).To(MatchError("some-error"))
+			spyWriter.err = nil
+			Expect(w.Write(context.Background(), sentAgo(time.Second))).To(Succeed())
+			slo.Report(time.Time{})
+
+			Expect(gauge("egress_delivery_latency_p999_seconds")).To(BeNumerically("~", 1, 0.25))
+		})
+	})
+
+	Describe("EmitterStrippingWriter", func() {
+		It("writes a copy of envelopes without the emitter tag", func() {
+			spyWriter := &spyWriteCloser{}
+			w := v2.NewEmitterStrippingWriter(spyWriter)
+			e := &loggregator_v2.Envelope{
+				SourceId: "some-id",
+				Tags:     map[string]string{v2.EmitterTag: "diego-cell", "job": "router"},
+				Message:  &loggregator_v2.Envelope_Log{Log: &loggregator_v2.Log{Payload: []byte("some-log")}},
+			}
+
+			Expect(w.Write(context.Background(), e)).To(Succeed())
+
+			Expect(spyWriter.envelopes).To(HaveLen(1))
+			written := spyWriter.envelopes[0]
+			Expect(written.GetTags()).To(Equal(map[string]string{"job": "router"}))
+			Expect(written.GetSourceId()).To(Equal("some-id"))
+			Expect(written.GetLog().GetPayload()).To(Equal([]byte("some-log")))
+			Expect(e.GetTags()).To(HaveKeyWithValue(v2.EmitterTag, "diego-cell"))
+		})
+
+		It("writes envelopes without the emitter tag unchanged", func() {
+			spyWriter := &spyWriteCloser{}
+			w := v2.NewEmitterStrippingWriter(spyWriter)
+			e := &loggregator_v2.Envelope{SourceId: "some-id"}
+
+			Expect(w.Write(context.Background(), e)).To(Succeed())
+			Expect(spyWriter.envelopes).To(ConsistOf(BeIdenticalTo(e)))
+		})
+	})
+
+	Describe("SLOBatchWriter", func() {
+		It("records successfully written batches", func() {
+			mockWriter := testhelpers.NewChanBatchWriter()
+			w := v2.NewSLOBatchWriter(mockWriter, slo)
+
+			mockWriter.WriteOutput.Ret0 <- errors.New("some-error")
+			Expect(w.Write(context.Background(), []*loggregator_v2.Envelope{sentAgo(3 * time.Second)})).To(MatchError("some-error"))
+			mockWriter.WriteOutput.Ret0 <- nil
+			Expect(w.Write(context.Background(), []*loggregator_v2.Envelope{sentAgo(time.Second)})).To(Succeed())
+			slo.Report(time.Time{})
+
+			Expect(gauge("egress_delivery_latency_p999_seconds")).To(BeNumerically("~", 1, 0.25))
+		})
+	})
+})
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+type spyEnqueueReporter time.Time
+
+func (q spyEnqueueReporter) OldestEnqueued() time.Time {
+	return time.Time(q)
+}
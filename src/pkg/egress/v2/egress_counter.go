@@ -0,0 +1,99 @@
+package v2
+
+import (
+	"context"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metrics "code.cloudfoundry.org/go-metric-registry"
+
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
+)
+
+// Destination classes of an EgressCounter.
+const (
+	DestinationDoppler = "doppler"
+	DestinationSyslog  = "syslog"
+	DestinationHTTPS   = "https"
+	DestinationOTLP    = "otlp"
+
+	// DestinationLoggregator and DestinationDropsonde are the consumers
+	// of the Forwarder Agent.
+	DestinationLoggregator = "loggregator"
+	DestinationDropsonde   = "dropsonde"
+)
+
+// EnvelopeTypes are the envelope_type label values of an EgressCounter.
+var EnvelopeTypes = []string{"log", "counter", "gauge", "timer", "event"}
+
+// EgressCounter counts egressed envelopes by envelope type for a class of
+// destinations, e.g. to plan capacity by traffic mix. A nil EgressCounter
+// counts nothing.
+type EgressCounter struct {
+	counters map[string]metrics.Counter
+}
+
+// NewEgressCounter returns an EgressCounter for the destination class.
+func NewEgressCounter(m MetricClient, destination string) *EgressCounter {
+	c := &EgressCounter{
+		counters: make(map[string]metrics.Counter, len(EnvelopeTypes)),
+	}
+	for _, t := range EnvelopeTypes {
+		c.counters[t] = m.NewCounter(
+			"egress_envelopes",
+			"Total number of envelopes successfully egressed by envelope type and destination class.",
+			metrics.WithMetricLabels(map[string]string{
+				"envelope_type": t,
+				"destination":   destination,
+			}),
+		)
+	}
+	return c
+}
+
+// Add counts the envelopes. Envelopes without a message are not counted.
+func (c *EgressCounter) Add(envs ...*loggregator_v2.Envelope) {
+	if c == nil {
+		return
+	}
+	for _, e := range envs {
+		c.AddTypes(EnvelopeType(e))
+	}
+}
+
+// AddTypes counts envelopes by their envelope types as returned by
+// EnvelopeType, e.g. for envelopes that are sent after they were
+// converted. Unknown types are not counted.
+func (c *EgressCounter) AddTypes(types ...string) {
+	if c == nil {
+		return
+	}
+	for _, t := range types {
+		if counter, ok := c.counters[t]; ok {
+			counter.Add(1)
+		}
+	}
+}
+
+// CountingWriter counts the envelopes that are written successfully.
+type CountingWriter struct {
+	egress.WriteCloser
+	counter *EgressCounter
+}
+
+// NewCountingWriter returns a CountingWriter that writes to w and counts
+// successful writes with c.
+func NewCountingWriter(w egress.WriteCloser, c *EgressCounter) CountingWriter {
+	return CountingWriter{
+		WriteCloser: w,
+		counter:     c,
+	}
+}
+
+// Write writes the envelope and counts it if the write succeeds.
+func (w CountingWriter) Write(ctx context.Context, e *loggregator_v2.Envelope) error {
+	if err := w.WriteCloser.Write(ctx, e); err != nil {
+		return err
+	}
+	w.counter.Add(e)
+	return nil
+}
@@ -0,0 +1,100 @@
+package v2_test
+
+import (
+	"context"
+	"errors"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
+	v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("EgressCounter", func() {
+	var (
+		spy *metricsHelpers.SpyMetricsRegistry
+		c   *v2.EgressCounter
+	)
+
+	BeforeEach(func() {
+		spy = metricsHelpers.NewMetricsRegistry()
+		c = v2.NewEgressCounter(spy, v2.DestinationSyslog)
+	})
+
+	egressed := func(envelopeType string) float64 {
+		return spy.GetMetric("egress_envelopes", map[string]string{
+			"envelope_type": envelopeType,
+			"destination":   "syslog",
+		}).Value()
+	}
+
+	It("counts envelopes by envelope type", func() {
+		c.Add(
+			&loggregator_v2.Envelope{Message: &loggregator_v2.Envelope_Log{Log: &loggregator_v2.Log{}}},
+			&loggregator_v2.Envelope{Message: &loggregator_v2.Envelope_Log{Log: &loggregator_v2.Log{}}},
+			&loggregator_v2.Envelope{Message: &loggregator_v2.Envelope_Counter{Counter: &loggregator_v2.Counter{}}},
+			&loggregator_v2.Envelope{Message: &loggregator_v2.Envelope_Gauge{Gauge: &loggregator_v2.Gauge{}}},
+			&loggregator_v2.Envelope{Message: &loggregator_v2.Envelope_Timer{Timer: &loggregator_v2.Timer{}}},
+			&loggregator_v2.Envelope{Message: &loggregator_v2.Envelope_Event{Event: &loggregator_v2.Event{}}},
+			&loggregator_v2.Envelope{},
+		)
+
+		Expect(egressed("log")).To(Equal(2.0))
+		Expect(egressed("counter")).To(Equal(1.0))
+		Expect(egressed("gauge")).To(Equal(1.0))
+		Expect(egressed("timer")).To(Equal(1.0))
+		Expect(egressed("event")).To(Equal(1.0))
+	})
+
+	It("counts envelope types", func() {
+		c.AddTypes("log", "gauge", "", "log")
+
+		Expect(egressed("log")).To(Equal(2.0))
+		Expect(egressed("gauge")).To(Equal(1.0))
+	})
+
+	It("does nothing when nil", func() {
+		var c *v2.EgressCounter
+
+		Expect(func() { c.Add(&loggregator_v2.Envelope{}) }).ToNot(Panic())
+	})
+
+	Describe("CountingWriter", func() {
+		It("counts successfully written envelopes", func() {
+			spyWriter := &spyWriteCloser{}
+			w := v2.NewCountingWriter(spyWriter, c)
+			e := &loggregator_v2.Envelope{Message: &loggregator_v2.Envelope_Log{Log: &loggregator_v2.Log{}}}
+
+			Expect(w.Write(context.Background(), e)).To(Succeed())
+			spyWriter.err = errors.New("some-error")
+			Expect(w.Write(context.Background(), e)).To(MatchError("some-error"))
+
+			Expect(egressed("log")).To(Equal(1.0))
+		})
+
+		It("closes the writer", func() {
+			spyWriter := &spyWriteCloser{}
+
+			Expect(v2.NewCountingWriter(spyWriter, c).Close()).To(Succeed())
+			Expect(spyWriter.closed).To(BeTrue())
+		})
+	})
+})
+
+type spyWriteCloser struct {
+	err       error
+	closed    bool
+	envelopes []*loggregator_v2.Envelope
+}
+
+func (s *spyWriteCloser) Write(_ context.Context, e *loggregator_v2.Envelope) error {
+	s.envelopes = append(s.envelopes, e)
+	return s.err
+}
+
+func (s *spyWriteCloser) Close() error {
+	s.closed = true
+	return nil
+}
@@ -1,13 +1,17 @@
 package v2
 
-import "code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+import (
+	"context"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+)
 
 type Writer interface {
-	Write(*loggregator_v2.Envelope) error
+	Write(ctx context.Context, msg *loggregator_v2.Envelope) error
 }
 
 type EnvelopeProcessor interface {
-	Process(*loggregator_v2.Envelope) error
+	Process(msg *loggregator_v2.Envelope) error
 }
 
 type EnvelopeWriter struct {
@@ -22,11 +26,11 @@ func NewEnvelopeWriter(w Writer, ps EnvelopeProcessor) EnvelopeWriter {
 	}
 }
 
-func (ew EnvelopeWriter) Write(env *loggregator_v2.Envelope) error {
+func (ew EnvelopeWriter) Write(ctx context.Context, env *loggregator_v2.Envelope) error {
 	err := ew.processor.Process(env)
 	if err != nil {
 		return err
 	}
 
-	return ew.writer.Write(env)
+	return ew.writer.Write(ctx, env)
 }
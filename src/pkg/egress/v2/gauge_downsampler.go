@@ -0,0 +1,216 @@
+package v2
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metrics "code.cloudfoundry.org/go-metric-registry"
+)
+
+// GaugeStatistics are the statistics a GaugeDownsampler emits for every
+// gauge metric: min, max, last and avg.
+type GaugeStatistics []string
+
+// DefaultGaugeStatistics are emitted when no statistics are configured.
+var DefaultGaugeStatistics = GaugeStatistics{"min", "max", "last", "avg"}
+
+// UnmarshalEnv implements envstruct.Unmarshaller.
+// Example input: last,max
+func (s *GaugeStatistics) UnmarshalEnv(v string) error {
+	if v == "" {
+		return nil
+	}
+
+	var stats GaugeStatistics
+	for _, stat := range strings.Split(v, ",") {
+		stat = strings.TrimSpace(stat)
+		switch stat {
+		case "min", "max", "last", "avg":
+			stats = append(stats, stat)
+		default:
+			return fmt.Errorf("unknown gauge statistic %q", stat)
+		}
+	}
+	*s = stats
+
+	return nil
+}
+
+type gaugeSeriesID struct {
+	sourceID   string
+	instanceID string
+	tagsHash   string
+}
+
+// gaugeSeries are the samples of the metrics of a gauge series within the
+// current window.
+type gaugeSeries struct {
+	timestamp int64
+	tags      map[string]string
+	metrics   map[string]*gaugeSamples
+}
+
+type gaugeSamples struct {
+	unit  string
+	min   float64
+	max   float64
+	last  float64
+	sum   float64
+	count int
+}
+
+// GaugeDownsampler aggregates gauge envelopes per source ID, instance ID
+// and tags over a window and writes a single gauge envelope per series
+// when the window ends. For each metric the envelope has the configured
+// statistics: the last value under the metric name and the minimum,
+// maximum and average under the name with a _min, _max and _avg suffix.
+// Other envelopes are written through.
+type GaugeDownsampler struct {
+	// writeMu serializes the writes of the ingest and the flushing
+	// goroutine to the wrapped writer.
+	writeMu sync.Mutex
+	writer  Writer
+	stats   GaugeStatistics
+
+	mu          sync.Mutex
+	series      map[gaugeSeriesID]*gaugeSeries
+	downsampled metrics.Counter
+}
+
+// NewGaugeDownsampler returns a GaugeDownsampler that writes to w every
+// window until ctx is done. If stats is empty DefaultGaugeStatistics are
+// emitted.
+func NewGaugeDownsampler(
+	ctx context.Context,
+	w Writer,
+	window time.Duration,
+	stats GaugeStatistics,
+	m MetricClient,
+) *GaugeDownsampler {
+	if len(stats) == 0 {
+		stats = DefaultGaugeStatistics
+	}
+	d := &GaugeDownsampler{
+		writer: w,
+		stats:  stats,
+		series: make(map[gaugeSeriesID]*gaugeSeries),
+		downsampled: m.NewCounter(
+			"downsampled_gauges",
+			"Total number of gauge envelopes aggregated by gauge downsampling.",
+			metrics.WithMetricLabels(map[string]string{"metric_version": "2.0"}),
+		),
+	}
+	go d.run(ctx, window)
+
+	return d
+}
+
+// Write adds gauge envelopes to their series and writes other envelopes
+// to the wrapped writer.
+func (d *GaugeDownsampler) Write(ctx context.Context, e *loggregator_v2.Envelope) error {
+	g := e.GetGauge()
+	if g == nil {
+		d.writeMu.Lock()
+		defer d.writeMu.Unlock()
+		return d.writer.Write(ctx, e)
+	}
+
+	id := gaugeSeriesID{
+		sourceID:   e.GetSourceId(),
+		instanceID: e.GetInstanceId(),
+		tagsHash:   HashTags(e.GetTags()),
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	s, ok := d.series[id]
+	if !ok {
+		s = &gaugeSeries{metrics: make(map[string]*gaugeSamples)}
+		d.series[id] = s
+	}
+	s.timestamp = e.GetTimestamp()
+	s.tags = e.GetTags()
+	for name, v := range g.GetMetrics() {
+		samples, ok := s.metrics[name]
+		if !ok {
+			samples = &gaugeSamples{min: v.GetValue(), max: v.GetValue()}
+			s.metrics[name] = samples
+		}
+		samples.add(v.GetUnit(), v.GetValue())
+	}
+	d.downsampled.Add(1)
+
+	return nil
+}
+
+func (s *gaugeSamples) add(unit string, v float64) {
+	s.unit = unit
+	s.min = min(s.min, v)
+	s.max = max(s.max, v)
+	s.last = v
+	s.sum += v
+	s.count++
+}
+
+func (d *GaugeDownsampler) run(ctx context.Context, window time.Duration) {
+	ticker := time.NewTicker(window)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			d.Flush(context.Background())
+			return
+		case <-ticker.C:
+			d.Flush(ctx)
+		}
+	}
+}
+
+// Flush writes the aggregated series to the wrapped writer and starts a
+// new window.
+func (d *GaugeDownsampler) Flush(ctx context.Context) {
+	d.mu.Lock()
+	series := d.series
+	d.series = make(map[gaugeSeriesID]*gaugeSeries, len(series))
+	d.mu.Unlock()
+
+	d.writeMu.Lock()
+	defer d.writeMu.Unlock()
+	for id, s := range series {
+		d.writer.Write(ctx, d.envelope(id, s)) //nolint:errcheck
+	}
+}
+
+func (d *GaugeDownsampler) envelope(id gaugeSeriesID, s *gaugeSeries) *loggregator_v2.Envelope {
+	values := make(map[string]*loggregator_v2.GaugeValue, len(s.metrics)*len(d.stats))
+	for name, samples := range s.metrics {
+		for _, stat := range d.stats {
+			switch stat {
+			case "min":
+				values[name+"_min"] = &loggregator_v2.GaugeValue{Unit: samples.unit, Value: samples.min}
+			case "max":
+				values[name+"_max"] = &loggregator_v2.GaugeValue{Unit: samples.unit, Value: samples.max}
+			case "last":
+				values[name] = &loggregator_v2.GaugeValue{Unit: samples.unit, Value: samples.last}
+			case "avg":
+				values[name+"_avg"] = &loggregator_v2.GaugeValue{Unit: samples.unit, Value: samples.sum / float64(samples.count)}
+			}
+		}
+	}
+
+	return &loggregator_v2.Envelope{
+		Timestamp:  s.timestamp,
+		SourceId:   id.sourceID,
+		InstanceId: id.instanceID,
+		Tags:       s.tags,
+		Message: &loggregator_v2.Envelope_Gauge{
+			Gauge: &loggregator_v2.Gauge{Metrics: values},
+		},
+	}
+}
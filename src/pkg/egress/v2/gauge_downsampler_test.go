@@ -0,0 +1,165 @@
+package v2_test
+
+import (
+	"context"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
+	egress "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GaugeDownsampler", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		spy    *laneSpyWriter
+		m      *metricsHelpers.SpyMetricsRegistry
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		spy = &laneSpyWriter{}
+		m = metricsHelpers.NewMetricsRegistry()
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("emits the statistics of every metric of a series per window", func() {
+		d := egress.NewGaugeDownsampler(ctx, spy, time.Hour, nil, m)
+		for i, v := range []float64{3, 1, 5, 2} {
+			e := buildGaugeEnvelope("source-1", map[string]float64{"cpu": v, "memory": 10 * v})
+			e.Timestamp = int64(i)
+			Expect(d.Write(context.Background(), e)).To(Succeed())
+		}
+		Expect(spy.Envelopes()).To(BeEmpty())
+
+		d.Flush(context.Background())
+
+		Expect(spy.Envelopes()).To(HaveLen(1))
+		e := spy.Envelopes()[0]
+		Expect(e.GetSourceId()).To(Equal("source-1"))
+		Expect(e.GetInstanceId()).To(Equal("0"))
+		Expect(e.GetTimestamp()).To(Equal(int64(3)))
+		Expect(e.GetTags()).To(Equal(map[string]string{"job": "diego-cell"}))
+		values := gaugeValues(e)
+		Expect(values).To(Equal(map[string]float64{
+			"cpu":        2,
+			"cpu_min":    1,
+			"cpu_max":    5,
+			"cpu_avg":    2.75,
+			"memory":     20,
+			"memory_min": 10,
+			"memory_max": 50,
+			"memory_avg": 27.5,
+		}))
+		Expect(e.GetGauge().GetMetrics()["cpu_max"].GetUnit()).To(Equal("unit"))
+		Expect(m.GetMetric("downsampled_gauges", map[string]string{"metric_version": "2.0"}).Value()).To(Equal(4.0))
+	})
+
+	It("aggregates series with different tags separately", func() {
+		d := egress.NewGaugeDownsampler(ctx, spy, time.Hour, nil, m)
+		e1 := buildGaugeEnvelope("source-1", map[string]float64{"cpu": 1})
+		e2 := buildGaugeEnvelope("source-1", map[string]float64{"cpu": 2})
+		e2.Tags = map[string]string{"job": "router"}
+		Expect(d.Write(context.Background(), e1)).To(Succeed())
+		Expect(d.Write(context.Background(), e2)).To(Succeed())
+
+		d.Flush(context.Background())
+
+		Expect(spy.Envelopes()).To(HaveLen(2))
+	})
+
+	It("only emits the configured statistics", func() {
+		var stats egress.GaugeStatistics
+		Expect(stats.UnmarshalEnv("last, max")).To(Succeed())
+		d := egress.NewGaugeDownsampler(ctx, spy, time.Hour, stats, m)
+		Expect(d.Write(context.Background(), buildGaugeEnvelope("source-1", map[string]float64{"cpu": 1}))).To(Succeed())
+		Expect(d.Write(context.Background(), buildGaugeEnvelope("source-1", map[string]float64{"cpu": 4}))).To(Succeed())
+
+		d.Flush(context.Background())
+
+		Expect(gaugeValues(spy.Envelopes()[0])).To(Equal(map[string]float64{"cpu": 4, "cpu_max": 4}))
+	})
+
+	It("starts a new window after a flush", func() {
+		d := egress.NewGaugeDownsampler(ctx, spy, time.Hour, nil, m)
+		Expect(d.Write(context.Background(), buildGaugeEnvelope("source-1", map[string]float64{"cpu": 1}))).To(Succeed())
+		d.Flush(context.Background())
+		d.Flush(context.Background())
+
+		Expect(spy.Envelopes()).To(HaveLen(1))
+	})
+
+	It("writes other envelopes through", func() {
+		d := egress.NewGaugeDownsampler(ctx, spy, time.Hour, nil, m)
+		e := buildCounterEnvelope(10, "requests", "source-1")
+		Expect(d.Write(context.Background(), e)).To(Succeed())
+
+		Expect(spy.Envelopes()).To(ConsistOf(e))
+	})
+
+	It("does not write to the wrapped writer while flushing", func() {
+		w := &producerSpyWriter{}
+		d := egress.NewGaugeDownsampler(ctx, w, time.Hour, nil, m)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 1000; i++ {
+				d.Write(context.Background(), buildGaugeEnvelope("source-1", map[string]float64{"cpu": 1})) //nolint:errcheck
+				d.Flush(context.Background())
+			}
+		}()
+		for i := 0; i < 1000; i++ {
+			Expect(d.Write(context.Background(), buildCounterEnvelope(10, "requests", "source-1"))).To(Succeed())
+		}
+		Eventually(done).Should(BeClosed())
+
+		Expect(w.writes.Load()).To(Equal(int64(2000)))
+		Expect(w.concurrent.Load()).To(BeFalse())
+	})
+
+	It("flushes every window and when ctx is done", func() {
+		egress.NewGaugeDownsampler(ctx, spy, 10*time.Millisecond, nil, m).
+			Write(context.Background(), buildGaugeEnvelope("source-1", map[string]float64{"cpu": 1})) //nolint:errcheck
+		Eventually(spy.Envelopes).Should(HaveLen(1))
+
+		d := egress.NewGaugeDownsampler(ctx, spy, time.Hour, nil, m)
+		Expect(d.Write(context.Background(), buildGaugeEnvelope("source-2", map[string]float64{"cpu": 1}))).To(Succeed())
+		cancel()
+		Eventually(spy.Envelopes).Should(HaveLen(2))
+	})
+
+	It("rejects unknown statistics", func() {
+		var stats egress.GaugeStatistics
+		Expect(stats.UnmarshalEnv("min,p99")).To(MatchError(`unknown gauge statistic "p99"`))
+	})
+})
+
+func buildGaugeEnvelope(sourceID string, values map[string]float64) *loggregator_v2.Envelope {
+	metrics := make(map[string]*loggregator_v2.GaugeValue, len(values))
+	for name, v := range values {
+		metrics[name] = &loggregator_v2.GaugeValue{Unit: "unit", Value: v}
+	}
+	return &loggregator_v2.Envelope{
+		SourceId:   sourceID,
+		InstanceId: "0",
+		Tags:       map[string]string{"job": "diego-cell"},
+		Message: &loggregator_v2.Envelope_Gauge{
+			Gauge: &loggregator_v2.Gauge{Metrics: metrics},
+		},
+	}
+}
+
+func gaugeValues(e *loggregator_v2.Envelope) map[string]float64 {
+	values := make(map[string]float64)
+	for name, v := range e.GetGauge().GetMetrics() {
+		values[name] = v.GetValue()
+	}
+	return values
+}
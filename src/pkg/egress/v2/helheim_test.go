@@ -1,4 +1,4 @@
-// This file was generated by github.com/nelsam/hel.  Do not
+// This file was generated by git.sr.ht/~nelsam/hel.  Do not
 // edit this code by hand unless you *really* know what you're
 // doing.  Expect any changes made manually to be overwritten
 // the next time hel regenerates this file.
@@ -6,14 +6,38 @@
 package v2_test
 
 import (
+	"context"
+	"net/http"
+	"time"
+
 	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
 	metrics "code.cloudfoundry.org/go-metric-registry"
+	v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
 )
 
+type mockEnqueueReporter struct {
+	OldestEnqueuedCalled chan bool
+	OldestEnqueuedOutput struct {
+		Ret0 chan time.Time
+	}
+}
+
+func newMockEnqueueReporter() *mockEnqueueReporter {
+	m := &mockEnqueueReporter{}
+	m.OldestEnqueuedCalled = make(chan bool, 100)
+	m.OldestEnqueuedOutput.Ret0 = make(chan time.Time, 100)
+	return m
+}
+func (m *mockEnqueueReporter) OldestEnqueued() time.Time {
+	m.OldestEnqueuedCalled <- true
+	return <-m.OldestEnqueuedOutput.Ret0
+}
+
 type mockWriter struct {
 	WriteCalled chan bool
 	WriteInput  struct {
-		Arg0 chan *loggregator_v2.Envelope
+		Ctx chan context.Context
+		Msg chan *loggregator_v2.Envelope
 	}
 	WriteOutput struct {
 		Ret0 chan error
@@ -23,20 +47,22 @@ type mockWriter struct {
 func newMockWriter() *mockWriter {
 	m := &mockWriter{}
 	m.WriteCalled = make(chan bool, 100)
-	m.WriteInput.Arg0 = make(chan *loggregator_v2.Envelope, 100)
+	m.WriteInput.Ctx = make(chan context.Context, 100)
+	m.WriteInput.Msg = make(chan *loggregator_v2.Envelope, 100)
 	m.WriteOutput.Ret0 = make(chan error, 100)
 	return m
 }
-func (m *mockWriter) Write(arg0 *loggregator_v2.Envelope) error {
+func (m *mockWriter) Write(ctx context.Context, msg *loggregator_v2.Envelope) error {
 	m.WriteCalled <- true
-	m.WriteInput.Arg0 <- arg0
+	m.WriteInput.Ctx <- ctx
+	m.WriteInput.Msg <- msg
 	return <-m.WriteOutput.Ret0
 }
 
 type mockEnvelopeProcessor struct {
 	ProcessCalled chan bool
 	ProcessInput  struct {
-		Arg0 chan *loggregator_v2.Envelope
+		Msg chan *loggregator_v2.Envelope
 	}
 	ProcessOutput struct {
 		Ret0 chan error
@@ -46,16 +72,77 @@ type mockEnvelopeProcessor struct {
 func newMockEnvelopeProcessor() *mockEnvelopeProcessor {
 	m := &mockEnvelopeProcessor{}
 	m.ProcessCalled = make(chan bool, 100)
-	m.ProcessInput.Arg0 = make(chan *loggregator_v2.Envelope, 100)
+	m.ProcessInput.Msg = make(chan *loggregator_v2.Envelope, 100)
 	m.ProcessOutput.Ret0 = make(chan error, 100)
 	return m
 }
-func (m *mockEnvelopeProcessor) Process(arg0 *loggregator_v2.Envelope) error {
+func (m *mockEnvelopeProcessor) Process(msg *loggregator_v2.Envelope) error {
 	m.ProcessCalled <- true
-	m.ProcessInput.Arg0 <- arg0
+	m.ProcessInput.Msg <- msg
 	return <-m.ProcessOutput.Ret0
 }
 
+type mockHTTPClient struct {
+	DoCalled chan bool
+	DoInput  struct {
+		Arg0 chan *http.Request
+	}
+	DoOutput struct {
+		Ret0 chan *http.Response
+		Ret1 chan error
+	}
+}
+
+func newMockHTTPClient() *mockHTTPClient {
+	m := &mockHTTPClient{}
+	m.DoCalled = make(chan bool, 100)
+	m.DoInput.Arg0 = make(chan *http.Request, 100)
+	m.DoOutput.Ret0 = make(chan *http.Response, 100)
+	m.DoOutput.Ret1 = make(chan error, 100)
+	return m
+}
+func (m *mockHTTPClient) Do(arg0 *http.Request) (*http.Response, error) {
+	m.DoCalled <- true
+	m.DoInput.Arg0 <- arg0
+	return <-m.DoOutput.Ret0, <-m.DoOutput.Ret1
+}
+
+type mockIntrospectable struct {
+	StatusCalled chan bool
+	StatusOutput struct {
+		Ret0 chan v2.StageStatus
+	}
+}
+
+func newMockIntrospectable() *mockIntrospectable {
+	m := &mockIntrospectable{}
+	m.StatusCalled = make(chan bool, 100)
+	m.StatusOutput.Ret0 = make(chan v2.StageStatus, 100)
+	return m
+}
+func (m *mockIntrospectable) Status() v2.StageStatus {
+	m.StatusCalled <- true
+	return <-m.StatusOutput.Ret0
+}
+
+type mockQueue struct {
+	LenCalled chan bool
+	LenOutput struct {
+		Ret0 chan int
+	}
+}
+
+func newMockQueue() *mockQueue {
+	m := &mockQueue{}
+	m.LenCalled = make(chan bool, 100)
+	m.LenOutput.Ret0 = make(chan int, 100)
+	return m
+}
+func (m *mockQueue) Len() int {
+	m.LenCalled <- true
+	return <-m.LenOutput.Ret0
+}
+
 type mockNexter struct {
 	TryNextCalled chan bool
 	TryNextOutput struct {
@@ -79,6 +166,7 @@ func (m *mockNexter) TryNext() (*loggregator_v2.Envelope, bool) {
 type mockBatchWriter struct {
 	WriteCalled chan bool
 	WriteInput  struct {
+		Ctx  chan context.Context
 		Msgs chan []*loggregator_v2.Envelope
 	}
 	WriteOutput struct {
@@ -89,12 +177,14 @@ type mockBatchWriter struct {
 func newMockBatchWriter() *mockBatchWriter {
 	m := &mockBatchWriter{}
 	m.WriteCalled = make(chan bool, 100)
+	m.WriteInput.Ctx = make(chan context.Context, 100)
 	m.WriteInput.Msgs = make(chan []*loggregator_v2.Envelope, 100)
 	m.WriteOutput.Ret0 = make(chan error, 100)
 	return m
 }
-func (m *mockBatchWriter) Write(msgs []*loggregator_v2.Envelope) error {
+func (m *mockBatchWriter) Write(ctx context.Context, msgs []*loggregator_v2.Envelope) error {
 	m.WriteCalled <- true
+	m.WriteInput.Ctx <- ctx
 	m.WriteInput.Msgs <- msgs
 	return <-m.WriteOutput.Ret0
 }
@@ -108,6 +198,14 @@ type mockMetricClient struct {
 	NewCounterOutput struct {
 		Ret0 chan metrics.Counter
 	}
+	NewGaugeCalled chan bool
+	NewGaugeInput  struct {
+		Name, HelpText chan string
+		Opts           chan []metrics.MetricOption
+	}
+	NewGaugeOutput struct {
+		Ret0 chan metrics.Gauge
+	}
 }
 
 func newMockMetricClient() *mockMetricClient {
@@ -117,6 +215,11 @@ func newMockMetricClient() *mockMetricClient {
 	m.NewCounterInput.HelpText = make(chan string, 100)
 	m.NewCounterInput.Opts = make(chan []metrics.MetricOption, 100)
 	m.NewCounterOutput.Ret0 = make(chan metrics.Counter, 100)
+	m.NewGaugeCalled = make(chan bool, 100)
+	m.NewGaugeInput.Name = make(chan string, 100)
+	m.NewGaugeInput.HelpText = make(chan string, 100)
+	m.NewGaugeInput.Opts = make(chan []metrics.MetricOption, 100)
+	m.NewGaugeOutput.Ret0 = make(chan metrics.Gauge, 100)
 	return m
 }
 func (m *mockMetricClient) NewCounter(name, helpText string, opts ...metrics.MetricOption) metrics.Counter {
@@ -126,6 +229,68 @@ func (m *mockMetricClient) NewCounter(name, helpText string, opts ...metrics.Met
 	m.NewCounterInput.Opts <- opts
 	return <-m.NewCounterOutput.Ret0
 }
+func (m *mockMetricClient) NewGauge(name, helpText string, opts ...metrics.MetricOption) metrics.Gauge {
+	m.NewGaugeCalled <- true
+	m.NewGaugeInput.Name <- name
+	m.NewGaugeInput.HelpText <- helpText
+	m.NewGaugeInput.Opts <- opts
+	return <-m.NewGaugeOutput.Ret0
+}
+
+type mockContext struct {
+	DeadlineCalled chan bool
+	DeadlineOutput struct {
+		Deadline chan time.Time
+		Ok       chan bool
+	}
+	DoneCalled chan bool
+	DoneOutput struct {
+		Ret0 chan (<-chan struct{})
+	}
+	ErrCalled chan bool
+	ErrOutput struct {
+		Ret0 chan error
+	}
+	ValueCalled chan bool
+	ValueInput  struct {
+		Key chan any
+	}
+	ValueOutput struct {
+		Ret0 chan any
+	}
+}
+
+func newMockContext() *mockContext {
+	m := &mockContext{}
+	m.DeadlineCalled = make(chan bool, 100)
+	m.DeadlineOutput.Deadline = make(chan time.Time, 100)
+	m.DeadlineOutput.Ok = make(chan bool, 100)
+	m.DoneCalled = make(chan bool, 100)
+	m.DoneOutput.Ret0 = make(chan (<-chan struct{}), 100)
+	m.ErrCalled = make(chan bool, 100)
+	m.ErrOutput.Ret0 = make(chan error, 100)
+	m.ValueCalled = make(chan bool, 100)
+	m.ValueInput.Key = make(chan any, 100)
+	m.ValueOutput.Ret0 = make(chan any, 100)
+	return m
+}
+func (m *mockContext) Deadline() (deadline time.Time, ok bool) {
+	m.DeadlineCalled <- true
+	return <-m.DeadlineOutput.Deadline, <-m.DeadlineOutput.Ok
+}
+func (m *mockContext) Done() <-chan struct{} {
+	m.DoneCalled <- true
+	return <-m.DoneOutput.Ret0
+}
+func (m *mockContext) Err() error {
+	m.ErrCalled <- true
+	return <-m.ErrOutput.Ret0
+}
+func (m *mockContext) Value(key any) any {
+	m.ValueCalled <- true
+	m.ValueInput.Key <- key
+	return <-m.ValueOutput.Ret0
+}
 
 type mockCounter struct {
 	AddCalled chan bool
@@ -144,3 +309,31 @@ func (m *mockCounter) Add(arg0 float64) {
 	m.AddCalled <- true
 	m.AddInput.Arg0 <- arg0
 }
+
+type mockGauge struct {
+	AddCalled chan bool
+	AddInput  struct {
+		Arg0 chan float64
+	}
+	SetCalled chan bool
+	SetInput  struct {
+		Arg0 chan float64
+	}
+}
+
+func newMockGauge() *mockGauge {
+	m := &mockGauge{}
+	m.AddCalled = make(chan bool, 100)
+	m.AddInput.Arg0 = make(chan float64, 100)
+	m.SetCalled = make(chan bool, 100)
+	m.SetInput.Arg0 = make(chan float64, 100)
+	return m
+}
+func (m *mockGauge) Add(arg0 float64) {
+	m.AddCalled <- true
+	m.AddInput.Arg0 <- arg0
+}
+func (m *mockGauge) Set(arg0 float64) {
+	m.SetCalled <- true
+	m.SetInput.Arg0 <- arg0
+}
@@ -0,0 +1,98 @@
+package v2
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+)
+
+// IDRewriteRule rewrites the source ID or instance ID of envelopes. The
+// Pattern is a regular expression and the Replacement may refer to its
+// submatches, e.g. $1, as in regexp.Regexp.ReplaceAllString.
+type IDRewriteRule struct {
+	// Field is the ID to rewrite: source_id or instance_id.
+	Field       string `json:"field"`
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+}
+
+// IDRewriter rewrites the source IDs and instance IDs of envelopes, e.g. to
+// strip deployment prefixes or to map the GUIDs of system components to
+// names, for downstream systems that key on human-readable identifiers.
+// The zero IDRewriter rewrites nothing.
+type IDRewriter struct {
+	rules []compiledIDRewriteRule
+}
+
+type compiledIDRewriteRule struct {
+	IDRewriteRule
+	re *regexp.Regexp
+}
+
+// NewIDRewriter returns an IDRewriter that applies the rules in order. A
+// rule sees the IDs as rewritten by the rules before it.
+func NewIDRewriter(rules []IDRewriteRule) (IDRewriter, error) {
+	r := IDRewriter{rules: make([]compiledIDRewriteRule, 0, len(rules))}
+	for _, rule := range rules {
+		if rule.Field != "source_id" && rule.Field != "instance_id" {
+			return IDRewriter{}, fmt.Errorf("unknown id rewrite field: %q", rule.Field)
+		}
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return IDRewriter{}, fmt.Errorf("invalid id rewrite pattern %q: %s", rule.Pattern, err)
+		}
+		r.rules = append(r.rules, compiledIDRewriteRule{IDRewriteRule: rule, re: re})
+	}
+
+	return r, nil
+}
+
+// UnmarshalEnv implements envstruct.Unmarshaller.
+// Example input:
+// [{"field":"source_id","pattern":"^cf-(.*)$","replacement":"$1"}]
+func (r *IDRewriter) UnmarshalEnv(v string) error {
+	if v == "" {
+		return nil
+	}
+
+	var rules []IDRewriteRule
+	if err := json.Unmarshal([]byte(v), &rules); err != nil {
+		return fmt.Errorf("invalid id rewrite rules: %s", err)
+	}
+
+	parsed, err := NewIDRewriter(rules)
+	if err != nil {
+		return err
+	}
+	*r = parsed
+
+	return nil
+}
+
+// MarshalJSON encodes the rules.
+func (r IDRewriter) MarshalJSON() ([]byte, error) {
+	rules := make([]IDRewriteRule, 0, len(r.rules))
+	for _, rule := range r.rules {
+		rules = append(rules, rule.IDRewriteRule)
+	}
+	return json.Marshal(rules)
+}
+
+// IsZero reports whether the IDRewriter has no rules.
+func (r IDRewriter) IsZero() bool {
+	return len(r.rules) == 0
+}
+
+// RewriteEnvelope rewrites the IDs of the envelope that match the rules.
+func (r IDRewriter) RewriteEnvelope(e *loggregator_v2.Envelope) {
+	for _, rule := range r.rules {
+		switch rule.Field {
+		case "source_id":
+			e.SourceId = rule.re.ReplaceAllString(e.GetSourceId(), rule.Replacement)
+		case "instance_id":
+			e.InstanceId = rule.re.ReplaceAllString(e.GetInstanceId(), rule.Replacement)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package v2_test
+
+import (
+	"encoding/json"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("IDRewriter", func() {
+	It("rewrites the source id and instance id", func() {
+		r, err := v2.NewIDRewriter([]v2.IDRewriteRule{
+			{Field: "source_id", Pattern: "^cf-(.*)$", Replacement: "$1"},
+			{Field: "source_id", Pattern: "^6e1b2f9c-guid$", Replacement: "gorouter"},
+			{Field: "instance_id", Pattern: "^(.{8}).*$", Replacement: "$1"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		e := &loggregator_v2.Envelope{SourceId: "cf-6e1b2f9c-guid", InstanceId: "0123456789abcdef"}
+		r.RewriteEnvelope(e)
+
+		Expect(e.GetSourceId()).To(Equal("gorouter"))
+		Expect(e.GetInstanceId()).To(Equal("01234567"))
+	})
+
+	It("does not change ids that do not match", func() {
+		r, err := v2.NewIDRewriter([]v2.IDRewriteRule{
+			{Field: "source_id", Pattern: "^cf-(.*)$", Replacement: "$1"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		e := &loggregator_v2.Envelope{SourceId: "some-source", InstanceId: "0"}
+		r.RewriteEnvelope(e)
+
+		Expect(e.GetSourceId()).To(Equal("some-source"))
+		Expect(e.GetInstanceId()).To(Equal("0"))
+	})
+
+	It("returns an error for invalid rules", func() {
+		_, err := v2.NewIDRewriter([]v2.IDRewriteRule{{Field: "tags", Pattern: ".*"}})
+		Expect(err).To(MatchError(`unknown id rewrite field: "tags"`))
+
+		_, err = v2.NewIDRewriter([]v2.IDRewriteRule{{Field: "source_id", Pattern: "("}})
+		Expect(err).To(HaveOccurred())
+	})
+
+	Describe("UnmarshalEnv()", func() {
+		It("parses the rules from JSON", func() {
+			var r v2.IDRewriter
+			Expect(r.UnmarshalEnv(`[{"field":"source_id","pattern":"^cf-","replacement":""}]`)).To(Succeed())
+
+			e := &loggregator_v2.Envelope{SourceId: "cf-some-source"}
+			r.RewriteEnvelope(e)
+			Expect(e.GetSourceId()).To(Equal("some-source"))
+
+			b, err := json.Marshal(r)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(b).To(MatchJSON(`[{"field":"source_id","pattern":"^cf-","replacement":""}]`))
+		})
+
+		It("leaves the rewriter empty for an empty value", func() {
+			var r v2.IDRewriter
+			Expect(r.UnmarshalEnv("")).To(Succeed())
+			Expect(r.IsZero()).To(BeTrue())
+		})
+
+		It("returns an error for invalid JSON", func() {
+			var r v2.IDRewriter
+			Expect(r.UnmarshalEnv("{")).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,136 @@
+package v2
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// StageStatus reports the state of a single stage of the envelope
+// pipeline.
+type StageStatus struct {
+	Stage           string     `json:"stage"`
+	QueueDepth      int        `json:"queue_depth"`
+	BatchAgeSeconds float64    `json:"batch_age_seconds,omitempty"`
+	LastError       string     `json:"last_error,omitempty"`
+	LastErrorAt     *time.Time `json:"last_error_at,omitempty"`
+}
+
+// Introspectable is a pipeline stage that can report its status.
+type Introspectable interface {
+	Status() StageStatus
+}
+
+// Queue is a pipeline stage that buffers envelopes, such as a diode.
+type Queue interface {
+	Len() int
+}
+
+type queueStatus struct {
+	q Queue
+}
+
+// QueueStatus returns an Introspectable that reports the depth of q.
+func QueueStatus(q Queue) Introspectable {
+	return queueStatus{q: q}
+}
+
+func (s queueStatus) Status() StageStatus {
+	return StageStatus{QueueDepth: s.q.Len()}
+}
+
+// Introspector collects the status of the registered pipeline stages and
+// serves them as JSON for debugging.
+type Introspector struct {
+	mu     sync.Mutex
+	names  []string
+	stages []Introspectable
+}
+
+// NewIntrospector returns an Introspector without any stages.
+func NewIntrospector() *Introspector {
+	return &Introspector{}
+}
+
+// Register adds a stage with the given name. Stages are reported in the
+// order they are registered.
+func (i *Introspector) Register(name string, s Introspectable) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.names = append(i.names, name)
+	i.stages = append(i.stages, s)
+}
+
+// Unregister removes the stages with the given name.
+func (i *Introspector) Unregister(name string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	for idx := 0; idx < len(i.names); {
+		if i.names[idx] != name {
+			idx++
+			continue
+		}
+		i.names = append(i.names[:idx], i.names[idx+1:]...)
+		i.stages = append(i.stages[:idx], i.stages[idx+1:]...)
+	}
+}
+
+// Status returns the status of all registered stages.
+func (i *Introspector) Status() []StageStatus {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	statuses := make([]StageStatus, 0, len(i.stages))
+	for idx, s := range i.stages {
+		status := s.Status()
+		status.Stage = i.names[idx]
+		statuses = append(statuses, status)
+	}
+
+	return statuses
+}
+
+// ServeHTTP writes the status of all registered stages as JSON.
+func (i *Introspector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]StageStatus{"stages": i.Status()}) //nolint:errcheck
+}
+
+// DebugHandler returns a handler that serves the pipeline status on
+// /debug/pipeline and everything else, such as pprof, with next.
+func DebugHandler(i *Introspector, next http.Handler) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/pipeline", i)
+	mux.Handle("/", next)
+	return mux
+}
+
+// stageError records the last error of a pipeline stage.
+type stageError struct {
+	mu  sync.Mutex
+	err error
+	at  time.Time
+}
+
+func (e *stageError) set(err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.err = err
+	e.at = time.Now()
+}
+
+func (e *stageError) apply(s *StageStatus) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.err == nil {
+		return
+	}
+	at := e.at
+	s.LastError = e.err.Error()
+	s.LastErrorAt = &at
+}
@@ -0,0 +1,81 @@
+package v2_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	egress "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Introspector", func() {
+	var i *egress.Introspector
+
+	BeforeEach(func() {
+		i = egress.NewIntrospector()
+		i.Register("ingress", egress.QueueStatus(spyQueue(7)))
+		i.Register("writer", spyStage{status: egress.StageStatus{LastError: "some-error"}})
+	})
+
+	It("reports the status of the registered stages in order", func() {
+		Expect(i.Status()).To(Equal([]egress.StageStatus{
+			{Stage: "ingress", QueueDepth: 7},
+			{Stage: "writer", LastError: "some-error"},
+		}))
+	})
+
+	It("does not report unregistered stages", func() {
+		i.Unregister("ingress")
+
+		Expect(i.Status()).To(Equal([]egress.StageStatus{
+			{Stage: "writer", LastError: "some-error"},
+		}))
+	})
+
+	It("serves the status as JSON", func() {
+		rec := httptest.NewRecorder()
+		i.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/pipeline", nil))
+
+		Expect(rec.Header().Get("Content-Type")).To(Equal("application/json"))
+		Expect(rec.Body.String()).To(MatchJSON(`{"stages": [
+			{"stage": "ingress", "queue_depth": 7},
+			{"stage": "writer", "queue_depth": 0, "last_error": "some-error"}
+		]}`))
+	})
+
+	Describe("DebugHandler", func() {
+		It("serves the pipeline status and delegates other paths", func() {
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusTeapot)
+			})
+			h := egress.DebugHandler(i, next)
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/pipeline", nil))
+			var body map[string][]egress.StageStatus
+			Expect(json.Unmarshal(rec.Body.Bytes(), &body)).To(Succeed())
+			Expect(body["stages"]).To(HaveLen(2))
+
+			rec = httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil))
+			Expect(rec.Code).To(Equal(http.StatusTeapot))
+		})
+	})
+})
+
+type spyQueue int
+
+func (q spyQueue) Len() int {
+	return int(q)
+}
+
+type spyStage struct {
+	status egress.StageStatus
+}
+
+func (s spyStage) Status() egress.StageStatus {
+	return s.status
+}
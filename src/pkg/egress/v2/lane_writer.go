@@ -0,0 +1,68 @@
+package v2
+
+import (
+	"context"
+	"hash/fnv"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+)
+
+// LaneWriter writes envelopes through one of several lanes chosen by their
+// source ID. Each lane writes its envelopes in order in its own goroutine,
+// so the envelopes of a source ID keep their order while different source
+// IDs are written in parallel.
+//
+// A source ID that sends faster than its lane can write is not spread
+// across lanes, so the throughput of a single source ID is bounded by one
+// lane.
+type LaneWriter struct {
+	lanes []chan *loggregator_v2.Envelope
+}
+
+// NewLaneWriter returns a LaneWriter with one lane per writer. Since all
+// envelopes of a source ID are written by the same writer, writers may keep
+// per-source state such as a CounterAggregator without locking. Each lane
+// buffers up to bufferSize envelopes. The lanes stop when ctx is done.
+func NewLaneWriter(ctx context.Context, writers []Writer, bufferSize int) *LaneWriter {
+	lw := &LaneWriter{
+		lanes: make([]chan *loggregator_v2.Envelope, len(writers)),
+	}
+	for i, w := range writers {
+		lane := make(chan *loggregator_v2.Envelope, bufferSize)
+		lw.lanes[i] = lane
+		go runLane(ctx, lane, w)
+	}
+
+	return lw
+}
+
+// Write queues the envelope on the lane of its source ID. It blocks while
+// the lane is full and returns an error if ctx is done first.
+func (lw *LaneWriter) Write(ctx context.Context, e *loggregator_v2.Envelope) error {
+	lane := lw.lanes[LaneIndex(e.GetSourceId(), len(lw.lanes))]
+	select {
+	case lane <- e:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func runLane(ctx context.Context, lane <-chan *loggregator_v2.Envelope, w Writer) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-lane:
+			w.Write(ctx, e) //nolint:errcheck
+		}
+	}
+}
+
+// LaneIndex returns the lane of the source ID out of n lanes.
+func LaneIndex(sourceID string, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(sourceID)) //nolint:errcheck
+
+	return int(h.Sum32() % uint32(n)) //nolint:gosec
+}
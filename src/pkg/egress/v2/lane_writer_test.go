@@ -0,0 +1,177 @@
+package v2_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
+	"google.golang.org/protobuf/proto"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LaneWriter", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("writes the envelopes of a source ID in order through one lane", func() {
+		lanes := []*laneSpyWriter{{}, {}, {}, {}}
+		lw := v2.NewLaneWriter(ctx, []v2.Writer{lanes[0], lanes[1], lanes[2], lanes[3]}, 10)
+
+		for i := 0; i < 100; i++ {
+			Expect(lw.Write(context.Background(), &loggregator_v2.Envelope{
+				SourceId:  fmt.Sprintf("source-%d", i%10),
+				Timestamp: int64(i),
+			})).To(Succeed())
+		}
+
+		Eventually(func() int {
+			var n int
+			for _, l := range lanes {
+				n += len(l.Envelopes())
+			}
+			return n
+		}).Should(Equal(100))
+
+		for i, l := range lanes {
+			last := make(map[string]int64)
+			for _, e := range l.Envelopes() {
+				Expect(v2.LaneIndex(e.GetSourceId(), 4)).To(Equal(i))
+				if ts, ok := last[e.GetSourceId()]; ok {
+					Expect(e.GetTimestamp()).To(BeNumerically(">", ts))
+				}
+				last[e.GetSourceId()] = e.GetTimestamp()
+			}
+		}
+	})
+
+	It("writes different source IDs in parallel", func() {
+		blocked := &laneSpyWriter{block: make(chan struct{})}
+		other := &laneSpyWriter{}
+		lw := v2.NewLaneWriter(ctx, []v2.Writer{blocked, other}, 1)
+		defer close(blocked.block)
+
+		var blockedID, otherID string
+		for i := 0; blockedID == "" || otherID == ""; i++ {
+			id := fmt.Sprintf("source-%d", i)
+			if v2.LaneIndex(id, 2) == 0 {
+				blockedID = id
+			} else {
+				otherID = id
+			}
+		}
+
+		Expect(lw.Write(context.Background(), &loggregator_v2.Envelope{SourceId: blockedID})).To(Succeed())
+		Expect(lw.Write(context.Background(), &loggregator_v2.Envelope{SourceId: otherID})).To(Succeed())
+
+		Eventually(other.Envelopes).Should(HaveLen(1))
+	})
+
+	It("returns an error when the lane is full and the context is done", func() {
+		blocked := &laneSpyWriter{block: make(chan struct{})}
+		lw := v2.NewLaneWriter(ctx, []v2.Writer{blocked}, 1)
+		defer close(blocked.block)
+
+		writeCtx, writeCancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer writeCancel()
+		var err error
+		for i := 0; i < 3 && err == nil; i++ {
+			err = lw.Write(writeCtx, &loggregator_v2.Envelope{SourceId: "some-source"})
+		}
+
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+	})
+})
+
+type laneSpyWriter struct {
+	mu        sync.Mutex
+	envelopes []*loggregator_v2.Envelope
+	block     chan struct{}
+}
+
+func (w *laneSpyWriter) Write(_ context.Context, e *loggregator_v2.Envelope) error {
+	if w.block != nil {
+		<-w.block
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.envelopes = append(w.envelopes, e)
+	return nil
+}
+
+func (w *laneSpyWriter) Envelopes() []*loggregator_v2.Envelope {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]*loggregator_v2.Envelope(nil), w.envelopes...)
+}
+
+// marshallingWriter marshals envelopes, like a writer that sends them
+// downstream, and counts the written envelopes.
+type marshallingWriter struct {
+	written *int64
+}
+
+func (w marshallingWriter) Write(_ context.Context, e *loggregator_v2.Envelope) error {
+	if _, err := proto.Marshal(e); err != nil {
+		return err
+	}
+	atomic.AddInt64(w.written, 1)
+	return nil
+}
+
+func BenchmarkLaneWriter1Lane(b *testing.B)  { benchmarkLaneWriter(b, 1, 100) }
+func BenchmarkLaneWriter4Lanes(b *testing.B) { benchmarkLaneWriter(b, 4, 100) }
+func BenchmarkLaneWriter8Lanes(b *testing.B) { benchmarkLaneWriter(b, 8, 100) }
+
+// BenchmarkLaneWriterHotSource writes a single source ID, which is limited
+// to the throughput of one lane however many lanes there are.
+func BenchmarkLaneWriterHotSource(b *testing.B) { benchmarkLaneWriter(b, 8, 1) }
+
+func benchmarkLaneWriter(b *testing.B, lanes, sources int) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var written int64
+	writers := make([]v2.Writer, lanes)
+	for i := range writers {
+		writers[i] = marshallingWriter{written: &written}
+	}
+	lw := v2.NewLaneWriter(ctx, writers, 1000)
+
+	envs := make([]*loggregator_v2.Envelope, sources)
+	for i := range envs {
+		envs[i] = &loggregator_v2.Envelope{
+			SourceId: fmt.Sprintf("source-%d", i),
+			Tags:     map[string]string{"deployment": "cf", "job": "diego-cell", "index": "0"},
+			Message: &loggregator_v2.Envelope_Log{
+				Log: &loggregator_v2.Log{Payload: bytes.Repeat([]byte("a"), 1024)},
+			},
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lw.Write(ctx, envs[i%len(envs)]) //nolint:errcheck
+	}
+	for atomic.LoadInt64(&written) < int64(b.N) {
+		runtime.Gosched()
+	}
+}
@@ -0,0 +1,149 @@
+package v2
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+)
+
+// MetricRule renames the metrics of counter, gauge and timer envelopes
+// whose names match Pattern, or promotes matching counters to gauges.
+type MetricRule struct {
+	// Pattern is a regular expression that the metric name must match.
+	Pattern string `json:"pattern"`
+	// Rename replaces the matches of Pattern. It may refer to submatches,
+	// e.g. $1, as in regexp.Regexp.ReplaceAllString.
+	Rename string `json:"rename,omitempty"`
+	// UnderscoreDots replaces the dots in the name with underscores, after
+	// Rename.
+	UnderscoreDots bool `json:"underscore_dots,omitempty"`
+	// PromoteToGauge writes counters as gauges with the counter total as
+	// their value.
+	PromoteToGauge bool `json:"promote_to_gauge,omitempty"`
+}
+
+// MetricRules rename metrics and promote counters to gauges, for
+// downstream dashboards that depend on names that differ between emitters.
+// The zero MetricRules changes nothing.
+type MetricRules struct {
+	rules []compiledMetricRule
+}
+
+type compiledMetricRule struct {
+	MetricRule
+	re *regexp.Regexp
+}
+
+// NewMetricRules returns MetricRules that apply the rules in order. A rule
+// sees the names as renamed by the rules before it.
+func NewMetricRules(rules []MetricRule) (MetricRules, error) {
+	r := MetricRules{rules: make([]compiledMetricRule, 0, len(rules))}
+	for _, rule := range rules {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return MetricRules{}, fmt.Errorf("invalid metric rule pattern %q: %s", rule.Pattern, err)
+		}
+		if rule.Rename == "" && !rule.UnderscoreDots && !rule.PromoteToGauge {
+			return MetricRules{}, fmt.Errorf("metric rule for %q does nothing", rule.Pattern)
+		}
+		r.rules = append(r.rules, compiledMetricRule{MetricRule: rule, re: re})
+	}
+
+	return r, nil
+}
+
+// UnmarshalEnv implements envstruct.Unmarshaller.
+// Example input:
+// [{"pattern":"\\.","underscore_dots":true},{"pattern":"^requests$","promote_to_gauge":true}]
+func (r *MetricRules) UnmarshalEnv(v string) error {
+	if v == "" {
+		return nil
+	}
+
+	var rules []MetricRule
+	if err := json.Unmarshal([]byte(v), &rules); err != nil {
+		return fmt.Errorf("invalid metric rules: %s", err)
+	}
+
+	parsed, err := NewMetricRules(rules)
+	if err != nil {
+		return err
+	}
+	*r = parsed
+
+	return nil
+}
+
+// MarshalJSON encodes the rules.
+func (r MetricRules) MarshalJSON() ([]byte, error) {
+	rules := make([]MetricRule, 0, len(r.rules))
+	for _, rule := range r.rules {
+		rules = append(rules, rule.MetricRule)
+	}
+	return json.Marshal(rules)
+}
+
+// IsZero reports whether there are no rules.
+func (r MetricRules) IsZero() bool {
+	return len(r.rules) == 0
+}
+
+// Process applies the rules to the envelope. Counters must already have
+// their total set, e.g. by a CounterAggregator, to be promoted to gauges.
+func (r MetricRules) Process(e *loggregator_v2.Envelope) error {
+	switch m := e.Message.(type) {
+	case *loggregator_v2.Envelope_Counter:
+		name, promote := r.apply(m.Counter.GetName())
+		m.Counter.Name = name
+		if promote {
+			e.Message = &loggregator_v2.Envelope_Gauge{
+				Gauge: &loggregator_v2.Gauge{
+					Metrics: map[string]*loggregator_v2.GaugeValue{
+						name: {Value: float64(m.Counter.GetTotal())},
+					},
+				},
+			}
+		}
+	case *loggregator_v2.Envelope_Gauge:
+		renamed := make(map[string]string)
+		for name := range m.Gauge.GetMetrics() {
+			if n, _ := r.apply(name); n != name {
+				renamed[name] = n
+			}
+		}
+		values := make(map[string]*loggregator_v2.GaugeValue, len(renamed))
+		for name := range renamed {
+			values[name] = m.Gauge.Metrics[name]
+			delete(m.Gauge.Metrics, name)
+		}
+		for name, n := range renamed {
+			m.Gauge.Metrics[n] = values[name]
+		}
+	case *loggregator_v2.Envelope_Timer:
+		m.Timer.Name, _ = r.apply(m.Timer.GetName())
+	}
+
+	return nil
+}
+
+// apply returns the name as renamed by the rules and whether a matching
+// rule promotes counters to gauges.
+func (r MetricRules) apply(name string) (string, bool) {
+	var promote bool
+	for _, rule := range r.rules {
+		if !rule.re.MatchString(name) {
+			continue
+		}
+		if rule.Rename != "" {
+			name = rule.re.ReplaceAllString(name, rule.Rename)
+		}
+		if rule.UnderscoreDots {
+			name = strings.ReplaceAll(name, ".", "_")
+		}
+		promote = promote || rule.PromoteToGauge
+	}
+	return name, promote
+}
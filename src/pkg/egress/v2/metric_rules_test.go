@@ -0,0 +1,96 @@
+package v2_test
+
+import (
+	"encoding/json"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MetricRules", func() {
+	It("renames counters, gauges and timers", func() {
+		r, err := v2.NewMetricRules([]v2.MetricRule{
+			{Pattern: `^legacy\.(.*)$`, Rename: "$1"},
+			{Pattern: `\.`, UnderscoreDots: true},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		counter := &loggregator_v2.Envelope{Message: &loggregator_v2.Envelope_Counter{
+			Counter: &loggregator_v2.Counter{Name: "legacy.route.requests", Total: 5},
+		}}
+		gauge := &loggregator_v2.Envelope{Message: &loggregator_v2.Envelope_Gauge{
+			Gauge: &loggregator_v2.Gauge{Metrics: map[string]*loggregator_v2.GaugeValue{
+				"memory.used": {Unit: "bytes", Value: 1},
+				"cpu":         {Unit: "percentage", Value: 2},
+			}},
+		}}
+		timer := &loggregator_v2.Envelope{Message: &loggregator_v2.Envelope_Timer{
+			Timer: &loggregator_v2.Timer{Name: "http.request"},
+		}}
+		for _, e := range []*loggregator_v2.Envelope{counter, gauge, timer} {
+			Expect(r.Process(e)).To(Succeed())
+		}
+
+		Expect(counter.GetCounter().GetName()).To(Equal("route_requests"))
+		Expect(gauge.GetGauge().GetMetrics()).To(HaveLen(2))
+		Expect(gauge.GetGauge().GetMetrics()["memory_used"].GetValue()).To(Equal(1.0))
+		Expect(gauge.GetGauge().GetMetrics()["cpu"].GetValue()).To(Equal(2.0))
+		Expect(timer.GetTimer().GetName()).To(Equal("http_request"))
+	})
+
+	It("promotes counters to gauges with the counter total", func() {
+		r, err := v2.NewMetricRules([]v2.MetricRule{
+			{Pattern: "^requests$", PromoteToGauge: true},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		e := &loggregator_v2.Envelope{
+			SourceId: "gorouter",
+			Message: &loggregator_v2.Envelope_Counter{
+				Counter: &loggregator_v2.Counter{Name: "requests", Delta: 1, Total: 42},
+			},
+		}
+		Expect(r.Process(e)).To(Succeed())
+
+		Expect(e.GetCounter()).To(BeNil())
+		Expect(e.GetSourceId()).To(Equal("gorouter"))
+		Expect(e.GetGauge().GetMetrics()).To(HaveKeyWithValue("requests", HaveField("Value", 42.0)))
+	})
+
+	It("does not change metrics that do not match", func() {
+		r, err := v2.NewMetricRules([]v2.MetricRule{
+			{Pattern: "^requests$", PromoteToGauge: true},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		e := &loggregator_v2.Envelope{Message: &loggregator_v2.Envelope_Counter{
+			Counter: &loggregator_v2.Counter{Name: "requests.total", Total: 42},
+		}}
+		Expect(r.Process(e)).To(Succeed())
+
+		Expect(e.GetCounter().GetName()).To(Equal("requests.total"))
+	})
+
+	It("loads and reports rules from the environment", func() {
+		var r v2.MetricRules
+		Expect(r.IsZero()).To(BeTrue())
+
+		input := `[{"pattern":"\\.","underscore_dots":true},{"pattern":"^requests$","promote_to_gauge":true}]`
+		Expect(r.UnmarshalEnv(input)).To(Succeed())
+		Expect(r.IsZero()).To(BeFalse())
+
+		b, err := json.Marshal(r)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(b).To(MatchJSON(input))
+	})
+
+	It("rejects invalid rules", func() {
+		var r v2.MetricRules
+		Expect(r.UnmarshalEnv(`{}`)).To(MatchError(ContainSubstring("invalid metric rules")))
+		Expect(r.UnmarshalEnv(`[{"pattern":"(","underscore_dots":true}]`)).To(MatchError(ContainSubstring("invalid metric rule pattern")))
+		Expect(r.UnmarshalEnv(`[{"pattern":"requests"}]`)).To(MatchError(`metric rule for "requests" does nothing`))
+	})
+})
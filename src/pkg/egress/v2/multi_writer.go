@@ -0,0 +1,35 @@
+package v2
+
+import (
+	"context"
+	"sync"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+)
+
+// MultiWriter writes every envelope to all of its writers. Writes are
+// serialized so that several goroutines can write through it to writers
+// that only support a single producer, e.g. writers backed by a one to one
+// diode.
+type MultiWriter struct {
+	mu      sync.Mutex
+	writers []Writer
+}
+
+func NewMultiWriter(writers ...Writer) *MultiWriter {
+	return &MultiWriter{
+		writers: writers,
+	}
+}
+
+// Write writes the envelope to all writers. Errors of the writers are
+// ignored.
+func (mw *MultiWriter) Write(ctx context.Context, e *loggregator_v2.Envelope) error {
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+
+	for _, w := range mw.writers {
+		w.Write(ctx, e) //nolint:errcheck
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package v2_test
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MultiWriter", func() {
+	It("writes the envelope to all writers", func() {
+		w1, w2 := &producerSpyWriter{}, &producerSpyWriter{err: errors.New("some-error")}
+		mw := v2.NewMultiWriter(w1, w2)
+
+		Expect(mw.Write(context.Background(), &loggregator_v2.Envelope{})).To(Succeed())
+
+		Expect(w1.writes.Load()).To(Equal(int64(1)))
+		Expect(w2.writes.Load()).To(Equal(int64(1)))
+	})
+
+	It("serializes the writes of several goroutines", func() {
+		w := &producerSpyWriter{}
+		mw := v2.NewMultiWriter(w)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					mw.Write(context.Background(), &loggregator_v2.Envelope{}) //nolint:errcheck
+				}
+			}()
+		}
+		wg.Wait()
+
+		Expect(w.writes.Load()).To(Equal(int64(1000)))
+		Expect(w.concurrent.Load()).To(BeFalse())
+	})
+})
+
+// producerSpyWriter records whether it was written to by several
+// goroutines at once.
+type producerSpyWriter struct {
+	inFlight   atomic.Int64
+	writes     atomic.Int64
+	concurrent atomic.Bool
+	err        error
+}
+
+func (w *producerSpyWriter) Write(context.Context, *loggregator_v2.Envelope) error {
+	if w.inFlight.Add(1) > 1 {
+		w.concurrent.Store(true)
+	}
+	defer w.inFlight.Add(-1)
+	w.writes.Add(1)
+	runtime.Gosched()
+	return w.err
+}
@@ -0,0 +1,178 @@
+package v2
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+)
+
+// HTTPClient is the interface used to fetch placement metadata from an
+// endpoint.
+type HTTPClient interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+// PlacementSource returns placement metadata such as the Diego cell ID,
+// isolation segment, or Kubernetes node and pod names.
+type PlacementSource func() (map[string]string, error)
+
+// PlacementFromFile reads placement metadata from a file. The file either
+// contains a JSON object of strings or key=value lines as written by the
+// Kubernetes downward API.
+func PlacementFromFile(path string) PlacementSource {
+	return func() (map[string]string, error) {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		return parsePlacement(b)
+	}
+}
+
+// PlacementFromEndpoint fetches placement metadata as a JSON object of
+// strings from the given URL.
+func PlacementFromEndpoint(url string, c HTTPClient) PlacementSource {
+	return func() (map[string]string, error) {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := c.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+		}
+
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		return parsePlacement(b)
+	}
+}
+
+func parsePlacement(b []byte) (map[string]string, error) {
+	b = bytes.TrimSpace(b)
+	if bytes.HasPrefix(b, []byte("{")) {
+		var m map[string]string
+		if err := json.Unmarshal(b, &m); err != nil {
+			return nil, fmt.Errorf("invalid placement metadata: %s", err)
+		}
+		return m, nil
+	}
+
+	m := make(map[string]string)
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid placement metadata line: %q", line)
+		}
+		if unquoted, err := strconv.Unquote(v); err == nil {
+			v = unquoted
+		}
+		m[strings.TrimSpace(k)] = v
+	}
+
+	return m, s.Err()
+}
+
+// PlacementTagger adds placement metadata as tags on envelopes. The
+// metadata is read from the source on creation and refreshed on an
+// interval. If a refresh fails the last known metadata is kept.
+type PlacementTagger struct {
+	source PlacementSource
+
+	mu   sync.RWMutex
+	tags map[string]string
+}
+
+// DefaultPlacementRefreshInterval is the refresh interval of a
+// PlacementTagger that is created without a positive interval.
+const DefaultPlacementRefreshInterval = time.Minute
+
+// NewPlacementTagger returns a PlacementTagger that refreshes its metadata
+// from source every interval until ctx is done. If interval is not positive
+// DefaultPlacementRefreshInterval is used.
+func NewPlacementTagger(ctx context.Context, source PlacementSource, interval time.Duration) *PlacementTagger {
+	if interval <= 0 {
+		interval = DefaultPlacementRefreshInterval
+	}
+	t := &PlacementTagger{
+		source: source,
+	}
+	t.refresh()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				t.refresh()
+			}
+		}
+	}()
+
+	return t
+}
+
+func (t *PlacementTagger) refresh() {
+	tags, err := t.source()
+	if err != nil {
+		log.Printf("failed to read placement metadata: %s", err)
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tags = tags
+}
+
+// TagEnvelope adds the placement tags to the envelope. Tags already set on
+// the envelope are not overwritten.
+func (t *PlacementTagger) TagEnvelope(env *loggregator_v2.Envelope) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if len(t.tags) == 0 {
+		return
+	}
+
+	if env.Tags == nil {
+		env.Tags = make(map[string]string)
+	}
+
+	for k, v := range t.tags {
+		if _, ok := env.Tags[k]; !ok {
+			env.Tags[k] = v
+		}
+	}
+}
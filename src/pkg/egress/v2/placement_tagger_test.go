@@ -0,0 +1,136 @@
+package v2_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	egress "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PlacementTagger", func() {
+	var (
+		dir    string
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	writeFile := func(content string) string {
+		path := filepath.Join(dir, "placement")
+		Expect(os.WriteFile(path, []byte(content), 0600)).To(Succeed())
+		return path
+	}
+
+	It("tags envelopes with metadata from a JSON file", func() {
+		path := writeFile(`{"cell_id":"cell-1","isolation_segment":"iso-1"}`)
+		t := egress.NewPlacementTagger(ctx, egress.PlacementFromFile(path), time.Hour)
+
+		env := &loggregator_v2.Envelope{}
+		t.TagEnvelope(env)
+
+		Expect(env.GetTags()).To(Equal(map[string]string{
+			"cell_id":           "cell-1",
+			"isolation_segment": "iso-1",
+		}))
+	})
+
+	It("reads key value files written by the downward API", func() {
+		path := writeFile("node=\"node-1\"\npod=\"pod-1\"\n")
+		t := egress.NewPlacementTagger(ctx, egress.PlacementFromFile(path), time.Hour)
+
+		env := &loggregator_v2.Envelope{}
+		t.TagEnvelope(env)
+
+		Expect(env.GetTags()).To(Equal(map[string]string{
+			"node": "node-1",
+			"pod":  "pod-1",
+		}))
+	})
+
+	It("does not overwrite existing tags", func() {
+		path := writeFile(`{"cell_id":"cell-1"}`)
+		t := egress.NewPlacementTagger(ctx, egress.PlacementFromFile(path), time.Hour)
+
+		env := &loggregator_v2.Envelope{Tags: map[string]string{"cell_id": "original"}}
+		t.TagEnvelope(env)
+
+		Expect(env.GetTags()).To(HaveKeyWithValue("cell_id", "original"))
+	})
+
+	It("refreshes the metadata", func() {
+		path := writeFile(`{"cell_id":"cell-1"}`)
+		t := egress.NewPlacementTagger(ctx, egress.PlacementFromFile(path), 10*time.Millisecond)
+		writeFile(`{"cell_id":"cell-2"}`)
+
+		Eventually(func() string {
+			env := &loggregator_v2.Envelope{}
+			t.TagEnvelope(env)
+			return env.GetTags()["cell_id"]
+		}).Should(Equal("cell-2"))
+	})
+
+	It("keeps the last known metadata when a refresh fails", func() {
+		path := writeFile(`{"cell_id":"cell-1"}`)
+		t := egress.NewPlacementTagger(ctx, egress.PlacementFromFile(path), 10*time.Millisecond)
+		Expect(os.Remove(path)).To(Succeed())
+
+		Consistently(func() string {
+			env := &loggregator_v2.Envelope{}
+			t.TagEnvelope(env)
+			return env.GetTags()["cell_id"]
+		}, 50*time.Millisecond).Should(Equal("cell-1"))
+	})
+
+	It("stops refreshing the metadata when ctx is done", func() {
+		path := writeFile(`{"cell_id":"cell-1"}`)
+		t := egress.NewPlacementTagger(ctx, egress.PlacementFromFile(path), 10*time.Millisecond)
+		cancel()
+		time.Sleep(20 * time.Millisecond)
+		writeFile(`{"cell_id":"cell-2"}`)
+
+		Consistently(func() string {
+			env := &loggregator_v2.Envelope{}
+			t.TagEnvelope(env)
+			return env.GetTags()["cell_id"]
+		}, 50*time.Millisecond).Should(Equal("cell-1"))
+	})
+
+	It("uses the default refresh interval if the interval is not positive", func() {
+		path := writeFile(`{"cell_id":"cell-1"}`)
+		t := egress.NewPlacementTagger(ctx, egress.PlacementFromFile(path), 0)
+
+		env := &loggregator_v2.Envelope{}
+		t.TagEnvelope(env)
+		Expect(env.GetTags()).To(HaveKeyWithValue("cell_id", "cell-1"))
+	})
+
+	It("tags envelopes with metadata from an endpoint", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`{"node":"node-1"}`))
+		}))
+		defer server.Close()
+
+		t := egress.NewPlacementTagger(ctx, egress.PlacementFromEndpoint(server.URL, server.Client()), time.Hour)
+
+		env := &loggregator_v2.Envelope{}
+		t.TagEnvelope(env)
+
+		Expect(env.GetTags()).To(HaveKeyWithValue("node", "node-1"))
+	})
+})
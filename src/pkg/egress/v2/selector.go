@@ -0,0 +1,114 @@
+package v2
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+)
+
+// Selector selects envelopes by source ID prefix, envelope type and tags.
+// An envelope is selected if it matches every criterion that is set. The
+// zero Selector selects all envelopes.
+type Selector struct {
+	// SourceIDPrefix selects envelopes whose source ID starts with the
+	// prefix.
+	SourceIDPrefix string
+	// EnvelopeTypes selects envelopes of the given types: log, counter,
+	// gauge, timer or event.
+	EnvelopeTypes []string
+	// Tags selects envelopes that have all of the given tags with equal
+	// values.
+	Tags map[string]string
+}
+
+// IsZero reports whether the selector selects all envelopes.
+func (s Selector) IsZero() bool {
+	return s.SourceIDPrefix == "" && len(s.EnvelopeTypes) == 0 && len(s.Tags) == 0
+}
+
+// Validate returns an error if the selector contains an unknown envelope
+// type.
+func (s Selector) Validate() error {
+	for _, t := range s.EnvelopeTypes {
+		switch strings.ToLower(t) {
+		case "log", "counter", "gauge", "timer", "event":
+		default:
+			return fmt.Errorf("unknown envelope type: %q", t)
+		}
+	}
+	return nil
+}
+
+// Matches reports whether the envelope is selected.
+func (s Selector) Matches(e *loggregator_v2.Envelope) bool {
+	if !strings.HasPrefix(e.GetSourceId(), s.SourceIDPrefix) {
+		return false
+	}
+
+	if len(s.EnvelopeTypes) > 0 && !s.matchesType(e) {
+		return false
+	}
+
+	tags := e.GetTags()
+	for k, v := range s.Tags {
+		if tv, ok := tags[k]; !ok || tv != v {
+			return false
+		}
+	}
+	return true
+}
+
+func (s Selector) matchesType(e *loggregator_v2.Envelope) bool {
+	t := EnvelopeType(e)
+	for _, et := range s.EnvelopeTypes {
+		if strings.EqualFold(et, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// EnvelopeType returns the type of the envelope as one of EnvelopeTypes,
+// or an empty string if it has no message.
+func EnvelopeType(e *loggregator_v2.Envelope) string {
+	switch e.GetMessage().(type) {
+	case *loggregator_v2.Envelope_Log:
+		return "log"
+	case *loggregator_v2.Envelope_Counter:
+		return "counter"
+	case *loggregator_v2.Envelope_Gauge:
+		return "gauge"
+	case *loggregator_v2.Envelope_Timer:
+		return "timer"
+	case *loggregator_v2.Envelope_Event:
+		return "event"
+	default:
+		return ""
+	}
+}
+
+// SelectingWriter writes only the envelopes that match its selector.
+type SelectingWriter struct {
+	writer   Writer
+	selector Selector
+}
+
+// NewSelectingWriter returns a SelectingWriter that writes the envelopes
+// matching the selector to w.
+func NewSelectingWriter(w Writer, s Selector) SelectingWriter {
+	return SelectingWriter{
+		writer:   w,
+		selector: s,
+	}
+}
+
+// Write writes the envelope if it matches the selector and drops it
+// otherwise.
+func (w SelectingWriter) Write(ctx context.Context, e *loggregator_v2.Envelope) error {
+	if !w.selector.Matches(e) {
+		return nil
+	}
+	return w.writer.Write(ctx, e)
+}
@@ -0,0 +1,90 @@
+package v2_test
+
+import (
+	"context"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/testhelpers"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Selector", func() {
+	var env *loggregator_v2.Envelope
+
+	BeforeEach(func() {
+		env = &loggregator_v2.Envelope{
+			SourceId: "some-source-id",
+			Tags: map[string]string{
+				"tag-one": "value-one",
+				"tag-two": "value-two",
+			},
+			Message: &loggregator_v2.Envelope_Counter{
+				Counter: &loggregator_v2.Counter{Name: "some-counter"},
+			},
+		}
+	})
+
+	It("selects all envelopes when empty", func() {
+		s := v2.Selector{}
+
+		Expect(s.IsZero()).To(BeTrue())
+		Expect(s.Matches(env)).To(BeTrue())
+		Expect(s.Matches(&loggregator_v2.Envelope{})).To(BeTrue())
+	})
+
+	It("selects envelopes by source ID prefix", func() {
+		Expect(v2.Selector{SourceIDPrefix: "some-"}.Matches(env)).To(BeTrue())
+		Expect(v2.Selector{SourceIDPrefix: "other-"}.Matches(env)).To(BeFalse())
+	})
+
+	It("selects envelopes of any of the given types", func() {
+		Expect(v2.Selector{EnvelopeTypes: []string{"log", "Counter"}}.Matches(env)).To(BeTrue())
+		Expect(v2.Selector{EnvelopeTypes: []string{"log", "gauge"}}.Matches(env)).To(BeFalse())
+	})
+
+	It("selects envelopes with all of the given tags", func() {
+		Expect(v2.Selector{Tags: map[string]string{
+			"tag-one": "value-one",
+			"tag-two": "value-two",
+		}}.Matches(env)).To(BeTrue())
+		Expect(v2.Selector{Tags: map[string]string{
+			"tag-one": "value-one",
+			"tag-two": "other-value",
+		}}.Matches(env)).To(BeFalse())
+		Expect(v2.Selector{Tags: map[string]string{
+			"tag-three": "",
+		}}.Matches(env)).To(BeFalse())
+	})
+
+	It("requires all criteria to match", func() {
+		s := v2.Selector{
+			SourceIDPrefix: "some-",
+			EnvelopeTypes:  []string{"gauge"},
+			Tags:           map[string]string{"tag-one": "value-one"},
+		}
+
+		Expect(s.Matches(env)).To(BeFalse())
+	})
+
+	It("returns an error for unknown envelope types", func() {
+		Expect(v2.Selector{EnvelopeTypes: []string{"log", "TIMER", "event"}}.Validate()).To(Succeed())
+		Expect(v2.Selector{EnvelopeTypes: []string{"log", "metric"}}.Validate()).To(MatchError(`unknown envelope type: "metric"`))
+	})
+
+	Describe("SelectingWriter", func() {
+		It("writes only the selected envelopes", func() {
+			m := testhelpers.NewChanWriter()
+			m.WriteOutput.Ret0 <- nil
+			w := v2.NewSelectingWriter(m, v2.Selector{SourceIDPrefix: "some-"})
+
+			Expect(w.Write(context.Background(), &loggregator_v2.Envelope{SourceId: "other-source-id"})).To(Succeed())
+			Expect(w.Write(context.Background(), env)).To(Succeed())
+
+			Expect(m.WriteInput.Msg).To(HaveLen(1))
+			Expect(m.WriteInput.Msg).To(Receive(Equal(env)))
+		})
+	})
+})
@@ -0,0 +1,133 @@
+package v2
+
+import (
+	"sort"
+	"unicode/utf8"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metrics "code.cloudfoundry.org/go-metric-registry"
+)
+
+// TagsTruncatedTag is set to "true" on envelopes whose tags were truncated
+// by a TagLimiter.
+const TagsTruncatedTag = "tags_truncated"
+
+// TagLimiter bounds the total size of the tags on an envelope. The size of
+// the tags is the sum of the lengths of their keys and values in bytes.
+type TagLimiter struct {
+	maxBytes  int
+	truncated metrics.Counter
+}
+
+// NewTagLimiter returns a TagLimiter allowing at most maxBytes of tags per
+// envelope. A non-positive maxBytes disables the limit. The truncated
+// counter is incremented for every envelope with truncated tags.
+func NewTagLimiter(maxBytes int, truncated metrics.Counter) TagLimiter {
+	return TagLimiter{
+		maxBytes:  maxBytes,
+		truncated: truncated,
+	}
+}
+
+// LimitTags truncates the tags of the envelope if they exceed the limit.
+// The longest values are shortened first so short tags such as source
+// and deployment information are kept intact. If the keys alone exceed the
+// limit the largest tags are removed. Truncated envelopes are marked with
+// the TagsTruncatedTag, which counts towards the limit.
+func (l TagLimiter) LimitTags(env *loggregator_v2.Envelope) {
+	if l.maxBytes <= 0 || tagBytes(env.GetTags()) <= l.maxBytes {
+		return
+	}
+
+	delete(env.Tags, TagsTruncatedTag)
+	budget := l.maxBytes - len(TagsTruncatedTag) - len("true")
+
+	removeLargestTags(env.Tags, budget)
+
+	limit := valueLimit(env.Tags, budget)
+	for k, v := range env.Tags {
+		env.Tags[k] = truncateValue(v, limit)
+	}
+
+	env.Tags[TagsTruncatedTag] = "true"
+	l.truncated.Add(1)
+}
+
+func tagBytes(tags map[string]string) int {
+	var n int
+	for k, v := range tags {
+		n += len(k) + len(v)
+	}
+	return n
+}
+
+// removeLargestTags removes tags, largest first, until the keys fit in the
+// budget.
+func removeLargestTags(tags map[string]string, budget int) {
+	var keyBytes int
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keyBytes += len(k)
+		keys = append(keys, k)
+	}
+	if keyBytes <= budget {
+		return
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		si := len(keys[i]) + len(tags[keys[i]])
+		sj := len(keys[j]) + len(tags[keys[j]])
+		if si != sj {
+			return si > sj
+		}
+		return keys[i] < keys[j]
+	})
+
+	for _, k := range keys {
+		if keyBytes <= budget {
+			return
+		}
+		keyBytes -= len(k)
+		delete(tags, k)
+	}
+}
+
+// valueLimit returns the largest value length for which the tags fit in
+// the budget.
+func valueLimit(tags map[string]string, budget int) int {
+	fits := func(limit int) bool {
+		var n int
+		for k, v := range tags {
+			n += len(k) + min(len(v), limit)
+		}
+		return n <= budget
+	}
+
+	var longest int
+	for _, v := range tags {
+		longest = max(longest, len(v))
+	}
+
+	lo, hi := 0, longest
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if fits(mid) {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	return lo
+}
+
+// truncateValue shortens v to at most limit bytes without splitting a
+// UTF-8 encoded character.
+func truncateValue(v string, limit int) string {
+	if len(v) <= limit {
+		return v
+	}
+	for limit > 0 && !utf8.RuneStart(v[limit]) {
+		limit--
+	}
+	return v[:limit]
+}
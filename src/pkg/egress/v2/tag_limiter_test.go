@@ -0,0 +1,91 @@
+package v2_test
+
+import (
+	"strings"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
+	egress "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TagLimiter", func() {
+	var spy *metricsHelpers.SpyMetricsRegistry
+
+	BeforeEach(func() {
+		spy = metricsHelpers.NewMetricsRegistry()
+	})
+
+	newLimiter := func(maxBytes int) egress.TagLimiter {
+		return egress.NewTagLimiter(maxBytes, spy.NewCounter("tags_truncated", "help"))
+	}
+
+	tagBytes := func(tags map[string]string) int {
+		var n int
+		for k, v := range tags {
+			n += len(k) + len(v)
+		}
+		return n
+	}
+
+	It("leaves tags within the limit unchanged", func() {
+		env := &loggregator_v2.Envelope{Tags: map[string]string{"source_type": "APP/PROC/WEB"}}
+
+		newLimiter(100).LimitTags(env)
+
+		Expect(env.GetTags()).To(Equal(map[string]string{"source_type": "APP/PROC/WEB"}))
+		Expect(spy.GetMetricValue("tags_truncated", nil)).To(BeZero())
+	})
+
+	It("does not limit tags if the limit is disabled", func() {
+		env := &loggregator_v2.Envelope{Tags: map[string]string{"large": strings.Repeat("a", 10000)}}
+
+		newLimiter(0).LimitTags(env)
+
+		Expect(env.GetTags()["large"]).To(HaveLen(10000))
+	})
+
+	It("truncates the longest values first", func() {
+		env := &loggregator_v2.Envelope{Tags: map[string]string{
+			"deployment": "cf",
+			"large":      strings.Repeat("a", 1000),
+			"larger":     strings.Repeat("b", 2000),
+		}}
+
+		newLimiter(100).LimitTags(env)
+
+		Expect(env.GetTags()).To(HaveLen(4))
+		Expect(env.GetTags()).To(HaveKeyWithValue("deployment", "cf"))
+		Expect(env.GetTags()).To(HaveKeyWithValue("tags_truncated", "true"))
+		Expect(env.GetTags()["large"]).To(Equal(strings.Repeat("a", 29)))
+		Expect(env.GetTags()["larger"]).To(Equal(strings.Repeat("b", 29)))
+		Expect(tagBytes(env.GetTags())).To(BeNumerically("<=", 100))
+		Expect(tagBytes(env.GetTags())).To(BeNumerically(">", 95))
+		Expect(spy.GetMetricValue("tags_truncated", nil)).To(Equal(1.0))
+	})
+
+	It("does not split UTF-8 characters", func() {
+		env := &loggregator_v2.Envelope{Tags: map[string]string{"k": strings.Repeat("✓", 100)}}
+
+		newLimiter(30).LimitTags(env)
+
+		Expect(env.GetTags()["k"]).To(Equal(strings.Repeat("✓", 3)))
+	})
+
+	It("removes the largest tags if the keys exceed the limit", func() {
+		env := &loggregator_v2.Envelope{Tags: map[string]string{
+			"id":                              "1",
+			strings.Repeat("k", 100):          "v",
+			strings.Repeat("l", 100) + "long": "v",
+		}}
+
+		newLimiter(120).LimitTags(env)
+
+		Expect(env.GetTags()).To(HaveKey("id"))
+		Expect(env.GetTags()).To(HaveKey(strings.Repeat("k", 100)))
+		Expect(env.GetTags()).To(HaveKeyWithValue("tags_truncated", "true"))
+		Expect(tagBytes(env.GetTags())).To(BeNumerically("<=", 120))
+	})
+})
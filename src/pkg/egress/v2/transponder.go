@@ -1,20 +1,27 @@
 package v2
 
 import (
+	"context"
+	"math"
+	"sync"
 	"time"
 
 	metrics "code.cloudfoundry.org/go-metric-registry"
 
 	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/clock"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/plumbing/batching"
+	"google.golang.org/protobuf/proto"
 )
 
 type Nexter interface {
 	TryNext() (*loggregator_v2.Envelope, bool)
 }
 
+// BatchWriter writes batches of envelopes. Implementations that perform
+// network operations abort them when the context is done.
 type BatchWriter interface {
-	Write(msgs []*loggregator_v2.Envelope) error
+	Write(ctx context.Context, msgs []*loggregator_v2.Envelope) error
 }
 
 type Transponder struct {
@@ -22,12 +29,59 @@ type Transponder struct {
 	writer        BatchWriter
 	batchSize     int
 	batchInterval time.Duration
+	maxBatchAge   time.Duration
+	maxBatchBytes int
 	droppedMetric metrics.Counter
 	egressMetric  metrics.Counter
+	egressByType  *EgressCounter
+	batchAge      metrics.Gauge
+	byteLimited   metrics.Counter
+	clock         clock.Clock
+
+	mu         sync.Mutex
+	pending    int
+	batchBytes int
+	batchStart time.Time
+	lastFlush  time.Time
+	lastErr    stageError
+
+	flushes chan chan error
 }
 
 type MetricClient interface {
 	NewCounter(name, helpText string, opts ...metrics.MetricOption) metrics.Counter
+	NewGauge(name, helpText string, opts ...metrics.MetricOption) metrics.Gauge
+}
+
+// TransponderOption configures a Transponder.
+type TransponderOption func(*Transponder)
+
+// WithMaxBatchAge writes a partial batch as soon as no envelopes are
+// waiting and the oldest envelope in the batch is older than d, rather than
+// waiting for the batch interval to lapse.
+func WithMaxBatchAge(d time.Duration) TransponderOption {
+	return func(t *Transponder) {
+		t.maxBatchAge = d
+	}
+}
+
+// WithMaxBatchBytes writes a batch before it exceeds n bytes, so that
+// batches stay under the message size limits of the writer however large
+// their envelopes are. Envelopes are measured as they are read, before the
+// writer adds its tags. An envelope larger than n is written in a batch of
+// its own.
+func WithMaxBatchBytes(n int) TransponderOption {
+	return func(t *Transponder) {
+		t.maxBatchBytes = n
+	}
+}
+
+// WithTransponderClock sets the clock that a Transponder uses for its batch
+// interval, max batch age and idle sleeps. It is meant for tests.
+func WithTransponderClock(c clock.Clock) TransponderOption {
+	return func(t *Transponder) {
+		t.clock = c
+	}
 }
 
 func NewTransponder(
@@ -36,6 +90,7 @@ func NewTransponder(
 	batchSize int,
 	batchInterval time.Duration,
 	metricClient MetricClient,
+	opts ...TransponderOption,
 ) *Transponder {
 	droppedMetric := metricClient.NewCounter(
 		"dropped",
@@ -47,44 +102,208 @@ func NewTransponder(
 		"Total number of envelopes successfully egressed.",
 		metrics.WithMetricLabels(map[string]string{"metric_version": "2.0"}),
 	)
-	return &Transponder{
+	batchAge := metricClient.NewGauge(
+		"oldest_unflushed_envelope_age",
+		"Age of the oldest envelope waiting in a partial batch.",
+		metrics.WithMetricLabels(map[string]string{"unit": "seconds", "metric_version": "2.0"}),
+	)
+	t := &Transponder{
 		nexter:        n,
 		writer:        w,
 		droppedMetric: droppedMetric,
 		egressMetric:  egressMetric,
+		egressByType:  NewEgressCounter(metricClient, DestinationDoppler),
+		batchAge:      batchAge,
 		batchSize:     batchSize,
 		batchInterval: batchInterval,
+		clock:         clock.New(),
+		flushes:       make(chan chan error),
 	}
+	for _, o := range opts {
+		o(t)
+	}
+	if t.maxBatchBytes > 0 {
+		t.byteLimited = metricClient.NewCounter(
+			"byte_limited_batches",
+			"Total number of batches written early because they reached the maximum batch size in bytes.",
+			metrics.WithMetricLabels(map[string]string{"metric_version": "2.0"}),
+		)
+	}
+	return t
 }
 
-func (t *Transponder) Start() {
+// Start batches envelopes and writes them until ctx is done. Writes in
+// progress are cancelled when ctx is done.
+func (t *Transponder) Start(ctx context.Context) {
+	// The batcher only writes full batches. The batch interval is kept by
+	// the transponder so that it follows the transponder's clock.
+	var writeErr error
 	b := batching.NewV2EnvelopeBatcher(
 		t.batchSize,
-		t.batchInterval,
-		batching.V2EnvelopeWriterFunc(t.write),
+		time.Duration(math.MaxInt64),
+		batching.V2EnvelopeWriterFunc(func(batch []*loggregator_v2.Envelope) {
+			if err := t.write(ctx, batch); err != nil {
+				writeErr = err
+			}
+		}),
 	)
 
-	for {
+	idleSleep := 100 * time.Millisecond
+	if t.maxBatchAge > 0 && t.maxBatchAge < idleSleep {
+		idleSleep = t.maxBatchAge
+	}
+
+	t.mu.Lock()
+	t.lastFlush = t.clock.Now()
+	t.mu.Unlock()
+
+	flush := func(done chan<- error) {
+		writeErr = nil
+		for ctx.Err() == nil {
+			envelope, ok := t.nexter.TryNext()
+			if !ok {
+				break
+			}
+			t.add(b, envelope)
+		}
+		b.ForcedFlush()
+		done <- writeErr
+	}
+
+	for ctx.Err() == nil {
+		select {
+		case done := <-t.flushes:
+			flush(done)
+			continue
+		default:
+		}
+
 		envelope, ok := t.nexter.TryNext()
 		if !ok {
-			b.Flush()
-			time.Sleep(100 * time.Millisecond)
+			t.flushIdle(b)
+			timer := t.clock.NewTimer(idleSleep)
+			select {
+			case <-timer.C():
+			case done := <-t.flushes:
+				timer.Stop()
+				flush(done)
+			}
 			continue
 		}
 
-		b.Write(envelope)
+		t.add(b, envelope)
+		if t.intervalLapsed() {
+			b.ForcedFlush()
+		}
 	}
 }
 
-func (t *Transponder) write(batch []*loggregator_v2.Envelope) {
-	if err := t.writer.Write(batch); err != nil {
+// Flush writes all waiting envelopes and the current batch. It returns the
+// last error writing a batch, or ctx.Err() if ctx is done before the
+// envelopes are written. Envelopes that arrive while flushing are written
+// as well, so Flush may not return under sustained load.
+func (t *Transponder) Flush(ctx context.Context) error {
+	done := make(chan error, 1)
+	select {
+	case t.flushes <- done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *Transponder) add(b *batching.V2EnvelopeBatcher, envelope *loggregator_v2.Envelope) {
+	var size int
+	if t.maxBatchBytes > 0 {
+		size = proto.Size(envelope)
+		t.mu.Lock()
+		full := t.pending > 0 && t.batchBytes+size > t.maxBatchBytes
+		t.mu.Unlock()
+		if full {
+			t.byteLimited.Add(1)
+			b.ForcedFlush()
+		}
+	}
+
+	t.mu.Lock()
+	if t.pending == 0 {
+		t.batchStart = t.clock.Now()
+	}
+	t.pending++
+	t.batchBytes += size
+	t.mu.Unlock()
+
+	b.Write(envelope)
+}
+
+// flushIdle writes the partial batch if the batch interval has lapsed or
+// the oldest envelope in the batch exceeds the max batch age, and reports
+// the age of the oldest envelope that is still waiting.
+func (t *Transponder) flushIdle(b *batching.V2EnvelopeBatcher) {
+	if t.intervalLapsed() || (t.maxBatchAge > 0 && t.oldestAge() >= t.maxBatchAge) {
+		b.ForcedFlush()
+	}
+
+	t.batchAge.Set(t.oldestAge().Seconds())
+}
+
+// intervalLapsed reports whether the batch interval has lapsed since the
+// last batch was written.
+func (t *Transponder) intervalLapsed() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.clock.Since(t.lastFlush) >= t.batchInterval
+}
+
+// oldestAge returns the age of the oldest envelope in the current batch or
+// zero if the batch is empty.
+func (t *Transponder) oldestAge() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.pending == 0 {
+		return 0
+	}
+	return t.clock.Since(t.batchStart)
+}
+
+// Status reports the number of envelopes in the current batch, the age of
+// the batch and the last error writing a batch.
+func (t *Transponder) Status() StageStatus {
+	t.mu.Lock()
+	s := StageStatus{QueueDepth: t.pending}
+	if t.pending > 0 {
+		s.BatchAgeSeconds = t.clock.Since(t.batchStart).Seconds()
+	}
+	t.mu.Unlock()
+
+	t.lastErr.apply(&s)
+	return s
+}
+
+func (t *Transponder) write(ctx context.Context, batch []*loggregator_v2.Envelope) error {
+	t.mu.Lock()
+	t.pending = 0
+	t.batchBytes = 0
+	t.lastFlush = t.clock.Now()
+	t.mu.Unlock()
+
+	if err := t.writer.Write(ctx, batch); err != nil {
+		t.lastErr.set(err)
 		// metric-documentation-v2: (loggregator.metron.dropped) Number of messages
 		// dropped when failing to write to Dopplers v2 API
 		t.droppedMetric.Add(float64(len(batch)))
-		return
+		return err
 	}
 
 	// metric-documentation-v2: (loggregator.metron.egress)
 	// Number of messages written to Doppler's v2 API
 	t.egressMetric.Add(float64(len(batch)))
+	t.egressByType.Add(batch...)
+	return nil
 }
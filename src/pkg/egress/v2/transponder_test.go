@@ -1,12 +1,15 @@
 package v2_test
 
 import (
+	"context"
 	"errors"
 	"time"
 
 	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
 	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
 	egress "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/testhelpers"
+	"google.golang.org/protobuf/proto"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -15,26 +18,47 @@ import (
 var _ = Describe("Transponder", func() {
 	It("reads from the buffer to the writer", func() {
 		envelope := &loggregator_v2.Envelope{SourceId: "uuid"}
-		nexter := newMockNexter()
+		nexter := testhelpers.NewChanNexter()
 		nexter.TryNextOutput.Ret0 <- envelope
 		nexter.TryNextOutput.Ret1 <- true
-		writer := newMockBatchWriter()
+		writer := testhelpers.NewChanBatchWriter()
 		close(writer.WriteOutput.Ret0)
 
 		spy := metricsHelpers.NewMetricsRegistry()
 
 		tx := egress.NewTransponder(nexter, writer, 1, time.Nanosecond, spy)
-		go tx.Start()
+		go tx.Start(context.Background())
 
 		Eventually(nexter.TryNextCalled).Should(Receive())
 		Eventually(writer.WriteInput.Msgs).Should(Receive(Equal([]*loggregator_v2.Envelope{envelope})))
 	})
 
+	It("stops when the context is done", func() {
+		nexter := testhelpers.NewChanNexter()
+		writer := testhelpers.NewChanBatchWriter()
+		close(writer.WriteOutput.Ret0)
+		close(nexter.TryNextOutput.Ret0)
+		close(nexter.TryNextOutput.Ret1)
+
+		spy := metricsHelpers.NewMetricsRegistry()
+
+		tx := egress.NewTransponder(nexter, writer, 1, time.Nanosecond, spy)
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			tx.Start(ctx)
+		}()
+
+		cancel()
+		Eventually(done).Should(BeClosed())
+	})
+
 	Describe("batching", func() {
 		It("emits once the batch count has been reached", func() {
 			envelope := &loggregator_v2.Envelope{SourceId: "uuid"}
-			nexter := newMockNexter()
-			writer := newMockBatchWriter()
+			nexter := testhelpers.NewChanNexter()
+			writer := testhelpers.NewChanBatchWriter()
 			close(writer.WriteOutput.Ret0)
 
 			for i := 0; i < 6; i++ {
@@ -45,7 +69,7 @@ var _ = Describe("Transponder", func() {
 			spy := metricsHelpers.NewMetricsRegistry()
 
 			tx := egress.NewTransponder(nexter, writer, 5, time.Minute, spy)
-			go tx.Start()
+			go tx.Start(context.Background())
 
 			var batch []*loggregator_v2.Envelope
 			Eventually(writer.WriteInput.Msgs).Should(Receive(&batch))
@@ -54,8 +78,8 @@ var _ = Describe("Transponder", func() {
 
 		It("emits once the batch interval has been reached", func() {
 			envelope := &loggregator_v2.Envelope{SourceId: "uuid"}
-			nexter := newMockNexter()
-			writer := newMockBatchWriter()
+			nexter := testhelpers.NewChanNexter()
+			writer := testhelpers.NewChanBatchWriter()
 			close(writer.WriteOutput.Ret0)
 
 			nexter.TryNextOutput.Ret0 <- envelope
@@ -66,17 +90,150 @@ var _ = Describe("Transponder", func() {
 			spy := metricsHelpers.NewMetricsRegistry()
 
 			tx := egress.NewTransponder(nexter, writer, 5, time.Millisecond, spy)
-			go tx.Start()
+			go tx.Start(context.Background())
+
+			var batch []*loggregator_v2.Envelope
+			Eventually(writer.WriteInput.Msgs).Should(Receive(&batch))
+			Expect(batch).To(HaveLen(1))
+		})
+
+		It("emits before the batch exceeds the max batch bytes", func() {
+			envelope := &loggregator_v2.Envelope{
+				SourceId: "uuid",
+				Message: &loggregator_v2.Envelope_Log{
+					Log: &loggregator_v2.Log{Payload: make([]byte, 1000)},
+				},
+			}
+			size := proto.Size(envelope)
+			nexter := testhelpers.NewChanNexter()
+			writer := testhelpers.NewChanBatchWriter()
+			close(writer.WriteOutput.Ret0)
+
+			for i := 0; i < 4; i++ {
+				nexter.TryNextOutput.Ret0 <- envelope
+				nexter.TryNextOutput.Ret1 <- true
+			}
+
+			spy := metricsHelpers.NewMetricsRegistry()
+
+			tx := egress.NewTransponder(nexter, writer, 100, time.Minute, spy, egress.WithMaxBatchBytes(3*size+1))
+			go tx.Start(context.Background())
+
+			var batch []*loggregator_v2.Envelope
+			Eventually(writer.WriteInput.Msgs).Should(Receive(&batch))
+			Expect(batch).To(HaveLen(3))
+			Eventually(func() float64 {
+				return spy.GetMetric("byte_limited_batches", map[string]string{"metric_version": "2.0"}).Value()
+			}).Should(Equal(1.0))
+		})
+
+		It("emits an envelope larger than the max batch bytes in its own batch", func() {
+			small := &loggregator_v2.Envelope{SourceId: "small"}
+			large := &loggregator_v2.Envelope{
+				SourceId: "large",
+				Message: &loggregator_v2.Envelope_Log{
+					Log: &loggregator_v2.Log{Payload: make([]byte, 1000)},
+				},
+			}
+			nexter := testhelpers.NewChanNexter()
+			writer := testhelpers.NewChanBatchWriter()
+			close(writer.WriteOutput.Ret0)
+
+			for _, e := range []*loggregator_v2.Envelope{small, large, small} {
+				nexter.TryNextOutput.Ret0 <- e
+				nexter.TryNextOutput.Ret1 <- true
+			}
+
+			spy := metricsHelpers.NewMetricsRegistry()
+
+			tx := egress.NewTransponder(nexter, writer, 100, time.Minute, spy, egress.WithMaxBatchBytes(100))
+			go tx.Start(context.Background())
+
+			var batch []*loggregator_v2.Envelope
+			Eventually(writer.WriteInput.Msgs).Should(Receive(&batch))
+			Expect(batch).To(ConsistOf(small))
+			Eventually(writer.WriteInput.Msgs).Should(Receive(&batch))
+			Expect(batch).To(ConsistOf(large))
+		})
+
+		It("emits once the batch interval has passed on its clock", func() {
+			envelope := &loggregator_v2.Envelope{SourceId: "uuid"}
+			nexter := testhelpers.NewChanNexter()
+			writer := testhelpers.NewChanBatchWriter()
+			close(writer.WriteOutput.Ret0)
+
+			nexter.TryNextOutput.Ret0 <- envelope
+			nexter.TryNextOutput.Ret1 <- true
+			close(nexter.TryNextOutput.Ret0)
+			close(nexter.TryNextOutput.Ret1)
+
+			spy := metricsHelpers.NewMetricsRegistry()
+			clock := testhelpers.NewFakeClock(time.Now())
+
+			tx := egress.NewTransponder(nexter, writer, 5, time.Second, spy, egress.WithTransponderClock(clock))
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go tx.Start(ctx)
+
+			Eventually(clock.Waiters).Should(Equal(1))
+			Expect(tx.Status().BatchAgeSeconds).To(BeZero())
+			clock.Advance(900 * time.Millisecond)
+			Eventually(clock.Waiters).Should(Equal(1))
+			Expect(writer.WriteInput.Msgs).To(BeEmpty())
+			Expect(tx.Status().BatchAgeSeconds).To(BeNumerically("~", 0.9, 0.001))
+
+			clock.Advance(100 * time.Millisecond)
+			var batch []*loggregator_v2.Envelope
+			Eventually(writer.WriteInput.Msgs).Should(Receive(&batch))
+			Expect(batch).To(HaveLen(1))
+		})
+
+		It("emits a partial batch once it exceeds the max batch age", func() {
+			envelope := &loggregator_v2.Envelope{SourceId: "uuid"}
+			nexter := testhelpers.NewChanNexter()
+			writer := testhelpers.NewChanBatchWriter()
+			close(writer.WriteOutput.Ret0)
+
+			nexter.TryNextOutput.Ret0 <- envelope
+			nexter.TryNextOutput.Ret1 <- true
+			close(nexter.TryNextOutput.Ret0)
+			close(nexter.TryNextOutput.Ret1)
+
+			spy := metricsHelpers.NewMetricsRegistry()
+
+			tx := egress.NewTransponder(nexter, writer, 5, time.Hour, spy, egress.WithMaxBatchAge(10*time.Millisecond))
+			go tx.Start(context.Background())
 
 			var batch []*loggregator_v2.Envelope
 			Eventually(writer.WriteInput.Msgs).Should(Receive(&batch))
 			Expect(batch).To(HaveLen(1))
 		})
 
+		It("reports the age of the oldest unflushed envelope", func() {
+			envelope := &loggregator_v2.Envelope{SourceId: "uuid"}
+			nexter := testhelpers.NewChanNexter()
+			writer := testhelpers.NewChanBatchWriter()
+			close(writer.WriteOutput.Ret0)
+
+			nexter.TryNextOutput.Ret0 <- envelope
+			nexter.TryNextOutput.Ret1 <- true
+			close(nexter.TryNextOutput.Ret0)
+			close(nexter.TryNextOutput.Ret1)
+
+			spy := metricsHelpers.NewMetricsRegistry()
+
+			tx := egress.NewTransponder(nexter, writer, 5, time.Hour, spy)
+			go tx.Start(context.Background())
+
+			Eventually(func() float64 {
+				return spy.GetMetric("oldest_unflushed_envelope_age", map[string]string{"unit": "seconds", "metric_version": "2.0"}).Value()
+			}).Should(BeNumerically(">", 0))
+		})
+
 		It("clears batch upon egress failure", func() {
 			envelope := &loggregator_v2.Envelope{SourceId: "uuid"}
-			nexter := newMockNexter()
-			writer := newMockBatchWriter()
+			nexter := testhelpers.NewChanNexter()
+			writer := testhelpers.NewChanBatchWriter()
 
 			go func() {
 				for {
@@ -92,7 +249,7 @@ var _ = Describe("Transponder", func() {
 			spy := metricsHelpers.NewMetricsRegistry()
 
 			tx := egress.NewTransponder(nexter, writer, 5, time.Minute, spy)
-			go tx.Start()
+			go tx.Start(context.Background())
 
 			Eventually(writer.WriteCalled).Should(HaveLen(1))
 			Consistently(writer.WriteCalled).Should(HaveLen(1))
@@ -100,8 +257,8 @@ var _ = Describe("Transponder", func() {
 
 		It("emits egress and dropped metric", func() {
 			envelope := &loggregator_v2.Envelope{SourceId: "uuid"}
-			nexter := newMockNexter()
-			writer := newMockBatchWriter()
+			nexter := testhelpers.NewChanNexter()
+			writer := testhelpers.NewChanBatchWriter()
 			close(writer.WriteOutput.Ret0)
 
 			for i := 0; i < 6; i++ {
@@ -111,12 +268,137 @@ var _ = Describe("Transponder", func() {
 
 			spy := metricsHelpers.NewMetricsRegistry()
 			tx := egress.NewTransponder(nexter, writer, 5, time.Minute, spy)
-			go tx.Start()
+			go tx.Start(context.Background())
 
 			Eventually(hasMetric(spy, "egress", map[string]string{"metric_version": "2.0"}))
 			Eventually(hasMetric(spy, "dropped", map[string]string{"direction": "egress", "metric_version": "2.0"}))
 
 		})
+
+		It("counts egressed envelopes by envelope type", func() {
+			envelope := &loggregator_v2.Envelope{
+				SourceId: "uuid",
+				Message:  &loggregator_v2.Envelope_Log{Log: &loggregator_v2.Log{}},
+			}
+			nexter := testhelpers.NewChanNexter()
+			writer := testhelpers.NewChanBatchWriter()
+			close(writer.WriteOutput.Ret0)
+
+			for i := 0; i < 5; i++ {
+				nexter.TryNextOutput.Ret0 <- envelope
+				nexter.TryNextOutput.Ret1 <- true
+			}
+
+			spy := metricsHelpers.NewMetricsRegistry()
+			tx := egress.NewTransponder(nexter, writer, 5, time.Minute, spy)
+			go tx.Start(context.Background())
+
+			Eventually(func() float64 {
+				return spy.GetMetric("egress_envelopes", map[string]string{
+					"envelope_type": "log",
+					"destination":   "doppler",
+				}).Value()
+			}).Should(Equal(5.0))
+		})
+	})
+
+	Describe("Flush", func() {
+		It("writes the waiting envelopes and the current batch", func() {
+			envelope := &loggregator_v2.Envelope{SourceId: "uuid"}
+			nexter := testhelpers.NewChanNexter()
+			writer := testhelpers.NewChanBatchWriter()
+			close(writer.WriteOutput.Ret0)
+
+			for i := 0; i < 3; i++ {
+				nexter.TryNextOutput.Ret0 <- envelope
+				nexter.TryNextOutput.Ret1 <- true
+			}
+			close(nexter.TryNextOutput.Ret0)
+			close(nexter.TryNextOutput.Ret1)
+
+			clock := testhelpers.NewFakeClock(time.Now())
+			tx := egress.NewTransponder(nexter, writer, 5, time.Hour, metricsHelpers.NewMetricsRegistry(), egress.WithTransponderClock(clock))
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go tx.Start(ctx)
+
+			Expect(tx.Flush(context.Background())).To(Succeed())
+
+			var batch []*loggregator_v2.Envelope
+			Expect(writer.WriteInput.Msgs).To(Receive(&batch))
+			Expect(batch).To(HaveLen(3))
+			Expect(tx.Status().QueueDepth).To(BeZero())
+		})
+
+		It("returns the error writing the batch", func() {
+			nexter := testhelpers.NewChanNexter()
+			nexter.TryNextOutput.Ret0 <- &loggregator_v2.Envelope{SourceId: "uuid"}
+			nexter.TryNextOutput.Ret1 <- true
+			close(nexter.TryNextOutput.Ret0)
+			close(nexter.TryNextOutput.Ret1)
+			writer := testhelpers.NewChanBatchWriter()
+			writer.WriteOutput.Ret0 <- errors.New("some-error")
+
+			clock := testhelpers.NewFakeClock(time.Now())
+			tx := egress.NewTransponder(nexter, writer, 5, time.Hour, metricsHelpers.NewMetricsRegistry(), egress.WithTransponderClock(clock))
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go tx.Start(ctx)
+
+			Expect(tx.Flush(context.Background())).To(MatchError("some-error"))
+		})
+
+		It("returns when the context is done", func() {
+			tx := egress.NewTransponder(
+				testhelpers.NewChanNexter(),
+				testhelpers.NewChanBatchWriter(),
+				5,
+				time.Hour,
+				metricsHelpers.NewMetricsRegistry(),
+			)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+
+			Expect(tx.Flush(ctx)).To(MatchError(context.DeadlineExceeded))
+		})
+	})
+
+	Describe("Status", func() {
+		It("reports the envelopes in the current batch", func() {
+			envelope := &loggregator_v2.Envelope{SourceId: "uuid"}
+			nexter := testhelpers.NewChanNexter()
+			writer := testhelpers.NewChanBatchWriter()
+			close(writer.WriteOutput.Ret0)
+
+			for i := 0; i < 3; i++ {
+				nexter.TryNextOutput.Ret0 <- envelope
+				nexter.TryNextOutput.Ret1 <- true
+			}
+
+			tx := egress.NewTransponder(nexter, writer, 5, time.Minute, metricsHelpers.NewMetricsRegistry())
+			go tx.Start(context.Background())
+
+			Eventually(func() int { return tx.Status().QueueDepth }).Should(Equal(3))
+			Eventually(func() float64 { return tx.Status().BatchAgeSeconds }).Should(BeNumerically(">", 0))
+		})
+
+		It("reports the last write error", func() {
+			envelope := &loggregator_v2.Envelope{SourceId: "uuid"}
+			nexter := testhelpers.NewChanNexter()
+			nexter.TryNextOutput.Ret0 <- envelope
+			nexter.TryNextOutput.Ret1 <- true
+			writer := testhelpers.NewChanBatchWriter()
+			writer.WriteOutput.Ret0 <- errors.New("some-error")
+
+			tx := egress.NewTransponder(nexter, writer, 1, time.Minute, metricsHelpers.NewMetricsRegistry())
+			Expect(tx.Status().LastError).To(BeEmpty())
+			go tx.Start(context.Background())
+
+			Eventually(func() string { return tx.Status().LastError }).Should(Equal("some-error"))
+			Expect(tx.Status().LastErrorAt).ToNot(BeNil())
+			Expect(tx.Status().QueueDepth).To(BeZero())
+		})
 	})
 })
 
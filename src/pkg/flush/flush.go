@@ -0,0 +1,133 @@
+// Package flush serves an endpoint that flushes the envelopes buffered by
+// an agent, e.g. for BOSH drain scripts before a VM is stopped.
+package flush
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Flusher writes the envelopes it buffers. Flush returns once they are
+// written or ctx is done.
+type Flusher interface {
+	Flush(ctx context.Context) error
+}
+
+// FlusherFunc is an adapter to use a func as a Flusher.
+type FlusherFunc func(ctx context.Context) error
+
+// Flush calls f.
+func (f FlusherFunc) Flush(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Result is the response of the flush endpoint.
+type Result struct {
+	Flushed         bool    `json:"flushed"`
+	Error           string  `json:"error,omitempty"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+// Handler flushes its flushers on POST requests with the bearer token.
+// The flushers are flushed in order and must complete within the timeout,
+// which requests can shorten with the timeout query parameter.
+type Handler struct {
+	token    string
+	timeout  time.Duration
+	flushers []Flusher
+}
+
+// NewHandler returns a Handler. It rejects all requests if token is empty.
+func NewHandler(token string, timeout time.Duration, flushers ...Flusher) *Handler {
+	return &Handler{
+		token:    token,
+		timeout:  timeout,
+		flushers: flushers,
+	}
+}
+
+// ServeHTTP flushes the flushers and writes a Result. It responds with 504
+// if the flushers do not complete in time.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.authorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	timeout := h.timeout
+	if v := r.URL.Query().Get("timeout"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, fmt.Sprintf("invalid timeout: %q", v), http.StatusBadRequest)
+			return
+		}
+		timeout = min(d, timeout)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := h.flush(ctx)
+	res := Result{
+		Flushed:         err == nil,
+		DurationSeconds: time.Since(start).Seconds(),
+	}
+
+	status := http.StatusOK
+	if err != nil {
+		res.Error = err.Error()
+		status = http.StatusInternalServerError
+		if errors.Is(err, context.DeadlineExceeded) {
+			status = http.StatusGatewayTimeout
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+func (h *Handler) flush(ctx context.Context) error {
+	for _, f := range h.flushers {
+		if err := f.Flush(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *Handler) authorized(r *http.Request) bool {
+	if h.token == "" {
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) == 1
+}
+
+// NewServer returns a server for the /flush endpoint on localhost at the
+// given port.
+func NewServer(port uint16, h *Handler) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/flush", h)
+
+	return &http.Server{
+		Addr:              fmt.Sprintf("127.0.0.1:%d", port),
+		Handler:           mux,
+		ReadHeaderTimeout: 2 * time.Second,
+	}
+}
@@ -0,0 +1,13 @@
+package flush_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestFlush(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Flush Suite")
+}
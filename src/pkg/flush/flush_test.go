@@ -0,0 +1,145 @@
+package flush_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/flush"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Handler", func() {
+	var flushed []string
+
+	flusher := func(name string, err error) flush.Flusher {
+		return flush.FlusherFunc(func(context.Context) error {
+			flushed = append(flushed, name)
+			return err
+		})
+	}
+
+	serve := func(h http.Handler, method, target, token string) (*httptest.ResponseRecorder, flush.Result) {
+		req := httptest.NewRequest(method, target, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		var res flush.Result
+		if rec.Header().Get("Content-Type") == "application/json" {
+			Expect(json.Unmarshal(rec.Body.Bytes(), &res)).To(Succeed())
+		}
+		return rec, res
+	}
+
+	BeforeEach(func() {
+		flushed = nil
+	})
+
+	It("flushes the flushers in order", func() {
+		h := flush.NewHandler("token", time.Second, flusher("a", nil), flusher("b", nil))
+
+		rec, res := serve(h, http.MethodPost, "/flush", "token")
+
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(res.Flushed).To(BeTrue())
+		Expect(flushed).To(Equal([]string{"a", "b"}))
+	})
+
+	It("stops at the first failing flusher", func() {
+		h := flush.NewHandler("token", time.Second, flusher("a", errors.New("some-error")), flusher("b", nil))
+
+		rec, res := serve(h, http.MethodPost, "/flush", "token")
+
+		Expect(rec.Code).To(Equal(http.StatusInternalServerError))
+		Expect(res.Flushed).To(BeFalse())
+		Expect(res.Error).To(Equal("some-error"))
+		Expect(flushed).To(Equal([]string{"a"}))
+	})
+
+	It("responds with a timeout if the flushers do not complete in time", func() {
+		var deadline time.Time
+		h := flush.NewHandler("token", time.Minute, flush.FlusherFunc(func(ctx context.Context) error {
+			deadline, _ = ctx.Deadline()
+			<-ctx.Done()
+			return ctx.Err()
+		}))
+
+		rec, res := serve(h, http.MethodPost, "/flush?timeout=10ms", "token")
+
+		Expect(rec.Code).To(Equal(http.StatusGatewayTimeout))
+		Expect(res.Flushed).To(BeFalse())
+		Expect(deadline).To(BeTemporally("<", time.Now().Add(time.Second)))
+	})
+
+	It("does not extend the timeout beyond the configured one", func() {
+		var deadline time.Time
+		h := flush.NewHandler("token", time.Second, flush.FlusherFunc(func(ctx context.Context) error {
+			deadline, _ = ctx.Deadline()
+			return nil
+		}))
+
+		rec, _ := serve(h, http.MethodPost, "/flush?timeout=1h", "token")
+
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(deadline).To(BeTemporally("<", time.Now().Add(2*time.Second)))
+	})
+
+	It("rejects invalid timeouts", func() {
+		h := flush.NewHandler("token", time.Second, flusher("a", nil))
+
+		rec, _ := serve(h, http.MethodPost, "/flush?timeout=soon", "token")
+
+		Expect(rec.Code).To(Equal(http.StatusBadRequest))
+		Expect(flushed).To(BeEmpty())
+	})
+
+	DescribeTable("rejects unauthorized requests",
+		func(configured, token string) {
+			h := flush.NewHandler(configured, time.Second, flusher("a", nil))
+
+			rec, _ := serve(h, http.MethodPost, "/flush", token)
+
+			Expect(rec.Code).To(Equal(http.StatusUnauthorized))
+			Expect(flushed).To(BeEmpty())
+		},
+		Entry("without a token", "token", ""),
+		Entry("with the wrong token", "token", "other-token"),
+		Entry("when no token is configured", "", ""),
+	)
+
+	It("only allows POST requests", func() {
+		h := flush.NewHandler("token", time.Second, flusher("a", nil))
+
+		rec, _ := serve(h, http.MethodGet, "/flush", "token")
+
+		Expect(rec.Code).To(Equal(http.StatusMethodNotAllowed))
+		Expect(rec.Header().Get("Allow")).To(Equal(http.MethodPost))
+		Expect(flushed).To(BeEmpty())
+	})
+})
+
+var _ = Describe("NewServer", func() {
+	It("serves the handler on /flush on localhost", func() {
+		s := flush.NewServer(8080, flush.NewHandler("token", time.Second))
+
+		Expect(s.Addr).To(Equal("127.0.0.1:8080"))
+
+		req := httptest.NewRequest(http.MethodPost, "/flush", nil)
+		req.Header.Set("Authorization", "Bearer token")
+		rec := httptest.NewRecorder()
+		s.Handler.ServeHTTP(rec, req)
+		Expect(rec.Code).To(Equal(http.StatusOK))
+
+		rec = httptest.NewRecorder()
+		s.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/other", nil))
+		Expect(rec.Code).To(Equal(http.StatusNotFound))
+	})
+})
@@ -15,6 +15,16 @@ type Client struct {
 	BatchSize int
 }
 
-func (w Client) Get(nextID int) (*http.Response, error) {
-	return w.Client.Get(fmt.Sprintf(pathTemplate, w.Addr, w.BatchSize, nextID))
+// Get requests the page of bindings starting at nextID. If etag is not
+// empty, it is sent as If-None-Match so that the API can respond with 304
+// Not Modified.
+func (w Client) Get(nextID int, etag string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf(pathTemplate, w.Addr, w.BatchSize, nextID), nil)
+	if err != nil {
+		return nil, err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	return w.Client.Do(req)
 }
@@ -0,0 +1,182 @@
+package bindings
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/binding"
+)
+
+// AggregateDrainsDocument is a CacheFetcher that reads the aggregate drains
+// from a JSON document instead of the binding cache, so that platform-wide
+// drains can be changed without redeploying the agents. The document is
+// either a file or an HTTPS URL and has the format of the aggregate
+// endpoint of the binding cache:
+//
+//	[{"url": "syslog-tls://drain.example.com:6514", "credentials": [{"cert": "...", "key": "...", "ca": "..."}]}]
+//
+// It is re-read every interval. If it cannot be read or is invalid, the
+// previous drains are kept.
+type AggregateDrainsDocument struct {
+	location string
+	client   *http.Client
+	log      *log.Logger
+
+	mu       sync.RWMutex
+	data     []byte
+	bindings []binding.Binding
+	err      error
+}
+
+// maxAggregateDrainsDocumentSize is the size in bytes above which the
+// document is rejected instead of read.
+const maxAggregateDrainsDocumentSize = 4 << 20
+
+// NewAggregateDrainsDocument reads the aggregate drains from the file or
+// HTTPS URL at location and re-reads them every interval until ctx is done.
+// The client is used for HTTPS URLs, e.g. with a client certificate for
+// mTLS. It returns an error if the interval is not positive or location is
+// a URL with another scheme than https.
+func NewAggregateDrainsDocument(ctx context.Context, location string, client *http.Client, interval time.Duration, l *log.Logger) (*AggregateDrainsDocument, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid polling interval for aggregate drains document: %s", interval)
+	}
+	if strings.Contains(location, "://") && !strings.HasPrefix(location, "https://") {
+		return nil, fmt.Errorf("unsupported scheme of aggregate drains document %s: only files and https URLs are supported", location)
+	}
+
+	d := &AggregateDrainsDocument{
+		location: location,
+		client:   client,
+		log:      l,
+	}
+
+	if _, err := d.reload(); err != nil {
+		d.log.Printf("failed to load aggregate drains from %s: %s", d.location, err)
+		d.err = err
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			changed, err := d.reload()
+			if err != nil {
+				d.log.Printf("failed to reload aggregate drains from %s, keeping previous drains: %s", d.location, err)
+				continue
+			}
+			if changed {
+				d.log.Printf("reloaded aggregate drains from %s", d.location)
+			}
+		}
+	}()
+
+	return d, nil
+}
+
+// GetAggregate returns the aggregate drains last read from the document.
+// It returns an error if the document has never been read successfully.
+func (d *AggregateDrainsDocument) GetAggregate() ([]binding.Binding, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if d.err != nil {
+		return nil, d.err
+	}
+	return d.bindings, nil
+}
+
+// reload re-reads the document. It returns whether the drains were
+// replaced.
+func (d *AggregateDrainsDocument) reload() (bool, error) {
+	data, err := d.read()
+	if err != nil {
+		return false, err
+	}
+
+	d.mu.RLock()
+	unchanged := d.err == nil && d.data != nil && bytes.Equal(data, d.data)
+	d.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	bindings, err := parseAggregateDrainsDocument(data)
+	if err != nil {
+		return false, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.data = data
+	d.bindings = bindings
+	d.err = nil
+
+	return true, nil
+}
+
+func (d *AggregateDrainsDocument) read() ([]byte, error) {
+	if !strings.HasPrefix(d.location, "https://") {
+		f, err := os.Open(d.location)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return readAggregateDrainsDocument(f)
+	}
+
+	resp, err := d.client.Get(d.location)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return readAggregateDrainsDocument(resp.Body)
+}
+
+// readAggregateDrainsDocument reads r up to
+// maxAggregateDrainsDocumentSize bytes.
+func readAggregateDrainsDocument(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxAggregateDrainsDocumentSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxAggregateDrainsDocumentSize {
+		return nil, fmt.Errorf("aggregate drains document exceeds %d bytes", maxAggregateDrainsDocumentSize)
+	}
+	return data, nil
+}
+
+func parseAggregateDrainsDocument(data []byte) ([]binding.Binding, error) {
+	var bindings []binding.Binding
+	if err := json.Unmarshal(data, &bindings); err != nil {
+		return nil, fmt.Errorf("invalid aggregate drains document: %w", err)
+	}
+	for _, b := range bindings {
+		if b.Url == "" {
+			return nil, errors.New("invalid aggregate drains document: drain without url")
+		}
+	}
+
+	return bindings, nil
+}
@@ -0,0 +1,149 @@
+package bindings_test
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/binding"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/ingress/bindings"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AggregateDrainsDocument", func() {
+	var (
+		path   string
+		ctx    context.Context
+		cancel context.CancelFunc
+		logger = log.New(GinkgoWriter, "", 0)
+	)
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "aggregate-drains.json")
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	newDocument := func(location string, client *http.Client, interval time.Duration) *bindings.AggregateDrainsDocument {
+		d, err := bindings.NewAggregateDrainsDocument(ctx, location, client, interval, logger)
+		Expect(err).ToNot(HaveOccurred())
+		return d
+	}
+
+	writeFile := func(content string) {
+		Expect(os.WriteFile(path, []byte(content), 0600)).To(Succeed())
+	}
+
+	It("reads the aggregate drains from a file", func() {
+		writeFile(`[{"url": "syslog-tls://drain.example.com:6514", "credentials": [{"cert": "cert", "key": "key", "ca": "ca"}], "metadata": {"include-metrics-deprecated": "true"}}]`)
+
+		d := newDocument(path, nil, time.Hour)
+
+		Expect(d.GetAggregate()).To(Equal([]binding.Binding{
+			{
+				Url:         "syslog-tls://drain.example.com:6514",
+				Credentials: []binding.Credentials{{Cert: "cert", Key: "key", CA: "ca"}},
+				Metadata:    map[string]string{"include-metrics-deprecated": "true"},
+			},
+		}))
+	})
+
+	It("reloads the file when it changes", func() {
+		writeFile(`[{"url": "syslog://drain-1.example.com"}]`)
+		d := newDocument(path, nil, 10*time.Millisecond)
+
+		writeFile(`[{"url": "syslog://drain-2.example.com"}, {"url": "syslog://drain-3.example.com"}]`)
+
+		Eventually(d.GetAggregate).Should(ConsistOf(
+			binding.Binding{Url: "syslog://drain-2.example.com"},
+			binding.Binding{Url: "syslog://drain-3.example.com"},
+		))
+	})
+
+	It("keeps the previous drains if the file becomes invalid", func() {
+		writeFile(`[{"url": "syslog://drain-1.example.com"}]`)
+		d := newDocument(path, nil, 10*time.Millisecond)
+
+		writeFile(`[{"credentials": []}]`)
+
+		Consistently(d.GetAggregate, 100*time.Millisecond).Should(ConsistOf(
+			binding.Binding{Url: "syslog://drain-1.example.com"},
+		))
+	})
+
+	It("returns an error until the document has been read", func() {
+		d := newDocument(path, nil, 10*time.Millisecond)
+
+		_, err := d.GetAggregate()
+		Expect(err).To(HaveOccurred())
+
+		writeFile(`[{"url": "syslog://drain-1.example.com"}]`)
+
+		Eventually(d.GetAggregate).Should(ConsistOf(
+			binding.Binding{Url: "syslog://drain-1.example.com"},
+		))
+	})
+
+	It("reads the aggregate drains from an HTTPS URL", func() {
+		var unavailable atomic.Bool
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if unavailable.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte(`[{"url": "syslog://drain-1.example.com"}]`)) //nolint:errcheck
+		}))
+		defer server.Close()
+
+		d := newDocument(server.URL, server.Client(), 10*time.Millisecond)
+		Expect(d.GetAggregate()).To(ConsistOf(
+			binding.Binding{Url: "syslog://drain-1.example.com"},
+		))
+
+		unavailable.Store(true)
+		Consistently(d.GetAggregate, 100*time.Millisecond).Should(ConsistOf(
+			binding.Binding{Url: "syslog://drain-1.example.com"},
+		))
+	})
+
+	It("stops reloading the document when the context is done", func() {
+		writeFile(`[{"url": "syslog://drain-1.example.com"}]`)
+		d := newDocument(path, nil, 10*time.Millisecond)
+
+		cancel()
+		time.Sleep(50 * time.Millisecond)
+		writeFile(`[{"url": "syslog://drain-2.example.com"}]`)
+
+		Consistently(d.GetAggregate, 100*time.Millisecond).Should(ConsistOf(
+			binding.Binding{Url: "syslog://drain-1.example.com"},
+		))
+	})
+
+	It("rejects documents that are too large", func() {
+		writeFile(`[{"url": "syslog://drain-1.example.com"}` + strings.Repeat(" ", 4<<20) + `]`)
+		d := newDocument(path, nil, time.Hour)
+
+		_, err := d.GetAggregate()
+		Expect(err).To(MatchError(ContainSubstring("exceeds")))
+	})
+
+	It("returns an error for a polling interval that is not positive", func() {
+		_, err := bindings.NewAggregateDrainsDocument(ctx, path, nil, 0, logger)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("returns an error for URLs that are not https", func() {
+		_, err := bindings.NewAggregateDrainsDocument(ctx, "http://drains.example.com", nil, time.Hour, logger)
+		Expect(err).To(MatchError(ContainSubstring("unsupported scheme")))
+	})
+})
@@ -38,7 +38,10 @@ func (a *AggregateDrainFetcher) FetchBindings() ([]syslog.Binding, error) {
 			}
 			b := syslog.Binding{
 				AppId: "",
-				Drain: syslog.Drain{Url: i.Url},
+				Drain: syslog.Drain{
+					Url:      i.Url,
+					Metadata: syslog.NewDrainMetadata(i.Metadata),
+				},
 			}
 			if len(i.Credentials) > 0 {
 				b.Drain.Credentials = syslog.Credentials{
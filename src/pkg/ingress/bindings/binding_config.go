@@ -35,6 +35,23 @@ func (d *DrainParamParser) FetchBindings() ([]syslog.Binding, error) {
 		b.OmitMetadata = getOmitMetadata(urlParsed, d.defaultDrainMetadata)
 		b.InternalTls = getInternalTLS(urlParsed)
 		b.DrainData = getBindingType(urlParsed)
+		b.Format = syslog.DrainFormat(getParam(urlParsed, b.Drain.Metadata, "format"))
+		b.Template = getParam(urlParsed, b.Drain.Metadata, "template")
+		b.Sanitize = syslog.PayloadSanitization(getParam(urlParsed, b.Drain.Metadata, "sanitize"))
+		b.Newline = syslog.NewlinePolicy(getParam(urlParsed, b.Drain.Metadata, "newline"))
+		b.Framing = syslog.Framing(getParam(urlParsed, b.Drain.Metadata, "framing"))
+		b.StreamStructuredData = getParam(urlParsed, b.Drain.Metadata, "stream-sd") == "true"
+		b.Severity = syslog.SeverityMapping(getParam(urlParsed, b.Drain.Metadata, "severity"))
+		b.ProcIDFormat = syslog.FieldFormat(getParam(urlParsed, b.Drain.Metadata, "procid"))
+		b.MsgIDFormat = syslog.FieldFormat(getParam(urlParsed, b.Drain.Metadata, "msgid"))
+		b.UTF8 = syslog.UTF8Mode(getParam(urlParsed, b.Drain.Metadata, "utf8"))
+		b.Instances = getParam(urlParsed, b.Drain.Metadata, "instances")
+		if b.Instances == "" {
+			b.Instances = getParam(urlParsed, b.Drain.Metadata, "instance")
+		}
+		b.ExcludeSources = getParam(urlParsed, b.Drain.Metadata, "exclude-source")
+		b.CAFingerprint = getParam(urlParsed, b.Drain.Metadata, "ca-fingerprint")
+		b.CAFingerprintOnly = getParam(urlParsed, b.Drain.Metadata, "ca-fingerprint-only") == "true"
 
 		processed = append(processed, b)
 	}
@@ -84,6 +101,16 @@ func getBindingType(u *url.URL) syslog.DrainData {
 	return drainData
 }
 
+// getParam returns the drain URL query parameter with the given name,
+// falling back to the binding metadata.
+func getParam(u *url.URL, m syslog.DrainMetadata, name string) string {
+	if v := u.Query().Get(name); v != "" {
+		return v
+	}
+	v, _ := m.Get(name)
+	return v
+}
+
 func getRemoveMetadataQuery(u *url.URL) string {
 	q := u.Query().Get("disable-metadata")
 	if q == "" {
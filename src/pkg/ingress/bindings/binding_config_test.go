@@ -107,6 +107,177 @@ var _ = Describe("Drain Param Config", func() {
 		Expect(configedBindings[4].DrainData).To(Equal(syslog.ALL))
 	})
 
+	It("sets the format from the 'format' parameter", func() {
+		bs := []syslog.Binding{
+			{Drain: syslog.Drain{Url: "https://test.org/drain"}},
+			{Drain: syslog.Drain{Url: "https://test.org/drain?format=splunk-hec"}},
+			{Drain: syslog.Drain{Url: "https://test.org/drain?format=datadog"}},
+			{Drain: syslog.Drain{Url: "https://test.org/drain?format=loki"}},
+		}
+		f := newStubFetcher(bs, nil)
+		wf := bindings.NewDrainParamParser(f, true)
+
+		configedBindings, _ := wf.FetchBindings()
+		Expect(configedBindings[0].Format).To(Equal(syslog.FormatRFC5424))
+		Expect(configedBindings[1].Format).To(Equal(syslog.FormatSplunkHEC))
+		Expect(configedBindings[2].Format).To(Equal(syslog.FormatDatadog))
+		Expect(configedBindings[3].Format).To(Equal(syslog.FormatLoki))
+	})
+
+	It("sets the message template from the 'template' parameter", func() {
+		bs := []syslog.Binding{
+			{Drain: syslog.Drain{Url: "syslog://test.org/drain"}},
+			{Drain: syslog.Drain{Url: "syslog://test.org/drain?template=plain"}},
+		}
+		f := newStubFetcher(bs, nil)
+		wf := bindings.NewDrainParamParser(f, true)
+
+		configedBindings, _ := wf.FetchBindings()
+		Expect(configedBindings[0].Template).To(BeEmpty())
+		Expect(configedBindings[1].Template).To(Equal("plain"))
+	})
+
+	It("sets the sanitize mode from the 'sanitize' parameter", func() {
+		bs := []syslog.Binding{
+			{Drain: syslog.Drain{Url: "syslog://test.org/drain"}},
+			{Drain: syslog.Drain{Url: "syslog://test.org/drain?sanitize=strip"}},
+			{Drain: syslog.Drain{
+				Url:      "syslog://test.org/drain",
+				Metadata: syslog.NewDrainMetadata(map[string]string{"sanitize": "escape"}),
+			}},
+		}
+		f := newStubFetcher(bs, nil)
+		wf := bindings.NewDrainParamParser(f, true)
+
+		configedBindings, _ := wf.FetchBindings()
+		Expect(configedBindings[0].Sanitize).To(Equal(syslog.SanitizeNone))
+		Expect(configedBindings[1].Sanitize).To(Equal(syslog.SanitizeStrip))
+		Expect(configedBindings[2].Sanitize).To(Equal(syslog.SanitizeEscape))
+	})
+
+	It("sets the newline policy and framing from the 'newline' and 'framing' parameters", func() {
+		bs := []syslog.Binding{
+			{Drain: syslog.Drain{Url: "syslog://test.org/drain"}},
+			{Drain: syslog.Drain{Url: "syslog://test.org/drain?newline=split&framing=non-transparent"}},
+		}
+		f := newStubFetcher(bs, nil)
+		wf := bindings.NewDrainParamParser(f, true)
+
+		configedBindings, _ := wf.FetchBindings()
+		Expect(configedBindings[0].Newline).To(BeEmpty())
+		Expect(configedBindings[0].Framing).To(BeEmpty())
+		Expect(configedBindings[1].Newline).To(Equal(syslog.NewlineSplit))
+		Expect(configedBindings[1].Framing).To(Equal(syslog.FramingNonTransparent))
+	})
+
+	It("sets the stream structured data and severity mapping from the 'stream-sd' and 'severity' parameters", func() {
+		bs := []syslog.Binding{
+			{Drain: syslog.Drain{Url: "syslog://test.org/drain"}},
+			{Drain: syslog.Drain{Url: "syslog://test.org/drain?stream-sd=true&severity=info,warning"}},
+		}
+		f := newStubFetcher(bs, nil)
+		wf := bindings.NewDrainParamParser(f, true)
+
+		configedBindings, _ := wf.FetchBindings()
+		Expect(configedBindings[0].StreamStructuredData).To(BeFalse())
+		Expect(configedBindings[0].Severity).To(BeEmpty())
+		Expect(configedBindings[1].StreamStructuredData).To(BeTrue())
+		Expect(configedBindings[1].Severity).To(Equal(syslog.SeverityMapping("info,warning")))
+	})
+
+	It("sets the PROCID and MSGID formats from the 'procid' and 'msgid' parameters", func() {
+		bs := []syslog.Binding{
+			{Drain: syslog.Drain{Url: "syslog://test.org/drain?procid=%7Bprocess_type%7D.%7Binstance%7D&msgid=%7Bsource%7D"}},
+		}
+		f := newStubFetcher(bs, nil)
+		wf := bindings.NewDrainParamParser(f, true)
+
+		configedBindings, _ := wf.FetchBindings()
+		Expect(configedBindings[0].ProcIDFormat).To(Equal(syslog.FieldFormat("{process_type}.{instance}")))
+		Expect(configedBindings[0].MsgIDFormat).To(Equal(syslog.FieldFormat("{source}")))
+	})
+
+	It("sets the UTF-8 mode from the 'utf8' parameter", func() {
+		bs := []syslog.Binding{
+			{Drain: syslog.Drain{Url: "syslog://test.org/drain"}},
+			{Drain: syslog.Drain{Url: "syslog://test.org/drain?utf8=strict"}},
+		}
+		f := newStubFetcher(bs, nil)
+		wf := bindings.NewDrainParamParser(f, true)
+
+		configedBindings, _ := wf.FetchBindings()
+		Expect(configedBindings[0].UTF8).To(BeEmpty())
+		Expect(configedBindings[1].UTF8).To(Equal(syslog.UTF8Strict))
+	})
+
+	It("sets the instances from the 'instances' or 'instance' parameter", func() {
+		bs := []syslog.Binding{
+			{Drain: syslog.Drain{Url: "syslog://test.org/drain"}},
+			{Drain: syslog.Drain{Url: "syslog://test.org/drain?instances=0,1"}},
+			{Drain: syslog.Drain{Url: "syslog://test.org/drain?instance=2"}},
+		}
+		f := newStubFetcher(bs, nil)
+		wf := bindings.NewDrainParamParser(f, true)
+
+		configedBindings, _ := wf.FetchBindings()
+		Expect(configedBindings[0].Instances).To(BeEmpty())
+		Expect(configedBindings[1].Instances).To(Equal("0,1"))
+		Expect(configedBindings[2].Instances).To(Equal("2"))
+	})
+
+	It("sets the pins from the 'ca-fingerprint' parameter or metadata", func() {
+		bs := []syslog.Binding{
+			{Drain: syslog.Drain{Url: "syslog-tls://test.org/drain"}},
+			{Drain: syslog.Drain{Url: "syslog-tls://test.org/drain?ca-fingerprint=some-pin&ca-fingerprint-only=true"}},
+			{Drain: syslog.Drain{
+				Url:      "syslog-tls://test.org/drain",
+				Metadata: syslog.NewDrainMetadata(map[string]string{"ca-fingerprint": "other-pin"}),
+			}},
+		}
+		f := newStubFetcher(bs, nil)
+		wf := bindings.NewDrainParamParser(f, true)
+
+		configedBindings, _ := wf.FetchBindings()
+		Expect(configedBindings[0].CAFingerprint).To(BeEmpty())
+		Expect(configedBindings[1].CAFingerprint).To(Equal("some-pin"))
+		Expect(configedBindings[1].CAFingerprintOnly).To(BeTrue())
+		Expect(configedBindings[2].CAFingerprint).To(Equal("other-pin"))
+		Expect(configedBindings[2].CAFingerprintOnly).To(BeFalse())
+	})
+
+	It("sets the excluded sources from the 'exclude-source' parameter", func() {
+		bs := []syslog.Binding{
+			{Drain: syslog.Drain{Url: "syslog://test.org/drain"}},
+			{Drain: syslog.Drain{Url: "syslog://test.org/drain?exclude-source=RTR,STG"}},
+		}
+		f := newStubFetcher(bs, nil)
+		wf := bindings.NewDrainParamParser(f, true)
+
+		configedBindings, _ := wf.FetchBindings()
+		Expect(configedBindings[0].ExcludeSources).To(BeEmpty())
+		Expect(configedBindings[1].ExcludeSources).To(Equal("RTR,STG"))
+	})
+
+	It("falls back to the binding metadata for format and template", func() {
+		bs := []syslog.Binding{
+			{Drain: syslog.Drain{
+				Url:      "https://test.org/drain",
+				Metadata: syslog.NewDrainMetadata(map[string]string{"format": "loki", "template": "plain"}),
+			}},
+			{Drain: syslog.Drain{
+				Url:      "https://test.org/drain?format=datadog",
+				Metadata: syslog.NewDrainMetadata(map[string]string{"format": "loki"}),
+			}},
+		}
+		f := newStubFetcher(bs, nil)
+		wf := bindings.NewDrainParamParser(f, true)
+
+		configedBindings, _ := wf.FetchBindings()
+		Expect(configedBindings[0].Format).To(Equal(syslog.FormatLoki))
+		Expect(configedBindings[0].Template).To(Equal("plain"))
+		Expect(configedBindings[1].Format).To(Equal(syslog.FormatDatadog))
+	})
+
 	It("omits bindings with bad Drain URLs", func() {
 		bs := []syslog.Binding{
 			{Drain: syslog.Drain{Url: "   https://leading-spaces-are-invalid"}},
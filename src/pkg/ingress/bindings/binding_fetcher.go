@@ -27,6 +27,7 @@ type Getter interface {
 type BindingFetcher struct {
 	refreshCount metrics.Counter
 	maxLatency   metrics.Gauge
+	fetchPhase   metrics.Gauge
 	limit        int
 	getter       Getter
 	logger       *log.Logger
@@ -50,6 +51,7 @@ func NewBindingFetcher(limit int, g Getter, m Metrics, logger *log.Logger) *Bind
 		getter:       g,
 		refreshCount: refreshCount,
 		maxLatency:   maxLatency,
+		fetchPhase:   binding.NewPhaseDurationGauge(m, binding.PhaseFetch),
 		logger:       logger,
 	}
 }
@@ -61,6 +63,7 @@ func (f *BindingFetcher) FetchBindings() ([]syslog.Binding, error) {
 	defer func() {
 		f.refreshCount.Add(1)
 		f.maxLatency.Set(toMilliseconds(latency))
+		f.fetchPhase.Set(toMilliseconds(latency))
 	}()
 
 	start := time.Now()
@@ -93,11 +96,14 @@ func (f *BindingFetcher) remodelBindings(bs []binding.Binding) map[string]mold {
 	for _, b := range bs {
 		for _, c := range b.Credentials {
 			for _, a := range c.Apps {
+				drain := syslog.Drain{
+					Url:         b.Url,
+					Credentials: syslog.Credentials{Cert: c.Cert, Key: c.Key, CA: c.CA},
+					Metadata:    syslog.NewDrainMetadata(b.Metadata),
+				}
 				if val, ok := remodel[a.AppID]; ok {
-					drain := syslog.Drain{Url: b.Url, Credentials: syslog.Credentials{Cert: c.Cert, Key: c.Key, CA: c.CA}}
 					remodel[a.AppID] = mold{drains: append(val.drains, drain), hostname: a.Hostname}
 				} else {
-					drain := syslog.Drain{Url: b.Url, Credentials: syslog.Credentials{Cert: c.Cert, Key: c.Key, CA: c.CA}}
 					remodel[a.AppID] = mold{drains: []syslog.Drain{drain}, hostname: a.Hostname}
 				}
 			}
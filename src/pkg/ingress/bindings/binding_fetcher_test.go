@@ -114,6 +114,21 @@ var _ = Describe("BindingFetcher", func() {
 		Expect(fetchedBindings).To(ConsistOf(expectedSyslogBindings))
 	})
 
+	It("passes binding metadata through to the drains", func() {
+		getter.bindings = []binding.Binding{
+			{
+				Url:         "https://metadata.url",
+				Credentials: []binding.Credentials{{Apps: []binding.App{{Hostname: "org.space.logspinner", AppID: "testAppID"}}}},
+				Metadata:    map[string]string{"tenant": "t-1"},
+			},
+		}
+
+		fetchedBindings, err := fetcher.FetchBindings()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fetchedBindings).To(HaveLen(1))
+		Expect(fetchedBindings[0].Drain.Metadata).To(Equal(syslog.NewDrainMetadata(map[string]string{"tenant": "t-1"})))
+	})
+
 	It("tracks the number of binding refreshes", func() {
 		_, err := fetcher.FetchBindings()
 		Expect(err).ToNot(HaveOccurred())
@@ -130,6 +145,9 @@ var _ = Describe("BindingFetcher", func() {
 		Expect(
 			metrics.GetMetric("latency_for_last_binding_refresh", map[string]string{"unit": "ms"}).Value(),
 		).To(BeNumerically(">", 0))
+		Expect(
+			metrics.GetMetric("binding_refresh_phase_duration", map[string]string{"unit": "ms", "phase": "fetch"}).Value(),
+		).To(BeNumerically(">", 0))
 	})
 
 	It("returns all the bindings when there are fewer bindings than the limit", func() {
@@ -0,0 +1,139 @@
+package bindings
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BlacklistFile is an IPChecker that blacklists the configured ranges and
+// the ranges read from a file. The file is re-read whenever it changes so
+// that the blacklist can be tightened without restarting the agent.
+type BlacklistFile struct {
+	static *BlacklistRanges
+	path   string
+	log    *log.Logger
+
+	mu      sync.RWMutex
+	ranges  *BlacklistRanges
+	modTime time.Time
+	size    int64
+}
+
+// NewBlacklistFile reads the blacklist ranges from the file at path and
+// checks it for changes every interval. The file contains ranges in the
+// same format as BLACKLISTED_SYSLOG_RANGES, separated by commas or
+// newlines. Lines starting with # are ignored. If the file cannot be read
+// or is invalid on a later check, the previous ranges are kept. It returns
+// an error if the interval is not positive.
+func NewBlacklistFile(static *BlacklistRanges, path string, interval time.Duration, l *log.Logger) (*BlacklistFile, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid reload interval for blacklist file: %s", interval)
+	}
+
+	b := &BlacklistFile{
+		static: static,
+		path:   path,
+		log:    l,
+	}
+
+	if _, err := b.reload(); err != nil {
+		return nil, err
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			changed, err := b.reload()
+			if err != nil {
+				b.log.Printf("failed to reload blacklist ranges from %s, keeping previous ranges: %s", b.path, err)
+				continue
+			}
+			if changed {
+				b.log.Printf("reloaded blacklist ranges from %s", b.path)
+			}
+		}
+	}()
+
+	return b, nil
+}
+
+// reload re-reads the file if its size or modification time changed. It
+// returns whether the ranges were replaced.
+func (b *BlacklistFile) reload() (bool, error) {
+	info, err := os.Stat(b.path)
+	if err != nil {
+		return false, err
+	}
+
+	b.mu.RLock()
+	unchanged := info.ModTime().Equal(b.modTime) && info.Size() == b.size
+	b.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(b.path)
+	if err != nil {
+		return false, err
+	}
+
+	ranges, err := parseBlacklistFile(string(data))
+	if err != nil {
+		return false, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.ranges = ranges
+	b.modTime = info.ModTime()
+	b.size = info.Size()
+
+	return true, nil
+}
+
+func parseBlacklistFile(data string) (*BlacklistRanges, error) {
+	var entries []string
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		for _, e := range strings.Split(line, ",") {
+			if e = strings.TrimSpace(e); e != "" {
+				entries = append(entries, e)
+			}
+		}
+	}
+
+	r := &BlacklistRanges{}
+	if err := r.UnmarshalEnv(strings.Join(entries, ",")); err != nil {
+		return nil, fmt.Errorf("invalid blacklist file: %w", err)
+	}
+
+	return r, nil
+}
+
+// CheckBlacklist returns an error if the IP is in the configured ranges or
+// the ranges last read from the file.
+func (b *BlacklistFile) CheckBlacklist(ip net.IP) error {
+	if err := b.static.CheckBlacklist(ip); err != nil {
+		return err
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.ranges.CheckBlacklist(ip)
+}
+
+// ResolveAddr resolves the host to an IP.
+func (b *BlacklistFile) ResolveAddr(host string) (net.IP, error) {
+	return b.static.ResolveAddr(host)
+}
@@ -0,0 +1,91 @@
+package bindings_test
+
+import (
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/ingress/bindings"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("BlacklistFile", func() {
+	var (
+		path   string
+		static *bindings.BlacklistRanges
+		logger = log.New(GinkgoWriter, "", 0)
+	)
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "blacklist")
+		static = &bindings.BlacklistRanges{}
+		Expect(static.UnmarshalEnv("10.0.0.1-10.0.0.1")).To(Succeed())
+	})
+
+	writeFile := func(content string) {
+		Expect(os.WriteFile(path, []byte(content), 0600)).To(Succeed())
+		later := time.Now().Add(time.Second)
+		Expect(os.Chtimes(path, later, later)).To(Succeed())
+	}
+
+	blacklisted := func(b *bindings.BlacklistFile, ip string) func() bool {
+		return func() bool {
+			return b.CheckBlacklist(net.ParseIP(ip)) != nil
+		}
+	}
+
+	It("blacklists the configured ranges and the ranges in the file", func() {
+		writeFile("# cell network\n10.0.1.0-10.0.1.255\n\n10.0.2.5-10.0.2.5, 10.0.3.5-10.0.3.5\n")
+
+		b, err := bindings.NewBlacklistFile(static, path, time.Hour, logger)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(blacklisted(b, "10.0.0.1")()).To(BeTrue())
+		Expect(blacklisted(b, "10.0.1.10")()).To(BeTrue())
+		Expect(blacklisted(b, "10.0.2.5")()).To(BeTrue())
+		Expect(blacklisted(b, "10.0.3.5")()).To(BeTrue())
+		Expect(blacklisted(b, "10.0.4.5")()).To(BeFalse())
+	})
+
+	It("returns an error if the file is invalid", func() {
+		writeFile("10.0.1.0")
+
+		_, err := bindings.NewBlacklistFile(static, path, time.Hour, logger)
+		Expect(err).To(MatchError(ContainSubstring("invalid blacklist file")))
+	})
+
+	It("returns an error if the file does not exist", func() {
+		_, err := bindings.NewBlacklistFile(static, path, time.Hour, logger)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("returns an error if the reload interval is not positive", func() {
+		writeFile("10.0.1.0-10.0.1.255")
+
+		_, err := bindings.NewBlacklistFile(static, path, 0, logger)
+		Expect(err).To(MatchError(ContainSubstring("invalid reload interval")))
+	})
+
+	It("reloads the file when it changes", func() {
+		writeFile("10.0.1.0-10.0.1.255")
+		b, err := bindings.NewBlacklistFile(static, path, 10*time.Millisecond, logger)
+		Expect(err).ToNot(HaveOccurred())
+
+		writeFile("10.0.1.0-10.0.1.255,10.0.4.0-10.0.4.255")
+
+		Eventually(blacklisted(b, "10.0.4.5")).Should(BeTrue())
+	})
+
+	It("keeps the previous ranges if the file becomes invalid", func() {
+		writeFile("10.0.1.0-10.0.1.255")
+		b, err := bindings.NewBlacklistFile(static, path, 10*time.Millisecond, logger)
+		Expect(err).ToNot(HaveOccurred())
+
+		writeFile("not-a-range")
+
+		Consistently(blacklisted(b, "10.0.1.10")).Should(BeTrue())
+	})
+})
@@ -0,0 +1,63 @@
+package bindings
+
+import "fmt"
+
+// FilterPolicy is what the FilteredBindingFetcher does with a binding whose
+// drain violates a rule.
+type FilterPolicy string
+
+const (
+	// FilterPolicyDrop logs the violation and drops the binding.
+	FilterPolicyDrop FilterPolicy = "drop"
+	// FilterPolicyWarn logs the violation and keeps the binding.
+	FilterPolicyWarn FilterPolicy = "warn"
+	// FilterPolicyRetryLater logs the violation, drops the binding and does
+	// not check the drain host again until the failed hosts cache expires.
+	// For rules that do not depend on the drain host it is the same as
+	// FilterPolicyDrop.
+	FilterPolicyRetryLater FilterPolicy = "retry-later"
+)
+
+// UnmarshalEnv implements envstruct.Unmarshaller.
+// Example input: retry-later
+func (p *FilterPolicy) UnmarshalEnv(v string) error {
+	if v == "" {
+		return nil
+	}
+
+	switch policy := FilterPolicy(v); policy {
+	case FilterPolicyDrop, FilterPolicyWarn, FilterPolicyRetryLater:
+		*p = policy
+		return nil
+	default:
+		return fmt.Errorf("unknown filter policy %q", v)
+	}
+}
+
+// FilterPolicies are the policies of the rules the drains of bindings are
+// checked against. Bindings whose drain URL cannot be parsed or has no host
+// are always dropped.
+type FilterPolicies struct {
+	// Scheme applies to drains with an unsupported scheme.
+	Scheme FilterPolicy `env:"INVALID_DRAIN_SCHEME_POLICY, report"`
+	// Blacklist applies to drains that resolve to a blacklisted IP.
+	Blacklist FilterPolicy `env:"INVALID_DRAIN_BLACKLIST_POLICY, report"`
+	// ResolveFailure applies to drains whose host cannot be resolved.
+	// Without a resolved IP the blacklist is not checked, so warn keeps
+	// the binding unchecked.
+	ResolveFailure FilterPolicy `env:"INVALID_DRAIN_RESOLVE_FAILURE_POLICY, report"`
+	// Silent does not log violations. It is set from the deprecated
+	// warn_on_invalid_drains property and does not change which bindings
+	// are dropped.
+	Silent bool
+}
+
+// DefaultFilterPolicies drops drains with an unsupported scheme or a
+// blacklisted IP and retries drains that fail to resolve later.
+func DefaultFilterPolicies() FilterPolicies {
+	return FilterPolicies{
+		Scheme:         FilterPolicyDrop,
+		Blacklist:      FilterPolicyDrop,
+		ResolveFailure: FilterPolicyRetryLater,
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"log"
 	"net"
 	"net/url"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	metrics "code.cloudfoundry.org/go-metric-registry"
@@ -14,7 +16,7 @@ import (
 
 //go:generate hel --type IPChecker
 
-var allowedSchemes = []string{"syslog", "syslog-tls", "https", "https-batch"}
+var allowedSchemes = []string{"syslog", "syslog-tls", "https", "https-batch", "forward", "forward-tls"}
 
 type IPChecker interface {
 	ResolveAddr(host string) (net.IP, error)
@@ -26,17 +28,37 @@ type metricsClient interface {
 	NewGauge(name, helpText string, opts ...metrics.MetricOption) metrics.Gauge
 }
 
+// filterWorkers is the number of bindings validated concurrently. Resolving
+// drain hosts dominates the time spent filtering bindings.
+const filterWorkers = 16
+
+// Rejection reasons used to dimension the invalid_drains_by_reason metric.
+const (
+	reasonParse          = "parse"
+	reasonScheme         = "scheme"
+	reasonNoHost         = "no-host"
+	reasonResolveFailure = "resolve-failure"
+	reasonBlacklist      = "blacklist"
+)
+
+var rejectionReasons = []string{reasonParse, reasonScheme, reasonNoHost, reasonResolveFailure, reasonBlacklist}
+
 type FilteredBindingFetcher struct {
-	ipChecker         IPChecker
-	br                binding.Fetcher
-	warn              bool
-	logger            *log.Logger
-	invalidDrains     metrics.Gauge
-	blacklistedDrains metrics.Gauge
-	failedHostsCache  *simplecache.SimpleCache[string, bool]
+	ipChecker             IPChecker
+	br                    binding.Fetcher
+	policies              FilterPolicies
+	logger                *log.Logger
+	invalidDrains         metrics.Gauge
+	blacklistedDrains     metrics.Gauge
+	invalidDrainsByReason map[string]metrics.Gauge
+	failedHostsCache      *simplecache.SimpleCache[string, string]
+	filterPhase           metrics.Gauge
+	dnsPhase              metrics.Gauge
 }
 
-func NewFilteredBindingFetcher(c IPChecker, b binding.Fetcher, m metricsClient, warn bool, lc *log.Logger) *FilteredBindingFetcher {
+// NewFilteredBindingFetcher returns a FilteredBindingFetcher that applies
+// the policies to the bindings of b whose drains violate a rule.
+func NewFilteredBindingFetcher(c IPChecker, b binding.Fetcher, m metricsClient, p FilterPolicies, lc *log.Logger) *FilteredBindingFetcher {
 	opt := metrics.WithMetricLabels(map[string]string{"unit": "total"})
 
 	invalidDrains := m.NewGauge(
@@ -49,14 +71,25 @@ func NewFilteredBindingFetcher(c IPChecker, b binding.Fetcher, m metricsClient,
 		"Count of blacklisted drains encountered in last binding fetch.",
 		opt,
 	)
+	invalidDrainsByReason := make(map[string]metrics.Gauge)
+	for _, r := range rejectionReasons {
+		invalidDrainsByReason[r] = m.NewGauge(
+			"invalid_drains_by_reason",
+			"Count of drains rejected in last binding fetch by reason. Includes drains with an unsupported scheme.",
+			metrics.WithMetricLabels(map[string]string{"unit": "total", "reason": r}),
+		)
+	}
 	return &FilteredBindingFetcher{
-		ipChecker:         c,
-		br:                b,
-		warn:              warn,
-		logger:            lc,
-		invalidDrains:     invalidDrains,
-		blacklistedDrains: blacklistedDrains,
-		failedHostsCache:  simplecache.New[string, bool](120 * time.Second),
+		ipChecker:             c,
+		br:                    b,
+		policies:              p,
+		logger:                lc,
+		invalidDrains:         invalidDrains,
+		blacklistedDrains:     blacklistedDrains,
+		invalidDrainsByReason: invalidDrainsByReason,
+		failedHostsCache:      simplecache.New[string, string](120 * time.Second),
+		filterPhase:           binding.NewPhaseDurationGauge(m, binding.PhaseFilter),
+		dnsPhase:              binding.NewPhaseDurationGauge(m, binding.PhaseDNS),
 	}
 }
 
@@ -69,68 +102,123 @@ func (f *FilteredBindingFetcher) FetchBindings() ([]syslog.Binding, error) {
 	if err != nil {
 		return nil, err
 	}
-	newBindings := []syslog.Binding{}
 
-	var invalidDrains float64
-	var blacklistedDrains float64
-	for _, b := range sourceBindings {
-		u, err := url.Parse(b.Drain.Url)
-		if err != nil {
-			invalidDrains += 1
-			f.printWarning("Cannot parse syslog drain url for application %s", b.AppId)
+	start := time.Now()
+	var resolveTime int64
+	reasons := make([]string, len(sourceBindings))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < filterWorkers && i < len(sourceBindings); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range indexes {
+				var d time.Duration
+				reasons[idx], d = f.rejectionReason(sourceBindings[idx])
+				atomic.AddInt64(&resolveTime, int64(d))
+			}
+		}()
+	}
+	for i := range sourceBindings {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	f.dnsPhase.Set(toMilliseconds(resolveTime))
+
+	newBindings := []syslog.Binding{}
+	rejected := make(map[string]float64)
+	for i, b := range sourceBindings {
+		if reasons[i] == "" {
+			newBindings = append(newBindings, b)
 			continue
 		}
+		rejected[reasons[i]] += 1
+	}
 
-		anonymousUrl := u
-		anonymousUrl.User = nil
-		anonymousUrl.RawQuery = ""
+	for r, g := range f.invalidDrainsByReason {
+		g.Set(rejected[r])
+	}
+	f.blacklistedDrains.Set(rejected[reasonBlacklist])
+	// Drains with an unsupported scheme are not counted as invalid.
+	f.invalidDrains.Set(rejected[reasonParse] + rejected[reasonNoHost] + rejected[reasonResolveFailure] + rejected[reasonBlacklist])
+	f.filterPhase.Set(toMilliseconds(time.Since(start).Nanoseconds()))
+	return newBindings, nil
+}
 
-		if invalidScheme(u.Scheme) {
-			f.printWarning("Invalid scheme %s in syslog drain url %s for application %s", u.Scheme, anonymousUrl.String(), b.AppId)
-			continue
-		}
+// rejectionReason returns why the binding is filtered or an empty string
+// if the binding is kept, and the time spent resolving the drain host.
+func (f *FilteredBindingFetcher) rejectionReason(b syslog.Binding) (string, time.Duration) {
+	u, err := url.Parse(b.Drain.Url)
+	if err != nil {
+		f.printf("Cannot parse syslog drain url for application %s", b.AppId)
+		return reasonParse, 0
+	}
 
-		if len(u.Host) == 0 {
-			invalidDrains += 1
-			f.printWarning("No hostname found in syslog drain url %s for application %s", anonymousUrl.String(), b.AppId)
-			continue
-		}
+	anonymousUrl := u
+	anonymousUrl.User = nil
+	anonymousUrl.RawQuery = ""
 
-		_, exists := f.failedHostsCache.Get(u.Host)
-		if exists {
-			invalidDrains += 1
-			f.printWarning("Skipped resolve ip address for syslog drain with url %s for application %s due to prior failure", anonymousUrl.String(), b.AppId)
-			continue
-		}
+	if invalidScheme(u.Scheme) && f.rejects(f.policies.Scheme, "Invalid scheme %s in syslog drain url %s for application %s", u.Scheme, anonymousUrl.String(), b.AppId) {
+		return reasonScheme, 0
+	}
 
-		ip, err := f.ipChecker.ResolveAddr(u.Host)
-		if err != nil {
-			invalidDrains += 1
-			f.failedHostsCache.Set(u.Host, true)
-			f.printWarning("Cannot resolve ip address for syslog drain with url %s for application %s", anonymousUrl.String(), b.AppId)
-			continue
-		}
+	if len(u.Host) == 0 {
+		f.printf("No hostname found in syslog drain url %s for application %s", anonymousUrl.String(), b.AppId)
+		return reasonNoHost, 0
+	}
 
-		err = f.ipChecker.CheckBlacklist(ip)
-		if err != nil {
-			invalidDrains += 1
-			blacklistedDrains += 1
-			f.printWarning("Resolved ip address for syslog drain with url %s for application %s is blacklisted", anonymousUrl.String(), b.AppId)
-			continue
+	reason, exists := f.failedHostsCache.Get(u.Host)
+	if exists {
+		f.printf("Skipped resolve ip address for syslog drain with url %s for application %s due to prior failure", anonymousUrl.String(), b.AppId)
+		return reason, 0
+	}
+
+	resolveStart := time.Now()
+	ip, err := f.ipChecker.ResolveAddr(u.Host)
+	resolveTime := time.Since(resolveStart)
+	if err != nil {
+		if f.rejectsHost(f.policies.ResolveFailure, u.Host, reasonResolveFailure, "Cannot resolve ip address for syslog drain with url %s for application %s", anonymousUrl.String(), b.AppId) {
+			return reasonResolveFailure, resolveTime
 		}
+		return "", resolveTime
+	}
 
-		newBindings = append(newBindings, b)
+	err = f.ipChecker.CheckBlacklist(ip)
+	if err != nil && f.rejectsHost(f.policies.Blacklist, u.Host, reasonBlacklist, "Resolved ip address for syslog drain with url %s for application %s is blacklisted", anonymousUrl.String(), b.AppId) {
+		return reasonBlacklist, resolveTime
 	}
 
-	f.blacklistedDrains.Set(blacklistedDrains)
-	f.invalidDrains.Set(invalidDrains)
-	return newBindings, nil
+	return "", resolveTime
+}
+
+// printf logs a violation unless the policies are silent.
+func (f *FilteredBindingFetcher) printf(format string, v ...any) {
+	if f.policies.Silent {
+		return
+	}
+	f.logger.Printf(format, v...)
+}
+
+// rejects logs the violation of a rule and reports whether the policy of
+// the rule rejects the binding.
+func (f *FilteredBindingFetcher) rejects(p FilterPolicy, format string, v ...any) bool {
+	if p == FilterPolicyWarn {
+		f.printf(format+", keeping the binding", v...)
+		return false
+	}
+	f.printf(format, v...)
+	return true
 }
 
-func (f FilteredBindingFetcher) printWarning(format string, v ...any) {
-	if f.warn {
-		f.logger.Printf(format, v...)
+// rejectsHost is rejects for rules that depend on the drain host. With
+// FilterPolicyRetryLater the host is not checked again until the failed
+// hosts cache expires.
+func (f *FilteredBindingFetcher) rejectsHost(p FilterPolicy, host, reason, format string, v ...any) bool {
+	if p == FilterPolicyRetryLater {
+		f.failedHostsCache.Set(host, reason)
 	}
+	return f.rejects(p, format, v...)
 }
 
 func invalidScheme(scheme string) bool {
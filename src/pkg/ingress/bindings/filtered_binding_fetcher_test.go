@@ -3,8 +3,10 @@ package bindings_test
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"log"
 	"net"
+	"time"
 
 	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
@@ -33,17 +35,74 @@ var _ = Describe("FilteredBindingFetcher", func() {
 		}
 		bindingReader := &SpyBindingReader{bindings: input}
 
-		filter = bindings.NewFilteredBindingFetcher(&spyIPChecker{}, bindingReader, metrics, true, log)
+		filter = bindings.NewFilteredBindingFetcher(&spyIPChecker{}, bindingReader, metrics, bindings.DefaultFilterPolicies(), log)
 		actual, err := filter.FetchBindings()
 
 		Expect(err).ToNot(HaveOccurred())
 		Expect(actual).To(Equal(input))
 	})
 
+	It("preserves the order of the bindings", func() {
+		var input []syslog.Binding
+		for i := 0; i < 100; i++ {
+			input = append(input, syslog.Binding{
+				AppId: fmt.Sprintf("app-%d", i),
+				Drain: syslog.Drain{Url: fmt.Sprintf("syslog://10.10.10.%d", i)},
+			})
+		}
+
+		filter = bindings.NewFilteredBindingFetcher(&spyIPChecker{}, &SpyBindingReader{bindings: input}, metrics, bindings.DefaultFilterPolicies(), log)
+		actual, err := filter.FetchBindings()
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(actual).To(Equal(input))
+	})
+
+	It("reports the duration of filtering and resolving drain hosts", func() {
+		input := []syslog.Binding{
+			{AppId: "app-1", Drain: syslog.Drain{Url: "syslog://10.10.10.10"}},
+			{AppId: "app-2", Drain: syslog.Drain{Url: "syslog://10.10.10.11"}},
+		}
+
+		filter = bindings.NewFilteredBindingFetcher(&spyIPChecker{resolveDelay: 10 * time.Millisecond}, &SpyBindingReader{bindings: input}, metrics, bindings.DefaultFilterPolicies(), log)
+		_, err := filter.FetchBindings()
+		Expect(err).ToNot(HaveOccurred())
+
+		phase := func(p string) float64 {
+			return metrics.GetMetric("binding_refresh_phase_duration", map[string]string{"unit": "ms", "phase": p}).Value()
+		}
+		Expect(phase("dns")).To(BeNumerically(">=", 20))
+		Expect(phase("filter")).To(BeNumerically(">=", 10))
+	})
+
+	It("counts invalid drains by rejection reason", func() {
+		input := []syslog.Binding{
+			{AppId: "app-id", Drain: syslog.Drain{Url: "syslog://10.10.10.10"}},
+			{AppId: "app-id", Drain: syslog.Drain{Url: "://"}},
+			{AppId: "app-id", Drain: syslog.Drain{Url: "bad-scheme://10.10.10.10"}},
+			{AppId: "app-id", Drain: syslog.Drain{Url: "blah://10.10.10.10"}},
+			{AppId: "app-id", Drain: syslog.Drain{Url: "https:///path"}},
+		}
+
+		filter = bindings.NewFilteredBindingFetcher(&spyIPChecker{}, &SpyBindingReader{bindings: input}, metrics, bindings.DefaultFilterPolicies(), log)
+		actual, err := filter.FetchBindings()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(actual).To(Equal(input[:1]))
+
+		byReason := func(reason string) float64 {
+			return metrics.GetMetric("invalid_drains_by_reason", map[string]string{"unit": "total", "reason": reason}).Value()
+		}
+		Expect(byReason("parse")).To(Equal(1.0))
+		Expect(byReason("scheme")).To(Equal(2.0))
+		Expect(byReason("no-host")).To(Equal(1.0))
+		Expect(byReason("resolve-failure")).To(Equal(0.0))
+		Expect(byReason("blacklist")).To(Equal(0.0))
+	})
+
 	It("returns an error if the binding reader cannot fetch bindings", func() {
 		bindingReader := &SpyBindingReader{nil, errors.New("Woops")}
 
-		filter := bindings.NewFilteredBindingFetcher(&spyIPChecker{}, bindingReader, metrics, true, log)
+		filter := bindings.NewFilteredBindingFetcher(&spyIPChecker{}, bindingReader, metrics, bindings.DefaultFilterPolicies(), log)
 		actual, err := filter.FetchBindings()
 
 		Expect(err).To(HaveOccurred())
@@ -52,12 +111,12 @@ var _ = Describe("FilteredBindingFetcher", func() {
 
 	Context("when syslog drain is unparsable", func() {
 		var logBuffer bytes.Buffer
-		var warn bool
+		var policies bindings.FilterPolicies
 
 		BeforeEach(func() {
 			logBuffer = bytes.Buffer{}
 			log.SetOutput(&logBuffer)
-			warn = true
+			policies = bindings.DefaultFilterPolicies()
 		})
 
 		JustBeforeEach(func() {
@@ -68,7 +127,7 @@ var _ = Describe("FilteredBindingFetcher", func() {
 				&spyIPChecker{},
 				&SpyBindingReader{bindings: input},
 				metrics,
-				warn,
+				policies,
 				log,
 			)
 		})
@@ -84,8 +143,9 @@ var _ = Describe("FilteredBindingFetcher", func() {
 
 		Context("when configured not to warn", func() {
 			BeforeEach(func() {
-				warn = false
+				policies.Silent = true
 			})
+
 			It("doesn't log the warning", func() {
 				_, err := filter.FetchBindings()
 				Expect(err).ToNot(HaveOccurred())
@@ -96,12 +156,12 @@ var _ = Describe("FilteredBindingFetcher", func() {
 
 	Context("when drain has no host", func() {
 		var logBuffer bytes.Buffer
-		var warn bool
+		var policies bindings.FilterPolicies
 
 		BeforeEach(func() {
 			logBuffer = bytes.Buffer{}
 			log.SetOutput(&logBuffer)
-			warn = true
+			policies = bindings.DefaultFilterPolicies()
 		})
 
 		JustBeforeEach(func() {
@@ -112,7 +172,7 @@ var _ = Describe("FilteredBindingFetcher", func() {
 				&spyIPChecker{},
 				&SpyBindingReader{bindings: input},
 				metrics,
-				warn,
+				policies,
 				log,
 			)
 		})
@@ -128,8 +188,9 @@ var _ = Describe("FilteredBindingFetcher", func() {
 
 		Context("when configured not to warn", func() {
 			BeforeEach(func() {
-				warn = false
+				policies.Silent = true
 			})
+
 			It("doesn't log the warning", func() {
 				_, err := filter.FetchBindings()
 				Expect(err).ToNot(HaveOccurred())
@@ -142,7 +203,7 @@ var _ = Describe("FilteredBindingFetcher", func() {
 		var (
 			input     []syslog.Binding
 			logBuffer bytes.Buffer
-			warn      bool
+			policies  bindings.FilterPolicies
 		)
 
 		BeforeEach(func() {
@@ -157,7 +218,7 @@ var _ = Describe("FilteredBindingFetcher", func() {
 
 			logBuffer = bytes.Buffer{}
 			log.SetOutput(&logBuffer)
-			warn = true
+			policies = bindings.DefaultFilterPolicies()
 
 			metrics = metricsHelpers.NewMetricsRegistry()
 		})
@@ -167,7 +228,7 @@ var _ = Describe("FilteredBindingFetcher", func() {
 				&spyIPChecker{},
 				&SpyBindingReader{bindings: input},
 				metrics,
-				warn,
+				policies,
 				log,
 			)
 		})
@@ -180,27 +241,46 @@ var _ = Describe("FilteredBindingFetcher", func() {
 			Expect(logBuffer.String()).Should(MatchRegexp("Invalid scheme (.*) in syslog drain url (.*) for application"))
 			Expect(metrics.GetMetric("invalid_drains", map[string]string{"unit": "total"}).Value()).To(Equal(0.0))
 		})
-		Context("when configured not to warn", func() {
+		Context("when the scheme policy is warn", func() {
 			BeforeEach(func() {
-				warn = false
+				policies.Scheme = bindings.FilterPolicyWarn
 			})
-			It("doesn't log the warning", func() {
-				_, err := filter.FetchBindings()
+
+			It("keeps the bindings", func() {
+				actual, err := filter.FetchBindings()
+
+				Expect(err).ToNot(HaveOccurred())
+				Expect(actual).To(Equal(append(input[:3:3], input[3], input[5])))
+				Expect(logBuffer.String()).Should(MatchRegexp("Invalid scheme (.*) in syslog drain url (.*) for application (.*), keeping the binding"))
+				Expect(metrics.GetMetric("invalid_drains_by_reason", map[string]string{"unit": "total", "reason": "scheme"}).Value()).To(Equal(0.0))
+				Expect(metrics.GetMetric("invalid_drains_by_reason", map[string]string{"unit": "total", "reason": "no-host"}).Value()).To(Equal(1.0))
+			})
+		})
+
+		Context("when the policies are silent", func() {
+			BeforeEach(func() {
+				policies.Silent = true
+			})
+
+			It("ignores the bindings without logging them", func() {
+				actual, err := filter.FetchBindings()
+
 				Expect(err).ToNot(HaveOccurred())
-				Expect(logBuffer.String()).ToNot(MatchRegexp("Invalid scheme"))
+				Expect(actual).To(Equal(input[:3]))
+				Expect(logBuffer.String()).To(BeEmpty())
 			})
 		})
 	})
 
 	Context("when the drain host fails to resolve", func() {
 		var logBuffer bytes.Buffer
-		var warn bool
+		var policies bindings.FilterPolicies
 		var mockic *mockIPChecker
 
 		BeforeEach(func() {
 			logBuffer = bytes.Buffer{}
 			log.SetOutput(&logBuffer)
-			warn = true
+			policies = bindings.DefaultFilterPolicies()
 			mockic = newMockIPChecker()
 			mockic.ResolveAddrOutput.Ret0 <- net.IP{}
 			mockic.ResolveAddrOutput.Ret1 <- errors.New("oof ouch ip not resolved")
@@ -214,7 +294,7 @@ var _ = Describe("FilteredBindingFetcher", func() {
 				mockic,
 				&SpyBindingReader{bindings: input},
 				metrics,
-				warn,
+				policies,
 				log,
 			)
 		})
@@ -226,6 +306,7 @@ var _ = Describe("FilteredBindingFetcher", func() {
 			Expect(actual).To(Equal([]syslog.Binding{}))
 			Expect(logBuffer.String()).Should(MatchRegexp("Cannot resolve ip address for syslog drain with url"))
 			Expect(metrics.GetMetric("invalid_drains", map[string]string{"unit": "total"}).Value()).To(Equal(1.0))
+			Expect(metrics.GetMetric("invalid_drains_by_reason", map[string]string{"unit": "total", "reason": "resolve-failure"}).Value()).To(Equal(1.0))
 		})
 
 		It("caches bindings that failed to resolve", func() {
@@ -245,26 +326,52 @@ var _ = Describe("FilteredBindingFetcher", func() {
 			Expect(metrics.GetMetric("invalid_drains", map[string]string{"unit": "total"}).Value()).To(Equal(1.0))
 		})
 
-		Context("when configured not to warn", func() {
+		Context("when the resolve failure policy is drop", func() {
 			BeforeEach(func() {
-				warn = false
+				policies.ResolveFailure = bindings.FilterPolicyDrop
+				mockic.ResolveAddrOutput.Ret0 <- net.IP{}
+				mockic.ResolveAddrOutput.Ret1 <- errors.New("oof ouch ip not resolved")
 			})
-			It("doesn't log the warning", func() {
-				_, err := filter.FetchBindings()
+
+			It("resolves the drain host again on the next fetch", func() {
+				actual, err := filter.FetchBindings()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(actual).To(BeEmpty())
+				Eventually(mockic.ResolveAddrCalled).Should(Receive())
+
+				actual, err = filter.FetchBindings()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(actual).To(BeEmpty())
+				Eventually(mockic.ResolveAddrCalled).Should(Receive())
+				Expect(logBuffer.String()).ToNot(MatchRegexp("Skipped resolve ip address for syslog drain with url"))
+				Expect(metrics.GetMetric("invalid_drains_by_reason", map[string]string{"unit": "total", "reason": "resolve-failure"}).Value()).To(Equal(1.0))
+			})
+		})
+
+		Context("when the resolve failure policy is warn", func() {
+			BeforeEach(func() {
+				policies.ResolveFailure = bindings.FilterPolicyWarn
+			})
+
+			It("keeps the binding", func() {
+				actual, err := filter.FetchBindings()
+
 				Expect(err).ToNot(HaveOccurred())
-				Expect(logBuffer.String()).ToNot(MatchRegexp("Cannot resolve ip address for syslog drain with url"))
+				Expect(actual).To(HaveLen(1))
+				Expect(logBuffer.String()).Should(MatchRegexp("Cannot resolve ip address for syslog drain with url (.*) for application (.*), keeping the binding"))
+				Expect(metrics.GetMetric("invalid_drains", map[string]string{"unit": "total"}).Value()).To(Equal(0.0))
 			})
 		})
 	})
 
 	Context("when the syslog drain has been blacklisted", func() {
 		var logBuffer bytes.Buffer
-		var warn bool
+		var policies bindings.FilterPolicies
 
 		BeforeEach(func() {
 			logBuffer = bytes.Buffer{}
 			log.SetOutput(&logBuffer)
-			warn = true
+			policies = bindings.DefaultFilterPolicies()
 		})
 
 		JustBeforeEach(func() {
@@ -279,7 +386,7 @@ var _ = Describe("FilteredBindingFetcher", func() {
 				},
 				&SpyBindingReader{bindings: input},
 				metrics,
-				warn,
+				policies,
 				log,
 			)
 		})
@@ -292,26 +399,46 @@ var _ = Describe("FilteredBindingFetcher", func() {
 			Expect(actual).To(Equal([]syslog.Binding{}))
 			Expect(metrics.GetMetric("invalid_drains", map[string]string{"unit": "total"}).Value()).To(Equal(1.0))
 			Expect(metrics.GetMetric("blacklisted_drains", map[string]string{"unit": "total"}).Value()).To(Equal(1.0))
+			Expect(metrics.GetMetric("invalid_drains_by_reason", map[string]string{"unit": "total", "reason": "blacklist"}).Value()).To(Equal(1.0))
 		})
 
-		Context("when configured not to warn", func() {
+		Context("when the blacklist policy is warn", func() {
 			BeforeEach(func() {
-				warn = false
+				policies.Blacklist = bindings.FilterPolicyWarn
 			})
-			It("doesn't log the warning", func() {
-				_, err := filter.FetchBindings()
+
+			It("keeps the binding", func() {
+				actual, err := filter.FetchBindings()
 
 				Expect(err).ToNot(HaveOccurred())
-				Expect(logBuffer.String()).ToNot(MatchRegexp("Resolved ip address for syslog drain with url (.*) for application (.*) is blacklisted"))
+				Expect(actual).To(HaveLen(1))
+				Expect(logBuffer.String()).Should(MatchRegexp("Resolved ip address for syslog drain with url (.*) for application (.*) is blacklisted, keeping the binding"))
+				Expect(metrics.GetMetric("blacklisted_drains", map[string]string{"unit": "total"}).Value()).To(Equal(0.0))
 			})
 		})
 	})
 })
 
+var _ = Describe("FilterPolicy", func() {
+	It("unmarshals known policies", func() {
+		var p bindings.FilterPolicy
+		Expect(p.UnmarshalEnv("retry-later")).To(Succeed())
+		Expect(p).To(Equal(bindings.FilterPolicyRetryLater))
+		Expect(p.UnmarshalEnv("")).To(Succeed())
+		Expect(p).To(Equal(bindings.FilterPolicyRetryLater))
+	})
+
+	It("rejects unknown policies", func() {
+		var p bindings.FilterPolicy
+		Expect(p.UnmarshalEnv("ignore")).To(MatchError(`unknown filter policy "ignore"`))
+	})
+})
+
 type spyIPChecker struct {
 	checkBlacklistError error
 	resolveAddrError    error
 	resolvedIP          net.IP
+	resolveDelay        time.Duration
 }
 
 func (s *spyIPChecker) CheckBlacklist(net.IP) error {
@@ -319,6 +446,7 @@ func (s *spyIPChecker) CheckBlacklist(net.IP) error {
 }
 
 func (s *spyIPChecker) ResolveAddr(host string) (net.IP, error) {
+	time.Sleep(s.resolveDelay)
 	return s.resolvedIP, s.resolveAddrError
 }
 
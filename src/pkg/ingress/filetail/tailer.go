@@ -0,0 +1,417 @@
+// Package filetail tails log files and converts their lines to log
+// envelopes, for platform components that only write logs to files.
+//
+// A Tailer polls the files matching its glob patterns and persists the
+// offsets it has read to a checkpoint file, so that it resumes where it
+// stopped after a restart. Rotated files are read to the end before the
+// new file at the path is read from its start, and truncated files are
+// read again from their start.
+//
+//	t := filetail.NewTailer(
+//		[]string{"/var/vcap/sys/log/*/*.log"},
+//		buffer, m, logger,
+//		filetail.WithCheckpointFile("/var/vcap/data/loggr-forwarder-agent/file_tail.json"),
+//	)
+//	go t.Run(ctx)
+package filetail
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metrics "code.cloudfoundry.org/go-metric-registry"
+)
+
+// maxLineSize is the largest line that is written as one envelope. Longer
+// lines are split.
+const maxLineSize = 64 * 1024
+
+// jobLogDir is the directory BOSH jobs write their logs to, one
+// subdirectory per job.
+const jobLogDir = "/var/vcap/sys/log/"
+
+// EnvelopeSetter receives the log envelopes converted from file lines.
+type EnvelopeSetter interface {
+	Set(e *loggregator_v2.Envelope)
+}
+
+// MetricClient creates the metrics of a Tailer.
+type MetricClient interface {
+	NewCounter(name, helpText string, opts ...metrics.MetricOption) metrics.Counter
+}
+
+// Tailer tails the files matching its glob patterns. The envelopes of a
+// file are tagged with the file path and, for files in a BOSH job log
+// directory, the job name, which is also used as source ID. The source ID
+// of other files is the file name.
+type Tailer struct {
+	globs          []string
+	setter         EnvelopeSetter
+	log            *log.Logger
+	checkpointFile string
+	pollInterval   time.Duration
+
+	files       map[string]*file
+	rotated     []rotatedFile
+	checkpoints map[string]int64
+	initialized bool
+
+	lines  metrics.Counter
+	errors metrics.Counter
+}
+
+type file struct {
+	path    string
+	f       *os.File
+	info    os.FileInfo
+	offset  int64
+	partial []byte
+	tags    map[string]string
+	source  string
+}
+
+// rotatedFile is a file that is no longer tailed at its path, e.g. because
+// it was renamed by log rotation.
+type rotatedFile struct {
+	info   os.FileInfo
+	offset int64
+}
+
+// TailerOption configures a Tailer.
+type TailerOption func(*Tailer)
+
+// WithCheckpointFile persists the read offsets to path. Without a
+// checkpoint file the Tailer starts at the end of the files that exist
+// when it starts.
+func WithCheckpointFile(path string) TailerOption {
+	return func(t *Tailer) {
+		t.checkpointFile = path
+	}
+}
+
+// WithPollInterval sets how often the files are read. Defaults to one
+// second.
+func WithPollInterval(d time.Duration) TailerOption {
+	return func(t *Tailer) {
+		t.pollInterval = d
+	}
+}
+
+// NewTailer returns a Tailer that writes the lines of the files matching
+// the globs to s.
+func NewTailer(globs []string, s EnvelopeSetter, m MetricClient, l *log.Logger, opts ...TailerOption) *Tailer {
+	t := &Tailer{
+		globs:        globs,
+		setter:       s,
+		log:          l,
+		pollInterval: time.Second,
+		files:        make(map[string]*file),
+		checkpoints:  make(map[string]int64),
+		lines: m.NewCounter(
+			"file_tail_lines",
+			"Total number of lines read from tailed files.",
+		),
+		errors: m.NewCounter(
+			"file_tail_errors",
+			"Total number of errors reading tailed files.",
+		),
+	}
+	for _, o := range opts {
+		o(t)
+	}
+	return t
+}
+
+// Run tails the files until ctx is done. The checkpoint file is written
+// after every poll and before Run returns.
+func (t *Tailer) Run(ctx context.Context) {
+	t.loadCheckpoints()
+
+	ticker := time.NewTicker(t.pollInterval)
+	defer ticker.Stop()
+	defer t.closeFiles()
+
+	for {
+		t.poll()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (t *Tailer) poll() {
+	paths := t.match()
+
+	for path := range paths {
+		if _, ok := t.files[path]; !ok {
+			t.open(path)
+		}
+	}
+	t.rotated = nil
+
+	for path, f := range t.files {
+		t.read(f)
+
+		info, err := os.Stat(path)
+		switch {
+		case err != nil && errors.Is(err, os.ErrNotExist), err == nil && !paths[path]:
+			t.close(f)
+		case err != nil:
+			t.errors.Add(1)
+		case !os.SameFile(info, f.info):
+			// The file was rotated. The old file has been read to its end,
+			// so continue with the new file from its start.
+			t.close(f)
+			t.openAt(path, 0)
+		case info.Size() < f.offset:
+			// The file was truncated.
+			f.partial = nil
+			f.offset = 0
+			if _, err := f.f.Seek(0, io.SeekStart); err != nil {
+				t.errors.Add(1)
+			}
+			t.read(f)
+		}
+	}
+
+	t.initialized = true
+	t.saveCheckpoints()
+}
+
+func (t *Tailer) match() map[string]bool {
+	paths := make(map[string]bool)
+	for _, g := range t.globs {
+		matches, err := filepath.Glob(g)
+		if err != nil {
+			t.log.Printf("invalid glob %q: %s", g, err)
+			continue
+		}
+		for _, m := range matches {
+			if info, err := os.Stat(m); err == nil && info.Mode().IsRegular() {
+				paths[m] = true
+			}
+		}
+	}
+	return paths
+}
+
+// open starts tailing the file at path. The file is read from its
+// checkpoint, from its end if it existed when the Tailer started, and from
+// its start otherwise. Rotated files that still match a glob continue where
+// they were read to at their previous path.
+func (t *Tailer) open(path string) {
+	offset, ok := t.checkpoints[path]
+	if !ok && !t.initialized {
+		offset = -1
+	}
+
+	if info, err := os.Stat(path); err == nil {
+		for _, f := range t.files {
+			if os.SameFile(info, f.info) {
+				// The file is still read at its previous path and will be
+				// picked up once it was read to its end.
+				return
+			}
+		}
+		for _, r := range t.rotated {
+			if os.SameFile(info, r.info) {
+				offset = r.offset
+			}
+		}
+	}
+
+	t.openAt(path, offset)
+}
+
+// close stops tailing the file after writing its last line.
+func (t *Tailer) close(f *file) {
+	t.flushPartial(f)
+	f.f.Close()
+	delete(t.files, f.path)
+	t.rotated = append(t.rotated, rotatedFile{info: f.info, offset: f.offset})
+}
+
+// openAt opens the file at path and seeks to the offset or, if the offset
+// is negative, to the end of the file. Offsets beyond the end of the file
+// are reset to its start.
+func (t *Tailer) openAt(path string, offset int64) {
+	fh, err := os.Open(path)
+	if err != nil {
+		t.errors.Add(1)
+		return
+	}
+	info, err := fh.Stat()
+	if err != nil {
+		fh.Close()
+		t.errors.Add(1)
+		return
+	}
+
+	if offset < 0 {
+		offset = info.Size()
+	}
+	if offset > info.Size() {
+		offset = 0
+	}
+	if _, err := fh.Seek(offset, io.SeekStart); err != nil {
+		fh.Close()
+		t.errors.Add(1)
+		return
+	}
+
+	source, tags := fileSource(path)
+	t.files[path] = &file{
+		path:   path,
+		f:      fh,
+		info:   info,
+		offset: offset,
+		tags:   tags,
+		source: source,
+	}
+}
+
+func (t *Tailer) read(f *file) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := f.f.Read(buf)
+		if n > 0 {
+			f.offset += int64(n)
+			t.writeLines(f, buf[:n])
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				t.errors.Add(1)
+			}
+			return
+		}
+	}
+}
+
+func (t *Tailer) writeLines(f *file, data []byte) {
+	f.partial = append(f.partial, data...)
+	for {
+		i := bytes.IndexByte(f.partial, '\n')
+		if i < 0 {
+			break
+		}
+		t.write(f, f.partial[:i])
+		f.partial = f.partial[i+1:]
+	}
+	for len(f.partial) >= maxLineSize {
+		t.write(f, f.partial[:maxLineSize])
+		f.partial = f.partial[maxLineSize:]
+	}
+	f.partial = append([]byte(nil), f.partial...)
+}
+
+// flushPartial writes the last line of a file that does not end with a
+// newline.
+func (t *Tailer) flushPartial(f *file) {
+	if len(f.partial) > 0 {
+		t.write(f, f.partial)
+		f.partial = nil
+	}
+}
+
+func (t *Tailer) write(f *file, line []byte) {
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	if len(line) == 0 {
+		return
+	}
+
+	tags := make(map[string]string, len(f.tags))
+	for k, v := range f.tags {
+		tags[k] = v
+	}
+	t.setter.Set(&loggregator_v2.Envelope{
+		Timestamp: time.Now().UnixNano(),
+		SourceId:  f.source,
+		Tags:      tags,
+		Message: &loggregator_v2.Envelope_Log{
+			Log: &loggregator_v2.Log{
+				Payload: append([]byte(nil), line...),
+				Type:    loggregator_v2.Log_OUT,
+			},
+		},
+	})
+	t.lines.Add(1)
+}
+
+// fileSource returns the source ID and the tags of the envelopes of the
+// file at path.
+func fileSource(path string) (string, map[string]string) {
+	tags := map[string]string{"file": path}
+	if rel, ok := strings.CutPrefix(path, jobLogDir); ok {
+		if job, _, ok := strings.Cut(rel, "/"); ok && job != "" {
+			tags["job"] = job
+			return job, tags
+		}
+	}
+	return filepath.Base(path), tags
+}
+
+func (t *Tailer) loadCheckpoints() {
+	if t.checkpointFile == "" {
+		return
+	}
+
+	b, err := os.ReadFile(t.checkpointFile)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			t.log.Printf("failed to read checkpoint file: %s", err)
+		}
+		return
+	}
+	if err := json.Unmarshal(b, &t.checkpoints); err != nil {
+		t.log.Printf("failed to parse checkpoint file: %s", err)
+		t.checkpoints = make(map[string]int64)
+		return
+	}
+
+	// Files without a checkpoint are new if the Tailer ran before.
+	t.initialized = true
+}
+
+// saveCheckpoints writes the offsets of the complete lines that were read.
+func (t *Tailer) saveCheckpoints() {
+	t.checkpoints = make(map[string]int64, len(t.files))
+	for path, f := range t.files {
+		t.checkpoints[path] = f.offset - int64(len(f.partial))
+	}
+
+	if t.checkpointFile == "" {
+		return
+	}
+
+	b, err := json.Marshal(t.checkpoints)
+	if err != nil {
+		return
+	}
+	tmp := t.checkpointFile + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		t.log.Printf("failed to write checkpoint file: %s", err)
+		return
+	}
+	if err := os.Rename(tmp, t.checkpointFile); err != nil {
+		t.log.Printf("failed to write checkpoint file: %s", err)
+	}
+}
+
+func (t *Tailer) closeFiles() {
+	for path, f := range t.files {
+		f.f.Close()
+		delete(t.files, path)
+	}
+}
@@ -0,0 +1,174 @@
+package filetail_test
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
+
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/ingress/filetail"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Tailer", func() {
+	var (
+		setter         *spySetter
+		spy            *metricsHelpers.SpyMetricsRegistry
+		logger         *log.Logger
+		dir            string
+		path           string
+		checkpointFile string
+		cancel         context.CancelFunc
+		done           chan struct{}
+	)
+
+	start := func() {
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		done = make(chan struct{})
+		t := filetail.NewTailer(
+			[]string{filepath.Join(dir, "*.log")},
+			setter, spy, logger,
+			filetail.WithCheckpointFile(checkpointFile),
+			filetail.WithPollInterval(10*time.Millisecond),
+		)
+		go func() {
+			defer close(done)
+			t.Run(ctx)
+		}()
+	}
+
+	stop := func() {
+		cancel()
+		Eventually(done).Should(BeClosed())
+	}
+
+	appendLines := func(p string, data string) {
+		f, err := os.OpenFile(p, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		Expect(err).ToNot(HaveOccurred())
+		defer f.Close()
+		_, err = f.WriteString(data)
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	payloads := func() []string {
+		var p []string
+		for _, e := range setter.Envelopes() {
+			p = append(p, string(e.GetLog().GetPayload()))
+		}
+		return p
+	}
+
+	BeforeEach(func() {
+		setter = &spySetter{}
+		spy = metricsHelpers.NewMetricsRegistry()
+		logger = log.New(GinkgoWriter, "", 0)
+		dir = GinkgoT().TempDir()
+		path = filepath.Join(dir, "app.log")
+		checkpointFile = filepath.Join(GinkgoT().TempDir(), "checkpoints.json")
+	})
+
+	AfterEach(func() {
+		if cancel != nil {
+			stop()
+		}
+	})
+
+	It("converts appended lines to log envelopes", func() {
+		appendLines(path, "old-line\n")
+		start()
+		Eventually(checkpointFile).Should(BeAnExistingFile())
+
+		appendLines(path, "line-1\nline-2\r\n")
+
+		Eventually(payloads).Should(Equal([]string{"line-1", "line-2"}))
+		e := setter.Envelopes()[0]
+		Expect(e.GetSourceId()).To(Equal("app.log"))
+		Expect(e.GetTags()).To(HaveKeyWithValue("file", path))
+		Expect(e.GetLog().GetType()).To(Equal(loggregator_v2.Log_OUT))
+		Expect(spy.GetMetric("file_tail_lines", nil).Value()).To(Equal(2.0))
+	})
+
+	It("reads files created after it started from their start", func() {
+		start()
+		Eventually(checkpointFile).Should(BeAnExistingFile())
+
+		appendLines(path, "line-1\n")
+
+		Eventually(payloads).Should(Equal([]string{"line-1"}))
+	})
+
+	It("waits for the end of a line", func() {
+		start()
+		Eventually(checkpointFile).Should(BeAnExistingFile())
+
+		appendLines(path, "partial")
+		Consistently(payloads, 100*time.Millisecond).Should(BeEmpty())
+
+		appendLines(path, "-line\n")
+		Eventually(payloads).Should(Equal([]string{"partial-line"}))
+	})
+
+	It("resumes from the checkpoint after a restart", func() {
+		start()
+		Eventually(checkpointFile).Should(BeAnExistingFile())
+		appendLines(path, "line-1\n")
+		Eventually(payloads).Should(HaveLen(1))
+		stop()
+
+		appendLines(path, "line-2\n")
+		start()
+
+		Eventually(payloads).Should(Equal([]string{"line-1", "line-2"}))
+		Consistently(payloads, 100*time.Millisecond).Should(HaveLen(2))
+	})
+
+	It("reads rotated files to their end before the new file", func() {
+		start()
+		Eventually(checkpointFile).Should(BeAnExistingFile())
+		appendLines(path, "line-1\n")
+		Eventually(payloads).Should(HaveLen(1))
+
+		appendLines(path, "line-2\n")
+		Expect(os.Rename(path, path+".1")).To(Succeed())
+		appendLines(path, "line-3\n")
+
+		Eventually(payloads).Should(Equal([]string{"line-1", "line-2", "line-3"}))
+	})
+
+	It("reads truncated files from their start", func() {
+		start()
+		Eventually(checkpointFile).Should(BeAnExistingFile())
+		appendLines(path, "line-1\nline-2\n")
+		Eventually(payloads).Should(HaveLen(2))
+
+		Expect(os.Truncate(path, 0)).To(Succeed())
+		appendLines(path, "line-3\n")
+
+		Eventually(payloads).Should(Equal([]string{"line-1", "line-2", "line-3"}))
+	})
+})
+
+type spySetter struct {
+	mu        sync.Mutex
+	envelopes []*loggregator_v2.Envelope
+}
+
+func (s *spySetter) Set(e *loggregator_v2.Envelope) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.envelopes = append(s.envelopes, e)
+}
+
+func (s *spySetter) Envelopes() []*loggregator_v2.Envelope {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*loggregator_v2.Envelope(nil), s.envelopes...)
+}
@@ -0,0 +1,367 @@
+// Package journald reads the logs of system components from
+// systemd-journald and converts them to log envelopes, so that platform
+// component logs flow through the agent pipeline without a separate
+// node-level log shipper.
+//
+// Journal entries are read in the JSON export format of journalctl, one
+// JSON object per line, either by following the journal with journalctl or
+// from connections to a unix socket:
+//
+//	r := journald.NewReader(buffer, m, logger, journald.WithUnits([]string{"nginx.service"}))
+//	go r.FollowJournal(ctx)
+//
+// While following the journal the Reader keeps the cursor of the last
+// entry it read, so that journalctl resumes after it when it is restarted.
+// With a cursor file the cursor also survives restarts of the agent.
+package journald
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metrics "code.cloudfoundry.org/go-metric-registry"
+
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/plumbing"
+)
+
+// maxEntrySize is the largest journal entry that is read. Longer entries
+// are skipped.
+const maxEntrySize = 1024 * 1024
+
+// cursorSaveInterval is how often the cursor of a followed journal is
+// written to the cursor file while entries are read.
+const cursorSaveInterval = time.Second
+
+// EnvelopeSetter receives the log envelopes converted from journal entries.
+type EnvelopeSetter interface {
+	Set(e *loggregator_v2.Envelope)
+}
+
+// MetricClient creates the metrics of a Reader.
+type MetricClient interface {
+	NewCounter(name, helpText string, opts ...metrics.MetricOption) metrics.Counter
+}
+
+// Reader converts journal entries to log envelopes. The source ID of an
+// envelope is the systemd unit of the entry, or its syslog identifier if
+// the entry does not belong to a unit.
+type Reader struct {
+	setter         EnvelopeSetter
+	log            *log.Logger
+	units          map[string]bool
+	journalctl     string
+	restartBackoff time.Duration
+	cursorFile     string
+	socketMode     os.FileMode
+
+	// cursor is the cursor of the last entry read from journalctl. It is
+	// only used by FollowJournal.
+	cursor      string
+	cursorSaved time.Time
+
+	entries metrics.Counter
+	invalid metrics.Counter
+}
+
+// ReaderOption configures a Reader.
+type ReaderOption func(*Reader)
+
+// WithUnits only reads the entries of the given systemd units. By default
+// the entries of all units are read.
+func WithUnits(units []string) ReaderOption {
+	return func(r *Reader) {
+		if len(units) == 0 {
+			return
+		}
+		r.units = make(map[string]bool, len(units))
+		for _, u := range units {
+			r.units[u] = true
+		}
+	}
+}
+
+// WithJournalctl sets the journalctl command used by FollowJournal.
+// Defaults to journalctl.
+func WithJournalctl(path string) ReaderOption {
+	return func(r *Reader) {
+		r.journalctl = path
+	}
+}
+
+// WithCursorFile persists the cursor of the last entry read from the
+// followed journal to path, so that FollowJournal resumes after it when the
+// agent restarts. Without a cursor file FollowJournal starts with the
+// entries written after it starts.
+func WithCursorFile(path string) ReaderOption {
+	return func(r *Reader) {
+		r.cursorFile = path
+	}
+}
+
+// WithSocketPermissions sets the permissions of the socket created by
+// ServeSocket. Defaults to 0660.
+func WithSocketPermissions(mode os.FileMode) ReaderOption {
+	return func(r *Reader) {
+		r.socketMode = mode
+	}
+}
+
+// NewReader returns a Reader that writes log envelopes to s.
+func NewReader(s EnvelopeSetter, m MetricClient, l *log.Logger, opts ...ReaderOption) *Reader {
+	r := &Reader{
+		setter:         s,
+		log:            l,
+		journalctl:     "journalctl",
+		restartBackoff: 5 * time.Second,
+		socketMode:     0660,
+		entries: m.NewCounter(
+			"journald_entries",
+			"Total number of journal entries ingressed as log envelopes.",
+		),
+		invalid: m.NewCounter(
+			"journald_invalid_entries",
+			"Total number of journal entries that could not be parsed.",
+		),
+	}
+	for _, o := range opts {
+		o(r)
+	}
+	return r
+}
+
+// FollowJournal follows the journal with journalctl until ctx is done.
+// It reads the entries after the persisted cursor, or only the entries
+// written after it starts if there is none. If journalctl exits it is
+// restarted after a backoff and resumes after the last entry read.
+func (r *Reader) FollowJournal(ctx context.Context) {
+	r.loadCursor()
+
+	for ctx.Err() == nil {
+		args := []string{"--output=json", "--follow"}
+		if r.cursor != "" {
+			args = append(args, "--after-cursor="+r.cursor)
+		} else {
+			args = append(args, "--lines=0")
+		}
+		for u := range r.units {
+			args = append(args, "--unit="+u)
+		}
+
+		err := r.runJournalctl(ctx, args)
+		r.saveCursor()
+		if err != nil && ctx.Err() == nil {
+			r.log.Printf("journalctl failed, restarting in %s: %s", r.restartBackoff, err)
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(r.restartBackoff):
+		}
+	}
+}
+
+func (r *Reader) runJournalctl(ctx context.Context, args []string) error {
+	cmd := exec.CommandContext(ctx, r.journalctl, args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	readErr := r.read(stdout, r.setCursor)
+	if err := cmd.Wait(); err != nil {
+		return err
+	}
+	return readErr
+}
+
+// setCursor records the cursor of an entry read from journalctl and
+// writes it to the cursor file at most every cursorSaveInterval.
+func (r *Reader) setCursor(cursor string) {
+	if cursor == "" {
+		return
+	}
+	r.cursor = cursor
+	if time.Since(r.cursorSaved) >= cursorSaveInterval {
+		r.saveCursor()
+	}
+}
+
+func (r *Reader) loadCursor() {
+	if r.cursorFile == "" {
+		return
+	}
+
+	b, err := os.ReadFile(r.cursorFile)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			r.log.Printf("failed to read cursor file: %s", err)
+		}
+		return
+	}
+	r.cursor = strings.TrimSpace(string(b))
+}
+
+// saveCursor writes the cursor of the last entry read to the cursor file.
+func (r *Reader) saveCursor() {
+	r.cursorSaved = time.Now()
+	if r.cursorFile == "" || r.cursor == "" {
+		return
+	}
+
+	tmp := r.cursorFile + ".tmp"
+	if err := os.WriteFile(tmp, []byte(r.cursor), 0600); err != nil {
+		r.log.Printf("failed to write cursor file: %s", err)
+		return
+	}
+	if err := os.Rename(tmp, r.cursorFile); err != nil {
+		r.log.Printf("failed to write cursor file: %s", err)
+	}
+}
+
+// ServeSocket reads journal entries from connections to a unix socket at
+// path until ctx is done. Each connection sends entries in the JSON export
+// format, one per line. Clients can only connect once the socket has the
+// permissions of the Reader.
+func (r *Reader) ServeSocket(ctx context.Context, path string) error {
+	l, err := plumbing.ListenUnix(path, r.socketMode)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			if err := r.Read(conn); err != nil {
+				r.log.Printf("failed to read journal entries from socket: %s", err)
+			}
+		}()
+	}
+}
+
+// Read reads journal entries from rd until EOF.
+func (r *Reader) Read(rd io.Reader) error {
+	return r.read(rd, nil)
+}
+
+// read reads journal entries from rd until EOF and calls cursor, if not
+// nil, with the cursor of every entry that was read.
+func (r *Reader) read(rd io.Reader, cursor func(string)) error {
+	s := bufio.NewScanner(rd)
+	s.Buffer(make([]byte, 64*1024), maxEntrySize)
+
+	for s.Scan() {
+		line := s.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(line, &fields); err != nil {
+			r.invalid.Add(1)
+			continue
+		}
+		if cursor != nil {
+			cursor(field(fields, "__CURSOR"))
+		}
+
+		e := r.envelope(fields)
+		if e == nil {
+			continue
+		}
+
+		r.setter.Set(e)
+		r.entries.Add(1)
+	}
+	return s.Err()
+}
+
+// envelope converts the journal entry to a log envelope. It returns nil
+// if the entry is not selected by the units of the Reader.
+func (r *Reader) envelope(fields map[string]json.RawMessage) *loggregator_v2.Envelope {
+	unit := field(fields, "_SYSTEMD_UNIT")
+	if r.units != nil && !r.units[unit] {
+		return nil
+	}
+
+	sourceID := unit
+	if sourceID == "" {
+		sourceID = field(fields, "SYSLOG_IDENTIFIER")
+	}
+	if sourceID == "" {
+		sourceID = "journald"
+	}
+
+	timestamp := time.Now().UnixNano()
+	if us, err := strconv.ParseInt(field(fields, "__REALTIME_TIMESTAMP"), 10, 64); err == nil {
+		timestamp = us * int64(time.Microsecond)
+	}
+
+	logType := loggregator_v2.Log_OUT
+	// Priorities 0 (emerg) to 3 (err) are errors.
+	if p, err := strconv.Atoi(field(fields, "PRIORITY")); err == nil && p <= 3 {
+		logType = loggregator_v2.Log_ERR
+	}
+
+	tags := map[string]string{}
+	if h := field(fields, "_HOSTNAME"); h != "" {
+		tags["hostname"] = h
+	}
+
+	return &loggregator_v2.Envelope{
+		Timestamp: timestamp,
+		SourceId:  sourceID,
+		Tags:      tags,
+		Message: &loggregator_v2.Envelope_Log{
+			Log: &loggregator_v2.Log{
+				Payload: []byte(field(fields, "MESSAGE")),
+				Type:    logType,
+			},
+		},
+	}
+}
+
+// field returns the value of a journal field. Fields that are not valid
+// UTF-8 are exported as arrays of bytes.
+func field(fields map[string]json.RawMessage, name string) string {
+	raw, ok := fields[name]
+	if !ok {
+		return ""
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	var b []byte
+	var ints []int
+	if err := json.Unmarshal(raw, &ints); err == nil {
+		for _, i := range ints {
+			b = append(b, byte(i))
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,211 @@
+package journald_test
+
+import (
+	"context"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
+
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/ingress/journald"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const nginxEntry = `{"__REALTIME_TIMESTAMP":"1700000000000001","_SYSTEMD_UNIT":"nginx.service","_HOSTNAME":"cell-1","PRIORITY":"6","MESSAGE":"some-message"}`
+
+var _ = Describe("Reader", func() {
+	var (
+		setter *spySetter
+		spy    *metricsHelpers.SpyMetricsRegistry
+		logger *log.Logger
+	)
+
+	BeforeEach(func() {
+		setter = &spySetter{}
+		spy = metricsHelpers.NewMetricsRegistry()
+		logger = log.New(GinkgoWriter, "", 0)
+	})
+
+	Describe("Read()", func() {
+		It("converts journal entries to log envelopes", func() {
+			r := journald.NewReader(setter, spy, logger)
+
+			Expect(r.Read(strings.NewReader(nginxEntry + "\n"))).To(Succeed())
+
+			Expect(setter.Envelopes()).To(HaveLen(1))
+			e := setter.Envelopes()[0]
+			Expect(e.GetSourceId()).To(Equal("nginx.service"))
+			Expect(e.GetTimestamp()).To(Equal(int64(1700000000000001000)))
+			Expect(e.GetTags()).To(HaveKeyWithValue("hostname", "cell-1"))
+			Expect(e.GetLog().GetPayload()).To(Equal([]byte("some-message")))
+			Expect(e.GetLog().GetType()).To(Equal(loggregator_v2.Log_OUT))
+			Expect(spy.GetMetric("journald_entries", nil).Value()).To(Equal(1.0))
+		})
+
+		It("uses the syslog identifier without a unit", func() {
+			r := journald.NewReader(setter, spy, logger)
+
+			Expect(r.Read(strings.NewReader(`{"SYSLOG_IDENTIFIER":"kernel","MESSAGE":"some-message"}`))).To(Succeed())
+
+			Expect(setter.Envelopes()).To(ConsistOf(HaveField("SourceId", "kernel")))
+		})
+
+		It("writes error priorities to stderr", func() {
+			r := journald.NewReader(setter, spy, logger)
+
+			Expect(r.Read(strings.NewReader(`{"_SYSTEMD_UNIT":"nginx.service","PRIORITY":"3","MESSAGE":"some-error"}`))).To(Succeed())
+
+			Expect(setter.Envelopes()[0].GetLog().GetType()).To(Equal(loggregator_v2.Log_ERR))
+		})
+
+		It("decodes binary messages", func() {
+			r := journald.NewReader(setter, spy, logger)
+
+			Expect(r.Read(strings.NewReader(`{"_SYSTEMD_UNIT":"nginx.service","MESSAGE":[104,105,255]}`))).To(Succeed())
+
+			Expect(setter.Envelopes()[0].GetLog().GetPayload()).To(Equal([]byte{104, 105, 255}))
+		})
+
+		It("only reads the entries of the configured units", func() {
+			r := journald.NewReader(setter, spy, logger, journald.WithUnits([]string{"sshd.service"}))
+
+			Expect(r.Read(strings.NewReader(nginxEntry + "\n" + `{"_SYSTEMD_UNIT":"sshd.service","MESSAGE":"some-message"}`))).To(Succeed())
+
+			Expect(setter.Envelopes()).To(ConsistOf(HaveField("SourceId", "sshd.service")))
+		})
+
+		It("counts invalid entries", func() {
+			r := journald.NewReader(setter, spy, logger)
+
+			Expect(r.Read(strings.NewReader("not-json\n" + nginxEntry))).To(Succeed())
+
+			Expect(setter.Envelopes()).To(HaveLen(1))
+			Expect(spy.GetMetric("journald_invalid_entries", nil).Value()).To(Equal(1.0))
+		})
+	})
+
+	Describe("FollowJournal()", func() {
+		It("reads the output of journalctl", func() {
+			dir := GinkgoT().TempDir()
+			journalctl := filepath.Join(dir, "journalctl")
+			script := "#!/bin/sh\necho '" + nginxEntry + "'\n"
+			Expect(os.WriteFile(journalctl, []byte(script), 0755)).To(Succeed())
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			r := journald.NewReader(setter, spy, logger, journald.WithJournalctl(journalctl))
+			go r.FollowJournal(ctx)
+
+			Eventually(setter.Envelopes).Should(ContainElement(HaveField("SourceId", "nginx.service")))
+		})
+
+		It("only reads new entries without a cursor", func() {
+			dir := GinkgoT().TempDir()
+			journalctl := filepath.Join(dir, "journalctl")
+			argsFile := filepath.Join(dir, "args")
+			script := "#!/bin/sh\necho \"$@\" > " + argsFile + "\n"
+			Expect(os.WriteFile(journalctl, []byte(script), 0755)).To(Succeed())
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			r := journald.NewReader(setter, spy, logger, journald.WithJournalctl(journalctl))
+			go r.FollowJournal(ctx)
+
+			Eventually(func() (string, error) {
+				b, err := os.ReadFile(argsFile)
+				return string(b), err
+			}).Should(ContainSubstring("--lines=0"))
+		})
+
+		It("resumes after the persisted cursor and persists the last cursor", func() {
+			dir := GinkgoT().TempDir()
+			journalctl := filepath.Join(dir, "journalctl")
+			argsFile := filepath.Join(dir, "args")
+			cursorFile := filepath.Join(dir, "journald.cursor")
+			Expect(os.WriteFile(cursorFile, []byte("s=1;i=1"), 0600)).To(Succeed())
+			entry := strings.Replace(nginxEntry, "{", `{"__CURSOR":"s=1;i=2",`, 1)
+			script := "#!/bin/sh\necho \"$@\" > " + argsFile + "\necho '" + entry + "'\n"
+			Expect(os.WriteFile(journalctl, []byte(script), 0755)).To(Succeed())
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			r := journald.NewReader(
+				setter,
+				spy,
+				logger,
+				journald.WithJournalctl(journalctl),
+				journald.WithCursorFile(cursorFile),
+			)
+			go r.FollowJournal(ctx)
+
+			Eventually(setter.Envelopes).Should(HaveLen(1))
+			args, err := os.ReadFile(argsFile)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(args)).To(ContainSubstring("--after-cursor=s=1;i=1"))
+			Expect(string(args)).ToNot(ContainSubstring("--lines=0"))
+			Eventually(func() (string, error) {
+				b, err := os.ReadFile(cursorFile)
+				return string(b), err
+			}).Should(Equal("s=1;i=2"))
+		})
+	})
+
+	Describe("ServeSocket()", func() {
+		It("reads entries from connections to the socket", func() {
+			path := filepath.Join(GinkgoT().TempDir(), "journald.sock")
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			r := journald.NewReader(setter, spy, logger)
+			go r.ServeSocket(ctx, path) //nolint:errcheck
+
+			var conn net.Conn
+			Eventually(func() error {
+				var err error
+				conn, err = net.Dial("unix", path)
+				return err
+			}).Should(Succeed())
+			_, err := conn.Write([]byte(nginxEntry + "\n"))
+			Expect(err).ToNot(HaveOccurred())
+			conn.Close()
+
+			Eventually(setter.Envelopes).Should(ConsistOf(HaveField("SourceId", "nginx.service")))
+		})
+
+		It("creates the socket with the permissions of the Reader", func() {
+			path := filepath.Join(GinkgoT().TempDir(), "journald.sock")
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			r := journald.NewReader(setter, spy, logger, journald.WithSocketPermissions(0600))
+			go r.ServeSocket(ctx, path) //nolint:errcheck
+
+			Eventually(path).Should(BeAnExistingFile())
+			info, err := os.Stat(path)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+		})
+	})
+})
+
+type spySetter struct {
+	mu        sync.Mutex
+	envelopes []*loggregator_v2.Envelope
+}
+
+func (s *spySetter) Set(e *loggregator_v2.Envelope) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.envelopes = append(s.envelopes, e)
+}
+
+func (s *spySetter) Envelopes() []*loggregator_v2.Envelope {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*loggregator_v2.Envelope(nil), s.envelopes...)
+}
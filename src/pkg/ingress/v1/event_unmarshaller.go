@@ -2,6 +2,7 @@
 package v1
 
 import (
+	"context"
 	"errors"
 	"log"
 
@@ -10,7 +11,7 @@ import (
 )
 
 type EnvelopeWriter interface {
-	Write(event *events.Envelope)
+	Write(ctx context.Context, event *events.Envelope)
 }
 
 var (
@@ -21,21 +22,38 @@ var (
 // Buffer-encoded dropsonde messages to Envelope instances.
 type EventUnmarshaller struct {
 	outputWriter EnvelopeWriter
+	ctx          context.Context
+	cancel       context.CancelFunc
 }
 
 func NewUnMarshaller(outputWriter EnvelopeWriter) *EventUnmarshaller {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &EventUnmarshaller{
 		outputWriter: outputWriter,
+		ctx:          ctx,
+		cancel:       cancel,
 	}
 }
 
+// Write unmarshals the message and writes it to the output writer. Messages
+// written after Stop are dropped.
 func (u *EventUnmarshaller) Write(message []byte) {
+	if u.ctx.Err() != nil {
+		return
+	}
+
 	envelope, err := u.UnmarshallMessage(message)
 	if err != nil {
 		log.Printf("Error unmarshalling: %s", err)
 		return
 	}
-	u.outputWriter.Write(envelope)
+	u.outputWriter.Write(u.ctx, envelope)
+}
+
+// Stop cancels the context of writes to the output writer, which aborts
+// writes in progress, and drops further messages.
+func (u *EventUnmarshaller) Stop() {
+	u.cancel()
 }
 
 func (u *EventUnmarshaller) UnmarshallMessage(message []byte) (*events.Envelope, error) {
@@ -1,6 +1,8 @@
 package v1_test
 
 import (
+	"context"
+
 	ingress "code.cloudfoundry.org/loggregator-agent-release/src/pkg/ingress/v1"
 	"github.com/cloudfoundry/sonde-go/events"
 	"google.golang.org/protobuf/proto"
@@ -103,6 +105,26 @@ var _ = Describe("EventUnmarshaller", func() {
 			Expect(mockWriter.WriteInput.Event).To(HaveLen(0))
 		})
 	})
+
+	Context("Stop", func() {
+		It("cancels the context of writes in progress", func() {
+			unmarshaller.Write(message)
+
+			var ctx context.Context
+			Expect(mockWriter.WriteInput.Ctx).To(Receive(&ctx))
+			Expect(ctx.Err()).ToNot(HaveOccurred())
+
+			unmarshaller.Stop()
+			Expect(ctx.Err()).To(MatchError(context.Canceled))
+		})
+
+		It("drops messages written after it is stopped", func() {
+			unmarshaller.Stop()
+			unmarshaller.Write(message)
+
+			Expect(mockWriter.WriteCalled).To(BeEmpty())
+		})
+	})
 })
 
 func NewValueMetric(name string, value float64, unit string) *events.ValueMetric {
@@ -6,12 +6,15 @@
 package v1_test
 
 import (
+	"context"
+
 	"github.com/cloudfoundry/sonde-go/events"
 )
 
 type mockEnvelopeWriter struct {
 	WriteCalled chan bool
 	WriteInput  struct {
+		Ctx   chan context.Context
 		Event chan *events.Envelope
 	}
 }
@@ -19,10 +22,12 @@ type mockEnvelopeWriter struct {
 func newMockEnvelopeWriter() *mockEnvelopeWriter {
 	m := &mockEnvelopeWriter{}
 	m.WriteCalled = make(chan bool, 100)
+	m.WriteInput.Ctx = make(chan context.Context, 100)
 	m.WriteInput.Event = make(chan *events.Envelope, 100)
 	return m
 }
-func (m *mockEnvelopeWriter) Write(event *events.Envelope) {
+func (m *mockEnvelopeWriter) Write(ctx context.Context, event *events.Envelope) {
 	m.WriteCalled <- true
+	m.WriteInput.Ctx <- ctx
 	m.WriteInput.Event <- event
 }
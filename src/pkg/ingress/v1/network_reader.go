@@ -1,8 +1,10 @@
 package v1
 
 import (
+	"context"
 	"log"
 	"net"
+	"sync"
 
 	metrics "code.cloudfoundry.org/go-metric-registry"
 
@@ -23,6 +25,12 @@ type NetworkReader struct {
 	writer     ByteArrayWriter
 	rxMsgCount func(uint64)
 	buffer     *diodes.OneToOne
+	ctx        context.Context
+	cancel     context.CancelFunc
+
+	mu        sync.Mutex
+	readDone  chan struct{}
+	writeDone chan struct{}
 }
 
 func NewNetworkReader(
@@ -46,6 +54,7 @@ func NewNetworkReader(
 		metrics.WithMetricLabels(map[string]string{"metric_version": "1.0"}),
 	)
 
+	ctx, cancel := context.WithCancel(context.Background())
 	return &NetworkReader{
 		connection: connection,
 		rxMsgCount: func(i uint64) { rxMsgCount.Add(float64(i)) },
@@ -53,16 +62,24 @@ func NewNetworkReader(
 		buffer: diodes.NewOneToOne(10000, gendiodes.AlertFunc(func(missed int) {
 			log.Printf("network reader dropped messages %d", missed)
 			rxErrCount.Add(float64(missed))
-		})),
+		}), gendiodes.WithWaiterContext(ctx)),
+		ctx:    ctx,
+		cancel: cancel,
 	}, nil
 }
 
+// StartReading reads messages from the UDP connection into the buffer
+// until the connection fails or the reader is stopped.
 func (nr *NetworkReader) StartReading() {
+	defer close(nr.started(&nr.readDone))
+
 	readBuffer := make([]byte, 65535) //buffer with size = max theoretical UDP size
 	for {
 		readCount, _, err := nr.connection.ReadFrom(readBuffer)
 		if err != nil {
-			log.Printf("Error while reading: %s", err)
+			if nr.ctx.Err() == nil {
+				log.Printf("Error while reading: %s", err)
+			}
 			return
 		}
 		readData := make([]byte, readCount)
@@ -72,14 +89,55 @@ func (nr *NetworkReader) StartReading() {
 	}
 }
 
+// StartWriting writes messages from the buffer to the writer until the
+// reader is stopped.
 func (nr *NetworkReader) StartWriting() {
+	defer close(nr.started(&nr.writeDone))
+
 	for {
 		data := nr.buffer.Next()
+		if data == nil {
+			return
+		}
 		nr.rxMsgCount(1)
 		nr.writer.Write(data)
 	}
 }
 
+// Stop closes the UDP connection and stops reading and writing. Messages
+// that are still buffered are dropped.
 func (nr *NetworkReader) Stop() {
+	nr.cancel()
 	nr.connection.Close()
 }
+
+// Shutdown stops the reader and waits until StartReading and StartWriting
+// have returned or ctx is done.
+func (nr *NetworkReader) Shutdown(ctx context.Context) error {
+	nr.Stop()
+
+	nr.mu.Lock()
+	done := []chan struct{}{nr.readDone, nr.writeDone}
+	nr.mu.Unlock()
+
+	for _, d := range done {
+		if d == nil {
+			continue
+		}
+		select {
+		case <-d:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// started records that a loop started and returns the channel to close
+// when it returns.
+func (nr *NetworkReader) started(done *chan struct{}) chan struct{} {
+	nr.mu.Lock()
+	defer nr.mu.Unlock()
+	*done = make(chan struct{})
+	return *done
+}
@@ -1,9 +1,11 @@
 package v1_test
 
 import (
+	"context"
 	"net"
 	"strconv"
 	"sync"
+	"time"
 
 	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
 	ingress "code.cloudfoundry.org/loggregator-agent-release/src/pkg/ingress/v1"
@@ -80,6 +82,39 @@ var _ = Describe("NetworkReader", func() {
 			Expect(metric.Value()).ToNot(BeZero())
 		})
 	})
+
+	Describe("Shutdown", func() {
+		It("waits for reading and writing to stop", func() {
+			readerStopped, writerStopped := make(chan struct{}), make(chan struct{})
+			go func() {
+				reader.StartWriting()
+				close(writerStopped)
+			}()
+			go func() {
+				reader.StartReading()
+				close(readerStopped)
+			}()
+
+			connection, err := net.Dial("udp", address)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(func() int {
+				_, err := connection.Write([]byte("Some Data"))
+				Expect(err).NotTo(HaveOccurred())
+				return len(writer.Data())
+			}).ShouldNot(BeZero())
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			Expect(reader.Shutdown(ctx)).To(Succeed())
+
+			Expect(readerStopped).To(BeClosed())
+			Expect(writerStopped).To(BeClosed())
+		})
+
+		It("returns if it was not started", func() {
+			Expect(reader.Shutdown(context.Background())).To(Succeed())
+		})
+	})
 })
 
 type MockByteArrayWriter struct {
@@ -0,0 +1,146 @@
+package v2
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metrics "code.cloudfoundry.org/go-metric-registry"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	egress_v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
+)
+
+const (
+	// EmitterMetadataKey is the gRPC metadata key emitters can identify
+	// themselves with. Without it the common name of their client
+	// certificate identifies them.
+	EmitterMetadataKey = "loggregator-emitter"
+	// BatchCreatedMetadataKey is the gRPC metadata key of the creation time
+	// of a batch sent with Send in nanoseconds since the Unix epoch.
+	BatchCreatedMetadataKey = "loggregator-batch-created"
+
+	unknownEmitter = "unknown"
+)
+
+// BatchMetadata describes a batch of envelopes received from an emitter.
+type BatchMetadata struct {
+	// Emitter identifies the emitter of the batch.
+	Emitter string
+	// CreatedAt is when the emitter created the batch. Unless the emitter
+	// sends it, it is the newest timestamp of the envelopes of the batch.
+	CreatedAt time.Time
+	// ReceivedAt is when the agent received the batch.
+	ReceivedAt time.Time
+}
+
+// Delay is how long the batch took from its creation to the agent.
+func (m BatchMetadata) Delay() time.Duration {
+	if m.CreatedAt.IsZero() || m.ReceivedAt.Before(m.CreatedAt) {
+		return 0
+	}
+	return m.ReceivedAt.Sub(m.CreatedAt)
+}
+
+// NewBatchMetadata returns the metadata of a batch received at now with
+// the gRPC call or stream of ctx.
+func NewBatchMetadata(ctx context.Context, batch []*loggregator_v2.Envelope, now time.Time) BatchMetadata {
+	md, _ := metadata.FromIncomingContext(ctx)
+	m := BatchMetadata{
+		Emitter:    emitter(ctx, md),
+		ReceivedAt: now,
+	}
+
+	if v := md.Get(BatchCreatedMetadataKey); len(v) > 0 {
+		if ns, err := strconv.ParseInt(v[0], 10, 64); err == nil && ns > 0 {
+			m.CreatedAt = time.Unix(0, ns)
+			return m
+		}
+	}
+	var newest int64
+	for _, e := range batch {
+		newest = max(newest, e.GetTimestamp())
+	}
+	if newest > 0 {
+		m.CreatedAt = time.Unix(0, newest)
+	}
+
+	return m
+}
+
+func emitter(ctx context.Context, md metadata.MD) string {
+	if v := md.Get(EmitterMetadataKey); len(v) > 0 && v[0] != "" {
+		return v[0]
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return unknownEmitter
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.PeerCertificates) == 0 {
+		return unknownEmitter
+	}
+	if cn := tlsInfo.State.PeerCertificates[0].Subject.CommonName; cn != "" {
+		return cn
+	}
+	return unknownEmitter
+}
+
+// batchDelays tags the envelopes of batches with their emitter and reports
+// the delay of the last batch of every emitter. An emitter tag sent by the
+// client is overwritten, since emitters are identified by the agent. The
+// tag is removed again before envelopes are egressed, see
+// egress_v2.EmitterStrippingWriter.
+type batchDelays struct {
+	m MetricClient
+
+	mu     sync.Mutex
+	delays map[string]metrics.Gauge
+}
+
+func newBatchDelays(m MetricClient) *batchDelays {
+	return &batchDelays{
+		m:      m,
+		delays: make(map[string]metrics.Gauge),
+	}
+}
+
+func (d *batchDelays) record(ctx context.Context, batch []*loggregator_v2.Envelope) {
+	m := NewBatchMetadata(ctx, batch, time.Now())
+	for _, e := range batch {
+		if e.Tags == nil {
+			e.Tags = make(map[string]string)
+		}
+		e.Tags[egress_v2.EmitterTag] = m.Emitter
+	}
+
+	d.gauge(m.Emitter).Set(m.Delay().Seconds())
+}
+
+func (d *batchDelays) gauge(emitter string) metrics.Gauge {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if g, ok := d.delays[emitter]; ok {
+		return g
+	}
+	if len(d.delays) >= egress_v2.MaxEmitters {
+		emitter = egress_v2.OtherEmitter
+		if g, ok := d.delays[emitter]; ok {
+			return g
+		}
+	}
+
+	g := d.m.NewGauge(
+		"ingress_batch_delay_seconds",
+		"Time from the creation of the last batch of an emitter until the agent received it.",
+		metrics.WithMetricLabels(map[string]string{"emitter": emitter}),
+	)
+	d.delays[emitter] = g
+	return g
+}
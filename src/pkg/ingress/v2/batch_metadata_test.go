@@ -0,0 +1,119 @@
+package v2_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"strconv"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
+	ingress "code.cloudfoundry.org/loggregator-agent-release/src/pkg/ingress/v2"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("BatchMetadata", func() {
+	now := time.Unix(1000, 0)
+
+	It("reads the emitter and creation time from the gRPC metadata", func() {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+			ingress.EmitterMetadataKey, "diego-cell",
+			ingress.BatchCreatedMetadataKey, strconv.FormatInt(now.Add(-2*time.Second).UnixNano(), 10),
+		))
+
+		m := ingress.NewBatchMetadata(ctx, nil, now)
+
+		Expect(m.Emitter).To(Equal("diego-cell"))
+		Expect(m.ReceivedAt).To(Equal(now))
+		Expect(m.Delay()).To(Equal(2 * time.Second))
+	})
+
+	It("takes the newest envelope timestamp as the creation time", func() {
+		batch := []*loggregator_v2.Envelope{
+			{Timestamp: now.Add(-3 * time.Second).UnixNano()},
+			{Timestamp: now.Add(-time.Second).UnixNano()},
+			{},
+		}
+
+		m := ingress.NewBatchMetadata(context.Background(), batch, now)
+
+		Expect(m.Delay()).To(Equal(time.Second))
+	})
+
+	It("identifies the emitter by the common name of its certificate", func() {
+		ctx := peer.NewContext(context.Background(), &peer.Peer{
+			AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "metron"}}},
+			}},
+		})
+
+		Expect(ingress.NewBatchMetadata(ctx, nil, now).Emitter).To(Equal("metron"))
+	})
+
+	It("reports unknown emitters", func() {
+		m := ingress.NewBatchMetadata(context.Background(), nil, now)
+
+		Expect(m.Emitter).To(Equal("unknown"))
+		Expect(m.Delay()).To(BeZero())
+	})
+
+	Describe("Receiver with batch metadata", func() {
+		var (
+			spySetter *SpySetter
+			spy       *metricsHelpers.SpyMetricsRegistry
+			rx        *ingress.Receiver
+			ctx       context.Context
+		)
+
+		BeforeEach(func() {
+			spySetter = NewSpySetter()
+			spy = metricsHelpers.NewMetricsRegistry()
+			rx = ingress.NewReceiver(spySetter, &metricsHelpers.SpyMetric{}, &metricsHelpers.SpyMetric{}, ingress.WithBatchMetadata(spy))
+			ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+				ingress.EmitterMetadataKey, "diego-cell",
+				ingress.BatchCreatedMetadataKey, strconv.FormatInt(time.Now().Add(-time.Minute).UnixNano(), 10),
+			))
+		})
+
+		It("tags the envelopes of sent batches with their emitter, overwriting the tag of the client", func() {
+			_, err := rx.Send(ctx, &loggregator_v2.EnvelopeBatch{Batch: []*loggregator_v2.Envelope{
+				{SourceId: "some-id"},
+				{SourceId: "some-id", Tags: map[string]string{"emitter": "router"}},
+			}})
+			Expect(err).ToNot(HaveOccurred())
+
+			var e *loggregator_v2.Envelope
+			Expect(spySetter.envelopes).To(Receive(&e))
+			Expect(e.GetTags()).To(HaveKeyWithValue("emitter", "diego-cell"))
+			Expect(spySetter.envelopes).To(Receive(&e))
+			Expect(e.GetTags()).To(HaveKeyWithValue("emitter", "diego-cell"))
+
+			delay := spy.GetMetric("ingress_batch_delay_seconds", map[string]string{"emitter": "diego-cell"})
+			Expect(delay.Value()).To(BeNumerically("~", 60, 5))
+		})
+
+		It("reads the metadata of batch streams", func() {
+			sender := NewSpyBatchSender()
+			sender.ctx = ctx
+			sender.recvResponses <- BatchSenderRecvResponse{
+				envelopes: []*loggregator_v2.Envelope{{SourceId: "some-id"}},
+			}
+			sender.recvResponses <- BatchSenderRecvResponse{err: io.EOF}
+
+			Expect(rx.BatchSender(sender)).To(Equal(io.EOF))
+
+			var e *loggregator_v2.Envelope
+			Expect(spySetter.envelopes).To(Receive(&e))
+			Expect(e.GetTags()).To(HaveKeyWithValue("emitter", "diego-cell"))
+			Expect(spy.HasMetric("ingress_batch_delay_seconds", map[string]string{"emitter": "diego-cell"})).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,65 @@
+package v2
+
+import (
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metrics "code.cloudfoundry.org/go-metric-registry"
+	"google.golang.org/protobuf/proto"
+
+	egress_v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
+)
+
+// sizeBuckets are the upper bounds in bytes of the buckets of the size
+// histograms, from 64 B to 1 MiB.
+var sizeBuckets = []float64{64, 256, 1024, 4096, 16384, 65536, 262144, 1048576}
+
+// HistogramClient creates histograms.
+type HistogramClient interface {
+	NewHistogram(name, helpText string, buckets []float64, opts ...metrics.MetricOption) metrics.Histogram
+}
+
+// WithEnvelopeSizes reports the sizes of the received envelopes by
+// envelope type and the sizes of the payloads of their logs, e.g. to
+// notice apps that emit very long lines before drains fail on them.
+func WithEnvelopeSizes(m HistogramClient) ReceiverOption {
+	return func(r *Receiver) {
+		r.envelopeSizes = newEnvelopeSizes(m)
+	}
+}
+
+// envelopeSizes records the sizes of envelopes in histograms.
+type envelopeSizes struct {
+	envelopes   map[string]metrics.Histogram
+	logPayloads metrics.Histogram
+}
+
+func newEnvelopeSizes(m HistogramClient) *envelopeSizes {
+	s := &envelopeSizes{
+		envelopes: make(map[string]metrics.Histogram, len(egress_v2.EnvelopeTypes)),
+		logPayloads: m.NewHistogram(
+			"ingress_log_payload_size_bytes",
+			"Size of the payloads of the received logs.",
+			sizeBuckets,
+		),
+	}
+	for _, t := range egress_v2.EnvelopeTypes {
+		s.envelopes[t] = m.NewHistogram(
+			"ingress_envelope_size_bytes",
+			"Size of the received envelopes by envelope type.",
+			sizeBuckets,
+			metrics.WithMetricLabels(map[string]string{"envelope_type": t}),
+		)
+	}
+	return s
+}
+
+func (s *envelopeSizes) record(e *loggregator_v2.Envelope) {
+	if s == nil {
+		return
+	}
+	if h, ok := s.envelopes[egress_v2.EnvelopeType(e)]; ok {
+		h.Observe(float64(proto.Size(e)))
+	}
+	if l := e.GetLog(); l != nil {
+		s.logPayloads.Observe(float64(len(l.GetPayload())))
+	}
+}
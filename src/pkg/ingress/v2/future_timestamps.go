@@ -0,0 +1,87 @@
+package v2
+
+import (
+	"fmt"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metrics "code.cloudfoundry.org/go-metric-registry"
+)
+
+// FutureTimestampAction is what a Receiver does with envelopes that are
+// timestamped too far in the future.
+type FutureTimestampAction string
+
+const (
+	// FutureTimestampPass forwards the envelopes as they are.
+	FutureTimestampPass FutureTimestampAction = "pass"
+	// FutureTimestampClamp sets the timestamp of the envelopes to the time
+	// they are received.
+	FutureTimestampClamp FutureTimestampAction = "clamp"
+	// FutureTimestampReject drops the envelopes.
+	FutureTimestampReject FutureTimestampAction = "reject"
+)
+
+// UnmarshalEnv implements envstruct.Unmarshaller.
+// Example input: clamp
+func (a *FutureTimestampAction) UnmarshalEnv(v string) error {
+	if v == "" {
+		return nil
+	}
+
+	switch action := FutureTimestampAction(v); action {
+	case FutureTimestampPass, FutureTimestampClamp, FutureTimestampReject:
+		*a = action
+		return nil
+	default:
+		return fmt.Errorf("unknown future timestamp action %q", v)
+	}
+}
+
+// WithFutureTimestamps applies the action to envelopes timestamped more
+// than tolerance after they are received, since future timestamps break the
+// retention of downstream stores. The envelopes are counted in
+// future_timestamp_envelopes by action.
+func WithFutureTimestamps(tolerance time.Duration, action FutureTimestampAction, m MetricClient) ReceiverOption {
+	return func(r *Receiver) {
+		r.futureTimestamps = &futureTimestamps{
+			tolerance: tolerance,
+			action:    action,
+			counter: m.NewCounter(
+				"future_timestamp_envelopes",
+				"Total number of envelopes received with a timestamp too far in the future by action.",
+				metrics.WithMetricLabels(map[string]string{"action": string(action)}),
+			),
+			now: time.Now,
+		}
+	}
+}
+
+type futureTimestamps struct {
+	tolerance time.Duration
+	action    FutureTimestampAction
+	counter   metrics.Counter
+	now       func() time.Time
+}
+
+// accept applies the action to the envelope if its timestamp is too far in
+// the future and reports whether it is kept.
+func (f *futureTimestamps) accept(e *loggregator_v2.Envelope) bool {
+	if f == nil {
+		return true
+	}
+
+	now := f.now().UnixNano()
+	if e.GetTimestamp() <= now+f.tolerance.Nanoseconds() {
+		return true
+	}
+
+	f.counter.Add(1)
+	switch f.action {
+	case FutureTimestampReject:
+		return false
+	case FutureTimestampClamp:
+		e.Timestamp = now
+	}
+	return true
+}
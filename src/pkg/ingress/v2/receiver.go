@@ -13,9 +13,10 @@ type DataSetter interface {
 	Set(e *loggregator_v2.Envelope)
 }
 
-// MetricClient creates new CounterMetrics to be emitted periodically.
+// MetricClient creates new metrics to be emitted periodically.
 type MetricClient interface {
 	NewCounter(name, helpText string, opts ...metrics.MetricOption) metrics.Counter
+	NewGauge(name, helpText string, opts ...metrics.MetricOption) metrics.Gauge
 }
 
 type Receiver struct {
@@ -24,14 +25,34 @@ type Receiver struct {
 	dataSetter           DataSetter
 	ingressMetric        func(uint64)
 	originMappingsMetric func(uint64)
+	batchDelays          *batchDelays
+	envelopeSizes        *envelopeSizes
+	futureTimestamps     *futureTimestamps
 }
 
-func NewReceiver(setter DataSetter, ingress metrics.Counter, egress metrics.Counter) *Receiver {
-	return &Receiver{
+// ReceiverOption configures a Receiver.
+type ReceiverOption func(*Receiver)
+
+// WithBatchMetadata tags the envelopes of batches received with
+// BatchSender and Send with the EmitterTag of their emitter and reports
+// the delay of the batches of every emitter from their creation to the
+// agent. See BatchMetadata.
+func WithBatchMetadata(m MetricClient) ReceiverOption {
+	return func(r *Receiver) {
+		r.batchDelays = newBatchDelays(m)
+	}
+}
+
+func NewReceiver(setter DataSetter, ingress metrics.Counter, egress metrics.Counter, opts ...ReceiverOption) *Receiver {
+	r := &Receiver{
 		dataSetter:           setter,
 		ingressMetric:        func(i uint64) { ingress.Add(float64(i)) },
 		originMappingsMetric: func(i uint64) { egress.Add(float64(i)) },
 	}
+	for _, o := range opts {
+		o(r)
+	}
+	return r
 }
 
 func (s *Receiver) Sender(sender loggregator_v2.Ingress_SenderServer) error {
@@ -41,8 +62,7 @@ func (s *Receiver) Sender(sender loggregator_v2.Ingress_SenderServer) error {
 			log.Printf("Failed to receive data: %s", err)
 			return err
 		}
-		e.SourceId = s.sourceID(e)
-		s.dataSetter.Set(e)
+		s.set(e)
 		s.ingressMetric(1)
 	}
 }
@@ -55,18 +75,22 @@ func (s *Receiver) BatchSender(sender loggregator_v2.Ingress_BatchSenderServer)
 			return err
 		}
 
+		if s.batchDelays != nil {
+			s.batchDelays.record(sender.Context(), envelopes.Batch)
+		}
 		for _, e := range envelopes.Batch {
-			e.SourceId = s.sourceID(e)
-			s.dataSetter.Set(e)
+			s.set(e)
 		}
 		s.ingressMetric(uint64(len(envelopes.Batch)))
 	}
 }
 
-func (s *Receiver) Send(_ context.Context, b *loggregator_v2.EnvelopeBatch) (*loggregator_v2.SendResponse, error) {
+func (s *Receiver) Send(ctx context.Context, b *loggregator_v2.EnvelopeBatch) (*loggregator_v2.SendResponse, error) {
+	if s.batchDelays != nil {
+		s.batchDelays.record(ctx, b.Batch)
+	}
 	for _, e := range b.Batch {
-		e.SourceId = s.sourceID(e)
-		s.dataSetter.Set(e)
+		s.set(e)
 	}
 
 	s.ingressMetric(uint64(len(b.Batch)))
@@ -74,6 +98,17 @@ func (s *Receiver) Send(_ context.Context, b *loggregator_v2.EnvelopeBatch) (*lo
 	return &loggregator_v2.SendResponse{}, nil
 }
 
+// set passes a received envelope on to the data setter unless it is
+// rejected.
+func (s *Receiver) set(e *loggregator_v2.Envelope) {
+	s.envelopeSizes.record(e)
+	if !s.futureTimestamps.accept(e) {
+		return
+	}
+	e.SourceId = s.sourceID(e)
+	s.dataSetter.Set(e)
+}
+
 func (r *Receiver) sourceID(e *loggregator_v2.Envelope) string {
 	if e.SourceId != "" {
 		return e.SourceId
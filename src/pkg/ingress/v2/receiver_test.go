@@ -4,10 +4,12 @@ import (
 	"context"
 	"errors"
 	"io"
+	"time"
 
 	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
 	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
 	ingress "code.cloudfoundry.org/loggregator-agent-release/src/pkg/ingress/v2"
+	"google.golang.org/protobuf/proto"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -373,6 +375,102 @@ var _ = Describe("Receiver", func() {
 			Expect(ingressMetric.Value()).To(BeNumerically("==", 1))
 		})
 
+		It("records the sizes of the envelopes by envelope type", func() {
+			sm := metricsHelpers.NewMetricsRegistry()
+			rx = ingress.NewReceiver(spySetter, &metricsHelpers.SpyMetric{}, &metricsHelpers.SpyMetric{}, ingress.WithEnvelopeSizes(sm))
+
+			log1 := &loggregator_v2.Envelope{
+				SourceId: "some-id",
+				Message:  &loggregator_v2.Envelope_Log{Log: &loggregator_v2.Log{Payload: make([]byte, 100)}},
+			}
+			log2 := &loggregator_v2.Envelope{
+				SourceId: "some-id",
+				Message:  &loggregator_v2.Envelope_Log{Log: &loggregator_v2.Log{Payload: make([]byte, 200)}},
+			}
+			counter := &loggregator_v2.Envelope{
+				SourceId: "some-id",
+				Message:  &loggregator_v2.Envelope_Counter{Counter: &loggregator_v2.Counter{Name: "some-counter"}},
+			}
+			logSizes := float64(proto.Size(log1) + proto.Size(log2))
+			counterSize := float64(proto.Size(counter))
+
+			_, err := rx.Send(context.Background(), &loggregator_v2.EnvelopeBatch{
+				Batch: []*loggregator_v2.Envelope{log1, log2, counter},
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			envelopeSizes := sm.GetMetric("ingress_envelope_size_bytes", map[string]string{"envelope_type": "log"})
+			Expect(envelopeSizes.Value()).To(Equal(logSizes))
+			Expect(envelopeSizes.Buckets()).ToNot(BeEmpty())
+			Expect(sm.GetMetric("ingress_envelope_size_bytes", map[string]string{"envelope_type": "counter"}).Value()).To(Equal(counterSize))
+			Expect(sm.GetMetric("ingress_envelope_size_bytes", map[string]string{"envelope_type": "gauge"}).Value()).To(BeZero())
+			Expect(sm.GetMetric("ingress_log_payload_size_bytes", nil).Value()).To(Equal(300.0))
+		})
+
+		Context("when future timestamps are handled", func() {
+			var (
+				sm      *metricsHelpers.SpyMetricsRegistry
+				present *loggregator_v2.Envelope
+				future  *loggregator_v2.Envelope
+			)
+
+			BeforeEach(func() {
+				sm = metricsHelpers.NewMetricsRegistry()
+				present = &loggregator_v2.Envelope{SourceId: "present", Timestamp: time.Now().UnixNano()}
+				future = &loggregator_v2.Envelope{SourceId: "future", Timestamp: time.Now().Add(time.Hour).UnixNano()}
+			})
+
+			send := func(action ingress.FutureTimestampAction) {
+				rx = ingress.NewReceiver(
+					spySetter,
+					&metricsHelpers.SpyMetric{},
+					&metricsHelpers.SpyMetric{},
+					ingress.WithFutureTimestamps(time.Minute, action, sm),
+				)
+				_, err := rx.Send(context.Background(), &loggregator_v2.EnvelopeBatch{
+					Batch: []*loggregator_v2.Envelope{present, future},
+				})
+				Expect(err).ToNot(HaveOccurred())
+			}
+
+			It("rejects envelopes too far in the future", func() {
+				send(ingress.FutureTimestampReject)
+
+				Expect(spySetter.envelopes).To(Receive(Equal(present)))
+				Expect(spySetter.envelopes).ToNot(Receive())
+				Expect(sm.GetMetric("future_timestamp_envelopes", map[string]string{"action": "reject"}).Value()).To(Equal(1.0))
+			})
+
+			It("clamps the timestamps of envelopes too far in the future", func() {
+				send(ingress.FutureTimestampClamp)
+
+				Expect(spySetter.envelopes).To(Receive(Equal(present)))
+				var e *loggregator_v2.Envelope
+				Expect(spySetter.envelopes).To(Receive(&e))
+				Expect(e.GetSourceId()).To(Equal("future"))
+				Expect(time.Unix(0, e.GetTimestamp())).To(BeTemporally("~", time.Now(), time.Second))
+				Expect(sm.GetMetric("future_timestamp_envelopes", map[string]string{"action": "clamp"}).Value()).To(Equal(1.0))
+			})
+
+			It("passes envelopes too far in the future", func() {
+				timestamp := future.Timestamp
+				send(ingress.FutureTimestampPass)
+
+				Expect(spySetter.envelopes).To(Receive(Equal(present)))
+				var e *loggregator_v2.Envelope
+				Expect(spySetter.envelopes).To(Receive(&e))
+				Expect(e.GetTimestamp()).To(Equal(timestamp))
+				Expect(sm.GetMetric("future_timestamp_envelopes", map[string]string{"action": "pass"}).Value()).To(Equal(1.0))
+			})
+
+			It("rejects unknown actions", func() {
+				var action ingress.FutureTimestampAction
+				Expect(action.UnmarshalEnv("clamp")).To(Succeed())
+				Expect(action).To(Equal(ingress.FutureTimestampClamp))
+				Expect(action.UnmarshalEnv("drop")).To(MatchError(`unknown future timestamp action "drop"`))
+			})
+		})
+
 		It("increments the origin_mappings metric", func() {
 			originMappingMetric := &metricsHelpers.SpyMetric{}
 			rx = ingress.NewReceiver(spySetter, &metricsHelpers.SpyMetric{}, originMappingMetric)
@@ -495,6 +593,7 @@ func (s *SpySender) Recv() (*loggregator_v2.Envelope, error) {
 type SpyBatchSender struct {
 	loggregator_v2.Ingress_BatchSenderServer
 	recvResponses chan BatchSenderRecvResponse
+	ctx           context.Context
 }
 
 func NewSpyBatchSender() *SpyBatchSender {
@@ -503,6 +602,13 @@ func NewSpyBatchSender() *SpyBatchSender {
 	}
 }
 
+func (s *SpyBatchSender) Context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
 func (s *SpyBatchSender) Recv() (*loggregator_v2.EnvelopeBatch, error) {
 	resp := <-s.recvResponses
 
@@ -3,31 +3,84 @@ package v2
 import (
 	"log"
 	"net"
+	"os"
 
 	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/plumbing"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
 )
 
 type Server struct {
+	network string
 	addr    string
+	mode    os.FileMode
+	sddl    string
 	lis     net.Listener
 	grpcSrv *grpc.Server
 	rx      *Receiver
 	opts    []grpc.ServerOption
+
+	healthAndReflection bool
+	health              *health.Server
 }
 
 func NewServer(addr string, rx *Receiver, opts ...grpc.ServerOption) *Server {
 	return &Server{
-		addr: addr,
-		rx:   rx,
-		opts: opts,
+		network: "tcp",
+		addr:    addr,
+		rx:      rx,
+		opts:    opts,
+	}
+}
+
+// NewUnixServer returns a Server that listens on a Unix domain socket at
+// path. Any existing file at path is replaced and clients can only connect
+// once the socket has the provided permissions.
+func NewUnixServer(path string, mode os.FileMode, rx *Receiver, opts ...grpc.ServerOption) *Server {
+	return &Server{
+		network: "unix",
+		addr:    path,
+		mode:    mode,
+		rx:      rx,
+		opts:    opts,
 	}
 }
 
+// NewPipeServer returns a Server that listens on the Windows named pipe
+// with the given name. The pipe is created with the security descriptor in
+// SDDL form, or with the default one of the process when sddl is empty.
+func NewPipeServer(name, sddl string, rx *Receiver, opts ...grpc.ServerOption) *Server {
+	return &Server{
+		network: "pipe",
+		addr:    name,
+		sddl:    sddl,
+		rx:      rx,
+		opts:    opts,
+	}
+}
+
+// EnableHealthAndReflection registers the gRPC health checking and
+// reflection services when the server is started so that orchestrators and
+// tools such as grpcurl can probe the server. It must be called before
+// Start.
+func (s *Server) EnableHealthAndReflection() {
+	s.healthAndReflection = true
+}
+
 func (s *Server) Start() {
 	var err error
-	s.lis, err = net.Listen("tcp", s.addr)
+	switch s.network {
+	case "unix":
+		s.lis, err = plumbing.ListenUnix(s.addr, s.mode)
+	case "pipe":
+		s.lis, err = plumbing.ListenPipe(s.addr, s.sddl)
+	default:
+		s.lis, err = net.Listen(s.network, s.addr)
+	}
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
@@ -36,12 +89,21 @@ func (s *Server) Start() {
 	s.grpcSrv = grpc.NewServer(s.opts...)
 	loggregator_v2.RegisterIngressServer(s.grpcSrv, s.rx)
 
+	if s.healthAndReflection {
+		s.health = health.NewServer()
+		healthpb.RegisterHealthServer(s.grpcSrv, s.health)
+		reflection.Register(s.grpcSrv)
+	}
+
 	if err := s.grpcSrv.Serve(s.lis); err != nil {
 		log.Fatalf("failed to serve: %v", err)
 	}
 }
 
 func (s *Server) Stop() {
+	if s.health != nil {
+		s.health.Shutdown()
+	}
 	s.grpcSrv.Stop()
 	s.lis.Close()
 }
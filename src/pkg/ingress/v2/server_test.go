@@ -0,0 +1,85 @@
+package v2_test
+
+import (
+	"context"
+	"path/filepath"
+
+	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
+	ingress "code.cloudfoundry.org/loggregator-agent-release/src/pkg/ingress/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Server", func() {
+	var (
+		socketPath string
+		srv        *ingress.Server
+		conn       *grpc.ClientConn
+	)
+
+	BeforeEach(func() {
+		socketPath = filepath.Join(GinkgoT().TempDir(), "agent.sock")
+		rx := ingress.NewReceiver(NewSpySetter(), &metricsHelpers.SpyMetric{}, &metricsHelpers.SpyMetric{})
+		srv = ingress.NewUnixServer(socketPath, 0600, rx)
+
+		var err error
+		conn, err = grpc.NewClient(
+			"unix://"+socketPath,
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	JustBeforeEach(func() {
+		go srv.Start()
+		conn.Connect()
+		Eventually(conn.GetState).Should(Equal(connectivity.Ready))
+	})
+
+	AfterEach(func() {
+		conn.Close()
+		srv.Stop()
+	})
+
+	It("does not register the health service by default", func() {
+		_, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+		Expect(status.Code(err)).To(Equal(codes.Unimplemented))
+	})
+
+	Context("when health and reflection are enabled", func() {
+		BeforeEach(func() {
+			srv.EnableHealthAndReflection()
+		})
+
+		It("reports that it is serving", func() {
+			resp, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.GetStatus()).To(Equal(healthpb.HealthCheckResponse_SERVING))
+		})
+
+		It("lists the ingress service through reflection", func() {
+			stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(stream.Send(&reflectionpb.ServerReflectionRequest{
+				MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+			})).To(Succeed())
+			resp, err := stream.Recv()
+			Expect(err).ToNot(HaveOccurred())
+
+			var names []string
+			for _, s := range resp.GetListServicesResponse().GetService() {
+				names = append(names, s.GetName())
+			}
+			Expect(names).To(ContainElements("loggregator.v2.Ingress", "grpc.health.v1.Health"))
+		})
+	})
+})
@@ -44,8 +44,10 @@ type GRPCWriter struct {
 }
 
 // NewGRPCWriter dials the provided gRPC address and returns a *GRPCWriter.
-func NewGRPCWriter(addr string, tlsConfig *tls.Config, l *log.Logger) (*GRPCWriter, error) {
-	cc, err := grpc.NewClient(addr, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+// The dial options are added to the transport credentials of tlsConfig.
+func NewGRPCWriter(addr string, tlsConfig *tls.Config, l *log.Logger, opts ...grpc.DialOption) (*GRPCWriter, error) {
+	opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	cc, err := grpc.NewClient(addr, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -129,8 +131,9 @@ func New(w Writer, emitTraces bool, emitMetrics bool, emitLogs bool) *Client {
 }
 
 // Write translates an envelope to OTLP and forwards it to the connected OTel
-// Collector.
-func (c *Client) Write(e *loggregator_v2.Envelope) error {
+// Collector. Envelopes are sent in batches in the background so ctx is not
+// used.
+func (c *Client) Write(_ context.Context, e *loggregator_v2.Envelope) error {
 	switch e.Message.(type) {
 	case *loggregator_v2.Envelope_Counter:
 		c.writeCounter(e)
@@ -79,7 +79,7 @@ var _ = Describe("Client", func() {
 		)
 
 		JustBeforeEach(func() {
-			returnedErr = c.Write(envelope)
+			returnedErr = c.Write(context.Background(), envelope)
 		})
 
 		Context("when given a gauge", func() {
@@ -1070,7 +1070,7 @@ var _ = Describe("Client", func() {
 					},
 				},
 			}
-			Expect(c.Write(envelope)).ToNot(HaveOccurred())
+			Expect(c.Write(context.Background(), envelope)).ToNot(HaveOccurred())
 			Expect(c.Close()).ToNot(HaveOccurred())
 			Eventually(spyMSC.ctx.Done()).Should(BeClosed())
 		})
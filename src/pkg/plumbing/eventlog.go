@@ -0,0 +1,20 @@
+package plumbing
+
+import (
+	"io"
+	"log"
+)
+
+// AddEventLogOutput additionally writes the output of the logger and of
+// the standard logger to the Windows Event Log under the event source.
+func AddEventLogOutput(logger *log.Logger, source string) error {
+	w, err := NewEventLogWriter(source)
+	if err != nil {
+		return err
+	}
+	logger.SetOutput(io.MultiWriter(logger.Writer(), w))
+	if log.Default() != logger {
+		log.SetOutput(io.MultiWriter(log.Writer(), w))
+	}
+	return nil
+}
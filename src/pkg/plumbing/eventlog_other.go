@@ -0,0 +1,25 @@
+//go:build !windows
+
+package plumbing
+
+import "errors"
+
+// EventLogWriter writes every log line as an information event to the
+// Windows Event Log. It is only supported on Windows.
+type EventLogWriter struct{}
+
+// NewEventLogWriter returns an error because the Windows Event Log is not
+// available on this platform.
+func NewEventLogWriter(string) (*EventLogWriter, error) {
+	return nil, errors.New("the event log is only supported on windows")
+}
+
+// Write discards the log line.
+func (*EventLogWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+// Close does nothing.
+func (*EventLogWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,51 @@
+//go:build windows
+
+package plumbing
+
+import (
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+// eventID is the ID of all events written by an EventLogWriter.
+const eventID = 1
+
+// EventLogWriter writes every log line as an information event to the
+// Windows Event Log.
+type EventLogWriter struct {
+	handle windows.Handle
+}
+
+// NewEventLogWriter returns an EventLogWriter for the event source. The
+// source should be registered, e.g. with New-EventLog, so that the Event
+// Viewer shows the events without a warning about a missing description.
+func NewEventLogWriter(source string) (*EventLogWriter, error) {
+	name, err := windows.UTF16PtrFromString(source)
+	if err != nil {
+		return nil, err
+	}
+	h, err := windows.RegisterEventSource(nil, name)
+	if err != nil {
+		return nil, err
+	}
+	return &EventLogWriter{handle: h}, nil
+}
+
+// Write writes the log line as an event.
+func (w *EventLogWriter) Write(b []byte) (int, error) {
+	msg, err := windows.UTF16PtrFromString(strings.TrimRight(string(b), "\n"))
+	if err != nil {
+		return 0, err
+	}
+	err = windows.ReportEvent(w.handle, windows.EVENTLOG_INFORMATION_TYPE, 0, eventID, 0, 1, 0, &msg, nil)
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Close deregisters the event source.
+func (w *EventLogWriter) Close() error {
+	return windows.DeregisterEventSource(w.handle)
+}
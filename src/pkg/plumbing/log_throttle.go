@@ -0,0 +1,117 @@
+package plumbing
+
+import (
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxThrottledMessages is the number of distinct messages a ThrottledWriter
+// tracks per interval. Further distinct messages are written unthrottled.
+const maxThrottledMessages = 1000
+
+// ThrottledWriter coalesces repeated identical log lines, e.g. a write
+// failure that is logged for every envelope during an outage. The first
+// occurrence of a line in an interval is written and its repeats are
+// counted. At the end of the interval a summary with the number of
+// repeats is written for every line that was repeated.
+//
+// Lines are compared without the date and time the logger prepends, so the
+// writer must know the prefix and flags of its logger.
+type ThrottledWriter struct {
+	out       io.Writer
+	summary   *log.Logger
+	headerLen int
+	interval  time.Duration
+
+	mu      sync.Mutex
+	open    bool
+	repeats map[string]int
+	order   []string
+}
+
+// NewThrottledWriter returns a ThrottledWriter that writes to out for a
+// logger with the prefix and flags.
+func NewThrottledWriter(out io.Writer, prefix string, flags int, interval time.Duration) *ThrottledWriter {
+	return &ThrottledWriter{
+		out:       out,
+		summary:   log.New(out, prefix, flags),
+		headerLen: headerLen(prefix, flags),
+		interval:  interval,
+		repeats:   make(map[string]int),
+	}
+}
+
+// ThrottleLogOutput coalesces repeated identical lines written by the
+// logger and the standard logger. See ThrottledWriter.
+func ThrottleLogOutput(logger *log.Logger, interval time.Duration) {
+	logger.SetOutput(NewThrottledWriter(logger.Writer(), logger.Prefix(), logger.Flags(), interval))
+	if log.Default() != logger {
+		log.SetOutput(NewThrottledWriter(log.Writer(), log.Prefix(), log.Flags(), interval))
+	}
+}
+
+// Write writes the log line unless it was already written in the current
+// interval.
+func (w *ThrottledWriter) Write(b []byte) (int, error) {
+	msg := string(b)
+	if len(msg) > w.headerLen {
+		msg = msg[w.headerLen:]
+	}
+
+	w.mu.Lock()
+	if !w.open {
+		w.open = true
+		time.AfterFunc(w.interval, w.flush)
+	}
+	if n, ok := w.repeats[msg]; ok {
+		w.repeats[msg] = n + 1
+		w.mu.Unlock()
+		return len(b), nil
+	}
+	if len(w.repeats) < maxThrottledMessages {
+		w.repeats[msg] = 0
+		w.order = append(w.order, msg)
+	}
+	w.mu.Unlock()
+
+	return w.out.Write(b)
+}
+
+// flush writes the summaries of the repeated lines and starts a new
+// interval.
+func (w *ThrottledWriter) flush() {
+	w.mu.Lock()
+	repeats, order := w.repeats, w.order
+	w.repeats = make(map[string]int)
+	w.order = nil
+	w.open = false
+	w.mu.Unlock()
+
+	for _, msg := range order {
+		if n := repeats[msg]; n > 0 {
+			w.summary.Printf("%s (repeated %d more times in the last %s)", strings.TrimSuffix(msg, "\n"), n, w.interval)
+		}
+	}
+}
+
+// headerLen returns the length of the prefix, date and time a logger with
+// the prefix and flags prepends to each line.
+func headerLen(prefix string, flags int) int {
+	var n int
+	if flags&log.Lmsgprefix == 0 {
+		n += len(prefix)
+	}
+	if flags&log.Ldate != 0 {
+		n += len("2006/01/02 ")
+	}
+	if flags&(log.Ltime|log.Lmicroseconds) != 0 {
+		n += len("15:04:05 ")
+		if flags&log.Lmicroseconds != 0 {
+			n += len(".000000")
+		}
+	}
+	return n
+}
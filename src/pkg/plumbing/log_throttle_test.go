@@ -0,0 +1,88 @@
+package plumbing_test
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/plumbing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ThrottledWriter", func() {
+	var (
+		buf    *syncBuffer
+		logger *log.Logger
+	)
+
+	BeforeEach(func() {
+		buf = &syncBuffer{}
+		logger = log.New(buf, "[agent] ", log.LstdFlags|log.Lmicroseconds)
+		logger.SetOutput(plumbing.NewThrottledWriter(buf, logger.Prefix(), logger.Flags(), 100*time.Millisecond))
+	})
+
+	lines := func() []string {
+		return strings.Split(strings.TrimSpace(buf.String()), "\n")
+	}
+
+	It("writes distinct lines", func() {
+		logger.Println("failed to write envelope: some-error")
+		logger.Println("failed to write envelope: other-error")
+
+		Expect(lines()).To(HaveExactElements(
+			HaveSuffix("failed to write envelope: some-error"),
+			HaveSuffix("failed to write envelope: other-error"),
+		))
+	})
+
+	It("coalesces repeated lines into a summary", func() {
+		for i := 0; i < 5; i++ {
+			logger.Println("failed to write envelope: some-error")
+			time.Sleep(time.Millisecond)
+		}
+		Expect(lines()).To(HaveLen(1))
+
+		Eventually(lines).Should(HaveExactElements(
+			And(HavePrefix("[agent] "), HaveSuffix("failed to write envelope: some-error")),
+			And(HavePrefix("[agent] "), HaveSuffix("failed to write envelope: some-error (repeated 4 more times in the last 100ms)")),
+		))
+	})
+
+	It("writes the line again in the next interval", func() {
+		logger.Println("failed to write envelope: some-error")
+		time.Sleep(200 * time.Millisecond)
+		logger.Println("failed to write envelope: some-error")
+
+		Expect(lines()).To(HaveExactElements(
+			HaveSuffix("failed to write envelope: some-error"),
+			HaveSuffix("failed to write envelope: some-error"),
+		))
+	})
+
+	It("does not write a summary for lines that were not repeated", func() {
+		logger.Println("some message")
+
+		Consistently(lines, 200*time.Millisecond).Should(HaveLen(1))
+	})
+})
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,33 @@
+package plumbing
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// pipePrefix is the prefix of the names of local named pipes.
+const pipePrefix = `\\.\pipe\`
+
+// ListenPipe listens on the Windows named pipe with the given name, e.g.
+// \\.\pipe\loggregator-agent. The pipe is created with the security
+// descriptor in SDDL form, or with the default one of the process when sddl
+// is empty. Remote clients are rejected. Named pipes are only supported on
+// Windows.
+func ListenPipe(name, sddl string) (net.Listener, error) {
+	if !strings.HasPrefix(strings.ToLower(name), pipePrefix) {
+		return nil, fmt.Errorf("invalid named pipe %q: the name must start with %s", name, pipePrefix)
+	}
+	return listenPipe(name, sddl)
+}
+
+// pipeAddr is the address of a named pipe.
+type pipeAddr string
+
+func (pipeAddr) Network() string {
+	return "pipe"
+}
+
+func (a pipeAddr) String() string {
+	return string(a)
+}
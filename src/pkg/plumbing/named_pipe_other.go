@@ -0,0 +1,12 @@
+//go:build !windows
+
+package plumbing
+
+import (
+	"errors"
+	"net"
+)
+
+func listenPipe(string, string) (net.Listener, error) {
+	return nil, errors.New("named pipes are only supported on windows")
+}
@@ -0,0 +1,25 @@
+package plumbing_test
+
+import (
+	"runtime"
+
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/plumbing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ListenPipe", func() {
+	It("rejects names outside of the pipe namespace", func() {
+		_, err := plumbing.ListenPipe(`C:\agent`, "")
+		Expect(err).To(MatchError(ContainSubstring(`must start with \\.\pipe\`)))
+	})
+
+	It("is only supported on windows", func() {
+		if runtime.GOOS == "windows" {
+			Skip("named pipes are supported on windows")
+		}
+		_, err := plumbing.ListenPipe(`\\.\pipe\loggregator-agent-test`, "")
+		Expect(err).To(MatchError("named pipes are only supported on windows"))
+	})
+})
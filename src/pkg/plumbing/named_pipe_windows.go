@@ -0,0 +1,362 @@
+//go:build windows
+
+package plumbing
+
+import (
+	"errors"
+	"io"
+	"math"
+	"net"
+	"os"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// pipeBufferSize is the size of the input and output buffers of every pipe
+// instance.
+const pipeBufferSize = 64 << 10
+
+func listenPipe(name, sddl string) (net.Listener, error) {
+	l := &pipeListener{name: name}
+	if sddl != "" {
+		sd, err := windows.SecurityDescriptorFromString(sddl)
+		if err != nil {
+			return nil, err
+		}
+		l.sa = &windows.SecurityAttributes{
+			Length:             uint32(unsafe.Sizeof(windows.SecurityAttributes{})),
+			SecurityDescriptor: sd,
+		}
+	}
+
+	var err error
+	if l.closed, err = windows.CreateEvent(nil, 1, 0, nil); err != nil {
+		return nil, err
+	}
+	if l.connected, err = windows.CreateEvent(nil, 1, 0, nil); err != nil {
+		windows.CloseHandle(l.closed)
+		return nil, err
+	}
+	// The first instance fails if another process already owns the pipe.
+	if l.next, err = l.newInstance(windows.FILE_FLAG_FIRST_PIPE_INSTANCE); err != nil {
+		windows.CloseHandle(l.connected)
+		windows.CloseHandle(l.closed)
+		return nil, err
+	}
+	return l, nil
+}
+
+// pipeListener accepts connections on a named pipe. One pipe instance
+// always waits for the next client, a new instance is created whenever a
+// client connected to it.
+type pipeListener struct {
+	name string
+	sa   *windows.SecurityAttributes
+
+	// acceptMu serializes Accept and guards connected.
+	acceptMu  sync.Mutex
+	connected windows.Handle
+
+	mu       sync.Mutex
+	next     windows.Handle
+	isClosed bool
+	closed   windows.Handle
+}
+
+func (l *pipeListener) newInstance(flags uint32) (windows.Handle, error) {
+	name, err := windows.UTF16PtrFromString(l.name)
+	if err != nil {
+		return windows.InvalidHandle, err
+	}
+	return windows.CreateNamedPipe(
+		name,
+		windows.PIPE_ACCESS_DUPLEX|windows.FILE_FLAG_OVERLAPPED|flags,
+		windows.PIPE_TYPE_BYTE|windows.PIPE_READMODE_BYTE|windows.PIPE_WAIT|windows.PIPE_REJECT_REMOTE_CLIENTS,
+		windows.PIPE_UNLIMITED_INSTANCES,
+		pipeBufferSize,
+		pipeBufferSize,
+		0,
+		l.sa,
+	)
+}
+
+// Accept waits for a client to connect to the pipe. Clients that disconnect
+// before they are accepted are skipped.
+func (l *pipeListener) Accept() (net.Conn, error) {
+	l.acceptMu.Lock()
+	defer l.acceptMu.Unlock()
+
+	for {
+		l.mu.Lock()
+		if l.isClosed {
+			l.mu.Unlock()
+			return nil, net.ErrClosed
+		}
+		h := l.next
+		l.mu.Unlock()
+
+		err := l.connect(h)
+		if errors.Is(err, net.ErrClosed) {
+			return nil, err
+		}
+
+		next, nerr := l.newInstance(0)
+		l.mu.Lock()
+		if l.isClosed {
+			l.mu.Unlock()
+			if nerr == nil {
+				windows.CloseHandle(next)
+			}
+			return nil, net.ErrClosed
+		}
+		if nerr != nil {
+			l.mu.Unlock()
+			// Keep h as the next instance, ready for another client.
+			windows.DisconnectNamedPipe(h)
+			return nil, nerr
+		}
+		l.next = next
+		l.mu.Unlock()
+
+		if err != nil {
+			windows.CloseHandle(h)
+			continue
+		}
+		return newPipeConn(h, l.name)
+	}
+}
+
+// connect waits for a client to connect to the pipe instance h.
+func (l *pipeListener) connect(h windows.Handle) error {
+	o := &windows.Overlapped{HEvent: l.connected}
+	err := windows.ConnectNamedPipe(h, o)
+	switch err {
+	case nil, windows.ERROR_PIPE_CONNECTED:
+		return nil
+	case windows.ERROR_IO_PENDING:
+		_, err = waitIO(h, o, l.closed, time.Time{})
+		return err
+	default:
+		return err
+	}
+}
+
+// Close stops listening. Connections that were already accepted are not
+// closed.
+func (l *pipeListener) Close() error {
+	l.mu.Lock()
+	if l.isClosed {
+		l.mu.Unlock()
+		return net.ErrClosed
+	}
+	l.isClosed = true
+	windows.SetEvent(l.closed)
+	l.mu.Unlock()
+
+	// Wait for a pending Accept to return before releasing its handles.
+	l.acceptMu.Lock()
+	defer l.acceptMu.Unlock()
+	windows.CloseHandle(l.next)
+	windows.CloseHandle(l.connected)
+	windows.CloseHandle(l.closed)
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return pipeAddr(l.name)
+}
+
+// pipeConn is a client connection to a pipe instance.
+type pipeConn struct {
+	h    windows.Handle
+	addr pipeAddr
+
+	readMu    sync.Mutex
+	readEvent windows.Handle
+
+	writeMu    sync.Mutex
+	writeEvent windows.Handle
+
+	mu            sync.Mutex
+	readDeadline  time.Time
+	writeDeadline time.Time
+	isClosed      bool
+	closed        windows.Handle
+	pending       sync.WaitGroup
+}
+
+func newPipeConn(h windows.Handle, name string) (*pipeConn, error) {
+	c := &pipeConn{h: h, addr: pipeAddr(name)}
+	var err error
+	if c.readEvent, err = windows.CreateEvent(nil, 1, 0, nil); err == nil {
+		if c.writeEvent, err = windows.CreateEvent(nil, 1, 0, nil); err == nil {
+			if c.closed, err = windows.CreateEvent(nil, 1, 0, nil); err == nil {
+				return c, nil
+			}
+			windows.CloseHandle(c.writeEvent)
+		}
+		windows.CloseHandle(c.readEvent)
+	}
+	windows.DisconnectNamedPipe(h)
+	windows.CloseHandle(h)
+	return nil, err
+}
+
+// begin registers a pending operation and returns its deadline. It fails
+// once the connection is closed.
+func (c *pipeConn) begin(read bool) (time.Time, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.isClosed {
+		return time.Time{}, net.ErrClosed
+	}
+	deadline := c.writeDeadline
+	if read {
+		deadline = c.readDeadline
+	}
+	if !deadline.IsZero() && !time.Now().Before(deadline) {
+		return time.Time{}, os.ErrDeadlineExceeded
+	}
+	c.pending.Add(1)
+	return deadline, nil
+}
+
+func (c *pipeConn) Read(b []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	deadline, err := c.begin(true)
+	if err != nil {
+		return 0, err
+	}
+	defer c.pending.Done()
+
+	var n uint32
+	o := &windows.Overlapped{HEvent: c.readEvent}
+	err = windows.ReadFile(c.h, b, &n, o)
+	if err == windows.ERROR_IO_PENDING {
+		n, err = waitIO(c.h, o, c.closed, deadline)
+	}
+	switch err {
+	case nil:
+		return int(n), nil
+	case windows.ERROR_BROKEN_PIPE, windows.ERROR_PIPE_NOT_CONNECTED:
+		return int(n), io.EOF
+	case windows.ERROR_MORE_DATA:
+		return int(n), nil
+	default:
+		return int(n), err
+	}
+}
+
+func (c *pipeConn) Write(b []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	deadline, err := c.begin(false)
+	if err != nil {
+		return 0, err
+	}
+	defer c.pending.Done()
+
+	var written int
+	for written < len(b) {
+		var n uint32
+		o := &windows.Overlapped{HEvent: c.writeEvent}
+		err = windows.WriteFile(c.h, b[written:], &n, o)
+		if err == windows.ERROR_IO_PENDING {
+			n, err = waitIO(c.h, o, c.closed, deadline)
+		}
+		written += int(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// Close cancels pending reads and writes and closes the pipe instance.
+// Data not read by the client yet is still delivered.
+func (c *pipeConn) Close() error {
+	c.mu.Lock()
+	if c.isClosed {
+		c.mu.Unlock()
+		return net.ErrClosed
+	}
+	c.isClosed = true
+	windows.SetEvent(c.closed)
+	c.mu.Unlock()
+
+	c.pending.Wait()
+	err := windows.CloseHandle(c.h)
+	windows.CloseHandle(c.readEvent)
+	windows.CloseHandle(c.writeEvent)
+	windows.CloseHandle(c.closed)
+	return err
+}
+
+func (c *pipeConn) LocalAddr() net.Addr {
+	return c.addr
+}
+
+func (c *pipeConn) RemoteAddr() net.Addr {
+	return c.addr
+}
+
+// SetDeadline sets the read and write deadlines. Like the deadlines of
+// the connections of the net package, they only apply to operations that
+// start after they were set.
+func (c *pipeConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	c.writeDeadline = t
+	return nil
+}
+
+func (c *pipeConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	return nil
+}
+
+func (c *pipeConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writeDeadline = t
+	return nil
+}
+
+// waitIO waits for the overlapped operation o on h to complete, for the
+// cancel event to be signaled or for the deadline to pass. An operation
+// that did not complete is cancelled, and waitIO only returns once it was,
+// so that o and the buffer of the operation can be released.
+func waitIO(h windows.Handle, o *windows.Overlapped, cancel windows.Handle, deadline time.Time) (uint32, error) {
+	timeout := uint32(windows.INFINITE)
+	if !deadline.IsZero() {
+		d := time.Until(deadline).Milliseconds()
+		timeout = uint32(max(0, min(d, math.MaxUint32-1)))
+	}
+
+	var n uint32
+	event, err := windows.WaitForMultipleObjects([]windows.Handle{o.HEvent, cancel}, false, timeout)
+	if err == nil && event == windows.WAIT_OBJECT_0 {
+		return n, windows.GetOverlappedResult(h, o, &n, false)
+	}
+
+	windows.CancelIoEx(h, o)
+	// The operation may have completed before it was cancelled.
+	ioErr := windows.GetOverlappedResult(h, o, &n, true)
+	switch {
+	case ioErr != windows.ERROR_OPERATION_ABORTED:
+		return n, ioErr
+	case err != nil:
+		return n, err
+	case event == uint32(windows.WAIT_TIMEOUT):
+		return n, os.ErrDeadlineExceeded
+	default:
+		return n, net.ErrClosed
+	}
+}
@@ -0,0 +1,107 @@
+//go:build windows
+
+package plumbing_test
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"golang.org/x/sys/windows"
+
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/plumbing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ListenPipe on windows", func() {
+	var (
+		name string
+		l    net.Listener
+	)
+
+	BeforeEach(func() {
+		name = fmt.Sprintf(`\\.\pipe\loggregator-agent-test-%d-%d`, os.Getpid(), GinkgoParallelProcess())
+		var err error
+		l, err = plumbing.ListenPipe(name, "D:P(A;;GA;;;WD)")
+		Expect(err).ToNot(HaveOccurred())
+		DeferCleanup(func() { l.Close() })
+	})
+
+	dial := func() *os.File {
+		p, err := windows.UTF16PtrFromString(name)
+		Expect(err).ToNot(HaveOccurred())
+		h, err := windows.CreateFile(p, windows.GENERIC_READ|windows.GENERIC_WRITE, 0, nil, windows.OPEN_EXISTING, 0, 0)
+		Expect(err).ToNot(HaveOccurred())
+		return os.NewFile(uintptr(h), name)
+	}
+
+	It("exchanges data with clients", func() {
+		client := dial()
+		defer client.Close()
+
+		conn, err := l.Accept()
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close()
+		Expect(conn.LocalAddr().String()).To(Equal(name))
+
+		_, err = client.Write([]byte("ping"))
+		Expect(err).ToNot(HaveOccurred())
+		b := make([]byte, 4)
+		_, err = io.ReadFull(conn, b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(b)).To(Equal("ping"))
+
+		_, err = conn.Write([]byte("pong"))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = io.ReadFull(client, b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(b)).To(Equal("pong"))
+
+		client.Close()
+		_, err = conn.Read(b)
+		Expect(err).To(Equal(io.EOF))
+	})
+
+	It("accepts several clients", func() {
+		for i := 0; i < 3; i++ {
+			client := dial()
+			defer client.Close()
+			conn, err := l.Accept()
+			Expect(err).ToNot(HaveOccurred())
+			defer conn.Close()
+		}
+	})
+
+	It("fails to listen on a pipe that is already in use", func() {
+		_, err := plumbing.ListenPipe(name, "")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("times out reads at the deadline", func() {
+		client := dial()
+		defer client.Close()
+		conn, err := l.Accept()
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close()
+
+		Expect(conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))).To(Succeed())
+		_, err = conn.Read(make([]byte, 1))
+		Expect(err).To(MatchError(os.ErrDeadlineExceeded))
+	})
+
+	It("unblocks Accept when closed", func() {
+		errs := make(chan error, 1)
+		go func() {
+			_, err := l.Accept()
+			errs <- err
+		}()
+
+		Consistently(errs, 100*time.Millisecond).ShouldNot(Receive())
+		Expect(l.Close()).To(Succeed())
+		Eventually(errs).Should(Receive(MatchError(net.ErrClosed)))
+	})
+})
@@ -0,0 +1,37 @@
+package plumbing
+
+// RunService runs the component with run. When the process was started by
+// the Windows service control manager, it reports run as the running
+// service and calls stop when the service is stopped or the system shuts
+// down. Pause requests are only accepted with WithPause. Elsewhere, and
+// when the process is run by a service wrapper like the BOSH Windows jobs
+// are, run is just called.
+func RunService(name string, run, stop func(), opts ...ServiceOption) error {
+	s := &service{run: run, stop: stop}
+	for _, o := range opts {
+		o(s)
+	}
+	return runService(name, s)
+}
+
+// ServiceOption configures RunService.
+type ServiceOption func(*service)
+
+// WithPause accepts pause requests of the service control manager. pause
+// is called when the service is paused and resume when it is continued.
+// Components that cannot pause without losing data should not accept
+// pause requests.
+func WithPause(pause, resume func()) ServiceOption {
+	return func(s *service) {
+		s.pause = pause
+		s.resume = resume
+	}
+}
+
+// service is the component run by RunService.
+type service struct {
+	run    func()
+	stop   func()
+	pause  func()
+	resume func()
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package plumbing
+
+func runService(_ string, s *service) error {
+	s.run()
+	return nil
+}
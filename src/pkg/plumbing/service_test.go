@@ -0,0 +1,30 @@
+package plumbing_test
+
+import (
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/plumbing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RunService", func() {
+	It("runs the component when not started by a service control manager", func() {
+		var ran, stopped bool
+		err := plumbing.RunService("test", func() { ran = true }, func() { stopped = true })
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ran).To(BeTrue())
+		Expect(stopped).To(BeFalse())
+	})
+
+	It("does not pause the component when not started by a service control manager", func() {
+		var paused bool
+		err := plumbing.RunService("test", func() {}, func() {}, plumbing.WithPause(
+			func() { paused = true },
+			func() { paused = false },
+		))
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(paused).To(BeFalse())
+	})
+})
@@ -0,0 +1,61 @@
+//go:build windows
+
+package plumbing
+
+import (
+	"golang.org/x/sys/windows/svc"
+)
+
+func runService(name string, s *service) error {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return err
+	}
+	if !isService {
+		s.run()
+		return nil
+	}
+	return svc.Run(name, s)
+}
+
+// Execute implements svc.Handler. The service is stopped once run returns
+// or after stop returned.
+func (s *service) Execute(_ []string, requests <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	accepts := svc.AcceptStop | svc.AcceptShutdown
+	if s.pause != nil {
+		accepts |= svc.AcceptPauseAndContinue
+	}
+
+	changes <- svc.Status{State: svc.StartPending}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.run()
+	}()
+	changes <- svc.Status{State: svc.Running, Accepts: accepts}
+
+	for {
+		select {
+		case <-done:
+			changes <- svc.Status{State: svc.StopPending}
+			return false, 0
+		case r := <-requests:
+			switch r.Cmd {
+			case svc.Interrogate:
+				changes <- r.CurrentStatus
+			case svc.Pause:
+				changes <- svc.Status{State: svc.PausePending, Accepts: accepts}
+				s.pause()
+				changes <- svc.Status{State: svc.Paused, Accepts: accepts}
+			case svc.Continue:
+				changes <- svc.Status{State: svc.ContinuePending, Accepts: accepts}
+				s.resume()
+				changes <- svc.Status{State: svc.Running, Accepts: accepts}
+			case svc.Stop, svc.Shutdown:
+				changes <- svc.Status{State: svc.StopPending}
+				s.stop()
+				return false, 0
+			}
+		}
+	}
+}
@@ -0,0 +1,57 @@
+//go:build windows
+
+package plumbing
+
+import (
+	"golang.org/x/sys/windows/svc"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("service", func() {
+	It("pauses and resumes the component when pause requests are accepted", func() {
+		var paused bool
+		stopped := make(chan struct{})
+		s := &service{
+			run:    func() { <-stopped },
+			stop:   func() { close(stopped) },
+			pause:  func() { paused = true },
+			resume: func() { paused = false },
+		}
+		requests := make(chan svc.ChangeRequest)
+		changes := make(chan svc.Status, 10)
+		go s.Execute(nil, requests, changes)
+
+		Eventually(changes).Should(Receive(HaveField("State", svc.StartPending)))
+		var running svc.Status
+		Eventually(changes).Should(Receive(&running))
+		Expect(running.State).To(Equal(svc.Running))
+		Expect(running.Accepts & svc.AcceptPauseAndContinue).ToNot(BeZero())
+
+		requests <- svc.ChangeRequest{Cmd: svc.Pause}
+		Eventually(changes).Should(Receive(HaveField("State", svc.PausePending)))
+		Eventually(changes).Should(Receive(HaveField("State", svc.Paused)))
+		Expect(paused).To(BeTrue())
+
+		requests <- svc.ChangeRequest{Cmd: svc.Continue}
+		Eventually(changes).Should(Receive(HaveField("State", svc.ContinuePending)))
+		Eventually(changes).Should(Receive(HaveField("State", svc.Running)))
+		Expect(paused).To(BeFalse())
+
+		requests <- svc.ChangeRequest{Cmd: svc.Stop}
+		Eventually(changes).Should(Receive(HaveField("State", svc.StopPending)))
+		Eventually(stopped).Should(BeClosed())
+	})
+
+	It("does not accept pause requests by default", func() {
+		s := &service{run: func() {}, stop: func() {}}
+		changes := make(chan svc.Status, 10)
+		go s.Execute(nil, make(chan svc.ChangeRequest), changes)
+
+		Eventually(changes).Should(Receive(HaveField("State", svc.StartPending)))
+		var running svc.Status
+		Eventually(changes).Should(Receive(&running))
+		Expect(running.Accepts & svc.AcceptPauseAndContinue).To(BeZero())
+	})
+})
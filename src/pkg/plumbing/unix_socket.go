@@ -0,0 +1,57 @@
+package plumbing
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+)
+
+// ListenUnix listens on a Unix domain socket at path with the given
+// permissions. Any existing file at path is replaced. The socket is created
+// in a private directory next to path and only moved to path once its
+// permissions are set, so clients cannot connect to it before. The socket
+// is removed when the listener is closed.
+func ListenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".sock-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	tmp := filepath.Join(dir, filepath.Base(path))
+	l, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, err
+	}
+	ul := l.(*net.UnixListener)
+	ul.SetUnlinkOnClose(false)
+
+	if err := os.Chmod(tmp, mode); err != nil {
+		ul.Close()
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		ul.Close()
+		return nil, err
+	}
+
+	return &unixListener{UnixListener: ul, path: path}, nil
+}
+
+// unixListener reports and removes the socket at the path it was moved to.
+type unixListener struct {
+	*net.UnixListener
+	path string
+}
+
+func (l *unixListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: l.path, Net: "unix"}
+}
+
+func (l *unixListener) Close() error {
+	err := l.UnixListener.Close()
+	if rerr := os.Remove(l.path); rerr != nil && !os.IsNotExist(rerr) && err == nil {
+		err = rerr
+	}
+	return err
+}
@@ -0,0 +1,57 @@
+package plumbing_test
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/plumbing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ListenUnix", func() {
+	var path string
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "agent.sock")
+	})
+
+	It("listens with the permissions at the path", func() {
+		l, err := plumbing.ListenUnix(path, 0600)
+		Expect(err).ToNot(HaveOccurred())
+		defer l.Close()
+
+		info, err := os.Stat(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Mode() & os.ModeSocket).ToNot(BeZero())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+		Expect(l.Addr().String()).To(Equal(path))
+
+		conn, err := net.Dial("unix", path)
+		Expect(err).ToNot(HaveOccurred())
+		conn.Close()
+	})
+
+	It("replaces an existing file and leaves no private directory", func() {
+		Expect(os.WriteFile(path, nil, 0644)).To(Succeed())
+
+		l, err := plumbing.ListenUnix(path, 0660)
+		Expect(err).ToNot(HaveOccurred())
+		defer l.Close()
+
+		entries, err := os.ReadDir(filepath.Dir(path))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].Type() & os.ModeSocket).ToNot(BeZero())
+	})
+
+	It("removes the socket when closed", func() {
+		l, err := plumbing.ListenUnix(path, 0600)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(l.Close()).To(Succeed())
+		Expect(path).ToNot(BeAnExistingFile())
+	})
+})
@@ -12,18 +12,20 @@ import (
 )
 
 type PromScraperConfig struct {
-	Port           string            `yaml:"port"`
-	SourceID       string            `yaml:"source_id"`
-	InstanceID     string            `yaml:"instance_id"`
-	Scheme         string            `yaml:"scheme"`
-	ServerName     string            `yaml:"server_name"`
-	Path           string            `yaml:"path"`
-	Headers        map[string]string `yaml:"headers"`
-	Labels         map[string]string `yaml:"labels"`
-	CaPath         string            `yaml:"ca_path"`
-	ClientKeyPath  string            `yaml:"client_key_path"`
-	ClientCertPath string            `yaml:"client_cert_path"`
-	ScrapeInterval time.Duration     `yaml:"scrape_interval"`
+	Port            string            `yaml:"port"`
+	SourceID        string            `yaml:"source_id"`
+	InstanceID      string            `yaml:"instance_id"`
+	Scheme          string            `yaml:"scheme"`
+	ServerName      string            `yaml:"server_name"`
+	Path            string            `yaml:"path"`
+	Headers         map[string]string `yaml:"headers"`
+	Labels          map[string]string `yaml:"labels"`
+	CaPath          string            `yaml:"ca_path"`
+	ClientKeyPath   string            `yaml:"client_key_path"`
+	ClientCertPath  string            `yaml:"client_cert_path"`
+	BearerTokenFile string            `yaml:"bearer_token_file"`
+	ScrapeInterval  time.Duration     `yaml:"scrape_interval"`
+	ScrapeTimeout   time.Duration     `yaml:"scrape_timeout"`
 }
 
 type ConfigProvider struct {
@@ -0,0 +1,83 @@
+package scraper
+
+import "sync"
+
+// Limiter bounds the number of scrapes running at the same time, both in
+// total and per job.
+type Limiter struct {
+	global chan struct{}
+	perJob int
+
+	mu   sync.Mutex
+	jobs map[string]chan struct{}
+}
+
+// NewLimiter returns a Limiter allowing at most global concurrent scrapes
+// and at most perJob concurrent scrapes for the same job. A non-positive
+// limit is unlimited.
+func NewLimiter(global, perJob int) *Limiter {
+	l := &Limiter{
+		perJob: perJob,
+		jobs:   make(map[string]chan struct{}),
+	}
+	if global > 0 {
+		l.global = make(chan struct{}, global)
+	}
+
+	return l
+}
+
+// Acquire blocks until a scrape for the job may start or done is closed.
+// The returned function must be called when the scrape has finished. If
+// done is closed before the scrape may start, Acquire returns false.
+func (l *Limiter) Acquire(job string, done <-chan struct{}) (func(), bool) {
+	jobSem := l.jobSemaphore(job)
+
+	if !acquire(jobSem, done) {
+		return nil, false
+	}
+	if !acquire(l.global, done) {
+		release(jobSem)
+		return nil, false
+	}
+
+	return func() {
+		release(l.global)
+		release(jobSem)
+	}, true
+}
+
+func (l *Limiter) jobSemaphore(job string) chan struct{} {
+	if l.perJob <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	sem, ok := l.jobs[job]
+	if !ok {
+		sem = make(chan struct{}, l.perJob)
+		l.jobs[job] = sem
+	}
+	return sem
+}
+
+func acquire(sem chan struct{}, done <-chan struct{}) bool {
+	if sem == nil {
+		return true
+	}
+
+	select {
+	case sem <- struct{}{}:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+func release(sem chan struct{}) {
+	if sem != nil {
+		<-sem
+	}
+}
@@ -0,0 +1,104 @@
+package scraper_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/scraper"
+)
+
+var _ = Describe("Limiter", func() {
+	var done chan struct{}
+
+	BeforeEach(func() {
+		done = make(chan struct{})
+	})
+
+	AfterEach(func() {
+		select {
+		case <-done:
+		default:
+			close(done)
+		}
+	})
+
+	acquireAsync := func(l *scraper.Limiter, job string) chan func() {
+		c := make(chan func(), 1)
+		d := done
+		go func() {
+			release, ok := l.Acquire(job, d)
+			if ok {
+				c <- release
+			}
+		}()
+		return c
+	}
+
+	It("does not limit scrapes if no limits are set", func() {
+		l := scraper.NewLimiter(0, 0)
+
+		for i := 0; i < 100; i++ {
+			_, ok := l.Acquire("job", done)
+			Expect(ok).To(BeTrue())
+		}
+	})
+
+	It("limits the number of concurrent scrapes", func() {
+		l := scraper.NewLimiter(2, 0)
+
+		release, ok := l.Acquire("job-1", done)
+		Expect(ok).To(BeTrue())
+		_, ok = l.Acquire("job-2", done)
+		Expect(ok).To(BeTrue())
+
+		c := acquireAsync(l, "job-3")
+		Consistently(c).ShouldNot(Receive())
+
+		release()
+		Eventually(c).Should(Receive())
+	})
+
+	It("limits the number of concurrent scrapes per job", func() {
+		l := scraper.NewLimiter(0, 1)
+
+		release, ok := l.Acquire("job-1", done)
+		Expect(ok).To(BeTrue())
+		_, ok = l.Acquire("job-2", done)
+		Expect(ok).To(BeTrue())
+
+		c := acquireAsync(l, "job-1")
+		Consistently(c).ShouldNot(Receive())
+
+		release()
+		Eventually(c).Should(Receive())
+	})
+
+	It("does not hold a global slot while waiting for the job", func() {
+		l := scraper.NewLimiter(2, 1)
+
+		_, ok := l.Acquire("job-1", done)
+		Expect(ok).To(BeTrue())
+
+		c := acquireAsync(l, "job-1")
+		Consistently(c).ShouldNot(Receive())
+
+		_, ok = l.Acquire("job-2", done)
+		Expect(ok).To(BeTrue())
+	})
+
+	It("stops waiting when done is closed", func() {
+		l := scraper.NewLimiter(1, 0)
+
+		_, ok := l.Acquire("job", done)
+		Expect(ok).To(BeTrue())
+
+		result := make(chan bool)
+		go func() {
+			_, ok := l.Acquire("job", done)
+			result <- ok
+		}()
+
+		close(done)
+		Eventually(result).Should(Receive(BeFalse()))
+	})
+})
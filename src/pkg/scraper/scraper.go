@@ -5,7 +5,9 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -24,6 +26,21 @@ type Scraper struct {
 	failedScrapes  metrics.Gauge
 	scrapeDuration metrics.Gauge
 	defaultID      string
+
+	counterDeltas bool
+	countersMu    sync.Mutex
+	counterTotals map[counterID]uint64
+}
+
+// maxCounterTotals bounds the number of counter totals remembered for
+// computing deltas. The totals are reset when it is exceeded.
+const maxCounterTotals = 10000
+
+type counterID struct {
+	sourceID   string
+	instanceID string
+	name       string
+	tags       string
 }
 
 type TargetProvider func() []Target
@@ -95,6 +112,18 @@ func WithMetricsClient(m metricsClient) ScrapeOption {
 	}
 }
 
+// WithCounterDeltas configures the scraper to set the delta on emitted
+// counters. The delta is computed from the total of the previous scrape. On
+// the first scrape of a counter the delta is zero, and if the total
+// decreased the counter is assumed to have been reset and the delta is the
+// new total.
+func WithCounterDeltas() ScrapeOption {
+	return func(s *Scraper) {
+		s.counterDeltas = true
+		s.counterTotals = make(map[counterID]uint64)
+	}
+}
+
 func (s *Scraper) Scrape() error {
 	start := time.Now()
 	defer func() {
@@ -225,12 +254,66 @@ func (s *Scraper) emitCounter(sourceID, instanceID, name string, tags map[string
 		return //the counter contains a fractional value
 	}
 
-	s.metricsEmitter.EmitCounter(
-		name,
-		loggregator.WithTotal(uint64(val)),
+	s.emitTotalAsCounter(sourceID, instanceID, name, tags, uint64(val))
+}
+
+func (s *Scraper) emitTotalAsCounter(sourceID, instanceID, name string, tags map[string]string, total uint64) {
+	opts := []loggregator.EmitCounterOption{
+		loggregator.WithTotal(total),
 		loggregator.WithCounterSourceInfo(sourceID, instanceID),
 		loggregator.WithEnvelopeTags(tags),
-	)
+	}
+	if s.counterDeltas {
+		opts = append(opts, loggregator.WithDelta(s.delta(sourceID, instanceID, name, tags, total)))
+	}
+
+	s.metricsEmitter.EmitCounter(name, opts...)
+}
+
+// delta records the total of the counter and returns the difference to the
+// previously recorded total.
+func (s *Scraper) delta(sourceID, instanceID, name string, tags map[string]string, total uint64) uint64 {
+	id := counterID{
+		sourceID:   sourceID,
+		instanceID: instanceID,
+		name:       name,
+		tags:       hashTags(tags),
+	}
+
+	s.countersMu.Lock()
+	defer s.countersMu.Unlock()
+
+	prev, ok := s.counterTotals[id]
+	if !ok && len(s.counterTotals) >= maxCounterTotals {
+		s.counterTotals = make(map[counterID]uint64)
+	}
+	s.counterTotals[id] = total
+
+	switch {
+	case !ok:
+		return 0
+	case total < prev:
+		return total
+	default:
+		return total - prev
+	}
+}
+
+func hashTags(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(tags[k])
+		b.WriteByte(',')
+	}
+	return b.String()
 }
 
 func (s *Scraper) emitHistogram(sourceID, instanceID, name string, tags map[string]string, metric *io_prometheus_client.Metric) {
@@ -241,20 +324,14 @@ func (s *Scraper) emitHistogram(sourceID, instanceID, name string, tags map[stri
 		loggregator.WithGaugeSourceInfo(sourceID, instanceID),
 		loggregator.WithEnvelopeTags(tags),
 	)
-	s.metricsEmitter.EmitCounter(
-		name+"_count",
-		loggregator.WithTotal(histogram.GetSampleCount()),
-		loggregator.WithCounterSourceInfo(sourceID, instanceID),
-		loggregator.WithEnvelopeTags(tags),
-	)
+	s.emitTotalAsCounter(sourceID, instanceID, name+"_count", tags, histogram.GetSampleCount())
 	for _, bucket := range histogram.GetBucket() {
-		s.metricsEmitter.EmitCounter(
-			name+"_bucket",
-			loggregator.WithTotal(bucket.GetCumulativeCount()),
-			loggregator.WithCounterSourceInfo(sourceID, instanceID),
-			loggregator.WithEnvelopeTags(tags),
-			loggregator.WithEnvelopeTag("le", strconv.FormatFloat(bucket.GetUpperBound(), 'g', -1, 64)),
-		)
+		bucketTags := make(map[string]string, len(tags)+1)
+		for k, v := range tags {
+			bucketTags[k] = v
+		}
+		bucketTags["le"] = strconv.FormatFloat(bucket.GetUpperBound(), 'g', -1, 64)
+		s.emitTotalAsCounter(sourceID, instanceID, name+"_bucket", bucketTags, bucket.GetCumulativeCount())
 	}
 }
 
@@ -265,12 +342,7 @@ func (s *Scraper) emitSummary(sourceID, instanceID, name string, tags map[string
 		loggregator.WithGaugeSourceInfo(sourceID, instanceID),
 		loggregator.WithEnvelopeTags(tags),
 	)
-	s.metricsEmitter.EmitCounter(
-		name+"_count",
-		loggregator.WithTotal(summary.GetSampleCount()),
-		loggregator.WithCounterSourceInfo(sourceID, instanceID),
-		loggregator.WithEnvelopeTags(tags),
-	)
+	s.emitTotalAsCounter(sourceID, instanceID, name+"_count", tags, summary.GetSampleCount())
 	for _, quantile := range summary.GetQuantile() {
 		s.metricsEmitter.EmitGauge(
 			loggregator.WithGaugeValue(name, float64(quantile.GetValue()), ""),
@@ -172,6 +172,89 @@ var _ = Describe("Scraper", func() {
 		})
 	})
 
+	Context("counter deltas", func() {
+		var tc *testContext
+
+		BeforeEach(func() {
+			tc = setup()
+			tc.scraper = scraper.New(
+				func() []scraper.Target {
+					return []scraper.Target{{
+						ID:         "some-id",
+						InstanceID: "some-instance-id",
+						MetricURL:  "http://some.url/metrics",
+					}}
+				},
+				tc.metricEmitter,
+				tc.metricGetter.Get,
+				"default-id",
+				scraper.WithCounterDeltas(),
+			)
+		})
+
+		var scrapeCounter = func(value string) *loggregator_v2.Envelope {
+			addResponse(tc, 200, "# TYPE counter_1 counter\ncounter_1{code=\"200\"} "+value+"\n")
+			Expect(tc.scraper.Scrape()).To(Succeed())
+			Expect(tc.metricEmitter.envelopes).ToNot(BeEmpty())
+			return tc.metricEmitter.envelopes[len(tc.metricEmitter.envelopes)-1]
+		}
+
+		It("emits a zero delta on the first scrape", func() {
+			env := scrapeCounter("5")
+
+			Expect(env.GetCounter().GetTotal()).To(Equal(uint64(5)))
+			Expect(env.GetCounter().GetDelta()).To(Equal(uint64(0)))
+		})
+
+		It("emits the difference to the previous scrape", func() {
+			scrapeCounter("5")
+			env := scrapeCounter("12")
+
+			Expect(env.GetCounter().GetTotal()).To(Equal(uint64(12)))
+			Expect(env.GetCounter().GetDelta()).To(Equal(uint64(7)))
+		})
+
+		It("emits the total as delta when the counter was reset", func() {
+			scrapeCounter("12")
+			env := scrapeCounter("3")
+
+			Expect(env.GetCounter().GetTotal()).To(Equal(uint64(3)))
+			Expect(env.GetCounter().GetDelta()).To(Equal(uint64(3)))
+		})
+
+		It("tracks counters with different tags separately", func() {
+			addResponse(tc, 200, "# TYPE counter_1 counter\ncounter_1{code=\"200\"} 5\ncounter_1{code=\"500\"} 1\n")
+			Expect(tc.scraper.Scrape()).To(Succeed())
+			addResponse(tc, 200, "# TYPE counter_1 counter\ncounter_1{code=\"200\"} 6\ncounter_1{code=\"500\"} 4\n")
+			Expect(tc.scraper.Scrape()).To(Succeed())
+
+			deltas := map[string]uint64{}
+			for _, e := range tc.metricEmitter.envelopes[2:] {
+				deltas[e.GetTags()["code"]] = e.GetCounter().GetDelta()
+			}
+			Expect(deltas).To(Equal(map[string]uint64{"200": 1, "500": 3}))
+		})
+
+		It("emits deltas for histogram counts and buckets", func() {
+			addResponse(tc, 200, histogramOutput)
+			Expect(tc.scraper.Scrape()).To(Succeed())
+			addResponse(tc, 200, strings.ReplaceAll(histogramOutput, "144320", "144330"))
+			Expect(tc.scraper.Scrape()).To(Succeed())
+
+			var count, infBucket *loggregator_v2.Counter
+			for _, e := range tc.metricEmitter.envelopes {
+				switch {
+				case e.GetCounter().GetName() == "http_request_duration_seconds_count":
+					count = e.GetCounter()
+				case e.GetCounter().GetName() == "http_request_duration_seconds_bucket" && e.GetTags()["le"] == "+Inf":
+					infBucket = e.GetCounter()
+				}
+			}
+			Expect(count.GetDelta()).To(Equal(uint64(10)))
+			Expect(infBucket.GetDelta()).To(Equal(uint64(10)))
+		})
+	})
+
 	Context("histograms", func() {
 		It("emits a histogram with a default source ID", func() {
 			tc := setup(scraper.Target{
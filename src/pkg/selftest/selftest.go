@@ -0,0 +1,102 @@
+// Package selftest runs checks of an agent's configuration and environment
+// and reports their results, e.g. for BOSH pre-start scripts.
+package selftest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// Check is a single check of a self-test.
+type Check struct {
+	Name string
+	// Optional checks are reported but do not fail the self-test.
+	Optional bool
+	Run      func(ctx context.Context) error
+}
+
+// Result is the result of a Check.
+type Result struct {
+	Name            string  `json:"name"`
+	Passed          bool    `json:"passed"`
+	Optional        bool    `json:"optional,omitempty"`
+	Error           string  `json:"error,omitempty"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+// Report is the result of a self-test. It passed if all checks that are
+// not optional passed.
+type Report struct {
+	Passed bool     `json:"passed"`
+	Checks []Result `json:"checks"`
+}
+
+// Run runs the checks one after another. Each check is given at most
+// timeout to complete.
+func Run(ctx context.Context, timeout time.Duration, checks ...Check) Report {
+	r := Report{Passed: true}
+	for _, c := range checks {
+		start := time.Now()
+		err := runCheck(ctx, timeout, c)
+		res := Result{
+			Name:            c.Name,
+			Passed:          err == nil,
+			Optional:        c.Optional,
+			DurationSeconds: time.Since(start).Seconds(),
+		}
+		if err != nil {
+			res.Error = err.Error()
+			if !c.Optional {
+				r.Passed = false
+			}
+		}
+		r.Checks = append(r.Checks, res)
+	}
+
+	return r
+}
+
+func runCheck(ctx context.Context, timeout time.Duration, c Check) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	errs := make(chan error, 1)
+	go func() { errs <- c.Run(ctx) }()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("timed out after %s", timeout)
+	}
+}
+
+// Write writes the report as indented JSON.
+func (r Report) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// Resolve returns a check function that resolves the host of addr, a
+// host:port pair, with lookup.
+func Resolve(lookup func(string) ([]net.IP, error), addr string) func(context.Context) error {
+	return func(context.Context) error {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return err
+		}
+		ips, err := lookup(host)
+		if err != nil {
+			return err
+		}
+		if len(ips) == 0 {
+			return fmt.Errorf("%s did not resolve to any addresses", host)
+		}
+		return nil
+	}
+}
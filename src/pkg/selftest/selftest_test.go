@@ -0,0 +1,104 @@
+package selftest_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"time"
+
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/selftest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Selftest", func() {
+	pass := func(context.Context) error { return nil }
+	fail := func(context.Context) error { return errors.New("some-error") }
+
+	It("passes if all checks pass", func() {
+		r := selftest.Run(context.Background(), time.Second,
+			selftest.Check{Name: "a", Run: pass},
+			selftest.Check{Name: "b", Run: pass},
+		)
+
+		Expect(r.Passed).To(BeTrue())
+		Expect(r.Checks).To(HaveExactElements(
+			And(HaveField("Name", "a"), HaveField("Passed", true)),
+			And(HaveField("Name", "b"), HaveField("Passed", true)),
+		))
+	})
+
+	It("fails if a check fails", func() {
+		r := selftest.Run(context.Background(), time.Second,
+			selftest.Check{Name: "a", Run: fail},
+			selftest.Check{Name: "b", Run: pass},
+		)
+
+		Expect(r.Passed).To(BeFalse())
+		Expect(r.Checks[0].Error).To(Equal("some-error"))
+		Expect(r.Checks[1].Passed).To(BeTrue())
+	})
+
+	It("does not fail if an optional check fails", func() {
+		r := selftest.Run(context.Background(), time.Second,
+			selftest.Check{Name: "a", Optional: true, Run: fail},
+		)
+
+		Expect(r.Passed).To(BeTrue())
+		Expect(r.Checks[0].Passed).To(BeFalse())
+	})
+
+	It("fails checks that time out", func() {
+		block := make(chan struct{})
+		defer close(block)
+
+		r := selftest.Run(context.Background(), 10*time.Millisecond,
+			selftest.Check{Name: "a", Run: func(context.Context) error {
+				<-block
+				return nil
+			}},
+		)
+
+		Expect(r.Passed).To(BeFalse())
+		Expect(r.Checks[0].Error).To(Equal("timed out after 10ms"))
+	})
+
+	It("writes the report as JSON", func() {
+		r := selftest.Run(context.Background(), time.Second,
+			selftest.Check{Name: "a", Run: fail},
+		)
+		var buf bytes.Buffer
+		Expect(r.Write(&buf)).To(Succeed())
+
+		var decoded map[string]interface{}
+		Expect(json.Unmarshal(buf.Bytes(), &decoded)).To(Succeed())
+		Expect(decoded).To(HaveKeyWithValue("passed", false))
+		Expect(decoded["checks"]).To(ConsistOf(And(
+			HaveKeyWithValue("name", "a"),
+			HaveKeyWithValue("error", "some-error"),
+		)))
+	})
+
+	Describe("Resolve", func() {
+		It("resolves the host of the address", func() {
+			var host string
+			lookup := func(h string) ([]net.IP, error) {
+				host = h
+				return []net.IP{net.IPv4(10, 0, 0, 1)}, nil
+			}
+
+			Expect(selftest.Resolve(lookup, "doppler.service.cf.internal:8082")(context.Background())).To(Succeed())
+			Expect(host).To(Equal("doppler.service.cf.internal"))
+		})
+
+		It("fails if the host does not resolve", func() {
+			lookup := func(string) ([]net.IP, error) { return nil, nil }
+
+			Expect(selftest.Resolve(lookup, "doppler:8082")(context.Background())).To(MatchError("doppler did not resolve to any addresses"))
+			Expect(selftest.Resolve(lookup, "doppler")(context.Background())).ToNot(Succeed())
+		})
+	})
+})
@@ -0,0 +1,26 @@
+// Package testhelpers provides mocks of the core egress/v2 interfaces
+// (Nexter, Writer, BatchWriter and EnvelopeProcessor) for tests, so that
+// test suites share them rather than each defining their own.
+//
+// Every interface has two mocks:
+//
+//   - Channel based mocks, e.g. ChanBatchWriter, record their calls on
+//     buffered channels and return the values queued on their output
+//     channels, blocking until one is queued. They have the same shape as
+//     the mocks generated by hel.
+//   - Expectation based mocks, e.g. MockBatchWriter, fail the test on
+//     calls that were not expected and, in AssertExpectations, on expected
+//     calls that were not made.
+//
+// For example:
+//
+//	w := testhelpers.NewMockBatchWriter(GinkgoT())
+//	w.ExpectWrite(nil).Return(errors.New("some-error")).Times(1)
+//	...
+//	w.AssertExpectations()
+//
+// The channel based mocks are generated, run go generate after changing
+// the interfaces.
+package testhelpers
+
+//go:generate go run ./internal/chanmockgen -o egress_chan_mocks.go -pkg testhelpers -import code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2 -name egress ../egress/v2 Nexter Writer BatchWriter EnvelopeProcessor
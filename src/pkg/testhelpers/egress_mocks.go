@@ -0,0 +1,122 @@
+package testhelpers
+
+import (
+	"context"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+
+	egress "code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/v2"
+)
+
+var (
+	_ egress.Nexter            = (*MockNexter)(nil)
+	_ egress.Writer            = (*MockWriter)(nil)
+	_ egress.BatchWriter       = (*MockBatchWriter)(nil)
+	_ egress.EnvelopeProcessor = (*MockEnvelopeProcessor)(nil)
+)
+
+// MockNexter is an expectation based mock of egress.Nexter. TryNext
+// returns ok if the returned envelope is not nil.
+type MockNexter struct {
+	tryNext *expectations[struct{}, *loggregator_v2.Envelope]
+}
+
+// NewMockNexter returns a MockNexter that fails t.
+func NewMockNexter(t TestingT) *MockNexter {
+	return &MockNexter{tryNext: newExpectations[struct{}, *loggregator_v2.Envelope](t, "TryNext")}
+}
+
+// ExpectTryNext expects calls to TryNext.
+func (m *MockNexter) ExpectTryNext() *Expectation[struct{}, *loggregator_v2.Envelope] {
+	return m.tryNext.expect(nil)
+}
+
+// TryNext returns the envelope of the first matching expectation.
+func (m *MockNexter) TryNext() (*loggregator_v2.Envelope, bool) {
+	e := m.tryNext.call(struct{}{})
+	return e, e != nil
+}
+
+// AssertExpectations fails the test if expected calls were not made.
+func (m *MockNexter) AssertExpectations() {
+	m.tryNext.verify()
+}
+
+// MockWriter is an expectation based mock of egress.Writer.
+type MockWriter struct {
+	write *expectations[*loggregator_v2.Envelope, error]
+}
+
+// NewMockWriter returns a MockWriter that fails t.
+func NewMockWriter(t TestingT) *MockWriter {
+	return &MockWriter{write: newExpectations[*loggregator_v2.Envelope, error](t, "Write")}
+}
+
+// ExpectWrite expects writes of envelopes that match. A nil match matches
+// all envelopes.
+func (m *MockWriter) ExpectWrite(match func(*loggregator_v2.Envelope) bool) *Expectation[*loggregator_v2.Envelope, error] {
+	return m.write.expect(match)
+}
+
+// Write returns the error of the first matching expectation.
+func (m *MockWriter) Write(_ context.Context, msg *loggregator_v2.Envelope) error {
+	return m.write.call(msg)
+}
+
+// AssertExpectations fails the test if expected calls were not made.
+func (m *MockWriter) AssertExpectations() {
+	m.write.verify()
+}
+
+// MockBatchWriter is an expectation based mock of egress.BatchWriter.
+type MockBatchWriter struct {
+	write *expectations[[]*loggregator_v2.Envelope, error]
+}
+
+// NewMockBatchWriter returns a MockBatchWriter that fails t.
+func NewMockBatchWriter(t TestingT) *MockBatchWriter {
+	return &MockBatchWriter{write: newExpectations[[]*loggregator_v2.Envelope, error](t, "Write")}
+}
+
+// ExpectWrite expects writes of batches that match. A nil match matches
+// all batches.
+func (m *MockBatchWriter) ExpectWrite(match func([]*loggregator_v2.Envelope) bool) *Expectation[[]*loggregator_v2.Envelope, error] {
+	return m.write.expect(match)
+}
+
+// Write returns the error of the first matching expectation.
+func (m *MockBatchWriter) Write(_ context.Context, msgs []*loggregator_v2.Envelope) error {
+	return m.write.call(msgs)
+}
+
+// AssertExpectations fails the test if expected calls were not made.
+func (m *MockBatchWriter) AssertExpectations() {
+	m.write.verify()
+}
+
+// MockEnvelopeProcessor is an expectation based mock of
+// egress.EnvelopeProcessor.
+type MockEnvelopeProcessor struct {
+	process *expectations[*loggregator_v2.Envelope, error]
+}
+
+// NewMockEnvelopeProcessor returns a MockEnvelopeProcessor that fails t.
+func NewMockEnvelopeProcessor(t TestingT) *MockEnvelopeProcessor {
+	return &MockEnvelopeProcessor{process: newExpectations[*loggregator_v2.Envelope, error](t, "Process")}
+}
+
+// ExpectProcess expects envelopes that match to be processed. A nil match
+// matches all envelopes.
+func (m *MockEnvelopeProcessor) ExpectProcess(match func(*loggregator_v2.Envelope) bool) *Expectation[*loggregator_v2.Envelope, error] {
+	return m.process.expect(match)
+}
+
+// Process returns the error of the first matching expectation.
+func (m *MockEnvelopeProcessor) Process(msg *loggregator_v2.Envelope) error {
+	return m.process.call(msg)
+}
+
+// AssertExpectations fails the test if expected calls were not made.
+func (m *MockEnvelopeProcessor) AssertExpectations() {
+	m.process.verify()
+}
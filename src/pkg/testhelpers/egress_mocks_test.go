@@ -0,0 +1,101 @@
+package testhelpers_test
+
+import (
+	"context"
+	"errors"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/testhelpers"
+)
+
+var _ = Describe("Egress mocks", func() {
+	var env *loggregator_v2.Envelope
+
+	BeforeEach(func() {
+		env = &loggregator_v2.Envelope{SourceId: "some-source-id"}
+	})
+
+	Describe("channel based mocks", func() {
+		It("records writes and returns the queued errors", func() {
+			w := testhelpers.NewChanBatchWriter()
+			w.WriteOutput.Ret0 <- errors.New("some-error")
+
+			err := w.Write(context.Background(), []*loggregator_v2.Envelope{env})
+
+			Expect(err).To(MatchError("some-error"))
+			Expect(w.WriteCalled).To(Receive())
+			Expect(w.WriteInput.Msgs).To(Receive(ConsistOf(env)))
+		})
+
+		It("returns the queued envelopes", func() {
+			n := testhelpers.NewChanNexter()
+			n.TryNextOutput.Ret0 <- env
+			n.TryNextOutput.Ret1 <- true
+
+			e, ok := n.TryNext()
+
+			Expect(e).To(Equal(env))
+			Expect(ok).To(BeTrue())
+			Expect(n.TryNextCalled).To(Receive())
+		})
+	})
+
+	Describe("expectation based mocks", func() {
+		var t *testhelpers.MockTesting
+
+		BeforeEach(func() {
+			t = &testhelpers.MockTesting{}
+		})
+
+		It("returns the value of the first matching expectation", func() {
+			w := testhelpers.NewMockWriter(t)
+			w.ExpectWrite(func(e *loggregator_v2.Envelope) bool {
+				return e.GetSourceId() == "other-source-id"
+			}).Return(errors.New("other-error"))
+			w.ExpectWrite(nil).Return(errors.New("some-error"))
+
+			Expect(w.Write(context.Background(), env)).To(MatchError("some-error"))
+			Expect(t.Failed()).To(BeFalse())
+		})
+
+		It("fails on unexpected calls", func() {
+			p := testhelpers.NewMockEnvelopeProcessor(t)
+			p.ExpectProcess(nil).Times(1)
+
+			Expect(p.Process(env)).To(Succeed())
+			Expect(t.Failed()).To(BeFalse())
+
+			Expect(p.Process(env)).To(Succeed())
+			Expect(t.Errors()).To(ConsistOf(ContainSubstring("unexpected call to Process")))
+		})
+
+		It("fails on expected calls that were not made", func() {
+			w := testhelpers.NewMockBatchWriter(t)
+			w.ExpectWrite(nil).Times(2)
+
+			Expect(w.Write(context.Background(), nil)).To(Succeed())
+			w.AssertExpectations()
+
+			Expect(t.Errors()).To(ConsistOf("expected 2 calls to Write for expectation 1, got 1"))
+		})
+
+		It("returns ok if the nexter returns an envelope", func() {
+			n := testhelpers.NewMockNexter(t)
+			n.ExpectTryNext().Return(env).Times(1)
+			n.ExpectTryNext()
+
+			e, ok := n.TryNext()
+			Expect(e).To(Equal(env))
+			Expect(ok).To(BeTrue())
+
+			_, ok = n.TryNext()
+			Expect(ok).To(BeFalse())
+
+			n.AssertExpectations()
+			Expect(t.Failed()).To(BeFalse())
+		})
+	})
+})
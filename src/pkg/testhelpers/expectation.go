@@ -0,0 +1,88 @@
+package testhelpers
+
+import "sync"
+
+// Expectation is an expected call of an expectation based mock with
+// arguments A that returns R.
+type Expectation[A, R any] struct {
+	match func(A) bool
+	ret   R
+	times int
+	calls int
+}
+
+// Return sets the value returned by the call.
+func (e *Expectation[A, R]) Return(r R) *Expectation[A, R] {
+	e.ret = r
+	return e
+}
+
+// Times sets the number of calls that are expected. By default any number
+// of calls is expected, including none.
+func (e *Expectation[A, R]) Times(n int) *Expectation[A, R] {
+	e.times = n
+	return e
+}
+
+func (e *Expectation[A, R]) matches(a A) bool {
+	if e.times > 0 && e.calls >= e.times {
+		return false
+	}
+	return e.match == nil || e.match(a)
+}
+
+// expectations are the expected calls of a method of a mock.
+type expectations[A, R any] struct {
+	t      TestingT
+	method string
+
+	mu  sync.Mutex
+	all []*Expectation[A, R]
+}
+
+func newExpectations[A, R any](t TestingT, method string) *expectations[A, R] {
+	return &expectations[A, R]{t: t, method: method}
+}
+
+// expect adds an expectation for calls whose arguments match. A nil match
+// matches all calls.
+func (x *expectations[A, R]) expect(match func(A) bool) *Expectation[A, R] {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	e := &Expectation[A, R]{match: match}
+	x.all = append(x.all, e)
+	return e
+}
+
+// call returns the value of the first expectation the call matches. Calls
+// that match no expectation fail the test.
+func (x *expectations[A, R]) call(a A) R {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	for _, e := range x.all {
+		if e.matches(a) {
+			e.calls++
+			return e.ret
+		}
+	}
+
+	x.t.Helper()
+	x.t.Errorf("unexpected call to %s(%v)", x.method, a)
+	var zero R
+	return zero
+}
+
+// verify fails the test for expectations with fewer calls than expected.
+func (x *expectations[A, R]) verify() {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.t.Helper()
+	for i, e := range x.all {
+		if e.calls < e.times {
+			x.t.Errorf("expected %d calls to %s for expectation %d, got %d", e.times, x.method, i+1, e.calls)
+		}
+	}
+}
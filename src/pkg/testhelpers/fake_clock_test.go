@@ -0,0 +1,67 @@
+package testhelpers_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/testhelpers"
+)
+
+var _ = Describe("FakeClock", func() {
+	var (
+		start time.Time
+		clock *testhelpers.FakeClock
+	)
+
+	BeforeEach(func() {
+		start = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		clock = testhelpers.NewFakeClock(start)
+	})
+
+	It("only moves when advanced", func() {
+		Expect(clock.Now()).To(Equal(start))
+
+		clock.Advance(time.Minute)
+
+		Expect(clock.Now()).To(Equal(start.Add(time.Minute)))
+		Expect(clock.Since(start)).To(Equal(time.Minute))
+	})
+
+	It("fires timers once their deadline has passed", func() {
+		t := clock.NewTimer(time.Second)
+		Expect(clock.Waiters()).To(Equal(1))
+
+		clock.Advance(999 * time.Millisecond)
+		Expect(t.C()).ToNot(Receive())
+
+		clock.Advance(time.Millisecond)
+		Expect(t.C()).To(Receive(Equal(start.Add(time.Second))))
+		Expect(clock.Waiters()).To(BeZero())
+		Expect(t.Stop()).To(BeFalse())
+	})
+
+	It("does not fire stopped timers", func() {
+		t := clock.NewTimer(time.Second)
+
+		Expect(t.Stop()).To(BeTrue())
+		clock.Advance(time.Second)
+
+		Expect(t.C()).ToNot(Receive())
+	})
+
+	It("returns from Sleep once advanced", func() {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			clock.Sleep(time.Second)
+		}()
+
+		Eventually(clock.Waiters).Should(Equal(1))
+		Consistently(done).ShouldNot(BeClosed())
+
+		clock.Advance(time.Second)
+		Eventually(done).Should(BeClosed())
+	})
+})
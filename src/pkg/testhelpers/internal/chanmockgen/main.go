@@ -0,0 +1,346 @@
+// Command chanmockgen generates exported channel based mocks of interfaces
+// in the shape of the mocks generated by hel. hel only generates unexported
+// mocks in the package of the interfaces, so it cannot generate the mocks
+// that testhelpers shares between packages.
+//
+// usage: chanmockgen -o FILE -pkg PACKAGE -import IMPORT_PATH -name NAME DIR TYPE...
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("chanmockgen: ")
+
+	output := flag.String("o", "", "file to write the mocks to")
+	pkgName := flag.String("pkg", "", "package of the generated file")
+	importPath := flag.String("import", "", "import path of the package of the interfaces")
+	name := flag.String("name", "", "name the package of the interfaces is imported as")
+	chanSize := flag.Int("chan-size", 100, "size of the channels of the mocks")
+	flag.Parse()
+
+	if *output == "" || *pkgName == "" || *importPath == "" || *name == "" || flag.NArg() < 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	g := &generator{
+		fset:     token.NewFileSet(),
+		name:     *name,
+		imports:  map[string]string{*importPath: *name},
+		chanSize: *chanSize,
+	}
+	src, err := g.generate(*pkgName, flag.Arg(0), flag.Args()[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(*output, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+type generator struct {
+	fset     *token.FileSet
+	name     string
+	chanSize int
+
+	// imports maps the import paths used by the mocks to the names they
+	// are imported as.
+	imports map[string]string
+}
+
+type param struct {
+	name     string
+	field    string
+	typ      string
+	variadic bool
+}
+
+type method struct {
+	name    string
+	params  []param
+	results []string
+}
+
+func (g *generator) generate(pkgName, dir string, types []string) ([]byte, error) {
+	pkgs, err := parser.ParseDir(g.fset, dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkgs) != 1 {
+		return nil, fmt.Errorf("expected one package in %s, found %d", dir, len(pkgs))
+	}
+
+	var body bytes.Buffer
+	var asserts []string
+	for _, t := range types {
+		methods, err := g.interfaceMethods(pkgs, t)
+		if err != nil {
+			return nil, err
+		}
+		g.writeMock(&body, t, methods)
+		asserts = append(asserts, fmt.Sprintf("_ %s.%s = (*Chan%s)(nil)", g.name, t, t))
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by chanmockgen. DO NOT EDIT.\n\npackage %s\n\n", pkgName)
+	out.WriteString("import (\n")
+	paths := make([]string, 0, len(g.imports))
+	for p := range g.imports {
+		paths = append(paths, p)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		if std(paths[i]) != std(paths[j]) {
+			return std(paths[i])
+		}
+		return paths[i] < paths[j]
+	})
+	for i, p := range paths {
+		if i > 0 && std(p) != std(paths[i-1]) {
+			out.WriteString("\n")
+		}
+		if g.imports[p] == path.Base(p) {
+			fmt.Fprintf(&out, "%q\n", p)
+			continue
+		}
+		fmt.Fprintf(&out, "%s %q\n", g.imports[p], p)
+	}
+	out.WriteString(")\n\n")
+	out.WriteString("// chanBuffer is the number of calls the channels of channel based mocks\n// buffer.\n")
+	fmt.Fprintf(&out, "const chanBuffer = %d\n\n", g.chanSize)
+	fmt.Fprintf(&out, "var (\n%s\n)\n\n", strings.Join(asserts, "\n"))
+	out.Write(body.Bytes())
+
+	return format.Source(out.Bytes())
+}
+
+// interfaceMethods returns the methods of the interface named t.
+func (g *generator) interfaceMethods(pkgs map[string]*ast.Package, t string) ([]method, error) {
+	for _, p := range pkgs {
+		for _, f := range p.Files {
+			for _, decl := range f.Decls {
+				gd, ok := decl.(*ast.GenDecl)
+				if !ok || gd.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range gd.Specs {
+					ts := spec.(*ast.TypeSpec)
+					if ts.Name.Name != t {
+						continue
+					}
+					it, ok := ts.Type.(*ast.InterfaceType)
+					if !ok {
+						return nil, fmt.Errorf("%s is not an interface", t)
+					}
+					return g.methods(f, it)
+				}
+			}
+		}
+	}
+	return nil, fmt.Errorf("interface %s not found", t)
+}
+
+func (g *generator) methods(f *ast.File, it *ast.InterfaceType) ([]method, error) {
+	var methods []method
+	for _, m := range it.Methods.List {
+		ft, ok := m.Type.(*ast.FuncType)
+		if !ok || len(m.Names) == 0 {
+			return nil, fmt.Errorf("embedded interfaces are not supported")
+		}
+
+		var params []param
+		for _, p := range ft.Params.List {
+			typ, variadic := p.Type, false
+			if e, ok := typ.(*ast.Ellipsis); ok {
+				typ, variadic = e.Elt, true
+			}
+			names := p.Names
+			if len(names) == 0 {
+				names = []*ast.Ident{nil}
+			}
+			for _, n := range names {
+				name := "arg" + strconv.Itoa(len(params))
+				if n != nil && n.Name != "_" {
+					name = n.Name
+				}
+				params = append(params, param{
+					name:     name,
+					field:    exported(name),
+					typ:      g.typeString(f, typ),
+					variadic: variadic,
+				})
+			}
+		}
+
+		var results []string
+		if ft.Results != nil {
+			for _, r := range ft.Results.List {
+				n := len(r.Names)
+				if n == 0 {
+					n = 1
+				}
+				for i := 0; i < n; i++ {
+					results = append(results, g.typeString(f, r.Type))
+				}
+			}
+		}
+
+		for _, n := range m.Names {
+			methods = append(methods, method{name: n.Name, params: params, results: results})
+		}
+	}
+	return methods, nil
+}
+
+// typeString prints the type expression of the file f qualified for the
+// generated file and records the imports it needs.
+func (g *generator) typeString(f *ast.File, e ast.Expr) string {
+	e = g.qualify(f, e)
+	var b bytes.Buffer
+	if err := printer.Fprint(&b, g.fset, e); err != nil {
+		log.Fatal(err)
+	}
+	return b.String()
+}
+
+func (g *generator) qualify(f *ast.File, e ast.Expr) ast.Expr {
+	switch t := e.(type) {
+	case *ast.Ident:
+		if ast.IsExported(t.Name) {
+			return &ast.SelectorExpr{X: ast.NewIdent(g.name), Sel: t}
+		}
+		return t
+	case *ast.SelectorExpr:
+		if x, ok := t.X.(*ast.Ident); ok {
+			g.addImport(f, x.Name)
+		}
+		return t
+	case *ast.StarExpr:
+		return &ast.StarExpr{X: g.qualify(f, t.X)}
+	case *ast.ArrayType:
+		return &ast.ArrayType{Len: t.Len, Elt: g.qualify(f, t.Elt)}
+	case *ast.MapType:
+		return &ast.MapType{Key: g.qualify(f, t.Key), Value: g.qualify(f, t.Value)}
+	case *ast.ChanType:
+		return &ast.ChanType{Dir: t.Dir, Value: g.qualify(f, t.Value)}
+	default:
+		return e
+	}
+}
+
+// addImport records the import of the file f that is referred to as name.
+func (g *generator) addImport(f *ast.File, name string) {
+	for _, s := range f.Imports {
+		p, err := strconv.Unquote(s.Path.Value)
+		if err != nil {
+			continue
+		}
+		if (s.Name != nil && s.Name.Name == name) || (s.Name == nil && path.Base(p) == name) {
+			g.imports[p] = name
+			return
+		}
+	}
+	log.Fatalf("no import for %s", name)
+}
+
+func (g *generator) writeMock(w *bytes.Buffer, t string, methods []method) {
+	mock := "Chan" + t
+
+	fmt.Fprintf(w, "// %s is a channel based mock of %s.%s.\ntype %s struct {\n", mock, g.name, t, mock)
+	for _, m := range methods {
+		fmt.Fprintf(w, "%sCalled chan bool\n", m.name)
+		if len(m.params) > 0 {
+			fmt.Fprintf(w, "%sInput struct {\n", m.name)
+			for _, p := range m.params {
+				fmt.Fprintf(w, "%s chan %s\n", p.field, p.chanType())
+			}
+			w.WriteString("}\n")
+		}
+		if len(m.results) > 0 {
+			fmt.Fprintf(w, "%sOutput struct {\n", m.name)
+			for i, r := range m.results {
+				fmt.Fprintf(w, "Ret%d chan %s\n", i, r)
+			}
+			w.WriteString("}\n")
+		}
+	}
+	w.WriteString("}\n\n")
+
+	fmt.Fprintf(w, "// New%s returns a %s.\nfunc New%s() *%s {\nm := &%s{}\n", mock, mock, mock, mock, mock)
+	for _, m := range methods {
+		fmt.Fprintf(w, "m.%sCalled = make(chan bool, chanBuffer)\n", m.name)
+		for _, p := range m.params {
+			fmt.Fprintf(w, "m.%sInput.%s = make(chan %s, chanBuffer)\n", m.name, p.field, p.chanType())
+		}
+		for i, r := range m.results {
+			fmt.Fprintf(w, "m.%sOutput.Ret%d = make(chan %s, chanBuffer)\n", m.name, i, r)
+		}
+	}
+	w.WriteString("return m\n}\n\n")
+
+	for _, m := range methods {
+		params := make([]string, 0, len(m.params))
+		for _, p := range m.params {
+			typ := p.typ
+			if p.variadic {
+				typ = "..." + typ
+			}
+			params = append(params, p.name+" "+typ)
+		}
+		results := strings.Join(m.results, ", ")
+		if len(m.results) > 1 {
+			results = "(" + results + ")"
+		}
+
+		fmt.Fprintf(w, "// %s records the call and returns the next queued values.\n", m.name)
+		fmt.Fprintf(w, "func (m *%s) %s(%s) %s {\n", mock, m.name, strings.Join(params, ", "), results)
+		fmt.Fprintf(w, "m.%sCalled <- true\n", m.name)
+		for _, p := range m.params {
+			fmt.Fprintf(w, "m.%sInput.%s <- %s\n", m.name, p.field, p.name)
+		}
+		if len(m.results) > 0 {
+			rets := make([]string, 0, len(m.results))
+			for i := range m.results {
+				rets = append(rets, fmt.Sprintf("<-m.%sOutput.Ret%d", m.name, i))
+			}
+			fmt.Fprintf(w, "return %s\n", strings.Join(rets, ", "))
+		}
+		w.WriteString("}\n\n")
+	}
+}
+
+func (p param) chanType() string {
+	if p.variadic {
+		return "[]" + p.typ
+	}
+	return p.typ
+}
+
+// std reports whether the import path is of the standard library.
+func std(importPath string) bool {
+	return !strings.Contains(strings.SplitN(importPath, "/", 2)[0], ".")
+}
+
+func exported(name string) string {
+	r := []rune(name)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
@@ -0,0 +1,149 @@
+package testhelpers
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/onsi/gomega"
+	"github.com/onsi/gomega/types"
+)
+
+// TestingT is the part of testing.T that expectation based mocks use to
+// fail a test. GinkgoT() implements it.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...any)
+}
+
+// MockTesting is a TestingT that records how it is failed or skipped, so
+// that tests can check the failure paths of code that reports to a
+// testing.T. Unlike testing.T, Fatal, Fatalf and Skip do not stop the
+// calling goroutine.
+type MockTesting struct {
+	mu      sync.Mutex
+	errors  []string
+	failed  bool
+	fatal   bool
+	skipped bool
+	skipMsg string
+}
+
+// Helper does nothing.
+func (m *MockTesting) Helper() {}
+
+// Error records the error.
+func (m *MockTesting) Error(args ...any) {
+	m.record(false, fmt.Sprint(args...))
+}
+
+// Errorf records the error.
+func (m *MockTesting) Errorf(format string, args ...any) {
+	m.record(false, fmt.Sprintf(format, args...))
+}
+
+// Fatal records the error and that the test was stopped.
+func (m *MockTesting) Fatal(args ...any) {
+	m.record(true, fmt.Sprint(args...))
+}
+
+// Fatalf records the error and that the test was stopped.
+func (m *MockTesting) Fatalf(format string, args ...any) {
+	m.record(true, fmt.Sprintf(format, args...))
+}
+
+// Fail records that the test failed without an error.
+func (m *MockTesting) Fail() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failed = true
+}
+
+// FailNow records that the test failed and was stopped.
+func (m *MockTesting) FailNow() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failed = true
+	m.fatal = true
+}
+
+// Skip records that the test was skipped.
+func (m *MockTesting) Skip(args ...any) {
+	m.skip(fmt.Sprint(args...))
+}
+
+// Skipf records that the test was skipped.
+func (m *MockTesting) Skipf(format string, args ...any) {
+	m.skip(fmt.Sprintf(format, args...))
+}
+
+// SkipNow records that the test was skipped.
+func (m *MockTesting) SkipNow() {
+	m.skip("")
+}
+
+func (m *MockTesting) record(fatal bool, msg string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.errors = append(m.errors, msg)
+	m.failed = true
+	m.fatal = m.fatal || fatal
+}
+
+func (m *MockTesting) skip(msg string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.skipped = true
+	m.skipMsg = msg
+}
+
+// Errors returns the recorded errors, including those of Fatal and Fatalf.
+func (m *MockTesting) Errors() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.errors...)
+}
+
+// Failed reports whether the test failed.
+func (m *MockTesting) Failed() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.failed
+}
+
+// Stopped reports whether the test would have been stopped by Fatal, Fatalf
+// or FailNow.
+func (m *MockTesting) Stopped() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.fatal
+}
+
+// Skipped reports whether the test was skipped.
+func (m *MockTesting) Skipped() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.skipped
+}
+
+// SkipMessage returns the message the test was skipped with.
+func (m *MockTesting) SkipMessage() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.skipMsg
+}
+
+// ExpectError asserts that an error matching the matcher was recorded. A
+// string matcher is matched with gomega.ContainSubstring.
+func (m *MockTesting) ExpectError(matcher any) {
+	if s, ok := matcher.(string); ok {
+		matcher = gomega.ContainSubstring(s)
+	}
+	gomega.ExpectWithOffset(1, m.Errors()).To(gomega.ContainElement(matcher), "no matching error was recorded")
+}
+
+// ExpectNoError asserts that no error was recorded.
+func (m *MockTesting) ExpectNoError() {
+	gomega.ExpectWithOffset(1, m.Errors()).To(gomega.BeEmpty(), "unexpected errors were recorded")
+}
+
+var _ types.GomegaTestingT = (*MockTesting)(nil)
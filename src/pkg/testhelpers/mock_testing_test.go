@@ -0,0 +1,66 @@
+package testhelpers_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/testhelpers"
+)
+
+var _ = Describe("MockTesting", func() {
+	var t *testhelpers.MockTesting
+
+	BeforeEach(func() {
+		t = &testhelpers.MockTesting{}
+	})
+
+	It("starts out passed and not skipped", func() {
+		Expect(t.Failed()).To(BeFalse())
+		Expect(t.Stopped()).To(BeFalse())
+		Expect(t.Skipped()).To(BeFalse())
+		t.ExpectNoError()
+	})
+
+	It("records errors", func() {
+		t.Errorf("some-error: %d", 1)
+
+		Expect(t.Failed()).To(BeTrue())
+		Expect(t.Stopped()).To(BeFalse())
+		t.ExpectError("some-error: 1")
+		t.ExpectError(HavePrefix("some-"))
+	})
+
+	It("records fatal errors", func() {
+		t.Fatalf("fatal-error: %d", 1)
+		t.Fatal("other-error")
+
+		Expect(t.Failed()).To(BeTrue())
+		Expect(t.Stopped()).To(BeTrue())
+		Expect(t.Errors()).To(Equal([]string{"fatal-error: 1", "other-error"}))
+	})
+
+	It("records failures without errors", func() {
+		t.FailNow()
+
+		Expect(t.Failed()).To(BeTrue())
+		Expect(t.Stopped()).To(BeTrue())
+		Expect(t.Errors()).To(BeEmpty())
+	})
+
+	It("records skips", func() {
+		t.Skipf("not on %s", "windows")
+
+		Expect(t.Skipped()).To(BeTrue())
+		Expect(t.SkipMessage()).To(Equal("not on windows"))
+		Expect(t.Failed()).To(BeFalse())
+	})
+
+	It("fails ExpectError if no error matches", func() {
+		t.Errorf("some-error")
+
+		failures := InterceptGomegaFailures(func() {
+			t.ExpectError("other-error")
+		})
+		Expect(failures).To(HaveLen(1))
+	})
+})